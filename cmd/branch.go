@@ -0,0 +1,950 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/color"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/wildmatch"
+)
+
+// branchColors are the default colors of color.branch.<slot>.
+var branchColors = map[string]string{
+	"plain":    "",
+	"current":  "green",
+	"local":    "",
+	"remote":   "red",
+	"upstream": "blue",
+}
+
+// branchOptions are the options of branch.
+type branchOptions struct {
+	mode     string // "list", "delete", "rename", "upstream", "unset-upstream" or "show-current"; "" creates
+	force    bool
+	quiet    bool
+	remotes  bool // -r
+	all      bool // -a
+	verbose  int
+	abbrev   int // -1 for the default
+	track    string
+	upstream string // of -u
+	color    string
+	format   string
+	sortKeys []string
+
+	merged, noMerged, contains, noContains []string
+}
+
+// setMode records the action asked for; asking for two is an error.
+func (o *branchOptions) setMode(mode string) int {
+	if o.mode != "" && o.mode != mode {
+		return usage("options '%s' and '%s' cannot be used together", o.mode, mode)
+	}
+	o.mode = mode
+	return 0
+}
+
+// parseArgs applies the options and returns the other arguments.
+func (o *branchOptions) parseArgs(args []string) ([]string, int) {
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			rest = append(rest, arg)
+			continue
+		}
+		name, value, hasValue := arg, "", false
+		if j := strings.IndexByte(arg, '='); j >= 0 && strings.HasPrefix(arg, "--") {
+			name, value, hasValue = arg[:j], arg[j+1:], true
+		}
+		// lastArgDefault takes the next argument as the value, HEAD
+		// when there is none.
+		lastArgDefault := func() string {
+			switch {
+			case hasValue:
+				return value
+			case i+1 < len(args):
+				i++
+				return args[i]
+			}
+			return refs.HEAD
+		}
+		required := func() (string, bool) {
+			switch {
+			case hasValue:
+				return value, true
+			case i+1 < len(args):
+				i++
+				return args[i], true
+			}
+			return "", false
+		}
+		code := 0
+		switch name {
+		case "--delete":
+			code = o.setMode("delete")
+		case "--move":
+			code = o.setMode("rename")
+		case "--list":
+			code = o.setMode("list")
+		case "--show-current":
+			code = o.setMode("show-current")
+		case "--unset-upstream":
+			code = o.setMode("unset-upstream")
+		case "--set-upstream-to":
+			v, ok := required()
+			if !ok {
+				return nil, usage("option `set-upstream-to' requires a value")
+			}
+			o.upstream = v
+			code = o.setMode("upstream")
+		case "--force":
+			o.force = true
+		case "--quiet":
+			o.quiet = true
+		case "--remotes":
+			o.remotes = true
+		case "--all":
+			o.all = true
+		case "--verbose":
+			o.verbose++
+		case "--track":
+			o.track = "direct"
+			if hasValue && value != "direct" {
+				return nil, usage("option `track' expects \"direct\" or \"inherit\"")
+			}
+		case "--no-track":
+			o.track = "no"
+		case "--color":
+			o.color = "always"
+			if hasValue {
+				o.color = value
+			}
+		case "--no-color":
+			o.color = "never"
+		case "--abbrev":
+			n, err := strconv.Atoi(value)
+			if !hasValue || err != nil {
+				return nil, usage("option `abbrev' expects a numerical value")
+			}
+			o.abbrev = n
+		case "--no-abbrev":
+			o.abbrev = 0
+		case "--format":
+			v, ok := required()
+			if !ok {
+				return nil, usage("option `format' requires a value")
+			}
+			o.format = v
+		case "--sort":
+			v, ok := required()
+			if !ok {
+				return nil, usage("option `sort' requires a value")
+			}
+			o.sortKeys = append(o.sortKeys, v)
+		case "--merged":
+			o.merged = append(o.merged, lastArgDefault())
+		case "--no-merged":
+			o.noMerged = append(o.noMerged, lastArgDefault())
+		case "--contains", "--with":
+			o.contains = append(o.contains, lastArgDefault())
+		case "--no-contains", "--without":
+			o.noContains = append(o.noContains, lastArgDefault())
+		default:
+			if strings.HasPrefix(arg, "--") {
+				return nil, usage("unknown option `%s'", strings.TrimPrefix(arg, "--"))
+			}
+			// Bundled short options like -avv or -dr.
+			for j := 1; j < len(arg) && code == 0; j++ {
+				switch c := arg[j]; c {
+				case 'd':
+					code = o.setMode("delete")
+				case 'D':
+					o.force = true
+					code = o.setMode("delete")
+				case 'm':
+					code = o.setMode("rename")
+				case 'M':
+					o.force = true
+					code = o.setMode("rename")
+				case 'l':
+					code = o.setMode("list")
+				case 'f':
+					o.force = true
+				case 'q':
+					o.quiet = true
+				case 'r':
+					o.remotes = true
+				case 'a':
+					o.all = true
+				case 'v':
+					o.verbose++
+				case 't':
+					o.track = "direct"
+				case 'u':
+					if j+1 < len(arg) {
+						o.upstream = arg[j+1:]
+					} else if i+1 < len(args) {
+						i++
+						o.upstream = args[i]
+					} else {
+						return nil, usage("switch `u' requires a value")
+					}
+					j = len(arg)
+					code = o.setMode("upstream")
+				default:
+					return nil, usage("unknown switch `%c'", c)
+				}
+			}
+		}
+		if code != 0 {
+			return nil, code
+		}
+	}
+	return rest, 0
+}
+
+// Branch implements "branch": it lists, creates, deletes and renames
+// branches and sets what they track.
+// ref: https://git-scm.com/docs/git-branch
+func Branch(args []string) int {
+	o := &branchOptions{abbrev: -1}
+	rest, code := o.parseArgs(args)
+	if code != 0 {
+		return code
+	}
+	filtering := len(o.merged)+len(o.noMerged)+len(o.contains)+len(o.noContains) > 0 || o.verbose > 0
+	if o.mode == "" && (len(rest) == 0 || filtering) {
+		o.mode = "list"
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return die("%v", err)
+	}
+	switch o.mode {
+	case "list":
+		return listBranches(repo, cfg, o, rest)
+	case "delete":
+		return deleteBranches(repo, cfg, o, rest)
+	case "rename":
+		return renameBranch(repo, o, rest)
+	case "upstream":
+		return setUpstreamTo(repo, cfg, o, rest)
+	case "unset-upstream":
+		return unsetUpstream(repo, cfg, rest)
+	case "show-current":
+		if len(rest) > 0 {
+			return die("branch name not allowed with --show-current")
+		}
+		if name := headBranch(repo); name != "" {
+			fmt.Println(name)
+		}
+		return 0
+	}
+	if o.remotes || o.all {
+		return die("the -a, and -r, options to 'git branch' do not take a branch name.\nDid you mean to use: -a|-r --list <pattern>?")
+	}
+	if len(rest) > 2 {
+		return usage("too many arguments")
+	}
+	return createBranch(repo, cfg, o, rest)
+}
+
+// headBranch is the branch HEAD points to, "" when detached.
+func headBranch(repo *repository.Repository) string {
+	head, err := repo.Refs().Read(refs.HEAD)
+	if err != nil || !strings.HasPrefix(head.Symref, "refs/heads/") {
+		return ""
+	}
+	return strings.TrimPrefix(head.Symref, "refs/heads/")
+}
+
+// branchName expands "@{-N}" to the branch checked out before.
+func branchName(repo *repository.Repository, name string) string {
+	if strings.HasPrefix(name, "@{-") {
+		if expanded, err := expandPriorCheckout(repo, name); err == nil && expanded != "" {
+			return expanded
+		}
+	}
+	return name
+}
+
+// checkedOut refuses to touch the current branch of the work tree.
+func checkedOut(repo *repository.Repository, branch, what string) error {
+	if !repo.IsBare() && headBranch(repo) == branch {
+		return fmt.Errorf("%s '%s' checked out at '%s'", what, branch, repo.WorkTree)
+	}
+	return nil
+}
+
+// branchStart resolves the start point of a new branch and checks that
+// it can be tracked when tracking is asked for explicitly.
+// ref: dwim_branch_start in https://github.com/git/git/blob/master/branch.c
+func branchStart(repo *repository.Repository, cfg *config.Config, start string, explicit bool) (string, int) {
+	sha, err := resolveRevision(repo, start)
+	if err != nil {
+		if explicit {
+			return "", upstreamMissing(cfg, start)
+		}
+		return "", die("not a valid object name: '%s'", start)
+	}
+	if explicit {
+		if _, _, ok := upstreamFor(repo, cfg, start); !ok {
+			return "", die("cannot set up tracking information; starting point '%s' is not a branch", start)
+		}
+	}
+	commit, typ, err := peel(repo.Objects(), sha)
+	if err != nil || typ != "commit" {
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "error: object %s is a %s, not a commit\n", commit, typ)
+		}
+		return "", die("not a valid branch point: '%s'", start)
+	}
+	return commit, 0
+}
+
+// upstreamMissing explains that the upstream asked for doesn't exist.
+func upstreamMissing(cfg *config.Config, name string) int {
+	code := die("the requested upstream branch '%s' does not exist", name)
+	if advice, _ := cfg.Bool("advice.setUpstreamFailure", true); advice {
+		fmt.Fprint(os.Stderr, "hint: \n"+
+			"hint: If you are planning on basing your work on an upstream\n"+
+			"hint: branch that already exists at the remote, you may need to\n"+
+			"hint: run \"git fetch\" to retrieve it.\n"+
+			"hint: \n"+
+			"hint: If you are planning to push out a new local branch that\n"+
+			"hint: will track its remote counterpart, you may want to use\n"+
+			"hint: \"git push -u\" to set the upstream config as you push.\n"+
+			"hint: Disable this message with \"git config advice.setUpstreamFailure false\"\n")
+	}
+	return code
+}
+
+// createBranch makes a branch at a start point, HEAD by default, or
+// with --force moves an existing one.
+// ref: create_branch in https://github.com/git/git/blob/master/branch.c
+func createBranch(repo *repository.Repository, cfg *config.Config, o *branchOptions, args []string) int {
+	name := branchName(repo, args[0])
+	start := headBranch(repo)
+	if start == "" {
+		start = refs.HEAD
+	}
+	if len(args) == 2 {
+		start = args[1]
+	}
+	if err := checkNewBranch(repo, name, o.force); err != nil {
+		return die("%v", err)
+	}
+	ref := "refs/heads/" + name
+	existed := repo.Refs().Exists(ref)
+	if existed {
+		if err := checkedOut(repo, name, "cannot force update the branch"); err != nil {
+			return die("%v", err)
+		}
+	}
+	commit, code := branchStart(repo, cfg, start, o.track == "direct")
+	if code != 0 {
+		return code
+	}
+	msg, old := "branch: Created from "+start, repo.Format.ZeroHex()
+	if existed {
+		msg, old = "branch: Reset to "+start, ""
+	}
+	if err := repo.Refs().Update(ref, commit, old, msg, true); err != nil {
+		return die("%v", err)
+	}
+	if err := setupTrackingFor(repo, cfg, name, start, o.track, o.quiet); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// deleteBranches deletes local branches, or with -r remote-tracking
+// ones. Without --force a local branch must be merged into its upstream,
+// or into HEAD when it has none.
+// ref: delete_branches in https://github.com/git/git/blob/master/builtin/branch.c
+func deleteBranches(repo *repository.Repository, cfg *config.Config, o *branchOptions, names []string) int {
+	if len(names) == 0 {
+		return die("branch name required")
+	}
+	prefix, what := "refs/heads/", "branch"
+	if o.remotes {
+		prefix, what = "refs/remotes/", "remote-tracking branch"
+	}
+	head := ""
+	if resolved, err := repo.Refs().Resolve(refs.HEAD); err == nil {
+		head = resolved.Target
+	}
+	code := 0
+	for _, name := range names {
+		name = branchName(repo, name)
+		full := prefix + name
+		if !o.remotes {
+			if err := checkedOut(repo, name, "Cannot delete branch"); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				code = 1
+				continue
+			}
+		}
+		ref, err := repo.Refs().Read(full)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s '%s' not found.\n", what, name)
+			code = 1
+			continue
+		}
+		was := ref.Symref
+		if !ref.IsSymbolic() {
+			was = repo.Objects().Abbrev(ref.Target, defaultAbbrev(repo))
+			if !o.force && !o.remotes {
+				merged, err := branchMerged(repo, name, ref.Target, head)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: Couldn't look up commit object for '%s'\n", full)
+					code = 1
+					continue
+				}
+				if !merged {
+					fmt.Fprintf(os.Stderr, "error: The branch '%s' is not fully merged.\nIf you are sure you want to delete it, run 'git branch -D %s'.\n", name, name)
+					code = 1
+					continue
+				}
+			}
+		}
+		if err := repo.Refs().Delete(full, "", true); err != nil {
+			fmt.Fprintf(os.Stderr, "error: Error deleting %s '%s'\n", what, name)
+			code = 1
+			continue
+		}
+		if !o.remotes {
+			if err := removeBranchConfig(repo, name); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: Update of config-file failed\n")
+			}
+		}
+		if !o.quiet {
+			if o.remotes {
+				fmt.Printf("Deleted remote-tracking branch %s (was %s).\n", name, was)
+			} else {
+				fmt.Printf("Deleted branch %s (was %s).\n", name, was)
+			}
+		}
+	}
+	return code
+}
+
+// branchMerged reports whether a branch at sha is merged into its
+// upstream, or into HEAD when it has none, warning when HEAD disagrees.
+// ref: branch_merged in https://github.com/git/git/blob/master/builtin/branch.c
+func branchMerged(repo *repository.Repository, name, sha, head string) (bool, error) {
+	reference, referenceName := head, ""
+	if upstream, err := trackingRef(repo, name, false); err == nil {
+		if resolved, err := repo.Refs().Resolve(upstream); err == nil {
+			if commit, typ, err := peel(repo.Objects(), resolved.Target); err == nil && typ == "commit" {
+				reference, referenceName = commit, upstream
+			}
+		}
+	}
+	if _, typ, err := peel(repo.Objects(), sha); err != nil || typ != "commit" {
+		return false, fmt.Errorf("not a commit: %s", sha)
+	}
+	merged := false
+	if reference != "" {
+		var err error
+		if merged, err = merge.IsAncestor(repo.Objects(), sha, reference); err != nil {
+			return false, err
+		}
+	}
+	if reference != head {
+		mergedToHead := false
+		if head != "" {
+			var err error
+			if mergedToHead, err = merge.IsAncestor(repo.Objects(), sha, head); err != nil {
+				return false, err
+			}
+		}
+		switch {
+		case merged && !mergedToHead:
+			fmt.Fprintf(os.Stderr, "warning: deleting branch '%s' that has been merged to\n         '%s', but not yet merged to HEAD.\n", name, referenceName)
+		case !merged && mergedToHead:
+			fmt.Fprintf(os.Stderr, "warning: not deleting branch '%s' that is not yet merged to\n         '%s', even though it is merged to HEAD.\n", name, referenceName)
+		}
+	}
+	return merged, nil
+}
+
+// removeBranchConfig drops the branch.<name> section.
+func removeBranchConfig(repo *repository.Repository, name string) error {
+	f, err := config.ReadFile(repo.Path("config"), config.ScopeLocal)
+	if err != nil {
+		return err
+	}
+	if removed, err := f.RemoveSection("branch", name); err != nil || !removed {
+		return err
+	}
+	return f.Save()
+}
+
+// renameBranch implements "branch -m [<old>] <new>": the branch, its
+// reflog and its configuration move to the new name, and HEAD follows.
+// ref: copy_or_rename_branch in https://github.com/git/git/blob/master/builtin/branch.c
+func renameBranch(repo *repository.Repository, o *branchOptions, args []string) int {
+	var oldName, newName string
+	switch len(args) {
+	case 0:
+		return die("branch name required")
+	case 1:
+		if oldName = headBranch(repo); oldName == "" {
+			return die("cannot rename the current branch while not on any.")
+		}
+		newName = args[0]
+	case 2:
+		oldName, newName = branchName(repo, args[0]), args[1]
+	default:
+		return die("too many arguments for a rename operation")
+	}
+	newName = branchName(repo, newName)
+	oldRef, newRef := "refs/heads/"+oldName, "refs/heads/"+newName
+	current := headBranch(repo) == oldName
+	if !repo.Refs().Exists(oldRef) {
+		// Only the unborn current branch may be missing.
+		if !current {
+			return die("No branch named '%s'.", oldName)
+		}
+	}
+	if oldName != newName {
+		if err := checkNewBranch(repo, newName, o.force); err != nil {
+			return die("%v", err)
+		}
+		if repo.Refs().Exists(newRef) {
+			if err := checkedOut(repo, newName, "cannot force update the branch"); err != nil {
+				return die("%v", err)
+			}
+		}
+	} else if !refs.ValidName(newRef) {
+		return die("'%s' is not a valid branch name", newName)
+	}
+	msg := fmt.Sprintf("Branch: renamed %s to %s", oldRef, newRef)
+	if repo.Refs().Exists(oldRef) {
+		if err := refs.Rename(repo.Refs(), oldRef, newRef, msg); err != nil {
+			return die("branch rename failed: %v", err)
+		}
+	}
+	if current && oldName != newName {
+		if err := repo.Refs().SetSymbolic(refs.HEAD, newRef, msg); err != nil {
+			return die("branch renamed to %s, but HEAD is not updated!", newName)
+		}
+	}
+	if oldName == newName {
+		return 0
+	}
+	f, err := config.ReadFile(repo.Path("config"), config.ScopeLocal)
+	if err == nil {
+		if _, err = f.RenameSection("branch", oldName, "branch", newName); err == nil {
+			err = f.Save()
+		}
+	}
+	if err != nil {
+		return die("Branch is renamed, but update of config-file failed")
+	}
+	return 0
+}
+
+// setUpstreamTo implements "branch -u <upstream> [<branch>]".
+func setUpstreamTo(repo *repository.Repository, cfg *config.Config, o *branchOptions, args []string) int {
+	if len(args) > 1 {
+		return die("too many arguments to set new upstream")
+	}
+	name := headBranch(repo)
+	if len(args) == 1 {
+		name = branchName(repo, args[0])
+	} else if name == "" {
+		return die("could not set upstream of HEAD to %s when it does not point to any branch.", o.upstream)
+	}
+	if !repo.Refs().Exists("refs/heads/" + name) {
+		if len(args) == 0 {
+			return die("no commit on branch '%s' yet", name)
+		}
+		return die("branch '%s' does not exist", name)
+	}
+	if _, code := branchStart(repo, cfg, o.upstream, true); code != 0 {
+		return code
+	}
+	if err := setupTrackingFor(repo, cfg, name, o.upstream, "direct", o.quiet); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// unsetUpstream implements "branch --unset-upstream [<branch>]".
+func unsetUpstream(repo *repository.Repository, cfg *config.Config, args []string) int {
+	if len(args) > 1 {
+		return die("too many arguments to unset upstream")
+	}
+	name := headBranch(repo)
+	if len(args) == 1 {
+		name = branchName(repo, args[0])
+	} else if name == "" {
+		return die("could not unset upstream of HEAD when it does not point to any branch.")
+	}
+	if !repo.Refs().Exists("refs/heads/" + name) {
+		return die("branch '%s' does not exist", name)
+	}
+	if _, ok := cfg.Get("branch." + name + ".merge"); !ok {
+		return die("Branch '%s' has no upstream information", name)
+	}
+	f, err := config.ReadFile(repo.Path("config"), config.ScopeLocal)
+	if err != nil {
+		return die("%v", err)
+	}
+	for _, key := range []string{"branch." + name + ".remote", "branch." + name + ".merge"} {
+		if _, err := f.Unset(key, true); err != nil {
+			return die("%v", err)
+		}
+	}
+	if err := f.Save(); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// branchItem is a branch to list.
+type branchItem struct {
+	*refItem
+	kind string // "local", "remote" or "detached"
+	name string // as shown
+}
+
+// listBranches lists the branches matching the patterns and filters,
+// sorted by name with a detached HEAD first.
+// ref: print_ref_list in https://github.com/git/git/blob/master/builtin/branch.c
+func listBranches(repo *repository.Repository, cfg *config.Config, o *branchOptions, patterns []string) int {
+	filters := map[*[]string][]string{}
+	for _, list := range []*[]string{&o.merged, &o.noMerged, &o.contains, &o.noContains} {
+		for _, rev := range *list {
+			sha, err := resolveRevisionAs(repo, rev, "commit")
+			if err != nil {
+				return usage("malformed object name %s", rev)
+			}
+			filters[list] = append(filters[list], sha)
+		}
+	}
+	var items []*branchItem
+	add := func(ref *refs.Ref, sha, kind, name string) error {
+		if len(patterns) > 0 && !matchesBranchPattern(name, patterns) {
+			return nil
+		}
+		if len(filters) > 0 {
+			ok, err := passesBranchFilters(repo, sha, o, filters)
+			if err != nil || !ok {
+				return err
+			}
+		}
+		items = append(items, &branchItem{refItem: &refItem{repo: repo, ref: ref, sha: sha}, kind: kind, name: name})
+		return nil
+	}
+
+	head, err := repo.Refs().Read(refs.HEAD)
+	if err != nil {
+		return die("%v", err)
+	}
+	kinds := []string{}
+	if !o.remotes || o.all {
+		kinds = append(kinds, "local")
+		if resolved, err := repo.Refs().Resolve(refs.HEAD); err == nil && !head.IsSymbolic() {
+			desc := headDescription(repo, resolved.Target)
+			if err := add(&refs.Ref{Name: desc, Target: resolved.Target}, resolved.Target, "detached", refs.HEAD); err != nil {
+				return die("%v", err)
+			}
+		}
+	}
+	if o.remotes || o.all {
+		kinds = append(kinds, "remote")
+	}
+	for _, kind := range kinds {
+		prefix := "refs/heads/"
+		if kind == "remote" {
+			prefix = "refs/remotes/"
+		}
+		list, err := repo.Refs().List(prefix)
+		if err != nil {
+			return die("%v", err)
+		}
+		for _, ref := range list {
+			sha := ""
+			if resolved, err := repo.Refs().Resolve(ref.Name); err == nil {
+				sha = resolved.Target
+			} else if !ref.IsSymbolic() {
+				continue
+			}
+			if err := add(ref, sha, kind, strings.TrimPrefix(ref.Name, prefix)); err != nil {
+				return die("%v", err)
+			}
+		}
+	}
+
+	sortKeys := o.sortKeys
+	if len(sortKeys) == 0 {
+		sortKeys = cfg.GetAll("branch.sort")
+	}
+	if len(sortKeys) == 0 {
+		sortKeys = []string{"refname"}
+	}
+	list := make([]*refItem, len(items))
+	byRef := map[*refItem]*branchItem{}
+	for i, item := range items {
+		item.head = head.Symref
+		if item.kind == "detached" {
+			item.head = item.ref.Name
+		}
+		list[i] = item.refItem
+		byRef[item.refItem] = item
+	}
+	for _, key := range sortKeys {
+		if err := sortRefItems(list, key); err != nil {
+			return die("%v", err)
+		}
+	}
+	sorted := []*branchItem{}
+	for _, r := range list {
+		if item := byRef[r]; item.kind == "detached" {
+			sorted = append([]*branchItem{item}, sorted...)
+		} else {
+			sorted = append(sorted, item)
+		}
+	}
+
+	if o.format != "" {
+		format, err := parseRefFormat(o.format)
+		if err != nil {
+			return die("%v", err)
+		}
+		for _, item := range sorted {
+			line := ""
+			for _, fi := range format {
+				if fi.atom == "" {
+					line += fi.literal
+					continue
+				}
+				value, err := item.atom(fi)
+				if err != nil {
+					return die("%v", err)
+				}
+				line += value
+			}
+			fmt.Println(line)
+		}
+		return 0
+	}
+
+	setting := o.color
+	if setting == "" {
+		setting = color.Setting(cfg, "color.branch")
+	}
+	colors := map[string]string{}
+	if color.Use(setting, os.Stdout) {
+		for slot, def := range branchColors {
+			value, ok := cfg.Get("color.branch." + slot)
+			if !ok {
+				value = def
+			}
+			if colors[slot], err = color.Parse(value); err != nil {
+				return die("%v", err)
+			}
+		}
+		colors["reset"] = color.Reset
+	}
+	remotePrefix := ""
+	if o.all {
+		remotePrefix = "remotes/"
+	}
+	width := 0
+	if o.verbose > 0 {
+		for _, item := range sorted {
+			w := len(item.shownName(remotePrefix))
+			if w > width {
+				width = w
+			}
+		}
+	}
+	for _, item := range sorted {
+		line, err := item.line(o, colors, remotePrefix, width)
+		if err != nil {
+			return die("%v", err)
+		}
+		fmt.Println(line)
+	}
+	return 0
+}
+
+// matchesBranchPattern globs a branch name, the whole name of a
+// remote-tracking branch, or HEAD for a detached HEAD.
+func matchesBranchPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if wildmatch.Match(pattern, name, 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// passesBranchFilters applies --merged, --no-merged, --contains and
+// --no-contains to the commit a branch points to.
+func passesBranchFilters(repo *repository.Repository, sha string, o *branchOptions, filters map[*[]string][]string) (bool, error) {
+	commit, typ, err := peel(repo.Objects(), sha)
+	if err != nil || typ != "commit" {
+		return false, nil
+	}
+	any := func(list *[]string, test func(string) (bool, error)) (bool, error) {
+		for _, other := range filters[list] {
+			if ok, err := test(other); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+	mergedInto := func(other string) (bool, error) { return merge.IsAncestor(repo.Objects(), commit, other) }
+	contains := func(other string) (bool, error) { return merge.IsAncestor(repo.Objects(), other, commit) }
+	for _, check := range []struct {
+		list *[]string
+		test func(string) (bool, error)
+		want bool
+	}{
+		{&o.merged, mergedInto, true},
+		{&o.noMerged, mergedInto, false},
+		{&o.contains, contains, true},
+		{&o.noContains, contains, false},
+	} {
+		if len(filters[check.list]) == 0 {
+			continue
+		}
+		ok, err := any(check.list, check.test)
+		if err != nil {
+			return false, err
+		}
+		if ok != check.want {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// headDescription names a detached HEAD after the last checkout that
+// moved it, as "(HEAD detached at <name>)" while it is still there.
+// ref: wt_status_get_detached_from in https://github.com/git/git/blob/master/wt-status.c
+func headDescription(repo *repository.Repository, head string) string {
+	entries, _ := repo.Refs().ReadReflog(refs.HEAD)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		msg := strings.TrimPrefix(e.Message, "checkout: moving from ")
+		to := strings.Index(msg, " to ")
+		if msg == e.Message || to < 0 {
+			continue
+		}
+		target := msg[to+len(" to "):]
+		from := repo.Objects().Abbrev(e.New, defaultAbbrev(repo))
+		if target != refs.HEAD {
+			if full, ok := dwimRef(repo, target); ok {
+				if resolved, err := repo.Refs().Resolve(full); err == nil {
+					commit, _, _ := peel(repo.Objects(), resolved.Target)
+					if resolved.Target == e.New || commit == e.New {
+						from = strings.TrimPrefix(full, "refs/tags/")
+						from = strings.TrimPrefix(from, "refs/remotes/")
+					}
+				}
+			}
+		}
+		if e.New == head {
+			return "(HEAD detached at " + from + ")"
+		}
+		return "(HEAD detached from " + from + ")"
+	}
+	return "(no branch)"
+}
+
+// shownName is the name of the item in the listing, which sets the
+// width of the column of names.
+func (b *branchItem) shownName(remotePrefix string) string {
+	switch b.kind {
+	case "detached":
+		return b.ref.Name
+	case "remote":
+		return remotePrefix + b.name
+	}
+	return b.name
+}
+
+// line formats one branch of the listing.
+// ref: build_format in https://github.com/git/git/blob/master/builtin/branch.c
+func (b *branchItem) line(o *branchOptions, colors map[string]string, remotePrefix string, width int) (string, error) {
+	name := b.shownName(remotePrefix)
+	if width > 0 {
+		name += strings.Repeat(" ", width-len(name))
+	}
+	var line string
+	switch {
+	case b.kind == "remote":
+		line = "  " + colors["remote"] + name + colors["reset"]
+	case b.ref.Name == b.head:
+		line = "* " + colors["current"] + name + colors["reset"]
+	default:
+		line = "  " + colors["local"] + name + colors["reset"]
+	}
+	if b.ref.IsSymbolic() && (b.kind == "remote" || o.verbose == 0) {
+		return line + " -> " + refs.Shorten(b.ref.Symref, b.repo.Refs().Exists), nil
+	}
+	if o.verbose == 0 {
+		return line, nil
+	}
+	abbrev := b.repo.Objects().Abbrev(b.sha, defaultAbbrev(b.repo))
+	switch {
+	case o.abbrev == 0:
+		abbrev = b.sha
+	case o.abbrev > 0:
+		abbrev = b.repo.Objects().Abbrev(b.sha, o.abbrev)
+	}
+	line += " " + abbrev + " "
+	if b.kind == "local" {
+		if o.verbose > 1 {
+			upstream, err := b.atom(formatItem{atom: "upstream", arg: "short"})
+			if err != nil {
+				return "", err
+			}
+			if upstream != "" {
+				track, err := b.atom(formatItem{atom: "upstream", arg: "track,nobracket"})
+				if err != nil {
+					return "", err
+				}
+				line += "[" + colors["upstream"] + upstream + colors["reset"]
+				if track != "" {
+					line += ": " + track
+				}
+				line += "] "
+			}
+		} else {
+			track, err := b.atom(formatItem{atom: "upstream", arg: "track"})
+			if err != nil {
+				return "", err
+			}
+			if track != "" {
+				line += track + " "
+			}
+		}
+	}
+	subject, err := b.atom(formatItem{atom: "contents", arg: "subject"})
+	if err != nil {
+		return "", err
+	}
+	return line + subject, nil
+}
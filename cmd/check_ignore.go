@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/ignore"
+)
+
+// CheckIgnore implements "check-ignore".
+// ref: https://git-scm.com/docs/git-check-ignore
+func CheckIgnore(args []string) int {
+	verbose, nonMatching, quiet, stdin, null := false, false, false, false, false
+	paths := []string{}
+	for i, arg := range args {
+		switch arg {
+		case "-v", "--verbose":
+			verbose = true
+		case "-n", "--non-matching":
+			nonMatching = true
+		case "-q", "--quiet":
+			quiet = true
+		case "--stdin":
+			stdin = true
+		case "-z":
+			null = true
+		case "--no-index":
+			// There is no index to consult, every path is checked.
+		case "--":
+			paths = append(paths, args[i+1:]...)
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+			}
+			paths = append(paths, arg)
+		}
+		if arg == "--" {
+			break
+		}
+	}
+	if nonMatching && !verbose {
+		return die("--non-matching is only valid with --verbose")
+	}
+	if quiet && verbose {
+		return die("cannot have both --quiet and --verbose")
+	}
+	if stdin && len(paths) > 0 {
+		return die("cannot specify pathnames with --stdin")
+	}
+	if !stdin && len(paths) == 0 {
+		return die("no path specified")
+	}
+
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	if repo.IsBare() {
+		return die("this operation must be run in a work tree")
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return die("%v", err)
+	}
+	matcher, err := ignore.New(repo.WorkTree, repo.GitDir, cfg)
+	if err != nil {
+		return die("%v", err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	terminator := "\n"
+	if null {
+		terminator = "\x00"
+	}
+	matched := 0
+	check := func(arg string) int {
+		rel := path.Join(repo.Prefix, filepath.ToSlash(arg))
+		if strings.HasPrefix(rel, "../") || rel == ".." {
+			return die("%s: '%s' is outside repository at '%s'", arg, arg, repo.WorkTree)
+		}
+		info, err := os.Stat(filepath.Join(repo.WorkTree, filepath.FromSlash(rel)))
+		isDir := (err == nil && info.IsDir()) || strings.HasSuffix(arg, "/")
+		p := matcher.Match(rel, isDir)
+		if p != nil && !p.Negated() {
+			matched++
+		}
+		if quiet {
+			return 0
+		}
+		switch {
+		case verbose && p != nil:
+			fmt.Fprintf(out, "%s:%d:%s\t%s%s", displaySource(repo.WorkTree, p.Source), p.Line, p.Raw, arg, terminator)
+		case verbose && nonMatching:
+			fmt.Fprintf(out, "::\t%s%s", arg, terminator)
+		case p != nil && !p.Negated():
+			fmt.Fprintf(out, "%s%s", arg, terminator)
+		}
+		return 0
+	}
+
+	if stdin {
+		scanner := bufio.NewScanner(os.Stdin)
+		if null {
+			scanner.Split(scanNull)
+		}
+		for scanner.Scan() {
+			if code := check(scanner.Text()); code != 0 {
+				return code
+			}
+			// Let callers reading our output interactively see each answer.
+			out.Flush()
+		}
+	} else {
+		for _, arg := range paths {
+			if code := check(arg); code != 0 {
+				return code
+			}
+		}
+	}
+	if matched == 0 {
+		return 1
+	}
+	return 0
+}
+
+// displaySource shows pattern files inside the work tree relative to it,
+// like git does.
+func displaySource(workTree, source string) string {
+	if !filepath.IsAbs(source) {
+		return source
+	}
+	if rel, err := filepath.Rel(workTree, source); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return source
+}
+
+func scanNull(data []byte, atEOF bool) (int, []byte, error) {
+	for i, b := range data {
+		if b == 0 {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,764 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/ignore"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/unpack"
+)
+
+// orphanCutoff is how many commits a detached HEAD leaves behind are
+// listed by name.
+const orphanCutoff = 4
+
+// checkoutOptions are the options of checkout and switch.
+type checkoutOptions struct {
+	command     string // "checkout" or "switch"
+	quiet       bool
+	force       bool   // throw local changes away
+	newBranch   string // -b or -c
+	resetBranch bool   // -B or -C: the new branch may exist
+	orphan      string
+	detach      bool
+	track       string // "" to follow branch.autoSetupMerge, "direct" or "no"
+	guess       bool   // create a missing branch from a remote-tracking one
+}
+
+// branchInfo is one side of a switch.
+type branchInfo struct {
+	name   string // as given, or the branch name
+	ref    string // "refs/heads/<branch>", "" for a detached HEAD
+	commit string // "" on an unborn branch
+}
+
+// parse handles one option of checkout or switch; value reads the
+// argument of an option that takes one.
+func (opts *checkoutOptions) parse(arg string, value func() (string, bool)) (bool, int) {
+	create, reset := "-b", "-B"
+	if opts.command == "switch" {
+		create, reset = "-c", "-C"
+	}
+	switch {
+	case arg == "-q" || arg == "--quiet":
+		opts.quiet = true
+	case arg == "-f" || arg == "--force" || arg == "--discard-changes" && opts.command == "switch":
+		opts.force = true
+	case arg == "--detach" || arg == "-d" && opts.command == "switch":
+		opts.detach = true
+	case arg == "-t" || arg == "--track" || arg == "--track=direct":
+		opts.track = "direct"
+	case arg == "--no-track":
+		opts.track = "no"
+	case arg == "--guess":
+		opts.guess = true
+	case arg == "--no-guess":
+		opts.guess = false
+	case arg == create || arg == reset || arg == "--orphan" ||
+		opts.command == "switch" && (arg == "--create" || arg == "--force-create"):
+		name, ok := value()
+		if !ok {
+			return true, usage("switch `%s' requires a value", strings.TrimLeft(arg, "-"))
+		}
+		if arg == "--orphan" {
+			opts.orphan = name
+		} else {
+			opts.newBranch = name
+			opts.resetBranch = arg == reset || arg == "--force-create"
+		}
+	case strings.HasPrefix(arg, create) || strings.HasPrefix(arg, reset):
+		opts.newBranch = arg[2:]
+		opts.resetBranch = strings.HasPrefix(arg, reset)
+	case strings.HasPrefix(arg, "--orphan="):
+		opts.orphan = strings.TrimPrefix(arg, "--orphan=")
+	default:
+		return false, 0
+	}
+	return true, 0
+}
+
+// parseArgs splits args into options, which it applies, and the
+// rest. dashdash is where "--" was among the rest, or -1.
+func (opts *checkoutOptions) parseArgs(args []string) ([]string, int, int) {
+	rest := []string{}
+	dashdash := -1
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if dashdash >= 0 || !strings.HasPrefix(arg, "-") || arg == "-" {
+			rest = append(rest, arg)
+			continue
+		}
+		if arg == "--" {
+			dashdash = len(rest)
+			continue
+		}
+		handled, code := opts.parse(arg, func() (string, bool) {
+			if i+1 >= len(args) {
+				return "", false
+			}
+			i++
+			return args[i], true
+		})
+		if code != 0 {
+			return nil, 0, code
+		}
+		if !handled {
+			return nil, 0, usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		}
+	}
+	return rest, dashdash, 0
+}
+
+// Checkout implements "checkout": "checkout <branch>" switches branches,
+// "checkout <commit>" detaches HEAD there, and "checkout [<tree-ish>]
+// [--] <paths>" restores files from the index or the tree-ish.
+// ref: https://git-scm.com/docs/git-checkout
+func Checkout(args []string) int {
+	opts := &checkoutOptions{command: "checkout", guess: true}
+	rest, dashdash, code := opts.parseArgs(args)
+	if code != 0 {
+		return code
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	if repo.IsBare() {
+		return die("this operation must be run in a work tree")
+	}
+
+	target, source := "", ""
+	var paths []string
+	switch {
+	case dashdash >= 0:
+		revs := rest[:dashdash]
+		paths = rest[dashdash:]
+		if len(revs) > 1 {
+			return die("only one reference expected, %d given.", len(revs))
+		}
+		if len(revs) == 1 && len(paths) == 0 {
+			target = revs[0]
+		} else if len(revs) == 1 {
+			source = revs[0]
+		}
+	case len(rest) > 0:
+		arg := rest[0]
+		if _, err := resolveRevision(repo, arg); err == nil || arg == "-" || strings.HasPrefix(arg, "@{-") {
+			if len(rest) == 1 {
+				target = arg
+			} else {
+				source, paths = arg, rest[1:]
+			}
+		} else if len(rest) == 1 && opts.newBranch == "" && opts.orphan == "" && opts.dwimRemote(repo, arg) != "" {
+			target = arg
+		} else if opts.newBranch != "" {
+			return die("'%s' is not a commit and a branch '%s' cannot be created from it", arg, opts.newBranch)
+		} else {
+			paths = rest
+		}
+	}
+	if len(paths) > 0 || source != "" {
+		if opts.newBranch != "" || opts.orphan != "" {
+			return die("Cannot update paths and switch to branch '%s' at the same time.", opts.newBranch+opts.orphan)
+		}
+		if opts.detach {
+			return die("git checkout: --detach does not take a path argument '%s'", paths[0])
+		}
+		return restorePaths(repo, &restoreOptions{
+			command:  "checkout",
+			source:   source,
+			staged:   source != "",
+			worktree: true,
+			overlay:  true,
+			quiet:    opts.quiet,
+			count:    dashdash < 0,
+			specs:    paths,
+		})
+	}
+	return opts.switchTo(repo, target)
+}
+
+// Switch implements "switch": to a branch, to a new one with -c, or to a
+// detached HEAD with --detach.
+// ref: https://git-scm.com/docs/git-switch
+func Switch(args []string) int {
+	opts := &checkoutOptions{command: "switch", guess: true}
+	rest, _, code := opts.parseArgs(args)
+	if code != 0 {
+		return code
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	if repo.IsBare() {
+		return die("this operation must be run in a work tree")
+	}
+	if len(rest) > 1 {
+		return die("only one reference expected, %d given.", len(rest))
+	}
+	target := ""
+	if len(rest) == 1 {
+		target = rest[0]
+	}
+	switch {
+	case opts.orphan != "" && target != "":
+		return die("'--orphan' cannot take <start-point>")
+	case target == "" && opts.newBranch == "" && opts.orphan == "" && !opts.detach:
+		return die("missing branch or commit argument")
+	case target == "" && opts.detach:
+		target = refs.HEAD
+	}
+	return opts.switchTo(repo, target)
+}
+
+// dwimRemote finds the one remote-tracking branch named like a missing
+// local branch, which "checkout <branch>" then creates to track it.
+func (opts *checkoutOptions) dwimRemote(repo *repository.Repository, name string) string {
+	if !opts.guess || opts.detach || repo.Refs().Exists("refs/heads/"+name) {
+		return ""
+	}
+	list, err := repo.Refs().List("refs/remotes/")
+	if err != nil {
+		return ""
+	}
+	found := ""
+	for _, ref := range list {
+		rest := strings.TrimPrefix(ref.Name, "refs/remotes/")
+		if i := strings.IndexByte(rest, '/'); i < 0 || rest[i+1:] != name {
+			continue
+		}
+		if found != "" {
+			return ""
+		}
+		found = ref.Name
+	}
+	return found
+}
+
+// currentBranch describes where HEAD is.
+func currentBranch(repo *repository.Repository) (*branchInfo, error) {
+	head, err := repo.Refs().Read(refs.HEAD)
+	if err != nil {
+		return nil, err
+	}
+	info := &branchInfo{}
+	if head.IsSymbolic() {
+		info.ref = head.Symref
+		info.name = strings.TrimPrefix(head.Symref, "refs/heads/")
+	}
+	resolved, err := repo.Refs().Resolve(refs.HEAD)
+	if err == nil {
+		info.commit = resolved.Target
+	} else if !errors.Is(err, refs.ErrNotFound) {
+		return nil, err
+	}
+	if info.ref == "" {
+		info.name = info.commit
+	}
+	return info, nil
+}
+
+// switchTo works out the branch or commit to switch to from the
+// argument and the options, creating the new branch if any, and
+// switches.
+// ref: parse_branchname_arg in https://github.com/git/git/blob/master/builtin/checkout.c
+func (opts *checkoutOptions) switchTo(repo *repository.Repository, arg string) int {
+	if arg == "-" {
+		arg = "@{-1}"
+	}
+	if strings.HasPrefix(arg, "@{-") {
+		name, err := expandPriorCheckout(repo, arg)
+		if err != nil || name == "" {
+			return die("invalid reference: %s", arg)
+		}
+		arg = name
+	}
+	old, err := currentBranch(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	creating := opts.newBranch != "" || opts.orphan != ""
+	startName := arg
+	var target *branchInfo
+	switch {
+	case arg == "":
+		target = &branchInfo{name: refs.HEAD, commit: old.commit}
+		startName = refs.HEAD
+	case !creating && !opts.detach && repo.Refs().Exists("refs/heads/"+arg):
+		ref, err := repo.Refs().Resolve("refs/heads/" + arg)
+		if err != nil {
+			return die("%v", err)
+		}
+		target = &branchInfo{name: arg, ref: "refs/heads/" + arg, commit: ref.Target}
+	default:
+		sha, err := resolveRevisionAs(repo, arg, "commit")
+		if err != nil {
+			remote := ""
+			if !creating && isUnknownRevision(err) {
+				remote = opts.dwimRemote(repo, arg)
+			}
+			if remote == "" {
+				if opts.newBranch != "" && opts.command == "checkout" {
+					return die("'%s' is not a commit and a branch '%s' cannot be created from it", arg, opts.newBranch)
+				}
+				return die("invalid reference: %s", arg)
+			}
+			// "switch <branch>" of a branch only a remote has.
+			opts.newBranch = arg
+			startName = strings.TrimPrefix(remote, "refs/remotes/")
+			ref, err := repo.Refs().Resolve(remote)
+			if err != nil {
+				return die("%v", err)
+			}
+			sha = ref.Target
+			creating = true
+		}
+		if opts.command == "switch" && !creating && !opts.detach {
+			return opts.expectBranch(repo, arg)
+		}
+		target = &branchInfo{name: arg, commit: sha}
+	}
+
+	newTree := ""
+	if target.commit != "" {
+		if newTree, err = peelTo(repo, target.name, target.commit, "tree"); err != nil {
+			return die("%v", err)
+		}
+	}
+	switch {
+	case opts.orphan != "":
+		if err := checkNewBranch(repo, opts.orphan, false); err != nil {
+			return die("%v", err)
+		}
+		if opts.command == "switch" {
+			// A new orphan branch starts with nothing tracked.
+			newTree = ""
+		}
+		target = &branchInfo{name: opts.orphan, ref: "refs/heads/" + opts.orphan}
+	case opts.newBranch != "":
+		if err := checkNewBranch(repo, opts.newBranch, opts.resetBranch); err != nil {
+			return die("%v", err)
+		}
+		if target.commit == "" {
+			// On an unborn branch, only the name of the branch changes.
+			opts.orphan, opts.newBranch = opts.newBranch, ""
+		}
+		target = &branchInfo{name: opts.newBranch + opts.orphan, ref: "refs/heads/" + opts.newBranch + opts.orphan, commit: target.commit}
+	}
+	return opts.switchBranches(repo, old, target, newTree, startName)
+}
+
+// expectBranch refuses to switch to something that is not a branch
+// without --detach.
+func (opts *checkoutOptions) expectBranch(repo *repository.Repository, arg string) int {
+	what := "commit "
+	if full, ok := dwimRef(repo, arg); ok {
+		switch {
+		case strings.HasPrefix(full, "refs/tags/"):
+			what = "tag "
+		case strings.HasPrefix(full, "refs/remotes/"):
+			what = "remote branch "
+		default:
+			what = ""
+		}
+	}
+	code := die("a branch is expected, got %s'%s'", what, arg)
+	fmt.Fprintln(os.Stderr, "hint: If you want to detach HEAD at the commit, try again with the --detach option.")
+	return code
+}
+
+// checkNewBranch checks the name of a branch to create; with reset the
+// branch may exist.
+func checkNewBranch(repo *repository.Repository, name string, reset bool) error {
+	full := "refs/heads/" + name
+	if name == refs.HEAD || strings.HasPrefix(name, "-") || !refs.ValidName(full) {
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	if !reset && repo.Refs().Exists(full) {
+		return fmt.Errorf("a branch named '%s' already exists", name)
+	}
+	return nil
+}
+
+// switchBranches moves the index and the work tree to newTree and then
+// HEAD to target, telling what happened as git does.
+// ref: switch_branches in https://github.com/git/git/blob/master/builtin/checkout.c
+func (opts *checkoutOptions) switchBranches(repo *repository.Repository, old, target *branchInfo, newTree, startName string) int {
+	cfg, err := repo.Config()
+	if err != nil {
+		return die("%v", err)
+	}
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	if !opts.force {
+		unmerged := []string{}
+		for _, e := range idx.Entries {
+			if e.Stage > 0 && (len(unmerged) == 0 || unmerged[len(unmerged)-1] != e.Path) {
+				unmerged = append(unmerged, e.Path)
+			}
+		}
+		if len(unmerged) > 0 {
+			fmt.Fprintln(os.Stderr, "error: you need to resolve your current index first")
+			for _, path := range unmerged {
+				fmt.Fprintf(os.Stderr, "%s: needs merge\n", path)
+			}
+			return 1
+		}
+	}
+	oldTree, err := headTree(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	if target.commit == "" && opts.orphan == "" {
+		newTree = oldTree
+	}
+	matcher, err := ignore.New(repo.WorkTree, repo.GitDir, cfg)
+	if err != nil {
+		return die("%v", err)
+	}
+	_, statErr := os.Stat(repo.IndexFile())
+	err = unpack.TwoWay(idx, oldTree, newTree, unpack.Options{
+		Store:    repo.Objects(),
+		WorkTree: repo.WorkTree,
+		Reset:    opts.force,
+		Initial:  os.IsNotExist(statErr),
+		Ignored:  matcher.IsIgnored,
+		Action:   "checkout",
+	})
+	var unpackErr *unpack.Error
+	if errors.As(err, &unpackErr) {
+		for _, msg := range unpackErr.Messages() {
+			fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+		}
+		fmt.Fprintln(os.Stderr, "Aborting")
+		return 1
+	}
+	if err != nil {
+		return die("%v", err)
+	}
+	if err := idx.Write(repo.IndexFile(), repo.Format); err != nil {
+		return die("%v", err)
+	}
+	if !opts.force && !opts.quiet && target.commit != "" {
+		pairs, err := diff.TreeIndex(repo.Objects(), newTree, idx, repo.WorkTree, diff.TreeOptions{})
+		if err != nil {
+			return die("%v", err)
+		}
+		for _, p := range pairs {
+			fmt.Printf("%c\t%s\n", p.Status, p.Path())
+		}
+	}
+
+	if !opts.quiet && old.ref == "" && old.commit != "" && target.commit != old.commit {
+		if err := orphanedCommitWarning(repo, old.commit, target.commit); err != nil {
+			return die("%v", err)
+		}
+	}
+	if code := opts.updateRefs(repo, cfg, old, target, startName); code != 0 {
+		return code
+	}
+	// Like git, which read the config before the branch was set up,
+	// don't report on a branch just created.
+	if !opts.quiet && !opts.detach && opts.newBranch == "" && (target.ref != "" || target.name == refs.HEAD) {
+		if err := reportTracking(repo, target.ref); err != nil {
+			return die("%v", err)
+		}
+	}
+	return 0
+}
+
+// updateRefs creates the new branch and points HEAD at the target.
+// ref: update_refs_for_switch in https://github.com/git/git/blob/master/builtin/checkout.c
+func (opts *checkoutOptions) updateRefs(repo *repository.Repository, cfg *config.Config, old, target *branchInfo, startName string) int {
+	store := repo.Refs()
+	existed := false
+	if opts.newBranch != "" {
+		existed = store.Exists(target.ref)
+		msg := "branch: Created from " + startName
+		if existed {
+			msg = "branch: Reset to " + startName
+		}
+		if err := store.Update(target.ref, target.commit, "", msg, false); err != nil {
+			return die("%v", err)
+		}
+		if err := setupTrackingFor(repo, cfg, opts.newBranch, startName, opts.track, opts.quiet); err != nil {
+			return die("%v", err)
+		}
+	}
+
+	oldDesc := old.name
+	if oldDesc == "" {
+		oldDesc = "(invalid)"
+	}
+	msg := fmt.Sprintf("checkout: moving from %s to %s", oldDesc, target.name)
+	switch {
+	case target.ref != "":
+		if err := store.SetSymbolic(refs.HEAD, target.ref, msg); err != nil {
+			return die("%v", err)
+		}
+		if opts.quiet {
+			break
+		}
+		switch {
+		case old.ref == target.ref && opts.newBranch != "":
+			fmt.Fprintf(os.Stderr, "Reset branch '%s'\n", target.name)
+		case old.ref == target.ref:
+			fmt.Fprintf(os.Stderr, "Already on '%s'\n", target.name)
+		case opts.newBranch != "" && existed:
+			fmt.Fprintf(os.Stderr, "Switched to and reset branch '%s'\n", target.name)
+		case opts.newBranch != "" || opts.orphan != "":
+			fmt.Fprintf(os.Stderr, "Switched to a new branch '%s'\n", target.name)
+		default:
+			fmt.Fprintf(os.Stderr, "Switched to branch '%s'\n", target.name)
+		}
+	case target.name == refs.HEAD && !opts.detach:
+		// Nothing moves.
+	default:
+		if err := store.Update(refs.HEAD, target.commit, "", msg, true); err != nil {
+			return die("%v", err)
+		}
+		if opts.quiet {
+			break
+		}
+		if advice, _ := cfg.Bool("advice.detachedHead", true); old.ref != "" && advice && !opts.detach {
+			fmt.Fprintf(os.Stderr, detachAdvice, target.name)
+		}
+		if err := describeDetachedHead(repo, "HEAD is now at", target.commit); err != nil {
+			return die("%v", err)
+		}
+	}
+	return 0
+}
+
+// detachAdvice explains a detached HEAD to those who just got one.
+const detachAdvice = `Note: switching to '%s'.
+
+You are in 'detached HEAD' state. You can look around, make experimental
+changes and commit them, and you can discard any commits you make in this
+state without impacting any branches by switching back to a branch.
+
+If you want to create a new branch to retain commits you create, you may
+do so (now or later) by using -c with the switch command. Example:
+
+  git switch -c <new-branch-name>
+
+Or undo this operation with:
+
+  git switch -
+
+Turn off this advice by setting config variable advice.detachedHead to false
+
+`
+
+// onelineCommit is "<abbrev> <subject>" of a commit.
+func onelineCommit(repo *repository.Repository, sha string) (string, error) {
+	info, err := readObjectInfo(repo.Objects(), sha)
+	if err != nil {
+		return "", err
+	}
+	subject, _ := formatSubject(skipBlankLines(info.message), " ")
+	return repo.Objects().Abbrev(sha, defaultAbbrev(repo)) + " " + subject, nil
+}
+
+func describeDetachedHead(repo *repository.Repository, msg, sha string) error {
+	line, err := onelineCommit(repo, sha)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s %s\n", msg, line)
+	return nil
+}
+
+// orphanedCommitWarning warns about the commits a detached HEAD leaves
+// behind, that no ref reaches; if there are none, it tells where HEAD
+// was.
+// ref: orphaned_commit_warning in https://github.com/git/git/blob/master/builtin/checkout.c
+func orphanedCommitWarning(repo *repository.Repository, oldCommit, newCommit string) error {
+	w := newRevWalk(repo)
+	w.addObject(oldCommit, "", false)
+	w.addRefs("refs/", "", true)
+	if newCommit != "" {
+		w.addObject(newCommit, "", true)
+	}
+	lost, err := w.commits()
+	if err != nil {
+		return err
+	}
+	if len(lost) == 0 {
+		return describeDetachedHead(repo, "Previous HEAD position was", oldCommit)
+	}
+	list := ""
+	for i, n := range lost {
+		if i < orphanCutoff || len(lost) == orphanCutoff+1 {
+			line, err := onelineCommit(repo, n.sha)
+			if err != nil {
+				return err
+			}
+			list += "  " + line + "\n"
+		}
+	}
+	if more := len(lost) - orphanCutoff; more > 1 {
+		list += fmt.Sprintf(" ... and %d more.\n", more)
+	}
+	commits, it := "commits", "them"
+	if len(lost) == 1 {
+		commits, it = "commit", "it"
+	}
+	fmt.Fprintf(os.Stderr, "Warning: you are leaving %d %s behind, not connected to\nany of your branches:\n\n%s\n", len(lost), commits, list)
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	if advice, _ := cfg.Bool("advice.detachedHead", true); advice {
+		fmt.Fprintf(os.Stderr, "If you want to keep %s by creating a new branch, this may be a good time\nto do so with:\n\n git branch <new-branch-name> %s\n\n",
+			it, repo.Objects().Abbrev(oldCommit, defaultAbbrev(repo)))
+	}
+	return nil
+}
+
+// setupTrackingFor makes a new branch track its start point, if that is
+// a remote-tracking branch and branch.autoSetupMerge allows it, or a
+// local branch with --track.
+// ref: setup_tracking in https://github.com/git/git/blob/master/branch.c
+func setupTrackingFor(repo *repository.Repository, cfg *config.Config, branch, start, track string, quiet bool) error {
+	if track == "no" {
+		return nil
+	}
+	auto, ok := cfg.Get("branch.autoSetupMerge")
+	if !ok {
+		auto = "true"
+	}
+	if track == "" && auto != "always" {
+		if on, err := config.ParseBool(auto, true); err != nil || !on {
+			return nil
+		}
+	}
+	remote, merge, ok := upstreamFor(repo, cfg, start)
+	if !ok || remote == "." && track == "" && auto != "always" {
+		return nil
+	}
+	return setUpstream(repo, branch, remote, merge, quiet)
+}
+
+// upstreamFor finds what a branch starting at start would track: the
+// remote and its branch for a remote-tracking branch, "." and the branch
+// for a local one.
+func upstreamFor(repo *repository.Repository, cfg *config.Config, start string) (string, string, bool) {
+	full, ok := dwimRef(repo, start)
+	if !ok {
+		return "", "", false
+	}
+	if strings.HasPrefix(full, "refs/heads/") {
+		return ".", full, true
+	}
+	if !strings.HasPrefix(full, "refs/remotes/") {
+		return "", "", false
+	}
+	for _, remote := range cfg.Subsections("remote") {
+		for _, value := range cfg.GetAll("remote." + remote + ".fetch") {
+			spec, err := refs.ParseRefspec(value)
+			if err != nil {
+				continue
+			}
+			if src, ok := spec.MapDst(full); ok {
+				return remote, src, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// setUpstream records that branch tracks merge of remote.
+func setUpstream(repo *repository.Repository, branch, remote, merge string, quiet bool) error {
+	f, err := config.ReadFile(repo.Path("config"), config.ScopeLocal)
+	if err != nil {
+		return err
+	}
+	if err := f.Set("branch."+branch+".remote", remote, false); err != nil {
+		return err
+	}
+	if err := f.Set("branch."+branch+".merge", merge, false); err != nil {
+		return err
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	if !quiet {
+		display := strings.TrimPrefix(merge, "refs/heads/")
+		if remote != "." {
+			display = remote + "/" + display
+		}
+		fmt.Printf("branch '%s' set up to track '%s'.\n", branch, display)
+	}
+	return nil
+}
+
+// reportTracking tells how a branch compares with its upstream.
+// ref: format_tracking_info in https://github.com/git/git/blob/master/remote.c
+func reportTracking(repo *repository.Repository, ref string) error {
+	if ref == "" {
+		return nil
+	}
+	branch := strings.TrimPrefix(ref, "refs/heads/")
+	upstream, err := trackingRef(repo, branch, false)
+	if err != nil {
+		return nil
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	hints, _ := cfg.Bool("advice.statusHints", true)
+	base := refs.Shorten(upstream, repo.Refs().Exists)
+	theirs, err := repo.Refs().Resolve(upstream)
+	if err != nil {
+		fmt.Printf("Your branch is based on '%s', but the upstream is gone.\n", base)
+		if hints {
+			fmt.Println(`  (use "git branch --unset-upstream" to fixup)`)
+		}
+		return nil
+	}
+	ours, err := repo.Refs().Resolve(ref)
+	if err != nil {
+		return nil
+	}
+	ahead, behind, err := aheadBehind(repo, ours.Target, theirs.Target)
+	if err != nil {
+		return err
+	}
+	plural := func(n int) string {
+		if n == 1 {
+			return "commit"
+		}
+		return "commits"
+	}
+	switch {
+	case ahead == 0 && behind == 0:
+		fmt.Printf("Your branch is up to date with '%s'.\n", base)
+	case behind == 0:
+		fmt.Printf("Your branch is ahead of '%s' by %d %s.\n", base, ahead, plural(ahead))
+		if hints {
+			fmt.Println(`  (use "git push" to publish your local commits)`)
+		}
+	case ahead == 0:
+		fmt.Printf("Your branch is behind '%s' by %d %s, and can be fast-forwarded.\n", base, behind, plural(behind))
+		if hints {
+			fmt.Println(`  (use "git pull" to update your local branch)`)
+		}
+	default:
+		fmt.Printf("Your branch and '%s' have diverged,\nand have %d and %d different %s each, respectively.\n", base, ahead, behind, plural(ahead+behind))
+		if hints {
+			fmt.Println(`  (use "git pull" to merge the remote branch into yours)`)
+		}
+	}
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"compress/zlib"
-	"crypto/sha1"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -17,6 +16,10 @@ import (
 	"strconv"
 	"strings"
 	"github.com/go-git/go-git/v5"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
 )
 
 const (
@@ -37,6 +40,8 @@ const (
 var (
 	// Fetched object. Map from sha1 to the object.
 	shaToObj map[string]Object = make(map[string]Object)
+	// Object format advertised by the remote.
+	objectFormat hash.Algo = hash.SHA1
 )
 
 type GitObjectReader struct {
@@ -56,7 +61,7 @@ func Clone(repoUrl string, cloneDir string) {
 	// directory := os.Args[3]
 	repoPath := path.Join(".", cloneDir)
 	if err := os.MkdirAll(repoPath, 0750); err != nil {
-		fmt.Errorf("error creating directory: %s\n", err)
+		fmt.Fprintf(os.Stderr, "error creating directory: %s\n", err)
 	}
 
 	// repoPath, err := ioutil.TempDir("", "worktree")
@@ -68,53 +73,60 @@ func Clone(repoUrl string, cloneDir string) {
 	for _, dir := range []string{".git", ".git/objects", ".git/refs"} {
 		dirPath := path.Join(repoPath, dir)
 		if err := os.Mkdir(dirPath, 0755); err != nil {
-			fmt.Errorf("Error creating directory: %s\n", err.Error())
+			fmt.Fprintf(os.Stderr, "Error creating directory: %s\n", err.Error())
 		}
 	}
 
-	headFileContents := []byte("ref: refs/heads/master\n")
-	headPath := path.Join(repoPath, ".git/HEAD")
-	if err := ioutil.WriteFile(headPath, headFileContents, 0644); err != nil {
-		fmt.Errorf("Error writing file: %s\n", err.Error())
-	}
-
 	fmt.Println("Initialized git directory")
 
 
 
 	if err := os.MkdirAll(repoPath, 0750); err != nil {
-		fmt.Errorf("error creating cloneDir: %s\n", err)
+		fmt.Fprintf(os.Stderr, "error creating cloneDir: %s\n", err)
 	}
 
-	commitSha, err := fetchLatestCommitHash(repoUrl)
+	commitSha, capabilities, err := fetchLatestCommitHash(repoUrl)
 	if err != nil {
-		fmt.Errorf("error fetch latest commit hash: %s\n", err)
+		fmt.Fprintf(os.Stderr, "error fetch latest commit hash: %s\n", err)
+	}
+	if objectFormat, err = formatFromCapabilities(capabilities); err != nil {
+		fmt.Fprintf(os.Stderr, "error object format: %s\n", err)
+		return
+	}
+	branch := defaultBranchFromCapabilities(capabilities)
+	headFileContents := []byte("ref: refs/heads/" + branch + "\n")
+	headPath := path.Join(repoPath, ".git/HEAD")
+	if err := ioutil.WriteFile(headPath, headFileContents, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing file: %s\n", err.Error())
+	}
+	if err := writeConfigFile(repoPath); err != nil {
+		fmt.Fprintf(os.Stderr, "error write config file: %s\n", err)
 	}
-	if err := writeBranchRefFile(repoPath, "master", commitSha); err != nil {
-		fmt.Errorf("error write branch ref file: %s\n", err)
+	if err := writeBranchRefFile(repoPath, branch, commitSha, repoUrl); err != nil {
+		fmt.Fprintf(os.Stderr, "error write branch ref file: %s\n", err)
 	}
 	// Fetch objects.
 	if err := fetchObjects(repoUrl, commitSha); err != nil {
-		fmt.Errorf("error fetching objects: %s\n", err)
+		fmt.Fprintf(os.Stderr, "error fetching objects: %s\n", err)
 	}
 	if err := writeFetchedObjects(repoPath); err != nil {
-		fmt.Errorf("error writing fetched objects: %s\n", err)
+		fmt.Fprintf(os.Stderr, "error writing fetched objects: %s\n", err)
 	}
 	// Restore files committed at the commit sha.
 	if err := restoreRepository(repoPath, commitSha); err != nil {
-		fmt.Errorf("error restoring repository: %s\n", err)
+		fmt.Fprintf(os.Stderr, "error restoring repository: %s\n", err)
 	}
 	log.Println(repoPath)
 	gitRepo, err := git.PlainOpen(repoPath)
 	if err != nil {
-		fmt.Errorf("error plain open: %s\n", err)
+		fmt.Fprintf(os.Stderr, "error plain open: %s\n", err)
 	}
 	log.Println(gitRepo)
 	log.Println(err)
 }
 
 
-func fetchLatestCommitHash(repositoryURL string) (string, error) {
+func fetchLatestCommitHash(repositoryURL string) (string, []string, error) {
 	// $ curl 'https://github.com/taxintt/codecrafters-git-go/info/refs?service=git-upload-pack' --output -
 	// 2023/06/27 23:40:54 SHA: 4b825dc642cb6eb9a060e54bf8d69288fbee4904
 	// 001e# service=git-upload-pack
@@ -124,33 +136,71 @@ func fetchLatestCommitHash(repositoryURL string) (string, error) {
 	// 0000%
 	resp, err := http.Get(fmt.Sprintf("%s/info/refs?service=git-upload-pack", repositoryURL))
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer resp.Body.Close()
 	buf := bytes.NewBuffer([]byte{})
 	if _, err := io.Copy(buf, resp.Body); err != nil {
-		return "", err
+		return "", nil, err
 	}
 	reader := bufio.NewReader(buf)
 	// read "001e# service=git-upload-pack\n"
 	if _, err := readPacketLine(reader); err != nil {
-		return "", err
+		return "", nil, err
 	}
 	// read "0000"
 	if _, err := readPacketLine(reader); err != nil {
-		return "", err
+		return "", nil, err
 	}
 	// read "0155 <commit sha> HEADmulti_ack..."
 	// 0155 39065120688df73291eb9ec890bd5fd72e2bc9f1 HEADmulti_ack
 	head, err := readPacketLine(reader)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	// extract commit sha from head
 	commitHash := strings.Split(string(head), " ")[0]
-	return commitHash, nil
+	// capabilities follow the first ref after a NUL byte
+	capabilities := []string{}
+	if i := bytes.IndexByte(head, 0); i >= 0 {
+		capabilities = strings.Fields(string(head[i+1:]))
+	}
+	return commitHash, capabilities, nil
+}
+
+// Pick the object format from the "object-format=" capability.
+// Servers that don't advertise it only speak sha1.
+func formatFromCapabilities(capabilities []string) (hash.Algo, error) {
+	for _, c := range capabilities {
+		if strings.HasPrefix(c, "object-format=") {
+			return hash.ByName(strings.TrimPrefix(c, "object-format="))
+		}
+	}
+	return hash.SHA1, nil
+}
+
+// Pick the branch the remote HEAD points to from the "symref=HEAD:"
+// capability. Servers too old to advertise it get "master".
+func defaultBranchFromCapabilities(capabilities []string) string {
+	for _, c := range capabilities {
+		if target := strings.TrimPrefix(c, "symref=HEAD:"); target != c && strings.HasPrefix(target, "refs/heads/") {
+			return strings.TrimPrefix(target, "refs/heads/")
+		}
+	}
+	return "master"
 }
 
+// write $repo/.git/config
+func writeConfigFile(repoPath string) error {
+	config := fmt.Sprintf("[core]\n\trepositoryformatversion = %d\n\tbare = false\n", objectFormat.RepositoryFormatVersion())
+	if objectFormat != hash.SHA1 {
+		config += fmt.Sprintf("[extensions]\n\tobjectformat = %s\n", objectFormat)
+	}
+	return ioutil.WriteFile(path.Join(repoPath, ".git", "config"), []byte(config), 0644)
+}
+
+
+
 // read packet line sequentially from reader
 func readPacketLine(reader io.Reader) ([]byte, error) {
 	// e.g.) string(hex)=001e → size=30
@@ -175,19 +225,18 @@ func readPacketLine(reader io.Reader) ([]byte, error) {
 }
 
 // write $repo/.git/refs/heads/<branch>
-func writeBranchRefFile(repoPath string, branch string, commitSha string) error {
-	refFilePath := path.Join(repoPath, ".git", "refs", "heads", branch)
-	if err := os.MkdirAll(path.Dir(refFilePath), 0750); err != nil && !os.IsExist(err) {
+func writeBranchRefFile(repoPath string, branch string, commitSha string, repoUrl string) error {
+	repo, err := repository.Open(path.Join(repoPath, ".git"))
+	if err != nil {
 		return err
 	}
-	refFileContent := []byte(commitSha)
-	if err := ioutil.WriteFile(refFilePath, refFileContent, 0644); err != nil {
+	tx := repo.Refs().NewTransaction()
+	if err := tx.Create("refs/heads/"+branch, commitSha, "clone: from "+repoUrl, false); err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
-
 func fetchObjects(gitRepositoryURL, commitSha string) error {
 	// do Reference discovery
 	packfileBuf := fetchPackfile(gitRepositoryURL, commitSha)
@@ -199,10 +248,11 @@ func fetchObjects(gitRepositoryURL, commitSha string) error {
 	log.Printf("[Debug] version: %d\n", version)
 	log.Printf("[Debug] num objects: %d\n", numObjects)
 	// verify checksum
-	checksumLen := 20
+	checksumLen := objectFormat.Size()
 	calculatedChecksum := packfileBuf[len(packfileBuf)-checksumLen:]
-	storedChecksum := sha1.Sum(packfileBuf[:len(packfileBuf)-checksumLen])
-	if !bytes.Equal(storedChecksum[:], calculatedChecksum) {
+	storedChecksum := objectFormat.New()
+	storedChecksum.Write(packfileBuf[:len(packfileBuf)-checksumLen])
+	if !bytes.Equal(storedChecksum.Sum(nil), calculatedChecksum) {
 		log.Printf("[Error] expected checksum: %v, but got: %v", storedChecksum, calculatedChecksum)
 	}
 	// read objects from packfile except for header
@@ -224,7 +274,11 @@ func fetchObjects(gitRepositoryURL, commitSha string) error {
 func fetchPackfile(gitUrl, commitSha string) []byte {
 	buf := bytes.NewBuffer([]byte{})
 	// write no-progress for Packfile negotiation
-	buf.WriteString(packetLine(fmt.Sprintf("want %s no-progress\n", commitSha)))
+	capabilities := "no-progress"
+	if objectFormat != hash.SHA1 {
+		capabilities += fmt.Sprintf(" object-format=%s", objectFormat)
+	}
+	buf.WriteString(packetLine(fmt.Sprintf("want %s %s\n", commitSha, capabilities)))
 	buf.WriteString("0000")
 	buf.WriteString(packetLine("done\n"))
 	// do Packfile negotiation
@@ -300,8 +354,8 @@ func readObject(reader *bytes.Reader) error {
 }
 
 func readSha(reader io.Reader) (string, error) {
-	sha := make([]byte, 20)
-	if _, err := reader.Read(sha); err != nil {
+	sha := make([]byte, objectFormat.Size())
+	if _, err := io.ReadFull(reader, sha); err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("%x", sha), nil
@@ -427,7 +481,7 @@ func (o *Object) sha() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%x", sha1.Sum(b)), nil
+	return objectFormat.Sum(b), nil
 }
 // Write objects in shaToObj to .git/objects.
 func writeFetchedObjects(repoPath string) error {
@@ -480,7 +534,7 @@ func wrapContent(contents []byte, objectType string) (*bytes.Buffer, error) {
 
 // Write the git object and return the sha1.
 func writeGitObject(repoPath string, object []byte) (string, error) {
-	blobSha := fmt.Sprintf("%x", sha1.Sum(object))
+	blobSha := objectFormat.Sum(object)
 	// log.Printf("[Debug] object sha: %s\n", blobSha)
 	objectFilePath := path.Join(repoPath, ".git", "objects", blobSha[:2], blobSha[2:])
 	// log.Printf("[Debug] object file path: %s\n", objectFilePath)
@@ -509,19 +563,11 @@ func restoreRepository(repoPath, commitSha string) error {
 	}
 	log.Printf("[Debug] latest commit sha: %s\n", commitSha)
 	log.Printf("[Debug] latest commit buf: %s\n", string(commitBuf))
-	commitReader := bufio.NewReader(bytes.NewReader(commitBuf))
-	treePrefix, err := commitReader.ReadString(' ')
+	commit, err := object.ParseCommit(commitBuf)
 	if err != nil {
-		return err
-	}
-	if treePrefix != "tree " {
-		return errors.New(fmt.Sprintf("Invalid commit blob: %s", string(commitBuf)))
-	}
-	treeSha, err := commitReader.ReadString('\n')
-	if err != nil {
-		return err
+		return fmt.Errorf("invalid commit %s: %s", commitSha, err)
 	}
-	treeSha = treeSha[:len(treeSha)-1] // Strip newline.
+	treeSha := commit.Tree
 	// Traverse tree objects.
 	if err := traverseTree(repoPath, "", treeSha); err != nil {
 		return err
@@ -654,8 +700,8 @@ func parseTree(treeBuf []byte) (*Tree, error) {
 			return nil, err
 		}
 		entryName = entryName[:len(entryName)-1] // Trim the null-byte character suffix.
-		sha := make([]byte, 20)
-		_, err = contentsReader.Read(sha)
+		sha := make([]byte, objectFormat.Size())
+		_, err = io.ReadFull(contentsReader, sha)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,401 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/unpack"
+)
+
+// commitTemplate is what the editor shows below the message.
+const commitTemplate = `
+# Please enter the commit message for your changes. Lines starting
+# with '#' will be ignored, and an empty message aborts the commit.
+`
+
+// mergeTemplate warns, when a merge is being concluded, that the commit
+// will be one.
+const mergeTemplate = `
+# It looks like you may be committing a merge.
+# If this is not correct, please run
+#	git update-ref -d MERGE_HEAD
+# and try again.
+
+`
+
+// Commit implements "commit": the index becomes a commit on top of
+// HEAD, and of MERGE_HEAD too when a merge stopped for conflicts. The
+// message comes from -m or -F, or from the merge, or the editor. With
+// --amend the commit replaces HEAD instead, keeping its parents, author
+// and, by default, message.
+// ref: https://git-scm.com/docs/git-commit
+func Commit(args []string) int {
+	var messages []string
+	file := ""
+	edit, noEdit, quiet, allowEmpty, amend := false, false, false, false, false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-m" || arg == "--message" || arg == "-F" || arg == "--file":
+			if i+1 >= len(args) {
+				return usage("switch `%s' requires a value", strings.TrimLeft(arg, "-")[:1])
+			}
+			i++
+			if arg == "-m" || arg == "--message" {
+				messages = append(messages, args[i])
+			} else {
+				file = args[i]
+			}
+		case strings.HasPrefix(arg, "--message="):
+			messages = append(messages, strings.TrimPrefix(arg, "--message="))
+		case strings.HasPrefix(arg, "--file="):
+			file = strings.TrimPrefix(arg, "--file=")
+		case strings.HasPrefix(arg, "-m") && len(arg) > 2:
+			messages = append(messages, arg[2:])
+		case strings.HasPrefix(arg, "-F") && len(arg) > 2:
+			file = arg[2:]
+		case arg == "-e" || arg == "--edit":
+			edit, noEdit = true, false
+		case arg == "--no-edit":
+			edit, noEdit = false, true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--allow-empty":
+			allowEmpty = true
+		case arg == "--amend":
+			amend = true
+		case arg == "--no-amend":
+			amend = false
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			return usage("paths with commit are not supported")
+		}
+	}
+	if len(messages) > 0 && file != "" {
+		return die("options '-m' and '-F' cannot be used together")
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	// Refreshing the index, as git does first, lists the conflicts.
+	for i, e := range idx.Entries {
+		if e.Stage > 0 && (i == 0 || idx.Entries[i-1].Path != e.Path) {
+			fmt.Printf("U\t%s\n", e.Path)
+		}
+	}
+	if code := refuseUnmerged(idx, "Committing"); code != 0 {
+		return code
+	}
+	head, err := currentBranch(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	tree, err := unpack.WriteTree(repo.Objects(), idx.Entries)
+	if err != nil {
+		return die("%v", err)
+	}
+	parents := []string{}
+	if head.commit != "" {
+		parents = append(parents, head.commit)
+	}
+	mergeHeads, err := readMergeHeads(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	var amended *object.Commit
+	if amend {
+		if head.commit == "" {
+			return die("You have nothing to amend.")
+		}
+		if len(mergeHeads) > 0 {
+			return die("You are in the middle of a merge -- cannot amend.")
+		}
+		if amended, err = readCommit(repo, head.commit); err != nil {
+			return die("%v", err)
+		}
+		parents = amended.Parents
+	}
+	parents = append(parents, mergeHeads...)
+	if len(mergeHeads) == 0 && !allowEmpty && !amend {
+		oldTree, err := headTree(repo)
+		if err != nil {
+			return die("%v", err)
+		}
+		if oldTree == tree || oldTree == "" && len(idx.Entries) == 0 {
+			fmt.Println("nothing to commit")
+			return 1
+		}
+	}
+	if amend && !allowEmpty {
+		parentTree := ""
+		if len(parents) > 0 {
+			if parentTree, err = peelTo(repo, parents[0], parents[0], "tree"); err != nil {
+				return die("%v", err)
+			}
+		}
+		if parentTree == tree || parentTree == "" && len(idx.Entries) == 0 {
+			fmt.Fprintln(os.Stderr, "You asked to amend the most recent commit, but doing so would make")
+			fmt.Fprintln(os.Stderr, "it empty. You can repeat your command with --allow-empty, or you can")
+			fmt.Fprintln(os.Stderr, "remove the commit entirely with \"git reset HEAD^\".")
+			if head.ref != "" {
+				fmt.Printf("On branch %s\n", head.name)
+			} else {
+				fmt.Printf("HEAD detached at %s\n", repo.Objects().Abbrev(head.commit, defaultAbbrev(repo)))
+			}
+			fmt.Println("No changes")
+			return 1
+		}
+	}
+
+	var msg string
+	switch {
+	case len(messages) > 0:
+		msg = strings.Join(messages, "\n\n") + "\n"
+	case file != "":
+		var data []byte
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return die("could not read log file '%s': %v", file, err)
+		}
+		msg = string(data)
+	case amend:
+		msg = amended.Message
+	default:
+		// A squash that stopped for conflicts left both, the list of
+		// conflicts in MERGE_MSG.
+		for _, name := range []string{"SQUASH_MSG", "MERGE_MSG"} {
+			if data, err := os.ReadFile(repo.Path(name)); err == nil {
+				msg += string(data)
+			}
+		}
+	}
+	useEditor := edit || len(messages) == 0 && file == "" && !noEdit
+	if useEditor {
+		template := msg + commitTemplate
+		if len(mergeHeads) > 0 {
+			template = msg + mergeTemplate + strings.TrimPrefix(commitTemplate, "\n")
+		}
+		if msg, err = editMessage(repo, "COMMIT_EDITMSG", template); err != nil {
+			return die("%v", err)
+		}
+	} else if err := os.WriteFile(repo.Path("COMMIT_EDITMSG"), []byte(msg), 0o666); err != nil {
+		return die("%v", err)
+	}
+	msg = cleanupMessage(msg, useEditor)
+	if msg == "" {
+		fmt.Fprintln(os.Stderr, "Aborting commit due to empty commit message.")
+		return 1
+	}
+
+	var author *object.Signature
+	if amend {
+		author = &amended.Author
+	}
+	sha, err := createCommit(repo, tree, parents, msg, author)
+	if err != nil {
+		return die("%v", err)
+	}
+	what := "commit"
+	switch {
+	case amend:
+		what = "commit (amend)"
+	case head.commit == "":
+		what = "commit (initial)"
+	case len(mergeHeads) > 0:
+		what = "commit (merge)"
+	}
+	subject, _ := splitSubjectBody(msg)
+	if err := repo.Refs().Update(refs.HEAD, sha, head.commit, what+": "+subject, false); err != nil {
+		return die("%v", err)
+	}
+	removeMergeState(repo)
+	if quiet {
+		return 0
+	}
+	if err := printCommitSummary(repo, head, sha, amend); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// refuseUnmerged stops a command when the index has conflicts, which
+// must be resolved first.
+// ref: die_resolve_conflict in https://github.com/git/git/blob/master/advice.c
+func refuseUnmerged(idx *index.Index, what string) int {
+	for _, e := range idx.Entries {
+		if e.Stage > 0 {
+			fmt.Fprintf(os.Stderr, "error: %s is not possible because you have unmerged files.\n", what)
+			fmt.Fprintln(os.Stderr, "hint: Fix them up in the work tree, and then use 'git add/rm <file>'")
+			fmt.Fprintln(os.Stderr, "hint: as appropriate to mark resolution and make a commit.")
+			return die("Exiting because of an unresolved conflict.")
+		}
+	}
+	return 0
+}
+
+// readMergeHeads lists the commits of MERGE_HEAD, none when no merge is
+// in progress.
+func readMergeHeads(repo *repository.Repository) ([]string, error) {
+	data, err := os.ReadFile(repo.Path("MERGE_HEAD"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	heads := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if !repo.Format.IsHex(line) {
+			return nil, fmt.Errorf("corrupt MERGE_HEAD file (%s)", line)
+		}
+		heads = append(heads, line)
+	}
+	return heads, nil
+}
+
+// removeMergeState forgets a merge in progress, once committed or
+// aborted.
+// ref: remove_merge_branch_state in https://github.com/git/git/blob/master/branch.c
+func removeMergeState(repo *repository.Repository) {
+	for _, name := range []string{"MERGE_HEAD", "MERGE_MSG", "MERGE_MODE", "SQUASH_MSG", "AUTO_MERGE"} {
+		os.Remove(repo.Path(name))
+	}
+}
+
+// editMessage lets the user edit a message in a file of the git
+// directory and returns what the editor left there.
+func editMessage(repo *repository.Repository, name, msg string) (string, error) {
+	path := repo.Path(name)
+	if err := os.WriteFile(path, []byte(msg), 0o666); err != nil {
+		return "", err
+	}
+	if err := launchEditor(editor(repo), path); err != nil {
+		fmt.Fprintln(os.Stderr, "Please supply the message using either -m or -F option.")
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+// createCommit writes a commit of tree by the author, or by the
+// committer if author is nil.
+func createCommit(repo *repository.Repository, tree string, parents []string, msg string, author *object.Signature) (string, error) {
+	committer, err := repo.Signature("committer")
+	if err != nil {
+		return "", err
+	}
+	c := &object.Commit{Tree: tree, Parents: parents, Committer: committer, Message: msg}
+	if author != nil {
+		c.Author = *author
+	} else if c.Author, err = repo.Signature("author"); err != nil {
+		return "", err
+	}
+	return repo.Objects().Write("commit", c.Bytes())
+}
+
+// printCommitSummary tells of a new commit: "[<branch> <abbrev>]
+// <subject>", its author if not the committer, the author date if
+// showDate, as when the author was taken from another commit, and what
+// changed unless it is a merge.
+// ref: print_commit_summary in https://github.com/git/git/blob/master/sequencer.c
+func printCommitSummary(repo *repository.Repository, head *branchInfo, sha string, showDate bool) error {
+	line, err := onelineCommit(repo, sha)
+	if err != nil {
+		return err
+	}
+	c, err := readCommit(repo, sha)
+	if err != nil {
+		return err
+	}
+	where := head.name
+	if head.ref == "" {
+		where = "detached HEAD"
+	}
+	if head.commit == "" {
+		where += " (root-commit)"
+	}
+	fmt.Printf("[%s %s\n", where, strings.Replace(line, " ", "] ", 1))
+	if c.Author.Name != c.Committer.Name || c.Author.Email != c.Committer.Email {
+		fmt.Printf(" Author: %s <%s>\n", c.Author.Name, c.Author.Email)
+	}
+	if showDate {
+		when, err := date.Format(c.Author.When(), "default")
+		if err != nil {
+			return err
+		}
+		fmt.Printf(" Date: %s\n", when)
+	}
+	if len(c.Parents) > 1 {
+		return nil
+	}
+	parentTree := ""
+	if len(c.Parents) == 1 {
+		if parentTree, err = peelTo(repo, c.Parents[0], c.Parents[0], "tree"); err != nil {
+			return err
+		}
+	}
+	return printDiffstat(repo, parentTree, c.Tree, true)
+}
+
+// readCommit reads and parses a commit.
+func readCommit(repo *repository.Repository, sha string) (*object.Commit, error) {
+	data, err := repo.Objects().ReadType(sha, "commit")
+	if err != nil {
+		return nil, err
+	}
+	return object.ParseCommit(data)
+}
+
+// printDiffstat shows what changed between two trees, as commit and
+// merge do after their work: the stat, or only its last line if short,
+// and the summary of created, deleted and renamed files.
+func printDiffstat(repo *repository.Repository, oldTree, newTree string, short bool) error {
+	o := newDiffOutputOptions(repo)
+	o.configRenames(repo)
+	pairs, err := diff.Trees(repo.Objects(), oldTree, newTree, o.treeOptions(nil))
+	if err != nil {
+		return err
+	}
+	if pairs, err = o.detect(repo, pairs); err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	printer := &diff.Printer{Store: repo.Objects(), Out: out, Options: o.diffOptions, Abbrev: o.abbrev}
+	if err := o.setupPrinter(repo, printer); err != nil {
+		return err
+	}
+	if short {
+		err = printer.WriteShortStat(pairs)
+	} else {
+		err = printer.WriteStat(pairs)
+	}
+	if err != nil {
+		return err
+	}
+	printer.WriteSummary(pairs)
+	return nil
+}
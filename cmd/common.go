@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// die prints a fatal error like git does and returns its exit code.
+func die(format string, a ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "fatal: "+format+"\n", a...)
+	return 128
+}
+
+// usage prints an option parsing error and returns git's exit code for it.
+func usage(format string, a ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	return 129
+}
+
+// openRepository finds the repository of the current directory.
+func openRepository() (*repository.Repository, error) {
+	return repository.Discover()
+}
+
+// dwimRef expands a short ref name to the full name of an existing ref.
+func dwimRef(repo *repository.Repository, name string) (string, bool) {
+	for _, rule := range refs.DWIMRules {
+		full := fmt.Sprintf(rule, name)
+		if repo.Refs().Exists(full) {
+			return full, true
+		}
+	}
+	return "", false
+}
+
+// reflogRef is the ref whose reflog "<name>@{...}" reads. An empty name
+// means the current branch.
+func reflogRef(repo *repository.Repository, name string) (string, error) {
+	name, err := expandPriorCheckout(repo, name)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		head, err := repo.Refs().Read(refs.HEAD)
+		if err != nil {
+			return "", err
+		}
+		if head.IsSymbolic() {
+			return head.Symref, nil
+		}
+		return refs.HEAD, nil
+	}
+	full, ok := dwimRef(repo, name)
+	if !ok && repo.Refs().HasReflog(name) {
+		full, ok = name, true
+	}
+	if !ok {
+		return "", fmt.Errorf("ambiguous argument '%s@{...}': unknown revision or path not in the working tree.", name)
+	}
+	return full, nil
+}
+
+// resolveReflogRevision implements "<ref>@{<n>}" and "<ref>@{<date>}".
+// ref: https://git-scm.com/docs/gitrevisions#Documentation/gitrevisions.txt-emltrefnamegtltdategtemegemmasteryesterdayememHEAD5minutesagoem
+func resolveReflogRevision(repo *repository.Repository, name, selector string) (string, error) {
+	full, err := reflogRef(repo, name)
+	if err != nil {
+		return "", err
+	}
+	entries, err := repo.Refs().ReadReflog(full)
+	if err != nil {
+		return "", fmt.Errorf("log for '%s' is empty", refs.Shorten(full, repo.Refs().Exists))
+	}
+	display := name
+	if display == "" {
+		display = refs.Shorten(full, repo.Refs().Exists)
+	}
+	if n, err := strconv.Atoi(selector); err == nil && n >= 0 {
+		if n >= len(entries) {
+			if n == len(entries) && n > 0 && entries[0].Old != repo.Format.ZeroHex() {
+				return entries[0].Old, nil
+			}
+			return "", fmt.Errorf("log for '%s' only has %d entries", display, len(entries))
+		}
+		return entries[len(entries)-1-n].New, nil
+	}
+	when, err := date.Approx(selector, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("'%s@{%s}': %v", name, selector, err)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("log for '%s' is empty", display)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].When.After(when) {
+			return entries[i].New, nil
+		}
+	}
+	oldest := entries[0]
+	fmt.Fprintf(os.Stderr, "warning: log for '%s' only goes back to %s\n", display, oldest.When.Format(date.COMMIT_DATE_FORMAT))
+	if oldest.Old != repo.Format.ZeroHex() {
+		return oldest.Old, nil
+	}
+	return oldest.New, nil
+}
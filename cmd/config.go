@@ -0,0 +1,562 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+)
+
+type configOptions struct {
+	action     string
+	file       string
+	scope      config.Scope
+	hasScope   bool
+	typ        string
+	showOrigin bool
+	showScope  bool
+	nameOnly   bool
+	null       bool
+	def        *string
+	fixedValue bool // compare values to the value-pattern as strings
+	includes   int  // 1 for --includes, 0 for --no-includes, -1 if neither
+	args       []string
+}
+
+// Config implements "config".
+// ref: https://git-scm.com/docs/git-config
+func Config(args []string) int {
+	opts, code := parseConfigOptions(args)
+	if code != 0 {
+		return code
+	}
+	switch opts.action {
+	case "get", "get-all", "get-regexp":
+		return configGet(opts)
+	case "list":
+		return configList(opts)
+	case "set", "add", "replace-all":
+		return configSet(opts)
+	case "unset", "unset-all":
+		return configUnset(opts)
+	case "remove-section", "rename-section":
+		return configSection(opts)
+	}
+	return usage("unknown action: %s", opts.action)
+}
+
+func parseConfigOptions(args []string) (*configOptions, int) {
+	opts := &configOptions{includes: -1}
+	// "config get|set|unset|list ..." subcommands.
+	if len(args) > 0 {
+		switch args[0] {
+		case "get", "set", "unset", "list":
+			opts.action = args[0]
+			args = args[1:]
+		case "remove-section", "rename-section":
+			opts.action = args[0]
+			args = args[1:]
+		}
+	}
+	setAction := func(action string) int {
+		if opts.action != "" && opts.action != action {
+			return usage("only one action at a time")
+		}
+		opts.action = action
+		return 0
+	}
+	setScope := func(scope config.Scope) {
+		opts.scope, opts.hasScope = scope, true
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		code := 0
+		switch {
+		case arg == "--system":
+			setScope(config.ScopeSystem)
+		case arg == "--global":
+			setScope(config.ScopeGlobal)
+		case arg == "--local":
+			setScope(config.ScopeLocal)
+		case arg == "--worktree":
+			setScope(config.ScopeWorktree)
+		case arg == "-f" || arg == "--file":
+			if i+1 >= len(args) {
+				return nil, usage("switch `%s' requires a value", arg)
+			}
+			i++
+			opts.file = args[i]
+		case strings.HasPrefix(arg, "--file="):
+			opts.file = strings.TrimPrefix(arg, "--file=")
+		case arg == "--get" || arg == "--get-all" || arg == "--get-regexp" || arg == "--add" ||
+			arg == "--replace-all" || arg == "--unset" || arg == "--unset-all" || arg == "--set" ||
+			arg == "--remove-section" || arg == "--rename-section":
+			code = setAction(strings.TrimPrefix(arg, "--"))
+		case arg == "--all":
+			// "config get --all" and "config unset --all".
+			switch opts.action {
+			case "get":
+				opts.action = "get-all"
+			case "unset":
+				opts.action = "unset-all"
+			case "set":
+				opts.action = "replace-all"
+			}
+		case arg == "-l" || arg == "--list":
+			code = setAction("list")
+		case arg == "--bool" || arg == "--int" || arg == "--path" || arg == "--bool-or-int":
+			opts.typ = strings.TrimPrefix(arg, "--")
+		case strings.HasPrefix(arg, "--type="):
+			opts.typ = strings.TrimPrefix(arg, "--type=")
+			switch opts.typ {
+			case "bool", "int", "bool-or-int", "path":
+			default:
+				return nil, usage("unrecognized --type argument, %s", opts.typ)
+			}
+		case arg == "--show-origin":
+			opts.showOrigin = true
+		case arg == "--show-scope":
+			opts.showScope = true
+		case arg == "--name-only":
+			opts.nameOnly = true
+		case arg == "-z" || arg == "--null":
+			opts.null = true
+		case arg == "--fixed-value":
+			opts.fixedValue = true
+		case arg == "--includes":
+			opts.includes = 1
+		case arg == "--no-includes":
+			opts.includes = 0
+		case arg == "--default":
+			if i+1 >= len(args) {
+				return nil, usage("option `default' requires a value")
+			}
+			i++
+			opts.def = &args[i]
+		case strings.HasPrefix(arg, "--default="):
+			def := strings.TrimPrefix(arg, "--default=")
+			opts.def = &def
+		case arg == "--":
+			opts.args = append(opts.args, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return nil, usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			opts.args = append(opts.args, arg)
+		}
+		if code != 0 {
+			return nil, code
+		}
+	}
+	if opts.file != "" && !opts.hasScope {
+		opts.scope = config.ScopeCommand
+	}
+	if opts.action == "" {
+		// Legacy "config <key>" and "config <key> <value> [<value-pattern>]".
+		switch len(opts.args) {
+		case 0:
+			return nil, usage("no action specified")
+		case 1:
+			opts.action = "get"
+		case 2, 3:
+			opts.action = "set"
+		default:
+			return nil, usage("usage: git config [<options>]")
+		}
+	}
+	if _, ok := opts.valuePattern(); opts.fixedValue && !ok {
+		return nil, usage("--fixed-value only applies with 'value-pattern'")
+	}
+	return opts, 0
+}
+
+// valuePattern is the value-pattern argument of the action, if given.
+func (opts *configOptions) valuePattern() (string, bool) {
+	i := 1
+	switch opts.action {
+	case "get", "get-all", "get-regexp", "unset", "unset-all":
+	case "set", "replace-all":
+		i = 2
+	default:
+		return "", false
+	}
+	if len(opts.args) <= i {
+		return "", false
+	}
+	return opts.args[i], true
+}
+
+// loadForRead returns the merged configuration, or just one file when a
+// location option was given. Includes are followed in the merged
+// configuration, and in the one file only with --includes.
+func (opts *configOptions) loadForRead() (*config.Config, error) {
+	gitDir := ""
+	if repo, err := openRepository(); err == nil {
+		gitDir = repo.GitDir
+	}
+	if opts.file == "" && !opts.hasScope {
+		if opts.includes == 0 {
+			return config.LoadNoIncludes(gitDir)
+		}
+		return config.Load(gitDir)
+	}
+	path, err := opts.targetPath()
+	if err != nil {
+		return nil, err
+	}
+	if opts.includes == 1 {
+		return config.LoadFile(path, opts.scope, gitDir)
+	}
+	f, err := config.ReadFile(path, opts.scope)
+	if err != nil {
+		return nil, err
+	}
+	return &config.Config{Entries: f.Entries}, nil
+}
+
+// targetPath is the file written by set and unset.
+func (opts *configOptions) targetPath() (string, error) {
+	if opts.file != "" {
+		return opts.file, nil
+	}
+	switch opts.scope {
+	case config.ScopeSystem:
+		if opts.hasScope {
+			return config.SystemPath(), nil
+		}
+	case config.ScopeGlobal:
+		return config.GlobalPath(), nil
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return "", errors.New("not in a git directory")
+	}
+	if opts.hasScope && opts.scope == config.ScopeWorktree {
+		return repo.Path("config.worktree"), nil
+	}
+	return repo.Path("config"), nil
+}
+
+func (opts *configOptions) terminator() string {
+	if opts.null {
+		return "\x00"
+	}
+	return "\n"
+}
+
+// format converts a value according to --type.
+func (opts *configOptions) format(e *config.Entry) (string, error) {
+	switch opts.typ {
+	case "bool":
+		b, err := config.ParseBool(e.Value, e.NoValue)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	case "int":
+		n, err := config.ParseInt(e.Value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	case "bool-or-int":
+		if n, err := config.ParseInt(e.Value); err == nil && !e.NoValue {
+			return strconv.FormatInt(n, 10), nil
+		}
+		b, err := config.ParseBool(e.Value, e.NoValue)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	case "path":
+		return config.ExpandPath(e.Value), nil
+	}
+	return e.Value, nil
+}
+
+// normalize converts a value to be written according to --type.
+func (opts *configOptions) normalize(value string) (string, error) {
+	if opts.typ == "" || opts.typ == "path" {
+		return value, nil
+	}
+	return opts.format(&config.Entry{Value: value})
+}
+
+func (opts *configOptions) prefix(e *config.Entry) string {
+	prefix := ""
+	if opts.showScope {
+		prefix += e.Scope.String() + "\t"
+	}
+	if opts.showOrigin {
+		if e.Scope == config.ScopeCommand {
+			prefix += "command line:\t"
+		} else {
+			prefix += "file:" + e.Origin + "\t"
+		}
+	}
+	return prefix
+}
+
+// valueMatcher compiles the value-pattern, nil without one. "!" negates
+// it, and --fixed-value compares values to it as they are.
+func (opts *configOptions) valueMatcher() (func(string) bool, error) {
+	pattern, ok := opts.valuePattern()
+	if !ok {
+		return nil, nil
+	}
+	if opts.fixedValue {
+		return func(value string) bool {
+			return value == pattern
+		}, nil
+	}
+	negate := strings.HasPrefix(pattern, "!")
+	re, err := regexp.Compile(strings.TrimPrefix(pattern, "!"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %s", pattern)
+	}
+	return func(value string) bool {
+		return re.MatchString(value) != negate
+	}, nil
+}
+
+func configGet(opts *configOptions) int {
+	if len(opts.args) < 1 || len(opts.args) > 2 {
+		return usage("wrong number of arguments, should be from 1 to 2")
+	}
+	cfg, err := opts.loadForRead()
+	if err != nil {
+		return die("%v", err)
+	}
+	matchValue, err := opts.valueMatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 6
+	}
+	if matchValue == nil {
+		matchValue = func(string) bool { return true }
+	}
+
+	matches := []*config.Entry{}
+	if opts.action == "get-regexp" {
+		re, err := regexp.Compile("(?i)" + opts.args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid key pattern: %s\n", opts.args[0])
+			return 6
+		}
+		for _, e := range cfg.Entries {
+			if re.MatchString(e.Key()) && matchValue(e.Value) {
+				matches = append(matches, e)
+			}
+		}
+	} else {
+		if _, err := config.CanonicalKey(opts.args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		for _, e := range cfg.All(opts.args[0]) {
+			if matchValue(e.Value) {
+				matches = append(matches, e)
+			}
+		}
+	}
+	if len(matches) == 0 {
+		if opts.def != nil && opts.action != "get-regexp" {
+			value, err := opts.normalize(*opts.def)
+			if err != nil {
+				return die("%v", err)
+			}
+			fmt.Print(value + opts.terminator())
+			return 0
+		}
+		return 1
+	}
+	if opts.action == "get" {
+		matches = matches[len(matches)-1:]
+	}
+	for _, e := range matches {
+		value, err := opts.format(e)
+		if err != nil {
+			return die("%v", err)
+		}
+		line := opts.prefix(e)
+		if opts.action == "get-regexp" {
+			line += e.Key()
+			if !opts.nameOnly && !(e.NoValue && opts.typ == "") {
+				if opts.null {
+					line += "\n"
+				} else {
+					line += " "
+				}
+				line += value
+			}
+		} else {
+			line += value
+		}
+		fmt.Print(line + opts.terminator())
+	}
+	return 0
+}
+
+func configList(opts *configOptions) int {
+	if len(opts.args) != 0 {
+		return usage("wrong number of arguments, should be 0")
+	}
+	cfg, err := opts.loadForRead()
+	if err != nil {
+		return die("%v", err)
+	}
+	for _, e := range cfg.Entries {
+		line := opts.prefix(e) + e.Key()
+		if !opts.nameOnly && !e.NoValue {
+			if opts.null {
+				line += "\n"
+			} else {
+				line += "="
+			}
+			line += e.Value
+		}
+		fmt.Print(line + opts.terminator())
+	}
+	return 0
+}
+
+func configSet(opts *configOptions) int {
+	if opts.action == "add" && len(opts.args) != 2 {
+		return usage("wrong number of arguments, should be 2")
+	}
+	if len(opts.args) < 2 || len(opts.args) > 3 {
+		return usage("wrong number of arguments, should be from 2 to 3")
+	}
+	matchValue, err := opts.valueMatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 6
+	}
+	key := opts.args[0]
+	value, err := opts.normalize(opts.args[1])
+	if err != nil {
+		return die("%v", err)
+	}
+	path, err := opts.targetPath()
+	if err != nil {
+		return die("%v", err)
+	}
+	f, err := config.ReadFile(path, opts.scope)
+	if err != nil {
+		return die("%v", err)
+	}
+	if opts.action == "add" {
+		err = f.Add(key, value)
+	} else {
+		err = f.SetMatching(key, value, matchValue, opts.action == "replace-all")
+	}
+	if errors.Is(err, config.ErrMultipleValues) {
+		fmt.Fprintf(os.Stderr, "warning: %s has multiple values\n", key)
+		if matchValue == nil {
+			fmt.Fprintf(os.Stderr, "error: cannot overwrite multiple values with a single value\n       Use a regexp, --add or --replace-all to change %s.\n", key)
+		}
+		return 5
+	}
+	if errors.Is(err, config.ErrInvalidKey) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if err != nil {
+		return die("%v", err)
+	}
+	if err := f.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: could not lock config file %s: %v\n", path, err)
+		return 4
+	}
+	return 0
+}
+
+func configUnset(opts *configOptions) int {
+	if len(opts.args) < 1 || len(opts.args) > 2 {
+		return usage("wrong number of arguments, should be from 1 to 2")
+	}
+	path, err := opts.targetPath()
+	if err != nil {
+		return die("%v", err)
+	}
+	f, err := config.ReadFile(path, opts.scope)
+	if err != nil {
+		return die("%v", err)
+	}
+	matchValue, err := opts.valueMatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 6
+	}
+	key := opts.args[0]
+	n, err := f.UnsetMatching(key, matchValue, opts.action == "unset-all")
+	removed := n > 0
+	if errors.Is(err, config.ErrMultipleValues) {
+		fmt.Fprintf(os.Stderr, "warning: %s has multiple values\n", key)
+		return 5
+	}
+	if errors.Is(err, config.ErrInvalidKey) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if err != nil {
+		return die("%v", err)
+	}
+	if !removed {
+		return 5
+	}
+	if err := f.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: could not lock config file %s: %v\n", path, err)
+		return 4
+	}
+	return 0
+}
+
+func configSection(opts *configOptions) int {
+	want := 1
+	if opts.action == "rename-section" {
+		want = 2
+	}
+	if len(opts.args) != want {
+		return usage("wrong number of arguments, should be %d", want)
+	}
+	path, err := opts.targetPath()
+	if err != nil {
+		return die("%v", err)
+	}
+	f, err := config.ReadFile(path, opts.scope)
+	if err != nil {
+		return die("%v", err)
+	}
+	section, sub := splitSectionName(opts.args[0])
+	found := false
+	if opts.action == "remove-section" {
+		found, err = f.RemoveSection(section, sub)
+	} else {
+		newSection, newSub := splitSectionName(opts.args[1])
+		found, err = f.RenameSection(section, sub, newSection, newSub)
+	}
+	if err != nil {
+		return die("%v", err)
+	}
+	if !found {
+		return die("no such section: %s", opts.args[0])
+	}
+	if err := f.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: could not lock config file %s: %v\n", path, err)
+		return 4
+	}
+	return 0
+}
+
+// splitSectionName splits "section.subsection" as used by --remove-section.
+func splitSectionName(name string) (string, string) {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/wildmatch"
+)
+
+// describeOptions are the options %(describe) passes on to describe.
+type describeOptions struct {
+	tags     bool
+	abbrev   int // -1 for the default
+	match    []string
+	excludes []string
+}
+
+// describeName is a tag a commit can be described by.
+type describeName struct {
+	path     string // the name of the tag ref, without refs/tags/
+	prio     int    // 2 for annotated tags, 1 for lightweight ones
+	tag      string // the name recorded in an annotated tag
+	tagged   int64  // date of an annotated tag
+	misnamed bool
+	checked  bool
+}
+
+// describeCommit names a commit after the nearest tag that reaches it,
+// as "<tag>-<depth>-g<abbrev>", like git describe does. It returns ""
+// when no tag describes the commit.
+// ref: https://git-scm.com/docs/git-describe
+func describeCommit(repo *repository.Repository, sha string, opts describeOptions) string {
+	names := describeNames(repo, opts)
+	abbrev := opts.abbrev
+	if abbrev < 0 {
+		abbrev = defaultAbbrev(repo)
+	}
+	suffix := func(depth int, sha string) string {
+		return "-" + strconv.Itoa(depth) + "-g" + repo.Objects().Abbrev(sha, abbrev)
+	}
+	if n := names[sha]; n != nil && (opts.tags || n.prio == 2) {
+		name := n.name()
+		if n.misnamed {
+			name += suffix(0, sha)
+		}
+		return name
+	}
+
+	// Walk back from the commit in date order, counting for each tag
+	// met the commits it doesn't reach.
+	type candidate struct {
+		name  *describeName
+		depth int
+		flag  uint
+		order int
+	}
+	const seen = 1
+	const maxCandidates = 10
+	type node struct {
+		sha     string
+		parents []string
+		when    int64
+		flags   uint
+	}
+	nodes := map[string]*node{}
+	load := func(sha string) *node {
+		if n, ok := nodes[sha]; ok {
+			return n
+		}
+		info, err := readObjectInfo(repo.Objects(), sha)
+		if err != nil || info.typ != "commit" {
+			return nil
+		}
+		n := &node{sha: sha, parents: info.headerAll("parent")}
+		_, _, when := splitIdent(info.header("committer"))
+		if t, err := date.ParseRaw(when); err == nil {
+			n.when = t.Unix()
+		}
+		nodes[sha] = n
+		return n
+	}
+	insertByDate := func(list []*node, n *node) []*node {
+		i := 0
+		for i < len(list) && list[i].when >= n.when {
+			i++
+		}
+		list = append(list, nil)
+		copy(list[i+1:], list[i:])
+		list[i] = n
+		return list
+	}
+	start := load(sha)
+	if start == nil {
+		return ""
+	}
+	start.flags = seen
+	list := []*node{start}
+	matches := []*candidate{}
+	annotated, seenCommits := 0, 0
+	var gaveUpOn *node
+	addParents := func(c *node) {
+		for _, p := range c.parents {
+			pn := load(p)
+			if pn == nil {
+				continue
+			}
+			if pn.flags&seen == 0 {
+				list = insertByDate(list, pn)
+			}
+			pn.flags |= c.flags
+		}
+	}
+	for len(list) > 0 {
+		c := list[0]
+		list = list[1:]
+		seenCommits++
+		// Lightweight tags only count with tags.
+		if n := names[c.sha]; n != nil && (opts.tags || n.prio == 2) {
+			if len(matches) == maxCandidates {
+				gaveUpOn = c
+				break
+			}
+			t := &candidate{name: n, depth: seenCommits - 1, flag: 1 << uint(len(matches)+1), order: len(matches) + 1}
+			matches = append(matches, t)
+			c.flags |= t.flag
+			if n.prio == 2 {
+				annotated++
+			}
+		}
+		for _, t := range matches {
+			if c.flags&t.flag == 0 {
+				t.depth++
+			}
+		}
+		// Stop once the best candidates reach all that is left.
+		if annotated > 0 && len(list) == 0 {
+			best, within := int(^uint(0)>>1), uint(0)
+			for _, t := range matches {
+				if t.depth < best {
+					best, within = t.depth, t.flag
+				} else if t.depth == best {
+					within |= t.flag
+				}
+			}
+			if c.flags&within == within {
+				break
+			}
+		}
+		addParents(c)
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].depth != matches[j].depth {
+			return matches[i].depth < matches[j].depth
+		}
+		return matches[i].order < matches[j].order
+	})
+	best := matches[0]
+	if gaveUpOn != nil {
+		list = insertByDate(list, gaveUpOn)
+	}
+	// Finish counting the commits the best candidate doesn't reach.
+	for len(list) > 0 {
+		c := list[0]
+		list = list[1:]
+		if c.flags&best.flag != 0 {
+			all := true
+			for _, o := range list {
+				if o.flags&best.flag == 0 {
+					all = false
+					break
+				}
+			}
+			if all {
+				break
+			}
+		} else {
+			best.depth++
+		}
+		addParents(c)
+	}
+	name := best.name.name()
+	if best.name.misnamed || abbrev != 0 {
+		name += suffix(best.depth, sha)
+	}
+	return name
+}
+
+// name is how describe shows a tag: the name recorded in an annotated
+// tag, which may differ from that of its ref.
+func (n *describeName) name() string {
+	if n.tag == "" {
+		return n.path
+	}
+	if !n.checked {
+		n.misnamed = n.tag != n.path
+		n.checked = true
+	}
+	return n.tag
+}
+
+// describeNames reads the tags describe may use, keyed by the commit
+// they point to. Annotated tags win over lightweight ones, and the
+// newest annotated tag over older ones.
+func describeNames(repo *repository.Repository, opts describeOptions) map[string]*describeName {
+	names := map[string]*describeName{}
+	list, err := repo.Refs().List("refs/tags/")
+	if err != nil {
+		return names
+	}
+	for _, ref := range list {
+		path := strings.TrimPrefix(ref.Name, "refs/tags/")
+		excluded := false
+		for _, pattern := range opts.excludes {
+			if wildmatch.Match(pattern, path, 0) {
+				excluded = true
+			}
+		}
+		if excluded {
+			continue
+		}
+		if len(opts.match) > 0 {
+			found := false
+			for _, pattern := range opts.match {
+				if wildmatch.Match(pattern, path, 0) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		peeled, _, err := peel(repo.Objects(), ref.Target)
+		if err != nil {
+			continue
+		}
+		n := &describeName{path: path, prio: 1}
+		if peeled != ref.Target {
+			n.prio = 2
+			info, err := readObjectInfo(repo.Objects(), ref.Target)
+			if err != nil {
+				continue
+			}
+			n.tag = info.header("tag")
+			_, _, when := splitIdent(info.header("tagger"))
+			if t, err := date.ParseRaw(when); err == nil {
+				n.tagged = t.Unix()
+			}
+		}
+		e := names[peeled]
+		if e == nil || e.prio < n.prio || e.prio == 2 && n.prio == 2 && e.tagged < n.tagged {
+			names[peeled] = n
+		}
+	}
+	return names
+}
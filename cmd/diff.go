@@ -0,0 +1,595 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/attr"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/color"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// diffOutputOptions are the output options shared by the diff commands.
+type diffOutputOptions struct {
+	diffOptions diff.Options
+	patch       bool
+	stat        bool
+	statWidth   int
+	numstat     bool
+	shortstat   bool
+	nameOnly    bool
+	nameStatus  bool
+	noPatch     bool
+	abbrev      int
+	exitCode    bool
+	quiet       bool
+	raw         bool
+	rawAbbrev   int // 0 for full names
+	nul         bool
+	renames     diff.RenameOptions
+	color       string // --color, "" to follow color.diff
+	wordDiff    string
+	wordRegex   string
+	colorMoved  string
+	// plumbing makes the raw format the default instead of a patch.
+	plumbing bool
+}
+
+func newDiffOutputOptions(repo *repository.Repository) *diffOutputOptions {
+	o := &diffOutputOptions{diffOptions: diff.DefaultOptions(), abbrev: defaultAbbrev(repo)}
+	o.renames.Limit = diff.DefaultRenameLimit
+	if cfg, err := repo.Config(); err == nil {
+		if value, ok := cfg.Get("diff.algorithm"); ok && diff.IsAlgorithm(value) {
+			o.diffOptions.Algorithm = value
+		}
+		if value, ok := cfg.Get("diff.context"); ok {
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				o.diffOptions.Context = n
+			}
+		}
+		o.diffOptions.IndentHeuristic, _ = cfg.Bool("diff.indentHeuristic", true)
+		if value, ok := cfg.Get("diff.renameLimit"); ok {
+			if n, err := strconv.Atoi(value); err == nil {
+				o.renames.Limit = n
+			}
+		}
+		if value, ok := cfg.Get("diff.colorMoved"); ok {
+			if diff.IsColorMovedMode(value) {
+				o.colorMoved = value
+			} else if on, err := cfg.Bool("diff.colorMoved", false); err == nil && on {
+				o.colorMoved = "default"
+			}
+		}
+		o.wordRegex, _ = cfg.Get("diff.wordRegex")
+	}
+	return o
+}
+
+// configRenames applies diff.renames, which turns on rename detection in
+// the porcelain commands unless set to false, and to copies with "copies".
+func (o *diffOutputOptions) configRenames(repo *repository.Repository) {
+	o.renames.Detect = diff.DetectRenames
+	cfg, err := repo.Config()
+	if err != nil {
+		return
+	}
+	value, ok := cfg.Get("diff.renames")
+	if !ok {
+		return
+	}
+	if value == "copies" || value == "copy" {
+		o.renames.Detect = diff.DetectCopies
+	} else if on, err := cfg.Bool("diff.renames", true); err == nil && !on {
+		o.renames.Detect = 0
+	}
+}
+
+// parseRenameOption handles the rename, copy and break options.
+func (o *diffOutputOptions) parseRenameOption(arg string) (bool, int) {
+	score := func(value string) (int, bool) {
+		n, rest := diff.ParseScore(value)
+		return n, rest == ""
+	}
+	var value string
+	switch {
+	case arg == "--no-renames":
+		o.renames.Detect = 0
+		return true, 0
+	case arg == "--find-copies-harder":
+		o.renames.FindCopiesHarder = true
+		o.renames.Detect = diff.DetectCopies
+		return true, 0
+	case strings.HasPrefix(arg, "-l"):
+		n, err := strconv.Atoi(arg[2:])
+		if err != nil {
+			return true, usage("%s expects a numerical value", arg)
+		}
+		o.renames.Limit = n
+		return true, 0
+	case strings.HasPrefix(arg, "-M") || arg == "--find-renames" || strings.HasPrefix(arg, "--find-renames="):
+		o.renames.Detect = diff.DetectRenames
+		value = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(arg, "-M"), "--find-renames"), "=")
+	case strings.HasPrefix(arg, "-C") || arg == "--find-copies" || strings.HasPrefix(arg, "--find-copies="):
+		// A second -C looks for copies among unmodified files too.
+		if o.renames.Detect == diff.DetectCopies {
+			o.renames.FindCopiesHarder = true
+		}
+		o.renames.Detect = diff.DetectCopies
+		value = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(arg, "-C"), "--find-copies"), "=")
+	case strings.HasPrefix(arg, "-B") || arg == "--break-rewrites" || strings.HasPrefix(arg, "--break-rewrites="):
+		value = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(arg, "-B"), "--break-rewrites"), "=")
+		breakValue, mergeValue := value, ""
+		if i := strings.IndexByte(value, '/'); i >= 0 {
+			breakValue, mergeValue = value[:i], value[i+1:]
+		}
+		breakScore, ok := score(breakValue)
+		mergeScore, mergeOK := score(mergeValue)
+		if !ok || !mergeOK {
+			return true, usage("broken break-rewrites option: %s", arg)
+		}
+		o.renames.Break = true
+		o.renames.BreakScore, o.renames.MergeScore = breakScore, mergeScore
+		return true, 0
+	default:
+		return false, 0
+	}
+	n, ok := score(value)
+	if !ok {
+		return true, usage("broken rename option: %s", arg)
+	}
+	o.renames.MinScore = n
+	return true, 0
+}
+
+// parse handles one output option, reporting whether it was one and the
+// exit code of a bad one.
+// ref: https://git-scm.com/docs/diff-options
+func (o *diffOutputOptions) parse(repo *repository.Repository, arg string) (bool, int) {
+	if handled, code := o.parseRenameOption(arg); handled {
+		return true, code
+	}
+	switch {
+	case arg == "--raw":
+		o.raw = true
+	case arg == "-z":
+		o.nul = true
+	case arg == "-p" || arg == "-u" || arg == "--patch":
+		o.patch, o.noPatch = true, false
+	case arg == "-s" || arg == "--no-patch":
+		o.noPatch = true
+	case arg == "--stat":
+		o.stat = true
+	case strings.HasPrefix(arg, "--stat="):
+		o.stat = true
+		o.statWidth, _ = strconv.Atoi(strings.TrimPrefix(arg, "--stat="))
+	case arg == "--numstat":
+		o.numstat = true
+	case arg == "--shortstat":
+		o.shortstat = true
+	case arg == "--name-only":
+		o.nameOnly = true
+	case arg == "--name-status":
+		o.nameStatus = true
+	case strings.HasPrefix(arg, "-U") || strings.HasPrefix(arg, "--unified="):
+		value := strings.TrimPrefix(strings.TrimPrefix(arg, "-U"), "--unified=")
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return true, usage("%s expects a numerical value", arg)
+		}
+		o.diffOptions.Context = n
+		o.patch = true
+	case strings.HasPrefix(arg, "--inter-hunk-context="):
+		n, err := strconv.Atoi(strings.TrimPrefix(arg, "--inter-hunk-context="))
+		if err != nil || n < 0 {
+			return true, usage("%s expects a numerical value", arg)
+		}
+		o.diffOptions.InterHunkContext = n
+	case strings.HasPrefix(arg, "--diff-algorithm="):
+		value := strings.TrimPrefix(arg, "--diff-algorithm=")
+		if !diff.IsAlgorithm(value) {
+			return true, usage("option diff-algorithm accepts \"myers\", \"minimal\", \"patience\" and \"histogram\"")
+		}
+		o.diffOptions.Algorithm = value
+	case arg == "--minimal":
+		o.diffOptions.Algorithm = "minimal"
+	case arg == "--patience":
+		o.diffOptions.Algorithm = "patience"
+	case arg == "--histogram":
+		o.diffOptions.Algorithm = "histogram"
+	case arg == "--indent-heuristic":
+		o.diffOptions.IndentHeuristic = true
+	case arg == "--no-indent-heuristic":
+		o.diffOptions.IndentHeuristic = false
+	case arg == "--full-index":
+		o.abbrev = repo.Format.HexSize()
+		o.rawAbbrev = 0
+	case strings.HasPrefix(arg, "--abbrev="):
+		o.abbrev = parseAbbrev(strings.TrimPrefix(arg, "--abbrev="))
+		o.rawAbbrev = o.abbrev
+	case arg == "--abbrev":
+		o.rawAbbrev = o.abbrev
+	case arg == "--exit-code":
+		o.exitCode = true
+	case arg == "--quiet":
+		o.quiet, o.exitCode = true, true
+	case arg == "-w" || arg == "--ignore-all-space":
+		o.diffOptions.Whitespace |= diff.IgnoreAllSpace
+	case arg == "-b" || arg == "--ignore-space-change":
+		o.diffOptions.Whitespace |= diff.IgnoreSpaceChange
+	case arg == "--ignore-space-at-eol":
+		o.diffOptions.Whitespace |= diff.IgnoreSpaceAtEOL
+	case arg == "--ignore-cr-at-eol":
+		o.diffOptions.Whitespace |= diff.IgnoreCRAtEOL
+	case arg == "--ignore-blank-lines":
+		o.diffOptions.IgnoreBlankLines = true
+	case arg == "-W" || arg == "--function-context":
+		o.diffOptions.FunctionContext = true
+	case arg == "--no-function-context":
+		o.diffOptions.FunctionContext = false
+	case arg == "--color":
+		o.color = "always"
+	case strings.HasPrefix(arg, "--color="):
+		o.color = strings.TrimPrefix(arg, "--color=")
+		switch o.color {
+		case "always", "never", "auto":
+		default:
+			return true, usage("option `color' expects \"always\", \"auto\", or \"never\"")
+		}
+	case arg == "--no-color":
+		o.color = "never"
+	case arg == "--word-diff":
+		o.wordDiff = "plain"
+	case strings.HasPrefix(arg, "--word-diff="):
+		o.wordDiff = strings.TrimPrefix(arg, "--word-diff=")
+		if o.wordDiff == "none" {
+			o.wordDiff = ""
+		} else if !diff.IsWordDiffMode(o.wordDiff) {
+			return true, usage("bad --word-diff argument: %s", o.wordDiff)
+		}
+	case strings.HasPrefix(arg, "--word-diff-regex="):
+		o.wordRegex = strings.TrimPrefix(arg, "--word-diff-regex=")
+		if o.wordDiff == "" {
+			o.wordDiff = "plain"
+		}
+	case arg == "--color-words" || strings.HasPrefix(arg, "--color-words="):
+		o.wordDiff = "color"
+		if strings.HasPrefix(arg, "--color-words=") {
+			o.wordRegex = strings.TrimPrefix(arg, "--color-words=")
+		}
+	case arg == "--color-moved":
+		o.colorMoved = "default"
+	case strings.HasPrefix(arg, "--color-moved="):
+		o.colorMoved = strings.TrimPrefix(arg, "--color-moved=")
+		if !diff.IsColorMovedMode(o.colorMoved) {
+			return true, usage("bad --color-moved argument: %s", o.colorMoved)
+		}
+	case arg == "--no-color-moved":
+		o.colorMoved = "no"
+	case arg == "--no-ext-diff":
+	default:
+		return false, 0
+	}
+	return true, 0
+}
+
+// setupPrinter applies the options that need the configuration: colors,
+// diff drivers, word diffs and moved lines.
+// ref: https://git-scm.com/docs/diff-options#Documentation/diff-options.txt---color-moved-modegt
+func (o *diffOutputOptions) setupPrinter(repo *repository.Repository, printer *diff.Printer) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	setting := o.color
+	if setting == "" {
+		setting = color.Setting(cfg, "color.diff")
+	}
+	// --word-diff=color colors the patch whatever the settings say.
+	if color.Use(setting, os.Stdout) || o.wordDiff == "color" {
+		if printer.Colors, err = diff.LoadColors(cfg); err != nil {
+			return err
+		}
+	}
+	if value, ok := cfg.Get("core.whitespace"); ok {
+		printer.WhitespaceRule = diff.ParseWhitespaceRule(value)
+	}
+	attrs, err := attr.New(repo.WorkTree, repo.GitDir, cfg)
+	if err != nil {
+		return err
+	}
+	printer.Drivers = diff.NewDrivers(attrs, cfg)
+	printer.WordDiff = o.wordDiff
+	if o.wordDiff != "" && o.wordRegex != "" {
+		if printer.WordRegex, err = diff.CompileRegex(o.wordRegex, false, true); err != nil {
+			return fmt.Errorf("invalid regular expression: %s", o.wordRegex)
+		}
+	}
+	switch o.colorMoved {
+	case "", "no":
+	case "default":
+		printer.ColorMoved = "zebra"
+	default:
+		printer.ColorMoved = strings.Replace(o.colorMoved, "_", "-", 1)
+	}
+	return nil
+}
+
+// treeOptions are the options of the tree comparison the output options
+// need: copies from unmodified files need those files.
+func (o *diffOutputOptions) treeOptions(paths []string) diff.TreeOptions {
+	return diff.TreeOptions{Recursive: true, Paths: paths, Unmodified: o.renames.FindCopiesHarder}
+}
+
+// detect finds renames and breaks rewrites among the pairs, as asked.
+func (o *diffOutputOptions) detect(repo *repository.Repository, pairs []diff.FilePair) ([]diff.FilePair, error) {
+	if o.renames.Detect == 0 && !o.renames.Break && !o.renames.FindCopiesHarder {
+		return pairs, nil
+	}
+	return diff.Detect(repo.Objects(), pairs, o.renames)
+}
+
+// write shows the pairs in the formats asked for, a patch or the raw
+// format when none was, and returns the exit code: 1 for differences
+// with --exit-code.
+func (o *diffOutputOptions) write(repo *repository.Repository, pairs []diff.FilePair) int {
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	printer := &diff.Printer{
+		Store:         repo.Objects(),
+		Out:           out,
+		Options:       o.diffOptions,
+		Abbrev:        o.abbrev,
+		RawAbbrev:     o.rawAbbrev,
+		Width:         o.statWidth,
+		NulTerminated: o.nul,
+	}
+	code := 0
+	if o.exitCode && len(pairs) > 0 {
+		code = 1
+	}
+	if o.quiet {
+		return code
+	}
+	fail := func(err error) int {
+		out.Flush()
+		return die("%v", err)
+	}
+	if err := o.setupPrinter(repo, printer); err != nil {
+		return fail(err)
+	}
+	if o.nameOnly || o.nameStatus {
+		printer.WriteNames(pairs, o.nameStatus)
+		return code
+	}
+	stats := o.stat || o.numstat || o.shortstat
+	chosen := o.raw || o.patch || stats
+	raw := o.raw || !chosen && o.plumbing
+	patch := o.patch || !chosen && !o.plumbing
+	if o.noPatch {
+		raw, patch = false, false
+	}
+	if raw {
+		printer.WriteRaw(pairs)
+	}
+	if o.numstat {
+		if err := printer.WriteNumStat(pairs); err != nil {
+			return fail(err)
+		}
+	}
+	if o.stat {
+		if err := printer.WriteStat(pairs); err != nil {
+			return fail(err)
+		}
+	} else if o.shortstat {
+		if err := printer.WriteShortStat(pairs); err != nil {
+			return fail(err)
+		}
+	}
+	if !patch {
+		return code
+	}
+	if (raw || stats) && len(pairs) > 0 {
+		if o.nul {
+			out.WriteString("\x00")
+		} else {
+			out.WriteString("\n")
+		}
+	}
+	for _, pair := range pairs {
+		if err := printer.Patch(pair); err != nil {
+			return fail(err)
+		}
+	}
+	printer.Flush()
+	return code
+}
+
+// diffPaths makes paths given on the command line relative to the top.
+func diffPaths(repo *repository.Repository, args []string) []string {
+	paths := []string{}
+	for _, p := range args {
+		p = path.Join(repo.Prefix, filepath.ToSlash(p))
+		if p == "." {
+			p = ""
+		}
+		paths = append(paths, strings.Trim(p, "/"))
+	}
+	return paths
+}
+
+// Diff implements "diff": the work tree against the index, the index
+// against a commit with --cached, the work tree against a commit, or two
+// commits against each other.
+// ref: https://git-scm.com/docs/git-diff
+func Diff(args []string) int {
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	o := newDiffOutputOptions(repo)
+	o.configRenames(repo)
+	cached := false
+	revs, paths := []string{}, []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		if len(paths) == 0 && strings.HasPrefix(arg, "-") && arg != "-" {
+			handled, code := o.parse(repo, arg)
+			if code != 0 {
+				return code
+			}
+			if handled {
+				continue
+			}
+			if arg == "--cached" || arg == "--staged" {
+				cached = true
+				continue
+			}
+			return usage("invalid option: %s", arg)
+		}
+		if len(paths) > 0 {
+			paths = append(paths, arg)
+			continue
+		}
+		if err := diffRevisionArg(repo, arg, &revs); err != nil {
+			if !isUnknownRevision(err) {
+				return die("%v", err)
+			}
+			if _, statErr := os.Lstat(arg); statErr != nil {
+				return die("%s", ambiguousArgument(arg))
+			}
+			paths = append(paths, arg)
+		}
+	}
+	opts := o.treeOptions(diffPaths(repo, paths))
+	store := repo.Objects()
+
+	var pairs []diff.FilePair
+	switch {
+	case len(revs) > 2 || cached && len(revs) > 1:
+		return usage("usage: git diff [<options>] [<commit>] [--] [<path>...]")
+	case len(revs) == 2:
+		pairs, err = diff.Trees(store, revs[0], revs[1], opts)
+	default:
+		if !cached && repo.IsBare() {
+			return die("this operation must be run in a work tree")
+		}
+		idx, err := repo.Index()
+		if err != nil {
+			return die("%v", err)
+		}
+		switch {
+		case len(revs) == 1 && cached:
+			pairs, err = diff.TreeIndex(store, revs[0], idx, "", opts)
+		case len(revs) == 1:
+			pairs, err = diff.TreeIndex(store, revs[0], idx, repo.WorkTree, opts)
+		case cached:
+			head, headErr := headTree(repo)
+			if headErr != nil {
+				return die("%v", headErr)
+			}
+			pairs, err = diff.TreeIndex(store, head, idx, "", opts)
+		default:
+			pairs, err = diff.IndexFiles(store, idx, repo.WorkTree, opts)
+		}
+		if err != nil {
+			return die("%v", err)
+		}
+	}
+	if err != nil {
+		return die("%v", err)
+	}
+	if pairs, err = o.detect(repo, pairs); err != nil {
+		return die("%v", err)
+	}
+	return o.write(repo, pairs)
+}
+
+// diffRevisionArg resolves one revision argument of "diff" to the trees
+// it compares: "<a>..<b>" names both sides, "<a>...<b>" compares the
+// merge base of a and b with b.
+func diffRevisionArg(repo *repository.Repository, arg string, trees *[]string) error {
+	tree := func(rev string) (string, error) {
+		if rev == "" {
+			rev = refs.HEAD
+		}
+		sha, err := resolveRevision(repo, rev)
+		if err != nil {
+			return "", err
+		}
+		return peelTo(repo, rev, sha, "tree")
+	}
+	if i := strings.Index(arg, ".."); i >= 0 {
+		left, right := arg[:i], arg[i+2:]
+		symmetric := strings.HasPrefix(right, ".")
+		if symmetric {
+			right = right[1:]
+		}
+		if _, err := tree(left); err == nil {
+			if symmetric {
+				if left == "" {
+					left = refs.HEAD
+				}
+				if right == "" {
+					right = refs.HEAD
+				}
+				a, err := resolveRevisionAs(repo, left+"^{commit}", "commit")
+				if err != nil {
+					return err
+				}
+				b, err := resolveRevisionAs(repo, right+"^{commit}", "commit")
+				if err != nil {
+					return err
+				}
+				bases, err := merge.Bases(repo.Objects(), a, []string{b})
+				if err != nil {
+					return err
+				}
+				if len(bases) == 0 {
+					return &unknownRevisionError{arg}
+				}
+				left = bases[0]
+			}
+			leftTree, err := tree(left)
+			if err != nil {
+				return err
+			}
+			rightTree, err := tree(right)
+			if err != nil {
+				return err
+			}
+			*trees = append(*trees, leftTree, rightTree)
+			return nil
+		}
+	}
+	sha, err := tree(arg)
+	if err != nil {
+		return err
+	}
+	*trees = append(*trees, sha)
+	return nil
+}
+
+// headTree is the tree of HEAD, or the empty tree on an unborn branch.
+func headTree(repo *repository.Repository) (string, error) {
+	head, err := repo.Refs().Resolve(refs.HEAD)
+	if errors.Is(err, refs.ErrNotFound) && head != nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return peelTo(repo, refs.HEAD, head.Target, "tree")
+}
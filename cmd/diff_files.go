@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+)
+
+// DiffFiles implements "diff-files": the work tree against the index, in
+// the raw format by default. Files are judged by their stat data without
+// being hashed, so a touched file shows up until "update-index --refresh".
+// ref: https://git-scm.com/docs/git-diff-files
+func DiffFiles(args []string) int {
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	if repo.IsBare() {
+		return die("this operation must be run in a work tree")
+	}
+	o := newDiffOutputOptions(repo)
+	o.plumbing = true
+	silentMissing := false
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		if len(paths) == 0 && strings.HasPrefix(arg, "-") {
+			handled, code := o.parse(repo, arg)
+			if code != 0 {
+				return code
+			}
+			if handled {
+				continue
+			}
+			if arg == "-q" {
+				silentMissing = true
+				continue
+			}
+			return usage("unknown option: %s", arg)
+		}
+		paths = append(paths, arg)
+	}
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	opts := o.treeOptions(diffPaths(repo, paths))
+	opts.StatDirty = true
+	pairs, err := diff.IndexFiles(repo.Objects(), idx, repo.WorkTree, opts)
+	if err != nil {
+		return die("%v", err)
+	}
+	if silentMissing {
+		kept := []diff.FilePair{}
+		for _, pair := range pairs {
+			if pair.Status != diff.Deleted {
+				kept = append(kept, pair)
+			}
+		}
+		pairs = kept
+	}
+	if pairs, err = o.detect(repo, pairs); err != nil {
+		return die("%v", err)
+	}
+	return o.write(repo, pairs)
+}
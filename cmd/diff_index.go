@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+)
+
+// DiffIndex implements "diff-index": a tree against the work tree, or
+// against the index with --cached, in the raw format by default. Like
+// diff-files it trusts the stat data of the index for the work tree.
+// ref: https://git-scm.com/docs/git-diff-index
+func DiffIndex(args []string) int {
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	o := newDiffOutputOptions(repo)
+	o.plumbing = true
+	cached, missingAsIndexed := false, false
+	tree, name := "", ""
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		if name == "" && strings.HasPrefix(arg, "-") {
+			handled, code := o.parse(repo, arg)
+			if code != 0 {
+				return code
+			}
+			if handled {
+				continue
+			}
+			switch arg {
+			case "--cached":
+				cached = true
+			case "-m":
+				missingAsIndexed = true
+			default:
+				return usage("unknown option: %s", arg)
+			}
+			continue
+		}
+		if name != "" {
+			paths = append(paths, arg)
+			continue
+		}
+		sha, err := resolveRevision(repo, arg)
+		if err != nil {
+			if !isUnknownRevision(err) {
+				return die("%v", err)
+			}
+			if _, statErr := os.Lstat(arg); statErr != nil {
+				return die("%s", ambiguousArgument(arg))
+			}
+			return usage("usage: git diff-index [-m] [--cached] [<common-diff-options>] <tree-ish> [<path>...]")
+		}
+		if tree, err = peelTo(repo, arg, sha, "tree"); err != nil {
+			return die("%v", err)
+		}
+		name = arg
+	}
+	if name == "" {
+		return usage("usage: git diff-index [-m] [--cached] [<common-diff-options>] <tree-ish> [<path>...]")
+	}
+	if !cached && repo.IsBare() {
+		return die("this operation must be run in a work tree")
+	}
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	opts := o.treeOptions(diffPaths(repo, paths))
+	opts.StatDirty = true
+	opts.MissingAsIndexed = missingAsIndexed
+	workTree := repo.WorkTree
+	if cached {
+		workTree = ""
+	}
+	pairs, err := diff.TreeIndex(repo.Objects(), tree, idx, workTree, opts)
+	if err != nil {
+		return die("%v", err)
+	}
+	if pairs, err = o.detect(repo, pairs); err != nil {
+		return die("%v", err)
+	}
+	return o.write(repo, pairs)
+}
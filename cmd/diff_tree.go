@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// DiffTree implements "diff-tree": the raw diff between two trees, or
+// between a commit and its parents, preceded by the name of the commit.
+// Without -r only the top level is compared.
+// ref: https://git-scm.com/docs/git-diff-tree
+func DiffTree(args []string) int {
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	o := newDiffOutputOptions(repo)
+	o.plumbing = true
+	opts := diff.TreeOptions{}
+	root, noCommitID, merges := false, false, false
+	revs, names, paths := []string{}, []string{}, []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		if len(paths) == 0 && strings.HasPrefix(arg, "-") {
+			handled, code := o.parse(repo, arg)
+			if code != 0 {
+				return code
+			}
+			if handled {
+				continue
+			}
+			switch arg {
+			case "-r":
+				opts.Recursive = true
+			case "-t":
+				opts.Recursive, opts.ShowTrees = true, true
+			case "--root":
+				root = true
+			case "--no-commit-id":
+				noCommitID = true
+			case "-m":
+				merges = true
+			default:
+				return usage("unknown option: %s", arg)
+			}
+			continue
+		}
+		if len(paths) > 0 || len(revs) == 2 {
+			paths = append(paths, arg)
+			continue
+		}
+		sha, err := resolveRevision(repo, arg)
+		if err != nil {
+			if !isUnknownRevision(err) {
+				return die("%v", err)
+			}
+			if _, statErr := os.Lstat(arg); statErr != nil {
+				return die("%s", ambiguousArgument(arg))
+			}
+			paths = append(paths, arg)
+			continue
+		}
+		revs, names = append(revs, sha), append(names, arg)
+	}
+	// Everything but the raw and name formats needs the whole tree.
+	if o.patch || o.stat || o.numstat || o.shortstat {
+		opts.Recursive = true
+	}
+	opts.Paths = diffPaths(repo, paths)
+	opts.Unmodified = o.renames.FindCopiesHarder
+
+	compare := func(oldTree, newTree string) ([]diff.FilePair, error) {
+		pairs, err := diff.Trees(repo.Objects(), oldTree, newTree, opts)
+		if err != nil {
+			return nil, err
+		}
+		return o.detect(repo, pairs)
+	}
+	switch len(revs) {
+	case 2:
+		trees := make([]string, 2)
+		for i, rev := range revs {
+			if trees[i], err = peelTo(repo, names[i], rev, "tree"); err != nil {
+				return die("%v", err)
+			}
+		}
+		pairs, err := compare(trees[0], trees[1])
+		if err != nil {
+			return die("%v", err)
+		}
+		return o.write(repo, pairs)
+	case 1:
+	default:
+		return usage("usage: git diff-tree [<options>] <tree-ish> [<tree-ish>] [<path>...]")
+	}
+
+	sha, err := peelTo(repo, names[0], revs[0], "commit")
+	if err != nil {
+		return die("%v", err)
+	}
+	data, err := repo.Objects().ReadType(sha, "commit")
+	if err != nil {
+		return die("%v", err)
+	}
+	commit, err := object.ParseCommit(data)
+	if err != nil {
+		return die("%s: %v", sha, err)
+	}
+	parents := commit.Parents
+	switch {
+	case len(parents) == 0 && !root:
+		return 0
+	case len(parents) == 0:
+		parents = []string{""}
+	case len(parents) > 1 && !merges:
+		return 0
+	}
+	code := 0
+	for _, parent := range parents {
+		oldTree := ""
+		if parent != "" {
+			if oldTree, err = peelTo(repo, parent, parent, "tree"); err != nil {
+				return die("%v", err)
+			}
+		}
+		pairs, err := compare(oldTree, commit.Tree)
+		if err != nil {
+			return die("%v", err)
+		}
+		if len(pairs) == 0 {
+			continue
+		}
+		// Each parent's diff is headed by the commit.
+		if !noCommitID && !o.quiet {
+			terminator := "\n"
+			if o.nul {
+				terminator = "\x00"
+			}
+			fmt.Print(sha + terminator)
+		}
+		if c := o.write(repo, pairs); c != 0 {
+			code = c
+		}
+	}
+	return code
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// editor is the command that edits messages: GIT_EDITOR, core.editor,
+// VISUAL unless the terminal is dumb, EDITOR, and vi at last.
+// ref: git_editor in https://github.com/git/git/blob/master/editor.c
+func editor(repo *repository.Repository) string {
+	if value := os.Getenv("GIT_EDITOR"); value != "" {
+		return value
+	}
+	if cfg, err := repo.Config(); err == nil {
+		if value, ok := cfg.Get("core.editor"); ok && value != "" {
+			return value
+		}
+	}
+	if value := os.Getenv("VISUAL"); value != "" && os.Getenv("TERM") != "dumb" {
+		return value
+	}
+	if value := os.Getenv("EDITOR"); value != "" {
+		return value
+	}
+	return "vi"
+}
+
+// launchEditor runs an editor command on a file through the shell, as
+// git does, so that the command may have arguments. ":" edits nothing.
+// ref: launch_specified_editor in https://github.com/git/git/blob/master/editor.c
+func launchEditor(command, path string) error {
+	if command == ":" {
+		return nil
+	}
+	c := exec.Command("sh", "-c", command+` "$@"`, command, path)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("there was a problem with the editor '%s'", command)
+	}
+	return nil
+}
+
+// cleanupMessage tidies a message the way "commit --cleanup" does:
+// trailing whitespace and leading and trailing blank lines go, runs of
+// blank lines become one, and with stripComments lines starting with
+// "#" go too. A message that isn't empty ends with a newline.
+// ref: strbuf_stripspace in https://github.com/git/git/blob/master/strbuf.c
+func cleanupMessage(msg string, stripComments bool) string {
+	var b strings.Builder
+	blank := 0
+	for _, line := range strings.SplitAfter(msg, "\n") {
+		if line == "" {
+			continue
+		}
+		if stripComments && strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\n\r\v\f")
+		if line == "" {
+			blank++
+			continue
+		}
+		if blank > 0 && b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		blank = 0
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// sequenceEditor is the command that edits the todo list of an
+// interactive rebase: GIT_SEQUENCE_EDITOR, sequence.editor, or the
+// editor of messages.
+// ref: git_sequence_editor in https://github.com/git/git/blob/master/editor.c
+func sequenceEditor(repo *repository.Repository) string {
+	if value := os.Getenv("GIT_SEQUENCE_EDITOR"); value != "" {
+		return value
+	}
+	if cfg, err := repo.Config(); err == nil {
+		if value, ok := cfg.Get("sequence.editor"); ok && value != "" {
+			return value
+		}
+	}
+	return editor(repo)
+}
@@ -0,0 +1,652 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/wildmatch"
+)
+
+const defaultRefFormat = "%(objectname) %(objecttype)\t%(refname)"
+
+// formatItem is a literal or a %(atom) of a --format string.
+type formatItem struct {
+	literal string
+	atom    string
+	arg     string // the part after ':'
+	deref   bool   // %(*atom) looks at the object a tag points to
+}
+
+// refItem is a ref with its objects loaded on demand.
+type refItem struct {
+	repo   *repository.Repository
+	ref    *refs.Ref
+	sha    string
+	head   string // the branch HEAD points to
+	object *objectInfo
+	peeled *objectInfo
+}
+
+// ForEachRef implements "for-each-ref".
+// ref: https://git-scm.com/docs/git-for-each-ref
+func ForEachRef(args []string) int {
+	format := defaultRefFormat
+	sortKeys := []string{}
+	count := -1
+	quote := ""
+	pointsAt := ""
+	patterns := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, bool) {
+			if j := strings.IndexByte(arg, '='); j >= 0 {
+				return arg[j+1:], true
+			}
+			if i+1 < len(args) {
+				i++
+				return args[i], true
+			}
+			return "", false
+		}
+		name := arg
+		if j := strings.IndexByte(arg, '='); j >= 0 && strings.HasPrefix(arg, "--") {
+			name = arg[:j]
+		}
+		switch {
+		case name == "--format":
+			v, ok := value()
+			if !ok {
+				return usage("option `format' requires a value")
+			}
+			format = v
+		case name == "--sort":
+			v, ok := value()
+			if !ok {
+				return usage("option `sort' requires a value")
+			}
+			sortKeys = append(sortKeys, v)
+		case name == "--count":
+			v, ok := value()
+			n, err := strconv.Atoi(v)
+			if !ok || err != nil || n < 0 {
+				return usage("option `count' expects a non-negative integer")
+			}
+			count = n
+		case name == "--points-at":
+			v, ok := value()
+			if !ok {
+				return usage("option `points-at' requires a value")
+			}
+			pointsAt = v
+		case arg == "-s" || arg == "--shell":
+			quote = "shell"
+		case arg == "-p" || arg == "--perl":
+			quote = "perl"
+		case arg == "--python":
+			quote = "python"
+		case arg == "--tcl":
+			quote = "tcl"
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+	items, err := parseRefFormat(format)
+	if err != nil {
+		return die("%v", err)
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	if pointsAt != "" {
+		sha, err := resolveRevision(repo, pointsAt)
+		if err != nil {
+			return die("malformed object name %s", pointsAt)
+		}
+		pointsAt = sha
+	}
+
+	all, err := repo.Refs().List("refs/")
+	if err != nil {
+		return die("%v", err)
+	}
+	head := ""
+	if ref, err := repo.Refs().Read(refs.HEAD); err == nil && ref.IsSymbolic() {
+		head = ref.Symref
+	}
+	list := []*refItem{}
+	for _, ref := range all {
+		if len(patterns) > 0 && !matchesRefPattern(ref.Name, patterns) {
+			continue
+		}
+		resolved, err := repo.Refs().Resolve(ref.Name)
+		if err != nil {
+			continue
+		}
+		item := &refItem{repo: repo, ref: ref, sha: resolved.Target, head: head}
+		// Like git, only one level of tag is peeled.
+		if pointsAt != "" && item.sha != pointsAt {
+			info, err := readObjectInfo(repo.Objects(), item.sha)
+			if err != nil || info.typ != "tag" || info.header("object") != pointsAt {
+				continue
+			}
+		}
+		list = append(list, item)
+	}
+	if len(sortKeys) == 0 {
+		sortKeys = []string{"refname"}
+	}
+	// Stable sorts from the first key to the last make the last --sort
+	// key the primary one.
+	for _, key := range sortKeys {
+		if err := sortRefItems(list, key); err != nil {
+			return die("%v", err)
+		}
+	}
+	if count >= 0 && count < len(list) {
+		list = list[:count]
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, item := range list {
+		line := ""
+		for _, fi := range items {
+			if fi.atom == "" {
+				line += fi.literal
+				continue
+			}
+			value, err := item.atom(fi)
+			if err != nil {
+				return die("%v", err)
+			}
+			line += quoteFormatValue(value, quote)
+		}
+		fmt.Fprintln(out, line)
+	}
+	return 0
+}
+
+// matchesRefPattern accepts a prefix ending at a "/" boundary or a glob.
+func matchesRefPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			if wildmatch.Match(pattern, name, wildmatch.Pathname) {
+				return true
+			}
+			continue
+		}
+		if name == pattern || strings.HasPrefix(name, strings.TrimSuffix(pattern, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRefFormat(format string) ([]formatItem, error) {
+	items := []formatItem{}
+	literal := ""
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 >= len(format) {
+			literal += string(c)
+			continue
+		}
+		switch next := format[i+1]; {
+		case next == '%':
+			literal += "%"
+			i++
+		case next == '(':
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 {
+				return nil, fmt.Errorf("malformed format string %s", format[i:])
+			}
+			if literal != "" {
+				items = append(items, formatItem{literal: literal})
+				literal = ""
+			}
+			atom := format[i+2 : i+end]
+			item := formatItem{}
+			if strings.HasPrefix(atom, "*") {
+				item.deref = true
+				atom = atom[1:]
+			}
+			if j := strings.IndexByte(atom, ':'); j >= 0 {
+				atom, item.arg = atom[:j], atom[j+1:]
+			}
+			if atom == "" {
+				return nil, fmt.Errorf("malformed field name: %s", format[i:i+end+1])
+			}
+			if !knownRefAtom(atom) {
+				return nil, fmt.Errorf("unknown field name: %s", atom)
+			}
+			item.atom = atom
+			items = append(items, item)
+			i += end
+		case isHexDigit(next) && i+2 < len(format) && isHexDigit(format[i+2]):
+			b, _ := strconv.ParseUint(format[i+1:i+3], 16, 8)
+			literal += string([]byte{byte(b)})
+			i += 2
+		default:
+			literal += "%"
+		}
+	}
+	if literal != "" {
+		items = append(items, formatItem{literal: literal})
+	}
+	return items, nil
+}
+
+func knownRefAtom(atom string) bool {
+	switch atom {
+	case "refname", "symref", "HEAD", "upstream", "push",
+		"objectname", "objecttype", "objectsize", "tree", "object", "type", "tag",
+		"parent", "numparent", "subject", "body", "contents":
+		return true
+	}
+	for _, who := range []string{"author", "committer", "tagger", "creator"} {
+		switch strings.TrimPrefix(atom, who) {
+		case "", "name", "email", "date":
+			if strings.HasPrefix(atom, who) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func quoteFormatValue(value, quote string) string {
+	switch quote {
+	case "shell":
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+	case "perl":
+		return "'" + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), "'", `\'`) + "'"
+	case "python":
+		return "'" + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), "'", `\'`) + "'"
+	case "tcl":
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func (r *refItem) load(deref bool) (*objectInfo, error) {
+	if r.object == nil {
+		info, err := readObjectInfo(r.repo.Objects(), r.sha)
+		if err != nil {
+			return nil, err
+		}
+		r.object = info
+	}
+	if !deref {
+		return r.object, nil
+	}
+	if r.object.typ != "tag" {
+		return nil, nil
+	}
+	if r.peeled == nil {
+		info, err := readObjectInfo(r.repo.Objects(), r.object.header("object"))
+		if err != nil {
+			return nil, err
+		}
+		r.peeled = info
+	}
+	return r.peeled, nil
+}
+
+func (r *refItem) atom(fi formatItem) (string, error) {
+	switch fi.atom {
+	case "refname":
+		return formatRefName(r.repo, r.ref.Name, fi.arg)
+	case "symref":
+		if !r.ref.IsSymbolic() {
+			return "", nil
+		}
+		return formatRefName(r.repo, r.ref.Symref, fi.arg)
+	case "HEAD":
+		if r.ref.Name == r.head {
+			return "*", nil
+		}
+		return " ", nil
+	case "upstream", "push":
+		return r.upstream(fi)
+	}
+
+	info, err := r.load(fi.deref)
+	if err != nil || info == nil {
+		return "", err
+	}
+	switch fi.atom {
+	case "objectname":
+		return formatObjectName(info.sha, fi.arg)
+	case "objecttype":
+		return info.typ, nil
+	case "objectsize":
+		return strconv.Itoa(info.size), nil
+	case "tree", "object", "type", "tag":
+		return info.header(fi.atom), nil
+	case "parent", "numparent":
+		if info.typ != "commit" {
+			return "", nil
+		}
+		if fi.atom == "parent" {
+			return strings.Join(info.headerAll("parent"), " "), nil
+		}
+		return strconv.Itoa(len(info.headerAll("parent"))), nil
+	case "subject", "body", "contents":
+		return formatContents(info, fi)
+	}
+	for _, who := range []string{"author", "committer", "tagger", "creator"} {
+		if !strings.HasPrefix(fi.atom, who) {
+			continue
+		}
+		ident := ""
+		if who == "creator" {
+			ident = info.header("committer")
+			if info.typ == "tag" {
+				ident = info.header("tagger")
+			}
+		} else {
+			ident = info.header(who)
+		}
+		return formatIdent(ident, strings.TrimPrefix(fi.atom, who), fi.arg)
+	}
+	return "", fmt.Errorf("unknown field name: %s", fi.atom)
+}
+
+// formatRefName applies :short, :lstrip=N/:strip=N and :rstrip=N.
+func formatRefName(repo *repository.Repository, name, arg string) (string, error) {
+	switch {
+	case arg == "":
+		return name, nil
+	case arg == "short":
+		return refs.Shorten(name, repo.Refs().Exists), nil
+	case strings.HasPrefix(arg, "lstrip=") || strings.HasPrefix(arg, "strip="):
+		n, err := strconv.Atoi(arg[strings.IndexByte(arg, '=')+1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid argument: %s", arg)
+		}
+		parts := strings.Split(name, "/")
+		if n < 0 {
+			n = len(parts) + n
+			if n < 0 {
+				n = 0
+			}
+		}
+		if n >= len(parts) {
+			return "", nil
+		}
+		return strings.Join(parts[n:], "/"), nil
+	case strings.HasPrefix(arg, "rstrip="):
+		n, err := strconv.Atoi(strings.TrimPrefix(arg, "rstrip="))
+		if err != nil {
+			return "", fmt.Errorf("invalid argument: %s", arg)
+		}
+		parts := strings.Split(name, "/")
+		if n < 0 {
+			n = len(parts) + n
+			if n < 0 {
+				n = 0
+			}
+		}
+		if n >= len(parts) {
+			return "", nil
+		}
+		return strings.Join(parts[:len(parts)-n], "/"), nil
+	}
+	return "", fmt.Errorf("unrecognized %%(refname) argument: %s", arg)
+}
+
+func formatObjectName(sha, arg string) (string, error) {
+	switch {
+	case arg == "":
+		return sha, nil
+	case arg == "short":
+		return sha[:7], nil
+	case strings.HasPrefix(arg, "short="):
+		n, err := strconv.Atoi(strings.TrimPrefix(arg, "short="))
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("positive value expected '%s' in %%(objectname)", arg)
+		}
+		if n < 4 {
+			n = 4
+		}
+		if n > len(sha) {
+			n = len(sha)
+		}
+		return sha[:n], nil
+	}
+	return "", fmt.Errorf("unrecognized %%(objectname) argument: %s", arg)
+}
+
+func formatContents(info *objectInfo, fi formatItem) (string, error) {
+	subject, body := splitSubjectBody(info.message)
+	switch {
+	case fi.atom == "subject" || fi.arg == "subject":
+		return subject, nil
+	case fi.atom == "body" || fi.arg == "body":
+		return body, nil
+	case fi.atom == "contents" && fi.arg == "":
+		return info.message, nil
+	}
+	return "", fmt.Errorf("unrecognized %%(%s) argument: %s", fi.atom, fi.arg)
+}
+
+// formatIdent renders %(author), %(authorname), %(authoremail) and
+// %(authordate) from an "author" header and the same for the others.
+func formatIdent(ident, part, arg string) (string, error) {
+	if ident == "" {
+		return "", nil
+	}
+	name, email, when := splitIdent(ident)
+	switch part {
+	case "":
+		return ident, nil
+	case "name":
+		return name, nil
+	case "email":
+		switch arg {
+		case "trim":
+			return strings.Trim(email, "<>"), nil
+		case "localpart":
+			local := strings.Trim(email, "<>")
+			if i := strings.IndexByte(local, '@'); i >= 0 {
+				local = local[:i]
+			}
+			return local, nil
+		}
+		return email, nil
+	case "date":
+		t, err := date.ParseRaw(when)
+		if err != nil {
+			return "", nil
+		}
+		return date.Format(t, arg)
+	}
+	return "", fmt.Errorf("unknown field name: %s", part)
+}
+
+// splitIdent splits "Name <email> 1234567890 +0900".
+func splitIdent(ident string) (string, string, string) {
+	lt := strings.IndexByte(ident, '<')
+	gt := strings.LastIndexByte(ident, '>')
+	if lt < 0 || gt < lt {
+		return ident, "", ""
+	}
+	return strings.TrimSpace(ident[:lt]), ident[lt : gt+1], strings.TrimSpace(ident[gt+1:])
+}
+
+// upstream finds the remote-tracking ref of branch.<name>.merge, or of
+// the push destination.
+func (r *refItem) upstream(fi formatItem) (string, error) {
+	if !strings.HasPrefix(r.ref.Name, "refs/heads/") {
+		return "", nil
+	}
+	cfg, err := r.repo.Config()
+	if err != nil {
+		return "", err
+	}
+	branch := strings.TrimPrefix(r.ref.Name, "refs/heads/")
+	remote, _ := cfg.Get("branch." + branch + ".remote")
+	if fi.atom == "push" {
+		if pushRemote, ok := cfg.Get("branch." + branch + ".pushRemote"); ok {
+			remote = pushRemote
+		}
+	}
+	merge, ok := cfg.Get("branch." + branch + ".merge")
+	if remote == "" || !ok {
+		return "", nil
+	}
+	if fi.arg == "remotename" {
+		return remote, nil
+	}
+	if fi.arg == "remoteref" {
+		return merge, nil
+	}
+	name, err := trackingRef(r.repo, branch, fi.atom == "push")
+	if err != nil {
+		return "", nil
+	}
+	switch fi.arg {
+	case "track", "track,nobracket", "trackshort":
+		return r.track(name, fi.arg)
+	}
+	return formatRefName(r.repo, name, fi.arg)
+}
+
+// track compares the ref with its upstream: "[ahead N, behind M]" or
+// "[gone]" for :track, "<", ">", "<>" or "=" for :trackshort.
+// ref: https://git-scm.com/docs/git-for-each-ref#Documentation/git-for-each-ref.txt-upstream
+func (r *refItem) track(upstream, arg string) (string, error) {
+	theirs, err := r.repo.Refs().Resolve(upstream)
+	if err != nil {
+		if arg == "trackshort" {
+			return "", nil
+		}
+		if arg == "track,nobracket" {
+			return "gone", nil
+		}
+		return "[gone]", nil
+	}
+	ahead, behind, err := aheadBehind(r.repo, r.sha, theirs.Target)
+	if err != nil {
+		return "", err
+	}
+	if arg == "trackshort" {
+		switch {
+		case ahead > 0 && behind > 0:
+			return "<>", nil
+		case ahead > 0:
+			return ">", nil
+		case behind > 0:
+			return "<", nil
+		}
+		return "=", nil
+	}
+	parts := []string{}
+	if ahead > 0 {
+		parts = append(parts, fmt.Sprintf("ahead %d", ahead))
+	}
+	if behind > 0 {
+		parts = append(parts, fmt.Sprintf("behind %d", behind))
+	}
+	if len(parts) == 0 {
+		return "", nil
+	}
+	if arg == "track,nobracket" {
+		return strings.Join(parts, ", "), nil
+	}
+	return "[" + strings.Join(parts, ", ") + "]", nil
+}
+
+// sortRefItems stably sorts by one --sort key, "-" reverses it.
+func sortRefItems(list []*refItem, key string) error {
+	reverse := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+	version := false
+	if strings.HasPrefix(key, "version:") || strings.HasPrefix(key, "v:") {
+		version = true
+		key = key[strings.IndexByte(key, ':')+1:]
+	}
+	fi := formatItem{atom: key}
+	if strings.HasPrefix(key, "*") {
+		fi.deref, fi.atom = true, key[1:]
+	}
+	if j := strings.IndexByte(fi.atom, ':'); j >= 0 {
+		fi.atom, fi.arg = fi.atom[:j], fi.atom[j+1:]
+	}
+	numeric := strings.HasSuffix(fi.atom, "date") || fi.atom == "objectsize" || fi.atom == "numparent"
+	if strings.HasSuffix(fi.atom, "date") {
+		fi.arg = "unix"
+	}
+	values := make(map[*refItem]string, len(list))
+	for _, item := range list {
+		value, err := item.atom(fi)
+		if err != nil {
+			return err
+		}
+		values[item] = value
+	}
+	less := func(a, b string) bool {
+		switch {
+		case numeric:
+			x, _ := strconv.ParseInt(a, 10, 64)
+			y, _ := strconv.ParseInt(b, 10, 64)
+			return x < y
+		case version:
+			return versionLess(a, b)
+		}
+		return a < b
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := values[list[i]], values[list[j]]
+		if reverse {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+	return nil
+}
+
+// versionLess compares embedded numbers numerically, so v1.10 > v1.9.
+func versionLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := 0, 0
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			x, _ := strconv.ParseUint(a[:i], 10, 64)
+			y, _ := strconv.ParseUint(b[:j], 10, 64)
+			if x != y {
+				return x < y
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// signatureCheck is the verification of the signature of a commit, for
+// the %G placeholders, like git's struct signature_check.
+// ref: https://git-scm.com/docs/pretty-formats#Documentation/pretty-formats.txt-emG
+type signatureCheck struct {
+	// result is 'G' for a good signature, 'B' for a bad one, 'U' for a
+	// good one of unknown validity, 'X' for an expired signature, 'Y'
+	// for an expired key, 'R' for a revoked key, 'E' when it can't be
+	// checked and 'N' without a signature.
+	result      byte
+	output      string // what the program said about it
+	signer      string
+	key         string
+	fingerprint string
+	primaryKey  string // fingerprint of the primary key
+	trust       string // "" when unknown
+}
+
+// gpgStatus are the status lines of "gpg --status-fd" that git reads.
+var gpgStatus = []struct {
+	result    byte
+	prefix    string
+	exclusive bool // only one of these may come per signature
+	keyID     bool
+	uid       bool
+}{
+	{'G', "GOODSIG ", true, true, true},
+	{'B', "BADSIG ", true, true, true},
+	{'E', "ERRSIG ", true, true, false},
+	{'X', "EXPSIG ", true, true, true},
+	{'Y', "EXPKEYSIG ", true, true, true},
+	{'R', "REVKEYSIG ", true, true, true},
+	{0, "VALIDSIG ", false, false, false},
+	{0, "TRUST_", false, false, false},
+}
+
+// checkCommitSignature verifies the signature of a commit with the
+// program of gpg.format, like git's check_commit_signature.
+func checkCommitSignature(repo *repository.Repository, raw []byte) *signatureCheck {
+	sigc := &signatureCheck{result: 'N', trust: "undefined"}
+	key := "gpgsig"
+	if repo.Format == hash.SHA256 {
+		key = "gpgsig-sha256"
+	}
+	payload, signature := signedPayload(string(raw), key)
+	if signature == "" {
+		return sigc
+	}
+	sigc.trust = ""
+	format := ""
+	switch {
+	case strings.HasPrefix(signature, "-----BEGIN PGP SIGNATURE-----"), strings.HasPrefix(signature, "-----BEGIN PGP MESSAGE-----"):
+		format = "openpgp"
+	case strings.HasPrefix(signature, "-----BEGIN SIGNED MESSAGE-----"):
+		format = "x509"
+	case strings.HasPrefix(signature, "-----BEGIN SSH SIGNATURE-----"):
+		format = "ssh"
+	default:
+		sigc.result = 'E'
+		return sigc
+	}
+	cfg, _ := repo.Config()
+	program := map[string]string{"openpgp": "gpg", "x509": "gpgsm", "ssh": "ssh-keygen"}[format]
+	if cfg != nil {
+		if value, ok := cfg.Get("gpg.program"); ok && format == "openpgp" {
+			program = value
+		}
+		if value, ok := cfg.Get("gpg." + format + ".program"); ok {
+			program = value
+		}
+	}
+	sigFile, err := ioutil.TempFile("", ".git_vtag_tmp")
+	if err != nil {
+		sigc.result = 'E'
+		return sigc
+	}
+	defer os.Remove(sigFile.Name())
+	_, err = sigFile.WriteString(signature)
+	if closeErr := sigFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		sigc.result = 'E'
+		return sigc
+	}
+	if format == "ssh" {
+		verifySSHSignature(sigc, program, sigFile.Name(), payload, cfg)
+		return sigc
+	}
+	args := []string{"--status-fd=1", "--verify", sigFile.Name(), "-"}
+	if format == "openpgp" {
+		args = append([]string{"--keyid-format=long"}, args...)
+	}
+	status, output, _ := runVerifier(program, args, payload)
+	sigc.output = output
+	parseGPGStatus(sigc, status)
+	return sigc
+}
+
+// signedPayload splits the signature header off the headers of a raw
+// commit, leaving what was signed.
+func signedPayload(raw, key string) (string, string) {
+	var payload, signature strings.Builder
+	inSignature, inHeaders := false, true
+	for raw != "" {
+		line := raw
+		if i := strings.IndexByte(raw, '\n'); i >= 0 {
+			line, raw = raw[:i+1], raw[i+1:]
+		} else {
+			raw = ""
+		}
+		switch {
+		case !inHeaders:
+			payload.WriteString(line)
+		case inSignature && strings.HasPrefix(line, " "):
+			signature.WriteString(line[1:])
+		case strings.HasPrefix(line, key+" "):
+			signature.WriteString(line[len(key)+1:])
+			inSignature = true
+		default:
+			inSignature = false
+			inHeaders = line != "\n"
+			payload.WriteString(line)
+		}
+	}
+	return payload.String(), signature.String()
+}
+
+// runVerifier runs a signature program with the payload on its standard
+// input and returns its standard output and error.
+func runVerifier(program string, args []string, payload string) (string, string, error) {
+	cmd := exec.Command(program, args...)
+	cmd.Stdin = strings.NewReader(payload)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// parseGPGStatus reads the "[GNUPG:] " status lines of gpg or gpgsm,
+// like git's parse_gpg_output. More than one signature is an error.
+func parseGPGStatus(sigc *signatureCheck, status string) {
+	seenExclusive := false
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, "[GNUPG:] ") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "[GNUPG:] ")
+		for _, s := range gpgStatus {
+			if !strings.HasPrefix(line, s.prefix) {
+				continue
+			}
+			line = strings.TrimPrefix(line, s.prefix)
+			if s.exclusive {
+				if seenExclusive {
+					*sigc = signatureCheck{result: 'E', output: sigc.output, trust: sigc.trust}
+					return
+				}
+				seenExclusive = true
+			}
+			if s.result != 0 {
+				sigc.result = s.result
+			}
+			fields := strings.Fields(line)
+			if s.keyID && len(fields) > 0 {
+				sigc.key = fields[0]
+				if s.uid {
+					sigc.signer = strings.TrimPrefix(line, fields[0]+" ")
+				}
+			}
+			switch s.prefix {
+			case "TRUST_":
+				sigc.trust = strings.ToLower(strings.SplitN(line, " ", 2)[0])
+			case "VALIDSIG ":
+				if len(fields) > 0 {
+					sigc.fingerprint = fields[0]
+					sigc.primaryKey = fields[0]
+					// Only OpenPGP gives the primary key, in the tenth field.
+					if len(fields) > 9 {
+						sigc.primaryKey = fields[9]
+					}
+				}
+			}
+			break
+		}
+	}
+}
+
+// verifySSHSignature checks an ssh signature against
+// gpg.ssh.allowedSignersFile, like git's verify_ssh_signed_buffer.
+func verifySSHSignature(sigc *signatureCheck, program, sigFile, payload string, cfg interface {
+	Get(string) (string, bool)
+}) {
+	allowed := ""
+	if cfg != nil {
+		allowed, _ = cfg.Get("gpg.ssh.allowedSignersFile")
+	}
+	if _, err := os.Stat(allowed); allowed == "" || err != nil {
+		fmt.Fprintln(os.Stderr, "error: gpg.ssh.allowedSignersFile needs to be configured and exist for ssh signature verification")
+		return
+	}
+	principals, output, err := runVerifier(program, []string{"-Y", "find-principals", "-f", allowed, "-s", sigFile}, "")
+	if err != nil || strings.TrimSpace(principals) == "" {
+		out, errOut, err := runVerifier(program, []string{"-Y", "check-novalidate", "-n", "git", "-s", sigFile}, payload)
+		sigc.output = out + errOut
+		sigc.result = 'B'
+		if err == nil {
+			sigc.result = 'G'
+			sigc.trust = "undefined"
+			parseSSHOutput(sigc)
+		}
+		return
+	}
+	sigc.result = 'B'
+	for _, principal := range strings.Split(strings.TrimSpace(principals), "\n") {
+		out, errOut, err := runVerifier(program, []string{"-Y", "verify", "-n", "git", "-f", allowed, "-I", principal, "-s", sigFile}, payload)
+		sigc.output = out + errOut
+		if err == nil {
+			sigc.result = 'G'
+			sigc.trust = "fully"
+			parseSSHOutput(sigc)
+			return
+		}
+	}
+	if sigc.output == "" {
+		sigc.output = output
+	}
+}
+
+// parseSSHOutput reads the signer and key of a good ssh signature from
+// `Good "git" signature [for <principal>] with <type> key <fingerprint>`.
+func parseSSHOutput(sigc *signatureCheck) {
+	line := strings.SplitN(sigc.output, "\n", 2)[0]
+	rest := strings.TrimPrefix(line, `Good "git" signature `)
+	if rest == line {
+		return
+	}
+	if strings.HasPrefix(rest, "for ") {
+		if i := strings.Index(rest, " with "); i >= 0 {
+			sigc.signer = rest[len("for "):i]
+			rest = rest[i+1:]
+		}
+	}
+	if i := strings.Index(rest, " key "); i >= 0 {
+		sigc.key = rest[i+len(" key "):]
+		sigc.fingerprint = sigc.key
+		sigc.primaryKey = sigc.key
+	}
+}
@@ -0,0 +1,642 @@
+package cmd
+
+import (
+	"bufio"
+	"strings"
+)
+
+// graphState is the kind of line the graph prints next.
+type graphState int
+
+const (
+	graphPadding graphState = iota
+	graphSkip
+	graphPreCommit
+	graphCommit
+	graphPostMerge
+	graphCollapsing
+)
+
+// commitGraph draws the ASCII history graph of "log --graph" next to the
+// commits, one line at a time. It follows git's graph.c so that the
+// drawings match; a nil graph draws nothing.
+// ref: https://github.com/git/git/blob/master/graph.c
+type commitGraph struct {
+	w   *revWalk
+	out *bufio.Writer
+
+	commit  *commitNode
+	parents []string // interesting parents of commit
+	width   int      // width of the lines of this commit
+	// expansionRow counts the lines printed to make room for an octopus.
+	expansionRow    int
+	state           graphState
+	prevState       graphState
+	commitIndex     int
+	prevCommitIndex int
+	// mergeLayout is 0 when the first parent of a merge is to its left,
+	// 1 otherwise, and -1 before it is known.
+	mergeLayout    int
+	edgesAdded     int
+	prevEdgesAdded int
+
+	columns    []string // commits whose lines cross the current row
+	newColumns []string // the same after this commit
+	// mapping gives for each screen column of the row the index in
+	// newColumns its line goes to, or -1.
+	mapping     []int
+	oldMapping  []int
+	mappingSize int
+}
+
+func newCommitGraph(w *revWalk, out *bufio.Writer) *commitGraph {
+	return &commitGraph{w: w, out: out}
+}
+
+// graphLine is a line of the graph being built.
+type graphLine struct {
+	strings.Builder
+	width int
+}
+
+func (l *graphLine) add(s string) {
+	l.WriteString(s)
+	l.width += len(s)
+}
+
+func (l *graphLine) addChars(c byte, n int) {
+	l.add(strings.Repeat(string(c), n))
+}
+
+func (l *graphLine) writeColumn(c byte) {
+	l.add(string(c))
+}
+
+func (g *commitGraph) updateState(s graphState) {
+	g.prevState = g.state
+	g.state = s
+}
+
+// interesting reports whether a parent is shown by the walk.
+func (g *commitGraph) interesting(sha string) bool {
+	n, err := g.w.load(sha)
+	if err != nil {
+		return false
+	}
+	return g.w.wanted(n)
+}
+
+func (g *commitGraph) interestingParents(n *commitNode) []string {
+	parents := []string{}
+	for i, p := range n.parents {
+		if g.w.firstParent && i > 0 {
+			break
+		}
+		if g.interesting(p) {
+			parents = append(parents, p)
+		}
+	}
+	return parents
+}
+
+func (g *commitGraph) numDashedParents() int {
+	return len(g.parents) + g.mergeLayout - 3
+}
+
+func (g *commitGraph) numExpansionRows() int {
+	return g.numDashedParents() * 2
+}
+
+func (g *commitGraph) needsPreCommitLine() bool {
+	return len(g.parents) >= 3 &&
+		g.commitIndex < len(g.columns)-1 &&
+		g.expansionRow < g.numExpansionRows()
+}
+
+func (g *commitGraph) findNewColumn(sha string) int {
+	for i, c := range g.newColumns {
+		if c == sha {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *commitGraph) insertIntoNewColumns(sha string, idx int) {
+	i := g.findNewColumn(sha)
+	if i < 0 {
+		i = len(g.newColumns)
+		g.newColumns = append(g.newColumns, sha)
+	}
+	mappingIdx := 0
+	switch {
+	case len(g.parents) > 1 && idx > -1 && g.mergeLayout == -1:
+		// The first parent of a merge picks the layout of the merge
+		// line by whether it is to the left of the merge.
+		dist := idx - i
+		shift := 1
+		if dist > 1 {
+			shift = 2*dist - 3
+		}
+		if dist > 0 {
+			g.mergeLayout = 0
+		} else {
+			g.mergeLayout = 1
+		}
+		g.edgesAdded = len(g.parents) + g.mergeLayout - 2
+		mappingIdx = g.width + (g.mergeLayout-1)*shift
+		g.width += 2 * g.mergeLayout
+	case g.edgesAdded > 0 && i == g.mapping[g.width-2]:
+		// A merge added columns but this commit is in the last
+		// existing one: join the two edges right away.
+		mappingIdx = g.width - 2
+		g.edgesAdded = -1
+	default:
+		mappingIdx = g.width
+		g.width += 2
+	}
+	g.mapping[mappingIdx] = i
+}
+
+func (g *commitGraph) ensureMapping(size int) {
+	if len(g.mapping) >= size {
+		return
+	}
+	grow := func(m []int) []int {
+		bigger := make([]int, size)
+		for i := range bigger {
+			bigger[i] = -1
+		}
+		copy(bigger, m)
+		return bigger
+	}
+	g.mapping = grow(g.mapping)
+	g.oldMapping = grow(g.oldMapping)
+}
+
+func (g *commitGraph) updateColumns() {
+	g.columns, g.newColumns = g.newColumns, g.columns[:0]
+
+	maxNewColumns := len(g.columns) + len(g.parents)
+	// Like git, room for at least 30 columns.
+	g.ensureMapping(2 * maxInt(maxNewColumns, 30))
+	g.mappingSize = 2 * maxNewColumns
+	for i := 0; i < g.mappingSize; i++ {
+		g.mapping[i] = -1
+	}
+	g.width = 0
+	g.prevEdgesAdded = g.edgesAdded
+	g.edgesAdded = 0
+
+	seenThis := false
+	for i := 0; i <= len(g.columns); i++ {
+		colCommit := ""
+		if i == len(g.columns) {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit.sha
+		} else {
+			colCommit = g.columns[i]
+		}
+		if colCommit == g.commit.sha {
+			seenThis = true
+			g.commitIndex = i
+			g.mergeLayout = -1
+			for _, p := range g.parents {
+				g.insertIntoNewColumns(p, i)
+			}
+			// The commit takes up two columns even without parents.
+			if len(g.parents) == 0 {
+				g.width += 2
+			}
+		} else {
+			g.insertIntoNewColumns(colCommit, -1)
+		}
+	}
+	for g.mappingSize > 1 && g.mapping[g.mappingSize-1] < 0 {
+		g.mappingSize--
+	}
+}
+
+// update moves the graph to the next commit shown.
+func (g *commitGraph) update(n *commitNode) {
+	if g == nil {
+		return
+	}
+	g.commit = n
+	g.parents = g.interestingParents(n)
+	g.prevCommitIndex = g.commitIndex
+	g.updateColumns()
+	g.expansionRow = 0
+	switch {
+	case g.state != graphPadding:
+		g.state = graphSkip
+	case g.needsPreCommitLine():
+		g.state = graphPreCommit
+	default:
+		g.state = graphCommit
+	}
+}
+
+func (g *commitGraph) mappingCorrect() bool {
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.mapping[i]
+		if target >= 0 && target != i/2 {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *commitGraph) padHorizontally(line *graphLine) {
+	if line.width < g.width {
+		line.addChars(' ', g.width-line.width)
+	}
+}
+
+func (g *commitGraph) outputPaddingLine(line *graphLine) {
+	for range g.newColumns {
+		line.writeColumn('|')
+		line.add(" ")
+	}
+}
+
+func (g *commitGraph) outputSkipLine(line *graphLine) {
+	line.add("...")
+	if g.needsPreCommitLine() {
+		g.updateState(graphPreCommit)
+	} else {
+		g.updateState(graphCommit)
+	}
+}
+
+func (g *commitGraph) outputPreCommitLine(line *graphLine) {
+	seenThis := false
+	for i, col := range g.columns {
+		switch {
+		case col == g.commit.sha:
+			seenThis = true
+			line.writeColumn('|')
+			line.addChars(' ', g.expansionRow)
+		case seenThis && g.expansionRow == 0:
+			if g.prevState == graphPostMerge && g.prevCommitIndex < i {
+				line.writeColumn('\\')
+			} else {
+				line.writeColumn('|')
+			}
+		case seenThis && g.expansionRow > 0:
+			line.writeColumn('\\')
+		default:
+			line.writeColumn('|')
+		}
+		line.add(" ")
+	}
+	g.expansionRow++
+	if !g.needsPreCommitLine() {
+		g.updateState(graphCommit)
+	}
+}
+
+// drawOctopusMerge draws the dashes of a merge with more than two
+// parents.
+func (g *commitGraph) drawOctopusMerge(line *graphLine) {
+	dashed := g.numDashedParents()
+	for i := 0; i < dashed; i++ {
+		line.writeColumn('-')
+		if i == dashed-1 {
+			line.writeColumn('.')
+		} else {
+			line.writeColumn('-')
+		}
+	}
+}
+
+func (g *commitGraph) outputCommitLine(line *graphLine) {
+	seenThis := false
+	for i := 0; i <= len(g.columns); i++ {
+		colCommit := ""
+		if i == len(g.columns) {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit.sha
+		} else {
+			colCommit = g.columns[i]
+		}
+		switch {
+		case colCommit == g.commit.sha:
+			seenThis = true
+			line.add("*")
+			if len(g.parents) > 2 {
+				g.drawOctopusMerge(line)
+			}
+		case seenThis && g.edgesAdded > 1:
+			line.writeColumn('\\')
+		case seenThis && g.edgesAdded == 1:
+			// A branch line that came in as "\" after a merge stays
+			// one.
+			if g.prevState == graphPostMerge && g.prevEdgesAdded > 0 && g.prevCommitIndex < i {
+				line.writeColumn('\\')
+			} else {
+				line.writeColumn('|')
+			}
+		case g.prevState == graphCollapsing && g.oldMapping[2*i+1] == i && g.mapping[2*i] < i:
+			line.writeColumn('/')
+		default:
+			line.writeColumn('|')
+		}
+		line.add(" ")
+	}
+	switch {
+	case len(g.parents) > 1:
+		g.updateState(graphPostMerge)
+	case g.mappingCorrect():
+		g.updateState(graphPadding)
+	default:
+		g.updateState(graphCollapsing)
+	}
+}
+
+var graphMergeChars = []byte{'/', '|', '\\'}
+
+func (g *commitGraph) outputPostMergeLine(line *graphLine) {
+	seenThis := false
+	firstParent := g.parents[0]
+	parentSeen := false
+	for i := 0; i <= len(g.columns); i++ {
+		colCommit := ""
+		if i == len(g.columns) {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit.sha
+		} else {
+			colCommit = g.columns[i]
+		}
+		switch {
+		case colCommit == g.commit.sha:
+			seenThis = true
+			idx := g.mergeLayout
+			for j := range g.parents {
+				line.writeColumn(graphMergeChars[idx])
+				if idx == 2 {
+					if g.edgesAdded > 0 || j < len(g.parents)-1 {
+						line.add(" ")
+					}
+				} else {
+					idx++
+				}
+			}
+			if g.edgesAdded == 0 {
+				line.add(" ")
+			}
+		case seenThis:
+			if g.edgesAdded > 0 {
+				line.writeColumn('\\')
+			} else {
+				line.writeColumn('|')
+			}
+			line.add(" ")
+		default:
+			line.writeColumn('|')
+			if g.mergeLayout != 0 || i != g.commitIndex-1 {
+				if parentSeen {
+					line.writeColumn('_')
+				} else {
+					line.add(" ")
+				}
+			}
+		}
+		if colCommit == firstParent {
+			parentSeen = true
+		}
+	}
+	if g.mappingCorrect() {
+		g.updateState(graphPadding)
+	} else {
+		g.updateState(graphCollapsing)
+	}
+}
+
+func (g *commitGraph) outputCollapsingLine(line *graphLine) {
+	usedHorizontal := false
+	horizontalEdge, horizontalEdgeTarget := -1, -1
+
+	g.mapping, g.oldMapping = g.oldMapping, g.mapping
+	for i := 0; i < g.mappingSize; i++ {
+		g.mapping[i] = -1
+	}
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.oldMapping[i]
+		if target < 0 {
+			continue
+		}
+		// Lines only ever move to the left.
+		switch {
+		case target*2 == i:
+			g.mapping[i] = target
+		case g.mapping[i-1] < 0:
+			// Nothing to the left: move left by one.
+			g.mapping[i-1] = target
+			if horizontalEdge == -1 {
+				horizontalEdge, horizontalEdgeTarget = i, target
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		case g.mapping[i-1] == target:
+			// The line to the left goes to the same commit: merge.
+		default:
+			// Cross over the line to the left.
+			g.mapping[i-2] = target
+			if horizontalEdge == -1 {
+				horizontalEdgeTarget, horizontalEdge = target, i-1
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		}
+	}
+	copy(g.oldMapping[:g.mappingSize], g.mapping[:g.mappingSize])
+	if g.mapping[g.mappingSize-1] < 0 {
+		g.mappingSize--
+	}
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.mapping[i]
+		switch {
+		case target < 0:
+			line.add(" ")
+		case target*2 == i:
+			line.writeColumn('|')
+		case target == horizontalEdgeTarget && i != horizontalEdge-1:
+			// Only the first segment of a horizontal edge carries on
+			// to the next line.
+			if i != target*2+3 {
+				g.mapping[i] = -1
+			}
+			usedHorizontal = true
+			line.writeColumn('_')
+		default:
+			if usedHorizontal && i < horizontalEdge {
+				g.mapping[i] = -1
+			}
+			line.writeColumn('/')
+		}
+	}
+	g.padHorizontally(line)
+	if g.mappingCorrect() {
+		g.updateState(graphPadding)
+	}
+}
+
+// nextLine returns the next line of the graph and whether it is the one
+// with the commit.
+func (g *commitGraph) nextLine() (string, bool) {
+	line := &graphLine{}
+	if g.commit == nil {
+		return "", false
+	}
+	shownCommitLine := false
+	switch g.state {
+	case graphPadding:
+		g.outputPaddingLine(line)
+	case graphSkip:
+		g.outputSkipLine(line)
+	case graphPreCommit:
+		g.outputPreCommitLine(line)
+	case graphCommit:
+		g.outputCommitLine(line)
+		shownCommitLine = true
+	case graphPostMerge:
+		g.outputPostMergeLine(line)
+	case graphCollapsing:
+		g.outputCollapsingLine(line)
+	}
+	g.padHorizontally(line)
+	return line.String(), shownCommitLine
+}
+
+// paddingLine returns a line that only continues the branch lines, for
+// output that comes with a commit but isn't part of its graph.
+func (g *commitGraph) paddingLine() string {
+	if g == nil {
+		return ""
+	}
+	if g.state != graphCommit {
+		s, _ := g.nextLine()
+		return s
+	}
+	line := &graphLine{}
+	for _, col := range g.columns {
+		line.writeColumn('|')
+		if col == g.commit.sha && len(g.parents) > 2 {
+			line.addChars(' ', (len(g.parents)-2)*2)
+		} else {
+			line.add(" ")
+		}
+	}
+	g.padHorizontally(line)
+	g.prevState = graphPadding
+	return line.String()
+}
+
+// lineWidth is the width of the graph in front of the lines of the
+// current commit, 0 without a graph.
+func (g *commitGraph) lineWidth() int {
+	if g == nil {
+		return 0
+	}
+	return g.width
+}
+
+func (g *commitGraph) finished() bool {
+	return g.state == graphPadding
+}
+
+// showCommit prints the graph down to the line of the commit, which is
+// left for the commit header to finish.
+func (g *commitGraph) showCommit() {
+	if g == nil {
+		return
+	}
+	shownCommitLine := false
+	if g.finished() {
+		g.out.WriteString(g.paddingLine())
+		shownCommitLine = true
+	}
+	for !shownCommitLine && !g.finished() {
+		var s string
+		s, shownCommitLine = g.nextLine()
+		g.out.WriteString(s)
+		if !shownCommitLine {
+			g.out.WriteString("\n")
+		}
+	}
+}
+
+// showOneline prints the next line of the graph, before a line of the
+// commit's output.
+func (g *commitGraph) showOneline() {
+	if g == nil {
+		return
+	}
+	s, _ := g.nextLine()
+	g.out.WriteString(s)
+}
+
+func (g *commitGraph) showPadding() {
+	if g == nil {
+		return
+	}
+	g.out.WriteString(g.paddingLine())
+}
+
+// showRemainder prints the lines left to finish the commit's graph.
+func (g *commitGraph) showRemainder() bool {
+	if g == nil || g.finished() {
+		return false
+	}
+	for {
+		s, _ := g.nextLine()
+		g.out.WriteString(s)
+		if g.finished() {
+			return true
+		}
+		g.out.WriteString("\n")
+	}
+}
+
+// showMessage prints the formatted commit with the graph in front of
+// every line but the first, then the rest of the graph.
+func (g *commitGraph) showMessage(out *bufio.Writer, msg string) {
+	for p := msg; p != ""; {
+		line := p
+		p = ""
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line, p = line[:i+1], line[i+1:]
+		}
+		out.WriteString(line)
+		if p != "" {
+			g.showOneline()
+		}
+	}
+	if g == nil || g.finished() {
+		return
+	}
+	terminated := strings.HasSuffix(msg, "\n")
+	if !terminated {
+		out.WriteString("\n")
+	}
+	g.showRemainder()
+	if terminated {
+		out.WriteString("\n")
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,567 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// logOptions are the options of "log" beyond those of the walk.
+type logOptions struct {
+	format       prettyFormat
+	abbrevCommit bool
+	abbrev       int
+	dateStyle    string
+	decorate     string // "", "short" or "full"
+	graph        bool
+	parents      bool
+	patch        bool
+	stat         bool
+	statWidth    int
+	numstat      bool
+	shortstat    bool
+	nameOnly     bool
+	nameStatus   bool
+	noOutput     bool // -s: no diff output of any kind
+	fullDiff     bool
+	tabExpand    int // -1 for that of the format
+	diffOptions  diff.Options
+	prettyGiven  bool // a format was given on the command line
+	dateExplicit bool // --date was given on the command line
+	notes        int  // 1 for --notes, 0 for --no-notes, -1 if neither
+	useMailmap   bool
+}
+
+// Log implements "log".
+// ref: https://git-scm.com/docs/git-log
+func Log(args []string) int {
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	w := newRevWalk(repo)
+	rest, err := w.parseArgs(args)
+	if err != nil {
+		return die("%v", err)
+	}
+	opts, code := parseLogOptions(repo, rest)
+	if code != 0 {
+		return code
+	}
+	if opts.graph {
+		if w.reverse {
+			return die("options '--reverse' and '--graph' cannot be used together")
+		}
+		w.rewrite = true
+		if w.order == "" {
+			w.order = "topo"
+		}
+	}
+	if opts.parents {
+		w.rewrite = true
+	}
+	if opts.format.wants('S') {
+		w.sources = map[string]string{}
+	}
+	if !w.revGiven {
+		head, err := repo.Refs().Resolve(refs.HEAD)
+		if err != nil {
+			if errors.Is(err, refs.ErrNotFound) && head != nil {
+				return die("your current branch '%s' does not have any commits yet", strings.TrimPrefix(head.Name, "refs/heads/"))
+			}
+			return die("%v", err)
+		}
+		if err := w.addRevision(refs.HEAD, false); err != nil {
+			return die("%v", err)
+		}
+	}
+
+	commits, err := w.commits()
+	if err != nil {
+		return die("%v", err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	l := &logPrinter{repo: repo, w: w, opts: opts, out: out}
+	if opts.graph {
+		l.graph = newCommitGraph(w, out)
+	}
+	l.ctx = &prettyContext{
+		repo:         repo,
+		abbrev:       opts.abbrev,
+		dateStyle:    opts.dateStyle,
+		tabExpand:    opts.tabExpand,
+		dateExplicit: opts.dateExplicit,
+		useMailmap:   opts.useMailmap,
+		decorate:     l.decorations,
+		parents:      w.shownParents,
+		sources:      w.sources,
+		graphWidth:   l.graph.lineWidth,
+	}
+	if opts.notes == 1 {
+		l.ctx.notes = newNoteReader(repo)
+	}
+	for _, n := range commits {
+		if err := l.show(n); err != nil {
+			out.Flush()
+			return die("%v", err)
+		}
+	}
+	return 0
+}
+
+func parseLogOptions(repo *repository.Repository, args []string) (*logOptions, int) {
+	opts := &logOptions{
+		abbrev:      defaultAbbrev(repo),
+		dateStyle:   "default",
+		tabExpand:   -1,
+		diffOptions: diff.DefaultOptions(),
+		notes:       -1,
+	}
+	opts.format, _ = parsePrettyFormat("medium")
+	if cfg, err := repo.Config(); err == nil {
+		if value, ok := cfg.Get("log.date"); ok {
+			opts.dateStyle = value
+		}
+		if value, ok := cfg.Get("format.pretty"); ok {
+			if format, err := parsePrettyFormat(value); err == nil {
+				opts.format = format
+			}
+		}
+		opts.abbrevCommit, _ = cfg.Bool("log.abbrevCommit", false)
+		opts.useMailmap, _ = cfg.Bool("log.mailmap", true)
+		if value, ok := cfg.Get("log.decorate"); ok {
+			switch strings.ToLower(value) {
+			case "short", "true", "yes", "on", "1":
+				opts.decorate = "short"
+			case "full":
+				opts.decorate = "full"
+			}
+		}
+	}
+	setFormat := func(value string) int {
+		format, err := parsePrettyFormat(value)
+		if err != nil {
+			return die("%v", err)
+		}
+		opts.format = format
+		opts.prettyGiven = true
+		return 0
+	}
+	for _, arg := range args {
+		code := 0
+		switch {
+		case arg == "--pretty":
+			code = setFormat("medium")
+		case strings.HasPrefix(arg, "--pretty="):
+			code = setFormat(strings.TrimPrefix(arg, "--pretty="))
+		case strings.HasPrefix(arg, "--format="):
+			code = setFormat(strings.TrimPrefix(arg, "--format="))
+		case arg == "--oneline":
+			code = setFormat("oneline")
+			opts.abbrevCommit = true
+		case arg == "--abbrev-commit":
+			opts.abbrevCommit = true
+		case arg == "--no-abbrev-commit":
+			opts.abbrevCommit = false
+		case strings.HasPrefix(arg, "--abbrev="):
+			opts.abbrev = parseAbbrev(strings.TrimPrefix(arg, "--abbrev="))
+		case arg == "--abbrev":
+		case arg == "--decorate" || arg == "--decorate=short" || arg == "--decorate=auto":
+			opts.decorate = "short"
+		case arg == "--decorate=full":
+			opts.decorate = "full"
+		case arg == "--decorate=no" || arg == "--no-decorate":
+			opts.decorate = ""
+		case strings.HasPrefix(arg, "--decorate="):
+			return nil, die("invalid --decorate option: %s", strings.TrimPrefix(arg, "--decorate="))
+		case arg == "--graph":
+			opts.graph = true
+		case arg == "--parents":
+			opts.parents = true
+		case arg == "-p" || arg == "-u" || arg == "--patch":
+			opts.patch, opts.noOutput = true, false
+		case arg == "--stat":
+			opts.stat = true
+		case strings.HasPrefix(arg, "--stat="):
+			opts.stat = true
+			opts.statWidth, _ = strconv.Atoi(strings.TrimPrefix(arg, "--stat="))
+		case arg == "--numstat":
+			opts.numstat = true
+		case arg == "--shortstat":
+			opts.shortstat = true
+		case arg == "--name-only":
+			opts.nameOnly = true
+		case arg == "--name-status":
+			opts.nameStatus = true
+		case arg == "-s" || arg == "--no-patch":
+			opts.noOutput = true
+		case arg == "--full-diff":
+			opts.fullDiff = true
+		case strings.HasPrefix(arg, "-U") || strings.HasPrefix(arg, "--unified="):
+			value := strings.TrimPrefix(strings.TrimPrefix(arg, "-U"), "--unified=")
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, usage("%s expects a numerical value", arg)
+			}
+			opts.diffOptions.Context = n
+			opts.patch, opts.noOutput = true, false
+		case strings.HasPrefix(arg, "--date="):
+			opts.dateStyle = strings.TrimPrefix(arg, "--date=")
+			if _, err := date.Format(date.Now(), opts.dateStyle); err != nil {
+				return nil, die("unknown date format %s", opts.dateStyle)
+			}
+			opts.dateExplicit = true
+		case arg == "--relative-date":
+			opts.dateStyle = "relative"
+			opts.dateExplicit = true
+		case arg == "--notes" || arg == "--show-notes":
+			opts.notes = 1
+		case arg == "--no-notes":
+			opts.notes = 0
+		case arg == "--use-mailmap" || arg == "--mailmap":
+			opts.useMailmap = true
+		case arg == "--no-use-mailmap" || arg == "--no-mailmap":
+			opts.useMailmap = false
+		case arg == "--expand-tabs":
+			opts.tabExpand = 8
+		case strings.HasPrefix(arg, "--expand-tabs="):
+			opts.tabExpand, _ = strconv.Atoi(strings.TrimPrefix(arg, "--expand-tabs="))
+		case arg == "--no-expand-tabs":
+			opts.tabExpand = 0
+		case arg == "--root" || arg == "--no-color" || arg == "--color=never":
+		default:
+			return nil, die("unrecognized argument: %s", arg)
+		}
+		if code != 0 {
+			return nil, code
+		}
+	}
+	exclusive := 0
+	for _, set := range []bool{opts.nameOnly, opts.nameStatus, opts.noOutput} {
+		if set {
+			exclusive++
+		}
+	}
+	if exclusive > 1 {
+		return nil, die("options '--name-only', '--name-status', '--check', and '-s' cannot be used together")
+	}
+	if exclusive > 0 {
+		// Only one kind of output goes with the names, and none with -s.
+		opts.patch, opts.stat, opts.numstat, opts.shortstat = false, false, false, false
+	}
+	if opts.format.dateStyle != "" && opts.dateStyle == "default" {
+		opts.dateStyle = opts.format.dateStyle
+	}
+	if opts.notes < 0 {
+		// Notes are shown unless a format was asked for, or when it
+		// has %N.
+		opts.notes = 0
+		if !opts.prettyGiven || opts.format.wants('N') {
+			opts.notes = 1
+		}
+	}
+	return opts, 0
+}
+
+// logDecoration is a ref shown next to a commit.
+type logDecoration struct {
+	kind string // "HEAD", "branch", "remote", "tag" or "ref"
+	name string // the full ref name
+}
+
+// logPrinter shows the commits of a walk the way git's log-tree.c does.
+type logPrinter struct {
+	repo  *repository.Repository
+	w     *revWalk
+	opts  *logOptions
+	out   *bufio.Writer
+	graph *commitGraph
+	ctx   *prettyContext
+
+	shownOne       bool
+	missingNewline bool
+	refDecorations map[string][]logDecoration // newest first, like git's list
+}
+
+// loadDecorations reads the refs log decorates commits with: HEAD,
+// branches, remote-tracking branches, tags and the stash. Annotated
+// tags decorate what they point to as well.
+func (l *logPrinter) loadDecorations() {
+	l.refDecorations = map[string][]logDecoration{}
+	add := func(sha string, d logDecoration) {
+		l.refDecorations[sha] = append([]logDecoration{d}, l.refDecorations[sha]...)
+	}
+	addRef := func(name, sha string) {
+		d := logDecoration{kind: "ref", name: name}
+		switch {
+		case name == refs.HEAD:
+			d.kind = "HEAD"
+		case strings.HasPrefix(name, "refs/heads/"):
+			d.kind = "branch"
+		case strings.HasPrefix(name, "refs/remotes/"):
+			d.kind = "remote"
+		case strings.HasPrefix(name, "refs/tags/"):
+			d.kind = "tag"
+		case name == "refs/stash":
+		default:
+			return
+		}
+		add(sha, d)
+		for depth := 0; depth < 16; depth++ {
+			info, err := readObjectInfo(l.repo.Objects(), sha)
+			if err != nil || info.typ != "tag" {
+				return
+			}
+			sha = info.header("object")
+			add(sha, logDecoration{kind: "tag", name: name})
+		}
+	}
+	list, err := l.repo.Refs().List("refs/")
+	if err == nil {
+		for _, ref := range list {
+			sha := ref.Target
+			if ref.IsSymbolic() {
+				resolved, err := l.repo.Refs().Resolve(ref.Name)
+				if err != nil {
+					continue
+				}
+				sha = resolved.Target
+			}
+			addRef(ref.Name, sha)
+		}
+	}
+	if head, err := l.repo.Refs().Resolve(refs.HEAD); err == nil {
+		addRef(refs.HEAD, head.Target)
+	}
+}
+
+// decorations formats the refs pointing at a commit for --decorate, %d
+// and %D. HEAD shows the branch it points to as "HEAD -> <branch>".
+func (l *logPrinter) decorations(sha, prefix, separator, suffix string) string {
+	if l.refDecorations == nil {
+		l.loadDecorations()
+	}
+	list := l.refDecorations[sha]
+	if len(list) == 0 {
+		return ""
+	}
+	show := func(d logDecoration) string {
+		if l.opts.decorate == "full" {
+			return d.name
+		}
+		for _, p := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+			if strings.HasPrefix(d.name, p) {
+				return strings.TrimPrefix(d.name, p)
+			}
+		}
+		return d.name
+	}
+	current := -1
+	for _, d := range list {
+		if d.kind != "HEAD" {
+			continue
+		}
+		head, err := l.repo.Refs().Read(refs.HEAD)
+		if err != nil || !head.IsSymbolic() {
+			break
+		}
+		for i, b := range list {
+			if b.kind == "branch" && b.name == head.Symref {
+				current = i
+			}
+		}
+	}
+	var sb strings.Builder
+	for i, d := range list {
+		if i == current {
+			continue
+		}
+		sb.WriteString(prefix)
+		if d.kind == "tag" {
+			sb.WriteString("tag: ")
+		}
+		sb.WriteString(show(d))
+		if current >= 0 && d.kind == "HEAD" {
+			sb.WriteString(" -> " + show(list[current]))
+		}
+		prefix = separator
+	}
+	return sb.String() + suffix
+}
+
+// diffPairs compares a commit with its parent, or the root commit with
+// the empty tree. Merges show no diff, unless --first-parent leaves them
+// only one parent to compare with.
+func (l *logPrinter) diffPairs(n *commitNode) ([]diff.FilePair, error) {
+	parents := n.parents
+	if len(parents) > 1 {
+		return nil, nil
+	}
+	oldTree := ""
+	if len(parents) == 1 {
+		pn, err := l.w.load(parents[0])
+		if err != nil {
+			return nil, err
+		}
+		oldTree = pn.tree
+	}
+	paths := l.w.paths
+	if l.opts.fullDiff {
+		paths = nil
+	}
+	return diff.Trees(l.repo.Objects(), oldTree, n.tree, diff.TreeOptions{Recursive: true, Paths: paths})
+}
+
+// show prints one commit with its diff, in the order of git's
+// diff_flush: the names, the stats, then the patch.
+func (l *logPrinter) show(n *commitNode) error {
+	l.graph.update(n)
+	o := l.opts
+	var pairs []diff.FilePair
+	if o.patch || o.stat || o.numstat || o.shortstat || o.nameOnly || o.nameStatus {
+		var err error
+		if pairs, err = l.diffPairs(n); err != nil {
+			return err
+		}
+	}
+	if err := l.showLog(n); err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	format := o.format
+	printer := &diff.Printer{
+		Store:   l.repo.Objects(),
+		Out:     l.out,
+		Options: o.diffOptions,
+		Abbrev:  o.abbrev,
+		Width:   o.statWidth,
+	}
+	if l.graph != nil {
+		printer.Prefix = l.graph.paddingLine
+	}
+	if format.kind != "oneline" && !(format.kind == "user" && format.user == "") {
+		if printer.Prefix != nil {
+			l.out.WriteString(printer.Prefix())
+		}
+		if o.stat && o.patch {
+			l.out.WriteString("---")
+		}
+		l.out.WriteString("\n")
+	}
+	if o.nameOnly || o.nameStatus {
+		printer.WriteNames(pairs, o.nameStatus)
+	}
+	if o.numstat {
+		if err := printer.WriteNumStat(pairs); err != nil {
+			return err
+		}
+	}
+	if o.stat {
+		if err := printer.WriteStat(pairs); err != nil {
+			return err
+		}
+	}
+	if o.shortstat {
+		if err := printer.WriteShortStat(pairs); err != nil {
+			return err
+		}
+	}
+	if o.patch {
+		if o.stat || o.numstat || o.shortstat {
+			if printer.Prefix != nil {
+				l.out.WriteString(printer.Prefix())
+			}
+			l.out.WriteString("\n")
+		}
+		for _, pair := range pairs {
+			if err := printer.Patch(pair); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// showLog prints the header and message of a commit.
+func (l *logPrinter) showLog(n *commitNode) error {
+	format := l.opts.format
+	if l.shownOne && !format.terminator {
+		if !l.missingNewline {
+			l.graph.showPadding()
+		}
+		l.out.WriteString("\n")
+	}
+	l.shownOne = true
+	l.graph.showCommit()
+
+	name := func(sha string) string {
+		if l.opts.abbrevCommit {
+			return l.repo.Objects().Abbrev(sha, l.opts.abbrev)
+		}
+		return sha
+	}
+	switch {
+	case format.isEmail():
+		l.out.WriteString("From " + n.sha + " Mon Sep 17 00:00:00 2001\n")
+	case format.kind != "user":
+		if format.kind != "oneline" {
+			l.out.WriteString("commit ")
+		}
+		l.out.WriteString(name(n.sha))
+		if l.opts.parents {
+			for _, p := range l.w.shownParents(n) {
+				l.out.WriteString(" " + name(p))
+			}
+		}
+		if l.opts.decorate != "" {
+			l.out.WriteString(l.decorations(n.sha, " (", ", ", ")"))
+		}
+		if format.kind == "oneline" {
+			l.out.WriteString(" ")
+		} else {
+			l.out.WriteString("\n")
+			l.graph.showOneline()
+		}
+		if n.reflog != nil {
+			if format.kind == "oneline" {
+				// The reflog entry takes the place of the subject.
+				l.out.WriteString(n.reflog.selector(l.ctx, false) + ": " + n.reflog.entry.Message + "\n")
+				l.missingNewline = false
+				return nil
+			}
+			l.out.WriteString("Reflog: " + n.reflog.selector(l.ctx, false) + " (" + n.reflog.entry.Committer + ")\n")
+			l.out.WriteString("Reflog message: " + n.reflog.entry.Message + "\n")
+		}
+	}
+	msg, err := prettyPrint(l.ctx, format, n)
+	if err != nil {
+		return err
+	}
+	if format.kind != "user" && l.ctx.notes != nil {
+		if notes := l.ctx.notes.format(n.sha, false); notes != "" {
+			if format.isEmail() {
+				msg += "---\n"
+			}
+			msg += notes
+		}
+	}
+	l.missingNewline = !strings.HasSuffix(msg, "\n")
+	l.graph.showMessage(l.out, msg)
+	if format.terminator && !(format.kind == "user" && format.user == "") {
+		if !l.missingNewline {
+			l.graph.showPadding()
+		}
+		l.out.WriteString("\n")
+	}
+	return nil
+}
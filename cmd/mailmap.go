@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// mailmap maps the names and emails of commits to canonical ones, keyed
+// by lower-cased email.
+// ref: https://git-scm.com/docs/gitmailmap
+type mailmap map[string]*mailmapEntry
+
+// mailmapEntry is what an email maps to: a name and email for any name,
+// and those of the lines that also give the commit name, keyed by the
+// lower-cased name.
+type mailmapEntry struct {
+	name, email string
+	names       map[string]*mailmapEntry
+}
+
+// readMailmap reads the .mailmap of the working tree, mailmap.blob
+// (HEAD:.mailmap in a bare repository) and mailmap.file, in that order.
+func readMailmap(repo *repository.Repository) mailmap {
+	m := mailmap{}
+	if repo.WorkTree != "" {
+		if data, err := ioutil.ReadFile(filepath.Join(repo.WorkTree, ".mailmap")); err == nil {
+			m.parse(string(data))
+		}
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return m
+	}
+	blob, ok := cfg.Get("mailmap.blob")
+	if !ok && repo.WorkTree == "" {
+		blob = "HEAD:.mailmap"
+	}
+	if blob != "" {
+		if sha, err := resolveRevision(repo, blob); err == nil {
+			if data, err := repo.Objects().ReadType(sha, "blob"); err == nil {
+				m.parse(string(data))
+			}
+		}
+	}
+	if file, ok := cfg.Get("mailmap.file"); ok {
+		if strings.HasPrefix(file, "~/") {
+			home, _ := os.UserHomeDir()
+			file = filepath.Join(home, file[2:])
+		}
+		if data, err := ioutil.ReadFile(file); err == nil {
+			m.parse(string(data))
+		}
+	}
+	return m
+}
+
+// parse adds the lines of a mailmap file: "<proper name> <<commit
+// email>>", "<<proper email>> <<commit email>>" or either with the commit
+// name before the commit email, as git's read_mailmap_line does.
+func (m mailmap) parse(data string) {
+	for _, line := range strings.Split(data, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name1, email1, rest, ok := parseMailmapIdent(line, false)
+		if !ok {
+			continue
+		}
+		name2, email2 := "", ""
+		if rest != "" {
+			name2, email2, _, _ = parseMailmapIdent(rest, true)
+		}
+		m.add(name1, email1, name2, email2)
+	}
+}
+
+// parseMailmapIdent splits "<name> <<email>>" off the start of s and
+// returns what follows.
+func parseMailmapIdent(s string, allowEmpty bool) (string, string, string, bool) {
+	lt := strings.IndexByte(s, '<')
+	if lt < 0 {
+		return "", "", "", false
+	}
+	gt := strings.IndexByte(s[lt+1:], '>')
+	if gt < 0 || gt == 0 && !allowEmpty {
+		return "", "", "", false
+	}
+	gt += lt + 1
+	return strings.TrimSpace(s[:lt]), s[lt+1 : gt], s[gt+1:], true
+}
+
+// add records a line, like git's add_mapping: without a commit email,
+// the proper email is the one to match and only the name is replaced.
+func (m mailmap) add(newName, newEmail, oldName, oldEmail string) {
+	if oldEmail == "" {
+		oldEmail, newEmail = newEmail, ""
+	}
+	key := strings.ToLower(oldEmail)
+	e := m[key]
+	if e == nil {
+		e = &mailmapEntry{names: map[string]*mailmapEntry{}}
+		m[key] = e
+	}
+	if oldName == "" {
+		if newName != "" {
+			e.name = newName
+		}
+		if newEmail != "" {
+			e.email = newEmail
+		}
+		return
+	}
+	e.names[strings.ToLower(oldName)] = &mailmapEntry{name: newName, email: newEmail}
+}
+
+// lookup maps a name and email, returning them unchanged when the
+// mailmap has nothing for them.
+func (m mailmap) lookup(name, email string) (string, string) {
+	e := m[strings.ToLower(email)]
+	if e == nil {
+		return name, email
+	}
+	if byName, ok := e.names[strings.ToLower(name)]; ok {
+		e = byName
+	}
+	if e.name != "" {
+		name = e.name
+	}
+	if e.email != "" {
+		email = e.email
+	}
+	return name, email
+}
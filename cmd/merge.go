@@ -0,0 +1,664 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/ignore"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/unpack"
+)
+
+// mergeOptions are the options of "merge".
+type mergeOptions struct {
+	ff       string // "" to fast-forward when possible, "no" or "only"
+	squash   bool
+	noCommit bool
+	edit     int // 1 for --edit, 0 for --no-edit, -1 to decide
+	messages []string
+	quiet    bool
+	noStat   bool
+	favor    merge.Favor
+	// noRenames and renameScore are "-X no-renames" and
+	// "-X find-renames=<n>".
+	noRenames   bool
+	renameScore int
+}
+
+// Merge implements "merge": the named commit joins the current branch,
+// by fast-forwarding to it when the branch has nothing of its own, or
+// else by a merge commit. A merge that conflicts stops with the
+// conflicts in the index and the work tree, to be concluded by "commit"
+// or given up with "merge --abort".
+// ref: https://git-scm.com/docs/git-merge
+func Merge(args []string) int {
+	o := &mergeOptions{edit: -1}
+	abort, cont := false, false
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, bool) {
+			if i+1 >= len(args) {
+				return "", false
+			}
+			i++
+			return args[i], true
+		}
+		switch {
+		case arg == "--":
+			rest = append(rest, args[i+1:]...)
+			i = len(args)
+		case arg == "--ff":
+			o.ff = ""
+		case arg == "--no-ff":
+			o.ff = "no"
+		case arg == "--ff-only":
+			o.ff = "only"
+		case arg == "--squash":
+			o.squash = true
+		case arg == "--no-squash":
+			o.squash = false
+		case arg == "--commit":
+			o.noCommit = false
+		case arg == "--no-commit":
+			o.noCommit = true
+		case arg == "-e" || arg == "--edit":
+			o.edit = 1
+		case arg == "--no-edit":
+			o.edit = 0
+		case arg == "-m" || arg == "--message":
+			msg, ok := value()
+			if !ok {
+				return usage("switch `m' requires a value")
+			}
+			o.messages = append(o.messages, msg)
+		case strings.HasPrefix(arg, "--message="):
+			o.messages = append(o.messages, strings.TrimPrefix(arg, "--message="))
+		case strings.HasPrefix(arg, "-m") && len(arg) > 2:
+			o.messages = append(o.messages, arg[2:])
+		case arg == "-q" || arg == "--quiet":
+			o.quiet = true
+		case arg == "-n" || arg == "--no-stat":
+			o.noStat = true
+		case arg == "--stat":
+			o.noStat = false
+		case arg == "--abort":
+			abort = true
+		case arg == "--continue":
+			cont = true
+		case arg == "-s" || arg == "--strategy" || strings.HasPrefix(arg, "--strategy="):
+			strategy := strings.TrimPrefix(arg, "--strategy=")
+			if strategy == arg {
+				var ok bool
+				if strategy, ok = value(); !ok {
+					return usage("switch `s' requires a value")
+				}
+			}
+			if strategy != "ort" && strategy != "recursive" {
+				fmt.Fprintf(os.Stderr, "Could not find merge strategy '%s'.\nAvailable strategies are: ort recursive.\n", strategy)
+				return 1
+			}
+		case arg == "-X" || arg == "--strategy-option" || strings.HasPrefix(arg, "--strategy-option=") || strings.HasPrefix(arg, "-X"):
+			option := strings.TrimPrefix(strings.TrimPrefix(arg, "--strategy-option="), "-X")
+			if arg == "-X" || arg == "--strategy-option" {
+				var ok bool
+				if option, ok = value(); !ok {
+					return usage("switch `X' requires a value")
+				}
+			}
+			if !o.strategyOption(option) {
+				return die("unknown strategy option: -X%s", option)
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if o.squash && o.ff == "no" {
+		return die("options '--squash' and '--no-ff.' cannot be used together")
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	if abort || cont {
+		if len(rest) > 0 || len(args) > 1 {
+			what := "--abort"
+			if cont {
+				what = "--continue"
+			}
+			return usage("%s expects no arguments", what)
+		}
+		if _, err := os.Stat(repo.Path("MERGE_HEAD")); err != nil {
+			if abort {
+				return die("There is no merge to abort (MERGE_HEAD missing).")
+			}
+			return die("There is no merge in progress (MERGE_HEAD missing).")
+		}
+		if cont {
+			return Commit(nil)
+		}
+		return mergeAbort(repo)
+	}
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	if code := refuseUnmerged(idx, "Merging"); code != 0 {
+		return code
+	}
+	if _, err := os.Stat(repo.Path("MERGE_HEAD")); err == nil {
+		return die("You have not concluded your merge (MERGE_HEAD exists).\nPlease, commit your changes before you merge.")
+	}
+	switch len(rest) {
+	case 0:
+		if headBranch(repo) == "" {
+			return die("No current branch.")
+		}
+		upstream, err := trackingRef(repo, "", false)
+		if err != nil {
+			return die("No remote for the current branch.")
+		}
+		rest = []string{refs.Shorten(upstream, repo.Refs().Exists)}
+	case 1:
+	default:
+		return die("octopus merges are not supported")
+	}
+	return o.merge(repo, idx, rest[0])
+}
+
+// strategyOption applies an option of the ort strategy.
+// ref: parse_merge_opt in https://github.com/git/git/blob/master/merge-recursive.c
+func (o *mergeOptions) strategyOption(option string) bool {
+	switch {
+	case option == "ours":
+		o.favor = merge.FavorOurs
+	case option == "theirs":
+		o.favor = merge.FavorTheirs
+	case option == "no-renames":
+		o.noRenames = true
+	case option == "find-renames":
+		o.noRenames, o.renameScore = false, 0
+	case strings.HasPrefix(option, "find-renames=") || strings.HasPrefix(option, "rename-threshold="):
+		score, rest := diff.ParseScore(option[strings.IndexByte(option, '=')+1:])
+		if rest != "" {
+			return false
+		}
+		o.noRenames, o.renameScore = false, score
+	default:
+		return false
+	}
+	return true
+}
+
+// merge merges the commit named arg into HEAD.
+// ref: cmd_merge in https://github.com/git/git/blob/master/builtin/merge.c
+func (o *mergeOptions) merge(repo *repository.Repository, idx *index.Index, arg string) int {
+	theirs, err := resolveRevisionAs(repo, arg, "commit")
+	if err == nil {
+		theirs, err = peelTo(repo, arg, theirs, "commit")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "merge: %s - not something we can merge\n", arg)
+		return 1
+	}
+	head, err := currentBranch(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	if head.commit == "" {
+		// Merging into an unborn branch takes the commit as it is.
+		if o.squash {
+			return die("Squash commit into empty head not supported yet")
+		}
+		if o.ff == "no" {
+			return die("Non-fast-forward commit does not make sense into an empty head")
+		}
+		if code := checkoutCommit(repo, idx, "", theirs); code != 0 {
+			return code
+		}
+		if err := repo.Refs().Update(refs.HEAD, theirs, "", "initial pull", false); err != nil {
+			return die("%v", err)
+		}
+		return 0
+	}
+	bases, err := merge.Bases(repo.Objects(), head.commit, []string{theirs})
+	if err != nil {
+		return die("%v", err)
+	}
+	if len(bases) == 1 && bases[0] == theirs {
+		if !o.quiet {
+			fmt.Println("Already up to date.")
+		}
+		return 0
+	}
+	if err := repo.Refs().Update("ORIG_HEAD", head.commit, "", "updating ORIG_HEAD", true); err != nil {
+		return die("%v", err)
+	}
+	reflog := "merge " + arg
+	abbrev := defaultAbbrev(repo)
+	if len(bases) == 1 && bases[0] == head.commit && o.ff != "no" {
+		if !o.quiet {
+			fmt.Printf("Updating %s..%s\n", repo.Objects().Abbrev(head.commit, abbrev), repo.Objects().Abbrev(theirs, abbrev))
+		}
+		if code := checkoutCommit(repo, idx, head.commit, theirs); code != 0 {
+			return code
+		}
+		return o.finish(repo, head, theirs, theirs, reflog, "Fast-forward")
+	}
+	if o.ff == "only" {
+		return die("Not possible to fast-forward, aborting.")
+	}
+
+	oldTree, err := headTree(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	changed, err := diff.TreeIndex(repo.Objects(), oldTree, idx, "", diff.TreeOptions{})
+	if err != nil {
+		return die("%v", err)
+	}
+	if len(changed) > 0 {
+		fmt.Fprintln(os.Stderr, "error: Your local changes to the following files would be overwritten by merge:")
+		for _, p := range changed {
+			fmt.Fprintf(os.Stderr, "  %s\n", p.Path())
+		}
+		// Git stashes the changes and puts them back after a reset,
+		// which the reflog keeps a trace of.
+		if err := repo.Refs().Update(refs.HEAD, head.commit, head.commit, reflog+": updating HEAD", false); err != nil {
+			return die("%v", err)
+		}
+		fmt.Fprintln(os.Stderr, "Merge with strategy ort failed.")
+		return 2
+	}
+	style, err := conflictStyle(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	res, err := merge.Commits(bases, head.commit, theirs, merge.Options{
+		Store:       repo.Objects(),
+		OursLabel:   "HEAD",
+		TheirsLabel: arg,
+		Style:       style,
+		Favor:       o.favor,
+		NoRenames:   o.noRenames,
+		RenameScore: o.renameScore,
+		RenameLimit: diff.DefaultRenameLimit,
+	})
+	if err != nil {
+		return die("%v", err)
+	}
+	if code := applyMerge(repo, idx, oldTree, res); code != 0 {
+		return code
+	}
+	if !o.quiet {
+		printMergeMessages(res)
+	}
+
+	msg := mergeMessage(repo, head, arg)
+	if len(o.messages) > 0 {
+		msg = strings.Join(o.messages, "\n\n") + "\n"
+	}
+	if !res.Clean || o.squash || o.noCommit {
+		if o.squash {
+			if code := o.finish(repo, head, theirs, "", reflog, ""); code != 0 {
+				return code
+			}
+		} else if err := o.writeMergeState(repo, theirs, msg); err != nil {
+			return die("%v", err)
+		}
+		if res.Clean {
+			fmt.Fprintln(os.Stderr, "Automatic merge went well; stopped before committing as requested")
+			return 0
+		}
+		if err := suggestConflicts(repo, res); err != nil {
+			return die("%v", err)
+		}
+		fmt.Println("Automatic merge failed; fix conflicts and then commit the result.")
+		return 1
+	}
+
+	if o.edit == 1 || o.edit == -1 && autoEdit() {
+		if err := o.writeMergeState(repo, theirs, msg); err != nil {
+			return die("%v", err)
+		}
+		if msg, err = editMessage(repo, "MERGE_MSG", msg+mergeEditTemplate); err != nil {
+			return die("%v", err)
+		}
+		msg = cleanupMessage(msg, true)
+		if msg == "" {
+			fmt.Fprintln(os.Stderr, "Not committing merge; use 'git commit' to complete the merge.")
+			return 1
+		}
+	} else {
+		msg = cleanupMessage(msg, false)
+	}
+	sha, err := createCommit(repo, res.Tree, []string{head.commit, theirs}, msg, nil)
+	if err != nil {
+		return die("%v", err)
+	}
+	removeMergeState(repo)
+	return o.finish(repo, head, theirs, sha, reflog, "Merge made by the 'ort' strategy.")
+}
+
+// mergeEditTemplate explains the message of a merge commit in the
+// editor.
+const mergeEditTemplate = `
+# Please enter a commit message to explain why this merge is necessary,
+# especially if it merges an updated upstream into a topic branch.
+#
+# Lines starting with '#' will be ignored, and an empty message aborts
+# the commit.
+`
+
+// autoEdit tells whether a merge commit's message is edited without
+// --edit: only when a person is at a terminal to do it.
+// ref: default_edit_option in https://github.com/git/git/blob/master/builtin/merge.c
+func autoEdit() bool {
+	if value := os.Getenv("GIT_MERGE_AUTOEDIT"); value != "" {
+		return value != "no"
+	}
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		if info, err := f.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkoutCommit moves the index and the work tree from one commit to
+// another, as a fast-forward does.
+// ref: checkout_fast_forward in https://github.com/git/git/blob/master/merge.c
+func checkoutCommit(repo *repository.Repository, idx *index.Index, from, to string) int {
+	oldTree, newTree := "", ""
+	var err error
+	if from != "" {
+		if oldTree, err = peelTo(repo, from, from, "tree"); err != nil {
+			return die("%v", err)
+		}
+	}
+	if newTree, err = peelTo(repo, to, to, "tree"); err != nil {
+		return die("%v", err)
+	}
+	if code := twoWayMerge(repo, idx, oldTree, newTree); code != 0 {
+		return code
+	}
+	if err := idx.Write(repo.IndexFile(), repo.Format); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// twoWayMerge moves the index and the work tree to a new tree, keeping
+// the local changes it doesn't touch, or tells why it can't.
+func twoWayMerge(repo *repository.Repository, idx *index.Index, oldTree, newTree string) int {
+	cfg, err := repo.Config()
+	if err != nil {
+		return die("%v", err)
+	}
+	matcher, err := ignore.New(repo.WorkTree, repo.GitDir, cfg)
+	if err != nil {
+		return die("%v", err)
+	}
+	err = unpack.TwoWay(idx, oldTree, newTree, unpack.Options{
+		Store:    repo.Objects(),
+		WorkTree: repo.WorkTree,
+		Ignored:  matcher.IsIgnored,
+		Action:   "merge",
+	})
+	var unpackErr *unpack.Error
+	if errors.As(err, &unpackErr) {
+		for _, msg := range unpackErr.Messages() {
+			fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+		}
+		fmt.Fprintln(os.Stderr, "Aborting")
+		return 1
+	}
+	if err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// applyMerge puts the result of a merge in the index and the work tree:
+// the merged tree, with the conflicted paths at their stages.
+// ref: merge_switch_to_result in https://github.com/git/git/blob/master/merge-ort.c
+func applyMerge(repo *repository.Repository, idx *index.Index, oldTree string, res *merge.Result) int {
+	if code := twoWayMerge(repo, idx, oldTree, res.Tree); code != 0 {
+		fmt.Fprintln(os.Stderr, "Merge with strategy ort failed.")
+		return 2
+	}
+	if len(res.Unmerged) > 0 {
+		conflicted := map[string]bool{}
+		for _, e := range res.Unmerged {
+			conflicted[e.Path] = true
+		}
+		entries := append([]*index.Entry(nil), res.Unmerged...)
+		for _, e := range idx.Entries {
+			if !conflicted[e.Path] {
+				entries = append(entries, e)
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			a, b := entries[i], entries[j]
+			return a.Path < b.Path || a.Path == b.Path && a.Stage < b.Stage
+		})
+		idx.Entries = entries
+	}
+	if err := idx.Write(repo.IndexFile(), repo.Format); err != nil {
+		return die("%v", err)
+	}
+	// AUTO_MERGE keeps the tree as merged, conflict markers and all,
+	// until the merge is concluded.
+	if err := os.WriteFile(repo.Path("AUTO_MERGE"), []byte(res.Tree+"\n"), 0o666); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// printMergeMessages shows what a merge did, path by path; warnings go
+// to stderr.
+func printMergeMessages(res *merge.Result) {
+	for _, m := range res.Messages {
+		if m.Type == "CONFLICT (binary)" {
+			fmt.Fprintln(os.Stderr, m.Text)
+		} else {
+			fmt.Println(m.Text)
+		}
+	}
+}
+
+// finish moves HEAD to the result of a merge and shows what changed, or
+// for --squash leaves HEAD and writes SQUASH_MSG instead. An empty
+// result is a squash that stopped before writing the tree.
+// ref: finish in https://github.com/git/git/blob/master/builtin/merge.c
+func (o *mergeOptions) finish(repo *repository.Repository, head *branchInfo, theirs, result, reflog, what string) int {
+	if what != "" && !o.quiet {
+		fmt.Println(what)
+	}
+	if o.squash {
+		if !o.quiet {
+			fmt.Println("Squash commit -- not updating HEAD")
+		}
+		if err := writeSquashMessage(repo, head.commit, theirs); err != nil {
+			return die("%v", err)
+		}
+	} else if err := repo.Refs().Update(refs.HEAD, result, head.commit, reflog+": "+what, false); err != nil {
+		return die("%v", err)
+	}
+	if result == "" || o.quiet || o.noStat {
+		return 0
+	}
+	oldTree, err := peelTo(repo, head.commit, head.commit, "tree")
+	if err != nil {
+		return die("%v", err)
+	}
+	newTree, err := peelTo(repo, result, result, "tree")
+	if err != nil {
+		return die("%v", err)
+	}
+	if err := printDiffstat(repo, oldTree, newTree, false); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// writeSquashMessage lists in SQUASH_MSG the commits a squash brings,
+// for the commit that concludes it.
+// ref: squash_message in https://github.com/git/git/blob/master/builtin/merge.c
+func writeSquashMessage(repo *repository.Repository, head, theirs string) error {
+	w := newRevWalk(repo)
+	w.addObject(theirs, "", false)
+	w.addObject(head, "", true)
+	commits, err := w.commits()
+	if err != nil {
+		return err
+	}
+	ctx := &prettyContext{repo: repo, abbrev: defaultAbbrev(repo), dateStyle: "default", tabExpand: 8, parents: w.shownParents}
+	var sb strings.Builder
+	sb.WriteString("Squashed commit of the following:\n")
+	for _, n := range commits {
+		msg, err := prettyPrint(ctx, prettyFormat{kind: "medium"}, n)
+		if err != nil {
+			return err
+		}
+		sb.WriteString("\ncommit " + n.sha + "\n" + msg)
+	}
+	return os.WriteFile(repo.Path("SQUASH_MSG"), []byte(sb.String()), 0o666)
+}
+
+// writeMergeState records a merge left for "commit" to conclude.
+// ref: write_merge_state in https://github.com/git/git/blob/master/builtin/merge.c
+func (o *mergeOptions) writeMergeState(repo *repository.Repository, theirs, msg string) error {
+	if err := os.WriteFile(repo.Path("MERGE_HEAD"), []byte(theirs+"\n"), 0o666); err != nil {
+		return err
+	}
+	if err := os.WriteFile(repo.Path("MERGE_MSG"), []byte(msg), 0o666); err != nil {
+		return err
+	}
+	mode := ""
+	if o.ff == "no" {
+		mode = "no-ff"
+	}
+	return os.WriteFile(repo.Path("MERGE_MODE"), []byte(mode), 0o666)
+}
+
+// suggestConflicts lists the conflicted paths at the end of MERGE_MSG,
+// as comments that remind of them when the message is edited.
+// ref: suggest_conflicts in https://github.com/git/git/blob/master/builtin/merge.c
+func suggestConflicts(repo *repository.Repository, res *merge.Result) error {
+	f, err := os.OpenFile(repo.Path("MERGE_MSG"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := "\n# Conflicts:\n"
+	for i, e := range res.Unmerged {
+		if i == 0 || res.Unmerged[i-1].Path != e.Path {
+			s += "#\t" + e.Path + "\n"
+		}
+	}
+	_, err = f.WriteString(s)
+	return err
+}
+
+// mergeMessage is the default message of a merge commit, naming what
+// was merged by the kind of ref it is, and the branch merged into
+// unless it is the main one.
+// ref: fmt_merge_msg in https://github.com/git/git/blob/master/fmt-merge-msg.c
+func mergeMessage(repo *repository.Repository, head *branchInfo, arg string) string {
+	what := fmt.Sprintf("commit '%s'", arg)
+	// "<branch>~<n>" and "<branch>^" are an early part of the branch.
+	name, early := strings.TrimRight(arg, "^"), " (early part)"
+	if i := strings.LastIndexByte(arg, '~'); name == arg && i >= 0 && strings.Trim(arg[i+1:], "0123456789") == "" {
+		name = arg[:i]
+		if i+1 < len(arg) && strings.Trim(arg[i+1:], "0") == "" {
+			early = ""
+		}
+	}
+	if name != arg && repo.Refs().Exists("refs/heads/"+name) {
+		what = fmt.Sprintf("branch '%s'%s", name, early)
+	} else if full, ok := dwimRef(repo, branchName(repo, arg)); ok {
+		switch {
+		case strings.HasPrefix(full, "refs/heads/"):
+			what = fmt.Sprintf("branch '%s'", strings.TrimPrefix(full, "refs/heads/"))
+		case strings.HasPrefix(full, "refs/remotes/"):
+			what = fmt.Sprintf("remote-tracking branch '%s'", strings.TrimPrefix(full, "refs/remotes/"))
+		case strings.HasPrefix(full, "refs/tags/"):
+			what = fmt.Sprintf("tag '%s'", strings.TrimPrefix(full, "refs/tags/"))
+		}
+	}
+	msg := "Merge " + what
+	into := "HEAD"
+	if head.ref != "" {
+		into = head.name
+	}
+	if into != "main" && into != "master" {
+		msg += " into " + into
+	}
+	return msg + "\n"
+}
+
+// mergeAbort throws a conflicted merge away, back to HEAD, keeping the
+// local changes that were there before the merge.
+// ref: https://git-scm.com/docs/git-merge#Documentation/git-merge.txt---abort
+func mergeAbort(repo *repository.Repository) int {
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	head, err := currentBranch(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	tree, err := headTree(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	err = unpack.OneWay(idx, tree, unpack.Options{Store: repo.Objects(), WorkTree: repo.WorkTree, Action: "reset"})
+	var unpackErr *unpack.Error
+	if errors.As(err, &unpackErr) {
+		for _, msg := range unpackErr.Messages() {
+			fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+		}
+		return die("Could not reset index file to revision 'HEAD'.")
+	}
+	if err != nil {
+		return die("%v", err)
+	}
+	if err := idx.Write(repo.IndexFile(), repo.Format); err != nil {
+		return die("%v", err)
+	}
+	if head.commit != "" {
+		if err := repo.Refs().Update(refs.HEAD, head.commit, head.commit, "reset: moving to HEAD", false); err != nil {
+			return die("%v", err)
+		}
+	}
+	removeMergeState(repo)
+	return 0
+}
+
+// conflictStyle is the merge.conflictStyle of the configuration.
+func conflictStyle(repo *repository.Repository) (merge.Style, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return merge.StyleMerge, err
+	}
+	value, ok := cfg.Get("merge.conflictStyle")
+	if !ok {
+		return merge.StyleMerge, nil
+	}
+	style, ok := merge.ParseStyle(value)
+	if !ok {
+		return merge.StyleMerge, fmt.Errorf("unknown style '%s' given for 'merge.conflictstyle'", value)
+	}
+	return style, nil
+}
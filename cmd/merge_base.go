@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+const mergeBaseUsage = "usage: git merge-base [-a | --all] <commit> <commit>..."
+
+// MergeBase implements "merge-base": the best common ancestors of two
+// commits, or of the first commit and a merge of all the others; with
+// --octopus those of all the commits at once. --is-ancestor only
+// answers by its exit code, --independent drops the commits the others
+// reach, and --fork-point finds where a branch forked from the history
+// a ref's reflog remembers.
+// ref: https://git-scm.com/docs/git-merge-base
+func MergeBase(args []string) int {
+	all := false
+	mode := ""
+	rest := []string{}
+	for _, arg := range args {
+		switch {
+		case arg == "-a" || arg == "--all":
+			all = true
+		case arg == "--octopus" || arg == "--independent" || arg == "--is-ancestor" || arg == "--fork-point":
+			if mode != "" && mode != arg {
+				return usage("option `%s' is incompatible with %s", strings.TrimPrefix(arg, "--"), mode)
+			}
+			mode = arg
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if all && (mode == "--is-ancestor" || mode == "--independent" || mode == "--fork-point") {
+		return die("options '%s' and '--all' cannot be used together", mode)
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	switch mode {
+	case "--is-ancestor":
+		if len(rest) != 2 {
+			return die("--is-ancestor takes exactly two commits")
+		}
+	case "--fork-point":
+		if len(rest) < 1 || len(rest) > 2 {
+			return usage(mergeBaseUsage)
+		}
+		return forkPoint(repo, rest)
+	case "--octopus", "--independent":
+		if len(rest) < 1 {
+			return usage(mergeBaseUsage)
+		}
+	default:
+		if len(rest) < 2 {
+			return usage(mergeBaseUsage)
+		}
+	}
+	commits := []string{}
+	for _, arg := range rest {
+		sha, err := resolveRevision(repo, arg)
+		if err != nil {
+			return die("Not a valid object name %s", arg)
+		}
+		if sha, err = peelTo(repo, arg, sha, "commit"); err != nil {
+			return die("Not a valid commit name %s", arg)
+		}
+		commits = append(commits, sha)
+	}
+
+	var bases []string
+	switch mode {
+	case "--is-ancestor":
+		ok, err := merge.IsAncestor(repo.Objects(), commits[0], commits[1])
+		if err != nil {
+			return die("%v", err)
+		}
+		if !ok {
+			return 1
+		}
+		return 0
+	case "--independent":
+		bases, err = merge.Independent(repo.Objects(), commits)
+		all = true
+	case "--octopus":
+		bases, err = octopusMergeBases(repo, commits)
+	default:
+		bases, err = merge.Bases(repo.Objects(), commits[0], commits[1:])
+	}
+	if err != nil {
+		return die("%v", err)
+	}
+	if len(bases) == 0 {
+		return 1
+	}
+	if !all {
+		bases = bases[:1]
+	}
+	for _, sha := range bases {
+		fmt.Println(sha)
+	}
+	return 0
+}
+
+// octopusMergeBases finds the common ancestors of all the commits, one
+// commit after the other.
+// ref: get_octopus_merge_bases in https://github.com/git/git/blob/master/commit-reach.c
+func octopusMergeBases(repo *repository.Repository, commits []string) ([]string, error) {
+	result := commits[:1]
+	for _, next := range commits[1:] {
+		found := []string{}
+		for _, sha := range result {
+			bases, err := merge.Bases(repo.Objects(), next, []string{sha})
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, bases...)
+		}
+		result = found
+	}
+	return merge.Independent(repo.Objects(), result)
+}
+
+// forkPoint finds the commit where a branch forked from ref: the merge
+// base of the branch with any of the commits ref's reflog says ref was
+// at, if it is one of them.
+// ref: handle_fork_point in https://github.com/git/git/blob/master/builtin/merge-base.c
+func forkPoint(repo *repository.Repository, args []string) int {
+	ref, ok := dwimRef(repo, args[0])
+	if !ok {
+		return die("No such ref: '%s'", args[0])
+	}
+	rev := "HEAD"
+	if len(args) == 2 {
+		rev = args[1]
+	}
+	derived, err := resolveRevisionAs(repo, rev, "commit")
+	if err == nil {
+		derived, err = peelTo(repo, rev, derived, "commit")
+	}
+	if err != nil {
+		return die("Not a valid object name: '%s'", rev)
+	}
+	entries, err := repo.Refs().ReadReflog(ref)
+	if err != nil {
+		return die("%v", err)
+	}
+	candidates := []string{}
+	seen := map[string]bool{}
+	add := func(sha string) {
+		if sha == repo.Format.ZeroHex() || seen[sha] {
+			return
+		}
+		if _, err := peelTo(repo, sha, sha, "commit"); err != nil {
+			return
+		}
+		seen[sha] = true
+		candidates = append(candidates, sha)
+	}
+	for i, e := range entries {
+		if i == 0 {
+			add(e.Old)
+		}
+		add(e.New)
+	}
+	if len(candidates) == 0 {
+		if r, err := repo.Refs().Resolve(ref); err == nil {
+			add(r.Target)
+		}
+	}
+	if len(candidates) == 0 {
+		return 1
+	}
+	bases, err := merge.Bases(repo.Objects(), derived, candidates)
+	if err != nil {
+		return die("%v", err)
+	}
+	if len(bases) != 1 || !seen[bases[0]] {
+		return 1
+	}
+	fmt.Println(bases[0])
+	return 0
+}
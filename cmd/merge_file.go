@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+)
+
+const mergeFileUsage = "usage: git merge-file [<options>] [-L <name1> [-L <orig> [-L <name2>]]] <file1> <orig-file> <file2>"
+
+// MergeFile implements "merge-file": the changes from <orig-file> to
+// <file2> are merged into <file1>, with conflict markers labelled with
+// the file names, or with the -L names. The exit code is the number of
+// conflicts, or 255 on errors.
+// ref: https://git-scm.com/docs/git-merge-file
+func MergeFile(args []string) int {
+	opts := merge.FileOptions{}
+	toStdout, styleSet := false, false
+	labels := []string{}
+	files := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-p" || arg == "--stdout":
+			toStdout = true
+		case arg == "--diff3":
+			opts.Style, styleSet = merge.StyleDiff3, true
+		case arg == "--zdiff3":
+			opts.Style, styleSet = merge.StyleZdiff3, true
+		case arg == "--ours":
+			opts.Favor = merge.FavorOurs
+		case arg == "--theirs":
+			opts.Favor = merge.FavorTheirs
+		case arg == "--union":
+			opts.Favor = merge.FavorUnion
+		case arg == "-q" || arg == "--quiet":
+			// Conflicts are only told by the exit code anyway.
+		case arg == "--marker-size" || strings.HasPrefix(arg, "--marker-size="):
+			value := strings.TrimPrefix(arg, "--marker-size=")
+			if arg == "--marker-size" {
+				if i+1 >= len(args) {
+					return usage("option `marker-size' requires a value")
+				}
+				i++
+				value = args[i]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return usage("option `marker-size' expects a numerical value")
+			}
+			opts.MarkerSize = n
+		case arg == "-L":
+			if i+1 >= len(args) {
+				return usage("switch `L' requires a value")
+			}
+			i++
+			labels = append(labels, args[i])
+		case strings.HasPrefix(arg, "-L") && len(arg) > 2:
+			labels = append(labels, arg[2:])
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			files = append(files, arg)
+		}
+		if len(labels) > 3 {
+			return usage("too many labels on the command line")
+		}
+	}
+	if len(files) != 3 {
+		return usage(mergeFileUsage)
+	}
+	if !styleSet {
+		// Outside of a repository there is no configuration to read.
+		if repo, err := openRepository(); err == nil {
+			if opts.Style, err = conflictStyle(repo); err != nil {
+				return die("%v", err)
+			}
+		}
+	}
+	names := append(labels, files[len(labels):]...)
+	opts.OursLabel, opts.AncestorLabel, opts.TheirsLabel = names[0], names[1], names[2]
+
+	contents := make([][]byte, 3)
+	for i, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: Could not stat %s: %v\n", name, strerror(err))
+			return 255
+		}
+		if merge.IsBinary(data) {
+			fmt.Fprintf(os.Stderr, "error: Cannot merge binary files: %s\n", name)
+			return 255
+		}
+		contents[i] = data
+	}
+	result, conflicts := merge.File(contents[1], contents[0], contents[2], opts)
+	if toStdout {
+		os.Stdout.Write(result)
+	} else if err := os.WriteFile(files[0], result, 0o666); err != nil {
+		fmt.Fprintf(os.Stderr, "error: Could not open %s for writing\n", files[0])
+		return 255
+	}
+	if conflicts > 127 {
+		conflicts = 127
+	}
+	return conflicts
+}
+
+// strerror is the C library's message for the error of a system call,
+// as git prints it.
+func strerror(err error) string {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return err.Error()
+	}
+	msg := errno.Error()
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
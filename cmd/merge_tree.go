@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+)
+
+const mergeTreeUsage = "usage: git merge-tree [--write-tree] [<options>] <branch1> <branch2>"
+
+// MergeTree implements "merge-tree --write-tree": two commits are merged
+// in the object database alone, for bare repositories too, and the tree
+// of the result is printed. Conflicts add the stages of the conflicted
+// files, or only their names, and the messages of the merge; they exit
+// with 1.
+// ref: https://git-scm.com/docs/git-merge-tree
+func MergeTree(args []string) int {
+	nameOnly, nul, allowUnrelated := false, false, false
+	messages := 0 // -1 for --no-messages, 1 for --messages
+	rest := []string{}
+	for _, arg := range args {
+		switch {
+		case arg == "--write-tree":
+		case arg == "--trivial-merge":
+			return die("the trivial merge mode is not supported")
+		case arg == "--name-only":
+			nameOnly = true
+		case arg == "-z":
+			nul = true
+		case arg == "--messages":
+			messages = 1
+		case arg == "--no-messages":
+			messages = -1
+		case arg == "--allow-unrelated-histories":
+			allowUnrelated = true
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) == 3 {
+		return die("the trivial merge mode is not supported")
+	}
+	if len(rest) != 2 {
+		return usage(mergeTreeUsage)
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	commits := make([]string, 2)
+	for i, arg := range rest {
+		sha, err := resolveRevisionAs(repo, arg, "commit")
+		if err == nil {
+			sha, err = peelTo(repo, arg, sha, "commit")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "merge-tree: %s - not something we can merge\n", arg)
+			return 1
+		}
+		commits[i] = sha
+	}
+	style, err := conflictStyle(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	res, err := merge.Tree(commits[0], commits[1], merge.Options{
+		Store:                   repo.Objects(),
+		OursLabel:               rest[0],
+		TheirsLabel:             rest[1],
+		Style:                   style,
+		RenameLimit:             diff.DefaultRenameLimit,
+		AllowUnrelatedHistories: allowUnrelated,
+	})
+	if err != nil {
+		return die("%v", err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	term := "\n"
+	quote := diff.QuotePath
+	if nul {
+		term = "\x00"
+		quote = func(path string) string { return path }
+	}
+	fmt.Fprint(out, res.Tree+term)
+	if !res.Clean {
+		for i, e := range res.Unmerged {
+			if !nameOnly {
+				fmt.Fprintf(out, "%06o %s %d\t%s%s", e.Mode, e.Sha, e.Stage, quote(e.Path), term)
+			} else if i == 0 || res.Unmerged[i-1].Path != e.Path {
+				fmt.Fprint(out, quote(e.Path)+term)
+			}
+		}
+	}
+	if messages == 1 || messages == 0 && !res.Clean {
+		fmt.Fprint(out, term)
+		for _, m := range res.Messages {
+			if !nul {
+				fmt.Fprintln(out, m.Text)
+				continue
+			}
+			fmt.Fprintf(out, "%d\x00", len(m.Paths))
+			for _, path := range m.Paths {
+				fmt.Fprint(out, path+"\x00")
+			}
+			fmt.Fprintf(out, "%s\x00%s\n\x00", m.Type, m.Text)
+		}
+	}
+	if !res.Clean {
+		return 1
+	}
+	return 0
+}
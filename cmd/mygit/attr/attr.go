@@ -0,0 +1,300 @@
+// Package attr reads gitattributes files to tell which attributes apply
+// to a path of the work tree.
+// ref: https://git-scm.com/docs/gitattributes
+package attr
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/wildmatch"
+)
+
+// State is how an attribute stands on a path.
+type State int
+
+const (
+	Unspecified State = iota
+	Set               // "attr"
+	Unset             // "-attr"
+	Value             // "attr=value"
+)
+
+// Attribute is the state of one attribute, with its value if it has one.
+type Attribute struct {
+	State State
+	Value string
+}
+
+// assignment is one "attr", "-attr", "!attr" or "attr=value" of a line.
+type assignment struct {
+	name string
+	attr Attribute
+}
+
+// rule is one line of an attributes file: a pattern and what it assigns.
+type rule struct {
+	pattern  string
+	base     string // directory of the file, relative to the work tree
+	anchored bool   // contains a slash, so it matches the path from base
+	attrs    []assignment
+}
+
+// binaryMacro is the built-in "binary" macro.
+var binaryMacro = []assignment{
+	{"diff", Attribute{State: Unset}},
+	{"merge", Attribute{State: Unset}},
+	{"text", Attribute{State: Unset}},
+}
+
+// parseRules reads the lines of one attributes file. Macros are only
+// defined by the files that apply to the whole tree.
+func parseRules(data []byte, base string, macros map[string][]assignment) []*rule {
+	rules := []*rule{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\xef\xbb\xbf")
+			first = false
+		}
+		line = strings.TrimLeft(line, " \t\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var pattern string
+		if line[0] == '"' {
+			unquoted, rest, ok := unquote(line)
+			if !ok {
+				continue
+			}
+			pattern, line = unquoted, rest
+		} else {
+			end := strings.IndexAny(line, " \t\r")
+			if end < 0 {
+				end = len(line)
+			}
+			pattern, line = line[:end], line[end:]
+		}
+		attrs := []assignment{}
+		for _, word := range strings.Fields(line) {
+			a := assignment{name: word, attr: Attribute{State: Set}}
+			switch {
+			case word[0] == '-':
+				a = assignment{name: word[1:], attr: Attribute{State: Unset}}
+			case word[0] == '!':
+				a = assignment{name: word[1:], attr: Attribute{State: Unspecified}}
+			case strings.Contains(word, "="):
+				i := strings.IndexByte(word, '=')
+				a = assignment{name: word[:i], attr: Attribute{State: Value, Value: word[i+1:]}}
+			}
+			attrs = append(attrs, a)
+		}
+		if strings.HasPrefix(pattern, "[attr]") {
+			if macros != nil {
+				macros[strings.TrimPrefix(pattern, "[attr]")] = attrs
+			}
+			continue
+		}
+		// Negative patterns and directory-only ones never match files.
+		if pattern == "" || pattern[0] == '!' || strings.HasSuffix(pattern, "/") {
+			continue
+		}
+		r := &rule{pattern: pattern, base: base, attrs: attrs}
+		if strings.Contains(pattern, "/") {
+			r.anchored = true
+			r.pattern = strings.TrimPrefix(pattern, "/")
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// unquote reads a C-quoted pattern at the start of line.
+func unquote(line string) (string, string, bool) {
+	var b strings.Builder
+	for i := 1; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"':
+			return b.String(), line[i+1:], true
+		case c == '\\' && i+1 < len(line):
+			i++
+			switch e := line[i]; e {
+			case 'a':
+				b.WriteByte('\a')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'v':
+				b.WriteByte('\v')
+			default:
+				if e >= '0' && e <= '3' && i+2 < len(line) {
+					b.WriteByte((e-'0')<<6 | (line[i+1]-'0')<<3 | (line[i+2] - '0'))
+					i += 2
+				} else {
+					b.WriteByte(e)
+				}
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", false
+}
+
+func (r *rule) match(relPath string, flags int) bool {
+	if r.base != "" {
+		if !strings.HasPrefix(relPath, r.base+"/") {
+			return false
+		}
+		relPath = relPath[len(r.base)+1:]
+	}
+	if !r.anchored {
+		return wildmatch.Match(r.pattern, path.Base(relPath), flags)
+	}
+	return wildmatch.Match(r.pattern, relPath, flags|wildmatch.Pathname)
+}
+
+// Matcher looks up the attributes of paths. info/attributes wins over
+// the .gitattributes files, the deepest of which wins, and those over
+// core.attributesFile. Within a file the last matching line wins.
+type Matcher struct {
+	workTree string
+	flags    int
+	global   []*rule // core.attributesFile
+	info     []*rule // info/attributes
+	perDir   map[string][]*rule
+	macros   map[string][]assignment
+}
+
+// New loads the attributes files outside the work tree. The
+// .gitattributes files are read as paths are looked up; workTree may be
+// empty for a bare repository, which has none.
+func New(workTree, gitDir string, cfg *config.Config) (*Matcher, error) {
+	m := &Matcher{
+		workTree: workTree,
+		perDir:   map[string][]*rule{},
+		macros:   map[string][]assignment{"binary": binaryMacro},
+	}
+	if ignoreCase, _ := cfg.Bool("core.ignorecase", false); ignoreCase {
+		m.flags = wildmatch.CaseFold
+	}
+	attributesFile, ok := cfg.Path("core.attributesFile")
+	if !ok {
+		attributesFile = defaultAttributesFile()
+	}
+	for _, f := range []struct {
+		file  string
+		rules *[]*rule
+	}{{attributesFile, &m.global}, {filepath.Join(gitDir, "info", "attributes"), &m.info}} {
+		if f.file == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(f.file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		*f.rules = parseRules(data, "", m.macros)
+	}
+	// The top-level .gitattributes may define macros too.
+	m.dirRules("")
+	return m, nil
+}
+
+// defaultAttributesFile is $XDG_CONFIG_HOME/git/attributes.
+func defaultAttributesFile() string {
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		xdg = filepath.Join(home, ".config")
+	}
+	return filepath.Join(xdg, "git", "attributes")
+}
+
+func (m *Matcher) dirRules(dir string) []*rule {
+	if rules, ok := m.perDir[dir]; ok {
+		return rules
+	}
+	var rules []*rule
+	if m.workTree != "" {
+		file := path.Join(dir, ".gitattributes")
+		data, err := ioutil.ReadFile(filepath.Join(m.workTree, filepath.FromSlash(file)))
+		if err == nil {
+			var macros map[string][]assignment
+			if dir == "" {
+				macros = m.macros
+			}
+			rules = parseRules(data, dir, macros)
+		}
+	}
+	m.perDir[dir] = rules
+	return rules
+}
+
+// lookup finds name among attrs, last first, expanding the macros they
+// set; depth guards against macros that set each other.
+func (m *Matcher) lookup(attrs []assignment, name string, depth int) (Attribute, bool) {
+	for i := len(attrs) - 1; i >= 0; i-- {
+		a := attrs[i]
+		if a.name == name {
+			return a.attr, true
+		}
+		if macro, ok := m.macros[a.name]; ok && a.attr.State == Set && depth < 8 {
+			if attr, ok := m.lookup(macro, name, depth+1); ok {
+				return attr, true
+			}
+		}
+	}
+	return Attribute{}, false
+}
+
+// Get returns attribute name of relPath, a slash-separated path relative
+// to the top of the work tree.
+func (m *Matcher) Get(relPath, name string) Attribute {
+	relPath = strings.Trim(relPath, "/")
+	stack := [][]*rule{m.info}
+	dir := path.Dir(relPath)
+	for {
+		if dir == "." {
+			dir = ""
+		}
+		stack = append(stack, m.dirRules(dir))
+		if dir == "" {
+			break
+		}
+		dir = path.Dir(dir)
+	}
+	stack = append(stack, m.global)
+	for _, rules := range stack {
+		for i := len(rules) - 1; i >= 0; i-- {
+			if !rules[i].match(relPath, m.flags) {
+				continue
+			}
+			if attr, ok := m.lookup(rules[i].attrs, name, 0); ok {
+				return attr
+			}
+		}
+	}
+	return Attribute{}
+}
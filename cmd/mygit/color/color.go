@@ -0,0 +1,185 @@
+// Package color turns git color settings such as "bold red" into ANSI
+// escape sequences, and decides whether output is colored at all.
+// ref: https://git-scm.com/docs/git-config#Documentation/git-config.txt-color
+package color
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+)
+
+// Reset ends a colored span.
+const Reset = "\x1b[m"
+
+// names are the eight basic colors, numbered as ANSI does.
+var names = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// attributes maps attribute names to their SGR parameters.
+var attributes = map[string]int{
+	"bold": 1, "dim": 2, "italic": 3, "ul": 4, "blink": 5, "reverse": 7, "strike": 9,
+}
+
+// value is one parsed color: empty, an ANSI color, a 256-color index or
+// an RGB triple.
+type value struct {
+	kind    int // 0 none, 1 ansi, 2 256, 3 rgb
+	n       int // ansi color, plus 60 for bright ones, or the index
+	r, g, b int
+}
+
+func (v value) output(background bool) string {
+	base := 30
+	if background {
+		base = 40
+	}
+	switch v.kind {
+	case 1:
+		return strconv.Itoa(base + v.n)
+	case 2:
+		return fmt.Sprintf("%d;5;%d", base+8, v.n)
+	default:
+		return fmt.Sprintf("%d;2;%d;%d;%d", base+8, v.r, v.g, v.b)
+	}
+}
+
+// parseValue reads one color word: a name, "bright" and a name, "normal",
+// "default", a number below 256 or "#rrggbb".
+func parseValue(word string) (value, bool) {
+	if word == "normal" {
+		return value{}, true
+	}
+	if word == "default" {
+		return value{kind: 1, n: 9}, true
+	}
+	bright := strings.HasPrefix(word, "bright")
+	name := strings.TrimPrefix(word, "bright")
+	for i, n := range names {
+		if name == n {
+			if bright {
+				i += 60
+			}
+			return value{kind: 1, n: i}, true
+		}
+	}
+	if strings.HasPrefix(word, "#") && len(word) == 7 {
+		rgb, err := strconv.ParseUint(word[1:], 16, 32)
+		if err != nil {
+			return value{}, false
+		}
+		return value{kind: 3, r: int(rgb >> 16), g: int(rgb >> 8 & 0xff), b: int(rgb & 0xff)}, true
+	}
+	n, err := strconv.Atoi(word)
+	if err != nil || n < -1 || n > 255 {
+		return value{}, false
+	}
+	switch {
+	case n == -1:
+		return value{}, true
+	case n < 8:
+		return value{kind: 1, n: n}, true
+	}
+	return value{kind: 2, n: n}, true
+}
+
+// Parse turns a color setting into its escape sequence: up to two colors,
+// foreground then background, and any attributes, each of which may be
+// negated with "no" or "no-". An empty setting is no escape at all.
+func Parse(setting string) (string, error) {
+	var fg, bg value
+	colors := 0
+	attrs := uint64(0)
+	reset := false
+	for _, word := range strings.Fields(strings.ToLower(setting)) {
+		if word == "reset" {
+			reset = true
+			continue
+		}
+		if v, ok := parseValue(word); ok {
+			switch colors {
+			case 0:
+				fg = v
+			case 1:
+				bg = v
+			default:
+				return "", fmt.Errorf("invalid color value: %s", setting)
+			}
+			colors++
+			continue
+		}
+		negate := false
+		name := word
+		if strings.HasPrefix(name, "no") {
+			negate = true
+			name = strings.TrimPrefix(strings.TrimPrefix(name, "no"), "-")
+		}
+		n, ok := attributes[name]
+		if !ok {
+			return "", fmt.Errorf("invalid color value: %s", setting)
+		}
+		if negate {
+			// 21 is double underline, so bold is turned off by 22.
+			if n == 1 {
+				n = 2
+			}
+			n += 20
+		}
+		attrs |= 1 << uint(n)
+	}
+	if !reset && attrs == 0 && fg.kind == 0 && bg.kind == 0 {
+		return "", nil
+	}
+	parts := []string{}
+	if reset {
+		parts = append(parts, "")
+	}
+	for i := 0; attrs != 0; i++ {
+		if attrs&(1<<uint(i)) != 0 {
+			attrs &^= 1 << uint(i)
+			parts = append(parts, strconv.Itoa(i))
+		}
+	}
+	if fg.kind != 0 {
+		parts = append(parts, fg.output(false))
+	}
+	if bg.kind != 0 {
+		parts = append(parts, bg.output(true))
+	}
+	return "\x1b[" + strings.Join(parts, ";") + "m", nil
+}
+
+// Use decides whether to color output from a setting such as --color or
+// color.ui takes: "always", "never", or "auto", which colors terminals
+// unless TERM is "dumb". Booleans count as "auto" and "never".
+func Use(setting string, out *os.File) bool {
+	switch strings.ToLower(setting) {
+	case "always":
+		return true
+	case "never":
+		return false
+	case "auto", "":
+	default:
+		if on, err := config.ParseBool(setting, false); err != nil || !on {
+			return false
+		}
+	}
+	if term := os.Getenv("TERM"); term == "dumb" {
+		return false
+	}
+	info, err := out.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Setting looks up whether a command colors its output: the first of
+// keys that is set, then color.ui, which defaults to "auto".
+func Setting(cfg *config.Config, keys ...string) string {
+	for _, key := range append(keys, "color.ui") {
+		if value, ok := cfg.Get(key); ok {
+			return value
+		}
+	}
+	return "auto"
+}
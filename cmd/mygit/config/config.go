@@ -0,0 +1,535 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/wildmatch"
+)
+
+// Scope is where a value comes from. Later scopes override earlier ones.
+type Scope int
+
+const (
+	ScopeSystem Scope = iota
+	ScopeGlobal
+	ScopeLocal
+	ScopeWorktree
+	ScopeCommand
+)
+
+func (s Scope) String() string {
+	switch s {
+	case ScopeSystem:
+		return "system"
+	case ScopeGlobal:
+		return "global"
+	case ScopeLocal:
+		return "local"
+	case ScopeWorktree:
+		return "worktree"
+	default:
+		return "command"
+	}
+}
+
+var (
+	ErrMultipleValues = errors.New("key has multiple values")
+	ErrInvalidKey     = errors.New("invalid key")
+)
+
+const maxIncludeDepth = 10
+
+// Config is the merged view of every config file, in priority order.
+type Config struct {
+	Entries    []*Entry
+	gitDir     string
+	noIncludes bool
+}
+
+// Load reads the system, global, local, worktree and command line
+// configuration. gitDir may be empty outside of a repository.
+// ref: https://git-scm.com/docs/git-config#FILES
+func Load(gitDir string) (*Config, error) {
+	return load(&Config{gitDir: gitDir})
+}
+
+// LoadNoIncludes is Load without following include.path and
+// includeIf.*.path, for "config --no-includes".
+func LoadNoIncludes(gitDir string) (*Config, error) {
+	return load(&Config{gitDir: gitDir, noIncludes: true})
+}
+
+// LoadFile reads a single file and the files it includes, for
+// "config --file <file> --includes".
+func LoadFile(path string, scope Scope, gitDir string) (*Config, error) {
+	c := &Config{gitDir: gitDir}
+	if err := c.loadFile(path, scope, 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func load(c *Config) (*Config, error) {
+	gitDir := c.gitDir
+	if !envBool("GIT_CONFIG_NOSYSTEM") {
+		if err := c.loadFile(SystemPath(), ScopeSystem, 0); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range GlobalPaths() {
+		if err := c.loadFile(path, ScopeGlobal, 0); err != nil {
+			return nil, err
+		}
+	}
+	if gitDir != "" {
+		if err := c.loadFile(filepath.Join(gitDir, "config"), ScopeLocal, 0); err != nil {
+			return nil, err
+		}
+		if worktreeConfig, _ := c.Bool("extensions.worktreeconfig", false); worktreeConfig {
+			if err := c.loadFile(filepath.Join(gitDir, "config.worktree"), ScopeWorktree, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	params, err := CommandLineParameters()
+	if err != nil {
+		return nil, err
+	}
+	for _, param := range params {
+		key, value, noValue := param, "", true
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			key, value, noValue = param[:i], param[i+1:], false
+		}
+		section, sub, name, err := ParseKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("bogus config parameter: %s", param)
+		}
+		c.add(&Entry{Section: section, Subsection: sub, Name: name, Value: value, NoValue: noValue,
+			Scope: ScopeCommand, Origin: "command line:"}, 0)
+	}
+	return c, nil
+}
+
+// SystemPath is $GIT_CONFIG_SYSTEM or /etc/gitconfig.
+func SystemPath() string {
+	if path := os.Getenv("GIT_CONFIG_SYSTEM"); path != "" {
+		return path
+	}
+	return "/etc/gitconfig"
+}
+
+// GlobalPaths lists the per-user files in increasing priority:
+// $XDG_CONFIG_HOME/git/config and ~/.gitconfig, or $GIT_CONFIG_GLOBAL.
+func GlobalPaths() []string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return []string{path}
+	}
+	paths := []string{}
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	home, _ := os.UserHomeDir()
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	if xdg != "" {
+		paths = append(paths, filepath.Join(xdg, "git", "config"))
+	}
+	if home != "" {
+		paths = append(paths, filepath.Join(home, ".gitconfig"))
+	}
+	return paths
+}
+
+// GlobalPath is the file "config --global" writes to.
+func GlobalPath() string {
+	paths := GlobalPaths()
+	return paths[len(paths)-1]
+}
+
+// CommandLineParameters returns the "key=value" pairs given with -c,
+// which are passed down in GIT_CONFIG_PARAMETERS, followed by the
+// GIT_CONFIG_COUNT/GIT_CONFIG_KEY_<n>/GIT_CONFIG_VALUE_<n> pairs.
+func CommandLineParameters() ([]string, error) {
+	params, err := parseParameters(os.Getenv("GIT_CONFIG_PARAMETERS"))
+	if err != nil {
+		return nil, err
+	}
+	if count := os.Getenv("GIT_CONFIG_COUNT"); count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bogus count in GIT_CONFIG_COUNT")
+		}
+		for i := 0; i < n; i++ {
+			key, ok := os.LookupEnv(fmt.Sprintf("GIT_CONFIG_KEY_%d", i))
+			if !ok {
+				return nil, fmt.Errorf("missing config key GIT_CONFIG_KEY_%d", i)
+			}
+			value, ok := os.LookupEnv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", i))
+			if !ok {
+				return nil, fmt.Errorf("missing config value GIT_CONFIG_VALUE_%d", i)
+			}
+			params = append(params, key+"="+value)
+		}
+	}
+	return params, nil
+}
+
+// AddCommandLineParameter appends a -c option to GIT_CONFIG_PARAMETERS,
+// single-quoted like git so that child processes see it too.
+func AddCommandLineParameter(param string) error {
+	if i := strings.IndexByte(param, '='); i == 0 {
+		return fmt.Errorf("bogus config parameter: %s", param)
+	}
+	quoted := "'" + strings.ReplaceAll(param, "'", `'\''`) + "'"
+	if existing := os.Getenv("GIT_CONFIG_PARAMETERS"); existing != "" {
+		quoted = existing + " " + quoted
+	}
+	return os.Setenv("GIT_CONFIG_PARAMETERS", quoted)
+}
+
+func parseParameters(env string) ([]string, error) {
+	params := []string{}
+	var current strings.Builder
+	inParam, quote := false, false
+	for i := 0; i < len(env); i++ {
+		c := env[i]
+		switch {
+		case quote && c == '\'':
+			quote = false
+		case quote:
+			current.WriteByte(c)
+		case c == '\'':
+			quote, inParam = true, true
+		case c == '\\' && i+1 < len(env):
+			i++
+			current.WriteByte(env[i])
+			inParam = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inParam {
+				params = append(params, current.String())
+				current.Reset()
+				inParam = false
+			}
+		default:
+			current.WriteByte(c)
+			inParam = true
+		}
+	}
+	if quote {
+		return nil, errors.New("bogus format in GIT_CONFIG_PARAMETERS")
+	}
+	if inParam {
+		params = append(params, current.String())
+	}
+	return params, nil
+}
+
+func (c *Config) loadFile(path string, scope Scope, depth int) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	f, err := ReadFile(path, scope)
+	if err != nil {
+		return err
+	}
+	for _, e := range f.Entries {
+		if err := c.add(e, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add appends an entry and follows include.path and includeIf.*.path.
+// ref: https://git-scm.com/docs/git-config#_includes
+func (c *Config) add(e *Entry, depth int) error {
+	c.Entries = append(c.Entries, e)
+	if e.Name != "path" || e.NoValue || c.noIncludes {
+		return nil
+	}
+	if e.Section == "include" && e.Subsection == "" {
+		return c.include(e, depth)
+	}
+	if e.Section == "includeif" && c.includeCondition(e) {
+		return c.include(e, depth)
+	}
+	return nil
+}
+
+func (c *Config) include(e *Entry, depth int) error {
+	if depth >= maxIncludeDepth {
+		return fmt.Errorf("exceeded maximum include depth (%d) while including %s", maxIncludeDepth, e.Value)
+	}
+	path := ExpandPath(e.Value)
+	if !filepath.IsAbs(path) {
+		// Files given with --file have the command scope too.
+		if e.Origin == "command line:" {
+			return fmt.Errorf("relative config includes must come from files")
+		}
+		path = filepath.Join(filepath.Dir(e.Origin), path)
+	}
+	return c.loadFile(path, e.Scope, depth+1)
+}
+
+func (c *Config) includeCondition(e *Entry) bool {
+	cond := e.Subsection
+	switch {
+	case strings.HasPrefix(cond, "gitdir:"):
+		return c.matchGitDir(e, strings.TrimPrefix(cond, "gitdir:"), 0)
+	case strings.HasPrefix(cond, "gitdir/i:"):
+		return c.matchGitDir(e, strings.TrimPrefix(cond, "gitdir/i:"), wildmatch.CaseFold)
+	case strings.HasPrefix(cond, "onbranch:"):
+		return c.matchBranch(strings.TrimPrefix(cond, "onbranch:"))
+	}
+	return false
+}
+
+func (c *Config) matchGitDir(e *Entry, pattern string, flags int) bool {
+	if c.gitDir == "" {
+		return false
+	}
+	pattern = ExpandPath(pattern)
+	if strings.HasPrefix(pattern, "./") {
+		pattern = filepath.Join(filepath.Dir(e.Origin), pattern[2:])
+	} else if !filepath.IsAbs(pattern) {
+		pattern = "**/" + pattern
+	}
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	gitDir := filepath.ToSlash(c.gitDir)
+	if wildmatch.Match(filepath.ToSlash(pattern), gitDir, flags|wildmatch.Pathname) {
+		return true
+	}
+	if resolved, err := filepath.EvalSymlinks(c.gitDir); err == nil {
+		return wildmatch.Match(filepath.ToSlash(pattern), filepath.ToSlash(resolved), flags|wildmatch.Pathname)
+	}
+	return false
+}
+
+func (c *Config) matchBranch(pattern string) bool {
+	if c.gitDir == "" {
+		return false
+	}
+	head, err := ioutil.ReadFile(filepath.Join(c.gitDir, "HEAD"))
+	if err != nil || !strings.HasPrefix(string(head), "ref: refs/heads/") {
+		return false
+	}
+	branch := strings.TrimSpace(strings.TrimPrefix(string(head), "ref: refs/heads/"))
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return wildmatch.Match(pattern, branch, wildmatch.Pathname)
+}
+
+// ParseKey splits "section.subsection.name" into its canonical parts.
+func ParseKey(key string) (string, string, string, error) {
+	first := strings.IndexByte(key, '.')
+	last := strings.LastIndexByte(key, '.')
+	if first <= 0 || last == len(key)-1 {
+		return "", "", "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+	section := strings.ToLower(key[:first])
+	name := strings.ToLower(key[last+1:])
+	sub := ""
+	if first != last {
+		sub = key[first+1 : last]
+	}
+	for _, c := range section {
+		if !isKeyChar(int(c)) && c != '.' {
+			return "", "", "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+		}
+	}
+	if !('a' <= name[0] && name[0] <= 'z') {
+		return "", "", "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+	for _, c := range name {
+		if !isKeyChar(int(c)) {
+			return "", "", "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+		}
+	}
+	if strings.ContainsAny(sub, "\n\x00") {
+		return "", "", "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+	return section, sub, name, nil
+}
+
+// CanonicalKey lowercases the section and name but not the subsection.
+func CanonicalKey(key string) (string, error) {
+	section, sub, name, err := ParseKey(key)
+	if err != nil {
+		return "", err
+	}
+	return joinKey(section, sub, name), nil
+}
+
+func joinKey(section, sub, name string) string {
+	if sub == "" {
+		return section + "." + name
+	}
+	return section + "." + sub + "." + name
+}
+
+// Get returns the value with the highest priority.
+func (c *Config) Get(key string) (string, bool) {
+	e := c.Last(key)
+	if e == nil {
+		return "", false
+	}
+	return e.Value, true
+}
+
+// Last returns the entry with the highest priority for key.
+func (c *Config) Last(key string) *Entry {
+	all := c.All(key)
+	if len(all) == 0 {
+		return nil
+	}
+	return all[len(all)-1]
+}
+
+// All returns every entry of a multi-valued key, lowest priority first.
+func (c *Config) All(key string) []*Entry {
+	canonical, err := CanonicalKey(key)
+	if err != nil {
+		return nil
+	}
+	found := []*Entry{}
+	for _, e := range c.Entries {
+		if e.Key() == canonical {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// GetAll returns the values of a multi-valued key.
+func (c *Config) GetAll(key string) []string {
+	values := []string{}
+	for _, e := range c.All(key) {
+		values = append(values, e.Value)
+	}
+	return values
+}
+
+// Bool returns key as a boolean, or def when it isn't set.
+func (c *Config) Bool(key string, def bool) (bool, error) {
+	e := c.Last(key)
+	if e == nil {
+		return def, nil
+	}
+	return ParseBool(e.Value, e.NoValue)
+}
+
+// Int returns key as an integer with an optional k, m or g suffix.
+func (c *Config) Int(key string, def int64) (int64, error) {
+	value, ok := c.Get(key)
+	if !ok {
+		return def, nil
+	}
+	return ParseInt(value)
+}
+
+// Path returns key with a leading "~/" expanded.
+func (c *Config) Path(key string) (string, bool) {
+	value, ok := c.Get(key)
+	if !ok {
+		return "", false
+	}
+	return ExpandPath(value), true
+}
+
+// Subsections lists the distinct subsections of a section, in order.
+func (c *Config) Subsections(section string) []string {
+	section = strings.ToLower(section)
+	seen := map[string]bool{}
+	subs := []string{}
+	for _, e := range c.Entries {
+		if e.Section == section && e.Subsection != "" && !seen[e.Subsection] {
+			seen[e.Subsection] = true
+			subs = append(subs, e.Subsection)
+		}
+	}
+	return subs
+}
+
+func ParseBool(value string, noValue bool) (bool, error) {
+	if noValue {
+		return true, nil
+	}
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	if n, err := ParseInt(value); err == nil {
+		return n != 0, nil
+	}
+	return false, fmt.Errorf("bad boolean config value '%s'", value)
+}
+
+func ParseInt(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	factor := int64(1)
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'k', 'K':
+			factor = 1 << 10
+		case 'm', 'M':
+			factor = 1 << 20
+		case 'g', 'G':
+			factor = 1 << 30
+		}
+		if factor != 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad numeric config value '%s'", value)
+	}
+	return n * factor, nil
+}
+
+func ExpandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+func envBool(name string) bool {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return false
+	}
+	b, err := ParseBool(value, false)
+	return err == nil && b
+}
+
+// Lookup returns the value of section.key in the single file at path.
+// A missing file is not an error.
+func Lookup(path, section, key string) (string, bool, error) {
+	f, err := ReadFile(path, ScopeLocal)
+	if err != nil {
+		return "", false, err
+	}
+	value, found := "", false
+	for _, e := range f.Entries {
+		if e.Section == strings.ToLower(section) && e.Subsection == "" && e.Name == strings.ToLower(key) {
+			value, found = e.Value, true
+			if e.NoValue {
+				value = "true"
+			}
+		}
+	}
+	return value, found, nil
+}
@@ -0,0 +1,684 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/lockfile"
+)
+
+// Entry is one "name = value" line of a config file.
+type Entry struct {
+	Section    string // lowercased
+	Subsection string // case-sensitive, "" when absent
+	Name       string // lowercased
+	Value      string
+	NoValue    bool // "name" without "=", which means true for booleans
+	Scope      Scope
+	Origin     string // file path, or "command line:"
+
+	start, end int // byte range in the file, end is after the newline
+}
+
+// Key returns the canonical "section.subsection.name" form.
+func (e *Entry) Key() string {
+	return joinKey(e.Section, e.Subsection, e.Name)
+}
+
+type sectionHeader struct {
+	name, sub  string
+	start, end int // byte range of "[...]"
+}
+
+// File is a parsed config file. It keeps the raw text so that edits
+// leave comments and formatting alone.
+type File struct {
+	Path    string
+	Scope   Scope
+	Entries []*Entry
+
+	data     []byte
+	sections []sectionHeader
+	// comments are the offsets of the comments outside values, which
+	// keep a section from being removed with its last entry.
+	comments []int
+}
+
+// ReadFile parses the file at path. A missing file is an empty config.
+func ReadFile(path string, scope Scope) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f := &File{Path: path, Scope: scope}
+	if err := f.parse(data); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Parse parses config text that doesn't come from a file on disk.
+func Parse(data []byte, origin string, scope Scope) (*File, error) {
+	f := &File{Path: origin, Scope: scope}
+	if err := f.parse(data); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+type parser struct {
+	data []byte
+	pos  int
+	line int
+}
+
+func (p *parser) peek() int {
+	if p.pos >= len(p.data) {
+		return -1
+	}
+	if p.data[p.pos] == '\r' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '\n' {
+		return '\n'
+	}
+	return int(p.data[p.pos])
+}
+
+func (p *parser) next() int {
+	c := p.peek()
+	if c < 0 {
+		return '\n' // EOF ends the last line.
+	}
+	if p.data[p.pos] == '\r' && c == '\n' {
+		p.pos++
+	}
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func isSpace(c int) bool {
+	return c == ' ' || c == '\t' || c == '\v' || c == '\f' || c == '\r'
+}
+
+func isKeyChar(c int) bool {
+	return c == '-' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// parse follows git's config.c.
+// ref: https://git-scm.com/docs/git-config#_syntax
+func (f *File) parse(data []byte) error {
+	f.data = data
+	f.Entries = nil
+	f.sections = nil
+	f.comments = nil
+	p := &parser{data: data, line: 1}
+	if bytes.HasPrefix(data, []byte("\xef\xbb\xbf")) {
+		p.pos = 3
+	}
+	section, sub := "", ""
+	for {
+		c := p.peek()
+		if c < 0 {
+			return nil
+		}
+		switch {
+		case c == '\n' || isSpace(c):
+			p.next()
+		case c == '#' || c == ';':
+			f.comments = append(f.comments, p.pos)
+			for c := p.next(); c != '\n'; c = p.next() {
+			}
+		case c == '[':
+			start := p.pos
+			var err error
+			if section, sub, err = p.parseSectionHeader(); err != nil {
+				return f.errorAt(p, err)
+			}
+			f.sections = append(f.sections, sectionHeader{name: section, sub: sub, start: start, end: p.pos})
+		case isKeyChar(c) && ('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'):
+			if section == "" {
+				return f.errorAt(p, errors.New("key outside of any section"))
+			}
+			entry, err := p.parseEntry()
+			if err != nil {
+				return f.errorAt(p, err)
+			}
+			entry.Section, entry.Subsection = section, sub
+			entry.Scope, entry.Origin = f.Scope, f.Path
+			f.Entries = append(f.Entries, entry)
+		default:
+			return f.errorAt(p, errors.New("unexpected character"))
+		}
+	}
+}
+
+func (f *File) errorAt(p *parser, err error) error {
+	return fmt.Errorf("bad config line %d in file %s: %v", p.line, f.Path, err)
+}
+
+func (p *parser) parseSectionHeader() (string, string, error) {
+	p.next() // '['
+	name := []byte{}
+	for {
+		c := p.next()
+		if c == '\n' {
+			return "", "", errors.New("unterminated section header")
+		}
+		if c == ']' {
+			// Deprecated [section.subsection] syntax lowercases both parts.
+			s := strings.ToLower(string(name))
+			if i := strings.IndexByte(s, '.'); i >= 0 {
+				return s[:i], s[i+1:], nil
+			}
+			return s, "", nil
+		}
+		if isSpace(c) {
+			break
+		}
+		if !isKeyChar(c) && c != '.' {
+			return "", "", errors.New("invalid section name")
+		}
+		name = append(name, byte(c))
+	}
+	for isSpace(p.peek()) {
+		p.next()
+	}
+	if p.next() != '"' {
+		return "", "", errors.New("invalid section header")
+	}
+	sub := []byte{}
+	for {
+		c := p.next()
+		if c == '\n' {
+			return "", "", errors.New("unterminated subsection")
+		}
+		if c == '"' {
+			break
+		}
+		if c == '\\' {
+			c = p.next()
+			if c == '\n' {
+				return "", "", errors.New("unterminated subsection")
+			}
+		}
+		sub = append(sub, byte(c))
+	}
+	if p.next() != ']' {
+		return "", "", errors.New("invalid section header")
+	}
+	return strings.ToLower(string(name)), string(sub), nil
+}
+
+func (p *parser) parseEntry() (*Entry, error) {
+	entry := &Entry{start: p.pos}
+	name := []byte{}
+	for isKeyChar(p.peek()) {
+		name = append(name, byte(p.next()))
+	}
+	entry.Name = strings.ToLower(string(name))
+	for isSpace(p.peek()) {
+		p.next()
+	}
+	c := p.peek()
+	if c < 0 || c == '\n' || c == '#' || c == ';' {
+		entry.NoValue = true
+		for c := p.next(); c != '\n'; c = p.next() {
+		}
+		entry.end = p.pos
+		return entry, nil
+	}
+	if c != '=' {
+		return nil, errors.New("invalid key")
+	}
+	p.next()
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	entry.Value = value
+	entry.end = p.pos
+	return entry, nil
+}
+
+func (p *parser) parseValue() (string, error) {
+	value := []byte{}
+	quote, comment := false, false
+	spaces := 0
+	for {
+		c := p.next()
+		if c == '\n' {
+			if quote {
+				return "", errors.New("unterminated quote")
+			}
+			return string(value), nil
+		}
+		if comment {
+			continue
+		}
+		if isSpace(c) && !quote {
+			if len(value) > 0 {
+				spaces++
+			}
+			continue
+		}
+		if !quote && (c == ';' || c == '#') {
+			comment = true
+			continue
+		}
+		for ; spaces > 0; spaces-- {
+			value = append(value, ' ')
+		}
+		if c == '\\' {
+			switch c = p.next(); c {
+			case '\n':
+				continue
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'n':
+				c = '\n'
+			case '\\', '"':
+			default:
+				return "", errors.New("invalid escape sequence")
+			}
+			value = append(value, byte(c))
+			continue
+		}
+		if c == '"' {
+			quote = !quote
+			continue
+		}
+		value = append(value, byte(c))
+	}
+}
+
+// Bytes returns the current file contents.
+func (f *File) Bytes() []byte {
+	return f.data
+}
+
+// Save writes the file through a lock file.
+func (f *File) Save() error {
+	lock, err := lockfile.Acquire(f.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write(f.data); err != nil {
+		lock.Rollback()
+		return err
+	}
+	return lock.Commit()
+}
+
+func (f *File) find(section, sub, name string) []*Entry {
+	found := []*Entry{}
+	for _, e := range f.Entries {
+		if e.Section == section && e.Subsection == sub && e.Name == name {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func (f *File) splice(start, end int, text string) error {
+	data := make([]byte, 0, len(f.data)+len(text))
+	data = append(data, f.data[:start]...)
+	data = append(data, text...)
+	data = append(data, f.data[end:]...)
+	return f.parse(data)
+}
+
+// lineStart returns where the line containing pos begins if only
+// whitespace precedes pos on it, otherwise pos itself.
+func (f *File) lineStart(pos int) int {
+	i := pos
+	for i > 0 && (f.data[i-1] == ' ' || f.data[i-1] == '\t') {
+		i--
+	}
+	if i == 0 || f.data[i-1] == '\n' {
+		return i
+	}
+	return pos
+}
+
+func formatEntry(name, value string) string {
+	return fmt.Sprintf("\t%s = %s\n", name, quoteValue(value))
+}
+
+// quoteValue quotes a value so that it parses back unchanged.
+func quoteValue(value string) string {
+	needQuote := value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;")
+	var b strings.Builder
+	for _, c := range value {
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	if needQuote {
+		return `"` + b.String() + `"`
+	}
+	return b.String()
+}
+
+func formatSectionHeader(section, sub string) string {
+	if sub == "" {
+		return "[" + section + "]\n"
+	}
+	sub = strings.ReplaceAll(sub, `\`, `\\`)
+	sub = strings.ReplaceAll(sub, `"`, `\"`)
+	return fmt.Sprintf("[%s \"%s\"]\n", section, sub)
+}
+
+// keyCase returns the section and name of a valid key as they are
+// written, which new headers and entries keep.
+func keyCase(key string) (string, string) {
+	return key[:strings.IndexByte(key, '.')], key[strings.LastIndexByte(key, '.')+1:]
+}
+
+// Set replaces the value of key, or adds it when missing. Replacing
+// fails when the key has several values unless all is set, in which case
+// every value is replaced by a single one.
+func (f *File) Set(key, value string, all bool) error {
+	return f.SetMatching(key, value, nil, all)
+}
+
+// SetMatching is Set for the values of key accepted by match, nil
+// accepting all of them. Like git, the new value takes the place of the
+// last one replaced, and is added when none is.
+func (f *File) SetMatching(key, value string, match func(string) bool, all bool) error {
+	matched, err := f.findMatching(key, match)
+	if err != nil {
+		return err
+	}
+	if len(matched) > 1 && !all {
+		return ErrMultipleValues
+	}
+	if len(matched) == 0 {
+		return f.Add(key, value)
+	}
+	// Edit from the end, which leaves the offsets of the entries before
+	// in place.
+	e := matched[len(matched)-1]
+	start := f.lineStart(e.start)
+	_, name := keyCase(key)
+	text := formatEntry(name, value)
+	if start > 0 && f.data[start-1] != '\n' {
+		// The entry shares its line with a section header.
+		text = strings.TrimPrefix(text, "\t")
+	}
+	if err := f.splice(start, e.end, text); err != nil {
+		return err
+	}
+	for i := len(matched) - 2; i >= 0; i-- {
+		if err := f.removeEntry(matched[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findMatching returns the entries of key whose value match accepts.
+func (f *File) findMatching(key string, match func(string) bool) ([]*Entry, error) {
+	section, sub, name, err := ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	matched := []*Entry{}
+	for _, e := range f.find(section, sub, name) {
+		if match == nil || match(e.Value) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+// Add appends a value for key, after the last entry of its section.
+func (f *File) Add(key, value string) error {
+	section, sub, name, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+	pos := -1
+	for _, h := range f.sections {
+		if h.name == section && h.sub == sub {
+			pos = f.headerLineEnd(h)
+		}
+	}
+	for _, e := range f.Entries {
+		if e.Section == section && e.Subsection == sub {
+			pos = e.end
+		}
+	}
+	section, name = keyCase(key)
+	text := formatEntry(name, value)
+	if pos < 0 {
+		text = formatSectionHeader(section, sub) + text
+		pos = len(f.data)
+	}
+	if pos > 0 && f.data[pos-1] != '\n' {
+		text = "\n" + text
+	}
+	return f.splice(pos, pos, text)
+}
+
+func (f *File) headerLineEnd(h sectionHeader) int {
+	if i := bytes.IndexByte(f.data[h.end:], '\n'); i >= 0 {
+		return h.end + i + 1
+	}
+	return len(f.data)
+}
+
+// Unset removes key. Like Set, several values are only removed with all.
+// It reports whether anything was removed.
+func (f *File) Unset(key string, all bool) (bool, error) {
+	n, err := f.UnsetMatching(key, nil, all)
+	return n > 0, err
+}
+
+// UnsetMatching removes the values of key accepted by match, nil
+// accepting all of them, and returns how many it removed.
+func (f *File) UnsetMatching(key string, match func(string) bool, all bool) (int, error) {
+	matched, err := f.findMatching(key, match)
+	if err != nil {
+		return 0, err
+	}
+	if len(matched) > 1 && !all {
+		return 0, ErrMultipleValues
+	}
+	if err := f.removeEntries(matched); err != nil {
+		return 0, err
+	}
+	return len(matched), nil
+}
+
+func (f *File) removeEntry(e *Entry) error {
+	start, end := f.entryRange(e)
+	return f.splice(start, end, "")
+}
+
+// entryRange is what removing the entry takes out of the file.
+func (f *File) entryRange(e *Entry) (int, int) {
+	start := f.lineStart(e.start)
+	end := e.end
+	if start == e.start && start > 0 && f.data[start-1] != '\n' {
+		// Something else precedes it on the line, keep the line break.
+		if end > 0 && f.data[end-1] == '\n' {
+			end--
+		}
+	}
+	return start, end
+}
+
+// removeEntries removes entries, in file order, together with the
+// section headers they leave without entries.
+func (f *File) removeEntries(entries []*Entry) error {
+	type span struct{ start, end int }
+	spans := []span{}
+	for i := 0; i < len(entries); i++ {
+		if start, end, n, ok := f.emptiedSection(entries[i:]); ok {
+			spans = append(spans, span{start, end})
+			i += n - 1
+			continue
+		}
+		start, end := f.entryRange(entries[i])
+		spans = append(spans, span{start, end})
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	data := append([]byte(nil), f.data...)
+	for i := len(spans) - 1; i >= 0; i-- {
+		data = append(data[:spans[i].start], data[spans[i].end:]...)
+	}
+	return f.parse(data)
+}
+
+// emptiedSection reports the range of the section that removing the
+// first of entries leaves empty, and how many of entries go with it.
+// Like git's maybe_remove_section, it keeps the section when any
+// comment is in it or right before it, since the comment may be about
+// it. Repeated headers of the same section count as one.
+// ref: https://github.com/git/git/blob/master/config.c
+func (f *File) emptiedSection(entries []*Entry) (int, int, int, bool) {
+	const (
+		eventSection = iota
+		eventEntry
+		eventComment
+	)
+	type event struct {
+		kind, start, end int
+		keys             bool // a header of the section of entries
+		entry            *Entry
+	}
+	first := entries[0]
+	events := []event{}
+	for _, h := range f.sections {
+		keys := h.name == first.Section && h.sub == first.Subsection
+		events = append(events, event{kind: eventSection, start: h.start, end: f.headerLineEnd(h), keys: keys})
+	}
+	for _, e := range f.Entries {
+		events = append(events, event{kind: eventEntry, start: e.start, end: e.end, entry: e})
+	}
+	for _, pos := range f.comments {
+		events = append(events, event{kind: eventComment, start: pos})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].start < events[j].start })
+	k := 0
+	for events[k].entry != first {
+		k++
+	}
+
+	// The entry must be the first of its section, with no comment
+	// before it or its header.
+	i, sectionSeen := k, false
+backward:
+	for ; i > 0; i-- {
+		switch ev := events[i-1]; ev.kind {
+		case eventComment:
+			return 0, 0, 0, false
+		case eventEntry:
+			if !sectionSeen {
+				return 0, 0, 0, false
+			}
+			break backward
+		case eventSection:
+			if !ev.keys {
+				break backward
+			}
+			sectionSeen = true
+		}
+	}
+	start := 0
+	if i > 0 {
+		start = events[i-1].end
+	}
+
+	// The entries removed must be the last of the section, with no
+	// comment after them.
+	n, j := 1, k+1
+forward:
+	for ; j < len(events); j++ {
+		switch ev := events[j]; ev.kind {
+		case eventComment:
+			return 0, 0, 0, false
+		case eventSection:
+			if !ev.keys {
+				break forward
+			}
+		case eventEntry:
+			if n < len(entries) && ev.entry == entries[n] {
+				n++
+				continue
+			}
+			return 0, 0, 0, false
+		}
+	}
+	end := len(f.data)
+	if j < len(events) {
+		end = events[j].start
+	}
+	return start, end, n, true
+}
+
+// RemoveSection deletes every "[section "sub"]" block with its entries.
+// It reports whether the section existed.
+func (f *File) RemoveSection(section, sub string) (bool, error) {
+	section = strings.ToLower(section)
+	removed := false
+	for {
+		i := -1
+		for j, h := range f.sections {
+			if h.name == section && h.sub == sub {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return removed, nil
+		}
+		end := len(f.data)
+		if i+1 < len(f.sections) {
+			end = f.lineStart(f.sections[i+1].start)
+		}
+		if err := f.splice(f.lineStart(f.sections[i].start), end, ""); err != nil {
+			return removed, err
+		}
+		removed = true
+	}
+}
+
+// RenameSection rewrites the headers of a section, keeping its entries.
+func (f *File) RenameSection(section, sub, newSection, newSub string) (bool, error) {
+	section = strings.ToLower(section)
+	renamed := false
+	for i := len(f.sections) - 1; i >= 0; i-- {
+		h := f.sections[i]
+		if h.name != section || h.sub != sub {
+			continue
+		}
+		header := strings.TrimSuffix(formatSectionHeader(newSection, newSub), "\n")
+		if err := f.splice(h.start, h.end, header); err != nil {
+			return renamed, err
+		}
+		renamed = true
+	}
+	return renamed, nil
+}
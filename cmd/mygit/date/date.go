@@ -2,6 +2,9 @@ package date
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,26 +18,660 @@ func GetCommitDate() string {
 	return commitDate
 }
 
+// FormatNowTimezoneOffset is the current time as "<unix seconds> <+hhmm>",
+// the way commits record it.
 func FormatNowTimezoneOffset() string {
-	// 現在の日付と時刻を取得
-	currentTime := time.Now()
-	// Unixエポックからの経過秒数
-	epochSeconds := currentTime.Unix()
-	// タイムゾーンオフセット（秒数）
-	offsetSeconds := currentTime.UTC().Sub(currentTime).Seconds()
+	return Raw(time.Now())
+}
+
+// Raw formats t as "<unix seconds> <+hhmm>".
+func Raw(t time.Time) string {
+	return fmt.Sprintf("%d %s", t.Unix(), Offset(t))
+}
 
-	sign := "+"
-	if offsetSeconds < 0 {
-		sign = "-"
-		offsetSeconds = -offsetSeconds
+// Offset is the "+hhmm" offset of t. A time from ParseRaw keeps the text it
+// was recorded with, so an offset such as "-0000" is written back as is.
+func Offset(t time.Time) string {
+	name, offset := t.Zone()
+	if seconds, ok := parseOffset(name); ok && seconds == offset {
+		return name
 	}
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset/60%60)
+}
 
-	hours := int(offsetSeconds / 3600)
-	minutes := int((offsetSeconds - float64(hours)*3600) / 60)
+// parseOffset converts "+hhmm" to seconds east of UTC.
+func parseOffset(tz string) (int, bool) {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') || strings.Trim(tz[1:], "0123456789") != "" {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(tz[1:3])
+	minutes, _ := strconv.Atoi(tz[3:5])
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return offset, true
+}
 
-	formattedTimezoneOffset := fmt.Sprintf("%s%02d%02d", sign, hours, minutes)
-	// タイムゾーンオフセットを文字列に変換
-	timezoneOffsetStr := fmt.Sprintf("%d %s", int(epochSeconds), formattedTimezoneOffset)
+// ParseRaw parses "<unix seconds> <+hhmm>" as stored in commits and tags.
+// The time keeps the offset it was recorded with.
+func ParseRaw(raw string) (time.Time, error) {
+	fields := strings.Fields(raw)
+	if len(fields) != 2 {
+		return time.Time{}, fmt.Errorf("invalid date: %s", raw)
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: %s", raw)
+	}
+	tz := fields[1]
+	offset, ok := parseOffset(tz)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid timezone: %s", tz)
+	}
+	return time.Unix(seconds, 0).In(time.FixedZone(tz, offset)), nil
+}
 
-	return timezoneOffsetStr
+// Format renders a commit or tag time in one of git's --date styles.
+// ref: https://git-scm.com/docs/git-log#Documentation/git-log.txt---dateltformatgt
+func Format(t time.Time, style string) (string, error) {
+	if strings.HasPrefix(style, "format:") {
+		return Strftime(t, strings.TrimPrefix(style, "format:")), nil
+	}
+	if strings.HasPrefix(style, "format-local:") {
+		return Strftime(t.Local(), strings.TrimPrefix(style, "format-local:")), nil
+	}
+	if style == "local" {
+		style = "default-local"
+	}
+	local := strings.HasSuffix(style, "-local")
+	if local {
+		style = strings.TrimSuffix(style, "-local")
+		t = t.Local()
+	}
+	tz := Offset(t)
+	switch style {
+	case "relative":
+		return Relative(t, Now()), nil
+	case "human":
+		return Human(t, Now()), nil
+	case "", "default":
+		if local {
+			// The default format leaves out the zone of local times.
+			return t.Format("Mon Jan 2 15:04:05 2006"), nil
+		}
+		return t.Format("Mon Jan 2 15:04:05 2006") + " " + tz, nil
+	case "iso", "iso8601":
+		return t.Format("2006-01-02 15:04:05") + " " + tz, nil
+	case "iso-strict", "iso8601-strict":
+		return t.Format("2006-01-02T15:04:05") + tz[:3] + ":" + tz[3:], nil
+	case "rfc", "rfc2822":
+		return t.Format("Mon, 2 Jan 2006 15:04:05") + " " + tz, nil
+	case "short":
+		return t.Format("2006-01-02"), nil
+	case "raw":
+		return Raw(t), nil
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	}
+	return "", fmt.Errorf("unknown date format %s", style)
+}
+
+// Human is "--date=human": the default format with whatever is the same
+// as now left out, and relative times for today.
+func Human(t, now time.Time) string {
+	local := now.Local()
+	sameYear := t.Year() == local.Year()
+	hideDate := false
+	if sameYear && t.Month() == local.Month() {
+		switch {
+		case t.Day() == local.Day():
+			return Relative(t, now)
+		case t.Day() < local.Day() && t.Day()+5 > local.Day():
+			hideDate = true
+		}
+	}
+	hideTZ := Offset(t) == Offset(local) || !hideDate
+	var parts []string
+	if sameYear {
+		parts = append(parts, t.Format("Mon"))
+	}
+	if !hideDate {
+		parts = append(parts, t.Format("Jan 2"))
+	}
+	if sameYear {
+		parts = append(parts, t.Format("15:04"))
+	} else {
+		parts = append(parts, strconv.Itoa(t.Year()))
+	}
+	if !hideTZ {
+		parts = append(parts, Offset(t))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Parse reads a date in one of the formats git accepts for
+// GIT_AUTHOR_DATE and "--date": "<unix> <+hhmm>", "@<unix> [<+hhmm>]",
+// RFC 2822, ISO 8601, git's default format and numeric dates such as
+// "2005.04.07 22:13:13" or "04/07/2005 22:13". A date without a timezone
+// is in local time. The offset given is kept for Offset and Raw.
+// ref: https://git-scm.com/docs/git-commit#_date_formats
+func Parse(s string) (time.Time, error) {
+	text := strings.TrimSpace(s)
+	if t, err := ParseRaw(strings.TrimPrefix(text, "@")); err == nil {
+		return t, nil
+	}
+	if strings.HasPrefix(text, "@") {
+		if seconds, err := strconv.ParseInt(text[1:], 10, 64); err == nil {
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	for _, layout := range []string{
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"2 Jan 2006 15:04:05 -0700",
+		"Mon Jan 2 15:04:05 2006 -0700",
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02T15:04:05-07:00",
+		"2006-01-02T15:04:05Z07:00",
+		"2006-01-02T15:04:05-0700",
+	} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return withOffset(t), nil
+		}
+	}
+	for _, layout := range []string{
+		"Mon, 2 Jan 2006 15:04:05",
+		"Mon Jan 2 15:04:05 2006",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05",
+	} {
+		if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, ok := parseNumeric(text); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date format: %s", s)
+}
+
+// parseNumeric reads "<date> <hh:mm[:ss]> [<+hhmm>]", where the date is
+// three numbers separated by "-", "/" or ".". Like git's
+// match_multi_number, it tries yyyy-mm-dd, then mm/dd/yyyy unless the
+// separator is ".", then dd.mm.yyyy, then mm.dd.yyyy.
+// ref: https://github.com/git/git/blob/master/date.c
+func parseNumeric(text string) (time.Time, bool) {
+	fields := strings.Fields(text)
+	if len(fields) > 0 {
+		if i := strings.IndexByte(fields[0], 'T'); i > 0 {
+			fields = append([]string{fields[0][:i], fields[0][i+1:]}, fields[1:]...)
+		}
+	}
+	if len(fields) < 2 || len(fields) > 3 {
+		return time.Time{}, false
+	}
+	sep := strings.IndexAny(fields[0], "-/.")
+	if sep < 0 {
+		return time.Time{}, false
+	}
+	c := fields[0][sep]
+	nums, ok := numbers(fields[0], string(c), 3)
+	if !ok {
+		return time.Time{}, false
+	}
+	clock, ok := numbers(fields[1], ":", 3)
+	if !ok {
+		if clock, ok = numbers(fields[1], ":", 2); !ok {
+			return time.Time{}, false
+		}
+		clock = append(clock, 0)
+	}
+	if clock[0] > 24 || clock[1] > 59 || clock[2] > 60 {
+		return time.Time{}, false
+	}
+	loc := time.Local
+	if len(fields) == 3 {
+		tz := strings.Replace(fields[2], ":", "", 1)
+		offset, ok := parseOffset(tz)
+		if !ok {
+			return time.Time{}, false
+		}
+		loc = time.FixedZone(tz, offset)
+	}
+	n1, n2, n3 := nums[0], nums[1], nums[2]
+	var orders [][3]int // year, month, day
+	if n1 > 70 {
+		orders = append(orders, [3]int{n1, n2, n3}, [3]int{n1, n3, n2})
+	}
+	if c != '.' {
+		orders = append(orders, [3]int{n3, n1, n2})
+	}
+	orders = append(orders, [3]int{n3, n2, n1})
+	if c == '.' {
+		orders = append(orders, [3]int{n3, n1, n2})
+	}
+	for _, o := range orders {
+		year, month, day := o[0], o[1], o[2]
+		if month < 1 || month > 12 || day < 1 || day > 31 {
+			continue
+		}
+		switch {
+		case year >= 1970 && year < 2100:
+		case year > 70 && year < 100:
+			year += 1900
+		case year < 38:
+			year += 2000
+		default:
+			continue
+		}
+		return time.Date(year, time.Month(month), day, clock[0], clock[1], clock[2], 0, loc), true
+	}
+	return time.Time{}, false
+}
+
+// numbers splits s at sep into n non-negative numbers.
+func numbers(s, sep string, n int) ([]int, bool) {
+	parts := strings.Split(s, sep)
+	if len(parts) != n {
+		return nil, false
+	}
+	nums := make([]int, n)
+	for i, part := range parts {
+		if part == "" || strings.Trim(part, "0123456789") != "" {
+			return nil, false
+		}
+		nums[i], _ = strconv.Atoi(part)
+	}
+	return nums, true
+}
+
+// withOffset names the zone of t after its offset, as ParseRaw does.
+func withOffset(t time.Time) time.Time {
+	_, offset := t.Zone()
+	return t.In(time.FixedZone(Offset(t), offset))
+}
+
+var approxUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+var approxNumbers = map[string]int{
+	"last": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+// approxClock is the hour of the named times of day.
+var approxClock = map[string]int{
+	"midnight": 0,
+	"noon":     12,
+	"tea":      17,
+}
+
+var weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+var months = []string{"january", "february", "march", "april", "may", "june", "july", "august", "september", "october", "november", "december"}
+
+// Approx parses the relative and absolute dates accepted by "@{<date>}",
+// --since and expiry options. Anything Parse accepts is taken as is;
+// otherwise the words adjust now, as git's approxidate does: "yesterday",
+// "<n> <unit>s ago" (dots may stand in for spaces, and "ago" is implied),
+// "last friday", "noon", "midnight", "tea", "5pm", "10:30" and month
+// names. ISO 8601 dates without a timezone are in the local time of now.
+func Approx(s string, now time.Time) (time.Time, error) {
+	if t, err := Parse(s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(s), now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	t, num, touched := now, 0, false
+	// month is set right after a month name, whose day may follow; the
+	// others record which fields a date has set explicitly.
+	month, daySet, monthSet, yearSet := false, false, false, false
+	// setClock moves t to hour:00:00. Named times like "noon" go back a
+	// day when that hour hasn't come yet on the day t is at.
+	setClock := func(hour int, named bool) {
+		if named && t.Hour() < hour {
+			t = t.AddDate(0, 0, -1)
+		}
+		t = time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, t.Location())
+	}
+	setDate := func(year int, month time.Month, day int) {
+		t = time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	}
+	// pending places a number no word claimed, as git's pending_number
+	// does: it is the day of the month, else the month, else the year.
+	pending := func() {
+		n := num
+		num = 0
+		switch {
+		case n == 0:
+		case !daySet && n < 32:
+			setDate(t.Year(), t.Month(), n)
+			daySet = true
+		case !monthSet && n < 13:
+			setDate(t.Year(), time.Month(n), t.Day())
+			monthSet = true
+		case yearSet:
+		case n > 1969 && n < 2100:
+			setDate(n, t.Month(), t.Day())
+			yearSet = true
+		case n > 69 && n < 100:
+			setDate(1900+n, t.Month(), t.Day())
+			yearSet = true
+		case n < 38:
+			setDate(2000+n, t.Month(), t.Day())
+			yearSet = true
+		}
+	}
+	for _, word := range approxWords(strings.ToLower(s)) {
+		touched = true
+		afterMonth := month
+		month = false
+		if n, err := strconv.Atoi(word); err == nil {
+			if afterMonth && n >= 1 && n <= 31 {
+				setDate(t.Year(), t.Month(), n)
+				daySet = true
+				continue
+			}
+			pending()
+			num = n
+			continue
+		}
+		if n, ok := approxNumbers[word]; ok {
+			num = n
+			continue
+		}
+		if hour, ok := approxClock[word]; ok {
+			setClock(hour, true)
+			continue
+		}
+		if clock := strings.Split(word, ":"); len(clock) > 1 && len(clock) <= 3 {
+			parts := []int{0, 0, 0}
+			valid := true
+			for i, c := range clock {
+				n, err := strconv.Atoi(c)
+				valid = valid && err == nil
+				parts[i] = n
+			}
+			if valid && parts[0] < 24 && parts[1] < 60 && parts[2] < 60 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), parts[0], parts[1], parts[2], 0, t.Location())
+				continue
+			}
+		}
+		switch word {
+		case "now", "today", "ago", "at", "and":
+			continue
+		case "yesterday":
+			t = t.AddDate(0, 0, -1)
+			continue
+		case "am", "pm":
+			hour := num % 12
+			if word == "pm" {
+				hour += 12
+			}
+			if num > 0 && num <= 12 {
+				setClock(hour, false)
+				num = 0
+				continue
+			}
+			return time.Time{}, fmt.Errorf("invalid date format: %s", s)
+		}
+		if i := matchName(word, weekdays); i >= 0 {
+			// The most recent such day, today included; "last friday"
+			// and "2 fridays" skip back whole weeks.
+			back := (int(t.Weekday()) - i + 7) % 7
+			if num > 0 {
+				if back == 0 {
+					back = 7
+				}
+				back += 7 * (num - 1)
+			}
+			t = t.AddDate(0, 0, -back)
+			num = 0
+			continue
+		}
+		if i := matchName(word, months); i >= 0 {
+			day := t.Day()
+			if num > 0 && num <= 31 {
+				day, num, daySet = num, 0, true
+			}
+			setDate(t.Year(), time.Month(i+1), day)
+			if !yearSet && t.After(now) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			month, monthSet = true, true
+			continue
+		}
+		unit := strings.TrimSuffix(word, "s")
+		if num == 0 {
+			num = 1
+		}
+		switch unit {
+		case "month":
+			t = t.AddDate(0, -num, 0)
+		case "year":
+			t = t.AddDate(-num, 0, 0)
+		default:
+			d, ok := approxUnits[unit]
+			if !ok {
+				return time.Time{}, fmt.Errorf("invalid date format: %s", s)
+			}
+			t = t.Add(-time.Duration(num) * d)
+		}
+		num = 0
+	}
+	if !touched {
+		return time.Time{}, fmt.Errorf("invalid date format: %s", s)
+	}
+	pending()
+	return t, nil
+}
+
+// approxWords splits an approxidate into numbers, words and clock times,
+// so that "2.weeks.ago" and "5pm" read like "2 weeks ago" and "5 pm".
+func approxWords(s string) []string {
+	var words []string
+	word := []byte{}
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = []byte{}
+		}
+	}
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' || c == ':' }
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isDigit(c):
+			if len(word) > 0 && !isDigit(word[0]) {
+				flush()
+			}
+		case c >= 'a' && c <= 'z':
+			if len(word) > 0 && isDigit(word[0]) {
+				flush()
+			}
+		default:
+			flush()
+			continue
+		}
+		word = append(word, c)
+	}
+	flush()
+	return words
+}
+
+// matchName finds word among names, which it may abbreviate to three
+// letters or more.
+func matchName(word string, names []string) int {
+	if len(word) < 3 {
+		return -1
+	}
+	for i, name := range names {
+		if strings.HasPrefix(name, word) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Now is the current time, or $GIT_TEST_DATE_NOW seconds since the epoch
+// as git's test suite sets it.
+func Now() time.Time {
+	if s := os.Getenv("GIT_TEST_DATE_NOW"); s != "" {
+		if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return time.Unix(seconds, 0)
+		}
+	}
+	return time.Now()
+}
+
+// Relative describes how long before now t was, rounding the way
+// "--date=relative" does.
+func Relative(t, now time.Time) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	if now.Unix() < t.Unix() {
+		return "in the future"
+	}
+	diff := now.Unix() - t.Unix()
+	if diff < 90 {
+		return plural(diff, "second") + " ago"
+	}
+	diff = (diff + 30) / 60
+	if diff < 90 {
+		return plural(diff, "minute") + " ago"
+	}
+	diff = (diff + 30) / 60
+	if diff < 36 {
+		return plural(diff, "hour") + " ago"
+	}
+	diff = (diff + 12) / 24
+	switch {
+	case diff < 14:
+		return plural(diff, "day") + " ago"
+	case diff < 70:
+		return plural((diff+3)/7, "week") + " ago"
+	case diff < 365:
+		return plural((diff+15)/30, "month") + " ago"
+	case diff < 1825:
+		totalMonths := (diff*12*2 + 365) / (365 * 2)
+		years, months := totalMonths/12, totalMonths%12
+		if months > 0 {
+			return plural(years, "year") + ", " + plural(months, "month") + " ago"
+		}
+		return plural(years, "year") + " ago"
+	}
+	return plural((diff+183)/365, "year") + " ago"
+}
+
+// Strftime formats t with the conversions of C's strftime, as
+// "--date=format:" does. %z and %Z use the zone t carries.
+func Strftime(t time.Time, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 == len(format) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case 'A':
+			b.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			b.WriteString(t.Format("Jan"))
+		case 'B':
+			b.WriteString(t.Format("January"))
+		case 'c':
+			b.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'C':
+			fmt.Fprintf(&b, "%02d", t.Year()/100)
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'D':
+			b.WriteString(t.Format("01/02/06"))
+		case 'e':
+			fmt.Fprintf(&b, "%2d", t.Day())
+		case 'F':
+			b.WriteString(t.Format("2006-01-02"))
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&b, "%02d", (t.Hour()+11)%12+1)
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&b, "%2d", t.Hour())
+		case 'l':
+			fmt.Fprintf(&b, "%2d", (t.Hour()+11)%12+1)
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'n':
+			b.WriteByte('\n')
+		case 'p':
+			b.WriteString(t.Format("PM"))
+		case 'P':
+			b.WriteString(strings.ToLower(t.Format("PM")))
+		case 'r':
+			b.WriteString(t.Format("03:04:05 PM"))
+		case 'R':
+			b.WriteString(t.Format("15:04"))
+		case 's':
+			fmt.Fprintf(&b, "%d", t.Unix())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 't':
+			b.WriteByte('\t')
+		case 'T':
+			b.WriteString(t.Format("15:04:05"))
+		case 'u':
+			fmt.Fprintf(&b, "%d", (int(t.Weekday())+6)%7+1)
+		case 'w':
+			fmt.Fprintf(&b, "%d", int(t.Weekday()))
+		case 'x':
+			b.WriteString(t.Format("01/02/06"))
+		case 'X':
+			b.WriteString(t.Format("15:04:05"))
+		case 'y':
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case 'Y':
+			fmt.Fprintf(&b, "%d", t.Year())
+		case 'z':
+			b.WriteString(Offset(t))
+		case 'Z':
+			if t.Location() == time.Local {
+				b.WriteString(t.Format("MST"))
+			}
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
 }
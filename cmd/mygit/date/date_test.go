@@ -0,0 +1,146 @@
+package date
+
+import (
+	"testing"
+	"time"
+)
+
+// The expected times are git's, from
+// GIT_TEST_DATE_NOW=<now> TZ=UTC git rev-parse --since=<date>.
+func TestApprox(t *testing.T) {
+	for _, tt := range []struct {
+		now  int64
+		date string
+		want int64
+	}{
+		{1700000000, "Oct 3 2023", 1696371200},
+		{1700000000, "3 Oct 2023", 1696371200},
+		{1700000000, "October 3, 2023", 1696371200},
+		{1700000000, "3 October", 1696371200},
+		{1700000000, "Oct 3", 1696371200},
+		{1700000000, "6am yesterday", 1699855200},
+		{1700000000, "yesterday 6am", 1699855200},
+		{1700000000, "6am", 1699941600},
+		{1700000000, "5pm", 1699981200},
+		{1700000000, "noon yesterday", 1699876800},
+		{1700000000, "yesterday noon", 1699876800},
+		{1700000000, "noon", 1699963200},
+		{1700000000, "midnight", 1699920000},
+		{1700000000, "tea", 1699981200},
+		{1700000000, "last friday", 1699654400},
+		{1700000000, "2 weeks ago", 1698790400},
+		{1700000000, "3.days.ago", 1699740800},
+		{1700000000, "yesterday", 1699913600},
+		{1700000000, "5", 1699222400},
+		{1700000000, "2023", 1700000000},
+		{1700000000, "Dec 2022", 1671056000},
+		{1700000000, "10:30", 1699957800},
+		{1700000000, "1 hour ago", 1699996400},
+		{1700000000, "now", 1700000000},
+		{1699930800, "Oct 3 2023", 1696302000},
+		{1699930800, "3 Oct 2023", 1696302000},
+		{1699930800, "October 3, 2023", 1696302000},
+		{1699930800, "3 October", 1696302000},
+		{1699930800, "Oct 3", 1696302000},
+		{1699930800, "6am yesterday", 1699855200},
+		{1699930800, "yesterday 6am", 1699855200},
+		{1699930800, "6am", 1699941600},
+		{1699930800, "5pm", 1699981200},
+		{1699930800, "noon yesterday", 1699790400},
+		{1699930800, "yesterday noon", 1699790400},
+		{1699930800, "noon", 1699876800},
+		{1699930800, "midnight", 1699920000},
+		{1699930800, "tea", 1699894800},
+		{1699930800, "last friday", 1699585200},
+		{1699930800, "2 weeks ago", 1698721200},
+		{1699930800, "3.days.ago", 1699671600},
+		{1699930800, "yesterday", 1699844400},
+		{1699930800, "5", 1699153200},
+		{1699930800, "2023", 1699930800},
+		{1699930800, "Dec 2022", 1670986800},
+		{1699930800, "10:30", 1699957800},
+		{1699930800, "1 hour ago", 1699927200},
+		{1699930800, "now", 1699930800},
+		{1699930800, "Oct 3 23", 1696302000},
+		{1699930800, "3 Oct 99", 938919600},
+		{1699930800, "Jan 2024", 1705201200},
+		{1699930800, "2022 Dec 25", 1671937200},
+		{1699930800, "12pm", 1699963200},
+		{1699930800, "12am yesterday", 1699833600},
+		{1699930800, "yesterday 5pm", 1699894800},
+		{1699930800, "midnight yesterday", 1699833600},
+		{1699930800, "2 days ago noon", 1699704000},
+		{1699930800, "Nov 20", 1700449200},
+		{1699930800, "3 weeks ago 6am", 1698127200},
+	} {
+		now := time.Unix(tt.now, 0).UTC()
+		got, err := Approx(tt.date, now)
+		if err != nil {
+			t.Errorf("Approx(%q) at %s: %v", tt.date, now, err)
+			continue
+		}
+		if got.Unix() != tt.want {
+			t.Errorf("Approx(%q) at %s = %s, want %s", tt.date, now, got, time.Unix(tt.want, 0).UTC())
+		}
+	}
+}
+
+// The expected times are git's, from
+// GIT_COMMITTER_DATE=<date> TZ=UTC git var GIT_COMMITTER_IDENT.
+func TestParse(t *testing.T) {
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.UTC
+	for _, tt := range []struct {
+		date string
+		want string // "" if git rejects the date
+	}{
+		{"1112911993 -0700", "1112911993 -0700"},
+		{"Thu, 07 Apr 2005 22:13:13 +0200", "1112904793 +0200"},
+		{"2005-04-07T22:13:13", "1112911993 +0000"},
+		{"2005.04.07 22:13:13", "1112911993 +0000"},
+		{"04/07/2005 22:13", "1112911980 +0000"},
+		{"07.04.2005 22:13", "1112911980 +0000"},
+		{"2005/04/07 22:13:13 +0200", "1112904793 +0200"},
+		{"13/04/2005 22:13", "1113430380 +0000"},
+		{"04-07-2005 22:13", "1112911980 +0000"},
+		{"07.04.05 22:13 -0130", "1112917380 -0130"},
+		{"12.13.2005 22:13", "1134511980 +0000"},
+		{"31.04.2005 22:13", "1114985580 +0000"},
+		{"2005.04.07T22:13:13 +02:00", "1112904793 +0200"},
+		{"2005-04-07 22:13", "1112911980 +0000"},
+		{"07/04/69 22:13", ""},
+		{"2005.04.07", ""},
+		{"2005.04.07 25:13", ""},
+	} {
+		got, err := Parse(tt.date)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("Parse(%q) = %s, want an error", tt.date, Raw(got))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.date, err)
+			continue
+		}
+		if Raw(got) != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.date, Raw(got), tt.want)
+		}
+	}
+}
+
+func TestFormatLocal(t *testing.T) {
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.FixedZone("", 9*3600)
+	when, _ := ParseRaw("1700000000 +0000")
+	for style, want := range map[string]string{
+		"local":         "Wed Nov 15 07:13:20 2023",
+		"default-local": "Wed Nov 15 07:13:20 2023",
+		"iso-local":     "2023-11-15 07:13:20 +0900",
+		"default":       "Tue Nov 14 22:13:20 2023 +0000",
+	} {
+		if got, err := Format(when, style); err != nil || got != want {
+			t.Errorf("Format(%s) = %q, %v; want %q", style, got, err, want)
+		}
+	}
+}
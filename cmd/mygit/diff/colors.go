@@ -0,0 +1,62 @@
+package diff
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/color"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+)
+
+// Colors are the escape sequences of the color.diff.* slots that colored
+// patches use.
+// ref: https://git-scm.com/docs/git-config#Documentation/git-config.txt-colordiffltslotgt
+type Colors struct {
+	Context, Meta, Frag, Func, Old, New, Whitespace string
+	// The colors of moved lines: the Alt ones tell adjacent blocks apart
+	// and the Dim ones are for lines inside blocks.
+	OldMoved, OldMovedAlt, OldMovedDim, OldMovedAltDim string
+	NewMoved, NewMovedAlt, NewMovedDim, NewMovedAltDim string
+}
+
+// colorSlots are the settings of the slots, as git has them by default.
+var colorSlots = []struct {
+	name    string
+	setting string
+	field   func(c *Colors) *string
+}{
+	{"context", "normal", func(c *Colors) *string { return &c.Context }},
+	{"meta", "bold", func(c *Colors) *string { return &c.Meta }},
+	{"frag", "cyan", func(c *Colors) *string { return &c.Frag }},
+	{"func", "normal", func(c *Colors) *string { return &c.Func }},
+	{"old", "red", func(c *Colors) *string { return &c.Old }},
+	{"new", "green", func(c *Colors) *string { return &c.New }},
+	{"whitespace", "normal red", func(c *Colors) *string { return &c.Whitespace }},
+	{"oldMoved", "bold magenta", func(c *Colors) *string { return &c.OldMoved }},
+	{"oldMovedAlternative", "bold blue", func(c *Colors) *string { return &c.OldMovedAlt }},
+	{"oldMovedDimmed", "dim", func(c *Colors) *string { return &c.OldMovedDim }},
+	{"oldMovedAlternativeDimmed", "dim italic", func(c *Colors) *string { return &c.OldMovedAltDim }},
+	{"newMoved", "bold cyan", func(c *Colors) *string { return &c.NewMoved }},
+	{"newMovedAlternative", "bold yellow", func(c *Colors) *string { return &c.NewMovedAlt }},
+	{"newMovedDimmed", "dim", func(c *Colors) *string { return &c.NewMovedDim }},
+	{"newMovedAlternativeDimmed", "dim italic", func(c *Colors) *string { return &c.NewMovedAltDim }},
+}
+
+// LoadColors reads the color.diff.<slot> settings over git's defaults;
+// "plain" is an old name of the context slot.
+func LoadColors(cfg *config.Config) (*Colors, error) {
+	c := &Colors{}
+	for _, slot := range colorSlots {
+		setting := slot.setting
+		if value, ok := cfg.Get("color.diff." + slot.name); ok {
+			setting = value
+		} else if value, ok := cfg.Get("color.diff.plain"); ok && slot.name == "context" {
+			setting = value
+		}
+		seq, err := color.Parse(setting)
+		if err != nil {
+			return nil, fmt.Errorf("%v for color.diff.%s", err, slot.name)
+		}
+		*slot.field(c) = seq
+	}
+	return c, nil
+}
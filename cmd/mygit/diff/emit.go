@@ -0,0 +1,294 @@
+package diff
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/color"
+)
+
+// symbolKind is what a line of a patch is, which decides its colors.
+type symbolKind int
+
+const (
+	symPlain          symbolKind = iota // written as it is
+	symMeta                             // "diff --git", "index", "---" and the like
+	symFrag                             // "@@ -1,2 +1,2 @@ func"
+	symContext                          // " line"
+	symOld                              // "-line"
+	symNew                              // "+line"
+	symIncomplete                       // "\ No newline at end of file"
+	symWords                            // a context line of a word diff
+	symWordsPorcelain                   // the same with --word-diff=porcelain
+)
+
+// symbolFlag marks context, old and new lines.
+type symbolFlag int
+
+const (
+	flagMoved symbolFlag = 1 << iota
+	flagMovedAlt
+	flagMovedDim
+	flagBlankAtEOF // a blank line added at the end of the file
+)
+
+// symbol is one line of a patch. Lines are kept apart from their colors
+// so that --color-moved can look for moves across all files first.
+// ref: emitted_diff_symbol in https://github.com/git/git/blob/master/diff.c
+type symbol struct {
+	kind  symbolKind
+	text  string // without the sign of context, old and new lines
+	flags symbolFlag
+	rule  WhitespaceRule // the errors to highlight in new lines
+}
+
+// emit writes a line of a patch, or keeps it until Flush when moved
+// lines are colored.
+func (p *Printer) emit(s symbol) {
+	if p.ColorMoved != "" && p.Colors != nil {
+		p.symbols = append(p.symbols, s)
+		return
+	}
+	p.render(s)
+}
+
+// Flush writes the lines kept back to color moved lines. The diff
+// commands call it once all pairs are written.
+func (p *Printer) Flush() {
+	if len(p.symbols) == 0 {
+		return
+	}
+	p.markMoved()
+	if p.ColorMoved == "dimmed-zebra" {
+		p.dimMoved()
+	}
+	for _, s := range p.symbols {
+		p.render(s)
+	}
+	p.symbols = nil
+}
+
+// colorLine writes set, the sign and the line, and reset unless nothing
+// was written; a trailing "\r" and "\n" go after reset.
+// ref: emit_line_0 in https://github.com/git/git/blob/master/diff.c
+func colorLine(set, sign, line, reset string) string {
+	nl := strings.HasSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\n")
+	cr := strings.HasSuffix(line, "\r")
+	line = strings.TrimSuffix(line, "\r")
+	s := ""
+	if sign != "" || line != "" {
+		s = set + sign + line + reset
+	}
+	if cr {
+		s += "\r"
+	}
+	if nl {
+		s += "\n"
+	}
+	return s
+}
+
+func (p *Printer) render(s symbol) {
+	c := p.Colors
+	if c == nil {
+		switch s.kind {
+		case symContext, symWordsPorcelain:
+			p.line(" " + s.text)
+		case symOld:
+			p.line("-" + s.text)
+		case symNew:
+			p.line("+" + s.text)
+		default:
+			p.line(s.text)
+		}
+		if s.kind == symWordsPorcelain {
+			io.WriteString(p.Out, "~\n")
+		}
+		return
+	}
+	reset := color.Reset
+	switch s.kind {
+	case symPlain:
+		p.line(s.text)
+	case symMeta:
+		p.line(c.Meta + strings.TrimSuffix(s.text, "\n") + reset + "\n")
+	case symFrag:
+		p.line(c.fragLine(s.text))
+	case symContext:
+		p.line(colorLine(c.Context, " ", s.text, reset))
+	case symIncomplete, symWords:
+		p.line(colorLine(c.Context, "", s.text, reset))
+	case symWordsPorcelain:
+		p.line(colorLine(c.Context, " ", s.text, reset))
+		io.WriteString(p.Out, "~\n")
+	case symOld:
+		p.line(colorLine(c.movedColor(s.flags, c.Old, c.OldMoved, c.OldMovedAlt, c.OldMovedDim, c.OldMovedAltDim), "-", s.text, reset))
+	case symNew:
+		set := c.movedColor(s.flags, c.New, c.NewMoved, c.NewMovedAlt, c.NewMovedDim, c.NewMovedAltDim)
+		switch {
+		case c.Whitespace == "":
+			p.line(colorLine(set, "+", s.text, reset))
+		case s.flags&flagBlankAtEOF != 0:
+			p.line(colorLine(c.Whitespace, "+", s.text, reset))
+		default:
+			p.line(set + "+" + reset + highlightWhitespace(s.text, s.rule, set, reset, c.Whitespace))
+		}
+	}
+}
+
+// movedColor picks the color of an old or new line from its flags.
+func (c *Colors) movedColor(flags symbolFlag, plain, moved, alt, dim, altDim string) string {
+	switch {
+	case flags&flagMoved == 0:
+		return plain
+	case flags&flagMovedAlt != 0 && flags&flagMovedDim != 0:
+		return altDim
+	case flags&flagMovedAlt != 0:
+		return alt
+	case flags&flagMovedDim != 0:
+		return dim
+	}
+	return moved
+}
+
+// fragLine colors a hunk header: the line numbers in the frag color and
+// the function line in the func color.
+// ref: emit_hunk_header in https://github.com/git/git/blob/master/diff.c
+func (c *Colors) fragLine(line string) string {
+	line = strings.TrimSuffix(line, "\n")
+	end := strings.Index(line[2:], "@@")
+	if !strings.HasPrefix(line, "@@") || end < 0 {
+		return colorLine(c.Context, "", line+"\n", color.Reset)
+	}
+	end += 4
+	s := c.Frag + line[:end] + color.Reset
+	rest := strings.TrimLeft(line[end:], " \t")
+	if blank := line[end : len(line)-len(rest)]; blank != "" {
+		s += c.Context + blank + color.Reset
+	}
+	if rest != "" {
+		s += c.Func + rest + color.Reset
+	}
+	return s + "\n"
+}
+
+// patchState follows the lines of the hunks of one file pair as they
+// are written, as git's fn_out_consume does.
+type patchState struct {
+	p      *Printer
+	header []string // the "---" and "+++" lines, written before the first hunk
+	rule   WhitespaceRule
+	words  *wordDiff
+	// Line numbers on both sides, and where the blank lines that the new
+	// side adds at its end start, or 0 if it adds none.
+	lnoOld, lnoNew     int
+	blankOld, blankNew int
+}
+
+func (p *Printer) newPatchState(a, b []byte, header []string) *patchState {
+	s := &patchState{p: p, header: header, rule: p.WhitespaceRule}
+	if s.rule == 0 {
+		s.rule = DefaultWhitespaceRule
+	}
+	if l1, l2 := trailingBlankLines(a), trailingBlankLines(b); l2 > l1 {
+		s.blankOld = len(SplitLines(a)) - l1 + 1
+		s.blankNew = len(SplitLines(b)) - l2 + 1
+	}
+	return s
+}
+
+// consume takes one line of a hunk, sign first.
+func (s *patchState) consume(line string) {
+	p := s.p
+	for _, h := range s.header {
+		p.emit(symbol{kind: symMeta, text: h})
+	}
+	s.header = nil
+	if s.words != nil {
+		switch line[0] {
+		case '-':
+			s.words.minus = append(s.words.minus, line[1:]...)
+			return
+		case '+':
+			s.words.plus = append(s.words.plus, line[1:]...)
+			return
+		case '\\':
+			// More new lines may follow the end of the old side.
+			return
+		}
+		s.flushWords()
+		switch {
+		case line[0] == '@':
+		case p.WordDiff == "porcelain":
+			p.emit(symbol{kind: symWordsPorcelain, text: line[1:]})
+			return
+		default:
+			p.emit(symbol{kind: symWords, text: line[1:]})
+			return
+		}
+	}
+	switch line[0] {
+	case '@':
+		s.lnoOld, s.lnoNew = hunkStarts(line)
+		p.emit(symbol{kind: symFrag, text: line})
+	case ' ':
+		s.lnoOld++
+		s.lnoNew++
+		p.emit(symbol{kind: symContext, text: line[1:]})
+	case '-':
+		s.lnoOld++
+		p.emit(symbol{kind: symOld, text: line[1:]})
+	case '+':
+		s.lnoNew++
+		sym := symbol{kind: symNew, text: line[1:], rule: s.rule}
+		if s.rule&BlankAtEOF != 0 && s.blankOld != 0 && s.blankOld <= s.lnoOld &&
+			s.blankNew <= s.lnoNew && isBlankLine(line[1:]) {
+			sym.flags |= flagBlankAtEOF
+		}
+		p.emit(sym)
+	default:
+		p.emit(symbol{kind: symIncomplete, text: line})
+	}
+}
+
+// done ends the pair, showing the words still gathered.
+func (s *patchState) done() {
+	if s.words != nil {
+		s.flushWords()
+	}
+}
+
+func (s *patchState) flushWords() {
+	out := s.words.show()
+	for out != "" {
+		i := strings.IndexByte(out, '\n') + 1
+		if i == 0 {
+			i = len(out)
+		}
+		s.p.emit(symbol{kind: symPlain, text: out[:i]})
+		out = out[i:]
+	}
+}
+
+// hunkStarts reads the first line numbers of both sides from a hunk
+// header.
+func hunkStarts(header string) (int, int) {
+	number := func(s string) int {
+		end := 0
+		for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+			end++
+		}
+		n, _ := strconv.Atoi(s[:end])
+		return n
+	}
+	old, new := 0, 0
+	if i := strings.IndexByte(header, '-'); i >= 0 {
+		old = number(header[i+1:])
+	}
+	if i := strings.IndexByte(header, '+'); i >= 0 {
+		new = number(header[i+1:])
+	}
+	return old, new
+}
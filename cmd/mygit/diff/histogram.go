@@ -0,0 +1,165 @@
+package diff
+
+// histogramMaxChain is how many times a line may occur in the old range
+// and still be a candidate to anchor on.
+const histogramMaxChain = 64
+
+// histogramIndex records, for a range of the old side, the occurrences of
+// each line from the last up, like xhistogram.c's histindex. Lines are
+// 1-based here as in git, so that 0 can mean "none".
+type histogramIndex struct {
+	f1, f2   *xdfile
+	records  map[int]*histogramRecord // by class
+	lineMap  []*histogramRecord       // record of each line, from ptrShift
+	nextPtrs []int                    // next occurrence of each line, from ptrShift
+	ptrShift int
+	cnt      int
+	common   bool
+}
+
+type histogramRecord struct {
+	ptr, cnt int // first occurrence, number of occurrences
+}
+
+type histogramRegion struct {
+	begin1, end1, begin2, end2 int
+}
+
+func (x *histogramIndex) cmp(l1, l2 int) bool {
+	return x.f1.class[l1-1] == x.f2.class[l2-1]
+}
+
+// histogramDiff marks the changed lines among count1 lines of f1 from
+// line1 and count2 lines of f2 from line2, 1-based. The longest run of
+// equal lines whose rarest line occurs least often on the old side splits
+// the ranges, and both halves are compared the same way.
+// ref: https://github.com/git/git/blob/master/xdiff/xhistogram.c
+func histogramDiff(f1, f2 *xdfile, line1, count1, line2, count2 int) {
+	for {
+		switch {
+		case count1 <= 0 && count2 <= 0:
+			return
+		case count1 <= 0:
+			for i := 0; i < count2; i++ {
+				f2.setChanged(line2-1+i, true)
+			}
+			return
+		case count2 <= 0:
+			for i := 0; i < count1; i++ {
+				f1.setChanged(line1-1+i, true)
+			}
+			return
+		}
+		x := &histogramIndex{
+			f1:       f1,
+			f2:       f2,
+			records:  map[int]*histogramRecord{},
+			lineMap:  make([]*histogramRecord, count1),
+			nextPtrs: make([]int, count1),
+			ptrShift: line1,
+		}
+		var lcs histogramRegion
+		if !x.findLCS(&lcs, line1, count1, line2, count2) {
+			fallBackDiff(f1, f2, line1-1, count1, line2-1, count2)
+			return
+		}
+		if lcs.begin1 == 0 && lcs.begin2 == 0 {
+			for i := 0; i < count1; i++ {
+				f1.setChanged(line1-1+i, true)
+			}
+			for i := 0; i < count2; i++ {
+				f2.setChanged(line2-1+i, true)
+			}
+			return
+		}
+		histogramDiff(f1, f2, line1, lcs.begin1-line1, line2, lcs.begin2-line2)
+		end1, end2 := line1+count1-1, line2+count2-1
+		line1, count1 = lcs.end1+1, end1-lcs.end1
+		line2, count2 = lcs.end2+1, end2-lcs.end2
+	}
+}
+
+// findLCS looks for the region to split on, reporting false when every
+// common line occurs too often to be a good anchor.
+func (x *histogramIndex) findLCS(lcs *histogramRegion, line1, count1, line2, count2 int) bool {
+	x.scanA(line1, count1)
+	x.cnt = histogramMaxChain + 1
+	for ptr := line2; ptr <= line2+count2-1; {
+		ptr = x.tryLCS(lcs, ptr, line1, count1, line2, count2)
+	}
+	return !(x.common && histogramMaxChain < x.cnt)
+}
+
+// scanA indexes the old range, bottom up so that each chain of
+// occurrences starts at the first one.
+func (x *histogramIndex) scanA(line1, count1 int) {
+	for ptr := line1 + count1 - 1; ptr >= line1; ptr-- {
+		c := x.f1.class[ptr-1]
+		if rec, ok := x.records[c]; ok {
+			x.nextPtrs[ptr-x.ptrShift] = rec.ptr
+			rec.ptr = ptr
+			rec.cnt++
+			x.lineMap[ptr-x.ptrShift] = rec
+			continue
+		}
+		rec := &histogramRecord{ptr: ptr, cnt: 1}
+		x.records[c] = rec
+		x.lineMap[ptr-x.ptrShift] = rec
+	}
+}
+
+// tryLCS extends every occurrence in the old range of line bPtr of the
+// new one into a run of equal lines, keeping the best, and returns the
+// new line to try next.
+func (x *histogramIndex) tryLCS(lcs *histogramRegion, bPtr, line1, count1, line2, count2 int) int {
+	bNext := bPtr + 1
+	rec, ok := x.records[x.f2.class[bPtr-1]]
+	if !ok {
+		return bNext
+	}
+	if rec.cnt > x.cnt {
+		x.common = true
+		return bNext
+	}
+	x.common = true
+	end1, end2 := line1+count1-1, line2+count2-1
+	for as := rec.ptr; ; {
+		np := x.nextPtrs[as-x.ptrShift]
+		bs, ae, be, rc := bPtr, as, bPtr, rec.cnt
+		for line1 < as && line2 < bs && x.cmp(as-1, bs-1) {
+			as--
+			bs--
+			if rc > 1 {
+				rc = min(rc, x.lineMap[as-x.ptrShift].cnt)
+			}
+		}
+		for ae < end1 && be < end2 && x.cmp(ae+1, be+1) {
+			ae++
+			be++
+			if rc > 1 {
+				rc = min(rc, x.lineMap[ae-x.ptrShift].cnt)
+			}
+		}
+		if bNext <= be {
+			bNext = be + 1
+		}
+		if lcs.end1-lcs.begin1 < ae-as || rc < x.cnt {
+			*lcs = histogramRegion{as, ae, bs, be}
+			x.cnt = rc
+		}
+		for np != 0 && np <= ae {
+			np = x.nextPtrs[np-x.ptrShift]
+		}
+		if np == 0 {
+			return bNext
+		}
+		as = np
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
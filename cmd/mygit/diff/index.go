@@ -0,0 +1,212 @@
+package diff
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// flattenTree lists the blobs of a tree by full path, within the paths
+// of opts.
+func flattenTree(store *object.Store, sha, base string, opts TreeOptions, files map[string]File) error {
+	entries, err := readTree(store, sha)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := e.Name
+		if base != "" {
+			path = base + "/" + e.Name
+		}
+		if !inPaths(opts.Paths, path, e.IsTree()) {
+			continue
+		}
+		if e.IsTree() {
+			if err := flattenTree(store, e.Sha, path, opts, files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[path] = File{Path: path, Mode: NormalizeMode(e.Mode), Sha: e.Sha}
+	}
+	return nil
+}
+
+// WorkTreeFile reads the file of an index entry from the work tree. Its
+// stat data can vouch for it to be unchanged; otherwise it is hashed,
+// and its contents kept for the diff. A racily clean file that hashes
+// to the entry is unchanged too. A missing file reports false.
+func WorkTreeFile(store *object.Store, idx *index.Index, e *index.Entry, workTree string) (File, bool, error) {
+	name := filepath.Join(workTree, filepath.FromSlash(e.Path))
+	info, err := os.Lstat(name)
+	if os.IsNotExist(err) || err == nil && info.IsDir() && e.Mode != 0160000 {
+		return File{}, false, nil
+	}
+	if err != nil {
+		return File{}, false, err
+	}
+	mode := index.FileMode(info)
+	f := File{Path: e.Path, Mode: fmt.Sprintf("%06o", mode), Sha: e.Sha}
+	if mode == 0160000 || !e.IntentToAdd && idx.Uptodate(e, info) {
+		return f, true, nil
+	}
+	var data []byte
+	if mode == 0120000 {
+		target, err := os.Readlink(name)
+		if err != nil {
+			return File{}, false, err
+		}
+		data = []byte(filepath.ToSlash(target))
+	} else if data, err = ioutil.ReadFile(name); err != nil {
+		return File{}, false, err
+	}
+	sha := store.Hash("blob", data)
+	if !e.IntentToAdd && sha == e.Sha && index.StatDataMatches(e, info) {
+		return f, true, nil
+	}
+	f.Sha, f.Contents = sha, data
+	return f, true, nil
+}
+
+// newPair classifies the change from old to new, or reports false when
+// there is none.
+func newPair(old, new File) (FilePair, bool) {
+	pair := FilePair{Status: Modified, Old: old, New: new}
+	switch {
+	case !old.Exists() && !new.Exists():
+		return pair, false
+	case !old.Exists():
+		pair.Status = Added
+	case !new.Exists():
+		pair.Status = Deleted
+	case old.Sha == new.Sha && old.Mode == new.Mode:
+		return pair, false
+	case fileType(old.Mode) != fileType(new.Mode):
+		pair.Status = TypeChanged
+	}
+	return pair, true
+}
+
+// TreeIndex compares a tree with the index, as "diff --cached" does, or
+// with the work tree files the index tracks when workTree is set, as
+// "diff <commit>" does. An empty tree name stands for the empty tree.
+// ref: https://git-scm.com/docs/git-diff-index
+func TreeIndex(store *object.Store, tree string, idx *index.Index, workTree string, opts TreeOptions) ([]FilePair, error) {
+	olds := map[string]File{}
+	if err := flattenTree(store, tree, "", opts, olds); err != nil {
+		return nil, err
+	}
+	news := map[string]File{}
+	unmerged := map[string]bool{}
+	for _, e := range idx.Entries {
+		if !inPaths(opts.Paths, e.Path, false) {
+			continue
+		}
+		if e.Stage > 0 {
+			// Against the work tree, the file is what it is, conflict
+			// or not.
+			if workTree == "" {
+				unmerged[e.Path] = true
+				continue
+			}
+			if _, seen := news[e.Path]; seen {
+				continue
+			}
+		}
+		if workTree == "" {
+			if !e.IntentToAdd {
+				news[e.Path] = File{Path: e.Path, Mode: e.ModeString(), Sha: e.Sha}
+			}
+			continue
+		}
+		f, ok, err := WorkTreeFile(store, idx, e, workTree)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			news[e.Path] = f
+		} else if opts.MissingAsIndexed && !e.IntentToAdd {
+			news[e.Path] = File{Path: e.Path, Mode: e.ModeString(), Sha: e.Sha}
+		}
+	}
+	paths := []string{}
+	for p := range olds {
+		paths = append(paths, p)
+	}
+	for p := range news {
+		if _, ok := olds[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	for p := range unmerged {
+		if _, ok := olds[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	pairs := []FilePair{}
+	for _, p := range paths {
+		if unmerged[p] {
+			pairs = append(pairs, FilePair{Status: Unmerged, Old: File{Path: p}, New: File{Path: p}})
+			continue
+		}
+		if pair, ok := newPair(olds[p], news[p]); ok || keepUnchanged(pair, opts) {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, nil
+}
+
+// IndexFiles compares the index with the work tree, as "diff" without
+// revisions does. Files the index doesn't track aren't looked at.
+// ref: https://git-scm.com/docs/git-diff-files
+func IndexFiles(store *object.Store, idx *index.Index, workTree string, opts TreeOptions) ([]FilePair, error) {
+	pairs := []FilePair{}
+	lastUnmerged := ""
+	for _, e := range idx.Entries {
+		if !inPaths(opts.Paths, e.Path, false) || e.SkipWorktree {
+			continue
+		}
+		if e.Stage > 0 {
+			if e.Path == lastUnmerged {
+				continue
+			}
+			// A conflict is reported once, followed by how the file
+			// differs from our side, as "diff -2" shows it.
+			lastUnmerged = e.Path
+			pairs = append(pairs, FilePair{Status: Unmerged, Old: File{Path: e.Path}, New: File{Path: e.Path}})
+			if e = idx.Find(e.Path, 2); e == nil {
+				continue
+			}
+		}
+		old := File{Path: e.Path, Mode: e.ModeString(), Sha: e.Sha}
+		if e.IntentToAdd {
+			old = File{}
+		}
+		new, ok, err := WorkTreeFile(store, idx, e, workTree)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			new = File{}
+		}
+		if pair, ok := newPair(old, new); ok || keepUnchanged(pair, opts) {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, nil
+}
+
+// keepUnchanged reports whether a pair without changes is wanted all the
+// same, as a source of copies or for its stat data.
+func keepUnchanged(pair FilePair, opts TreeOptions) bool {
+	if !pair.Old.Exists() || !pair.New.Exists() {
+		return false
+	}
+	return opts.Unmodified || opts.StatDirty && pair.New.Contents != nil
+}
@@ -0,0 +1,181 @@
+package diff
+
+// movedMinAlnum is how many alphanumeric characters a block of moved
+// lines needs for the block modes to color it.
+const movedMinAlnum = 20
+
+// IsColorMovedMode reports whether name is a mode of --color-moved, as
+// Printer.ColorMoved takes it; "default" is zebra and "no" is off.
+func IsColorMovedMode(name string) bool {
+	switch name {
+	case "no", "default", "plain", "blocks", "zebra", "dimmed-zebra", "dimmed_zebra":
+		return true
+	}
+	return false
+}
+
+// markMoved flags the old lines that come back as new lines elsewhere in
+// the patch and the other way around. But for the plain mode, moves are
+// found in blocks of lines that follow each other on both ends, and
+// adjacent blocks are told apart by the alternative flag.
+// ref: mark_color_as_moved in https://github.com/git/git/blob/master/diff.c
+func (p *Printer) markMoved() {
+	syms := p.symbols
+	// next links each old or new line to the one right after it, if that
+	// is of the same kind; matches lists the lines of the other kind
+	// each line could have moved from or to.
+	next := make([]int, len(syms))
+	olds, news := map[string][]int{}, map[string][]int{}
+	prev := -1
+	for i, s := range syms {
+		next[i] = -1
+		if s.kind != symOld && s.kind != symNew {
+			prev = -1
+			continue
+		}
+		if prev >= 0 && syms[prev].kind == s.kind {
+			next[prev] = i
+		}
+		prev = i
+		if s.kind == symOld {
+			olds[s.text] = append(olds[s.text], i)
+		} else {
+			news[s.text] = append(news[s.text], i)
+		}
+	}
+	matches := func(s symbol) []int {
+		switch s.kind {
+		case symOld:
+			return news[s.text]
+		case symNew:
+			return olds[s.text]
+		}
+		return nil
+	}
+
+	var candidates []int // where the blocks being followed are on the other side
+	blockLength := 0
+	flipped := false
+	movedKind := symPlain
+	for n := 0; n < len(syms); n++ {
+		l := &syms[n]
+		match := matches(*l)
+		if l.kind != symOld && l.kind != symNew {
+			flipped = false
+		}
+		if len(candidates) > 0 && (match == nil || l.kind != movedKind) {
+			if !p.adjustLastBlock(n, blockLength) && blockLength > 1 {
+				// Another block may start at the second line of this one.
+				match = nil
+				n -= blockLength
+			}
+			candidates = nil
+			blockLength = 0
+			flipped = false
+		}
+		if match == nil {
+			movedKind = symPlain
+			continue
+		}
+		if p.ColorMoved == "plain" {
+			l.flags |= flagMoved
+			continue
+		}
+
+		following := candidates[:0]
+		for _, c := range candidates {
+			if c = next[c]; c >= 0 && syms[c].text == l.text {
+				following = append(following, c)
+			}
+		}
+		candidates = following
+
+		if len(candidates) == 0 {
+			contiguous := p.adjustLastBlock(n, blockLength)
+			if !contiguous && blockLength > 1 {
+				n -= blockLength
+			} else {
+				candidates = append(candidates, match...)
+			}
+			if contiguous && len(candidates) > 0 && movedKind == l.kind {
+				flipped = !flipped
+			} else {
+				flipped = false
+			}
+			if len(candidates) > 0 {
+				movedKind = l.kind
+			} else {
+				movedKind = symPlain
+			}
+			blockLength = 0
+		}
+
+		if len(candidates) > 0 {
+			blockLength++
+			l.flags |= flagMoved
+			if flipped && p.ColorMoved != "blocks" {
+				l.flags |= flagMovedAlt
+			}
+		}
+	}
+	p.adjustLastBlock(len(syms), blockLength)
+}
+
+// adjustLastBlock unmarks the block of length lines ending before n if
+// it is too short to count as moved, and reports whether it counts.
+func (p *Printer) adjustLastBlock(n, length int) bool {
+	if p.ColorMoved == "plain" {
+		return length > 0
+	}
+	alnum := 0
+	for i := 1; i <= length; i++ {
+		for _, c := range []byte(p.symbols[n-i].text) {
+			if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+				alnum++
+			}
+		}
+		if alnum >= movedMinAlnum {
+			return true
+		}
+	}
+	for i := 1; i <= length; i++ {
+		p.symbols[n-i].flags &^= flagMoved | flagMovedAlt
+	}
+	return false
+}
+
+// dimMoved dims the moved lines inside blocks, so that only the edges
+// between blocks stand out.
+// ref: dim_moved_lines in https://github.com/git/git/blob/master/diff.c
+func (p *Printer) dimMoved() {
+	syms := p.symbols
+	const zebra = flagMoved | flagMovedAlt
+	isChange := func(i int) bool {
+		return i >= 0 && i < len(syms) && (syms[i].kind == symOld || syms[i].kind == symNew)
+	}
+	for n := range syms {
+		l := &syms[n]
+		if !isChange(n) || l.flags&flagMoved == 0 {
+			continue
+		}
+		prev, next := n-1, n+1
+		if !isChange(prev) {
+			prev = -1
+		}
+		if !isChange(next) {
+			next = -1
+		}
+		if prev >= 0 && syms[prev].flags&zebra == l.flags&zebra &&
+			next >= 0 && syms[next].flags&zebra == l.flags&zebra {
+			l.flags |= flagMovedDim
+			continue
+		}
+		edge := func(i int) bool {
+			return i >= 0 && syms[i].flags&flagMoved != 0 && syms[i].flags&flagMovedAlt != l.flags&flagMovedAlt
+		}
+		if edge(prev) || edge(next) {
+			continue
+		}
+		l.flags |= flagMovedDim
+	}
+}
@@ -0,0 +1,299 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// Printer writes file pairs in git's diff output formats.
+type Printer struct {
+	Store   *object.Store
+	Out     io.Writer
+	Options Options
+	// Abbrev is the length of the object names of "index" lines.
+	Abbrev int
+	// RawAbbrev is the length of the object names of the raw format, 0
+	// for full names.
+	RawAbbrev int
+	// Prefix, if set, is written before every line, as "log --graph"
+	// does with its padding.
+	Prefix func() string
+	// Width is the number of columns --stat fills.
+	Width int
+	// NulTerminated ends paths with NULs and doesn't quote them, as -z
+	// asks of the raw, name and numstat formats.
+	NulTerminated bool
+	// Colors, if set, colors patches.
+	Colors *Colors
+	// WhitespaceRule is core.whitespace, the errors colored patches
+	// highlight in new lines; 0 is git's default.
+	WhitespaceRule WhitespaceRule
+	// WordDiff shows patches word by word: "plain", "color" or
+	// "porcelain". WordRegex, if set, is what it takes for a word
+	// whatever the drivers say.
+	WordDiff  string
+	WordRegex *regexp.Regexp
+	// ColorMoved colors lines moved within the patches: "plain",
+	// "blocks", "zebra" or "dimmed-zebra". It needs Colors, and keeps
+	// the patches until Flush.
+	ColorMoved string
+	// Drivers picks the diff drivers of paths; nil uses none.
+	Drivers *Drivers
+
+	symbols []symbol // the lines kept for ColorMoved
+}
+
+func (p *Printer) line(s string) {
+	if p.Prefix != nil {
+		io.WriteString(p.Out, p.Prefix())
+	}
+	io.WriteString(p.Out, s)
+}
+
+// content reads the blob of one side; absent sides are empty and
+// submodules show the commit they point to.
+func (p *Printer) content(f File) ([]byte, error) {
+	switch {
+	case !f.Exists():
+		return nil, nil
+	case f.Contents != nil:
+		return f.Contents, nil
+	case f.Mode == "160000":
+		return []byte("Subproject commit " + f.Sha + "\n"), nil
+	}
+	return p.Store.ReadType(f.Sha, "blob")
+}
+
+// IsBinary reports whether data looks binary to git: it has a NUL byte
+// in its first 8000 bytes.
+func IsBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+func (p *Printer) abbrev(sha string) string {
+	if sha == "" {
+		return strings.Repeat("0", p.Abbrev)
+	}
+	return p.Store.Abbrev(sha, p.Abbrev)
+}
+
+// Patch writes the "diff --git" patch of one pair. A pair whose type
+// changed is shown as a deletion followed by a creation.
+// ref: https://git-scm.com/docs/diff-format#generate_patch_text_with_p
+func (p *Printer) Patch(pair FilePair) error {
+	if pair.Status == Unmerged {
+		p.line("* Unmerged path " + pair.Path() + "\n")
+		return nil
+	}
+	if Unchanged(pair) {
+		return nil
+	}
+	if pair.Status == TypeChanged {
+		if err := p.Patch(FilePair{Status: Deleted, Old: pair.Old}); err != nil {
+			return err
+		}
+		return p.Patch(FilePair{Status: Added, New: pair.New})
+	}
+	oldName, newName := "a/"+pair.Path(), "b/"+pair.Path()
+	if pair.Old.Exists() {
+		oldName = "a/" + pair.Old.Path
+	}
+	// The header waits for the first hunk unless it tells more than
+	// that the contents changed.
+	header := []string{fmt.Sprintf("diff --git %s %s\n", QuotePath(oldName), QuotePath(newName))}
+	switch {
+	case !pair.Old.Exists():
+		header = append(header, "new file mode "+pair.New.Mode+"\n")
+	case !pair.New.Exists():
+		header = append(header, "deleted file mode "+pair.Old.Mode+"\n")
+	case pair.Old.Mode != pair.New.Mode:
+		header = append(header, "old mode "+pair.Old.Mode+"\n", "new mode "+pair.New.Mode+"\n")
+	}
+	switch pair.Status {
+	case Renamed, Copied:
+		what := "rename"
+		if pair.Status == Copied {
+			what = "copy"
+		}
+		header = append(header,
+			fmt.Sprintf("similarity index %d%%\n", SimilarityIndex(pair.Score)),
+			what+" from "+QuotePath(pair.Old.Path)+"\n",
+			what+" to "+QuotePath(pair.New.Path)+"\n")
+	case Modified:
+		if pair.Score != 0 {
+			header = append(header, fmt.Sprintf("dissimilarity index %d%%\n", SimilarityIndex(pair.Score)))
+		}
+	}
+	mustShow := len(header) > 1
+	if pair.Old.Sha == pair.New.Sha {
+		p.emitMeta(header)
+		return nil
+	}
+	index := "index " + p.abbrev(pair.Old.Sha) + ".." + p.abbrev(pair.New.Sha)
+	if pair.Old.Mode == pair.New.Mode {
+		index += " " + pair.New.Mode
+	}
+	header = append(header, index+"\n")
+
+	a, err := p.content(pair.Old)
+	if err != nil {
+		return err
+	}
+	b, err := p.content(pair.New)
+	if err != nil {
+		return err
+	}
+	oldDriver, err := p.Drivers.For(pair.Old.Path)
+	if err != nil {
+		return err
+	}
+	newDriver, err := p.Drivers.For(pair.New.Path)
+	if err != nil {
+		return err
+	}
+	from, to := "a/"+pair.Old.Path, "b/"+pair.New.Path
+	if !pair.Old.Exists() {
+		from = "/dev/null"
+	}
+	if !pair.New.Exists() {
+		to = "/dev/null"
+	}
+	binary := oldDriver.IsBinary(a) || newDriver.IsBinary(b)
+	if binary || mustShow {
+		p.emitMeta(header)
+		header = nil
+	}
+	if binary {
+		p.emit(symbol{text: fmt.Sprintf("Binary files %s and %s differ\n", QuotePath(from), QuotePath(to))})
+		return nil
+	}
+	header = append(header, "--- "+QuotePath(from)+"\n", "+++ "+QuotePath(to)+"\n")
+	state := p.newPatchState(a, b, header)
+	if p.WordDiff != "" {
+		state.words = newWordDiff(p.WordDiff, p.wordRegex(oldDriver, newDriver), p.Colors)
+	}
+	if pair.Status == Modified && pair.Score != 0 {
+		rewrite(a, b, state.consume)
+	} else {
+		opts := p.Options
+		for _, drv := range []*Driver{oldDriver, newDriver} {
+			if drv != nil && drv.FuncName != nil {
+				opts.FuncLine = drv.FuncName.Match
+				break
+			}
+		}
+		Lines(a, b, opts).Unified(opts, state.consume)
+	}
+	state.done()
+	return nil
+}
+
+func (p *Printer) emitMeta(lines []string) {
+	for _, l := range lines {
+		p.emit(symbol{kind: symMeta, text: l})
+	}
+}
+
+// wordRegex is what word diffs take for words: WordRegex, or that of
+// the driver of either side.
+func (p *Printer) wordRegex(drivers ...*Driver) *regexp.Regexp {
+	if p.WordRegex != nil {
+		return p.WordRegex
+	}
+	for _, drv := range drivers {
+		if drv != nil && drv.WordRegex != nil {
+			return drv.WordRegex
+		}
+	}
+	return nil
+}
+
+// rewrite shows a file that -B found rewritten as a single hunk that
+// removes all of it and adds the new contents.
+func rewrite(a, b []byte, emit func(line string)) {
+	count := func(n int) string {
+		switch n {
+		case 0:
+			return "0,0"
+		case 1:
+			return "1"
+		}
+		return fmt.Sprintf("1,%d", n)
+	}
+	olds, news := SplitLines(a), SplitLines(b)
+	emit("@@ -" + count(len(olds)) + " +" + count(len(news)) + " @@\n")
+	for _, l := range olds {
+		emitLine(emit, '-', l)
+	}
+	for _, l := range news {
+		emitLine(emit, '+', l)
+	}
+}
+
+// WriteNames writes the paths of the pairs, as "--name-only" does, or
+// with their status letters first, as "--name-status" does.
+func (p *Printer) WriteNames(pairs []FilePair, status bool) {
+	for _, pair := range pairs {
+		if status {
+			p.line(statusString(pair) + p.end("\t") + p.names(pair))
+		} else {
+			p.line(p.quote(pair.Path()) + p.end("\n"))
+		}
+	}
+}
+
+// QuotePath quotes a path the way git shows it with core.quotePath: in
+// double quotes with C escapes when it has control characters, quotes,
+// backslashes or bytes outside ASCII.
+func QuotePath(name string) string {
+	needs := false
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			needs = true
+			break
+		}
+	}
+	if !needs {
+		return name
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch c {
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\v':
+			b.WriteString(`\v`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
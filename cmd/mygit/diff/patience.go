@@ -0,0 +1,140 @@
+package diff
+
+// patienceEntry is a line of the old range, and where it is in the new
+// one if it occurs exactly once on both sides.
+type patienceEntry struct {
+	line1, line2 int // line2 is -1 when absent, -2 when not unique
+	prev, next   *patienceEntry
+}
+
+const (
+	patienceAbsent    = -1
+	patienceNonUnique = -2
+)
+
+// patienceDiff marks the changed lines among count1 lines of f1 from
+// line1 and count2 lines of f2 from line2, 0-based. Lines unique to both
+// sides anchor the diff; the runs between them are compared the same way
+// in turn, and with Myers when they share no unique line.
+// ref: https://github.com/git/git/blob/master/xdiff/xpatience.c
+func patienceDiff(f1, f2 *xdfile, line1, count1, line2, count2 int) {
+	switch {
+	case count1 == 0 && count2 == 0:
+		return
+	case count1 == 0:
+		for i := 0; i < count2; i++ {
+			f2.setChanged(line2+i, true)
+		}
+		return
+	case count2 == 0:
+		for i := 0; i < count1; i++ {
+			f1.setChanged(line1+i, true)
+		}
+		return
+	}
+
+	byClass := map[int]*patienceEntry{}
+	entries := []*patienceEntry{}
+	for i := line1; i < line1+count1; i++ {
+		if e, ok := byClass[f1.class[i]]; ok {
+			e.line2 = patienceNonUnique
+			continue
+		}
+		e := &patienceEntry{line1: i, line2: patienceAbsent}
+		byClass[f1.class[i]] = e
+		entries = append(entries, e)
+	}
+	hasMatches := false
+	for i := line2; i < line2+count2; i++ {
+		e, ok := byClass[f2.class[i]]
+		if !ok {
+			continue
+		}
+		if e.line2 != patienceAbsent {
+			e.line2 = patienceNonUnique
+			continue
+		}
+		e.line2 = i
+		hasMatches = true
+	}
+	var first *patienceEntry
+	if hasMatches {
+		first = longestCommonSequence(entries)
+	}
+	if first == nil {
+		fallBackDiff(f1, f2, line1, count1, line2, count2)
+		return
+	}
+	walkCommonSequence(f1, f2, first, line1, count1, line2, count2)
+}
+
+// longestCommonSequence picks the longest run of unique lines that are in
+// the same order on both sides, by patience sorting, and links it up
+// through next.
+func longestCommonSequence(entries []*patienceEntry) *patienceEntry {
+	sequence := []*patienceEntry{}
+	for _, e := range entries {
+		if e.line2 < 0 {
+			continue
+		}
+		left, right := -1, len(sequence)
+		for left+1 < right {
+			middle := left + (right-left)/2
+			if sequence[middle].line2 > e.line2 {
+				right = middle
+			} else {
+				left = middle
+			}
+		}
+		if left >= 0 {
+			e.prev = sequence[left]
+		}
+		if left+1 == len(sequence) {
+			sequence = append(sequence, e)
+		} else {
+			sequence[left+1] = e
+		}
+	}
+	if len(sequence) == 0 {
+		return nil
+	}
+	e := sequence[len(sequence)-1]
+	e.next = nil
+	for e.prev != nil {
+		e.prev.next = e
+		e = e.prev
+	}
+	return e
+}
+
+// walkCommonSequence grows each anchor over the equal lines around it and
+// diffs the gaps between them.
+func walkCommonSequence(f1, f2 *xdfile, first *patienceEntry, line1, count1, line2, count2 int) {
+	end1, end2 := line1+count1, line2+count2
+	match := func(i1, i2 int) bool { return f1.class[i1] == f2.class[i2] }
+	for {
+		next1, next2 := end1, end2
+		if first != nil {
+			next1, next2 = first.line1, first.line2
+			for next1 > line1 && next2 > line2 && match(next1-1, next2-1) {
+				next1--
+				next2--
+			}
+		}
+		for line1 < next1 && line2 < next2 && match(line1, line2) {
+			line1++
+			line2++
+		}
+		if next1 > line1 || next2 > line2 {
+			patienceDiff(f1, f2, line1, next1-line1, line2, next2-line2)
+		}
+		if first == nil {
+			return
+		}
+		for first.next != nil && first.next.line1 == first.line1+1 && first.next.line2 == first.line2+1 {
+			first = first.next
+		}
+		line1, line2 = first.line1+1, first.line2+1
+		first = first.next
+	}
+}
@@ -0,0 +1,134 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// zeroMode is the mode raw output gives an absent side.
+const zeroMode = "000000"
+
+// end writes the end of a field: a tab or newline, or a NUL with -z.
+func (p *Printer) end(sep string) string {
+	if p.NulTerminated {
+		return "\x00"
+	}
+	return sep
+}
+
+// quote quotes a path unless -z makes that unnecessary.
+func (p *Printer) quote(name string) string {
+	if p.NulTerminated {
+		return name
+	}
+	return QuotePath(name)
+}
+
+// Unchanged reports whether a pair changes neither contents nor mode,
+// as the files whose stat data alone changed; only the raw and name
+// formats show them.
+func Unchanged(pair FilePair) bool {
+	return pair.Status == Modified && pair.Score == 0 && pair.Old.Path == pair.New.Path &&
+		pair.Old.Sha == pair.New.Sha && pair.Old.Mode == pair.New.Mode
+}
+
+// statusString is the status letter of a pair with its score, if any,
+// in percent: "R086".
+func statusString(pair FilePair) string {
+	if pair.Score != 0 {
+		return fmt.Sprintf("%c%03d", pair.Status, SimilarityIndex(pair.Score))
+	}
+	return string(pair.Status)
+}
+
+// names writes the path of a pair, preceded by its source for renames
+// and copies.
+func (p *Printer) names(pair FilePair) string {
+	if pair.Status == Renamed || pair.Status == Copied {
+		return p.quote(pair.Old.Path) + p.end("\t") + p.quote(pair.New.Path) + p.end("\n")
+	}
+	return p.quote(pair.Path()) + p.end("\n")
+}
+
+// WriteRaw writes the pairs in the raw format of the plumbing diff
+// commands: both modes and object names, then the status and paths.
+// Files of the work tree have no object name, as git doesn't hash them.
+// ref: https://git-scm.com/docs/diff-format#_raw_output_format
+func (p *Printer) WriteRaw(pairs []FilePair) {
+	abbrev := func(sha string) string {
+		n := p.RawAbbrev
+		if n == 0 || n > p.Store.Algo.HexSize() {
+			n = p.Store.Algo.HexSize()
+		}
+		if sha == "" {
+			return strings.Repeat("0", n)
+		}
+		return p.Store.Abbrev(sha, n)
+	}
+	for _, pair := range pairs {
+		oldMode, newMode := pair.Old.Mode, pair.New.Mode
+		if oldMode == "" {
+			oldMode = zeroMode
+		}
+		if newMode == "" {
+			newMode = zeroMode
+		}
+		oldSha, newSha := pair.Old.Sha, pair.New.Sha
+		if !pair.Old.Exists() || pair.Old.Contents != nil {
+			oldSha = ""
+		}
+		if !pair.New.Exists() || pair.New.Contents != nil {
+			newSha = ""
+		}
+		p.line(fmt.Sprintf(":%s %s %s %s %s", oldMode, newMode, abbrev(oldSha), abbrev(newSha), statusString(pair)) +
+			p.end("\t") + p.names(pair))
+	}
+}
+
+// RenameName shows a rename as "old => new", with the directories both
+// paths share outside braces: "dir/{a => b}/file".
+func RenameName(a, b string) string {
+	if QuotePath(a) != a || QuotePath(b) != b {
+		return QuotePath(a) + " => " + QuotePath(b)
+	}
+	// at is the byte at i, with NUL past the end, as in C.
+	at := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+	prefix := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			prefix = i + 1
+		}
+	}
+	// A common prefix ends in a slash, which the suffix may share.
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+	suffix := 0
+	for i, j := len(a), len(b); prefix-adjust <= i && prefix-adjust <= j && at(a, i) == at(b, j); i, j = i-1, j-1 {
+		if at(a, i) == '/' {
+			suffix = len(a) - i
+		}
+	}
+	aMid, bMid := len(a)-prefix-suffix, len(b)-prefix-suffix
+	if aMid < 0 {
+		aMid = 0
+	}
+	if bMid < 0 {
+		bMid = 0
+	}
+	var sb strings.Builder
+	if prefix+suffix > 0 {
+		sb.WriteString(a[:prefix] + "{")
+	}
+	sb.WriteString(a[prefix:prefix+aMid] + " => " + b[prefix:prefix+bMid])
+	if prefix+suffix > 0 {
+		sb.WriteString("}" + a[len(a)-suffix:])
+	}
+	return sb.String()
+}
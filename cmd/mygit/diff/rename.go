@@ -0,0 +1,592 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// Levels of RenameOptions.Detect.
+const (
+	DetectRenames = 1
+	DetectCopies  = 2
+)
+
+// Default scores of rename detection and of -B.
+const (
+	DefaultRenameScore = 30000 // 50%
+	DefaultBreakScore  = 30000 // 50%
+	DefaultMergeScore  = 36000 // 60%
+	DefaultRenameLimit = 1000
+	minimumBreakSize   = 400
+	candidatesPerDst   = 4
+)
+
+// RenameOptions select what Detect looks for.
+type RenameOptions struct {
+	// Detect is 0, DetectRenames or DetectCopies.
+	Detect int
+	// MinScore is how similar a file must be to its source, out of
+	// MaxScore; 0 is the default of 50%.
+	MinScore int
+	// FindCopiesHarder says the pairs include unmodified files, as
+	// sources of copies.
+	FindCopiesHarder bool
+	// Break splits pairs rewritten beyond BreakScore into a deletion and
+	// a creation, so that their halves can pair up with other files.
+	// Halves that don't are joined again, and keep their dissimilarity
+	// when it is above MergeScore.
+	Break                  bool
+	BreakScore, MergeScore int
+	// Limit caps the sources times destinations compared inexactly, as
+	// Limit squared; 0 is unlimited.
+	Limit int
+}
+
+// spec is one side of a queued pair, shared between the pairs that use
+// it, like git's diff_filespec.
+type spec struct {
+	File
+	renameUsed int
+	data       []byte
+	loaded     bool
+	spans      *spanCount
+}
+
+type queued struct {
+	one, two        *spec
+	score           int
+	broken, renamed bool
+	unmerged        bool
+}
+
+// unmodified reports whether a pair changes nothing, not even the path.
+func (q *queued) unmodified() bool {
+	return q.one.Exists() && q.two.Exists() && q.one.Path == q.two.Path && q.one.Sha == q.two.Sha && q.one.Mode == q.two.Mode
+}
+
+type renameSrc struct {
+	p     *queued
+	score int
+}
+
+type renameDst struct {
+	p        *queued
+	isRename bool
+}
+
+type renameScore struct {
+	src, dst  int
+	score     int
+	nameScore int
+}
+
+type renamer struct {
+	store *object.Store
+	opts  RenameOptions
+	queue []*queued
+	err   error
+}
+
+// Detect finds renames and copies among the pairs, and breaks rewritten
+// pairs with opts.Break, the way diffcore_std does. Renamed and copied
+// pairs take the place of their creations; pairs in the input without
+// changes, which FindCopiesHarder asks for, are dropped.
+// ref: https://github.com/git/git/blob/master/diffcore-rename.c
+func Detect(store *object.Store, pairs []FilePair, opts RenameOptions) ([]FilePair, error) {
+	r := &renamer{store: store, opts: opts}
+	for _, p := range pairs {
+		one, two := &spec{File: p.Old}, &spec{File: p.New}
+		if !one.Exists() {
+			one.Path = p.New.Path
+		}
+		if !two.Exists() {
+			two.Path = p.Old.Path
+		}
+		r.queue = append(r.queue, &queued{one: one, two: two, score: p.Score, unmerged: p.Status == Unmerged})
+	}
+	if opts.Break {
+		r.breakPairs()
+	}
+	if opts.Detect != 0 {
+		r.rename()
+	}
+	if opts.Break {
+		r.mergeBroken()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.resolve(), nil
+}
+
+// load reads the contents of a side, remembering the first error.
+func (r *renamer) load(s *spec) []byte {
+	if s.loaded {
+		return s.data
+	}
+	s.loaded = true
+	if s.Contents != nil {
+		s.data = s.Contents
+		return s.data
+	}
+	data, err := r.store.ReadType(s.Sha, "blob")
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	s.data = data
+	return s.data
+}
+
+func (r *renamer) spans(s *spec) *spanCount {
+	if s.spans == nil {
+		s.spans = countSpans(r.load(s))
+	}
+	return s.spans
+}
+
+func isRegular(mode string) bool {
+	return strings.HasPrefix(mode, "100")
+}
+
+func isBlob(mode string) bool {
+	return isRegular(mode) || mode == "120000"
+}
+
+// basenameSame reports whether two paths end in the same file name.
+func basenameSame(a, b string) bool {
+	return a[strings.LastIndexByte(a, '/')+1:] == b[strings.LastIndexByte(b, '/')+1:]
+}
+
+// estimate scores how much of dst comes from src. Only regular files are
+// compared, and files whose sizes differ too much for minScore aren't.
+func (r *renamer) estimate(src, dst *spec, minScore int) int {
+	if !isRegular(src.Mode) || !isRegular(dst.Mode) {
+		return 0
+	}
+	srcSize, dstSize := len(r.load(src)), len(r.load(dst))
+	maxSize, baseSize := srcSize, dstSize
+	if maxSize < baseSize {
+		maxSize, baseSize = baseSize, maxSize
+	}
+	if maxSize*(MaxScore-minScore) < (maxSize-baseSize)*MaxScore {
+		return 0
+	}
+	if dstSize == 0 {
+		return 0
+	}
+	copied, _ := countChanges(r.spans(src), r.spans(dst))
+	return copied * MaxScore / maxSize
+}
+
+// rename pairs up creations with deletions, and with -C with the other
+// sources: exact matches first, then files of the same name, then the
+// most similar.
+func (r *renamer) rename() {
+	wantCopies := r.opts.Detect == DetectCopies
+	minScore := r.opts.MinScore
+	if minScore == 0 {
+		minScore = DefaultRenameScore
+	}
+	var srcs []renameSrc
+	var dsts []*renameDst
+	broken := false
+	for _, p := range r.queue {
+		switch {
+		case p.unmerged:
+		case !p.one.Exists():
+			if p.two.Exists() {
+				dsts = append(dsts, &renameDst{p: p})
+				broken = broken || p.broken
+			}
+		case !p.two.Exists():
+			// A broken deletion not worth keeping apart stays in the tree.
+			if p.broken && p.score == 0 {
+				p.one.renameUsed++
+			}
+			srcs = append(srcs, renameSrc{p, p.score})
+		case wantCopies:
+			// The source stays as well.
+			p.one.renameUsed++
+			srcs = append(srcs, renameSrc{p, p.score})
+		}
+	}
+	record := func(dst *renameDst, src renameSrc, score int) {
+		src.p.one.renameUsed++
+		dst.isRename = true
+		dst.p.one = src.p.one
+		dst.p.renamed = true
+		if dst.p.one.Path == dst.p.two.Path {
+			dst.p.score = src.score
+		} else {
+			dst.p.score = score
+		}
+	}
+	if len(srcs) > 0 && len(dsts) > 0 {
+		renames := r.exactRenames(srcs, dsts, wantCopies, record)
+		if minScore != MaxScore {
+			r.inexactRenames(srcs, dsts, renames, minScore, wantCopies, broken, record)
+		}
+	}
+
+	// The renamed creations stand for their sources now.
+	out := []*queued{}
+	for _, p := range r.queue {
+		switch {
+		case p.unmerged || !p.one.Exists() && p.two.Exists():
+			out = append(out, p)
+		case p.one.Exists() && !p.two.Exists():
+			keep := p.one.renameUsed == 0
+			if p.broken {
+				keep = true
+				for _, dst := range dsts {
+					if dst.p.two.Path == p.one.Path {
+						keep = !dst.isRename
+						break
+					}
+				}
+			}
+			if keep {
+				out = append(out, p)
+			}
+		case !p.unmodified():
+			out = append(out, p)
+		}
+	}
+	r.queue = out
+}
+
+// exactRenames matches destinations with sources of the same contents,
+// preferring unused sources and the same file name.
+func (r *renamer) exactRenames(srcs []renameSrc, dsts []*renameDst, wantCopies bool, record func(*renameDst, renameSrc, int)) int {
+	renames := 0
+	for _, dst := range dsts {
+		two := dst.p.two
+		best, bestScore := -1, -1
+		left := 100
+		for i, src := range srcs {
+			one := src.p.one
+			if one.Sha != two.Sha {
+				continue
+			}
+			if (!isRegular(one.Mode) || !isRegular(two.Mode)) && one.Mode != two.Mode {
+				continue
+			}
+			if one.renameUsed > 0 && !wantCopies {
+				continue
+			}
+			score := 0
+			if one.renameUsed == 0 {
+				score++
+			}
+			if basenameSame(one.Path, two.Path) {
+				score++
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+				if score == 2 {
+					break
+				}
+			}
+			if left--; left == 0 {
+				break
+			}
+		}
+		if best >= 0 {
+			record(dst, srcs[best], MaxScore)
+			renames++
+		}
+	}
+	return renames
+}
+
+// unusedSources drops the sources renames have used.
+func unusedSources(srcs []renameSrc) []renameSrc {
+	kept := []renameSrc{}
+	for _, src := range srcs {
+		if src.p.one.renameUsed == 0 {
+			kept = append(kept, src)
+		}
+	}
+	return kept
+}
+
+// inexactRenames scores the remaining destinations against every source
+// and records the best pairs above minScore.
+func (r *renamer) inexactRenames(srcs []renameSrc, dsts []*renameDst, renames, minScore int, wantCopies, broken bool, record func(*renameDst, renameSrc, int)) {
+	if !wantCopies && !broken {
+		srcs = unusedSources(srcs)
+		renames += r.basenameRenames(srcs, dsts, minScore+(MaxScore-minScore)/2, record)
+		srcs = unusedSources(srcs)
+	}
+	numDsts := len(dsts) - renames
+	if numDsts == 0 || len(srcs) == 0 {
+		return
+	}
+	skipUnmodified := false
+	if limit := r.opts.Limit; limit > 0 && numDsts*len(srcs) > limit*limit {
+		if !r.opts.FindCopiesHarder {
+			return
+		}
+		// Fall back to -C from --find-copies-harder when that fits.
+		modified := 0
+		for _, src := range srcs {
+			if !src.p.unmodified() {
+				modified++
+			}
+		}
+		if numDsts*modified > limit*limit {
+			return
+		}
+		skipUnmodified = true
+	}
+	scores := []renameScore{}
+	for i, dst := range dsts {
+		if dst.isRename {
+			continue
+		}
+		m := make([]renameScore, candidatesPerDst)
+		for k := range m {
+			m[k].dst = -1
+		}
+		for j, src := range srcs {
+			if skipUnmodified && src.p.unmodified() {
+				continue
+			}
+			one, two := src.p.one, dst.p.two
+			s := renameScore{src: j, dst: i, score: r.estimate(one, two, minScore)}
+			if basenameSame(one.Path, two.Path) {
+				s.nameScore = 1
+			}
+			recordIfBetter(m, s)
+		}
+		scores = append(scores, m...)
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return compareScores(scores[i], scores[j]) < 0 })
+	for _, copies := range []bool{false, true} {
+		if copies && !wantCopies {
+			break
+		}
+		for _, s := range scores {
+			if s.dst < 0 || s.score < minScore {
+				break
+			}
+			dst := dsts[s.dst]
+			if dst.isRename || !copies && srcs[s.src].p.one.renameUsed > 0 {
+				continue
+			}
+			record(dst, srcs[s.src], s.score)
+		}
+	}
+}
+
+// basenameRenames pairs sources and destinations whose file names are
+// unique on both sides, when they are similar enough.
+func (r *renamer) basenameRenames(srcs []renameSrc, dsts []*renameDst, minScore int, record func(*renameDst, renameSrc, int)) int {
+	base := func(p string) string {
+		return p[strings.LastIndexByte(p, '/')+1:]
+	}
+	unique := func(m map[string]int, name string, i int) {
+		if _, ok := m[name]; ok {
+			m[name] = -1
+		} else {
+			m[name] = i
+		}
+	}
+	sources, dests := map[string]int{}, map[string]int{}
+	for i, src := range srcs {
+		unique(sources, base(src.p.one.Path), i)
+	}
+	for i, dst := range dsts {
+		if !dst.isRename {
+			unique(dests, base(dst.p.two.Path), i)
+		}
+	}
+	renames := 0
+	for i, src := range srcs {
+		name := base(src.p.one.Path)
+		d, ok := dests[name]
+		if !ok || sources[name] != i || d < 0 || dsts[d].isRename {
+			continue
+		}
+		if score := r.estimate(src.p.one, dsts[d].p.two, minScore); score >= minScore {
+			record(dsts[d], src, score)
+			renames++
+		}
+	}
+	return renames
+}
+
+// compareScores sorts candidates by score, then by matching file names,
+// with unused slots last.
+func compareScores(a, b renameScore) int {
+	switch {
+	case a.dst < 0 && b.dst < 0:
+		return 0
+	case a.dst < 0:
+		return 1
+	case b.dst < 0:
+		return -1
+	case a.score == b.score:
+		return b.nameScore - a.nameScore
+	}
+	return b.score - a.score
+}
+
+// recordIfBetter keeps s among the best candidates of a destination.
+func recordIfBetter(m []renameScore, s renameScore) {
+	worst := 0
+	for i := 1; i < len(m); i++ {
+		if compareScores(m[i], m[worst]) > 0 {
+			worst = i
+		}
+	}
+	if compareScores(m[worst], s) > 0 {
+		m[worst] = s
+	}
+}
+
+// breakPairs splits the modifications that rewrite most of a file into a
+// deletion and a creation.
+// ref: https://github.com/git/git/blob/master/diffcore-break.c
+func (r *renamer) breakPairs() {
+	breakScore, mergeScore := r.opts.BreakScore, r.opts.MergeScore
+	if breakScore == 0 {
+		breakScore = DefaultBreakScore
+	}
+	if mergeScore == 0 {
+		mergeScore = DefaultMergeScore
+	}
+	out := []*queued{}
+	for _, p := range r.queue {
+		if p.unmerged || !p.one.Exists() || !p.two.Exists() || !isBlob(p.one.Mode) || !isBlob(p.two.Mode) {
+			out = append(out, p)
+			continue
+		}
+		brk, score := r.shouldBreak(p.one, p.two, breakScore)
+		if !brk {
+			out = append(out, p)
+			continue
+		}
+		if score < mergeScore {
+			score = 0
+		}
+		out = append(out,
+			&queued{one: p.one, two: &spec{File: File{Path: p.one.Path}}, score: score, broken: true},
+			&queued{one: &spec{File: File{Path: p.two.Path}}, two: p.two, score: score, broken: true})
+	}
+	r.queue = out
+}
+
+// shouldBreak decides whether dst is so different from src that it is
+// better seen as a deletion and a creation, and returns how much of src
+// was removed as the score to keep if the halves are joined again.
+func (r *renamer) shouldBreak(src, dst *spec, breakScore int) (bool, int) {
+	if isRegular(src.Mode) != isRegular(dst.Mode) {
+		return true, MaxScore
+	}
+	if src.Sha == dst.Sha {
+		return false, 0
+	}
+	srcSize, dstSize := len(r.load(src)), len(r.load(dst))
+	maxSize := srcSize
+	if dstSize > maxSize {
+		maxSize = dstSize
+	}
+	if maxSize < minimumBreakSize || srcSize == 0 {
+		return false, 0
+	}
+	copied, added := countChanges(r.spans(src), r.spans(dst))
+	if srcSize < copied {
+		copied = srcSize
+	}
+	if dstSize < added+copied {
+		if copied < dstSize {
+			added = dstSize - copied
+		} else {
+			added = 0
+		}
+	}
+	removed := srcSize - copied
+	mergeScore := removed * MaxScore / srcSize
+	if mergeScore > breakScore {
+		return true, mergeScore
+	}
+	// The extent of damage counts both insertions and deletions.
+	if (removed+added)*MaxScore/maxSize < breakScore {
+		return false, mergeScore
+	}
+	if srcSize*breakScore < removed*MaxScore && added*20 < removed && added*20 < copied {
+		return false, mergeScore
+	}
+	return true, mergeScore
+}
+
+// mergeBroken joins the halves of broken pairs that both survived rename
+// detection.
+func (r *renamer) mergeBroken() {
+	out := []*queued{}
+	for i, p := range r.queue {
+		if p == nil {
+			continue
+		}
+		if !p.broken || p.one.Path != p.two.Path {
+			out = append(out, p)
+			continue
+		}
+		merged := false
+		for j := i + 1; j < len(r.queue); j++ {
+			pp := r.queue[j]
+			if pp == nil || !pp.broken || pp.one.Path != pp.two.Path || p.one.Path != pp.two.Path {
+				continue
+			}
+			del, create := p, pp
+			if !p.one.Exists() {
+				del, create = pp, p
+			}
+			out = append(out, &queued{one: del.one, two: create.two, score: p.score})
+			del.one.renameUsed++
+			r.queue[j] = nil
+			merged = true
+			break
+		}
+		if !merged {
+			out = append(out, p)
+		}
+	}
+	r.queue = out
+}
+
+// resolve turns the queue back into pairs with their statuses. A source
+// used by several renames is copied by all but the last.
+func (r *renamer) resolve() []FilePair {
+	pairs := []FilePair{}
+	for _, p := range r.queue {
+		pair := FilePair{Old: p.one.File, New: p.two.File, Score: p.score}
+		switch {
+		case p.unmerged:
+			pair.Status = Unmerged
+		case !p.one.Exists():
+			pair.Status, pair.Old = Added, File{}
+		case !p.two.Exists():
+			pair.Status, pair.New = Deleted, File{}
+		case fileType(p.one.Mode) != fileType(p.two.Mode):
+			pair.Status = TypeChanged
+		case p.renamed:
+			if p.one.Path == p.two.Path {
+				pair.Status = Modified
+			} else if p.one.renameUsed--; p.one.renameUsed > 0 {
+				pair.Status = Copied
+			} else {
+				pair.Status = Renamed
+			}
+		case !p.unmodified():
+			pair.Status = Modified
+		default:
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
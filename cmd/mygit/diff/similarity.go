@@ -0,0 +1,119 @@
+package diff
+
+import "sort"
+
+// MaxScore is the scale of similarity scores: two files with this score
+// are identical.
+const MaxScore = 60000
+
+// spanHashBase is the modulus of the chunk hashes.
+const spanHashBase = 107927
+
+// spanCount is how many bytes of a file fall in chunks of each hash.
+type spanCount struct {
+	hashes []uint32 // sorted
+	counts map[uint32]int
+}
+
+// countSpans cuts data into chunks that end at a newline or after 64
+// bytes, and counts the bytes by chunk hash. Text files don't count the
+// CR of CRLF, so that line endings don't make files dissimilar.
+// ref: https://github.com/git/git/blob/master/diffcore-delta.c
+func countSpans(data []byte) *spanCount {
+	sc := &spanCount{counts: map[uint32]int{}}
+	add := func(hash uint32, n int) {
+		if _, ok := sc.counts[hash]; !ok {
+			sc.hashes = append(sc.hashes, hash)
+		}
+		sc.counts[hash] += n
+	}
+	isText := !IsBinary(data)
+	var accum1, accum2 uint32
+	n := 0
+	for i := 0; i < len(data); i++ {
+		c := uint32(data[i])
+		if isText && c == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			continue
+		}
+		old1 := accum1
+		accum1 = (accum1 << 7) ^ (accum2 >> 25)
+		accum2 = (accum2 << 7) ^ (old1 >> 25)
+		accum1 += c
+		n++
+		if n < 64 && c != '\n' {
+			continue
+		}
+		add((accum1+accum2*0x61)%spanHashBase, n)
+		n, accum1, accum2 = 0, 0, 0
+	}
+	if n > 0 {
+		add((accum1+accum2*0x61)%spanHashBase, n)
+	}
+	sort.Slice(sc.hashes, func(i, j int) bool { return sc.hashes[i] < sc.hashes[j] })
+	return sc
+}
+
+// countChanges compares the chunks of src and dst: how many bytes of dst
+// were copied from src, and how many are new.
+func countChanges(src, dst *spanCount) (copied, added int) {
+	d := 0
+	for _, h := range src.hashes {
+		for d < len(dst.hashes) && dst.hashes[d] < h {
+			added += dst.counts[dst.hashes[d]]
+			d++
+		}
+		srcCnt, dstCnt := src.counts[h], 0
+		if d < len(dst.hashes) && dst.hashes[d] == h {
+			dstCnt = dst.counts[h]
+			d++
+		}
+		if srcCnt < dstCnt {
+			added += dstCnt - srcCnt
+			copied += srcCnt
+		} else {
+			copied += dstCnt
+		}
+	}
+	for ; d < len(dst.hashes); d++ {
+		added += dst.counts[dst.hashes[d]]
+	}
+	return copied, added
+}
+
+// ParseScore reads a similarity such as the "50%" of -M50%. Digits
+// without "%" are a fraction, so "5" is 50% and "05" is 5%.
+func ParseScore(s string) (int, string) {
+	num, scale := 0, 1
+	dot := false
+	i := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		if !dot && c == '.' {
+			scale, dot = 1, true
+		} else if c == '%' {
+			if dot {
+				scale *= 100
+			} else {
+				scale = 100
+			}
+			i++
+			break
+		} else if c >= '0' && c <= '9' {
+			if scale < 100000 {
+				scale *= 10
+				num = num*10 + int(c-'0')
+			}
+		} else {
+			break
+		}
+	}
+	if num >= scale {
+		return MaxScore, s[i:]
+	}
+	return MaxScore * num / scale, s[i:]
+}
+
+// SimilarityIndex is a score in percent, as diffs show it.
+func SimilarityIndex(score int) int {
+	return score * 100 / MaxScore
+}
@@ -0,0 +1,332 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/color"
+)
+
+// FileStat counts the lines a pair adds and deletes; for binary files
+// the counts are the sizes of the new and old blobs.
+type FileStat struct {
+	Name             string
+	Added, Deleted   int
+	Binary           bool
+	ContentUnchanged bool // only the mode changed
+	Unmerged         bool
+}
+
+// Stat counts the changes of one pair.
+func (p *Printer) Stat(pair FilePair) (FileStat, error) {
+	st := FileStat{Name: QuotePath(pair.Path())}
+	if pair.Status == Renamed || pair.Status == Copied {
+		st.Name = RenameName(pair.Old.Path, pair.New.Path)
+	}
+	if pair.Status == Unmerged {
+		st.Unmerged = true
+		return st, nil
+	}
+	if pair.Old.Sha == pair.New.Sha {
+		st.ContentUnchanged = true
+		return st, nil
+	}
+	a, err := p.content(pair.Old)
+	if err != nil {
+		return st, err
+	}
+	b, err := p.content(pair.New)
+	if err != nil {
+		return st, err
+	}
+	if IsBinary(a) || IsBinary(b) {
+		st.Binary = true
+		st.Added, st.Deleted = len(b), len(a)
+		return st, nil
+	}
+	for _, c := range Lines(a, b, p.Options).Changes {
+		st.Added += c.NewLen
+		st.Deleted += c.OldLen
+	}
+	return st, nil
+}
+
+// TerminalWidth is the width --stat fills: $COLUMNS, or 80.
+func TerminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+func decimalWidth(n int) int {
+	return len(strconv.Itoa(n))
+}
+
+// scaleLinear scales a change count to the width of the graph, keeping
+// every change visible.
+func scaleLinear(it, width, maxChange int) int {
+	if it == 0 {
+		return 0
+	}
+	return 1 + it*(width-1)/maxChange
+}
+
+// WriteStat writes the --stat histogram of the pairs and the summary
+// line.
+// ref: https://git-scm.com/docs/git-diff#Documentation/git-diff.txt---statltwidthgtltname-widthgtltcountgt
+func (p *Printer) WriteStat(pairs []FilePair) error {
+	stats := []FileStat{}
+	for _, pair := range pairs {
+		if Unchanged(pair) {
+			continue
+		}
+		st, err := p.Stat(pair)
+		if err != nil {
+			return err
+		}
+		stats = append(stats, st)
+	}
+	if len(stats) == 0 {
+		return nil
+	}
+	maxLen, maxChange, numberWidth, binWidth := 0, 0, 0, 0
+	for _, st := range stats {
+		if len(st.Name) > maxLen {
+			maxLen = len(st.Name)
+		}
+		if st.Binary {
+			if w := 14 + decimalWidth(st.Added) + decimalWidth(st.Deleted); w > binWidth {
+				binWidth = w
+			}
+			numberWidth = 3
+			continue
+		}
+		if change := st.Added + st.Deleted; change > maxChange {
+			maxChange = change
+		}
+	}
+	width := p.Width
+	if width == 0 {
+		width = TerminalWidth()
+		if p.Prefix != nil {
+			width -= len(p.Prefix())
+		}
+	}
+	if w := decimalWidth(maxChange); w > numberWidth {
+		numberWidth = w
+	}
+	if width < 16+6+numberWidth {
+		width = 16 + 6 + numberWidth
+	}
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	nameWidth := maxLen
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = width*3/8 - numberWidth - 6
+			if graphWidth < 6 {
+				graphWidth = 6
+			}
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	files, insertions, deletions := 0, 0, 0
+	for _, st := range stats {
+		if !st.Unmerged {
+			files++
+		}
+		name, prefix := st.Name, ""
+		length := nameWidth
+		if nameWidth < len(name) {
+			prefix = "..."
+			length -= 3
+			if length < 0 {
+				length = 0
+			}
+			name = name[len(name)-length:]
+			if i := strings.IndexByte(name, '/'); i >= 0 {
+				name = name[i:]
+			}
+		}
+		padding := length - len(name)
+		if padding < 0 {
+			padding = 0
+		}
+		if st.Unmerged {
+			p.line(fmt.Sprintf(" %s%s%*s | Unmerged\n", prefix, name, padding, ""))
+			continue
+		}
+		if st.Binary {
+			line := fmt.Sprintf(" %s%s%*s | %*s", prefix, name, padding, "", numberWidth, "Bin")
+			if st.Added != 0 || st.Deleted != 0 {
+				line += fmt.Sprintf(" %d -> %d bytes", st.Deleted, st.Added)
+			}
+			p.line(line + "\n")
+			continue
+		}
+		insertions += st.Added
+		deletions += st.Deleted
+		add, del := st.Added, st.Deleted
+		if graphWidth <= maxChange {
+			total := scaleLinear(add+del, graphWidth, maxChange)
+			if total < 2 && add > 0 && del > 0 {
+				total = 2
+			}
+			if add < del {
+				add = scaleLinear(add, graphWidth, maxChange)
+				del = total - add
+			} else {
+				del = scaleLinear(del, graphWidth, maxChange)
+				add = total - del
+			}
+		}
+		sep := ""
+		if st.Added+st.Deleted > 0 {
+			sep = " "
+		}
+		p.line(fmt.Sprintf(" %s%s%*s | %*d%s%s%s\n", prefix, name, padding, "",
+			numberWidth, st.Added+st.Deleted, sep, p.statGraph(add, "+"), p.statGraph(del, "-")))
+	}
+	p.line(StatSummary(files, insertions, deletions) + "\n")
+	return nil
+}
+
+// statGraph is the run of n pluses or minuses of a --stat line, in the
+// color of new or old lines.
+func (p *Printer) statGraph(n int, sign string) string {
+	run := strings.Repeat(sign, n)
+	if p.Colors == nil || n == 0 {
+		return run
+	}
+	if sign == "+" {
+		return p.Colors.New + run + color.Reset
+	}
+	return p.Colors.Old + run + color.Reset
+}
+
+// WriteNumStat writes "--numstat": the lines added and deleted by each
+// pair and its path, with "-" for the counts of binary files. With -z a
+// rename gives both paths as fields of their own.
+func (p *Printer) WriteNumStat(pairs []FilePair) error {
+	for _, pair := range pairs {
+		if Unchanged(pair) {
+			continue
+		}
+		st, err := p.Stat(pair)
+		if err != nil {
+			return err
+		}
+		counts := fmt.Sprintf("%d\t%d\t", st.Added, st.Deleted)
+		if st.Binary {
+			counts = "-\t-\t"
+		}
+		switch {
+		case !p.NulTerminated:
+			p.line(counts + st.Name + "\n")
+		case pair.Status == Renamed || pair.Status == Copied:
+			p.line(counts + "\x00" + pair.Old.Path + "\x00" + pair.New.Path + "\x00")
+		default:
+			p.line(counts + pair.Path() + "\x00")
+		}
+	}
+	return nil
+}
+
+// WriteShortStat writes the summary line of --stat alone.
+func (p *Printer) WriteShortStat(pairs []FilePair) error {
+	files, insertions, deletions := 0, 0, 0
+	for _, pair := range pairs {
+		if Unchanged(pair) {
+			continue
+		}
+		st, err := p.Stat(pair)
+		if err != nil {
+			return err
+		}
+		if st.Unmerged {
+			continue
+		}
+		files++
+		if !st.Binary {
+			insertions += st.Added
+			deletions += st.Deleted
+		}
+	}
+	if files > 0 {
+		p.line(StatSummary(files, insertions, deletions) + "\n")
+	}
+	return nil
+}
+
+// WriteSummary writes what --summary shows: the files created and
+// deleted, renamed and copied, rewritten, and the changes of mode.
+// ref: diff_summary in https://github.com/git/git/blob/master/diff.c
+func (p *Printer) WriteSummary(pairs []FilePair) {
+	modeChange := func(pair FilePair, name bool) {
+		if pair.Old.Exists() && pair.New.Exists() && pair.Old.Mode != pair.New.Mode {
+			if name {
+				p.line(fmt.Sprintf(" mode change %s => %s %s\n", pair.Old.Mode, pair.New.Mode, QuotePath(pair.New.Path)))
+			} else {
+				p.line(fmt.Sprintf(" mode change %s => %s\n", pair.Old.Mode, pair.New.Mode))
+			}
+		}
+	}
+	for _, pair := range pairs {
+		switch pair.Status {
+		case Deleted:
+			p.line(fmt.Sprintf(" delete mode %s %s\n", pair.Old.Mode, QuotePath(pair.Old.Path)))
+		case Added:
+			p.line(fmt.Sprintf(" create mode %s %s\n", pair.New.Mode, QuotePath(pair.New.Path)))
+		case Renamed, Copied:
+			what := "rename"
+			if pair.Status == Copied {
+				what = "copy"
+			}
+			p.line(fmt.Sprintf(" %s %s (%d%%)\n", what, RenameName(pair.Old.Path, pair.New.Path), SimilarityIndex(pair.Score)))
+			modeChange(pair, false)
+		default:
+			if pair.Score > 0 {
+				p.line(fmt.Sprintf(" rewrite %s (%d%%)\n", QuotePath(pair.New.Path), SimilarityIndex(pair.Score)))
+				modeChange(pair, false)
+			} else {
+				modeChange(pair, true)
+			}
+		}
+	}
+}
+
+// StatSummary is the last line of --stat and --shortstat.
+func StatSummary(files, insertions, deletions int) string {
+	if files == 0 {
+		return " 0 files changed"
+	}
+	s := fmt.Sprintf(" %d files changed", files)
+	if files == 1 {
+		s = " 1 file changed"
+	}
+	if insertions > 0 || deletions == 0 {
+		if insertions == 1 {
+			s += ", 1 insertion(+)"
+		} else {
+			s += fmt.Sprintf(", %d insertions(+)", insertions)
+		}
+	}
+	if deletions > 0 || insertions == 0 {
+		if deletions == 1 {
+			s += ", 1 deletion(-)"
+		} else {
+			s += fmt.Sprintf(", %d deletions(-)", deletions)
+		}
+	}
+	return s
+}
@@ -0,0 +1,236 @@
+package diff
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// Statuses of a FilePair, as in "git diff --name-status".
+const (
+	Added       = 'A'
+	Copied      = 'C'
+	Deleted     = 'D'
+	Modified    = 'M'
+	Renamed     = 'R'
+	TypeChanged = 'T'
+	Unmerged    = 'U'
+)
+
+// File is one side of a FilePair. An absent side has an empty Mode.
+type File struct {
+	Path string
+	Mode string // six octal digits, "040000" for trees
+	Sha  string
+	// Contents is set for a side that isn't in the object store, such
+	// as a file of the work tree. The raw format shows no object name
+	// for such a side.
+	Contents []byte
+}
+
+// Exists reports whether the side has a file at all.
+func (f File) Exists() bool { return f.Mode != "" }
+
+// IsTree reports whether the side is a directory.
+func (f File) IsTree() bool { return f.Mode == "040000" }
+
+// FilePair is a path that differs between two sides, like git's
+// diff_filepair.
+type FilePair struct {
+	Status   byte
+	Old, New File
+	// Score is out of MaxScore: the similarity of a rename or copy, or
+	// the dissimilarity of a rewritten file.
+	Score int
+}
+
+// Path is the name to show for the pair.
+func (p FilePair) Path() string {
+	if p.New.Exists() {
+		return p.New.Path
+	}
+	return p.Old.Path
+}
+
+// TreeOptions select what Trees compares.
+type TreeOptions struct {
+	// Recursive descends into changed subtrees instead of reporting them.
+	Recursive bool
+	// ShowTrees reports the subtrees Recursive descends into as well.
+	ShowTrees bool
+	// Paths limit the comparison to these paths, relative to the top.
+	// An empty path matches everything.
+	Paths []string
+	// Unmodified reports the files that didn't change as well, as
+	// modifications to themselves, for Detect to copy from.
+	Unmodified bool
+	// StatDirty reports the work tree files whose stat data doesn't
+	// match the index even when their contents do, as the plumbing
+	// commands do since they don't hash files to find out.
+	StatDirty bool
+	// MissingAsIndexed takes the files missing from the work tree to be
+	// as the index has them instead of deleted.
+	MissingAsIndexed bool
+}
+
+// Trees compares two trees and returns the changed entries in tree order.
+// An empty tree name stands for the empty tree.
+// ref: https://github.com/git/git/blob/master/tree-diff.c
+func Trees(store *object.Store, oldTree, newTree string, opts TreeOptions) ([]FilePair, error) {
+	pairs := []FilePair{}
+	err := diffTrees(store, oldTree, newTree, "", opts, &pairs)
+	return pairs, err
+}
+
+// NormalizeMode writes a tree entry mode with six digits, as diffs show it.
+func NormalizeMode(mode string) string {
+	if len(mode) < 6 {
+		return strings.Repeat("0", 6-len(mode)) + mode
+	}
+	return mode
+}
+
+func readTree(store *object.Store, sha string) ([]object.TreeEntry, error) {
+	if sha == "" {
+		return nil, nil
+	}
+	contents, err := store.ReadType(sha, "tree")
+	if err != nil {
+		return nil, err
+	}
+	return object.ParseTree(contents, store.Algo)
+}
+
+// compareEntries orders tree entries the way trees sort them: names
+// compare as if directories ended in "/".
+func compareEntries(a, b object.TreeEntry) int {
+	na, nb := a.Name, b.Name
+	if a.IsTree() {
+		na += "/"
+	}
+	if b.IsTree() {
+		nb += "/"
+	}
+	return strings.Compare(na, nb)
+}
+
+func diffTrees(store *object.Store, oldTree, newTree, base string, opts TreeOptions, pairs *[]FilePair) error {
+	if oldTree == newTree && !opts.Unmodified {
+		return nil
+	}
+	olds, err := readTree(store, oldTree)
+	if err != nil {
+		return err
+	}
+	news, err := readTree(store, newTree)
+	if err != nil {
+		return err
+	}
+	for len(olds) > 0 || len(news) > 0 {
+		c := 0
+		switch {
+		case len(olds) == 0:
+			c = 1
+		case len(news) == 0:
+			c = -1
+		default:
+			c = compareEntries(olds[0], news[0])
+		}
+		var o, n *object.TreeEntry
+		if c <= 0 {
+			o, olds = &olds[0], olds[1:]
+		}
+		if c >= 0 {
+			n, news = &news[0], news[1:]
+		}
+		if o != nil && n != nil && o.Sha == n.Sha && o.Mode == n.Mode && !opts.Unmodified {
+			continue
+		}
+		entry := o
+		if entry == nil {
+			entry = n
+		}
+		path := entry.Name
+		if base != "" {
+			path = base + "/" + entry.Name
+		}
+		if !inPaths(opts.Paths, path, entry.IsTree()) {
+			continue
+		}
+		if entry.IsTree() && (opts.Recursive || !matchesWhole(opts.Paths, path)) {
+			oldSha, newSha := "", ""
+			if o != nil {
+				oldSha = o.Sha
+			}
+			if n != nil {
+				newSha = n.Sha
+			}
+			if opts.ShowTrees && (o == nil || n == nil || o.Sha != n.Sha) {
+				*pairs = append(*pairs, treePair(o, n, path))
+			}
+			if err := diffTrees(store, oldSha, newSha, path, opts, pairs); err != nil {
+				return err
+			}
+			continue
+		}
+		*pairs = append(*pairs, treePair(o, n, path))
+	}
+	return nil
+}
+
+// treePair is the pair of two entries of path, either of which may be
+// missing.
+func treePair(o, n *object.TreeEntry, path string) FilePair {
+	pair := FilePair{Status: Modified}
+	if o != nil {
+		pair.Old = File{Path: path, Mode: NormalizeMode(o.Mode), Sha: o.Sha}
+	} else {
+		pair.Status = Added
+	}
+	if n != nil {
+		pair.New = File{Path: path, Mode: NormalizeMode(n.Mode), Sha: n.Sha}
+	} else {
+		pair.Status = Deleted
+	}
+	if pair.Status == Modified && fileType(pair.Old.Mode) != fileType(pair.New.Mode) {
+		pair.Status = TypeChanged
+	}
+	return pair
+}
+
+// fileType is the kind of entry a mode stands for: regular file (either
+// permission), symlink, gitlink or tree.
+func fileType(mode string) string {
+	if strings.HasPrefix(mode, "100") {
+		return "100"
+	}
+	return mode
+}
+
+// inPaths reports whether a path is inside one of paths, or for a tree
+// leads to one of them.
+func inPaths(paths []string, name string, tree bool) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if p == "" || name == p || strings.HasPrefix(name, p+"/") || (tree && strings.HasPrefix(p, name+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWhole reports whether a tree is wholly inside the paths, so
+// that it can be reported without descending into it.
+func matchesWhole(paths []string, name string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if p == "" || name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// funcLineMax is how much of a function line hunk headers show.
+const funcLineMax = 80
+
+// Unified calls emit with each line of the unified diff of r, newline
+// included, hunk headers first.
+// ref: https://github.com/git/git/blob/master/xdiff/xemit.c
+func (r *Result) Unified(opts Options, emit func(line string)) {
+	ctx := opts.Context
+	changes := r.Changes
+	funcLine := ""
+	funcLinePrev := -1
+	for next := 0; next < len(changes); {
+		skipped := next
+		first, last := r.hunk(next, opts)
+		if last < 0 {
+			break
+		}
+
+		var s1, s2 int
+		for {
+			s1, s2 = max(changes[first].Old-ctx, 0), max(changes[first].New-ctx, 0)
+			if !opts.FunctionContext {
+				break
+			}
+			i1 := changes[first].Old
+			if i1 >= len(r.Old) {
+				// A whole function added needs no more context;
+				// otherwise take it from the end of the old side.
+				if r.addsFunction(changes[first].New, opts) {
+					break
+				}
+				i1 = len(r.Old) - 1
+			}
+			fs1, _ := r.funcLine(opts, i1, -1)
+			for fs1 > 0 && !isEmptyLine(r.Old[fs1-1]) && !r.isFuncLine(opts, r.Old[fs1-1]) {
+				fs1--
+			}
+			if fs1 < 0 {
+				fs1 = 0
+			}
+			if fs1 >= s1 {
+				break
+			}
+			s2 = max(s2-(s1-fs1), 0)
+			s1 = fs1
+			// Show the ignored changes the function reaches back to after
+			// all.
+			for skipped != first && changes[skipped].Old+changes[skipped].OldLen <= s1 &&
+				changes[skipped].New+changes[skipped].NewLen <= s2 {
+				skipped++
+			}
+			if skipped == first {
+				break
+			}
+			first = skipped
+		}
+
+		var e1, e2 int
+		for {
+			end1, end2 := changes[last].Old+changes[last].OldLen, changes[last].New+changes[last].NewLen
+			lctx := min(ctx, min(len(r.Old)-end1, len(r.New)-end2))
+			e1, e2 = end1+lctx, end2+lctx
+			if !opts.FunctionContext {
+				break
+			}
+			fe1, _ := r.funcLine(opts, end1, len(r.Old))
+			for fe1 > 0 && isEmptyLine(r.Old[fe1-1]) {
+				fe1--
+			}
+			if fe1 < 0 {
+				fe1 = len(r.Old)
+			}
+			if fe1 > e1 {
+				e2 = min(e2+(fe1-e1), len(r.New))
+				e1 = fe1
+			}
+			// A next change that overlaps joins this hunk, which then
+			// needs its end found again.
+			if last+1 < len(changes) {
+				l := min(changes[last+1].Old, len(r.Old)-1)
+				if l-ctx <= e1 {
+					last++
+					continue
+				}
+				if i, _ := r.funcLine(opts, l, e1); i < 0 {
+					last++
+					continue
+				}
+			}
+			break
+		}
+
+		if i, line := r.funcLine(opts, s1-1, funcLinePrev); i >= 0 {
+			funcLine = line
+		}
+		funcLinePrev = s1 - 1
+		emit(hunkHeader(s1+1, e1-s1, s2+1, e2-s2, funcLine))
+
+		for ; s2 < changes[first].New; s2++ {
+			emitLine(emit, ' ', r.New[s2])
+		}
+		for k := first; k <= last; k++ {
+			c := changes[k]
+			for ; s2 < c.New; s2++ {
+				emitLine(emit, ' ', r.New[s2])
+			}
+			for l := c.Old; l < c.Old+c.OldLen; l++ {
+				emitLine(emit, '-', r.Old[l])
+			}
+			for l := c.New; l < c.New+c.NewLen; l++ {
+				emitLine(emit, '+', r.New[l])
+			}
+			s2 = c.New + c.NewLen
+		}
+		for ; s2 < e2; s2++ {
+			emitLine(emit, ' ', r.New[s2])
+		}
+		next = last + 1
+	}
+}
+
+// hunk finds the changes that make up the next hunk from changes[i]:
+// those close enough to share context. Changes that IgnoreBlankLines
+// ignores are left out unless they are close to others. last is -1 when
+// no hunk is left.
+// ref: xdl_get_hunk in https://github.com/git/git/blob/master/xdiff/xemit.c
+func (r *Result) hunk(i int, opts Options) (first, last int) {
+	changes := r.Changes
+	maxCommon := 2*opts.Context + opts.InterHunkContext
+	maxIgnorable := opts.Context
+	first = i
+	for j := i; j < len(changes) && changes[j].Ignore; j++ {
+		if j+1 == len(changes) || changes[j+1].Old-(changes[j].Old+changes[j].OldLen) >= maxIgnorable {
+			first = j + 1
+		}
+	}
+	if first >= len(changes) {
+		return first, -1
+	}
+	last = first
+	ignored := 0
+	for prev, j := first, first+1; j < len(changes); prev, j = j, j+1 {
+		distance := changes[j].Old - (changes[prev].Old + changes[prev].OldLen)
+		if distance > maxCommon {
+			break
+		}
+		if distance < maxIgnorable && (!changes[j].Ignore || last == prev) {
+			last, ignored = j, 0
+		} else if distance < maxIgnorable && changes[j].Ignore {
+			ignored += changes[j].NewLen
+		} else if last != prev && changes[j].Old+ignored-(changes[last].Old+changes[last].OldLen) > maxCommon {
+			break
+		} else if !changes[j].Ignore {
+			last, ignored = j, 0
+		} else {
+			ignored += changes[j].NewLen
+		}
+	}
+	return first, last
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func emitLine(emit func(string), sign byte, rec []byte) {
+	if bytes.HasSuffix(rec, []byte("\n")) {
+		emit(string(sign) + string(rec))
+		return
+	}
+	emit(string(sign) + string(rec) + "\n")
+	emit("\\ No newline at end of file\n")
+}
+
+// hunkHeader writes "@@ -<start>,<count> +<start>,<count> @@ <func>"; a
+// count of one is left out, and an empty range names the line before it.
+func hunkHeader(s1, c1, s2, c2 int, funcLine string) string {
+	side := func(s, c int) string {
+		if c == 0 {
+			s--
+		}
+		if c == 1 {
+			return fmt.Sprint(s)
+		}
+		return fmt.Sprintf("%d,%d", s, c)
+	}
+	header := "@@ -" + side(s1, c1) + " +" + side(s2, c2) + " @@"
+	if funcLine != "" {
+		header += " " + funcLine
+	}
+	return header + "\n"
+}
+
+// funcLine looks from start towards limit, which it stops short of, for
+// a line of the old side that starts a function, and returns its index,
+// or -1, and what hunk headers show of it.
+func (r *Result) funcLine(opts Options, start, limit int) (int, string) {
+	step := 1
+	if start > limit {
+		step = -1
+	}
+	for l := start; l != limit && l >= 0 && l < len(r.Old); l += step {
+		if line, ok := opts.funcLine(r.Old[l]); ok {
+			return l, line
+		}
+	}
+	return -1, ""
+}
+
+func (o Options) funcLine(rec []byte) (string, bool) {
+	if o.FuncLine != nil {
+		return o.FuncLine(rec)
+	}
+	return defaultFuncLine(rec)
+}
+
+func (r *Result) isFuncLine(opts Options, rec []byte) bool {
+	_, ok := opts.funcLine(rec)
+	return ok
+}
+
+// addsFunction reports whether the new side has a function line from
+// line i on.
+func (r *Result) addsFunction(i int, opts Options) bool {
+	for ; i < len(r.New); i++ {
+		if r.isFuncLine(opts, r.New[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyLine reports whether a line has nothing but whitespace.
+func isEmptyLine(rec []byte) bool {
+	for _, c := range rec {
+		if !isSpace(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultFuncLine matches what git takes for a function line without a
+// diff driver: a line starting with a letter, "_" or "$".
+func defaultFuncLine(rec []byte) (string, bool) {
+	if len(rec) == 0 {
+		return "", false
+	}
+	c := rec[0]
+	if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$') {
+		return "", false
+	}
+	if len(rec) > funcLineMax {
+		rec = rec[:funcLineMax]
+	}
+	return string(bytes.TrimRight(rec, " \t\n\v\f\r")), true
+}
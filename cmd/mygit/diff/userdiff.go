@@ -0,0 +1,288 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/attr"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+)
+
+// Driver is a diff driver, which the "diff" attribute picks for a file:
+// how hunk headers find function lines, what word diffs take for words,
+// and whether the file is binary.
+// ref: https://git-scm.com/docs/gitattributes#_defining_a_custom_hunk_header
+type Driver struct {
+	Name      string
+	FuncName  *FuncName      // nil for git's default
+	WordRegex *regexp.Regexp // nil for runs of non-whitespace
+	// Binary makes files binary and Text makes them text whatever their
+	// contents; with neither, the contents decide.
+	Binary, Text bool
+}
+
+// FuncName matches function lines with the patterns of a driver, one per
+// line: the first to match decides, and one starting with "!" rejects
+// the line. Hunk headers show the first group of the match, or all of
+// it without groups.
+type FuncName struct {
+	patterns []funcPattern
+}
+
+type funcPattern struct {
+	re     *regexp.Regexp
+	negate bool
+}
+
+// ParseFuncName compiles the patterns of diff.<driver>.xfuncname, which
+// are extended regular expressions, or of diff.<driver>.funcname, which
+// are basic ones.
+func ParseFuncName(patterns string, extended, ignoreCase bool) (*FuncName, error) {
+	f := &FuncName{}
+	for _, line := range strings.Split(patterns, "\n") {
+		p := funcPattern{}
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+		if !extended {
+			line = basicToExtended(line)
+		}
+		re, err := CompileRegex(line, ignoreCase, false)
+		if err != nil {
+			return nil, err
+		}
+		p.re = re
+		f.patterns = append(f.patterns, p)
+	}
+	return f, nil
+}
+
+// Match is the FuncLine of Options for the patterns.
+func (f *FuncName) Match(rec []byte) (string, bool) {
+	line := strings.TrimSuffix(strings.TrimSuffix(string(rec), "\n"), "\r")
+	var m []int
+	for _, p := range f.patterns {
+		if m = p.re.FindStringSubmatchIndex(line); m != nil {
+			if p.negate {
+				return "", false
+			}
+			break
+		}
+	}
+	if m == nil {
+		return "", false
+	}
+	start, end := m[0], m[1]
+	if len(m) > 2 && m[2] >= 0 {
+		start, end = m[2], m[3]
+	}
+	if end-start > funcLineMax {
+		end = start + funcLineMax
+	}
+	return strings.TrimRightFunc(line[start:end], func(r rune) bool { return r < 0x80 && isSpace(byte(r)) }), true
+}
+
+// CompileRegex compiles a POSIX regular expression of a driver with its
+// leftmost-longest matching. multiLine makes ^ and $ match at newlines,
+// as word regexes want.
+func CompileRegex(pattern string, ignoreCase, multiLine bool) (*regexp.Regexp, error) {
+	flags := ""
+	if ignoreCase {
+		flags += "i"
+	}
+	if multiLine {
+		flags += "m"
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	re.Longest()
+	return re, nil
+}
+
+// basicToExtended rewrites a basic regular expression as an extended
+// one: "\(", "\{", "\|", "\+" and "\?" are special in the former, and
+// the bare characters literal.
+func basicToExtended(pattern string) string {
+	var b strings.Builder
+	inBracket := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case inBracket:
+			if c == ']' && !strings.HasSuffix(b.String(), "[") && !strings.HasSuffix(b.String(), "[^") {
+				inBracket = false
+			}
+			b.WriteByte(c)
+		case c == '[':
+			inBracket = true
+			b.WriteByte(c)
+		case c == '\\' && i+1 < len(pattern) && strings.IndexByte("(){}|+?", pattern[i+1]) >= 0:
+			i++
+			b.WriteByte(pattern[i])
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteByte(c)
+			b.WriteByte(pattern[i])
+		case strings.IndexByte("(){}|+?", c) >= 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// builtinDriver holds the patterns of a driver git knows without
+// configuration.
+type builtinDriver struct {
+	funcName   string
+	ignoreCase bool
+	wordRegex  string
+}
+
+// wordRegexTail is added to the word regexes of built-in drivers so that
+// any other non-space character is a word of its own.
+const wordRegexTail = "|[^[:space:]]"
+
+// builtinDrivers are some of git's built-in drivers.
+// ref: https://github.com/git/git/blob/master/userdiff.c
+var builtinDrivers = map[string]builtinDriver{
+	"bash": {
+		funcName: "^[ \t]*((([a-zA-Z_][a-zA-Z0-9_]*[ \t]*\\([ \t]*\\))" +
+			"|(function[ \t]+[a-zA-Z_][a-zA-Z0-9_]*(([ \t]*\\([ \t]*\\))|([ \t]+))))" +
+			"[ \t]*(\\{|\\(\\(?|\\[\\[))",
+		wordRegex: "[^ \t]+",
+	},
+	"cpp": {
+		funcName: "!^[ \t]*[A-Za-z_][A-Za-z_0-9]*:[[:space:]]*($|/[/*])\n" +
+			`^((::[[:space:]]*)?[A-Za-z_].*)$`,
+		wordRegex: `[a-zA-Z_][a-zA-Z0-9_]*` +
+			`|[-+0-9.e]+[fFlL]?|0[xXbB]?[0-9a-fA-F]+[lLuU]*` +
+			`|[-+*/<>%&^|=!]=|--|\+\+|<<=?|>>=?|&&|\|\||::|->\*?|\.\*|<=>`,
+	},
+	"golang": {
+		funcName: "^[ \t]*(func[ \t]*.*(\\{[ \t]*)?)\n" +
+			"^[ \t]*(type[ \t].*(struct|interface)[ \t]*(\\{[ \t]*)?)",
+		wordRegex: `[a-zA-Z_][a-zA-Z0-9_]*` +
+			`|[-+0-9.eE]+i?|0[xX]?[0-9a-fA-F]+i?` +
+			`|[-+*/<>%&^|=!:]=|--|\+\+|<<=?|>>=?|&\^=?|&&|\|\||<-|\.{3}`,
+	},
+	"python": {
+		funcName: "^[ \t]*((class|(async[ \t]+)?def)[ \t].*)$",
+		wordRegex: `[a-zA-Z_][a-zA-Z0-9_]*` +
+			`|[-+0-9.e]+[jJlL]?|0[xX]?[0-9a-fA-F]+[lL]?` +
+			`|[-+*/<>%&^|=!]=|//=?|<<=?|>>=?|\*\*=?`,
+	},
+	"rust": {
+		funcName: "^[\t ]*((pub(\\([^\\)]+\\))?[\t ]+)?((async|const|unsafe|extern([\t ]+\"[^\"]+\"))[\t ]+)?(struct|enum|union|mod|trait|fn|impl|macro_rules!)[< \t]+[^;]*)$",
+		wordRegex: `[a-zA-Z_][a-zA-Z0-9_]*` +
+			`|[0-9][0-9_a-fA-Fiosuxz]*(\.([0-9]*[eE][+-]?)?[0-9_fF]*)?` +
+			`|[-+*\/<>%&^|=!:]=|<<=?|>>=?|&&|\|\||->|=>|\.{2}=|\.{3}|::`,
+	},
+}
+
+// BuiltinDriver returns the built-in driver of a name, if git has one.
+func BuiltinDriver(name string) (*Driver, bool) {
+	b, ok := builtinDrivers[name]
+	if !ok {
+		return nil, false
+	}
+	d := &Driver{Name: name}
+	d.FuncName, _ = ParseFuncName(b.funcName, true, b.ignoreCase)
+	d.WordRegex, _ = CompileRegex(b.wordRegex+wordRegexTail, false, true)
+	return d, true
+}
+
+// Drivers picks the driver of paths by their "diff" attribute: setting
+// it makes a file text, unsetting it binary, and a value names a driver
+// whose diff.<driver>.* settings go over the built-in ones.
+type Drivers struct {
+	attrs *attr.Matcher
+	cfg   *config.Config
+	named map[string]*Driver
+}
+
+// NewDrivers looks drivers up with the attributes and settings of a
+// repository.
+func NewDrivers(attrs *attr.Matcher, cfg *config.Config) *Drivers {
+	return &Drivers{attrs: attrs, cfg: cfg, named: map[string]*Driver{}}
+}
+
+// For returns the driver of a path, or nil when it has none. Drivers
+// may be nil, for none at all.
+func (d *Drivers) For(path string) (*Driver, error) {
+	if d == nil {
+		return nil, nil
+	}
+	a := d.attrs.Get(path, "diff")
+	switch a.State {
+	case attr.Set:
+		return &Driver{Text: true}, nil
+	case attr.Unset:
+		return &Driver{Binary: true}, nil
+	case attr.Value:
+		return d.byName(a.Value)
+	}
+	return nil, nil
+}
+
+func (d *Drivers) byName(name string) (*Driver, error) {
+	if drv, ok := d.named[name]; ok {
+		return drv, nil
+	}
+	drv, builtin := BuiltinDriver(name)
+	if !builtin {
+		drv = &Driver{Name: name}
+	}
+	configured := false
+	prefix := "diff." + name + "."
+	for _, key := range []string{"funcname", "xfuncname"} {
+		value, ok := d.cfg.Get(prefix + key)
+		if !ok {
+			continue
+		}
+		f, err := ParseFuncName(value, key == "xfuncname", false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp to look for hunk header: %s", value)
+		}
+		drv.FuncName, configured = f, true
+	}
+	if value, ok := d.cfg.Get(prefix + "wordRegex"); ok {
+		re, err := CompileRegex(value, false, true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %s", value)
+		}
+		drv.WordRegex, configured = re, true
+	}
+	if _, ok := d.cfg.Get(prefix + "binary"); ok {
+		binary, err := d.cfg.Bool(prefix+"binary", false)
+		if err != nil {
+			return nil, err
+		}
+		drv.Binary, drv.Text, configured = binary, !binary, true
+	}
+	if !builtin && !configured {
+		drv = nil
+	}
+	d.named[name] = drv
+	return drv, nil
+}
+
+// IsBinary decides whether data of a file with the driver is binary.
+func (d *Driver) IsBinary(data []byte) bool {
+	switch {
+	case d != nil && d.Binary:
+		return true
+	case d != nil && d.Text:
+		return false
+	}
+	return IsBinary(data)
+}
@@ -0,0 +1,150 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+)
+
+// WhitespaceRule is core.whitespace: the whitespace errors colored diffs
+// highlight in added lines, and the width of a tab in its low bits.
+// ref: https://git-scm.com/docs/git-config#Documentation/git-config.txt-corewhitespace
+type WhitespaceRule uint
+
+const (
+	BlankAtEOL WhitespaceRule = 1 << (iota + 6)
+	SpaceBeforeTab
+	IndentWithNonTab
+	CRAtEOL
+	BlankAtEOF
+	TabInIndent
+
+	tabWidthMask WhitespaceRule = 0x3f
+
+	// DefaultWhitespaceRule is the rule without core.whitespace.
+	DefaultWhitespaceRule = BlankAtEOL | SpaceBeforeTab | BlankAtEOF | 8
+)
+
+var whitespaceRuleNames = []struct {
+	name string
+	bits WhitespaceRule
+}{
+	{"trailing-space", BlankAtEOL | BlankAtEOF},
+	{"space-before-tab", SpaceBeforeTab},
+	{"indent-with-non-tab", IndentWithNonTab},
+	{"cr-at-eol", CRAtEOL},
+	{"blank-at-eol", BlankAtEOL},
+	{"blank-at-eof", BlankAtEOF},
+	{"tab-in-indent", TabInIndent},
+}
+
+// ParseWhitespaceRule reads a comma-separated list of rules, each of
+// which may be abbreviated or turned off with "-", on top of the default.
+func ParseWhitespaceRule(s string) WhitespaceRule {
+	rule := DefaultWhitespaceRule
+	for _, word := range strings.Split(s, ",") {
+		word = strings.Trim(word, " \t\n\r")
+		negate := strings.HasPrefix(word, "-")
+		word = strings.TrimPrefix(word, "-")
+		if word == "" {
+			continue
+		}
+		for _, r := range whitespaceRuleNames {
+			if strings.HasPrefix(r.name, word) {
+				if negate {
+					rule &^= r.bits
+				} else {
+					rule |= r.bits
+				}
+				break
+			}
+		}
+		if strings.HasPrefix(word, "tabwidth=") {
+			if n, err := strconv.Atoi(strings.TrimPrefix(word, "tabwidth=")); err == nil && n > 0 && n < 0100 {
+				rule = rule&^tabWidthMask | WhitespaceRule(n)
+			}
+		}
+	}
+	return rule
+}
+
+func (r WhitespaceRule) tabWidth() int {
+	return int(r & tabWidthMask)
+}
+
+// isBlankLine reports whether a line has nothing but whitespace.
+func isBlankLine(line string) bool {
+	for i := 0; i < len(line); i++ {
+		if !isSpace(line[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// highlightWhitespace writes an added line with its whitespace errors in
+// the ws color: spaces before tabs in the indent, tabs in it or spaces
+// instead of tabs, as the rule asks, and whitespace at the end. The rest
+// of the line is in the set color, but for the indent, which is plain.
+// ref: ws_check_emit in https://github.com/git/git/blob/master/ws.c
+func highlightWhitespace(line string, rule WhitespaceRule, set, reset, ws string) string {
+	var b strings.Builder
+	newline := strings.HasSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\n")
+	cr := false
+	if rule&CRAtEOL != 0 && strings.HasSuffix(line, "\r") {
+		cr = true
+		line = line[:len(line)-1]
+	}
+	trailing := len(line)
+	if rule&BlankAtEOL != 0 {
+		for trailing > 0 && isSpace(line[trailing-1]) {
+			trailing--
+		}
+	}
+	written := 0
+	i := 0
+	for ; i < trailing; i++ {
+		if line[i] == ' ' {
+			continue
+		}
+		if line[i] != '\t' {
+			break
+		}
+		switch {
+		case rule&SpaceBeforeTab != 0 && written < i:
+			b.WriteString(ws + line[written:i] + reset + line[i:i+1])
+		case rule&TabInIndent != 0:
+			b.WriteString(line[written:i] + ws + line[i:i+1] + reset)
+		default:
+			b.WriteString(line[written : i+1])
+		}
+		written = i + 1
+	}
+	if rule&IndentWithNonTab != 0 && i-written >= rule.tabWidth() {
+		b.WriteString(ws + line[written:i] + reset)
+		written = i
+	}
+	if trailing > written {
+		b.WriteString(set + line[written:trailing] + reset)
+	}
+	if trailing != len(line) {
+		b.WriteString(ws + line[trailing:] + reset)
+	}
+	if cr {
+		b.WriteByte('\r')
+	}
+	if newline {
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// trailingBlankLines counts the blank lines at the end of data.
+func trailingBlankLines(data []byte) int {
+	lines := SplitLines(data)
+	n := 0
+	for i := len(lines) - 1; i >= 0 && isBlankLine(string(lines[i])); i-- {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,181 @@
+package diff
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/color"
+)
+
+// IsWordDiffMode reports whether name is a mode of --word-diff, as
+// Printer.WordDiff takes it.
+func IsWordDiffMode(name string) bool {
+	_, ok := wordStyles[name]
+	return ok
+}
+
+// wordStyleElem is how one kind of word is written: in a color, and
+// between a prefix and a suffix.
+type wordStyleElem struct {
+	color, prefix, suffix string
+}
+
+// wordStyle is how a mode of --word-diff writes added, removed and
+// unchanged words, and the end of a line.
+type wordStyle struct {
+	newWord, oldWord, ctx wordStyleElem
+	newline               string
+}
+
+var wordStyles = map[string]wordStyle{
+	"porcelain": {wordStyleElem{"", "+", "\n"}, wordStyleElem{"", "-", "\n"}, wordStyleElem{"", " ", "\n"}, "~\n"},
+	"plain":     {wordStyleElem{"", "{+", "+}"}, wordStyleElem{"", "[-", "-]"}, wordStyleElem{"", "", ""}, "\n"},
+	"color":     {wordStyleElem{}, wordStyleElem{}, wordStyleElem{}, "\n"},
+}
+
+// wordDiff gathers the old and new lines of a run of changes and then
+// shows how their words changed. Words are matches of regex, or runs of
+// non-whitespace without one.
+// ref: diff_words_show in https://github.com/git/git/blob/master/diff.c
+type wordDiff struct {
+	style       wordStyle
+	regex       *regexp.Regexp
+	minus, plus []byte
+}
+
+func newWordDiff(mode string, regex *regexp.Regexp, colors *Colors) *wordDiff {
+	w := &wordDiff{style: wordStyles[mode], regex: regex}
+	if colors != nil {
+		w.style.oldWord.color = colors.Old
+		w.style.newWord.color = colors.New
+		w.style.ctx.color = colors.Context
+	}
+	return w
+}
+
+// span is where a word is in the text it was taken from.
+type span struct {
+	begin, end int
+}
+
+// boundaries finds the next word of text from begin.
+// ref: find_word_boundaries in https://github.com/git/git/blob/master/diff.c
+func (w *wordDiff) boundaries(text []byte, begin int) (span, bool) {
+	for w.regex != nil && begin < len(text) {
+		m := w.regex.FindIndex(text[begin:])
+		if m == nil {
+			return span{}, false
+		}
+		end := begin + m[1]
+		// A word never goes past the end of its line.
+		if nl := bytes.IndexByte(text[begin+m[0]:end], '\n'); nl >= 0 {
+			end = begin + m[0] + nl
+		}
+		begin += m[0]
+		if begin != end {
+			return span{begin, end}, true
+		}
+		begin++
+	}
+	for begin < len(text) && isSpace(text[begin]) {
+		begin++
+	}
+	if begin >= len(text) {
+		return span{}, false
+	}
+	end := begin + 1
+	for end < len(text) && !isSpace(text[end]) {
+		end++
+	}
+	return span{begin, end}, true
+}
+
+// split finds the words of text and returns them one per line, ready
+// for Lines.
+func (w *wordDiff) split(text []byte) ([]span, []byte) {
+	words := []span{}
+	var lines []byte
+	for i := 0; i < len(text); {
+		word, ok := w.boundaries(text, i)
+		if !ok {
+			break
+		}
+		words = append(words, word)
+		lines = append(lines, text[word.begin:word.end]...)
+		lines = append(lines, '\n')
+		i = word.end
+	}
+	return words, lines
+}
+
+// write writes text as words of one kind, ending its lines as the style
+// does.
+func (w *wordDiff) write(b *strings.Builder, el wordStyleElem, text []byte) {
+	for len(text) > 0 {
+		i := bytes.IndexByte(text, '\n')
+		chunk := text
+		if i >= 0 {
+			chunk = text[:i]
+		}
+		if len(chunk) > 0 {
+			b.WriteString(el.color + el.prefix)
+			b.Write(chunk)
+			b.WriteString(el.suffix)
+			if el.color != "" {
+				b.WriteString(color.Reset)
+			}
+		}
+		if i < 0 {
+			return
+		}
+		b.WriteString(w.style.newline)
+		text = text[i+1:]
+	}
+}
+
+// show returns the word diff of the lines gathered so far, the new text
+// with the words taken out and put in marked, and forgets them.
+func (w *wordDiff) show() string {
+	var b strings.Builder
+	minus, plus := w.minus, w.plus
+	w.minus, w.plus = nil, nil
+	if len(minus) == 0 && len(plus) == 0 {
+		return ""
+	}
+	if len(plus) == 0 {
+		w.write(&b, w.style.oldWord, minus)
+		return b.String()
+	}
+	minusWords, minusLines := w.split(minus)
+	plusWords, plusLines := w.split(plus)
+	// The word at a 0-based index, or the start of the text before all.
+	at := func(words []span, i, n int) (int, int) {
+		if n > 0 {
+			return words[i].begin, words[i+n-1].end
+		}
+		if i == 0 {
+			return 0, 0
+		}
+		return words[i-1].end, words[i-1].end
+	}
+	current := 0
+	for _, c := range Lines(minusLines, plusLines, Options{Algorithm: "myers"}).Changes {
+		minusBegin, minusEnd := at(minusWords, c.Old, c.OldLen)
+		plusBegin, plusEnd := at(plusWords, c.New, c.NewLen)
+		if current != plusBegin {
+			w.write(&b, w.style.ctx, plus[current:plusBegin])
+		}
+		if minusBegin != minusEnd {
+			w.write(&b, w.style.oldWord, minus[minusBegin:minusEnd])
+		}
+		if plusBegin != plusEnd {
+			w.write(&b, w.style.newWord, plus[plusBegin:plusEnd])
+		}
+		current = plusEnd
+	}
+	if current != len(plus) {
+		w.write(&b, w.style.ctx, plus[current:])
+	}
+	return b.String()
+}
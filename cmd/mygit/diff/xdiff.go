@@ -0,0 +1,883 @@
+// Package diff compares blobs line by line and trees entry by entry, and
+// prints the results in git's formats. The line diff follows git's xdiff
+// closely so that hunks come out the same.
+// ref: https://github.com/git/git/tree/master/xdiff
+package diff
+
+import (
+	"bytes"
+	"math"
+)
+
+// Options tune the line diff.
+type Options struct {
+	Algorithm string // "myers" (default), "minimal", "patience" or "histogram"
+	// Context is the number of unchanged lines around each hunk.
+	Context int
+	// InterHunkContext joins hunks that are at most this many lines
+	// further apart than the context would.
+	InterHunkContext int
+	// IndentHeuristic shifts ambiguous hunks to line up with the
+	// indentation of the surrounding code.
+	IndentHeuristic bool
+	// Whitespace is the whitespace lines may differ in and still match.
+	Whitespace Whitespace
+	// IgnoreBlankLines leaves out changes that only add or remove blank
+	// lines, unless they are close to other changes.
+	IgnoreBlankLines bool
+	// FunctionContext widens hunks to the whole functions they touch.
+	FunctionContext bool
+	// FuncLine tells whether a line starts a function and what of it hunk
+	// headers show; nil matches lines starting with a letter.
+	FuncLine func(line []byte) (string, bool)
+}
+
+// Whitespace flags make lines that differ only in some whitespace match.
+type Whitespace int
+
+const (
+	IgnoreAllSpace    Whitespace = 1 << iota // -w
+	IgnoreSpaceChange                        // -b
+	IgnoreSpaceAtEOL                         // --ignore-space-at-eol
+	IgnoreCRAtEOL                            // --ignore-cr-at-eol
+)
+
+// DefaultOptions are those of "git diff" without options.
+func DefaultOptions() Options {
+	return Options{Algorithm: "myers", Context: 3, IndentHeuristic: true}
+}
+
+// Change is a run of lines removed from the old side and added on the new
+// side: Old and New are 0-based line indexes, OldLen and NewLen counts.
+type Change struct {
+	Old, New       int
+	OldLen, NewLen int
+	// Ignore marks changes of blank lines alone under IgnoreBlankLines.
+	Ignore bool
+}
+
+// Result is the outcome of comparing two blobs.
+type Result struct {
+	Old, New [][]byte // lines, with their "\n"
+	Changes  []Change
+}
+
+// SplitLines splits data after each "\n". The last line may lack one.
+func SplitLines(data []byte) [][]byte {
+	lines := [][]byte{}
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			lines = append(lines, data)
+			break
+		}
+		lines = append(lines, data[:i+1])
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// xdfile is one side of the comparison, as xdiff's xdfile_t.
+type xdfile struct {
+	recs   [][]byte
+	class  []int  // equivalence class of each record
+	rchg   []bool // changed flags, offset by one so that [-1] and [nrec] exist
+	rindex []int  // records taking part in the diff after cleanup...
+	ha     []int  // ...and their classes
+	dstart int
+	dend   int
+}
+
+func (f *xdfile) nrec() int { return len(f.recs) }
+
+func (f *xdfile) changed(i int) bool { return f.rchg[i+1] }
+
+func (f *xdfile) setChanged(i int, v bool) { f.rchg[i+1] = v }
+
+// Lines compares two blobs.
+func Lines(a, b []byte, opts Options) *Result {
+	f1 := &xdfile{recs: SplitLines(a)}
+	f2 := &xdfile{recs: SplitLines(b)}
+	classes := map[string]int{}
+	for _, f := range []*xdfile{f1, f2} {
+		f.class = make([]int, f.nrec())
+		f.rchg = make([]bool, f.nrec()+2)
+		for i, rec := range f.recs {
+			key := opts.Whitespace.key(rec)
+			c, ok := classes[key]
+			if !ok {
+				c = len(classes)
+				classes[key] = c
+			}
+			f.class[i] = c
+		}
+	}
+	switch opts.Algorithm {
+	case "patience":
+		patienceDiff(f1, f2, 0, f1.nrec(), 0, f2.nrec())
+	case "histogram":
+		histogramDiff(f1, f2, 1, f1.nrec(), 1, f2.nrec())
+	default:
+		myersDiff(f1, f2, len(classes), opts.Algorithm == "minimal")
+	}
+
+	changeCompact(f1, f2, opts.IndentHeuristic)
+	changeCompact(f2, f1, opts.IndentHeuristic)
+	r := &Result{Old: f1.recs, New: f2.recs, Changes: buildScript(f1, f2)}
+	if opts.IgnoreBlankLines {
+		r.markIgnorable(opts.Whitespace)
+	}
+	return r
+}
+
+// isSpace is C's isspace.
+func isSpace(c byte) bool {
+	return c == ' ' || c >= '\t' && c <= '\r'
+}
+
+// key is what a line is compared by: the line itself, or the line with
+// the whitespace the flags ignore taken out.
+func (w Whitespace) key(rec []byte) string {
+	switch {
+	case w&IgnoreAllSpace != 0:
+		b := make([]byte, 0, len(rec))
+		for _, c := range rec {
+			if !isSpace(c) {
+				b = append(b, c)
+			}
+		}
+		return string(b)
+	case w&IgnoreSpaceChange != 0:
+		b := make([]byte, 0, len(rec))
+		for i := 0; i < len(rec); i++ {
+			if !isSpace(rec[i]) {
+				b = append(b, rec[i])
+				continue
+			}
+			for i+1 < len(rec) && isSpace(rec[i+1]) {
+				i++
+			}
+			// Whitespace at the end of the line doesn't count at all.
+			if i+1 < len(rec) {
+				b = append(b, ' ')
+			}
+		}
+		return string(b)
+	case w&IgnoreSpaceAtEOL != 0:
+		return string(bytes.TrimRightFunc(rec, func(r rune) bool { return r < 0x80 && isSpace(byte(r)) }))
+	case w&IgnoreCRAtEOL != 0:
+		trimmed := bytes.TrimSuffix(rec, []byte("\n"))
+		if bytes.HasSuffix(trimmed, []byte("\r")) {
+			return string(trimmed[:len(trimmed)-1]) + "\n"
+		}
+	}
+	return string(rec)
+}
+
+// isBlank reports whether a line counts as blank: empty but for its
+// newline, or only whitespace when whitespace is ignored.
+func (w Whitespace) isBlank(rec []byte) bool {
+	if w == 0 {
+		return len(rec) <= 1
+	}
+	for _, c := range rec {
+		if !isSpace(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// markIgnorable marks the changes that only remove and add blank lines.
+func (r *Result) markIgnorable(w Whitespace) {
+	for i := range r.Changes {
+		c := &r.Changes[i]
+		c.Ignore = true
+		for _, rec := range r.Old[c.Old : c.Old+c.OldLen] {
+			c.Ignore = c.Ignore && w.isBlank(rec)
+		}
+		for _, rec := range r.New[c.New : c.New+c.NewLen] {
+			c.Ignore = c.Ignore && w.isBlank(rec)
+		}
+	}
+}
+
+// IsAlgorithm reports whether name is a diff algorithm Lines knows, as
+// --diff-algorithm and diff.algorithm take them.
+func IsAlgorithm(name string) bool {
+	switch name {
+	case "myers", "default", "minimal", "patience", "histogram":
+		return true
+	}
+	return false
+}
+
+// myersDiff marks the changed lines of f1 and f2 with xdiff's Myers
+// search, nclass being the number of equivalence classes.
+func myersDiff(f1, f2 *xdfile, nclass int, minimal bool) {
+	counts := make([][2]int, nclass)
+	for side, f := range []*xdfile{f1, f2} {
+		for _, c := range f.class {
+			counts[c][side]++
+		}
+	}
+	trimEnds(f1, f2)
+	cleanupRecords(f1, f2, counts)
+
+	ndiags := len(f1.ha) + len(f2.ha) + 3
+	env := &xdenv{
+		kvd:      make([]int, 2*ndiags+2),
+		kvdf:     len(f2.ha) + 1,
+		kvdb:     ndiags + len(f2.ha) + 1,
+		mxcost:   bogosqrt(ndiags),
+		snakeCnt: 20,
+		heurMin:  256,
+	}
+	if env.mxcost < 256 {
+		env.mxcost = 256
+	}
+	env.recsCmp(f1, 0, len(f1.ha), f2, 0, len(f2.ha), minimal)
+}
+
+// fallBackDiff runs the Myers search on count1 lines of f1 from line1
+// and count2 lines of f2 from line2, 0-based, as patience and histogram
+// do where they find nothing to anchor on.
+func fallBackDiff(f1, f2 *xdfile, line1, count1, line2, count2 int) {
+	sub := func(f *xdfile, line, count int) *xdfile {
+		return &xdfile{
+			recs:  f.recs[line : line+count],
+			class: f.class[line : line+count],
+			rchg:  make([]bool, count+2),
+		}
+	}
+	s1, s2 := sub(f1, line1, count1), sub(f2, line2, count2)
+	nclass := 0
+	for _, f := range []*xdfile{s1, s2} {
+		for _, c := range f.class {
+			if c >= nclass {
+				nclass = c + 1
+			}
+		}
+	}
+	myersDiff(s1, s2, nclass, false)
+	for i := 0; i < count1; i++ {
+		f1.setChanged(line1+i, s1.changed(i))
+	}
+	for i := 0; i < count2; i++ {
+		f2.setChanged(line2+i, s2.changed(i))
+	}
+}
+
+// trimEnds leaves the common head and tail out of the comparison.
+func trimEnds(f1, f2 *xdfile) {
+	lim := f1.nrec()
+	if f2.nrec() < lim {
+		lim = f2.nrec()
+	}
+	i := 0
+	for ; i < lim && f1.class[i] == f2.class[i]; i++ {
+	}
+	f1.dstart, f2.dstart = i, i
+	lim -= i
+	j := 0
+	for ; j < lim && f1.class[f1.nrec()-1-j] == f2.class[f2.nrec()-1-j]; j++ {
+	}
+	f1.dend = f1.nrec() - j - 1
+	f2.dend = f2.nrec() - j - 1
+}
+
+func bogosqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+// cleanupRecords marks the lines that have no match on the other side
+// as changed right away, and the ones with too many matches too when
+// they sit among unmatched lines, so that the search skips them.
+func cleanupRecords(f1, f2 *xdfile, counts [][2]int) {
+	const maxEqLimit = 1024
+	mark := func(f *xdfile, other int) []byte {
+		dis := make([]byte, f.nrec()+1)
+		mlim := bogosqrt(f.nrec())
+		if mlim > maxEqLimit {
+			mlim = maxEqLimit
+		}
+		for i := f.dstart; i <= f.dend; i++ {
+			nm := counts[f.class[i]][other]
+			switch {
+			case nm == 0:
+				dis[i] = 0
+			case nm >= mlim:
+				dis[i] = 2
+			default:
+				dis[i] = 1
+			}
+		}
+		return dis
+	}
+	dis1, dis2 := mark(f1, 1), mark(f2, 0)
+	for _, p := range []struct {
+		f   *xdfile
+		dis []byte
+	}{{f1, dis1}, {f2, dis2}} {
+		for i := p.f.dstart; i <= p.f.dend; i++ {
+			if p.dis[i] == 1 || (p.dis[i] == 2 && !cleanMmatch(p.dis, i, p.f.dstart, p.f.dend)) {
+				p.f.rindex = append(p.f.rindex, i)
+				p.f.ha = append(p.f.ha, p.f.class[i])
+			} else {
+				p.f.setChanged(i, true)
+			}
+		}
+	}
+}
+
+// cleanMmatch reports whether a line with many matches sits in a run of
+// unmatched lines, and can be left out.
+func cleanMmatch(dis []byte, i, s, e int) bool {
+	const simscanWindow, kpdisRun = 100, 4
+	if i-s > simscanWindow {
+		s = i - simscanWindow
+	}
+	if e-i > simscanWindow {
+		e = i + simscanWindow
+	}
+	rdis0, rpdis0 := 0, 1
+	for r := 1; i-r >= s; r++ {
+		if dis[i-r] == 0 {
+			rdis0++
+		} else if dis[i-r] == 2 {
+			rpdis0++
+		} else {
+			break
+		}
+	}
+	if rdis0 == 0 {
+		return false
+	}
+	rdis1, rpdis1 := 0, 1
+	for r := 1; i+r <= e; r++ {
+		if dis[i+r] == 0 {
+			rdis1++
+		} else if dis[i+r] == 2 {
+			rpdis1++
+		} else {
+			break
+		}
+	}
+	if rdis1 == 0 {
+		return false
+	}
+	rdis1 += rdis0
+	rpdis1 += rpdis0
+	return rpdis1*kpdisRun < rpdis1+rdis1
+}
+
+// xdenv holds the diagonal vectors of the Myers search.
+type xdenv struct {
+	kvd        []int
+	kvdf, kvdb int // offsets of diagonal 0 in kvd
+	mxcost     int
+	snakeCnt   int
+	heurMin    int
+}
+
+type split struct {
+	i1, i2       int
+	minLo, minHi bool
+}
+
+// recsCmp finds the changed lines between off and lim on both sides by
+// divide and conquer along the middle snake.
+func (e *xdenv) recsCmp(f1 *xdfile, off1, lim1 int, f2 *xdfile, off2, lim2 int, minimal bool) {
+	ha1, ha2 := f1.ha, f2.ha
+	for off1 < lim1 && off2 < lim2 && ha1[off1] == ha2[off2] {
+		off1++
+		off2++
+	}
+	for off1 < lim1 && off2 < lim2 && ha1[lim1-1] == ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			f2.setChanged(f2.rindex[off2], true)
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			f1.setChanged(f1.rindex[off1], true)
+		}
+	default:
+		spl := e.split(ha1, off1, lim1, ha2, off2, lim2, minimal)
+		e.recsCmp(f1, off1, spl.i1, f2, off2, spl.i2, spl.minLo)
+		e.recsCmp(f1, spl.i1, lim1, f2, spl.i2, lim2, spl.minHi)
+	}
+}
+
+// split finds where the forward and backward searches meet, giving up
+// on an optimal answer when the edit cost grows too high.
+func (e *xdenv) split(ha1 []int, off1, lim1 int, ha2 []int, off2, lim2 int, minimal bool) split {
+	const kHeur = 4
+	lineMax := math.MaxInt64
+	kvd := e.kvd
+	fw := func(d int) *int { return &kvd[e.kvdf+d] }
+	bw := func(d int) *int { return &kvd[e.kvdb+d] }
+
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	*fw(fmid) = off1
+	*bw(bmid) = lim1
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		if fmin > dmin {
+			fmin--
+			*fw(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			*fw(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if *fw(d - 1) >= *fw(d + 1) {
+				i1 = *fw(d - 1) + 1
+			} else {
+				i1 = *fw(d + 1)
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 < lim1 && i2 < lim2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev1 > e.snakeCnt {
+				gotSnake = true
+			}
+			*fw(d) = i1
+			if odd && bmin <= d && d <= bmax && *bw(d) <= i1 {
+				return split{i1, i2, true, true}
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			*bw(bmin - 1) = lineMax
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			*bw(bmax + 1) = lineMax
+		} else {
+			bmax--
+		}
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if *bw(d - 1) < *bw(d + 1) {
+				i1 = *bw(d - 1)
+			} else {
+				i1 = *bw(d + 1) - 1
+			}
+			prev1 := i1
+			i2 := i1 - d
+			for i1 > off1 && i2 > off2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+			if prev1-i1 > e.snakeCnt {
+				gotSnake = true
+			}
+			*bw(d) = i1
+			if !odd && fmin <= d && d <= fmax && i1 <= *fw(d) {
+				return split{i1, i2, true, true}
+			}
+		}
+
+		if minimal {
+			continue
+		}
+
+		// Past the heuristic trigger, a long enough snake far from the
+		// corner is good enough.
+		if gotSnake && ec > e.heurMin {
+			best := 0
+			var spl split
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := d - fmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *fw(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+				if v > kHeur*ec && v > best &&
+					off1+e.snakeCnt <= i1 && i1 < lim1 &&
+					off2+e.snakeCnt <= i2 && i2 < lim2 {
+					for k := 1; ha1[i1-k] == ha2[i2-k]; k++ {
+						if k == e.snakeCnt {
+							best = v
+							spl.i1, spl.i2 = i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				spl.minLo, spl.minHi = true, false
+				return spl
+			}
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := d - bmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *bw(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+				if v > kHeur*ec && v > best &&
+					off1 < i1 && i1 <= lim1-e.snakeCnt &&
+					off2 < i2 && i2 <= lim2-e.snakeCnt {
+					for k := 0; ha1[i1+k] == ha2[i2+k]; k++ {
+						if k == e.snakeCnt-1 {
+							best = v
+							spl.i1, spl.i2 = i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				spl.minLo, spl.minHi = false, true
+				return spl
+			}
+		}
+
+		// Enough is enough: take the furthest reaching path.
+		if ec >= e.mxcost {
+			fbest, fbest1 := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := *fw(d)
+				if i1 > lim1 {
+					i1 = lim1
+				}
+				i2 := i1 - d
+				if lim2 < i2 {
+					i1, i2 = lim2+d, lim2
+				}
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+			bbest, bbest1 := lineMax, lineMax
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := *bw(d)
+				if i1 < off1 {
+					i1 = off1
+				}
+				i2 := i1 - d
+				if i2 < off2 {
+					i1, i2 = off2+d, off2
+				}
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return split{fbest1, fbest - fbest1, true, false}
+			}
+			return split{bbest1, bbest - bbest1, false, true}
+		}
+	}
+}
+
+// group is a run of changed lines, [start, end).
+type group struct {
+	start, end int
+}
+
+func (f *xdfile) groupInit() group {
+	g := group{}
+	for f.changed(g.end) {
+		g.end++
+	}
+	return g
+}
+
+func (f *xdfile) groupNext(g *group) bool {
+	if g.end == f.nrec() {
+		return false
+	}
+	g.start = g.end + 1
+	for g.end = g.start; f.changed(g.end); g.end++ {
+	}
+	return true
+}
+
+func (f *xdfile) groupPrevious(g *group) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	for g.start = g.end; f.changed(g.start - 1); g.start-- {
+	}
+	return true
+}
+
+func (f *xdfile) groupSlideDown(g *group) bool {
+	if g.end < f.nrec() && f.class[g.start] == f.class[g.end] {
+		f.setChanged(g.start, false)
+		g.start++
+		f.setChanged(g.end, true)
+		g.end++
+		for f.changed(g.end) {
+			g.end++
+		}
+		return true
+	}
+	return false
+}
+
+func (f *xdfile) groupSlideUp(g *group) bool {
+	if g.start > 0 && f.class[g.start-1] == f.class[g.end-1] {
+		g.start--
+		f.setChanged(g.start, true)
+		g.end--
+		f.setChanged(g.end, false)
+		for f.changed(g.start - 1) {
+			g.start--
+		}
+		return true
+	}
+	return false
+}
+
+// changeCompact slides each group of changes in f to where it reads
+// best: lined up with a change on the other side if possible, otherwise
+// by the indent heuristic, otherwise as far down as it goes.
+func changeCompact(f, other *xdfile, indentHeuristic bool) {
+	const maxSliding = 100
+	g, og := f.groupInit(), other.groupInit()
+	for {
+		if g.end != g.start {
+			var groupSize, earliestEnd, endMatchingOther int
+			for {
+				groupSize = g.end - g.start
+				endMatchingOther = -1
+				for f.groupSlideUp(&g) {
+					other.groupPrevious(&og)
+				}
+				earliestEnd = g.end
+				if og.end > og.start {
+					endMatchingOther = g.end
+				}
+				for f.groupSlideDown(&g) {
+					other.groupNext(&og)
+					if og.end > og.start {
+						endMatchingOther = g.end
+					}
+				}
+				if groupSize == g.end-g.start {
+					break
+				}
+			}
+			switch {
+			case g.end == earliestEnd:
+			case endMatchingOther != -1:
+				for og.end == og.start {
+					f.groupSlideUp(&g)
+					other.groupPrevious(&og)
+				}
+			case indentHeuristic:
+				shift := earliestEnd
+				if g.end-groupSize-1 > shift {
+					shift = g.end - groupSize - 1
+				}
+				if g.end-maxSliding > shift {
+					shift = g.end - maxSliding
+				}
+				bestShift := -1
+				var best splitScore
+				for ; shift <= g.end; shift++ {
+					score := splitScore{}
+					score.add(f.measureSplit(shift))
+					score.add(f.measureSplit(shift - groupSize))
+					if bestShift == -1 || score.cmp(best) <= 0 {
+						best, bestShift = score, shift
+					}
+				}
+				for g.end > bestShift {
+					f.groupSlideUp(&g)
+					other.groupPrevious(&og)
+				}
+			}
+		}
+		if !f.groupNext(&g) {
+			break
+		}
+		other.groupNext(&og)
+	}
+}
+
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int
+	preBlank   int
+	preIndent  int
+	postBlank  int
+	postIndent int
+}
+
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+// indentOf measures the leading whitespace of a line, tabs to multiples
+// of eight; blank lines give -1.
+func indentOf(rec []byte) int {
+	const maxIndent = 200
+	ret := 0
+	for _, c := range rec {
+		switch c {
+		case ' ':
+			ret++
+		case '\t':
+			ret += 8 - ret%8
+		case '\n', '\r', '\v', '\f':
+		default:
+			return ret
+		}
+		if ret >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+func (f *xdfile) measureSplit(split int) splitMeasurement {
+	const maxBlanks = 20
+	m := splitMeasurement{indent: -1, preIndent: -1, postIndent: -1}
+	if split >= f.nrec() {
+		m.endOfFile = true
+	} else {
+		m.indent = indentOf(f.recs[split])
+	}
+	for i := split - 1; i >= 0; i-- {
+		m.preIndent = indentOf(f.recs[i])
+		if m.preIndent != -1 {
+			break
+		}
+		m.preBlank++
+		if m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+	for i := split + 1; i < f.nrec(); i++ {
+		m.postIndent = indentOf(f.recs[i])
+		if m.postIndent != -1 {
+			break
+		}
+		m.postBlank++
+		if m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+	return m
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	const (
+		startOfFilePenalty              = 1
+		endOfFilePenalty                = 21
+		totalBlankWeight                = -30
+		postBlankWeight                 = 6
+		relativeIndentPenalty           = -4
+		relativeIndentWithBlankPenalty  = 10
+		relativeOutdentPenalty          = 24
+		relativeOutdentWithBlankPenalty = 17
+		relativeDedentPenalty           = 23
+		relativeDedentWithBlankPenalty  = 17
+	)
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+	s.effectiveIndent += indent
+	pick := func(withBlank, without int) int {
+		if anyBlanks {
+			return withBlank
+		}
+		return without
+	}
+	switch {
+	case indent == -1 || m.preIndent == -1:
+	case indent > m.preIndent:
+		s.penalty += pick(relativeIndentWithBlankPenalty, relativeIndentPenalty)
+	case indent == m.preIndent:
+	case m.postIndent != -1 && m.postIndent > indent:
+		s.penalty += pick(relativeOutdentWithBlankPenalty, relativeOutdentPenalty)
+	default:
+		s.penalty += pick(relativeDedentWithBlankPenalty, relativeDedentPenalty)
+	}
+}
+
+func (s splitScore) cmp(o splitScore) int {
+	const indentWeight = 60
+	cmpIndents := 0
+	if s.effectiveIndent > o.effectiveIndent {
+		cmpIndents = 1
+	} else if s.effectiveIndent < o.effectiveIndent {
+		cmpIndents = -1
+	}
+	return indentWeight*cmpIndents + (s.penalty - o.penalty)
+}
+
+// buildScript collects the groups of changed lines into changes.
+func buildScript(f1, f2 *xdfile) []Change {
+	changes := []Change{}
+	for i1, i2 := f1.nrec(), f2.nrec(); i1 >= 0 || i2 >= 0; i1, i2 = i1-1, i2-1 {
+		if f1.changed(i1-1) || f2.changed(i2-1) {
+			l1, l2 := i1, i2
+			for f1.changed(i1 - 1) {
+				i1--
+			}
+			for f2.changed(i2 - 1) {
+				i2--
+			}
+			changes = append(changes, Change{Old: i1, New: i2, OldLen: l1 - i1, NewLen: l2 - i2})
+		}
+	}
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+	return changes
+}
@@ -0,0 +1,89 @@
+package hash
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	stdhash "hash"
+	"strings"
+)
+
+// Algo is the object format of a repository.
+// ref: https://git-scm.com/docs/hash-function-transition
+type Algo int
+
+const (
+	SHA1 Algo = iota
+	SHA256
+)
+
+// ByName returns the algorithm named by extensions.objectFormat or the
+// object-format= capability. An empty name means sha1.
+func ByName(name string) (Algo, error) {
+	switch strings.ToLower(name) {
+	case "", "sha1":
+		return SHA1, nil
+	case "sha256":
+		return SHA256, nil
+	default:
+		return SHA1, fmt.Errorf("unknown object format: %s", name)
+	}
+}
+
+func (a Algo) String() string {
+	if a == SHA256 {
+		return "sha256"
+	}
+	return "sha1"
+}
+
+// Size is the length of a raw object name in bytes.
+func (a Algo) Size() int {
+	if a == SHA256 {
+		return sha256.Size
+	}
+	return sha1.Size
+}
+
+// HexSize is the length of a hex object name.
+func (a Algo) HexSize() int {
+	return a.Size() * 2
+}
+
+func (a Algo) New() stdhash.Hash {
+	if a == SHA256 {
+		return sha256.New()
+	}
+	return sha1.New()
+}
+
+// Sum returns the hex object name of data.
+func (a Algo) Sum(data []byte) string {
+	h := a.New()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ZeroHex is the all-zero object name used for "no object".
+func (a Algo) ZeroHex() string {
+	return strings.Repeat("0", a.HexSize())
+}
+
+// RepositoryFormatVersion is the core.repositoryformatversion a repository
+// using this format needs. Extensions are only honored from version 1.
+func (a Algo) RepositoryFormatVersion() int {
+	if a == SHA256 {
+		return 1
+	}
+	return 0
+}
+
+// IsHex reports whether s looks like a full object name of this format.
+func (a Algo) IsHex(s string) bool {
+	if len(s) != a.HexSize() {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
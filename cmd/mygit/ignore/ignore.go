@@ -0,0 +1,226 @@
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/wildmatch"
+)
+
+// Pattern is one line of a .gitignore, info/exclude or core.excludesFile.
+// ref: https://git-scm.com/docs/gitignore#_pattern_format
+type Pattern struct {
+	Source string // file the pattern was read from, as shown by check-ignore -v
+	Line   int
+	Raw    string // the pattern as written, including "!" and trailing "/"
+
+	pattern  string
+	base     string // directory of the .gitignore, relative to the work tree
+	negate   bool
+	dirOnly  bool
+	anchored bool // contains a slash, so it matches the path from base
+}
+
+func (p *Pattern) Negated() bool {
+	return p.negate
+}
+
+// ParsePatterns reads the patterns of one file. base is the directory the
+// patterns are relative to, "" for the top of the work tree.
+func ParsePatterns(data []byte, source, base string) []*Pattern {
+	patterns := []*Pattern{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, "\xef\xbb\xbf")
+		}
+		if p := parsePattern(line); p != nil {
+			p.Source, p.Line, p.base = source, lineNum, base
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func parsePattern(line string) *Pattern {
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+	// Trailing spaces are ignored unless escaped with a backslash.
+	end := len(line)
+	for end > 0 && line[end-1] == ' ' {
+		if end >= 2 && line[end-2] == '\\' {
+			break
+		}
+		end--
+	}
+	line = line[:end]
+	if line == "" {
+		return nil
+	}
+	p := &Pattern{Raw: line}
+	if line[0] == '!' {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	p.pattern = line
+	return p
+}
+
+// match checks a slash-separated path relative to the work tree.
+func (p *Pattern) match(relPath string, isDir bool, flags int) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(relPath, p.base+"/") {
+			return false
+		}
+		relPath = relPath[len(p.base)+1:]
+	}
+	if !p.anchored {
+		return wildmatch.Match(p.pattern, path.Base(relPath), flags)
+	}
+	return wildmatch.Match(p.pattern, relPath, flags|wildmatch.Pathname)
+}
+
+// Matcher decides whether paths of a work tree are ignored. Per-directory
+// .gitignore files win over info/exclude, which wins over
+// core.excludesFile. Within a file the last matching pattern wins.
+type Matcher struct {
+	workTree string
+	flags    int
+	exclude  [][]*Pattern // core.excludesFile, then info/exclude
+	perDir   map[string][]*Pattern
+}
+
+// New loads the exclude files of the repository. The .gitignore files of
+// the work tree are read lazily as paths are checked.
+func New(workTree, gitDir string, cfg *config.Config) (*Matcher, error) {
+	m := &Matcher{workTree: workTree, perDir: map[string][]*Pattern{}}
+	if ignoreCase, _ := cfg.Bool("core.ignorecase", false); ignoreCase {
+		m.flags = wildmatch.CaseFold
+	}
+	excludesFile, ok := cfg.Path("core.excludesFile")
+	if !ok {
+		excludesFile = defaultExcludesFile()
+	}
+	for _, file := range []string{excludesFile, filepath.Join(gitDir, "info", "exclude")} {
+		if file == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.exclude = append(m.exclude, ParsePatterns(data, file, ""))
+	}
+	return m, nil
+}
+
+// defaultExcludesFile is $XDG_CONFIG_HOME/git/ignore.
+func defaultExcludesFile() string {
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		xdg = filepath.Join(home, ".config")
+	}
+	return filepath.Join(xdg, "git", "ignore")
+}
+
+func (m *Matcher) dirPatterns(dir string) []*Pattern {
+	if patterns, ok := m.perDir[dir]; ok {
+		return patterns
+	}
+	file := path.Join(dir, ".gitignore")
+	data, err := ioutil.ReadFile(filepath.Join(m.workTree, filepath.FromSlash(file)))
+	var patterns []*Pattern
+	if err == nil {
+		patterns = ParsePatterns(data, file, dir)
+	}
+	m.perDir[dir] = patterns
+	return patterns
+}
+
+// lastMatch returns the deciding pattern for the path itself, without
+// looking at its parent directories.
+func (m *Matcher) lastMatch(relPath string, isDir bool) *Pattern {
+	// Deepest .gitignore first: it has the highest precedence.
+	dir := path.Dir(relPath)
+	for {
+		if dir == "." {
+			dir = ""
+		}
+		patterns := m.dirPatterns(dir)
+		for i := len(patterns) - 1; i >= 0; i-- {
+			if patterns[i].match(relPath, isDir, m.flags) {
+				return patterns[i]
+			}
+		}
+		if dir == "" {
+			break
+		}
+		dir = path.Dir(dir)
+	}
+	for i := len(m.exclude) - 1; i >= 0; i-- {
+		patterns := m.exclude[i]
+		for j := len(patterns) - 1; j >= 0; j-- {
+			if patterns[j].match(relPath, isDir, m.flags) {
+				return patterns[j]
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns the pattern that decides relPath, or nil when no pattern
+// matches. A path inside an ignored directory is decided by the pattern
+// of that directory, since git never looks inside it.
+func (m *Matcher) Match(relPath string, isDir bool) *Pattern {
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+	if relPath == "" || relPath == "." {
+		return nil
+	}
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		if p := m.lastMatch(strings.Join(parts[:i], "/"), true); p != nil && !p.negate {
+			return p
+		}
+	}
+	return m.lastMatch(relPath, isDir)
+}
+
+// IsIgnored reports whether relPath, relative to the work tree, is ignored.
+func (m *Matcher) IsIgnored(relPath string, isDir bool) bool {
+	p := m.Match(relPath, isDir)
+	return p != nil && !p.negate
+}
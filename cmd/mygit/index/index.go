@@ -0,0 +1,288 @@
+// Package index reads and writes the staging area, .git/index.
+// ref: https://git-scm.com/docs/index-format
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+)
+
+const signature = "DIRC"
+
+// Flags of an entry.
+const (
+	flagAssumeValid = 0x8000
+	flagExtended    = 0x4000
+	flagStageMask   = 0x3000
+	flagStageShift  = 12
+	flagNameMask    = 0x0fff
+
+	// Extended flags, in index version 3 and later.
+	flagSkipWorktree = 0x4000
+	flagIntentToAdd  = 0x2000
+)
+
+// Entry is one path of the index at one stage.
+type Entry struct {
+	CTime, MTime time.Time
+	Dev, Ino     uint32
+	Mode         uint32 // 0100644, 0100755, 0120000 or 0160000
+	UID, GID     uint32
+	Size         uint32 // truncated to 32 bits, as git stores it
+	Sha          string
+	Path         string // slash separated, relative to the top
+	// Stage is 0 for a merged entry, 1 to 3 for the base, ours and
+	// theirs sides of a conflict.
+	Stage        int
+	AssumeValid  bool
+	SkipWorktree bool
+	IntentToAdd  bool
+}
+
+// ModeString is the mode as trees and diffs write it.
+func (e *Entry) ModeString() string {
+	return fmt.Sprintf("%06o", e.Mode)
+}
+
+// Extension is an optional section after the entries, kept as it is.
+type Extension struct {
+	Signature string
+	Data      []byte
+}
+
+// Index is the parsed contents of the index file.
+type Index struct {
+	Version    uint32
+	Entries    []*Entry // sorted by path, then stage
+	Extensions []Extension
+	// ModTime is when the file was last written. Entries whose files
+	// changed within the same second can't be trusted by their stat data.
+	ModTime time.Time
+}
+
+// Read parses the index at path. A missing file is an empty index.
+func Read(path string, algo hash.Algo) (*Index, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Index{Version: 2}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	idx, err := Parse(data, algo)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		idx.ModTime = info.ModTime()
+	}
+	return idx, nil
+}
+
+// Parse decodes index versions 2, 3 and 4.
+func Parse(data []byte, algo hash.Algo) (*Index, error) {
+	size := algo.Size()
+	if len(data) < 12+size || string(data[:4]) != signature {
+		return nil, errors.New("index file corrupt: bad signature")
+	}
+	body, sum := data[:len(data)-size], data[len(data)-size:]
+	if hex.EncodeToString(sum) != algo.Sum(body) {
+		return nil, errors.New("index file corrupt: bad checksum")
+	}
+	idx := &Index{Version: binary.BigEndian.Uint32(data[4:8])}
+	if idx.Version < 2 || idx.Version > 4 {
+		return nil, fmt.Errorf("index file corrupt: bad version %d", idx.Version)
+	}
+	count := binary.BigEndian.Uint32(data[8:12])
+	r := &reader{buf: body, pos: 12}
+	prev := ""
+	for i := uint32(0); i < count; i++ {
+		e, err := r.entry(idx.Version, size, prev)
+		if err != nil {
+			return nil, err
+		}
+		idx.Entries = append(idx.Entries, e)
+		prev = e.Path
+	}
+	for r.pos < len(r.buf) {
+		if len(r.buf)-r.pos < 8 {
+			return nil, errors.New("index file corrupt: truncated extension")
+		}
+		sig := string(r.buf[r.pos : r.pos+4])
+		n := int(binary.BigEndian.Uint32(r.buf[r.pos+4 : r.pos+8]))
+		r.pos += 8
+		if n > len(r.buf)-r.pos {
+			return nil, errors.New("index file corrupt: truncated extension")
+		}
+		idx.Extensions = append(idx.Extensions, Extension{sig, r.buf[r.pos : r.pos+n]})
+		r.pos += n
+	}
+	return idx, nil
+}
+
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func (r *reader) uint32() uint32 {
+	v := binary.BigEndian.Uint32(r.buf[r.pos:])
+	r.pos += 4
+	return v
+}
+
+func (r *reader) time() time.Time {
+	sec := r.uint32()
+	nsec := r.uint32()
+	return time.Unix(int64(sec), int64(nsec))
+}
+
+// entry reads one entry. Version 4 names entries by how much of the
+// previous path to drop and what to add instead, without padding.
+func (r *reader) entry(version uint32, hashSize int, prev string) (*Entry, error) {
+	start := r.pos
+	if len(r.buf)-r.pos < 40+hashSize+2 {
+		return nil, errors.New("index file corrupt: truncated entry")
+	}
+	e := &Entry{}
+	e.CTime = r.time()
+	e.MTime = r.time()
+	e.Dev = r.uint32()
+	e.Ino = r.uint32()
+	e.Mode = r.uint32()
+	e.UID = r.uint32()
+	e.GID = r.uint32()
+	e.Size = r.uint32()
+	e.Sha = hex.EncodeToString(r.buf[r.pos : r.pos+hashSize])
+	r.pos += hashSize
+	flags := binary.BigEndian.Uint16(r.buf[r.pos:])
+	r.pos += 2
+	e.AssumeValid = flags&flagAssumeValid != 0
+	e.Stage = int(flags&flagStageMask) >> flagStageShift
+	if flags&flagExtended != 0 {
+		if version < 3 || len(r.buf)-r.pos < 2 {
+			return nil, errors.New("index file corrupt: bad extended flags")
+		}
+		extended := binary.BigEndian.Uint16(r.buf[r.pos:])
+		r.pos += 2
+		e.SkipWorktree = extended&flagSkipWorktree != 0
+		e.IntentToAdd = extended&flagIntentToAdd != 0
+	}
+	if version == 4 {
+		strip, n := varint(r.buf[r.pos:])
+		if n == 0 || strip > len(prev) {
+			return nil, errors.New("index file corrupt: bad path prefix")
+		}
+		r.pos += n
+		nul := bytes.IndexByte(r.buf[r.pos:], 0)
+		if nul < 0 {
+			return nil, errors.New("index file corrupt: unterminated path")
+		}
+		e.Path = prev[:len(prev)-strip] + string(r.buf[r.pos:r.pos+nul])
+		r.pos += nul + 1
+		return e, nil
+	}
+	nul := bytes.IndexByte(r.buf[r.pos:], 0)
+	if nul < 0 {
+		return nil, errors.New("index file corrupt: unterminated path")
+	}
+	e.Path = string(r.buf[r.pos : r.pos+nul])
+	// Entries are padded with 1 to 8 NULs to a multiple of 8 bytes.
+	r.pos = start + (r.pos+nul-start+8)&^7
+	if r.pos > len(r.buf) {
+		return nil, errors.New("index file corrupt: truncated entry")
+	}
+	return e, nil
+}
+
+// varint decodes git's offset encoding, where each continuation adds one
+// so that every number has a single encoding.
+func varint(buf []byte) (int, int) {
+	if len(buf) == 0 {
+		return 0, 0
+	}
+	c := buf[0]
+	v := int(c & 0x7f)
+	n := 1
+	for c&0x80 != 0 {
+		if n >= len(buf) {
+			return 0, 0
+		}
+		c = buf[n]
+		n++
+		v = ((v + 1) << 7) | int(c&0x7f)
+	}
+	return v, n
+}
+
+// Find returns the entry of path at stage, or nil.
+func (idx *Index) Find(path string, stage int) *Entry {
+	i := sort.Search(len(idx.Entries), func(i int) bool {
+		e := idx.Entries[i]
+		return e.Path > path || e.Path == path && e.Stage >= stage
+	})
+	if i < len(idx.Entries) && idx.Entries[i].Path == path && idx.Entries[i].Stage == stage {
+		return idx.Entries[i]
+	}
+	return nil
+}
+
+// Unmerged reports whether path has conflict stages.
+func (idx *Index) Unmerged(path string) bool {
+	for stage := 1; stage <= 3; stage++ {
+		if idx.Find(path, stage) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Uptodate reports whether the stat data of the entry still describes
+// the file, so that its contents needn't be read. A file changed in the
+// same second the index was written is "racily clean" and isn't trusted.
+func (idx *Index) Uptodate(e *Entry, info os.FileInfo) bool {
+	return e.AssumeValid || idx.StatMatches(e, info)
+}
+
+// StatMatches is Uptodate without trusting the assume-unchanged bit.
+func (idx *Index) StatMatches(e *Entry, info os.FileInfo) bool {
+	return StatDataMatches(e, info) && !idx.IsRacy(e)
+}
+
+// StatDataMatches reports whether the size, mtime and mode recorded in
+// the entry are those of the file. A mismatch means the file changed
+// without its contents being looked at.
+func StatDataMatches(e *Entry, info os.FileInfo) bool {
+	return uint32(info.Size()) == e.Size && info.ModTime().Equal(e.MTime) && e.Mode == FileMode(info)
+}
+
+// IsRacy reports whether the entry was modified no earlier than the
+// second the index was written, so that its stat data can't tell a
+// later change apart: such a file has to be hashed.
+// ref: https://git-scm.com/docs/racy-git
+func (idx *Index) IsRacy(e *Entry) bool {
+	return !idx.ModTime.IsZero() && !e.MTime.Before(idx.ModTime.Truncate(time.Second))
+}
+
+// FileMode is the mode the index would record for a file of the work
+// tree; a directory can only be a submodule.
+func FileMode(info os.FileInfo) uint32 {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return 0120000
+	case info.IsDir():
+		return 0160000
+	case info.Mode()&0111 != 0:
+		return 0100755
+	}
+	return 0100644
+}
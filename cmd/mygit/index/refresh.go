@@ -0,0 +1,105 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// SetStat records the stat data of the file of an entry.
+func (e *Entry) SetStat(info os.FileInfo) {
+	e.MTime = info.ModTime()
+	e.CTime = e.MTime
+	e.Size = uint32(info.Size())
+	fillStat(e, info)
+}
+
+// Stale is an entry Refresh couldn't bring up to date: its file is
+// missing or changed, or it is unmerged.
+type Stale struct {
+	Path     string
+	Missing  bool
+	Unmerged bool
+}
+
+// Refresh re-reads the stat data of the entries whose files still have
+// the contents and mode the index records, so that they can be trusted
+// without hashing again. Really checks the entries marked
+// assume-unchanged as well. It returns the entries it couldn't refresh
+// and whether any entry changed.
+// ref: https://github.com/git/git/blob/master/read-cache.c
+func (idx *Index) Refresh(workTree string, algo hash.Algo, really bool) ([]Stale, bool, error) {
+	stale := []Stale{}
+	changed := false
+	for i := 0; i < len(idx.Entries); i++ {
+		e := idx.Entries[i]
+		if e.Stage > 0 {
+			for i+1 < len(idx.Entries) && idx.Entries[i+1].Path == e.Path {
+				i++
+			}
+			stale = append(stale, Stale{Path: e.Path, Unmerged: true})
+			continue
+		}
+		if e.SkipWorktree || e.AssumeValid && !really || e.Mode == 0160000 {
+			continue
+		}
+		name := filepath.Join(workTree, filepath.FromSlash(e.Path))
+		info, err := os.Lstat(name)
+		if os.IsNotExist(err) || err == nil && info.IsDir() {
+			stale = append(stale, Stale{Path: e.Path, Missing: true})
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if idx.StatMatches(e, info) {
+			continue
+		}
+		same, err := SameContents(e, name, info, algo)
+		if err != nil {
+			return nil, false, err
+		}
+		if !same {
+			if really && e.AssumeValid {
+				e.AssumeValid = false
+				changed = true
+			}
+			// A file changed within the second the index was written
+			// would look clean once the index is written again; an
+			// impossible size keeps it dirty.
+			if uint32(info.Size()) == e.Size && info.ModTime().Equal(e.MTime) {
+				e.Size = 0
+				changed = true
+			}
+			stale = append(stale, Stale{Path: e.Path})
+			continue
+		}
+		e.SetStat(info)
+		changed = true
+	}
+	return stale, changed, nil
+}
+
+// SameContents hashes the file name of an entry to compare it with the
+// entry.
+func SameContents(e *Entry, name string, info os.FileInfo, algo hash.Algo) (bool, error) {
+	if FileMode(info) != e.Mode {
+		return false, nil
+	}
+	var data []byte
+	var err error
+	if e.Mode == 0120000 {
+		var target string
+		target, err = os.Readlink(name)
+		data = []byte(filepath.ToSlash(target))
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return false, err
+	}
+	return algo.Sum(object.Wrap("blob", data)) == e.Sha, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package index
+
+import "os"
+
+// fillStat copies the stat data that only some systems have.
+func fillStat(e *Entry, info os.FileInfo) {
+	e.CTime = info.ModTime()
+}
@@ -0,0 +1,139 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/lockfile"
+)
+
+// Bytes encodes the index with its checksum. Extended flags need version
+// 3, to which version 2 is raised when an entry has them.
+func (idx *Index) Bytes(algo hash.Algo) ([]byte, error) {
+	version := idx.Version
+	if version < 2 {
+		version = 2
+	}
+	for _, e := range idx.Entries {
+		if version == 2 && (e.SkipWorktree || e.IntentToAdd) {
+			version = 3
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString(signature)
+	put := func(v uint32) {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], v)
+		buf.Write(b[:])
+	}
+	put(version)
+	put(uint32(len(idx.Entries)))
+	prev := ""
+	for _, e := range idx.Entries {
+		start := buf.Len()
+		put(uint32(e.CTime.Unix()))
+		put(uint32(e.CTime.Nanosecond()))
+		put(uint32(e.MTime.Unix()))
+		put(uint32(e.MTime.Nanosecond()))
+		put(e.Dev)
+		put(e.Ino)
+		put(e.Mode)
+		put(e.UID)
+		put(e.GID)
+		put(e.Size)
+		sha, err := hex.DecodeString(e.Sha)
+		if err != nil || len(sha) != algo.Size() {
+			return nil, fmt.Errorf("invalid object name '%s' for '%s'", e.Sha, e.Path)
+		}
+		buf.Write(sha)
+		flags := uint16(e.Stage<<flagStageShift) & flagStageMask
+		if len(e.Path) < flagNameMask {
+			flags |= uint16(len(e.Path))
+		} else {
+			flags |= flagNameMask
+		}
+		if e.AssumeValid {
+			flags |= flagAssumeValid
+		}
+		extended := uint16(0)
+		if e.SkipWorktree {
+			extended |= flagSkipWorktree
+		}
+		if e.IntentToAdd {
+			extended |= flagIntentToAdd
+		}
+		if extended != 0 {
+			flags |= flagExtended
+		}
+		binary.Write(&buf, binary.BigEndian, flags)
+		if extended != 0 {
+			binary.Write(&buf, binary.BigEndian, extended)
+		}
+		if version == 4 {
+			common := 0
+			for common < len(prev) && common < len(e.Path) && prev[common] == e.Path[common] {
+				common++
+			}
+			buf.Write(encodeVarint(len(prev) - common))
+			buf.WriteString(e.Path[common:])
+			buf.WriteByte(0)
+			prev = e.Path
+			continue
+		}
+		buf.WriteString(e.Path)
+		// Pad with 1 to 8 NULs to a multiple of 8 bytes.
+		n := buf.Len() - start
+		buf.Write(make([]byte, (n+8)&^7-n))
+	}
+	for _, ext := range idx.Extensions {
+		buf.WriteString(ext.Signature)
+		put(uint32(len(ext.Data)))
+		buf.Write(ext.Data)
+	}
+	sum, _ := hex.DecodeString(algo.Sum(buf.Bytes()))
+	buf.Write(sum)
+	return buf.Bytes(), nil
+}
+
+// encodeVarint is the inverse of varint.
+func encodeVarint(v int) []byte {
+	var b [16]byte
+	pos := len(b) - 1
+	b[pos] = byte(v & 0x7f)
+	for v >>= 7; v != 0; v >>= 7 {
+		v--
+		pos--
+		b[pos] = 0x80 | byte(v&0x7f)
+	}
+	return b[pos:]
+}
+
+// Write replaces the index file at path through a lock file.
+func (idx *Index) Write(path string, algo hash.Algo) error {
+	data, err := idx.Bytes(algo)
+	if err != nil {
+		return err
+	}
+	lock, err := lockfile.Acquire(path)
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write(data); err != nil {
+		lock.Rollback()
+		return err
+	}
+	if err := lock.Commit(); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		idx.ModTime = info.ModTime()
+	} else {
+		idx.ModTime = time.Now()
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/shared"
+)
+
+// Lock is a "<path>.lock" file. It is created exclusively, so only one
+// writer can hold it, and renamed over the target on Commit.
+type Lock struct {
+	Path string // the file being locked
+	file *os.File
+}
+
+// Acquire creates <path>.lock or fails if somebody else holds it.
+func Acquire(path string) (*Lock, error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("Unable to create '%s.lock': File exists.\n\nAnother git process seems to be running in this repository", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := shared.Adjust(f.Name()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &Lock{Path: path, file: f}, nil
+}
+
+func (l *Lock) Write(p []byte) (int, error) {
+	return l.file.Write(p)
+}
+
+// Commit replaces the target file with the lock file contents.
+func (l *Lock) Commit() error {
+	if err := l.file.Close(); err != nil {
+		os.Remove(l.file.Name())
+		return err
+	}
+	return os.Rename(l.file.Name(), l.Path)
+}
+
+// Rollback removes the lock file and leaves the target untouched.
+func (l *Lock) Rollback() {
+	l.file.Close()
+	os.Remove(l.file.Name())
+}
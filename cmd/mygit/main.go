@@ -1,13 +1,10 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"compress/zlib"
-	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"path/filepath"
 	"strings"
@@ -16,50 +13,64 @@ import (
 	"os"
 
 	"github.com/codecrafters-io/git-starter-go/cmd"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
 	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/ignore"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/shared"
 	"github.com/codecrafters-io/git-starter-go/cmd/mygit/util"
 	myzlib "github.com/codecrafters-io/git-starter-go/cmd/mygit/zlib"
 )
 
-const (
-	GIT_DIRE = ".git"
-	GIT_OBJECT_DIRE = ".git/objects"
-	GIT_REFS_DIRE = ".git/refs"
-)
+// Object format of the current repository, read from extensions.objectFormat.
+var objectFormat = hash.SHA1
+
+// The repository found by setupRepository.
+var repo *repository.Repository
 
 // Usage: your_git.sh <command> <arg1> <arg2> ...
 func main() {
+	args, err := parseGlobalOptions(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: mygit [-C <path>] [--git-dir=<path>] [--work-tree=<path>] <command> [<args>]\n")
+		os.Exit(1)
+	}
+	os.Args = append(os.Args[:1], args...)
+
 	switch command := os.Args[1]; command {
 	case "init":
-		for _, dir := range []string{GIT_DIRE, GIT_OBJECT_DIRE, GIT_REFS_DIRE} {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				fmt.Fprintf(os.Stderr, "Error creating cloneDir: %s\n", err)
-			}
-		}
-
-		headFileContents := []byte("ref: refs/heads/master\n")
-		if err := os.WriteFile(".git/HEAD", headFileContents, 0644); err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing file: %s\n", err)
-		}
-
-		fmt.Println("Initialized git cloneDir")
-
+		initCmd(os.Args[2:])
 	case "cat-file":
+		setupRepository()
 		catFile()
 	case "hash-object":
+		setupRepository()
 		hashObject()
 	case "ls-tree":
+		setupRepository()
 		option := os.Args[2]
 		if option == "--name-only" {
 			treeHash := os.Args[3]
 			lsTree(treeHash)
 		}
 	case "write-tree":
+		setupRepository()
 		dirname := os.Args[len(os.Args)-1]
 		if len(os.Args) < 3 {
-			dirname = "."
+			dirname = repo.WorkTree
+		}
+		matcher, err := newIgnoreMatcher()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "write-tree: %v\n", err)
+			os.Exit(1)
 		}
-		objectname, err := writeTree(dirname, true)
+		objectname, err := writeTree(dirname, true, matcher)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "write-tree: %v\n", err)
 			os.Exit(1)
@@ -67,6 +78,7 @@ func main() {
 		fmt.Println(objectname)
 		// writeTree()
 	case "commit-tree":
+		setupRepository()
 		treeSha := os.Args[2]
 		commitMsg := os.Args[len(os.Args)-1]
 
@@ -78,7 +90,64 @@ func main() {
 			}
 		}
 
-		commitTree(treeSha, parentCommitSha, commitMsg)
+		if parentCommitSha != "" {
+			parentCommitSha = resolveRevision(parentCommitSha + "^{commit}")
+		}
+		commitTree(resolveRevision(treeSha+"^{tree}"), parentCommitSha, commitMsg)
+	case "check-ignore":
+		os.Exit(cmd.CheckIgnore(os.Args[2:]))
+	case "config":
+		os.Exit(cmd.Config(os.Args[2:]))
+	case "update-ref":
+		os.Exit(cmd.UpdateRef(os.Args[2:]))
+	case "symbolic-ref":
+		os.Exit(cmd.SymbolicRef(os.Args[2:]))
+	case "show-ref":
+		os.Exit(cmd.ShowRef(os.Args[2:]))
+	case "for-each-ref":
+		os.Exit(cmd.ForEachRef(os.Args[2:]))
+	case "pack-refs":
+		os.Exit(cmd.PackRefs(os.Args[2:]))
+	case "reflog":
+		os.Exit(cmd.Reflog(os.Args[2:]))
+	case "refs":
+		os.Exit(cmd.Refs(os.Args[2:]))
+	case "rev-parse":
+		os.Exit(cmd.RevParse(os.Args[2:]))
+	case "rev-list":
+		os.Exit(cmd.RevList(os.Args[2:]))
+	case "log":
+		os.Exit(cmd.Log(os.Args[2:]))
+	case "diff":
+		os.Exit(cmd.Diff(os.Args[2:]))
+	case "diff-tree":
+		os.Exit(cmd.DiffTree(os.Args[2:]))
+	case "diff-index":
+		os.Exit(cmd.DiffIndex(os.Args[2:]))
+	case "diff-files":
+		os.Exit(cmd.DiffFiles(os.Args[2:]))
+	case "update-index":
+		os.Exit(cmd.UpdateIndex(os.Args[2:]))
+	case "branch":
+		os.Exit(cmd.Branch(os.Args[2:]))
+	case "checkout":
+		os.Exit(cmd.Checkout(os.Args[2:]))
+	case "switch":
+		os.Exit(cmd.Switch(os.Args[2:]))
+	case "restore":
+		os.Exit(cmd.Restore(os.Args[2:]))
+	case "commit":
+		os.Exit(cmd.Commit(os.Args[2:]))
+	case "merge":
+		os.Exit(cmd.Merge(os.Args[2:]))
+	case "merge-base":
+		os.Exit(cmd.MergeBase(os.Args[2:]))
+	case "merge-tree":
+		os.Exit(cmd.MergeTree(os.Args[2:]))
+	case "merge-file":
+		os.Exit(cmd.MergeFile(os.Args[2:]))
+	case "rebase":
+		os.Exit(cmd.Rebase(os.Args[2:]))
 	case "clone":
 		repoUrl := os.Args[2]
 		cloneDir := os.Args[3]
@@ -94,39 +163,160 @@ func main() {
 
 // }
 
-func getTreeInfos(sha string) []string {
-	blobPath := filepath.Join(GIT_OBJECT_DIRE, sha[:2], sha[2:])
+// parseGlobalOptions handles the options given before the command and
+// returns the command with its arguments.
+func parseGlobalOptions(args []string) ([]string, error) {
+	for len(args) > 0 {
+		arg := args[0]
+		switch {
+		case arg == "-C":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("no directory given for -C")
+			}
+			if err := os.Chdir(args[1]); err != nil {
+				return nil, fmt.Errorf("cannot change to '%s': %v", args[1], err)
+			}
+			args = args[2:]
+		case arg == "-c":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("-c expects a configuration string")
+			}
+			if err := config.AddCommandLineParameter(args[1]); err != nil {
+				return nil, err
+			}
+			args = args[2:]
+		case arg == "--git-dir" || arg == "--work-tree":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("no directory given for %s", arg)
+			}
+			if err := setPathEnv(arg, args[1]); err != nil {
+				return nil, err
+			}
+			args = args[2:]
+		case strings.HasPrefix(arg, "--git-dir=") || strings.HasPrefix(arg, "--work-tree="):
+			i := strings.IndexByte(arg, '=')
+			if err := setPathEnv(arg[:i], arg[i+1:]); err != nil {
+				return nil, err
+			}
+			args = args[1:]
+		default:
+			return args, nil
+		}
+	}
+	return args, nil
+}
 
-	files, err := os.Open(blobPath)
+// setPathEnv exports --git-dir/--work-tree the way git does, so that
+// discovery and child processes see the same repository.
+func setPathEnv(option, path string) error {
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error open file: %s\n", err)
+		return err
+	}
+	if option == "--git-dir" {
+		return os.Setenv("GIT_DIR", abs)
 	}
-	defer files.Close()
+	return os.Setenv("GIT_WORK_TREE", abs)
+}
 
-	// io.ByteReaderを実装したReaderを生成
-	br := bufio.NewReader(files)
+// setupRepository discovers the repository or exits like git does.
+func setupRepository() {
+	r, err := repository.Discover()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+	repo = r
+	objectFormat = r.Format
+}
 
-	zr, err := zlib.NewReader(br)
+// resolveRevision turns a revision argument into an object name or exits
+// like git does.
+func resolveRevision(rev string) string {
+	sha, err := cmd.ResolveRevision(repo, rev)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error read file: %s\n", err)
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
 	}
-	defer zr.Close()
+	return sha
+}
 
+func initCmd(args []string) {
+	opts := repository.InitOptions{Dir: "."}
+	quiet := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--bare":
+			opts.Bare = true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "-b" || arg == "--initial-branch" || arg == "--template":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: option `%s' requires a value\n", arg)
+				os.Exit(129)
+			}
+			i++
+			if arg == "--template" {
+				opts.TemplateDir = args[i]
+			} else {
+				opts.Branch = args[i]
+			}
+		case strings.HasPrefix(arg, "--initial-branch="):
+			opts.Branch = strings.TrimPrefix(arg, "--initial-branch=")
+		case strings.HasPrefix(arg, "--template="):
+			opts.TemplateDir = strings.TrimPrefix(arg, "--template=")
+		case arg == "--shared":
+			opts.Shared = "group"
+		case strings.HasPrefix(arg, "--shared="):
+			opts.Shared = strings.TrimPrefix(arg, "--shared=")
+		case strings.HasPrefix(arg, "--object-format="):
+			format, err := hash.ByName(strings.TrimPrefix(arg, "--object-format="))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+				os.Exit(128)
+			}
+			opts.Format = &format
+		case strings.HasPrefix(arg, "--ref-format="):
+			opts.RefFormat = strings.TrimPrefix(arg, "--ref-format=")
+		case strings.HasPrefix(arg, "-"):
+			fmt.Fprintf(os.Stderr, "error: unknown option `%s'\n", arg)
+			os.Exit(129)
+		default:
+			opts.Dir = arg
+		}
+	}
+	if opts.Bare && opts.Dir == "." && os.Getenv("GIT_DIR") != "" {
+		opts.Dir = os.Getenv("GIT_DIR")
+	}
 
-	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, zr)
+	r, reinit, err := repository.Init(opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error copy buf file: %s\n", err)
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if quiet {
+		return
 	}
+	if reinit {
+		fmt.Printf("Reinitialized existing Git repository in %s/\n", r.GitDir)
+	} else {
+		fmt.Printf("Initialized empty Git repository in %s/\n", r.GitDir)
+	}
+}
 
-	treeInfo := strings.Split(buf.String(), "\000")
-	return treeInfo
+func objectStore() *object.Store {
+	return object.NewStore(repo.ObjectsDir(), objectFormat)
 }
 
 func catFile()  {
-	sha := os.Args[len(os.Args)-1]
-	blobBody := getTreeInfos(sha)[1]
-	fmt.Print(blobBody)
+	sha := resolveRevision(os.Args[len(os.Args)-1])
+	_, contents, err := objectStore().Read(sha)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
+		os.Exit(128)
+	}
+	fmt.Print(string(contents))
 }
 
 func hashObject() {
@@ -139,34 +329,21 @@ func hashObject() {
 	}
 
 	// SHA-1ハッシュの計算
-	sha1Hex, err := util.GetHashByFileName(fileName)
+	sha1Hex, err := util.GetHashByFileName(objectFormat, fileName)
 	if err != nil && !os.IsExist(err) {
 		fmt.Fprintf(os.Stderr, "Failed get hash: %s\n", err)
 		return
 	}
-	blobDire := string(sha1Hex[:2])
-	blobFile := string(sha1Hex[2:])
-	blobDirePath := filepath.Join(GIT_OBJECT_DIRE, blobDire)
-	blobFilePath := filepath.Join(blobDirePath, blobFile)
-
-	err = os.Mkdir(blobDirePath, 0755)
-	if err != nil && !os.IsExist(err) {
-		fmt.Fprintf(os.Stderr, "Failed mkdire: %s\n", err)
-		return
-	}
-
-	outFile, err := os.Create(blobFilePath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error create file: %s\n", err)
-	}
-	defer outFile.Close()
-
-	zw := zlib.NewWriter(outFile)
+	compressed := bytes.NewBuffer(make([]byte, 0))
+	zw := zlib.NewWriter(compressed)
 	_, err = zw.Write(blobData)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error write blob to file: %s\n", err)
 	}
 	zw.Close()
+	if err := WriteObject(sha1Hex, compressed.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error write blob to file: %s\n", err)
+	}
 
 	fmt.Printf(sha1Hex)
 }
@@ -181,7 +358,7 @@ func HashObject(filepath string, write bool) (objectname string, err error) {
 	// https://alblue.bandlem.com/2011/08/git-tip-of-week-objects.html
 	prefix := fmt.Sprintf("blob %d\x00", len(contents))
 	data := append([]byte(prefix), contents...)
-	hasher := sha1.New()
+	hasher := objectFormat.New()
 	hasher.Write(data)
 	objectname = hex.EncodeToString(hasher.Sum(nil))
 	compressed := bytes.NewBuffer(make([]byte, 0))
@@ -203,14 +380,18 @@ func HashObject(filepath string, write bool) (objectname string, err error) {
 }
 
 func lsTree(treeSha string) {
-	treeInfos := getTreeInfos(treeSha)
-	for _, v := range treeInfos {
-		blobInfo := strings.Split(v, " ")
-		// fmt.Println(blobInfo)
-		if len(blobInfo) == 2 && blobInfo[0] != "tree" {
-			dirName := blobInfo[1]
-			fmt.Println(dirName)
-		}
+	treeBuf, err := objectStore().ReadType(resolveRevision(treeSha+"^{tree}"), "tree")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
+		os.Exit(128)
+	}
+	entries, err := object.ParseTree(treeBuf, objectFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
+		os.Exit(128)
+	}
+	for _, entry := range entries {
+		fmt.Println(entry.Name)
 	}
 }
 
@@ -285,20 +466,35 @@ func lsTree(treeSha string) {
 // 	hashObject()
 // }
 
+// WriteObject stores an already compressed loose object, read-only like
+// git's, unless it exists already.
 func WriteObject(objectname string, contents []byte) error {
 	dirname, filename := objectname[:2], objectname[2:]
-	err := os.MkdirAll(fmt.Sprintf(".git/objects/%s", dirname), 0755)
+	err := shared.MkdirAll(filepath.Join(repo.ObjectsDir(), dirname))
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(fmt.Sprintf(".git/objects/%s/%s", dirname, filename), contents, 0644)
+	path := filepath.Join(repo.ObjectsDir(), dirname, filename)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	err = os.WriteFile(path, contents, 0444)
 	if err != nil {
 		return err
 	}
-	return nil
+	return shared.Adjust(path)
 }
 
-func writeTree(dir string, write bool) (objectname string, err error) {
+// newIgnoreMatcher loads the ignore rules of the current repository.
+func newIgnoreMatcher() (*ignore.Matcher, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	return ignore.New(repo.WorkTree, repo.GitDir, cfg)
+}
+
+func writeTree(dir string, write bool, matcher *ignore.Matcher) (objectname string, err error) {
 	files, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return "", err
@@ -306,14 +502,21 @@ func writeTree(dir string, write bool) (objectname string, err error) {
 	tree := bytes.NewBuffer(nil)
 	for _, file := range files {
 		path := filepath.Join(dir, file.Name())
+		if file.Name() == ".git" {
+			continue
+		}
+		if rel, err := filepath.Rel(repo.WorkTree, path); err == nil && matcher.IsIgnored(rel, file.IsDir()) {
+			continue
+		}
 		if file.IsDir() {
-			if file.Name()[0] == '.' {
-				continue
-			}
-			objectname, err := writeTree(path, write)
+			objectname, err := writeTree(path, write, matcher)
 			if err != nil {
 				return "", nil
 			}
+			// Like git, directories with nothing to track are left out.
+			if objectname == objectFormat.Sum([]byte("tree 0\x00")) {
+				continue
+			}
 			hexName, err := hex.DecodeString(objectname)
 			if err != nil {
 				return "", nil
@@ -333,7 +536,7 @@ func writeTree(dir string, write bool) (objectname string, err error) {
 	}
 	prefix := fmt.Sprintf("tree %d\x00", tree.Len())
 	data := append([]byte(prefix), tree.Bytes()...)
-	hasher := sha1.New()
+	hasher := objectFormat.New()
 	hasher.Write(data)
 	objectname = hex.EncodeToString(hasher.Sum(nil))
 	compressed := bytes.NewBuffer(make([]byte, 0))
@@ -377,10 +580,10 @@ func commitTree(treeSha string, parentCommitSha string, commitMsg string) {
 	data := append([]byte(commitHeader), commitObjContent...)
 	zlibContent, err := myzlib.CompressData(data)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error compress content", err)
+		fmt.Fprintf(os.Stderr, "Error compress content: %s\n", err)
 	}
 
-	sha1Hex := util.GetHashByBlob(data)
+	sha1Hex := util.GetHashByBlob(objectFormat, data)
 
 	WriteObject(sha1Hex, zlibContent)
 
@@ -0,0 +1,164 @@
+package merge
+
+import (
+	"container/heap"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/walk"
+)
+
+// graph loads the commits of the walks of this file.
+type graph struct {
+	*walk.Graph
+}
+
+func newGraph(store *object.Store) *graph {
+	return &graph{walk.NewGraph(store)}
+}
+
+// Bases finds the best common ancestors of one and any of twos: the
+// commits reachable from both sides that no other such commit descends
+// from.
+// ref: https://git-scm.com/docs/git-merge-base#_discussion
+func Bases(store *object.Store, one string, twos []string) ([]string, error) {
+	g := newGraph(store)
+	candidates, err := g.bases(one, twos)
+	if err != nil {
+		return nil, err
+	}
+	return g.independent(candidates)
+}
+
+// bases is paint_down_to_common: commits reached from both sides are
+// candidates, and everything below them is stale.
+// ref: https://github.com/git/git/blob/master/commit-reach.c
+func (g *graph) bases(one string, twos []string) ([]string, error) {
+	const (
+		parent1 = 1 << iota
+		parent2
+		stale
+		result
+	)
+	flags := map[string]int{}
+	q := &walk.Queue{}
+	add := func(sha string, f int) error {
+		if flags[sha]&f == f {
+			return nil
+		}
+		flags[sha] |= f
+		c, err := g.Load(sha)
+		if err != nil {
+			return err
+		}
+		heap.Push(q, c)
+		return nil
+	}
+	if err := add(one, parent1); err != nil {
+		return nil, err
+	}
+	for _, two := range twos {
+		if err := add(two, parent2); err != nil {
+			return nil, err
+		}
+	}
+	found := []string{}
+	nonStale := func() bool {
+		for _, c := range q.Items() {
+			if flags[c.(*walk.Commit).Sha]&stale == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	for nonStale() {
+		c := heap.Pop(q).(*walk.Commit)
+		f := flags[c.Sha] & (parent1 | parent2 | stale)
+		if f == parent1|parent2 {
+			if flags[c.Sha]&result == 0 {
+				flags[c.Sha] |= result
+				found = append(found, c.Sha)
+			}
+			f |= stale
+		}
+		for _, p := range c.Parents {
+			if err := add(p, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	candidates := []string{}
+	for _, sha := range found {
+		if flags[sha]&stale == 0 {
+			candidates = append(candidates, sha)
+		}
+	}
+	return candidates, nil
+}
+
+// Independent drops the commits that are ancestors of another one, as
+// "merge-base --independent" does.
+func Independent(store *object.Store, commits []string) ([]string, error) {
+	return newGraph(store).independent(commits)
+}
+
+func (g *graph) independent(commits []string) ([]string, error) {
+	if len(commits) < 2 {
+		return commits, nil
+	}
+	kept := []string{}
+	for i, sha := range commits {
+		redundant := false
+		for j, other := range commits {
+			if i == j {
+				continue
+			}
+			ancestor, err := g.isAncestor(sha, other)
+			if err != nil {
+				return nil, err
+			}
+			if ancestor && (sha != other || j < i) {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			kept = append(kept, sha)
+		}
+	}
+	return kept, nil
+}
+
+// IsAncestor reports whether ancestor is reachable from commit, not
+// walking past commits older than ancestor.
+func IsAncestor(store *object.Store, ancestor, commit string) (bool, error) {
+	return newGraph(store).isAncestor(ancestor, commit)
+}
+
+func (g *graph) isAncestor(ancestor, commit string) (bool, error) {
+	target, err := g.Load(ancestor)
+	if err != nil {
+		return false, err
+	}
+	seen := map[string]bool{}
+	stack := []string{commit}
+	for len(stack) > 0 {
+		sha := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if sha == ancestor {
+			return true, nil
+		}
+		if seen[sha] {
+			continue
+		}
+		seen[sha] = true
+		c, err := g.Load(sha)
+		if err != nil {
+			return false, err
+		}
+		if c.When < target.When {
+			continue
+		}
+		stack = append(stack, c.Parents...)
+	}
+	return false, nil
+}
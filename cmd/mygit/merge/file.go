@@ -0,0 +1,400 @@
+// Package merge joins the changes two sides made to a common ancestor:
+// line by line for file contents, and path by path for trees, with
+// renames followed the way git's "ort" strategy does. Merges only read
+// and write the object store, never an index or a work tree, so that
+// they serve bare repositories too.
+// ref: https://github.com/git/git/blob/master/xdiff/xmerge.c
+// ref: https://github.com/git/git/blob/master/merge-ort.c
+package merge
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+)
+
+// Style is how conflicts are written out.
+type Style int
+
+const (
+	// StyleMerge shows both sides of a conflict.
+	StyleMerge Style = iota
+	// StyleDiff3 shows the ancestor between them as well.
+	StyleDiff3
+	// StyleZdiff3 is diff3 with the lines both sides agree on at the
+	// ends of a conflict moved out of it.
+	StyleZdiff3
+)
+
+// ParseStyle reads a merge.conflictStyle value.
+func ParseStyle(name string) (Style, bool) {
+	switch name {
+	case "merge":
+		return StyleMerge, true
+	case "diff3":
+		return StyleDiff3, true
+	case "zdiff3":
+		return StyleZdiff3, true
+	}
+	return StyleMerge, false
+}
+
+// Favor resolves conflicts without markers.
+type Favor int
+
+const (
+	FavorNone Favor = iota
+	FavorOurs
+	FavorTheirs
+	FavorUnion // both sides, ours first
+)
+
+// DefaultMarkerSize is the length of the conflict markers.
+const DefaultMarkerSize = 7
+
+// FileOptions tune a file merge.
+type FileOptions struct {
+	Style Style
+	Favor Favor
+	// MarkerSize is the length of the markers; 0 is DefaultMarkerSize.
+	MarkerSize int
+	// The labels follow the markers of each side; empty ones are left
+	// out.
+	AncestorLabel, OursLabel, TheirsLabel string
+}
+
+// Modes of a hunk, as xdiff's xdmerge_t.
+const (
+	hunkConflict = 0
+	hunkOurs     = 1
+	hunkTheirs   = 2
+	hunkBoth     = 3
+	hunkSame     = 4 // a conflict of identical changes
+)
+
+// hunk is a run of lines changed by either side: i0 and chg0 index the
+// ancestor, i1 and chg1 ours, i2 and chg2 theirs.
+type hunk struct {
+	mode     int
+	i0, chg0 int
+	i1, chg1 int
+	i2, chg2 int
+}
+
+type lineMerger struct {
+	base, ours, theirs [][]byte
+	opts               FileOptions
+	hunks              []*hunk
+}
+
+// File merges the changes from base to ours and from base to theirs and
+// returns the result with conflict markers around the changes that
+// overlap, and the number of conflicts.
+// ref: xdl_merge in https://github.com/git/git/blob/master/xdiff/xmerge.c
+func File(base, ours, theirs []byte, opts FileOptions) ([]byte, int) {
+	lineOpts := diff.Options{Algorithm: "myers"}
+	d1 := diff.Lines(base, ours, lineOpts)
+	d2 := diff.Lines(base, theirs, lineOpts)
+	if len(d1.Changes) == 0 {
+		return append([]byte(nil), theirs...), 0
+	}
+	if len(d2.Changes) == 0 {
+		return append([]byte(nil), ours...), 0
+	}
+	m := &lineMerger{base: d1.Old, ours: d1.New, theirs: d2.New, opts: opts}
+	if m.opts.MarkerSize <= 0 {
+		m.opts.MarkerSize = DefaultMarkerSize
+	}
+	m.collect(d1.Changes, d2.Changes)
+	switch opts.Style {
+	case StyleZdiff3:
+		m.refineZdiff3()
+	case StyleMerge:
+		// git merges with XDL_MERGE_ZEALOUS_ALNUM; the diff3 styles,
+		// which show the ancestor, can't go further than EAGER.
+		m.refineConflicts(lineOpts)
+		m.simplifyNonConflicts()
+	}
+	var out bytes.Buffer
+	conflicts := m.fill(&out)
+	return out.Bytes(), conflicts
+}
+
+// add appends a hunk, joining it to the previous one when they touch.
+// ref: xdl_append_merge in https://github.com/git/git/blob/master/xdiff/xmerge.c
+func (m *lineMerger) add(mode, i0, chg0, i1, chg1, i2, chg2 int) {
+	if n := len(m.hunks); n > 0 {
+		h := m.hunks[n-1]
+		if i1 <= h.i1+h.chg1 || i2 <= h.i2+h.chg2 {
+			if mode != h.mode {
+				h.mode = hunkConflict
+			}
+			h.chg0 = i0 + chg0 - h.i0
+			h.chg1 = i1 + chg1 - h.i1
+			h.chg2 = i2 + chg2 - h.i2
+			return
+		}
+	}
+	m.hunks = append(m.hunks, &hunk{mode: mode, i0: i0, chg0: chg0, i1: i1, chg1: chg1, i2: i2, chg2: chg2})
+}
+
+func sameLines(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// collect walks the changes of both sides together into hunks.
+// ref: xdl_do_merge in https://github.com/git/git/blob/master/xdiff/xmerge.c
+func (m *lineMerger) collect(xs1, xs2 []diff.Change) {
+	for len(xs1) > 0 && len(xs2) > 0 {
+		x1, x2 := xs1[0], xs2[0]
+		if x1.Old+x1.OldLen < x2.Old {
+			m.add(hunkOurs, x1.Old, x1.OldLen, x1.New, x1.NewLen, x2.New-x2.Old+x1.Old, x1.OldLen)
+			xs1 = xs1[1:]
+			continue
+		}
+		if x2.Old+x2.OldLen < x1.Old {
+			m.add(hunkTheirs, x2.Old, x2.OldLen, x1.New-x1.Old+x2.Old, x2.OldLen, x2.New, x2.NewLen)
+			xs2 = xs2[1:]
+			continue
+		}
+		if x1.Old != x2.Old || x1.OldLen != x2.OldLen || x1.NewLen != x2.NewLen ||
+			!sameLines(m.ours[x1.New:x1.New+x1.NewLen], m.theirs[x2.New:x2.New+x2.NewLen]) {
+			off := x1.Old - x2.Old
+			ffo := off + x1.OldLen - x2.OldLen
+			i0, i1, i2 := x1.Old, x1.New, x2.New
+			if off > 0 {
+				i0 -= off
+				i1 -= off
+			} else {
+				i2 += off
+			}
+			chg0 := x1.Old + x1.OldLen - i0
+			chg1 := x1.New + x1.NewLen - i1
+			chg2 := x2.New + x2.NewLen - i2
+			if ffo < 0 {
+				chg0 -= ffo
+				chg1 -= ffo
+			} else {
+				chg2 += ffo
+			}
+			m.add(hunkConflict, i0, chg0, i1, chg1, i2, chg2)
+		}
+		end1, end2 := x1.Old+x1.OldLen, x2.Old+x2.OldLen
+		if end1 >= end2 {
+			xs2 = xs2[1:]
+		}
+		if end2 >= end1 {
+			xs1 = xs1[1:]
+		}
+	}
+	for _, x1 := range xs1 {
+		m.add(hunkOurs, x1.Old, x1.OldLen, x1.New, x1.NewLen, x1.Old+len(m.theirs)-len(m.base), x1.OldLen)
+	}
+	for _, x2 := range xs2 {
+		m.add(hunkTheirs, x2.Old, x2.OldLen, x2.Old+len(m.ours)-len(m.base), x2.OldLen, x2.New, x2.NewLen)
+	}
+}
+
+// refineConflicts diffs the two sides of each conflict against each
+// other and keeps only the lines that differ in conflict.
+// ref: xdl_refine_conflicts in https://github.com/git/git/blob/master/xdiff/xmerge.c
+func (m *lineMerger) refineConflicts(opts diff.Options) {
+	refined := []*hunk{}
+	for _, h := range m.hunks {
+		if h.mode != hunkConflict || h.chg1 == 0 || h.chg2 == 0 {
+			refined = append(refined, h)
+			continue
+		}
+		d := diff.Lines(bytes.Join(m.ours[h.i1:h.i1+h.chg1], nil), bytes.Join(m.theirs[h.i2:h.i2+h.chg2], nil), opts)
+		if len(d.Changes) == 0 {
+			h.mode = hunkSame
+			refined = append(refined, h)
+			continue
+		}
+		for _, c := range d.Changes {
+			refined = append(refined, &hunk{mode: hunkConflict, i0: h.i0, i1: h.i1 + c.Old, chg1: c.OldLen, i2: h.i2 + c.New, chg2: c.NewLen})
+		}
+	}
+	m.hunks = refined
+}
+
+// refineZdiff3 moves the lines both sides of a conflict start or end
+// with out of it.
+// ref: xdl_refine_zdiff3_conflicts in https://github.com/git/git/blob/master/xdiff/xmerge.c
+func (m *lineMerger) refineZdiff3() {
+	for _, h := range m.hunks {
+		if h.mode != hunkConflict {
+			continue
+		}
+		for h.chg1 > 0 && h.chg2 > 0 && bytes.Equal(m.ours[h.i1], m.theirs[h.i2]) {
+			h.chg1--
+			h.chg2--
+			h.i1++
+			h.i2++
+		}
+		for h.chg1 > 0 && h.chg2 > 0 && bytes.Equal(m.ours[h.i1+h.chg1-1], m.theirs[h.i2+h.chg2-1]) {
+			h.chg1--
+			h.chg2--
+		}
+	}
+}
+
+func hasAlnum(lines [][]byte) bool {
+	for _, line := range lines {
+		for _, c := range line {
+			if c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// simplifyNonConflicts joins conflicts separated by three lines or
+// fewer, or by lines without any letters or digits, since they read
+// more easily as one.
+// ref: xdl_simplify_non_conflicts in https://github.com/git/git/blob/master/xdiff/xmerge.c
+func (m *lineMerger) simplifyNonConflicts() {
+	for i := 0; i+1 < len(m.hunks); {
+		h, next := m.hunks[i], m.hunks[i+1]
+		begin, end := h.i1+h.chg1, next.i1
+		if h.mode != hunkConflict || next.mode != hunkConflict ||
+			end-begin > 3 && hasAlnum(m.ours[begin:end]) {
+			i++
+			continue
+		}
+		h.chg1 = next.i1 + next.chg1 - h.i1
+		h.chg2 = next.i2 + next.chg2 - h.i2
+		m.hunks = append(m.hunks[:i+1], m.hunks[i+2:]...)
+	}
+}
+
+// crlf tells whether line i of a file ends with CRLF; -1 means there is
+// no telling.
+// ref: is_eol_crlf in https://github.com/git/git/blob/master/xdiff/xmerge.c
+func crlf(lines [][]byte, i int) int {
+	isCRLF := func(line []byte) int {
+		if len(line) > 1 && line[len(line)-2] == '\r' && line[len(line)-1] == '\n' {
+			return 1
+		}
+		return 0
+	}
+	if i < len(lines)-1 {
+		return isCRLF(lines[i])
+	}
+	if len(lines) == 0 {
+		return -1
+	}
+	if line := lines[i]; len(line) > 0 && line[len(line)-1] == '\n' {
+		return isCRLF(line)
+	}
+	if i == 0 {
+		return -1
+	}
+	return isCRLF(lines[i-1])
+}
+
+// needsCR tells whether the markers of a hunk end with CRLF, going by
+// the lines before it.
+func (m *lineMerger) needsCR(h *hunk) bool {
+	before := func(i int) int {
+		if i > 0 {
+			return i - 1
+		}
+		return 0
+	}
+	cr := crlf(m.ours, before(h.i1))
+	if cr != 0 {
+		cr = crlf(m.theirs, before(h.i2))
+	}
+	if cr != 0 {
+		cr = crlf(m.base, 0)
+	}
+	return cr > 0
+}
+
+// copyLines writes lines, ending the last one if addNL asks for it.
+func copyLines(out *bytes.Buffer, lines [][]byte, needsCR, addNL bool) {
+	for _, line := range lines {
+		out.Write(line)
+	}
+	if addNL && len(lines) > 0 {
+		last := lines[len(lines)-1]
+		if len(last) == 0 || last[len(last)-1] != '\n' {
+			if needsCR {
+				out.WriteByte('\r')
+			}
+			out.WriteByte('\n')
+		}
+	}
+}
+
+func (m *lineMerger) marker(out *bytes.Buffer, c byte, label string, needsCR bool) {
+	out.WriteString(strings.Repeat(string(c), m.opts.MarkerSize))
+	if label != "" {
+		out.WriteString(" " + label)
+	}
+	if needsCR {
+		out.WriteByte('\r')
+	}
+	out.WriteByte('\n')
+}
+
+// fill writes the merged file and counts the conflicts left in it.
+// ref: xdl_fill_merge_buffer in https://github.com/git/git/blob/master/xdiff/xmerge.c
+func (m *lineMerger) fill(out *bytes.Buffer) int {
+	conflicts := 0
+	i := 0
+	for _, h := range m.hunks {
+		if m.opts.Favor != FavorNone && h.mode == hunkConflict {
+			h.mode = int(m.opts.Favor)
+		}
+		switch {
+		case h.mode == hunkConflict:
+			conflicts++
+			cr := m.needsCR(h)
+			copyLines(out, m.ours[i:h.i1], false, false)
+			m.marker(out, '<', m.opts.OursLabel, cr)
+			copyLines(out, m.ours[h.i1:h.i1+h.chg1], cr, true)
+			if m.opts.Style != StyleMerge {
+				m.marker(out, '|', m.opts.AncestorLabel, cr)
+				copyLines(out, m.base[h.i0:h.i0+h.chg0], cr, true)
+			}
+			m.marker(out, '=', "", cr)
+			copyLines(out, m.theirs[h.i2:h.i2+h.chg2], cr, true)
+			m.marker(out, '>', m.opts.TheirsLabel, cr)
+		case h.mode&hunkBoth != 0:
+			copyLines(out, m.ours[i:h.i1], false, false)
+			if h.mode&hunkOurs != 0 {
+				copyLines(out, m.ours[h.i1:h.i1+h.chg1], m.needsCR(h), h.mode&hunkTheirs != 0)
+			}
+			if h.mode&hunkTheirs != 0 {
+				copyLines(out, m.theirs[h.i2:h.i2+h.chg2], false, false)
+			}
+		default:
+			continue
+		}
+		i = h.i1 + h.chg1
+	}
+	copyLines(out, m.ours[i:], false, false)
+	return conflicts
+}
+
+// IsBinary tells whether contents can't be merged line by line: they
+// have a NUL in their first 8000 bytes.
+// ref: buffer_is_binary in https://github.com/git/git/blob/master/xdiff-interface.c
+func IsBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
@@ -0,0 +1,109 @@
+package merge
+
+import (
+	"errors"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// virtual is a side of a merge: a commit, or the merge of several
+// commits that only exists for the merge of their descendants.
+type virtual struct {
+	tree    string
+	commits []string
+}
+
+// ErrUnrelatedHistories is returned by Tree for commits without a merge
+// base, unless Options.AllowUnrelatedHistories is set.
+var ErrUnrelatedHistories = errors.New("refusing to merge unrelated histories")
+
+// Tree merges the commit theirs into the commit ours from their merge
+// bases, in the object database alone, as "merge-tree --write-tree"
+// does.
+// ref: https://git-scm.com/docs/git-merge-tree
+func Tree(ours, theirs string, opts Options) (*Result, error) {
+	bases, err := Bases(opts.Store, ours, []string{theirs})
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 && !opts.AllowUnrelatedHistories {
+		return nil, ErrUnrelatedHistories
+	}
+	return Commits(bases, ours, theirs, opts)
+}
+
+// Commits merges the commit theirs into the commit ours. Several merge
+// bases are merged together first, recursively, into a virtual base;
+// no merge base at all is the empty tree.
+// ref: merge_ort_internal in https://github.com/git/git/blob/master/merge-ort.c
+func Commits(bases []string, ours, theirs string, opts Options) (*Result, error) {
+	m := &merger{opts: opts}
+	oursTree, err := m.treeOf(ours)
+	if err != nil {
+		return nil, err
+	}
+	theirsTree, err := m.treeOf(theirs)
+	if err != nil {
+		return nil, err
+	}
+	return m.mergeCommits(bases, virtual{oursTree, []string{ours}}, virtual{theirsTree, []string{theirs}})
+}
+
+func (m *merger) treeOf(commit string) (string, error) {
+	data, err := m.opts.Store.ReadType(commit, "commit")
+	if err != nil {
+		return "", err
+	}
+	c, err := object.ParseCommit(data)
+	if err != nil {
+		return "", err
+	}
+	return c.Tree, nil
+}
+
+func (m *merger) mergeCommits(bases []string, ours, theirs virtual) (*Result, error) {
+	var base string
+	switch len(bases) {
+	case 0:
+		m.opts.AncestorLabel = "empty tree"
+	case 1:
+		tree, err := m.treeOf(bases[0])
+		if err != nil {
+			return nil, err
+		}
+		base = tree
+		m.opts.AncestorLabel = m.opts.Store.Abbrev(bases[0], 7)
+	default:
+		// Like git, merge the oldest merge bases first.
+		reversed := make([]string, len(bases))
+		for i, sha := range bases {
+			reversed[len(bases)-1-i] = sha
+		}
+		tree, err := m.treeOf(reversed[0])
+		if err != nil {
+			return nil, err
+		}
+		merged := virtual{tree, reversed[:1]}
+		for _, next := range reversed[1:] {
+			tree, err := m.treeOf(next)
+			if err != nil {
+				return nil, err
+			}
+			innerBases, err := Bases(m.opts.Store, next, merged.commits)
+			if err != nil {
+				return nil, err
+			}
+			inner := &merger{opts: m.opts, depth: m.depth + 1}
+			inner.opts.OursLabel = "Temporary merge branch 1"
+			inner.opts.TheirsLabel = "Temporary merge branch 2"
+			res, err := inner.mergeCommits(innerBases, merged, virtual{tree, []string{next}})
+			if err != nil {
+				return nil, err
+			}
+			merged = virtual{res.Tree, append(append([]string(nil), merged.commits...), next)}
+		}
+		base = merged.tree
+		m.opts.AncestorLabel = "merged common ancestors"
+	}
+	return m.mergeTrees(base, ours.tree, theirs.tree)
+}
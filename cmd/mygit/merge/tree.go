@@ -0,0 +1,604 @@
+package merge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/unpack"
+)
+
+// Options tune a tree merge.
+type Options struct {
+	Store *object.Store
+	// The labels name the sides in conflict markers and messages, such
+	// as "HEAD" and the branch being merged.
+	AncestorLabel, OursLabel, TheirsLabel string
+	Style                                 Style
+	// Favor resolves content conflicts, as "-X ours" and "-X theirs".
+	Favor Favor
+	// NoRenames turns rename detection off. RenameScore is the
+	// similarity renames need, 0 for the default; RenameLimit caps the
+	// inexact comparisons as diff.RenameOptions.Limit does.
+	NoRenames   bool
+	RenameScore int
+	RenameLimit int
+	// AllowUnrelatedHistories lets Tree merge commits without a merge
+	// base, from the empty tree.
+	AllowUnrelatedHistories bool
+}
+
+// Result is the outcome of a merge.
+type Result struct {
+	// Tree is the merged tree. Conflicted files are in it with their
+	// conflict markers, or as the side that kept them.
+	Tree  string
+	Clean bool
+	// Unmerged are the index entries of the conflicts, at stages 1 to
+	// 3, in index order.
+	Unmerged []*index.Entry
+	// Messages report the paths merged and their conflicts, ordered by
+	// path.
+	Messages []Message
+}
+
+// Message is one line of a merge report.
+type Message struct {
+	// Paths are those the message is about, the first being the one
+	// messages are ordered by.
+	Paths []string
+	// Type is the kind of message as "merge-tree -z" names it, such as
+	// "Auto-merging" or "CONFLICT (contents)".
+	Type string
+	Text string
+}
+
+// The sides of a merge, as the stages of their index entries less one.
+const (
+	sideBase = iota
+	sideOurs
+	sideTheirs
+)
+
+// item is a path of the result with what each side has for it. The
+// sides may have it at other paths when it was renamed.
+type item struct {
+	path    string
+	entries [3]*index.Entry
+	paths   [3]string
+	// renameDeleted is set when one side renamed the file the other
+	// deleted.
+	renameDeleted bool
+	// done is the outcome of a conflict settled while renames were.
+	done *outcome
+}
+
+// outcome is what a path becomes: the entry of the merged tree, and the
+// stages of the index if it is in conflict.
+type outcome struct {
+	result   *index.Entry
+	conflict bool
+	stages   []*index.Entry
+}
+
+type merger struct {
+	opts     Options
+	depth    int
+	items    map[string]*item
+	messages []Message
+}
+
+// Trees merges the changes from the base tree to ours and from the base
+// tree to theirs. An empty base is the empty tree.
+// ref: merge_incore_nonrecursive in https://github.com/git/git/blob/master/merge-ort.c
+func Trees(base, ours, theirs string, opts Options) (*Result, error) {
+	m := &merger{opts: opts}
+	return m.mergeTrees(base, ours, theirs)
+}
+
+func (m *merger) msg(typ, text string, paths ...string) {
+	if m.depth > 0 {
+		// Like git at its default verbosity, say nothing of the
+		// merges of merge bases.
+		return
+	}
+	m.messages = append(m.messages, Message{Paths: paths, Type: typ, Text: text})
+}
+
+func (m *merger) mergeTrees(base, ours, theirs string) (*Result, error) {
+	m.items = map[string]*item{}
+	for side, tree := range []string{base, ours, theirs} {
+		entries, err := unpack.ReadTree(m.opts.Store, tree)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			m.item(e.Path).entries[side] = e
+		}
+	}
+	if !m.opts.NoRenames {
+		if err := m.renames(base, ours, theirs); err != nil {
+			return nil, err
+		}
+	}
+	if m.depth == 0 {
+		m.splitTypes()
+	}
+
+	paths := []string{}
+	for path := range m.items {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	outcomes := map[string]*outcome{}
+	dirs := map[string]bool{}
+	for _, path := range paths {
+		o, err := m.resolve(m.items[path])
+		if err != nil {
+			return nil, err
+		}
+		outcomes[path] = o
+		if o.result != nil {
+			for dir := path; strings.Contains(dir, "/"); {
+				dir = dir[:strings.LastIndexByte(dir, '/')]
+				dirs[dir] = true
+			}
+		}
+	}
+
+	res := &Result{Clean: true}
+	results := []*index.Entry{}
+	for _, path := range paths {
+		it, o := m.items[path], outcomes[path]
+		if o.result != nil && dirs[path] {
+			// A file where the merge leaves a directory moves aside.
+			label := m.opts.OursLabel
+			if it.entries[sideOurs] == nil {
+				label = m.opts.TheirsLabel
+			}
+			newPath := m.uniquePath(path, label)
+			m.msg("CONFLICT (file/directory)", fmt.Sprintf("CONFLICT (file/directory): directory in the way of %s from %s; moving it to %s instead.", path, label, newPath), path, newPath)
+			m.move(it, newPath)
+			var err error
+			if o, err = m.resolve(it); err != nil {
+				return nil, err
+			}
+			o.conflict = true
+			if o.stages == nil {
+				o.stages = m.stagesOf(it)
+			}
+		}
+		m.report(it, o)
+		if o.result != nil {
+			e := *o.result
+			e.Path, e.Stage = it.path, 0
+			results = append(results, &e)
+		}
+		if o.conflict {
+			res.Clean = false
+			res.Unmerged = append(res.Unmerged, o.stages...)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	sort.SliceStable(res.Unmerged, func(i, j int) bool {
+		a, b := res.Unmerged[i], res.Unmerged[j]
+		return a.Path < b.Path || a.Path == b.Path && a.Stage < b.Stage
+	})
+	sort.SliceStable(m.messages, func(i, j int) bool { return m.messages[i].Paths[0] < m.messages[j].Paths[0] })
+	res.Messages = m.messages
+	var err error
+	res.Tree, err = unpack.WriteTree(m.opts.Store, results)
+	return res, err
+}
+
+// move puts an item at another path of the result.
+func (m *merger) move(it *item, path string) {
+	for i := range it.paths {
+		if it.paths[i] == it.path {
+			it.paths[i] = path
+		}
+	}
+	it.path = path
+	m.items[path] = it
+}
+
+func (m *merger) item(path string) *item {
+	it := m.items[path]
+	if it == nil {
+		it = &item{path: path, paths: [3]string{path, path, path}}
+		m.items[path] = it
+	}
+	return it
+}
+
+// uniquePath is "<path>~<label>", with a number added if a path of the
+// merge already has that name.
+// ref: unique_path in https://github.com/git/git/blob/master/merge-ort.c
+func (m *merger) uniquePath(path, label string) string {
+	newPath := path + "~" + strings.ReplaceAll(label, "/", "_")
+	base := newPath
+	for i := 0; m.items[newPath] != nil; i++ {
+		newPath = fmt.Sprintf("%s_%d", base, i)
+	}
+	return newPath
+}
+
+// renames pairs up the files each side renamed, so that their changes
+// meet the changes of the other side at the new path.
+// ref: detect_and_process_renames in https://github.com/git/git/blob/master/merge-ort.c
+func (m *merger) renames(base, ours, theirs string) error {
+	var renamed [3]map[string]string
+	for _, side := range []int{sideOurs, sideTheirs} {
+		tree := ours
+		if side == sideTheirs {
+			tree = theirs
+		}
+		pairs, err := diff.Trees(m.opts.Store, base, tree, diff.TreeOptions{Recursive: true})
+		if err != nil {
+			return err
+		}
+		pairs, err = diff.Detect(m.opts.Store, pairs, diff.RenameOptions{Detect: diff.DetectRenames, MinScore: m.opts.RenameScore, Limit: m.opts.RenameLimit})
+		if err != nil {
+			return err
+		}
+		renamed[side] = map[string]string{}
+		for _, p := range pairs {
+			if p.Status == diff.Renamed {
+				renamed[side][p.Old.Path] = p.New.Path
+			}
+		}
+	}
+	sources := []string{}
+	for _, side := range []int{sideOurs, sideTheirs} {
+		for old := range renamed[side] {
+			if side == sideOurs || renamed[sideOurs][old] == "" {
+				sources = append(sources, old)
+			}
+		}
+	}
+	sort.Strings(sources)
+	for _, old := range sources {
+		if err := m.rename(old, renamed[sideOurs][old], renamed[sideTheirs][old]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rename moves the changes to the file at old to the paths ours and
+// theirs renamed it to, either of which may be "" for no rename.
+// ref: process_renames in https://github.com/git/git/blob/master/merge-ort.c
+func (m *merger) rename(old, oursPath, theirsPath string) error {
+	src := m.items[old]
+	// A rename onto a file the other side added leaves both as they
+	// are, to conflict as a deletion and an addition.
+	if oursPath != "" && m.item(oursPath).entries[sideTheirs] != nil && oursPath != theirsPath {
+		oursPath = ""
+	}
+	if theirsPath != "" && m.item(theirsPath).entries[sideOurs] != nil && oursPath != theirsPath {
+		theirsPath = ""
+	}
+	switch {
+	case oursPath == "" && theirsPath == "":
+		return nil
+	case oursPath == theirsPath:
+		dst := m.items[oursPath]
+		dst.entries[sideBase], dst.paths[sideBase] = src.entries[sideBase], old
+		delete(m.items, old)
+		return nil
+	case oursPath != "" && theirsPath != "":
+		return m.renameRename(src, oursPath, theirsPath)
+	}
+	side, other, newPath := sideOurs, sideTheirs, oursPath
+	if oursPath == "" {
+		side, other, newPath = sideTheirs, sideOurs, theirsPath
+	}
+	dst := m.items[newPath]
+	dst.entries[sideBase], dst.paths[sideBase] = src.entries[sideBase], old
+	dst.entries[other], dst.paths[other] = src.entries[other], old
+	delete(m.items, old)
+	if src.entries[other] == nil {
+		dst.renameDeleted = true
+		m.msg("CONFLICT (rename/delete)", fmt.Sprintf("CONFLICT (rename/delete): %s renamed to %s in %s, but deleted in %s.", old, newPath, m.label(side), m.label(other)), newPath, old)
+	}
+	return nil
+}
+
+func (m *merger) label(side int) string {
+	switch side {
+	case sideOurs:
+		return m.opts.OursLabel
+	case sideTheirs:
+		return m.opts.TheirsLabel
+	}
+	return m.opts.AncestorLabel
+}
+
+// renameRename settles a file the two sides renamed differently: both
+// new paths get the merged contents, and the old one keeps the base in
+// the index.
+func (m *merger) renameRename(src *item, oursPath, theirsPath string) error {
+	old := src.path
+	o := src.entries[sideBase]
+	a, b := m.items[oursPath], m.items[theirsPath]
+	merged := a.entries[sideOurs]
+	if isRegular(o) && isRegular(a.entries[sideOurs]) && isRegular(b.entries[sideTheirs]) {
+		contents, _, err := m.mergeBlobs(o, a.entries[sideOurs], b.entries[sideTheirs], [3]string{old, oursPath, theirsPath}, 1)
+		if err != nil {
+			return err
+		}
+		sha, err := m.opts.Store.Write("blob", contents)
+		if err != nil {
+			return err
+		}
+		merged = &index.Entry{Mode: a.entries[sideOurs].Mode, Sha: sha}
+	}
+	src.done = &outcome{conflict: true, stages: []*index.Entry{stage(o, old, 1)}}
+	a.done = &outcome{result: merged, conflict: true, stages: []*index.Entry{stage(merged, oursPath, 2)}}
+	theirsMerged := merged
+	if !isRegular(b.entries[sideTheirs]) {
+		theirsMerged = b.entries[sideTheirs]
+	}
+	b.done = &outcome{result: theirsMerged, conflict: true, stages: []*index.Entry{stage(theirsMerged, theirsPath, 3)}}
+	m.msg("CONFLICT (rename/rename)", fmt.Sprintf("CONFLICT (rename/rename): %s renamed to %s in %s and to %s in %s.", old, oursPath, m.opts.OursLabel, theirsPath, m.opts.TheirsLabel), old, oursPath, theirsPath)
+	return nil
+}
+
+// splitTypes moves apart the files, symbolic links and submodules the
+// two sides put at the same path: a regular file moves to
+// "<path>~<label>", or both do if neither is one.
+// ref: process_entry in https://github.com/git/git/blob/master/merge-ort.c
+func (m *merger) splitTypes() {
+	paths := []string{}
+	for path, it := range m.items {
+		a, b := it.entries[sideOurs], it.entries[sideTheirs]
+		if it.done == nil && !it.renameDeleted && a != nil && b != nil && fileType(a) != fileType(b) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		it := m.items[path]
+		o, a, b := it.entries[sideBase], it.entries[sideOurs], it.entries[sideTheirs]
+		moveOurs, moveTheirs := isRegular(a), !isRegular(a) && isRegular(b)
+		how := "one"
+		if !moveOurs && !moveTheirs {
+			moveOurs, moveTheirs, how = true, true, "both"
+		}
+		m.msg("CONFLICT (distinct types)", fmt.Sprintf("CONFLICT (distinct types): %s had different types on each side; renamed %s of them so each can be recorded somewhere.", path, how), path)
+		ours, theirs := &item{path: path, paths: it.paths}, &item{path: path, paths: it.paths}
+		ours.entries[sideOurs], theirs.entries[sideTheirs] = a, b
+		if o != nil && fileType(o) == fileType(a) {
+			ours.entries[sideBase] = o
+		}
+		if o != nil && fileType(o) == fileType(b) {
+			theirs.entries[sideBase] = o
+		}
+		delete(m.items, path)
+		for _, part := range []struct {
+			it    *item
+			move  bool
+			label string
+			e     *index.Entry
+		}{{ours, moveOurs, m.opts.OursLabel, a}, {theirs, moveTheirs, m.opts.TheirsLabel, b}} {
+			newPath := path
+			if part.move {
+				newPath = m.uniquePath(path, part.label)
+			}
+			part.it.path = newPath
+			m.items[newPath] = part.it
+			part.it.done = &outcome{result: part.e, conflict: true, stages: m.stagesOf(part.it)}
+		}
+	}
+}
+
+// stage makes the index entry of one side of a conflict.
+func stage(e *index.Entry, path string, n int) *index.Entry {
+	return &index.Entry{Mode: e.Mode, Sha: e.Sha, Path: path, Stage: n}
+}
+
+// stagesOf lists the index entries of the sides an item has.
+func (m *merger) stagesOf(it *item) []*index.Entry {
+	stages := []*index.Entry{}
+	for side, e := range it.entries {
+		if e != nil {
+			stages = append(stages, stage(e, it.path, side+1))
+		}
+	}
+	return stages
+}
+
+func same(a, b *index.Entry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Mode == b.Mode && a.Sha == b.Sha
+}
+
+func isRegular(e *index.Entry) bool {
+	return e != nil && e.Mode&0170000 == 0100000
+}
+
+func fileType(e *index.Entry) uint32 {
+	return e.Mode & 0170000
+}
+
+// resolve decides what a path becomes. The messages about it wait for
+// report, since a directory in the way may still move it.
+// ref: process_entry in https://github.com/git/git/blob/master/merge-ort.c
+func (m *merger) resolve(it *item) (*outcome, error) {
+	if it.done != nil {
+		return it.done, nil
+	}
+	o, a, b := it.entries[sideBase], it.entries[sideOurs], it.entries[sideTheirs]
+	if it.renameDeleted {
+		kept := a
+		if kept == nil {
+			kept = b
+		}
+		res := &outcome{result: kept, conflict: true, stages: m.stagesOf(it)}
+		if m.depth > 0 {
+			res.result = o
+		}
+		return res, nil
+	}
+	switch {
+	case same(a, b):
+		return &outcome{result: a}, nil
+	case same(o, a):
+		return &outcome{result: b}, nil
+	case same(o, b):
+		return &outcome{result: a}, nil
+	case a == nil || b == nil:
+		// Modified on one side and deleted on the other.
+		kept := a
+		if kept == nil {
+			kept = b
+		}
+		res := &outcome{result: kept, conflict: true, stages: m.stagesOf(it)}
+		if m.depth > 0 {
+			res.result = o
+		}
+		return res, nil
+	case fileType(a) != fileType(b):
+		res := &outcome{result: a, conflict: true, stages: m.stagesOf(it)}
+		if m.depth > 0 {
+			res.result = o
+		}
+		return res, nil
+	}
+	// Both sides changed it: merge the modes, then the contents.
+	res := &outcome{result: &index.Entry{Mode: a.Mode}}
+	if a.Mode == b.Mode || o != nil && a.Mode == o.Mode {
+		res.result.Mode = b.Mode
+	} else {
+		res.conflict = o == nil || b.Mode != o.Mode
+	}
+	switch {
+	case a.Sha == b.Sha || o != nil && a.Sha == o.Sha:
+		res.result.Sha = b.Sha
+	case o != nil && b.Sha == o.Sha:
+		res.result.Sha = a.Sha
+	case isRegular(a):
+		contents, conflicts, err := m.mergeBlobs(o, a, b, it.paths, 0)
+		if err != nil {
+			return nil, err
+		}
+		if conflicts < 0 {
+			// Binary files aren't merged: ours stays, or the base in
+			// an inner merge.
+			res.result.Sha = a.Sha
+			if m.depth > 0 {
+				res.result.Sha = m.opts.Store.Hash("blob", nil)
+				if o != nil {
+					res.result.Sha = o.Sha
+				}
+			}
+		} else if res.result.Sha, err = m.opts.Store.Write("blob", contents); err != nil {
+			return nil, err
+		}
+		res.conflict = res.conflict || conflicts != 0
+	default:
+		// Symbolic links and submodules can't be merged.
+		res.result.Sha = a.Sha
+		res.conflict = true
+	}
+	if res.conflict {
+		res.stages = m.stagesOf(it)
+	}
+	return res, nil
+}
+
+// report records the messages about a path as it was resolved.
+func (m *merger) report(it *item, res *outcome) {
+	if it.done != nil || it.renameDeleted {
+		return
+	}
+	o, a, b := it.entries[sideBase], it.entries[sideOurs], it.entries[sideTheirs]
+	path := it.path
+	switch {
+	case same(a, b) || same(o, a) || same(o, b):
+		return
+	case a == nil || b == nil:
+		deleted, modified := m.opts.OursLabel, m.opts.TheirsLabel
+		if b == nil {
+			deleted, modified = modified, deleted
+		}
+		m.msg("CONFLICT (modify/delete)", fmt.Sprintf("CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.", path, deleted, modified, modified, path), path)
+		return
+	case fileType(a) != fileType(b):
+		// Inner merges keep the base; see splitTypes.
+		return
+	}
+	contentMerged := isRegular(a) && a.Sha != b.Sha && !(o != nil && (a.Sha == o.Sha || b.Sha == o.Sha))
+	if contentMerged && m.opts.Favor == FavorNone && (IsBinary(m.read(o)) || IsBinary(m.read(a)) || IsBinary(m.read(b))) {
+		m.msg("CONFLICT (binary)", fmt.Sprintf("warning: Cannot merge binary files: %s (%s vs. %s)", path, m.opts.OursLabel, m.opts.TheirsLabel), path)
+	}
+	if contentMerged {
+		m.msg("Auto-merging", "Auto-merging "+path, path)
+	}
+	if res.conflict {
+		reason := "content"
+		if o == nil {
+			reason = "add/add"
+		} else if fileType(a) == 0160000 {
+			reason = "submodule"
+		}
+		m.msg("CONFLICT (contents)", fmt.Sprintf("CONFLICT (%s): Merge conflict in %s", reason, path), path)
+	}
+}
+
+// read is the contents of a blob entry, nil for none or on errors,
+// which mergeBlobs reports.
+func (m *merger) read(e *index.Entry) []byte {
+	if e == nil {
+		return nil
+	}
+	data, _ := m.opts.Store.ReadType(e.Sha, "blob")
+	return data
+}
+
+// mergeBlobs merges the contents of three files, labelling the markers
+// with the paths when the sides don't agree on them. Binary contents
+// aren't merged and return -1 conflicts unless a side is favored.
+// ref: merge_3way in https://github.com/git/git/blob/master/merge-ort.c
+func (m *merger) mergeBlobs(o, a, b *index.Entry, paths [3]string, extraMarkers int) ([]byte, int, error) {
+	var contents [3][]byte
+	for i, e := range []*index.Entry{o, a, b} {
+		if e == nil {
+			continue
+		}
+		data, err := m.opts.Store.ReadType(e.Sha, "blob")
+		if err != nil {
+			return nil, 0, err
+		}
+		contents[i] = data
+	}
+	labels := [3]string{m.opts.AncestorLabel, m.opts.OursLabel, m.opts.TheirsLabel}
+	if paths[0] != paths[1] || paths[0] != paths[2] {
+		for i := range labels {
+			labels[i] += ":" + paths[i]
+		}
+	}
+	if IsBinary(contents[0]) || IsBinary(contents[1]) || IsBinary(contents[2]) {
+		switch m.opts.Favor {
+		case FavorTheirs:
+			return contents[2], 0, nil
+		case FavorOurs:
+			return contents[1], 0, nil
+		}
+		return contents[1], -1, nil
+	}
+	merged, conflicts := File(contents[0], contents[1], contents[2], FileOptions{
+		Style:         m.opts.Style,
+		Favor:         m.opts.Favor,
+		MarkerSize:    DefaultMarkerSize + extraMarkers + m.depth*2,
+		AncestorLabel: labels[0],
+		OursLabel:     labels[1],
+		TheirsLabel:   labels[2],
+	})
+	return merged, conflicts, nil
+}
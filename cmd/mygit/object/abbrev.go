@@ -0,0 +1,91 @@
+package object
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MinAbbrev is the shortest prefix accepted as an abbreviated object name.
+const MinAbbrev = 4
+
+// FindPrefix returns the names of every object, loose or packed, that
+// start with the given hex prefix, sorted.
+func (s *Store) FindPrefix(prefix string) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < 2 {
+		return nil, nil
+	}
+	found := map[string]bool{}
+	files, err := ioutil.ReadDir(filepath.Join(s.Dir, prefix[:2]))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, file := range files {
+		name := prefix[:2] + file.Name()
+		if s.Algo.IsHex(name) && strings.HasPrefix(name, prefix) {
+			found[name] = true
+		}
+	}
+	if err := s.loadPacks(); err != nil {
+		return nil, err
+	}
+	for _, p := range s.packs {
+		p.findPrefix(prefix, found)
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// findPrefix adds the names in the index starting with prefix to found.
+func (p *pack) findPrefix(prefix string, found map[string]bool) {
+	padded := prefix
+	if len(padded)%2 == 1 {
+		padded += "0"
+	}
+	raw, err := hex.DecodeString(padded)
+	if err != nil || len(raw) == 0 {
+		return
+	}
+	lo := 0
+	if raw[0] > 0 {
+		lo = int(p.fanout[raw[0]-1])
+	}
+	hi := int(p.fanout[raw[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.name(lo+i), raw) >= 0
+	})
+	for ; i < hi; i++ {
+		name := hex.EncodeToString(p.name(i))
+		if !strings.HasPrefix(name, prefix) {
+			break
+		}
+		found[name] = true
+	}
+}
+
+// Abbrev returns the shortest prefix of sha, at least min characters
+// long, that names no other object.
+func (s *Store) Abbrev(sha string, min int) string {
+	if min < MinAbbrev {
+		min = MinAbbrev
+	}
+	for n := min; n < len(sha); n++ {
+		names, err := s.FindPrefix(sha[:n])
+		if err != nil {
+			return sha
+		}
+		if len(names) <= 1 {
+			return sha[:n]
+		}
+	}
+	return sha
+}
@@ -0,0 +1,311 @@
+package object
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature is the "Name <email> <unix seconds> <+hhmm>" of the author or
+// committer of a commit, or the tagger of a tag.
+type Signature struct {
+	Name  string
+	Email string
+	Unix  int64
+	// Timezone is the offset as recorded, such as "+0900". It is kept as
+	// text since "-0000" and "+0000" differ.
+	Timezone string
+
+	// raw holds a line that doesn't parse, so that it is written back
+	// unchanged.
+	raw string
+}
+
+// ParseSignature splits an ident line the way git's split_ident_line
+// does: the name runs up to the first "<", the email up to the last ">".
+func ParseSignature(line string) (Signature, error) {
+	lt := strings.IndexByte(line, '<')
+	gt := strings.LastIndexByte(line, '>')
+	if lt < 0 || gt < lt {
+		return Signature{raw: line}, fmt.Errorf("invalid ident: %s", line)
+	}
+	sig := Signature{
+		Name:  strings.TrimRight(line[:lt], " "),
+		Email: line[lt+1 : gt],
+	}
+	fields := strings.Split(line[gt+1:], " ")
+	if len(fields) != 3 || fields[0] != "" {
+		return Signature{raw: line}, fmt.Errorf("invalid ident date: %s", line)
+	}
+	unix, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || strconv.FormatInt(unix, 10) != fields[1] {
+		return Signature{raw: line}, fmt.Errorf("invalid ident date: %s", line)
+	}
+	tz := fields[2]
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') || strings.Trim(tz[1:], "0123456789") != "" {
+		return Signature{raw: line}, fmt.Errorf("invalid ident timezone: %s", line)
+	}
+	sig.Unix, sig.Timezone = unix, tz
+	if sig.String() != line {
+		// Spacing git wouldn't write, such as a name without the space
+		// before "<".
+		sig.raw = line
+	}
+	return sig, nil
+}
+
+// NewSignature makes the signature of name and email at t, recording the
+// offset of t.
+func NewSignature(name, email string, t time.Time) Signature {
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	tz := fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset/60%60)
+	return Signature{Name: name, Email: email, Unix: t.Unix(), Timezone: tz}
+}
+
+// When is the time of the signature in its own timezone.
+func (s Signature) When() time.Time {
+	offset := 0
+	if len(s.Timezone) == 5 {
+		hours, _ := strconv.Atoi(s.Timezone[1:3])
+		minutes, _ := strconv.Atoi(s.Timezone[3:5])
+		offset = hours*3600 + minutes*60
+		if s.Timezone[0] == '-' {
+			offset = -offset
+		}
+	}
+	return time.Unix(s.Unix, 0).In(time.FixedZone("", offset))
+}
+
+func (s Signature) String() string {
+	if s.raw != "" {
+		return s.raw
+	}
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.Unix, s.Timezone)
+}
+
+// Header is one header of a commit or tag. Values of multi-line headers
+// such as gpgsig are joined with "\n", without the leading spaces of the
+// continuation lines.
+type Header struct {
+	Key, Value string
+
+	// bare is set for a line without a space after the key, which is
+	// written back without one.
+	bare bool
+}
+
+// String is the header as it is written in the object.
+func (h Header) String() string {
+	value := strings.ReplaceAll(h.Value, "\n", "\n ")
+	if h.bare {
+		return h.Key + value
+	}
+	return h.Key + " " + value
+}
+
+// Commit is a parsed commit object.
+// ref: https://git-scm.com/docs/signature-format#_commit_signatures
+type Commit struct {
+	Tree      string
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	// Encoding is the "encoding" header; empty means UTF-8.
+	Encoding string
+	// MergeTags are the signed tags merged by the commit, kept so that
+	// their signatures can still be checked.
+	MergeTags []string
+	// GPGSig is the signature over the rest of the object, gpgsig for
+	// sha1 repositories and gpgsig-sha256 for sha256 ones.
+	GPGSig       string
+	GPGSigSHA256 string
+	// Extra holds the headers git doesn't know about, in order, and those
+	// it wouldn't have written: a second tree, an author without a value.
+	Extra   []Header
+	Message string
+
+	// order is the sequence of header keys as parsed, "" standing for
+	// the next header of Extra. Headers are written back in this order
+	// so that the object keeps its name.
+	order []string
+	// noMessage is set when the object ends with its headers, without the
+	// empty line before a message.
+	noMessage bool
+}
+
+// ParseCommit decodes a commit object. Commits from the wild aren't
+// always well formed, so a bad author or committer line is kept as it is
+// rather than rejected.
+func ParseCommit(buf []byte) (*Commit, error) {
+	headers, message, ok, err := parseHeaders(buf)
+	if err != nil {
+		return nil, err
+	}
+	c := &Commit{Message: message, noMessage: !ok}
+	for _, h := range headers {
+		if c.parseHeader(h) {
+			c.order = append(c.order, h.Key)
+		} else {
+			c.order = append(c.order, "")
+			c.Extra = append(c.Extra, h)
+		}
+	}
+	if c.Tree == "" {
+		return nil, errors.New("invalid commit: no tree")
+	}
+	return c, nil
+}
+
+// parseHeader sets the field of a header git knows about. Like git, it
+// takes the first of repeated headers; those and headers without a value
+// are left for Extra.
+func (c *Commit) parseHeader(h Header) bool {
+	if h.Value == "" {
+		return false
+	}
+	switch h.Key {
+	case "tree":
+		if c.Tree != "" {
+			return false
+		}
+		c.Tree = h.Value
+	case "parent":
+		c.Parents = append(c.Parents, h.Value)
+	case "author":
+		if c.Author != (Signature{}) {
+			return false
+		}
+		c.Author, _ = ParseSignature(h.Value)
+	case "committer":
+		if c.Committer != (Signature{}) {
+			return false
+		}
+		c.Committer, _ = ParseSignature(h.Value)
+	case "encoding":
+		if c.Encoding != "" {
+			return false
+		}
+		c.Encoding = h.Value
+	case "mergetag":
+		c.MergeTags = append(c.MergeTags, h.Value)
+	case "gpgsig":
+		if c.GPGSig != "" {
+			return false
+		}
+		c.GPGSig = h.Value
+	case "gpgsig-sha256":
+		if c.GPGSigSHA256 != "" {
+			return false
+		}
+		c.GPGSigSHA256 = h.Value
+	default:
+		return false
+	}
+	return true
+}
+
+// parseHeaders splits a commit or tag into its headers and the message
+// after the first empty line, reporting whether there was one.
+func parseHeaders(buf []byte) ([]Header, string, bool, error) {
+	headers := []Header{}
+	for len(buf) > 0 {
+		nl := bytes.IndexByte(buf, '\n')
+		if nl < 0 {
+			return nil, "", false, errors.New("invalid object: unterminated header")
+		}
+		line := buf[:nl]
+		buf = buf[nl+1:]
+		if len(line) == 0 {
+			return headers, string(buf), true, nil
+		}
+		if line[0] == ' ' {
+			if len(headers) == 0 {
+				return nil, "", false, errors.New("invalid object: continuation line without a header")
+			}
+			headers[len(headers)-1].Value += "\n" + string(line[1:])
+			continue
+		}
+		h := Header{Key: string(line), bare: true}
+		if sp := bytes.IndexByte(line, ' '); sp >= 0 {
+			h = Header{Key: string(line[:sp]), Value: string(line[sp+1:])}
+		}
+		headers = append(headers, h)
+	}
+	return headers, "", false, nil
+}
+
+// Headers lists the headers in the order they are written: as parsed, or
+// in git's order for a commit made from scratch.
+func (c *Commit) Headers() []Header {
+	pending := map[string][]string{
+		"parent":   c.Parents,
+		"mergetag": c.MergeTags,
+	}
+	if c.Tree != "" {
+		pending["tree"] = []string{c.Tree}
+	}
+	if c.Author != (Signature{}) {
+		pending["author"] = []string{c.Author.String()}
+	}
+	if c.Committer != (Signature{}) {
+		pending["committer"] = []string{c.Committer.String()}
+	}
+	if c.Encoding != "" {
+		pending["encoding"] = []string{c.Encoding}
+	}
+	if c.GPGSig != "" {
+		pending["gpgsig"] = []string{c.GPGSig}
+	}
+	if c.GPGSigSHA256 != "" {
+		pending["gpgsig-sha256"] = []string{c.GPGSigSHA256}
+	}
+	extra := c.Extra
+	headers := []Header{}
+	take := func(key string) {
+		values := pending[key]
+		if len(values) == 0 {
+			return
+		}
+		headers = append(headers, Header{Key: key, Value: values[0]})
+		pending[key] = values[1:]
+	}
+	for _, key := range c.order {
+		if key != "" {
+			take(key)
+		} else if len(extra) > 0 {
+			headers = append(headers, extra[0])
+			extra = extra[1:]
+		}
+	}
+	// Whatever the parsed order has no room for goes where git puts it.
+	for _, key := range []string{"tree", "parent", "author", "committer", "encoding", "mergetag", "gpgsig", "gpgsig-sha256"} {
+		for len(pending[key]) > 0 {
+			take(key)
+		}
+		if key == "encoding" {
+			headers = append(headers, extra...)
+		}
+	}
+	return headers
+}
+
+// Bytes serializes the commit. A parsed commit that wasn't changed comes
+// out byte for byte as it went in.
+func (c *Commit) Bytes() []byte {
+	var b bytes.Buffer
+	for _, h := range c.Headers() {
+		b.WriteString(h.String() + "\n")
+	}
+	if !c.noMessage || c.Message != "" {
+		b.WriteString("\n")
+		b.WriteString(c.Message)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,64 @@
+package object
+
+import "testing"
+
+const (
+	testTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	testSig  = "A U Thor <author@example.com> 1112911993 -0700"
+)
+
+func TestCommitRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name, raw string
+	}{
+		{"plain", "tree " + testTree + "\nauthor " + testSig + "\ncommitter " + testSig + "\n\nmessage\n"},
+		{"valueless header", "tree " + testTree + "\nauthor " + testSig + "\ncommitter " + testSig + "\nfoo\n\nmessage\n"},
+		{"valueless header with continuation", "tree " + testTree + "\nfoo\n bar\nauthor " + testSig + "\n\nmessage\n"},
+		{"empty author", "tree " + testTree + "\nauthor \ncommitter " + testSig + "\n\nmessage\n"},
+		{"author without value", "tree " + testTree + "\nauthor\ncommitter " + testSig + "\n\nmessage\n"},
+		{"unparsable committer", "tree " + testTree + "\nauthor " + testSig + "\ncommitter nobody\n\nmessage\n"},
+		{"committer without a space", "tree " + testTree + "\nauthor " + testSig + "\ncommitter A U Thor<author@example.com> 1112911993 -0700\n\n"},
+		{"duplicate tree", "tree " + testTree + "\ntree 0000000000000000000000000000000000000000\nauthor " + testSig + "\n\nmessage\n"},
+		{"duplicate author", "tree " + testTree + "\nauthor " + testSig + "\nauthor B <b@example.com> 0 +0000\ncommitter " + testSig + "\n\n"},
+		{"empty encoding", "tree " + testTree + "\nauthor " + testSig + "\nencoding \n\nmessage\n"},
+		{"gpgsig", "tree " + testTree + "\nauthor " + testSig + "\ngpgsig -----BEGIN-----\n \n line\n -----END-----\n\nmessage\n"},
+		{"unknown header before tree", "x-y z\ntree " + testTree + "\n\n"},
+		{"no message", "tree " + testTree + "\nauthor " + testSig + "\n"},
+	} {
+		c, err := ParseCommit([]byte(tt.raw))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := string(c.Bytes()); got != tt.raw {
+			t.Errorf("%s: Bytes() = %q, want %q", tt.name, got, tt.raw)
+		}
+	}
+}
+
+func TestCommitFirstHeaderWins(t *testing.T) {
+	raw := "tree " + testTree + "\ntree 0000000000000000000000000000000000000000\n" +
+		"author " + testSig + "\nauthor B <b@example.com> 0 +0000\n\n"
+	c, err := ParseCommit([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Tree != testTree {
+		t.Errorf("Tree = %s, want %s", c.Tree, testTree)
+	}
+	if c.Author.String() != testSig {
+		t.Errorf("Author = %s, want %s", c.Author, testSig)
+	}
+}
+
+func TestCommitFromScratch(t *testing.T) {
+	sig, err := ParseSignature(testSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Commit{Tree: testTree, Parents: []string{testTree}, Author: sig, Committer: sig, Message: "m\n"}
+	want := "tree " + testTree + "\nparent " + testTree + "\nauthor " + testSig + "\ncommitter " + testSig + "\n\nm\n"
+	if got := string(c.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+}
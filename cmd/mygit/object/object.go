@@ -0,0 +1,178 @@
+package object
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/shared"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Store reads and writes objects under .git/objects, loose or packed.
+type Store struct {
+	Dir  string
+	Algo hash.Algo
+
+	packs       []*pack
+	packsLoaded bool
+	deltaBases  deltaBaseCache
+}
+
+func NewStore(dir string, algo hash.Algo) *Store {
+	return &Store{Dir: dir, Algo: algo}
+}
+
+// Wrap prepends the "<type> <size>\0" header to the contents.
+func Wrap(objType string, contents []byte) []byte {
+	header := fmt.Sprintf("%s %d\x00", objType, len(contents))
+	return append([]byte(header), contents...)
+}
+
+// Hash returns the object name of the contents without writing it.
+func (s *Store) Hash(objType string, contents []byte) string {
+	return s.Algo.Sum(Wrap(objType, contents))
+}
+
+func (s *Store) loosePath(sha string) string {
+	return filepath.Join(s.Dir, sha[:2], sha[2:])
+}
+
+// Write stores the object as a loose object and returns its name.
+func (s *Store) Write(objType string, contents []byte) (string, error) {
+	data := Wrap(objType, contents)
+	sha := s.Algo.Sum(data)
+	if s.Has(sha) {
+		return sha, nil
+	}
+	compressed := bytes.NewBuffer(nil)
+	zw := zlib.NewWriter(compressed)
+	if _, err := zw.Write(data); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	objectPath := s.loosePath(sha)
+	if err := shared.MkdirAll(filepath.Dir(objectPath)); err != nil {
+		return "", err
+	}
+	// Write to a temporary file first so readers never see a partial object.
+	tmp, err := ioutil.TempFile(filepath.Dir(objectPath), "tmp_obj_")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(compressed.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := shared.Adjust(tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), objectPath); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return sha, nil
+}
+
+// Has reports whether the object exists, loose or packed.
+func (s *Store) Has(sha string) bool {
+	if !s.Algo.IsHex(sha) {
+		return false
+	}
+	if _, err := os.Stat(s.loosePath(sha)); err == nil {
+		return true
+	}
+	if err := s.loadPacks(); err != nil {
+		return false
+	}
+	for _, p := range s.packs {
+		if _, ok := p.find(sha); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Read returns the type and the contents of the object.
+func (s *Store) Read(sha string) (string, []byte, error) {
+	if !s.Algo.IsHex(sha) {
+		return "", nil, fmt.Errorf("invalid object name: %s", sha)
+	}
+	objType, contents, err := s.readLoose(sha)
+	if err == nil || !os.IsNotExist(err) {
+		return objType, contents, err
+	}
+	if err := s.loadPacks(); err != nil {
+		return "", nil, err
+	}
+	for _, p := range s.packs {
+		if offset, ok := p.find(sha); ok {
+			return p.readAt(s, offset)
+		}
+	}
+	return "", nil, fmt.Errorf("%w: %s", ErrNotFound, sha)
+}
+
+// ReadType is like Read but fails unless the object has the expected type.
+func (s *Store) ReadType(sha, expected string) ([]byte, error) {
+	objType, contents, err := s.Read(sha)
+	if err != nil {
+		return nil, err
+	}
+	if objType != expected {
+		return nil, fmt.Errorf("object %s is a %s, not a %s", sha, objType, expected)
+	}
+	return contents, nil
+}
+
+func (s *Store) readLoose(sha string) (string, []byte, error) {
+	f, err := os.Open(s.loosePath(sha))
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+	br := bufio.NewReader(zr)
+	objType, err := br.ReadString(' ')
+	if err != nil {
+		return "", nil, err
+	}
+	sizeStr, err := br.ReadString(0)
+	if err != nil {
+		return "", nil, err
+	}
+	size, err := strconv.ParseInt(sizeStr[:len(sizeStr)-1], 10, 64)
+	if err != nil {
+		return "", nil, err
+	}
+	contents := make([]byte, size)
+	if _, err := io.ReadFull(br, contents); err != nil {
+		return "", nil, err
+	}
+	return objType[:len(objType)-1], contents, nil
+}
@@ -0,0 +1,408 @@
+package object
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"container/list"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// ref: https://git-scm.com/docs/pack-format
+	ObjCommit   = 1
+	ObjTree     = 2
+	ObjBlob     = 3
+	ObjTag      = 4
+	ObjOfsDelta = 6
+	ObjRefDelta = 7
+)
+
+var idxMagic = []byte{0xff, 't', 'O', 'c'}
+
+// TypeName maps a pack object type to its name.
+func TypeName(t int) (string, error) {
+	switch t {
+	case ObjCommit:
+		return "commit", nil
+	case ObjTree:
+		return "tree", nil
+	case ObjBlob:
+		return "blob", nil
+	case ObjTag:
+		return "tag", nil
+	default:
+		return "", fmt.Errorf("invalid object type: %d", t)
+	}
+}
+
+// pack is a packfile together with its version 2 index. The index layout is
+// the same for every object format, only the name width differs.
+type pack struct {
+	path    string
+	names   []byte // sorted raw names, hashSize bytes each
+	offsets []uint64
+	fanout  [256]uint32
+	size    int
+	// file is opened on the first read and kept for the life of the
+	// store.
+	file *os.File
+}
+
+func (s *Store) loadPacks() error {
+	if s.packsLoaded {
+		return nil
+	}
+	s.packsLoaded = true
+	idxPaths, err := filepath.Glob(filepath.Join(s.Dir, "pack", "*.idx"))
+	if err != nil {
+		return err
+	}
+	for _, idxPath := range idxPaths {
+		p, err := openPackIndex(idxPath, s.Algo.Size())
+		if err != nil {
+			return fmt.Errorf("%s: %w", idxPath, err)
+		}
+		s.packs = append(s.packs, p)
+	}
+	return nil
+}
+
+func openPackIndex(idxPath string, hashSize int) (*pack, error) {
+	buf, err := ioutil.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 8+256*4 || !bytes.Equal(buf[:4], idxMagic) {
+		return nil, errors.New("unsupported pack index")
+	}
+	if version := binary.BigEndian.Uint32(buf[4:8]); version != 2 {
+		return nil, fmt.Errorf("unsupported pack index version: %d", version)
+	}
+	p := &pack{
+		path: strings.TrimSuffix(idxPath, ".idx") + ".pack",
+		size: hashSize,
+	}
+	pos := 8
+	for i := 0; i < 256; i++ {
+		p.fanout[i] = binary.BigEndian.Uint32(buf[pos:])
+		pos += 4
+	}
+	n := int(p.fanout[255])
+	if len(buf) < pos+n*(hashSize+8)+2*hashSize {
+		return nil, errors.New("truncated pack index")
+	}
+	p.names = buf[pos : pos+n*hashSize]
+	pos += n * hashSize
+	pos += n * 4 // skip crc32
+	small := buf[pos : pos+n*4]
+	pos += n * 4
+	large := buf[pos:]
+	p.offsets = make([]uint64, n)
+	for i := 0; i < n; i++ {
+		off := binary.BigEndian.Uint32(small[i*4:])
+		if off&0x80000000 == 0 {
+			p.offsets[i] = uint64(off)
+			continue
+		}
+		j := int(off & 0x7fffffff)
+		if len(large) < (j+1)*8 {
+			return nil, errors.New("truncated pack index")
+		}
+		p.offsets[i] = binary.BigEndian.Uint64(large[j*8:])
+	}
+	return p, nil
+}
+
+func (p *pack) count() int {
+	return len(p.offsets)
+}
+
+func (p *pack) name(i int) []byte {
+	return p.names[i*p.size : (i+1)*p.size]
+}
+
+func (p *pack) find(sha string) (uint64, bool) {
+	raw, err := hex.DecodeString(sha)
+	if err != nil || len(raw) != p.size {
+		return 0, false
+	}
+	lo := 0
+	if raw[0] > 0 {
+		lo = int(p.fanout[raw[0]-1])
+	}
+	hi := int(p.fanout[raw[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.name(lo+i), raw) >= 0
+	})
+	if i < hi && bytes.Equal(p.name(i), raw) {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+func (p *pack) readAt(s *Store, offset uint64) (string, []byte, error) {
+	if p.file == nil {
+		f, err := os.Open(p.path)
+		if err != nil {
+			return "", nil, err
+		}
+		p.file = f
+	}
+	t, contents, err := p.readEntry(s, offset)
+	if err != nil {
+		return "", nil, err
+	}
+	objType, err := TypeName(t)
+	return objType, contents, err
+}
+
+// readBase reads the base of a delta, from the delta base cache when it
+// was inflated recently. The contents are shared with the cache and must
+// not be modified.
+func (p *pack) readBase(s *Store, offset uint64) (int, []byte, error) {
+	key := deltaBaseKey{p, offset}
+	if t, contents, ok := s.deltaBases.get(key); ok {
+		return t, contents, nil
+	}
+	t, contents, err := p.readEntry(s, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	s.deltaBases.add(key, t, contents)
+	return t, contents, nil
+}
+
+func (p *pack) readEntry(s *Store, offset uint64) (int, []byte, error) {
+	// Nothing is read after the compressed data, so buffering ahead is fine.
+	r := bufio.NewReader(io.NewSectionReader(p.file, int64(offset), 1<<62))
+	t, _, err := ReadTypeAndSize(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch t {
+	case ObjOfsDelta:
+		rel, err := readOfsOffset(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		if rel > offset {
+			return 0, nil, errors.New("invalid delta base offset")
+		}
+		baseType, base, err := p.readBase(s, offset-rel)
+		if err != nil {
+			return 0, nil, err
+		}
+		delta, err := inflate(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		result, err := ApplyDelta(base, delta)
+		return baseType, result, err
+	case ObjRefDelta:
+		raw := make([]byte, p.size)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return 0, nil, err
+		}
+		baseName, base, err := s.Read(hex.EncodeToString(raw))
+		if err != nil {
+			return 0, nil, err
+		}
+		delta, err := inflate(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		result, err := ApplyDelta(base, delta)
+		if err != nil {
+			return 0, nil, err
+		}
+		return typeNumber(baseName), result, nil
+	default:
+		contents, err := inflate(r)
+		return t, contents, err
+	}
+}
+
+// deltaBaseCacheLimit is the default of core.deltaBaseCacheLimit.
+const deltaBaseCacheLimit = 96 << 20
+
+type deltaBaseKey struct {
+	pack   *pack
+	offset uint64
+}
+
+type deltaBaseEntry struct {
+	key      deltaBaseKey
+	t        int
+	contents []byte
+}
+
+// deltaBaseCache keeps the pack entries recently used as delta bases,
+// since the deltas of a chain and of its neighbours share them. Like
+// git's delta_base_cache, it holds at most limit bytes and drops the
+// least recently used entries first.
+// ref: https://git-scm.com/docs/git-config#Documentation/git-config.txt-coredeltaBaseCacheLimit
+type deltaBaseCache struct {
+	limit   int
+	size    int
+	lru     *list.List // most recently used first
+	entries map[deltaBaseKey]*list.Element
+}
+
+func (c *deltaBaseCache) get(key deltaBaseKey) (int, []byte, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return 0, nil, false
+	}
+	c.lru.MoveToFront(el)
+	e := el.Value.(*deltaBaseEntry)
+	return e.t, e.contents, true
+}
+
+func (c *deltaBaseCache) add(key deltaBaseKey, t int, contents []byte) {
+	if c.entries == nil {
+		c.limit = deltaBaseCacheLimit
+		c.lru = list.New()
+		c.entries = map[deltaBaseKey]*list.Element{}
+	}
+	if _, ok := c.entries[key]; ok || len(contents) > c.limit {
+		return
+	}
+	for c.size+len(contents) > c.limit {
+		oldest := c.lru.Back()
+		e := c.lru.Remove(oldest).(*deltaBaseEntry)
+		delete(c.entries, e.key)
+		c.size -= len(e.contents)
+	}
+	c.entries[key] = c.lru.PushFront(&deltaBaseEntry{key, t, contents})
+	c.size += len(contents)
+}
+
+func typeNumber(objType string) int {
+	switch objType {
+	case "commit":
+		return ObjCommit
+	case "tree":
+		return ObjTree
+	case "blob":
+		return ObjBlob
+	case "tag":
+		return ObjTag
+	}
+	return 0
+}
+
+func inflate(r io.Reader) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// ReadTypeAndSize reads the variable-length header of a pack entry.
+func ReadTypeAndSize(r io.ByteReader) (int, uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	t := int(b>>4) & 0x7
+	size := uint64(b & 0x0f)
+	shift := uint(4)
+	for b&0x80 != 0 {
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		size |= uint64(b&0x7f) << shift
+		shift += 7
+	}
+	return t, size, nil
+}
+
+// readOfsOffset reads the negative base offset of an OFS_DELTA entry.
+func readOfsOffset(r io.ByteReader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	offset := uint64(b & 0x7f)
+	for b&0x80 != 0 {
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		offset = ((offset + 1) << 7) | uint64(b&0x7f)
+	}
+	return offset, nil
+}
+
+// ApplyDelta rebuilds an object from its base and a deltified representation.
+// ref: https://git-scm.com/docs/pack-format#_deltified_representation
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	srcLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if srcLen != uint64(len(base)) {
+		return nil, fmt.Errorf("delta base size mismatch: expected %d, got %d", srcLen, len(base))
+	}
+	dstLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	result := bytes.NewBuffer(make([]byte, 0, dstLen))
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		if op&0x80 == 0 {
+			if op == 0 {
+				return nil, errors.New("invalid delta opcode")
+			}
+			if _, err := io.CopyN(result, r, int64(op)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		offset, size := 0, 0
+		for i := 0; i < 4; i++ {
+			if op&(1<<i) != 0 {
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				offset |= int(b) << (8 * i)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if op&(1<<(4+i)) != 0 {
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				size |= int(b) << (8 * i)
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > len(base) {
+			return nil, errors.New("delta copy out of range")
+		}
+		result.Write(base[offset : offset+size])
+	}
+	if uint64(result.Len()) != dstLen {
+		return nil, fmt.Errorf("invalid delta result: expected %d, got %d", dstLen, result.Len())
+	}
+	return result.Bytes(), nil
+}
@@ -0,0 +1,73 @@
+package object
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+)
+
+// TreeEntry is one "<mode> <name>\0<raw sha>" record of a tree object.
+type TreeEntry struct {
+	Mode string // 100XXX for blob, 40000 for tree, 120000 for symlink, 160000 for gitlink.
+	Name string
+	Sha  string
+}
+
+func (e TreeEntry) IsTree() bool {
+	return e.Mode == "40000" || e.Mode == "040000"
+}
+
+// ParseTree decodes a tree object. The width of each object name depends on
+// the object format of the repository.
+func ParseTree(buf []byte, algo hash.Algo) ([]TreeEntry, error) {
+	entries := []TreeEntry{}
+	for len(buf) > 0 {
+		sp := bytes.IndexByte(buf, ' ')
+		if sp < 0 {
+			return nil, errors.New("invalid tree entry: no mode")
+		}
+		nul := bytes.IndexByte(buf[sp:], 0)
+		if nul < 0 {
+			return nil, errors.New("invalid tree entry: no name")
+		}
+		nul += sp
+		if len(buf) < nul+1+algo.Size() {
+			return nil, errors.New("invalid tree entry: truncated object name")
+		}
+		entries = append(entries, TreeEntry{
+			Mode: string(buf[:sp]),
+			Name: string(buf[sp+1 : nul]),
+			Sha:  hex.EncodeToString(buf[nul+1 : nul+1+algo.Size()]),
+		})
+		buf = buf[nul+1+algo.Size():]
+	}
+	return entries, nil
+}
+
+// TreeBytes encodes the entries of a tree object, sorted the way git
+// sorts them: by name, with the names of subtrees ending in "/".
+func TreeBytes(entries []TreeEntry) ([]byte, error) {
+	sorted := append([]TreeEntry(nil), entries...)
+	key := func(e TreeEntry) string {
+		if e.IsTree() {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(sorted, func(i, j int) bool { return key(sorted[i]) < key(sorted[j]) })
+	var buf bytes.Buffer
+	for _, e := range sorted {
+		sha, err := hex.DecodeString(e.Sha)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object name '%s' for '%s'", e.Sha, e.Name)
+		}
+		buf.WriteString(strings.TrimPrefix(e.Mode, "0") + " " + e.Name + "\x00")
+		buf.Write(sha)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,350 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/lockfile"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/shared"
+)
+
+// Files keeps refs as loose files below the git directory, falling back
+// to packed-refs for refs that have no loose file.
+// ref: https://git-scm.com/docs/gitrepository-layout
+type Files struct {
+	GitDir string
+	Algo   hash.Algo
+	// LogRefUpdates is core.logAllRefUpdates: "true", "always" or "false".
+	LogRefUpdates string
+	// Committer returns the signature recorded in reflog entries.
+	Committer func() (object.Signature, error)
+
+	packedCache *packedRefs
+}
+
+func NewFiles(gitDir string, algo hash.Algo) *Files {
+	return &Files{GitDir: gitDir, Algo: algo}
+}
+
+func (s *Files) path(name string) string {
+	return filepath.Join(s.GitDir, filepath.FromSlash(name))
+}
+
+func (s *Files) parse(name string, data []byte) (*Ref, error) {
+	contents := strings.TrimRight(string(data), "\n")
+	if strings.HasPrefix(contents, symrefPrefix) {
+		return &Ref{Name: name, Symref: strings.TrimSpace(strings.TrimPrefix(contents, symrefPrefix))}, nil
+	}
+	// Pseudorefs like FETCH_HEAD carry more than the object name.
+	if len(contents) > s.Algo.HexSize() && (contents[s.Algo.HexSize()] == ' ' || contents[s.Algo.HexSize()] == '\t') {
+		contents = contents[:s.Algo.HexSize()]
+	}
+	if !s.Algo.IsHex(contents) {
+		return nil, fmt.Errorf("cannot read ref '%s': invalid contents", name)
+	}
+	return &Ref{Name: name, Target: contents}, nil
+}
+
+// Read returns the ref without following symbolic refs. A loose ref
+// takes precedence over a packed one of the same name.
+func (s *Files) Read(name string) (*Ref, error) {
+	ref, err := s.readLoose(name)
+	if IsNotFound(err) && strings.HasPrefix(name, "refs/") {
+		return s.readPacked(name)
+	}
+	return ref, err
+}
+
+func (s *Files) readLoose(name string) (*Ref, error) {
+	if !ValidUpdateName(name) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	data, err := ioutil.ReadFile(s.path(name))
+	if os.IsNotExist(err) || isDirError(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.parse(name, data)
+}
+
+func isDirError(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return strings.Contains(pathErr.Err.Error(), "is a directory")
+	}
+	return false
+}
+
+// Exists reports whether name exists, symbolic or not.
+func (s *Files) Exists(name string) bool {
+	_, err := s.Read(name)
+	return err == nil
+}
+
+func (s *Files) Resolve(name string) (*Ref, error) {
+	return resolve(s.Read, name)
+}
+
+// List returns the refs below refs/ whose names start with prefix,
+// sorted by name.
+func (s *Files) List(prefix string) ([]*Ref, error) {
+	loose, err := s.listLoose(prefix)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.packed()
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*Ref, 0, len(loose)+len(p.refs))
+	i := sort.Search(len(p.refs), func(i int) bool { return p.refs[i].Name >= prefix })
+	for _, ref := range loose {
+		for ; i < len(p.refs) && p.refs[i].Name < ref.Name && strings.HasPrefix(p.refs[i].Name, prefix); i++ {
+			refs = append(refs, p.refs[i])
+		}
+		if i < len(p.refs) && p.refs[i].Name == ref.Name {
+			i++
+		}
+		refs = append(refs, ref)
+	}
+	for ; i < len(p.refs) && strings.HasPrefix(p.refs[i].Name, prefix); i++ {
+		refs = append(refs, p.refs[i])
+	}
+	return refs, nil
+}
+
+func (s *Files) listLoose(prefix string) ([]*Ref, error) {
+	refs := []*Ref{}
+	root := s.path("refs")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.GitDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) || !ValidName(name) {
+			return nil
+		}
+		ref, err := s.readLoose(name)
+		if err != nil {
+			// Broken refs are skipped like git does, with a warning.
+			fmt.Fprintf(os.Stderr, "warning: ignoring broken ref %s\n", name)
+			return nil
+		}
+		refs = append(refs, ref)
+		return nil
+	})
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, err
+}
+
+// target returns the ref an update of name writes to.
+func (s *Files) target(name string, noDeref bool) (string, error) {
+	if noDeref {
+		return name, nil
+	}
+	ref, err := s.Resolve(name)
+	if ref == nil {
+		return "", err
+	}
+	return ref.Name, nil
+}
+
+// checkConflicts rejects names that clash with existing refs as
+// directories: refs/heads/a and refs/heads/a/b can't both exist.
+func (s *Files) checkConflicts(name string) error {
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		prefix := strings.Join(parts[:i], "/")
+		if info, err := os.Stat(s.path(prefix)); err == nil && !info.IsDir() {
+			return fmt.Errorf("cannot lock ref '%s': '%s' exists; cannot create '%s'", name, prefix, name)
+		}
+	}
+	p, err := s.packed()
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(parts); i++ {
+		prefix := strings.Join(parts[:i], "/")
+		if _, ok := p.byName[prefix]; ok {
+			return fmt.Errorf("cannot lock ref '%s': '%s' exists; cannot create '%s'", name, prefix, name)
+		}
+	}
+	j := sort.Search(len(p.refs), func(j int) bool { return p.refs[j].Name > name+"/" })
+	if j < len(p.refs) && strings.HasPrefix(p.refs[j].Name, name+"/") {
+		return fmt.Errorf("cannot lock ref '%s': '%s' exists; cannot create '%s'", name, p.refs[j].Name, name)
+	}
+	if info, err := os.Stat(s.path(name)); err == nil && info.IsDir() {
+		entries, _ := ioutil.ReadDir(s.path(name))
+		if len(entries) > 0 {
+			return fmt.Errorf("cannot lock ref '%s': there is a non-empty directory '%s' blocking reference '%s'", name, s.path(name), name)
+		}
+		os.Remove(s.path(name))
+	}
+	return nil
+}
+
+// lock takes <ref>.lock and checks that the ref currently has the
+// expected value: "" skips the check, the zero name requires the ref to
+// be missing.
+func (s *Files) lock(name, old string) (*lockfile.Lock, *Ref, error) {
+	if !ValidUpdateName(name) {
+		return nil, nil, fmt.Errorf("refusing to update ref with bad name '%s'", name)
+	}
+	if err := s.checkConflicts(name); err != nil {
+		return nil, nil, err
+	}
+	if err := shared.MkdirAll(filepath.Dir(s.path(name))); err != nil {
+		return nil, nil, err
+	}
+	lock, err := lockfile.Acquire(s.path(name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot lock ref '%s': %v", name, err)
+	}
+	current, err := s.Read(name)
+	if err != nil && !IsNotFound(err) {
+		lock.Rollback()
+		return nil, nil, err
+	}
+	if err := verifyOld(s.Algo, s.Read, name, current, old); err != nil {
+		lock.Rollback()
+		return nil, nil, err
+	}
+	return lock, current, nil
+}
+
+// IsNotFound reports whether err means the ref doesn't exist.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// Update points name at the object newSha and logs msg in the reflog.
+// Symbolic refs are followed unless noDeref is set, in which case a
+// symbolic ref is overwritten.
+func (s *Files) Update(name, newSha, old, msg string, noDeref bool) error {
+	t := s.NewTransaction()
+	if err := t.Update(name, newSha, old, msg, noDeref); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// Write points name itself at newSha without logging the change, for
+// reflog maintenance like "reflog expire --updateref".
+func (s *Files) Write(name, newSha, old string) error {
+	lock, _, err := s.lock(name, old)
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write([]byte(newSha + "\n")); err != nil {
+		lock.Rollback()
+		return err
+	}
+	return lock.Commit()
+}
+
+// value is the object name a ref read under lock currently points to.
+func (s *Files) value(current *Ref) string {
+	if current == nil {
+		return ""
+	}
+	if current.IsSymbolic() {
+		resolved, err := s.Resolve(current.Symref)
+		if err != nil {
+			return ""
+		}
+		return resolved.Target
+	}
+	return current.Target
+}
+
+// logUpdate appends to the reflog of the ref written and, when that ref
+// is the current branch, to the reflog of HEAD as well.
+func (s *Files) logUpdate(name, target, old, new, msg string) error {
+	if err := s.appendReflog(target, old, new, msg); err != nil {
+		return err
+	}
+	return s.logHead(name, target, old, new, msg)
+}
+
+// logHead logs a change of the current branch, or of a ref written
+// through HEAD, in the reflog of HEAD.
+func (s *Files) logHead(name, target, old, new, msg string) error {
+	if target == HEAD {
+		return nil
+	}
+	if name != HEAD {
+		head, err := s.Read(HEAD)
+		if err != nil || head.Symref != target {
+			return nil
+		}
+	}
+	return s.appendReflog(HEAD, old, new, msg)
+}
+
+// Delete removes a ref, or the ref it points to unless noDeref is set,
+// from both the loose files and packed-refs along with its reflog.
+func (s *Files) Delete(name, old string, noDeref bool) error {
+	t := s.NewTransaction()
+	if err := t.Delete(name, old, "", noDeref); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// pruneEmptyDirs removes the directories left empty by a deleted ref,
+// stopping at refs/heads, refs/tags and the like.
+func (s *Files) pruneEmptyDirs(name string) {
+	dir := filepath.Dir(s.path(name))
+	stop := s.path("refs")
+	for strings.HasPrefix(dir, stop+string(filepath.Separator)) && strings.Count(dir[len(stop):], string(filepath.Separator)) > 1 {
+		// A loose ref may sit where a directory was expected.
+		if info, err := os.Lstat(dir); err != nil || !info.IsDir() || os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// SetSymbolic makes name a symbolic ref pointing at target. Unless msg
+// is empty, the switch is logged in the reflog of name, provided target
+// exists.
+func (s *Files) SetSymbolic(name, target, msg string) error {
+	if !strings.HasPrefix(target, "refs/") || !ValidName(target) {
+		return fmt.Errorf("refusing to point %s outside of refs/", name)
+	}
+	lock, current, err := s.lock(name, "")
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write([]byte(symrefPrefix + target + "\n")); err != nil {
+		lock.Rollback()
+		return err
+	}
+	if msg != "" {
+		if resolved, err := s.Resolve(target); err == nil {
+			if err := s.appendReflog(name, s.value(current), resolved.Target, msg); err != nil {
+				lock.Rollback()
+				return err
+			}
+		}
+	}
+	return lock.Commit()
+}
@@ -0,0 +1,211 @@
+package refs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/lockfile"
+)
+
+const (
+	packedRefsFile = "packed-refs"
+	// Written by git since 1.8.5: every tag is followed by its peeled
+	// value and the refs are sorted.
+	packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+)
+
+// packedRefs is the parsed contents of .git/packed-refs, cached until
+// the file changes on disk.
+type packedRefs struct {
+	modTime time.Time
+	size    int64
+	refs    []*Ref // sorted by name
+	byName  map[string]*Ref
+}
+
+func (s *Files) packedPath() string {
+	return filepath.Join(s.GitDir, packedRefsFile)
+}
+
+// packed returns the packed refs, re-reading the file only when its
+// size or mtime changed.
+func (s *Files) packed() (*packedRefs, error) {
+	info, err := os.Stat(s.packedPath())
+	if os.IsNotExist(err) {
+		s.packedCache = nil
+		return &packedRefs{byName: map[string]*Ref{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c := s.packedCache; c != nil && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(s.packedPath())
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.parsePacked(data)
+	if err != nil {
+		return nil, err
+	}
+	p.modTime, p.size = info.ModTime(), info.Size()
+	s.packedCache = p
+	return p, nil
+}
+
+// parsePacked reads "<sha> <refname>" lines, each optionally followed by
+// a "^<sha>" line holding the peeled value of an annotated tag.
+// ref: https://git-scm.com/docs/gitrepository-layout#Documentation/gitrepository-layout.txt-packed-refs
+func (s *Files) parsePacked(data []byte) (*packedRefs, error) {
+	p := &packedRefs{byName: map[string]*Ref{}}
+	var last *Ref
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "^"):
+			peeled := line[1:]
+			if last == nil || !s.Algo.IsHex(peeled) {
+				return nil, fmt.Errorf("unexpected line in %s: %s", s.packedPath(), line)
+			}
+			last.Peeled = peeled
+			continue
+		}
+		i := strings.IndexByte(line, ' ')
+		if i != s.Algo.HexSize() || !s.Algo.IsHex(line[:i]) || !ValidName(line[i+1:]) {
+			return nil, fmt.Errorf("unexpected line in %s: %s", s.packedPath(), line)
+		}
+		last = &Ref{Name: line[i+1:], Target: line[:i]}
+		if _, dup := p.byName[last.Name]; !dup {
+			p.refs = append(p.refs, last)
+		}
+		p.byName[last.Name] = last
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(p.refs, func(i, j int) bool { return p.refs[i].Name < p.refs[j].Name })
+	return p, nil
+}
+
+// readPacked looks name up in packed-refs.
+func (s *Files) readPacked(name string) (*Ref, error) {
+	p, err := s.packed()
+	if err != nil {
+		return nil, err
+	}
+	ref, ok := p.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	copied := *ref
+	return &copied, nil
+}
+
+// writePacked replaces packed-refs with refs through the held lock.
+func (s *Files) writePacked(lock *lockfile.Lock, refs []*Ref) error {
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	w := bufio.NewWriter(lock)
+	w.WriteString(packedRefsHeader)
+	for _, ref := range refs {
+		fmt.Fprintf(w, "%s %s\n", ref.Target, ref.Name)
+		if ref.Peeled != "" {
+			fmt.Fprintf(w, "^%s\n", ref.Peeled)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		lock.Rollback()
+		return err
+	}
+	s.packedCache = nil
+	return lock.Commit()
+}
+
+// PackOptions control Pack.
+type PackOptions struct {
+	// All packs every ref; otherwise only tags and refs already packed.
+	All bool
+	// NoPrune keeps the loose files of the refs that were packed.
+	NoPrune bool
+	// Peel returns the object an annotated tag ultimately points to, or
+	// "" for anything that isn't a tag.
+	Peel func(sha string) string
+}
+
+// Pack moves loose refs into packed-refs, like "git pack-refs".
+// Symbolic refs and broken refs are never packed.
+func (s *Files) Pack(opts PackOptions) error {
+	lock, err := lockfile.Acquire(s.packedPath())
+	if err != nil {
+		return fmt.Errorf("cannot lock packed-refs: %v", err)
+	}
+	p, err := s.packed()
+	if err != nil {
+		lock.Rollback()
+		return err
+	}
+	loose, err := s.listLoose("refs/")
+	if err != nil {
+		lock.Rollback()
+		return err
+	}
+	merged := map[string]*Ref{}
+	for _, ref := range p.refs {
+		copied := *ref
+		merged[ref.Name] = &copied
+	}
+	pruned := []*Ref{}
+	for _, ref := range loose {
+		if ref.IsSymbolic() || (!opts.All && !strings.HasPrefix(ref.Name, "refs/tags/")) {
+			continue
+		}
+		ref.Peeled = ""
+		if opts.Peel != nil {
+			if peeled := opts.Peel(ref.Target); peeled != ref.Target {
+				ref.Peeled = peeled
+			}
+		}
+		merged[ref.Name] = ref
+		pruned = append(pruned, ref)
+	}
+	refs := make([]*Ref, 0, len(merged))
+	for _, ref := range merged {
+		refs = append(refs, ref)
+	}
+	if err := s.writePacked(lock, refs); err != nil {
+		return err
+	}
+	if opts.NoPrune {
+		return nil
+	}
+	for _, ref := range pruned {
+		s.pruneLoose(ref)
+	}
+	return nil
+}
+
+// pruneLoose deletes the loose file of a ref just packed, unless
+// somebody changed it in the meantime.
+func (s *Files) pruneLoose(ref *Ref) {
+	lock, err := lockfile.Acquire(s.path(ref.Name))
+	if err != nil {
+		return
+	}
+	current, err := s.readLoose(ref.Name)
+	removed := err == nil && current.Target == ref.Target && os.Remove(s.path(ref.Name)) == nil
+	lock.Rollback()
+	if removed {
+		s.pruneEmptyDirs(ref.Name)
+	}
+}
@@ -0,0 +1,221 @@
+package refs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/lockfile"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/shared"
+)
+
+// ReflogEntry is one line of .git/logs/<ref>.
+// ref: https://git-scm.com/docs/gitrepository-layout#Documentation/gitrepository-layout.txt-logs
+type ReflogEntry struct {
+	Old       string
+	New       string
+	Committer string // "Name <email>"
+	When      time.Time
+	Message   string
+
+	updateIndex uint64 // key of the entry in a reftable log
+}
+
+func (e *ReflogEntry) String() string {
+	when, _ := date.Format(e.When, "raw")
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s %s %s\n", e.Old, e.New, e.Committer, when)
+	}
+	return fmt.Sprintf("%s %s %s %s\t%s\n", e.Old, e.New, e.Committer, when, e.Message)
+}
+
+// committer calls the Committer hook of a store, if it has one.
+func committer(hook func() (object.Signature, error)) (object.Signature, error) {
+	if hook == nil {
+		return object.NewSignature("unknown", "unknown", time.Now()), nil
+	}
+	return hook()
+}
+
+// newReflogEntry makes the entry of an update by sig, dated like it so
+// that GIT_COMMITTER_DATE applies to reflogs as it does to commits.
+func newReflogEntry(sig object.Signature, old, new, msg string) *ReflogEntry {
+	return &ReflogEntry{
+		Old:       old,
+		New:       new,
+		Committer: sig.Name + " <" + sig.Email + ">",
+		When:      sig.When(),
+		Message:   strings.Join(strings.Fields(msg), " "),
+	}
+}
+
+func (s *Files) logPath(name string) string {
+	return filepath.Join(s.GitDir, "logs", filepath.FromSlash(name))
+}
+
+// HasReflog reports whether name has a reflog, even an empty one.
+func (s *Files) HasReflog(name string) bool {
+	info, err := os.Stat(s.logPath(name))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// CreateReflog makes an empty reflog for name so its updates are logged
+// from now on, like "update-ref --create-reflog".
+func (s *Files) CreateReflog(name string) error {
+	path := s.logPath(name)
+	if err := shared.MkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return shared.Adjust(path)
+}
+
+// appendReflog records a change of name from old to new, if name is
+// logged at all.
+func (s *Files) appendReflog(name, old, new, msg string) error {
+	if !shouldLog(s.LogRefUpdates, name, s.HasReflog(name)) {
+		return nil
+	}
+	if old == "" {
+		old = s.Algo.ZeroHex()
+	}
+	sig, err := committer(s.Committer)
+	if err != nil {
+		return err
+	}
+	entry := newReflogEntry(sig, old, new, msg)
+	if err := s.CreateReflog(name); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.logPath(name), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(entry.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadReflog returns the entries of a reflog, oldest first.
+func (s *Files) ReadReflog(name string) ([]*ReflogEntry, error) {
+	data, err := ioutil.ReadFile(s.logPath(name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: reflog for %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := []*ReflogEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry, ok := s.parseReflogLine(scanner.Text())
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// parseReflogLine parses "<old> <new> <name> <<email>> <unix> <tz>\t<msg>".
+func (s *Files) parseReflogLine(line string) (*ReflogEntry, bool) {
+	size := s.Algo.HexSize()
+	if len(line) < 2*size+2 || line[size] != ' ' || line[2*size+1] != ' ' {
+		return nil, false
+	}
+	entry := &ReflogEntry{Old: line[:size], New: line[size+1 : 2*size+1]}
+	rest := line[2*size+2:]
+	if i := strings.IndexByte(rest, '\t'); i >= 0 {
+		rest, entry.Message = rest[:i], rest[i+1:]
+	}
+	gt := strings.LastIndexByte(rest, '>')
+	if gt < 0 {
+		return nil, false
+	}
+	entry.Committer = rest[:gt+1]
+	when, err := date.ParseRaw(rest[gt+1:])
+	if err != nil {
+		return nil, false
+	}
+	entry.When = when
+	return entry, true
+}
+
+// WriteReflog replaces a reflog with entries, for "reflog expire" and
+// "reflog delete".
+func (s *Files) WriteReflog(name string, entries []*ReflogEntry) error {
+	if err := shared.MkdirAll(filepath.Dir(s.logPath(name))); err != nil {
+		return err
+	}
+	lock, err := lockfile.Acquire(s.logPath(name))
+	if err != nil {
+		return fmt.Errorf("cannot lock reflog for '%s': %v", name, err)
+	}
+	w := bufio.NewWriter(lock)
+	for _, entry := range entries {
+		w.WriteString(entry.String())
+	}
+	if err := w.Flush(); err != nil {
+		lock.Rollback()
+		return err
+	}
+	return lock.Commit()
+}
+
+// DeleteReflog removes the reflog of name and the directories it leaves
+// empty.
+func (s *Files) DeleteReflog(name string) error {
+	if err := os.Remove(s.logPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	dir := filepath.Dir(s.logPath(name))
+	stop := filepath.Join(s.GitDir, "logs", "refs")
+	for strings.HasPrefix(dir, stop+string(filepath.Separator)) && strings.Count(dir[len(stop):], string(filepath.Separator)) > 1 {
+		if os.Remove(dir) != nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return nil
+}
+
+// ListReflogs returns the names of all refs that have a reflog.
+func (s *Files) ListReflogs() ([]string, error) {
+	names := []string{}
+	root := filepath.Join(s.GitDir, "logs")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); ValidUpdateName(name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
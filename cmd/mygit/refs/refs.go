@@ -0,0 +1,189 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	HEAD         = "HEAD"
+	symrefPrefix = "ref: "
+	// Symbolic refs are followed at most this many times, like git.
+	maxSymrefDepth = 5
+)
+
+var ErrNotFound = errors.New("ref not found")
+
+// Ref is a ref as stored: either an object name or a symbolic ref.
+type Ref struct {
+	Name   string
+	Target string // object name, "" for symbolic refs
+	Symref string // name of the ref pointed to, "" for direct refs
+	Peeled string // for annotated tags, the object the tag points to, if known
+}
+
+// Store is a ref backend. Files keeps loose refs and packed-refs,
+// Reftable keeps refs in a stack of reftable files; the rest of the tool
+// only talks to this interface.
+type Store interface {
+	// Read returns the ref without following symbolic refs.
+	Read(name string) (*Ref, error)
+	Exists(name string) bool
+	// Resolve follows symbolic refs; for an unborn branch it returns the
+	// missing ref's name together with ErrNotFound.
+	Resolve(name string) (*Ref, error)
+	// List returns the refs whose names start with prefix, sorted.
+	List(prefix string) ([]*Ref, error)
+	Update(name, newSha, old, msg string, noDeref bool) error
+	Delete(name, old string, noDeref bool) error
+	// Write changes a ref without touching the reflog.
+	Write(name, newSha, old string) error
+	SetSymbolic(name, target, msg string) error
+	NewTransaction() Transaction
+	// Pack packs loose refs or compacts the reftable stack.
+	Pack(opts PackOptions) error
+
+	HasReflog(name string) bool
+	CreateReflog(name string) error
+	ReadReflog(name string) ([]*ReflogEntry, error)
+	WriteReflog(name string, entries []*ReflogEntry) error
+	DeleteReflog(name string) error
+	ListReflogs() ([]string, error)
+}
+
+var (
+	_ Store = (*Files)(nil)
+	_ Store = (*Reftable)(nil)
+)
+
+// Transaction updates several refs atomically: Prepare takes every lock
+// and checks every old value before anything is written, so either all
+// updates happen or none does. Old values follow Store.Update: "" skips
+// the check, the zero object name requires the ref not to exist.
+type Transaction interface {
+	Update(name, newSha, old, msg string, noDeref bool) error
+	Create(name, newSha, msg string, noDeref bool) error
+	Delete(name, old, msg string, noDeref bool) error
+	Verify(name, old string, noDeref bool) error
+	Prepare() error
+	Commit() error
+	// Abort releases the locks; it is a no-op once committed.
+	Abort()
+}
+
+// resolve follows symbolic refs with read, shared by the backends.
+func resolve(read func(string) (*Ref, error), name string) (*Ref, error) {
+	for depth := 0; depth <= maxSymrefDepth; depth++ {
+		ref, err := read(name)
+		if err != nil {
+			return &Ref{Name: name}, err
+		}
+		if !ref.IsSymbolic() {
+			return ref, nil
+		}
+		name = ref.Symref
+	}
+	return nil, fmt.Errorf("too many levels of symbolic refs: %s", name)
+}
+
+// shouldLog follows core.logAllRefUpdates: "always" logs every ref,
+// "true" logs HEAD, branches, remote-tracking refs and notes, and
+// otherwise only refs that already have a reflog are logged.
+func shouldLog(mode, name string, hasReflog bool) bool {
+	if hasReflog {
+		return true
+	}
+	switch mode {
+	case "always":
+		return true
+	case "true":
+		return name == HEAD || strings.HasPrefix(name, "refs/heads/") ||
+			strings.HasPrefix(name, "refs/remotes/") || strings.HasPrefix(name, "refs/notes/")
+	}
+	return false
+}
+
+func (r *Ref) IsSymbolic() bool {
+	return r.Symref != ""
+}
+
+// ValidName implements the rules of git check-ref-format.
+// ref: https://git-scm.com/docs/git-check-ref-format
+func ValidName(name string) bool {
+	if name == "" || name == "@" || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.Contains(name, "..") || strings.Contains(name, "@{") ||
+		strings.Contains(name, "//") {
+		return false
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return false
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPseudoref reports names like HEAD or ORIG_HEAD that live directly
+// in the git directory.
+func IsPseudoref(name string) bool {
+	if name == "" || strings.Contains(name, "/") {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidUpdateName reports whether a ref may be written under this name:
+// a pseudoref or a well-formed name below refs/.
+func ValidUpdateName(name string) bool {
+	return IsPseudoref(name) || (strings.HasPrefix(name, "refs/") && ValidName(name))
+}
+
+// DWIMRules are the prefixes tried when a short name like "master" is
+// given, in order.
+// ref: https://git-scm.com/docs/gitrevisions#Documentation/gitrevisions.txt-emltrefnamegtemegemmasterememheadsmasterememrefsheadsmasterem
+var DWIMRules = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+	"refs/remotes/%s/HEAD",
+}
+
+// Shorten returns the shortest unambiguous name for a full ref name,
+// like "%(refname:short)".
+func Shorten(name string, exists func(string) bool) string {
+	for i := len(DWIMRules) - 1; i > 0; i-- {
+		rule := DWIMRules[i]
+		prefix := strings.SplitN(rule, "%s", 2)[0]
+		suffix := strings.SplitN(rule, "%s", 2)[1]
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) || len(name) <= len(prefix)+len(suffix) {
+			continue
+		}
+		short := name[len(prefix) : len(name)-len(suffix)]
+		// The short name must not resolve to another ref through a rule
+		// with higher priority.
+		ambiguous := false
+		for j := 0; j < i; j++ {
+			if exists(fmt.Sprintf(DWIMRules[j], short)) {
+				ambiguous = true
+				break
+			}
+		}
+		if !ambiguous {
+			return short
+		}
+	}
+	return name
+}
@@ -0,0 +1,57 @@
+package refs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Refspec maps refs of a remote to local refs, "+refs/heads/*:refs/remotes/origin/*".
+// ref: https://git-scm.com/book/en/v2/Git-Internals-The-Refspec
+type Refspec struct {
+	Force bool
+	Src   string
+	Dst   string
+}
+
+// ParseRefspec parses "[+]<src>[:<dst>]". A "*" must appear on both
+// sides or on neither.
+func ParseRefspec(spec string) (Refspec, error) {
+	r := Refspec{}
+	if strings.HasPrefix(spec, "+") {
+		r.Force, spec = true, spec[1:]
+	}
+	r.Src, r.Dst = spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		r.Src, r.Dst = spec[:i], spec[i+1:]
+	}
+	if strings.Count(r.Src, "*") > 1 || strings.Count(r.Dst, "*") > 1 ||
+		(r.Dst != "" && strings.Contains(r.Src, "*") != strings.Contains(r.Dst, "*")) {
+		return Refspec{}, fmt.Errorf("invalid refspec '%s'", spec)
+	}
+	return r, nil
+}
+
+// MapSrc returns the destination for the source ref name.
+func (r Refspec) MapSrc(name string) (string, bool) {
+	return mapPattern(r.Src, r.Dst, name)
+}
+
+// MapDst returns the source for the destination ref name.
+func (r Refspec) MapDst(name string) (string, bool) {
+	return mapPattern(r.Dst, r.Src, name)
+}
+
+func mapPattern(from, to, name string) (string, bool) {
+	if from == "" || to == "" {
+		return "", false
+	}
+	i := strings.IndexByte(from, '*')
+	if i < 0 {
+		return to, name == from
+	}
+	prefix, suffix := from[:i], from[i+1:]
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return strings.Replace(to, "*", name[len(prefix):len(name)-len(suffix)], 1), true
+}
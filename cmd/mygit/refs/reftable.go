@@ -0,0 +1,822 @@
+package refs
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/lockfile"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/reftable"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/shared"
+)
+
+const (
+	reftableDir = "reftable"
+	tablesList  = "tables.list"
+)
+
+// Reftable keeps HEAD and the refs below refs/ in a stack of reftable
+// files named in reftable/tables.list, oldest first. Every change adds a
+// table, and tables are merged again when the stack stops shrinking
+// geometrically. Other pseudorefs like ORIG_HEAD stay plain files.
+// ref: https://git-scm.com/docs/reftable
+type Reftable struct {
+	GitDir string
+	Algo   hash.Algo
+	// LogRefUpdates is core.logAllRefUpdates: "true", "always" or "false".
+	LogRefUpdates string
+	// Committer returns the signature recorded in reflog entries.
+	Committer func() (object.Signature, error)
+
+	files *Files
+	cache *reftableStack
+}
+
+func NewReftable(gitDir string, algo hash.Algo) *Reftable {
+	return &Reftable{GitDir: gitDir, Algo: algo, files: NewFiles(gitDir, algo)}
+}
+
+// reftableStack is the merged view of all tables of the stack.
+type reftableStack struct {
+	list      string // contents of tables.list it was read from
+	names     []string
+	sizes     []int64
+	tables    []*reftable.Table
+	maxUpdate uint64
+	refs      map[string]*reftable.RefRecord
+	sorted    []string
+	logs      map[string][]*reftable.LogRecord // oldest first
+}
+
+func (s *Reftable) dir() string {
+	return filepath.Join(s.GitDir, reftableDir)
+}
+
+func (s *Reftable) listPath() string {
+	return filepath.Join(s.dir(), tablesList)
+}
+
+// inFiles reports names kept outside the reftable stack.
+func inFiles(name string) bool {
+	return name != HEAD && IsPseudoref(name)
+}
+
+// stack returns the merged tables, re-reading them only when
+// tables.list changed.
+func (s *Reftable) stack() (*reftableStack, error) {
+	data, err := ioutil.ReadFile(s.listPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if s.cache != nil && s.cache.list == string(data) {
+		return s.cache, nil
+	}
+	st := &reftableStack{list: string(data)}
+	for _, name := range strings.Split(string(data), "\n") {
+		if name == "" {
+			continue
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(s.dir(), name))
+		if err != nil {
+			return nil, err
+		}
+		table, err := reftable.Read(contents)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if table.HashSize != s.Algo.Size() {
+			return nil, fmt.Errorf("%s: table uses a different hash function", name)
+		}
+		st.names = append(st.names, name)
+		st.sizes = append(st.sizes, int64(len(contents)))
+		st.tables = append(st.tables, table)
+	}
+	st.merge()
+	s.cache = st
+	return st, nil
+}
+
+// merge applies the tables in order, later records replacing earlier
+// ones, and drops the tombstones.
+func (st *reftableStack) merge() {
+	st.refs = map[string]*reftable.RefRecord{}
+	type logKey struct {
+		name  string
+		index uint64
+	}
+	logs := map[logKey]*reftable.LogRecord{}
+	for _, table := range st.tables {
+		if table.MaxUpdateIndex > st.maxUpdate {
+			st.maxUpdate = table.MaxUpdateIndex
+		}
+		for i := range table.Refs {
+			st.refs[table.Refs[i].Name] = &table.Refs[i]
+		}
+		for i := range table.Logs {
+			logs[logKey{table.Logs[i].Name, table.Logs[i].UpdateIndex}] = &table.Logs[i]
+		}
+	}
+	for name, r := range st.refs {
+		if r.Deleted {
+			delete(st.refs, name)
+			continue
+		}
+		st.sorted = append(st.sorted, name)
+	}
+	sort.Strings(st.sorted)
+	st.logs = map[string][]*reftable.LogRecord{}
+	for key, l := range logs {
+		if !l.Deleted {
+			st.logs[key.name] = append(st.logs[key.name], l)
+		}
+	}
+	for _, entries := range st.logs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].UpdateIndex < entries[j].UpdateIndex })
+	}
+}
+
+func (s *Reftable) toRef(r *reftable.RefRecord) *Ref {
+	ref := &Ref{Name: r.Name, Symref: r.Target}
+	if r.Value != nil {
+		ref.Target = hex.EncodeToString(r.Value)
+	}
+	if r.Peeled != nil {
+		ref.Peeled = hex.EncodeToString(r.Peeled)
+	}
+	return ref
+}
+
+func (s *Reftable) Read(name string) (*Ref, error) {
+	if inFiles(name) {
+		return s.files.Read(name)
+	}
+	if !ValidUpdateName(name) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	st, err := s.stack()
+	if err != nil {
+		return nil, err
+	}
+	r, ok := st.refs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return s.toRef(r), nil
+}
+
+func (s *Reftable) Exists(name string) bool {
+	_, err := s.Read(name)
+	return err == nil
+}
+
+func (s *Reftable) Resolve(name string) (*Ref, error) {
+	return resolve(s.Read, name)
+}
+
+func (s *Reftable) List(prefix string) ([]*Ref, error) {
+	st, err := s.stack()
+	if err != nil {
+		return nil, err
+	}
+	refs := []*Ref{}
+	for i := sort.SearchStrings(st.sorted, prefix); i < len(st.sorted) && strings.HasPrefix(st.sorted[i], prefix); i++ {
+		if strings.HasPrefix(st.sorted[i], "refs/") {
+			refs = append(refs, s.toRef(st.refs[st.sorted[i]]))
+		}
+	}
+	return refs, nil
+}
+
+func (s *Reftable) Update(name, newSha, old, msg string, noDeref bool) error {
+	if inFiles(name) {
+		return s.files.Update(name, newSha, old, msg, noDeref)
+	}
+	t := s.NewTransaction()
+	if err := t.Update(name, newSha, old, msg, noDeref); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+func (s *Reftable) Delete(name, old string, noDeref bool) error {
+	if inFiles(name) {
+		return s.files.Delete(name, old, noDeref)
+	}
+	t := s.NewTransaction()
+	if err := t.Delete(name, old, "", noDeref); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+func (s *Reftable) Write(name, newSha, old string) error {
+	if inFiles(name) {
+		return s.files.Write(name, newSha, old)
+	}
+	t := s.NewTransaction().(*reftableTransaction)
+	t.noLog = true
+	if err := t.Update(name, newSha, old, "", true); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+func (s *Reftable) SetSymbolic(name, target, msg string) error {
+	if !strings.HasPrefix(target, "refs/") || !ValidName(target) {
+		return fmt.Errorf("refusing to point %s outside of refs/", name)
+	}
+	if inFiles(name) {
+		return s.files.SetSymbolic(name, target, msg)
+	}
+	t := s.NewTransaction().(*reftableTransaction)
+	if err := t.queue(&txUpdate{name: name, symref: target, msg: msg, noDeref: true}); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// Pack merges the whole stack into a single table.
+func (s *Reftable) Pack(opts PackOptions) error {
+	lock, err := lockfile.Acquire(s.listPath())
+	if err != nil {
+		return fmt.Errorf("cannot lock references: %v", err)
+	}
+	st, err := s.stack()
+	if err != nil {
+		lock.Rollback()
+		return err
+	}
+	return s.commitList(lock, st, st.names, 0)
+}
+
+// tableName follows git: "0x<min>-0x<max>-<random>.ref".
+func tableName(min, max uint64) string {
+	return fmt.Sprintf("0x%012x-0x%012x-%08x.ref", min, max, rand.Uint32())
+}
+
+// writeTable writes a new table file into the reftable directory and
+// returns its name.
+func (s *Reftable) writeTable(min, max uint64, refs []reftable.RefRecord, logs []reftable.LogRecord) (string, int64, error) {
+	if err := shared.MkdirAll(s.dir()); err != nil {
+		return "", 0, err
+	}
+	tmp, err := ioutil.TempFile(s.dir(), "tmp_")
+	if err != nil {
+		return "", 0, err
+	}
+	opts := reftable.Options{HashSize: s.Algo.Size(), MinUpdateIndex: min, MaxUpdateIndex: max}
+	if err := reftable.Write(tmp, opts, refs, logs); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	info, err := tmp.Stat()
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err == nil {
+		err = shared.Adjust(tmp.Name())
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	name := tableName(min, max)
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir(), name)); err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	return name, info.Size(), nil
+}
+
+// addTable appends a table holding refs and logs to the stack and
+// compacts it. lock is the held tables.list lock.
+func (s *Reftable) addTable(lock *lockfile.Lock, st *reftableStack, refs []reftable.RefRecord, logs []reftable.LogRecord) error {
+	index := st.maxUpdate + 1
+	name, size, err := s.writeTable(index, index, refs, logs)
+	if err != nil {
+		lock.Rollback()
+		return err
+	}
+	names := append(append([]string{}, st.names...), name)
+	sizes := append(append([]int64{}, st.sizes...), size)
+	// Keep every table at least twice the size of the next one: merge
+	// the newest tables until that holds again.
+	from, total := len(sizes)-1, sizes[len(sizes)-1]
+	for from > 0 && sizes[from-1] < 2*total {
+		from--
+		total += sizes[from]
+	}
+	if from == len(names)-1 {
+		from = -1
+	}
+	return s.commitList(lock, st, names, from)
+}
+
+// commitList writes tables.list with names, after merging the tables
+// from index from on into one unless from is negative, and removes the
+// tables no longer listed.
+func (s *Reftable) commitList(lock *lockfile.Lock, st *reftableStack, names []string, from int) error {
+	stale := append(append([]string{}, st.names...), names...)
+	if from >= 0 && from < len(names) {
+		merged, err := s.compact(names[from:], from == 0)
+		if err != nil {
+			lock.Rollback()
+			return err
+		}
+		names = append(names[:from:from], merged)
+	}
+	list := ""
+	for _, name := range names {
+		list += name + "\n"
+	}
+	if _, err := lock.Write([]byte(list)); err != nil {
+		lock.Rollback()
+		return err
+	}
+	if err := lock.Commit(); err != nil {
+		return err
+	}
+	s.cache = nil
+	kept := map[string]bool{tablesList: true}
+	for _, name := range names {
+		kept[name] = true
+	}
+	for _, name := range stale {
+		if !kept[name] {
+			os.Remove(filepath.Join(s.dir(), name))
+		}
+	}
+	return nil
+}
+
+// compact merges the named tables into a new one. Tombstones are only
+// dropped when the oldest table takes part, as nothing below could
+// hold what they hide.
+func (s *Reftable) compact(names []string, dropTombstones bool) (string, error) {
+	sub := &reftableStack{}
+	for _, name := range names {
+		contents, err := ioutil.ReadFile(filepath.Join(s.dir(), name))
+		if err != nil {
+			return "", err
+		}
+		table, err := reftable.Read(contents)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+		sub.tables = append(sub.tables, table)
+	}
+	min := sub.tables[0].MinUpdateIndex
+	max := sub.tables[len(sub.tables)-1].MaxUpdateIndex
+
+	refs := map[string]reftable.RefRecord{}
+	type logKey struct {
+		name  string
+		index uint64
+	}
+	logs := map[logKey]reftable.LogRecord{}
+	for _, table := range sub.tables {
+		for _, r := range table.Refs {
+			refs[r.Name] = r
+		}
+		for _, l := range table.Logs {
+			logs[logKey{l.Name, l.UpdateIndex}] = l
+		}
+	}
+	refList := []reftable.RefRecord{}
+	for _, r := range refs {
+		if !(r.Deleted && dropTombstones) {
+			refList = append(refList, r)
+		}
+	}
+	logList := []reftable.LogRecord{}
+	for _, l := range logs {
+		if !(l.Deleted && dropTombstones) {
+			logList = append(logList, l)
+		}
+	}
+	name, _, err := s.writeTable(min, max, refList, logList)
+	return name, err
+}
+
+// splitIdent splits "Name <email>".
+func splitIdent(ident string) (string, string) {
+	lt := strings.IndexByte(ident, '<')
+	if lt < 0 {
+		return ident, ""
+	}
+	return strings.TrimSpace(ident[:lt]), strings.TrimSuffix(ident[lt+1:], ">")
+}
+
+// logRecord converts a reflog entry. Like git, the message is stored
+// with a trailing newline, as the files backend ends the line with it.
+func (s *Reftable) logRecord(name string, index uint64, e *ReflogEntry) reftable.LogRecord {
+	personName, email := splitIdent(e.Committer)
+	old, _ := hex.DecodeString(e.Old)
+	new, _ := hex.DecodeString(e.New)
+	tz, _ := strconv.Atoi(e.When.Format("-0700"))
+	return reftable.LogRecord{
+		Name:        name,
+		UpdateIndex: index,
+		Old:         old,
+		New:         new,
+		PersonName:  personName,
+		Email:       email,
+		Time:        uint64(e.When.Unix()),
+		TZOffset:    int16(tz),
+		Message:     e.Message + "\n",
+	}
+}
+
+func (s *Reftable) entry(l *reftable.LogRecord) *ReflogEntry {
+	sign, tz := "+", int(l.TZOffset)
+	if tz < 0 {
+		sign, tz = "-", -tz
+	}
+	when, _ := date.ParseRaw(fmt.Sprintf("%d %s%04d", l.Time, sign, tz))
+	return &ReflogEntry{
+		Old:         hex.EncodeToString(l.Old),
+		New:         hex.EncodeToString(l.New),
+		Committer:   l.PersonName + " <" + l.Email + ">",
+		When:        when,
+		Message:     strings.TrimSuffix(l.Message, "\n"),
+		updateIndex: l.UpdateIndex,
+	}
+}
+
+// isMarker reports the entry with zero old and new values that
+// CreateReflog writes so an empty reflog exists.
+func (s *Reftable) isMarker(l *reftable.LogRecord) bool {
+	zero := make([]byte, s.Algo.Size())
+	return string(l.Old) == string(zero) && string(l.New) == string(zero)
+}
+
+func (s *Reftable) HasReflog(name string) bool {
+	if inFiles(name) {
+		return s.files.HasReflog(name)
+	}
+	st, err := s.stack()
+	return err == nil && len(st.logs[name]) > 0
+}
+
+func (s *Reftable) CreateReflog(name string) error {
+	if inFiles(name) {
+		return s.files.CreateReflog(name)
+	}
+	if s.HasReflog(name) {
+		return nil
+	}
+	sig, err := committer(s.Committer)
+	if err != nil {
+		return err
+	}
+	zero := s.Algo.ZeroHex()
+	return s.editLogs(func(st *reftableStack, index uint64) []reftable.LogRecord {
+		return []reftable.LogRecord{s.logRecord(name, index, newReflogEntry(sig, zero, zero, ""))}
+	})
+}
+
+// editLogs adds a table with the log records returned by edit.
+func (s *Reftable) editLogs(edit func(st *reftableStack, index uint64) []reftable.LogRecord) error {
+	lock, err := lockfile.Acquire(s.listPath())
+	if err != nil {
+		return fmt.Errorf("cannot lock references: %v", err)
+	}
+	st, err := s.stack()
+	if err != nil {
+		lock.Rollback()
+		return err
+	}
+	return s.addTable(lock, st, nil, edit(st, st.maxUpdate+1))
+}
+
+func (s *Reftable) ReadReflog(name string) ([]*ReflogEntry, error) {
+	if inFiles(name) {
+		return s.files.ReadReflog(name)
+	}
+	st, err := s.stack()
+	if err != nil {
+		return nil, err
+	}
+	logs, ok := st.logs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: reflog for %s", ErrNotFound, name)
+	}
+	entries := []*ReflogEntry{}
+	for _, l := range logs {
+		if !s.isMarker(l) {
+			entries = append(entries, s.entry(l))
+		}
+	}
+	return entries, nil
+}
+
+// WriteReflog rewrites the records of name: kept entries are written
+// again under their own keys, the others get tombstones.
+func (s *Reftable) WriteReflog(name string, entries []*ReflogEntry) error {
+	if inFiles(name) {
+		return s.files.WriteReflog(name, entries)
+	}
+	sig, err := committer(s.Committer)
+	if err != nil {
+		return err
+	}
+	return s.editLogs(func(st *reftableStack, index uint64) []reftable.LogRecord {
+		records := []reftable.LogRecord{}
+		kept := map[uint64]bool{}
+		for _, e := range entries {
+			i := e.updateIndex
+			if i == 0 {
+				i = index
+				index++
+			}
+			kept[i] = true
+			records = append(records, s.logRecord(name, i, e))
+		}
+		for _, l := range st.logs[name] {
+			if !kept[l.UpdateIndex] && !s.isMarker(l) {
+				records = append(records, reftable.LogRecord{Name: name, UpdateIndex: l.UpdateIndex, Deleted: true})
+			}
+		}
+		if len(entries) == 0 {
+			// An emptied reflog still exists, as with the files backend.
+			zero := s.Algo.ZeroHex()
+			records = append(records, s.logRecord(name, index, newReflogEntry(sig, zero, zero, "")))
+		}
+		return records
+	})
+}
+
+func (s *Reftable) DeleteReflog(name string) error {
+	if inFiles(name) {
+		return s.files.DeleteReflog(name)
+	}
+	if !s.HasReflog(name) {
+		return nil
+	}
+	return s.editLogs(func(st *reftableStack, index uint64) []reftable.LogRecord {
+		return tombstones(st, name)
+	})
+}
+
+func tombstones(st *reftableStack, name string) []reftable.LogRecord {
+	records := []reftable.LogRecord{}
+	for _, l := range st.logs[name] {
+		records = append(records, reftable.LogRecord{Name: name, UpdateIndex: l.UpdateIndex, Deleted: true})
+	}
+	return records
+}
+
+func (s *Reftable) ListReflogs() ([]string, error) {
+	st, err := s.stack()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range st.logs {
+		names = append(names, name)
+	}
+	files, err := s.files.ListReflogs()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range files {
+		if inFiles(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// reftableTransaction holds the tables.list lock from Prepare to Commit,
+// which serializes all writers of the stack.
+type reftableTransaction struct {
+	txQueue
+	store *Reftable
+	files Transaction // for pseudorefs kept as files
+	lock  *lockfile.Lock
+	stack *reftableStack
+	noLog bool
+}
+
+func (s *Reftable) NewTransaction() Transaction {
+	return &reftableTransaction{txQueue: txQueue{algo: s.Algo}, store: s, files: s.files.NewTransaction()}
+}
+
+func (t *reftableTransaction) Prepare() error {
+	if t.state != txOpen {
+		return ErrTransactionClosed
+	}
+	if err := t.prepare(); err != nil {
+		t.Abort()
+		return err
+	}
+	t.state = txPrepared
+	return nil
+}
+
+func (t *reftableTransaction) prepare() error {
+	s := t.store
+	lock, err := lockfile.Acquire(s.listPath())
+	if err != nil {
+		return fmt.Errorf("cannot lock references: %v", err)
+	}
+	t.lock = lock
+	if t.stack, err = s.stack(); err != nil {
+		return err
+	}
+	read := func(name string) (*Ref, error) {
+		return s.Read(name)
+	}
+	seen := map[string]bool{}
+	updates := t.updates[:0]
+	for _, u := range t.updates {
+		if inFiles(u.name) {
+			if err := t.queueFiles(u); err != nil {
+				return err
+			}
+			continue
+		}
+		u.target = u.name
+		if !u.noDeref {
+			ref, err := resolve(read, u.name)
+			if err != nil && !IsNotFound(err) {
+				return err
+			}
+			u.target = ref.Name
+		}
+		if seen[u.target] {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", u.target)
+		}
+		seen[u.target] = true
+		if !ValidUpdateName(u.target) {
+			return fmt.Errorf("refusing to update ref with bad name '%s'", u.target)
+		}
+		u.current, _ = read(u.target)
+		if err := verifyOld(s.Algo, read, u.target, u.current, u.old); err != nil {
+			return err
+		}
+		if u.newSha != "" && !t.isDelete(u) || u.symref != "" {
+			if err := t.checkConflicts(u.target); err != nil {
+				return err
+			}
+		}
+		updates = append(updates, u)
+	}
+	t.updates = updates
+	return t.files.Prepare()
+}
+
+func (t *reftableTransaction) queueFiles(u *txUpdate) error {
+	switch {
+	case u.symref != "":
+		return fmt.Errorf("cannot make %s a symbolic ref", u.name)
+	case u.newSha == "":
+		return t.files.Verify(u.name, u.old, u.noDeref)
+	case t.isDelete(u):
+		return t.files.Delete(u.name, u.old, u.msg, u.noDeref)
+	}
+	return t.files.Update(u.name, u.newSha, u.old, u.msg, u.noDeref)
+}
+
+// checkConflicts rejects refs/heads/a when refs/heads/a/b exists and the
+// other way around, like the files backend has to.
+func (t *reftableTransaction) checkConflicts(name string) error {
+	st := t.stack
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		prefix := strings.Join(parts[:i], "/")
+		if _, ok := st.refs[prefix]; ok && !t.deletes(prefix) {
+			return fmt.Errorf("cannot lock ref '%s': '%s' exists; cannot create '%s'", name, prefix, name)
+		}
+	}
+	for i := sort.SearchStrings(st.sorted, name+"/"); i < len(st.sorted) && strings.HasPrefix(st.sorted[i], name+"/"); i++ {
+		if !t.deletes(st.sorted[i]) {
+			return fmt.Errorf("cannot lock ref '%s': '%s' exists; cannot create '%s'", name, st.sorted[i], name)
+		}
+	}
+	return nil
+}
+
+func (t *reftableTransaction) deletes(name string) bool {
+	for _, u := range t.updates {
+		if u.target == name && t.isDelete(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// Commit writes all updates into one new table with a single update
+// index, along with their reflog entries.
+func (t *reftableTransaction) Commit() error {
+	if t.state == txOpen {
+		if err := t.Prepare(); err != nil {
+			return err
+		}
+	}
+	if t.state != txPrepared {
+		return ErrTransactionClosed
+	}
+	defer t.Abort()
+	s := t.store
+	st := t.stack
+	index := st.maxUpdate + 1
+	sig, err := committer(s.Committer)
+	if err != nil {
+		return err
+	}
+
+	refs := []reftable.RefRecord{}
+	// Keyed by "<name>\0" for new entries and "<name>\0<index>" for
+	// tombstones of older ones.
+	logs := map[string]reftable.LogRecord{}
+	addLog := func(name, old, new, msg string) {
+		if t.noLog {
+			return
+		}
+		if !shouldLog(s.LogRefUpdates, name, len(st.logs[name]) > 0) {
+			return
+		}
+		if old == "" {
+			old = s.Algo.ZeroHex()
+		}
+		logs[name+"\x00"] = s.logRecord(name, index, newReflogEntry(sig, old, new, msg))
+	}
+	current := func(u *txUpdate) string {
+		if u.current == nil {
+			return ""
+		}
+		if ref, err := resolve(s.Read, u.target); err == nil {
+			return ref.Target
+		}
+		return ""
+	}
+	head, _ := s.Read(HEAD)
+	for _, u := range t.updates {
+		switch {
+		case u.symref != "":
+			refs = append(refs, reftable.RefRecord{Name: u.target, UpdateIndex: index, Target: u.symref})
+			if resolved, err := s.Resolve(u.symref); err == nil && u.msg != "" {
+				addLog(u.target, current(u), resolved.Target, u.msg)
+			}
+		case u.newSha == "":
+			// verify only
+		case t.isDelete(u):
+			if u.current == nil {
+				continue
+			}
+			refs = append(refs, reftable.RefRecord{Name: u.target, UpdateIndex: index, Deleted: true})
+			for _, l := range tombstones(st, u.target) {
+				logs[u.target+"\x00"+strconv.FormatUint(l.UpdateIndex, 10)] = l
+			}
+			delete(logs, u.target+"\x00")
+			if u.target != HEAD && (u.name == HEAD || head != nil && head.Symref == u.target) {
+				addLog(HEAD, current(u), s.Algo.ZeroHex(), u.msg)
+			}
+		default:
+			value, _ := hex.DecodeString(u.newSha)
+			refs = append(refs, reftable.RefRecord{Name: u.target, UpdateIndex: index, Value: value})
+			old := current(u)
+			addLog(u.target, old, u.newSha, u.msg)
+			if u.target != HEAD && (u.name == HEAD || head != nil && head.Symref == u.target) {
+				addLog(HEAD, old, u.newSha, u.msg)
+			}
+		}
+	}
+	if err := t.files.Commit(); err != nil {
+		return err
+	}
+	if len(refs) == 0 && len(logs) == 0 {
+		return nil
+	}
+	logList := make([]reftable.LogRecord, 0, len(logs))
+	for _, l := range logs {
+		logList = append(logList, l)
+	}
+	err = s.addTable(t.lock, st, refs, logList)
+	t.lock = nil
+	return err
+}
+
+func (t *reftableTransaction) Abort() {
+	if t.lock != nil {
+		t.lock.Rollback()
+		t.lock = nil
+	}
+	t.files.Abort()
+	t.state = txClosed
+}
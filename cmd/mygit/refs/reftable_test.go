@@ -0,0 +1,167 @@
+package refs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/reftable"
+)
+
+func newTestReftable(t *testing.T) *Reftable {
+	s := NewReftable(t.TempDir(), hash.SHA1)
+	if err := os.MkdirAll(s.dir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s.LogRefUpdates = "true"
+	s.Committer = func() (object.Signature, error) {
+		return object.ParseSignature("A U Thor <author@example.com> 1112911993 -0700")
+	}
+	return s
+}
+
+// readStack reads the tables of tables.list, oldest first.
+func readStack(t *testing.T, s *Reftable) ([]*reftable.Table, []int64) {
+	t.Helper()
+	list, err := ioutil.ReadFile(s.listPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, sizes := []*reftable.Table{}, []int64{}
+	for _, name := range strings.Fields(string(list)) {
+		data, err := ioutil.ReadFile(filepath.Join(s.dir(), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		table, err := reftable.Read(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		tables, sizes = append(tables, table), append(sizes, int64(len(data)))
+	}
+	return tables, sizes
+}
+
+func TestReftableAutoCompaction(t *testing.T) {
+	s := newTestReftable(t)
+	const updates = 64
+	for i := 0; i < updates; i++ {
+		sha := fmt.Sprintf("%040x", i+1)
+		if err := s.Update(fmt.Sprintf("refs/heads/b%d", i%8), sha, "", fmt.Sprintf("update %d", i), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tables, sizes := readStack(t, s)
+	// Each table is at least twice the size of the next one, which keeps
+	// the stack logarithmic.
+	for i := 1; i < len(sizes); i++ {
+		if sizes[i-1] < 2*sizes[i] {
+			t.Errorf("table %d is %d bytes, table %d %d bytes", i-1, sizes[i-1], i, sizes[i])
+		}
+	}
+	if len(tables) > 7 {
+		t.Errorf("%d tables after %d updates", len(tables), updates)
+	}
+	// The update indexes of the tables follow each other.
+	next := uint64(1)
+	for i, table := range tables {
+		if table.MinUpdateIndex != next || table.MaxUpdateIndex < table.MinUpdateIndex {
+			t.Errorf("table %d covers %d-%d, want it to start at %d", i, table.MinUpdateIndex, table.MaxUpdateIndex, next)
+		}
+		next = table.MaxUpdateIndex + 1
+	}
+	if next != updates+1 {
+		t.Errorf("tables end at update %d, want %d", next-1, updates)
+	}
+
+	for b := 0; b < 8; b++ {
+		name := fmt.Sprintf("refs/heads/b%d", b)
+		ref, err := s.Read(name)
+		if want := fmt.Sprintf("%040x", updates-8+b+1); err != nil || ref.Target != want {
+			t.Fatalf("%s = %v, %v, want %s", name, ref, err, want)
+		}
+		entries, err := s.ReadReflog(name)
+		if err != nil || len(entries) != updates/8 {
+			t.Fatalf("reflog of %s has %d entries, %v", name, len(entries), err)
+		}
+		if last := entries[len(entries)-1].Message; last != fmt.Sprintf("update %d", updates-8+b) {
+			t.Errorf("last reflog entry of %s is %q", name, last)
+		}
+	}
+
+	leftover, err := ioutil.ReadDir(s.dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftover) != len(tables)+1 {
+		t.Errorf("%d files in the reftable directory for %d tables", len(leftover), len(tables))
+	}
+}
+
+func TestReftableCompactionDropsTombstones(t *testing.T) {
+	s := newTestReftable(t)
+	if err := s.Update("refs/heads/gone", testSha, "", "create", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update("refs/heads/kept", testSha, "", "create", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("refs/heads/gone", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if s.Exists("refs/heads/gone") {
+		t.Fatal("deleted ref still exists")
+	}
+	if err := s.Pack(PackOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	tables, _ := readStack(t, s)
+	if len(tables) != 1 {
+		t.Fatalf("%d tables after packing", len(tables))
+	}
+	for _, r := range tables[0].Refs {
+		if r.Deleted || r.Name == "refs/heads/gone" {
+			t.Errorf("packed table holds %+v", r)
+		}
+	}
+	if !s.Exists("refs/heads/kept") || s.Exists("refs/heads/gone") {
+		t.Error("packing changed the refs")
+	}
+}
+
+func TestReftableEmptyReflogMessage(t *testing.T) {
+	s := newTestReftable(t)
+	if err := s.Update("refs/heads/main", testSha, "", "", false); err != nil {
+		t.Fatal(err)
+	}
+	// Like git, messages are stored with a newline, which reading drops.
+	tables, _ := readStack(t, s)
+	if logs := tables[0].Logs; len(logs) != 1 || logs[0].Message != "\n" {
+		t.Fatalf("logs = %+v, want one with the message \"\\n\"", logs)
+	}
+	entries, err := s.ReadReflog("refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Message != "" {
+		t.Fatalf("entries = %+v, want one with an empty message", entries)
+	}
+
+	// The files backend reads the same entry back the same way.
+	files := newTestFiles(t)
+	if err := files.WriteReflog("refs/heads/main", entries); err != nil {
+		t.Fatal(err)
+	}
+	fromFiles, err := files.ReadReflog("refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromFiles) != 1 || fromFiles[0].Message != entries[0].Message {
+		t.Errorf("files backend read %+v", fromFiles)
+	}
+}
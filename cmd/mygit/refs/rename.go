@@ -0,0 +1,43 @@
+package refs
+
+import "fmt"
+
+// Rename moves a ref together with its reflog to a new name. A ref
+// already at the new name is replaced. The move is logged with msg in the reflog of the new ref; pointing HEAD at a
+// renamed branch is left to the caller.
+// ref: files_copy_or_rename_ref in https://github.com/git/git/blob/master/refs/files-backend.c
+func Rename(s Store, oldName, newName, msg string) error {
+	old, err := s.Read(oldName)
+	if err != nil {
+		return err
+	}
+	if old.IsSymbolic() {
+		return fmt.Errorf("refname %s is a symbolic ref, renaming it is not supported", oldName)
+	}
+	entries, err := s.ReadReflog(oldName)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	t := s.NewTransaction()
+	if err := t.Delete(oldName, old.Target, msg, true); err != nil {
+		return err
+	}
+	if err := t.Commit(); err != nil {
+		return fmt.Errorf("unable to delete old %s: %v", oldName, err)
+	}
+	if s.Exists(newName) {
+		if err := s.Delete(newName, "", true); err != nil {
+			return err
+		}
+	}
+	if err := s.Write(newName, old.Target, ""); err != nil {
+		return err
+	}
+	if entries != nil {
+		if err := s.WriteReflog(newName, entries); err != nil {
+			return err
+		}
+	}
+	// Logged as an update from the object to itself, like git.
+	return s.Update(newName, old.Target, old.Target, msg, true)
+}
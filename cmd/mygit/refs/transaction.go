@@ -0,0 +1,293 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/lockfile"
+)
+
+type txState int
+
+const (
+	txOpen txState = iota
+	txPrepared
+	txClosed
+)
+
+// txUpdate is one queued change. newSha is "" for a verify and the zero
+// object name for a delete; an update with symref set writes a symbolic
+// ref instead.
+type txUpdate struct {
+	name    string
+	newSha  string
+	old     string
+	msg     string
+	noDeref bool
+	symref  string
+
+	target  string
+	lock    *lockfile.Lock
+	current *Ref
+}
+
+// txQueue collects the updates of a transaction until it is prepared.
+// Both backends share it.
+type txQueue struct {
+	algo    hash.Algo
+	updates []*txUpdate
+	state   txState
+}
+
+var ErrTransactionClosed = errors.New("transaction is already closed")
+
+func (q *txQueue) queue(u *txUpdate) error {
+	if q.state != txOpen {
+		return ErrTransactionClosed
+	}
+	q.updates = append(q.updates, u)
+	return nil
+}
+
+// Update queues pointing name at newSha, if it currently is at old.
+// old follows Store.Update: "" skips the check, the zero name requires
+// the ref not to exist.
+func (q *txQueue) Update(name, newSha, old, msg string, noDeref bool) error {
+	if !q.algo.IsHex(newSha) {
+		return fmt.Errorf("invalid object name: %s", newSha)
+	}
+	return q.queue(&txUpdate{name: name, newSha: newSha, old: old, msg: msg, noDeref: noDeref})
+}
+
+// Create queues creating name, which must not exist yet.
+func (q *txQueue) Create(name, newSha, msg string, noDeref bool) error {
+	return q.Update(name, newSha, q.algo.ZeroHex(), msg, noDeref)
+}
+
+// Delete queues removing name, if it currently is at old.
+func (q *txQueue) Delete(name, old, msg string, noDeref bool) error {
+	return q.queue(&txUpdate{name: name, newSha: q.algo.ZeroHex(), old: old, msg: msg, noDeref: noDeref})
+}
+
+// Verify queues a check that name is at old without changing it.
+func (q *txQueue) Verify(name, old string, noDeref bool) error {
+	if old == "" {
+		old = q.algo.ZeroHex()
+	}
+	return q.queue(&txUpdate{name: name, old: old, noDeref: noDeref})
+}
+
+func (q *txQueue) isDelete(u *txUpdate) bool {
+	return u.newSha == q.algo.ZeroHex()
+}
+
+// verifyOld checks the value current, read under lock, against the
+// expected old value of an update.
+func verifyOld(algo hash.Algo, read func(string) (*Ref, error), name string, current *Ref, old string) error {
+	if old == "" {
+		return nil
+	}
+	if old == algo.ZeroHex() {
+		if current != nil {
+			return fmt.Errorf("cannot lock ref '%s': reference already exists", name)
+		}
+		return nil
+	}
+	if current == nil {
+		return fmt.Errorf("cannot lock ref '%s': unable to resolve reference '%s'", name, name)
+	}
+	value := current.Target
+	if current.IsSymbolic() {
+		resolved, err := resolve(read, current.Symref)
+		if err != nil {
+			return fmt.Errorf("cannot lock ref '%s': unable to resolve reference '%s'", name, current.Symref)
+		}
+		value = resolved.Target
+	}
+	if value != old {
+		return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", name, value, old)
+	}
+	return nil
+}
+
+// filesTransaction locks every loose ref it changes, and packed-refs when
+// a packed ref is deleted.
+type filesTransaction struct {
+	txQueue
+	store      *Files
+	packedLock *lockfile.Lock
+	committed  bool
+}
+
+func (s *Files) NewTransaction() Transaction {
+	return &filesTransaction{txQueue: txQueue{algo: s.Algo}, store: s}
+}
+
+// Prepare locks every ref and verifies its old value. On failure all
+// locks are released and the transaction is closed.
+func (t *filesTransaction) Prepare() error {
+	if t.state != txOpen {
+		return ErrTransactionClosed
+	}
+	if err := t.prepare(); err != nil {
+		t.Abort()
+		return err
+	}
+	t.state = txPrepared
+	return nil
+}
+
+func (t *filesTransaction) prepare() error {
+	s := t.store
+	seen := map[string]bool{}
+	deletesPacked := false
+	for _, u := range t.updates {
+		target, err := s.target(u.name, u.noDeref)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+		if seen[target] {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", target)
+		}
+		seen[target] = true
+		u.target = target
+		if err := t.checkQueued(u); err != nil {
+			return err
+		}
+		if u.lock, u.current, err = s.lock(target, u.old); err != nil {
+			return err
+		}
+		if t.isDelete(u) && u.current != nil {
+			if _, err := s.readPacked(target); err == nil {
+				deletesPacked = true
+			}
+		}
+	}
+	if deletesPacked {
+		lock, err := lockfile.Acquire(s.packedPath())
+		if err != nil {
+			return fmt.Errorf("cannot lock packed-refs: %v", err)
+		}
+		t.packedLock = lock
+	}
+	return nil
+}
+
+// checkQueued rejects an update whose ref would be a directory of
+// another queued ref, or the other way round: refs/heads/a and
+// refs/heads/a/b can't be written together.
+func (t *filesTransaction) checkQueued(u *txUpdate) error {
+	for _, other := range t.updates {
+		if other != u && strings.HasPrefix(u.target, other.name+"/") {
+			return fmt.Errorf("cannot lock ref '%s': cannot process '%s' and '%s' at the same time", u.target, u.target, other.name)
+		}
+	}
+	for _, other := range t.updates {
+		if other != u && strings.HasPrefix(other.name, u.target+"/") {
+			return fmt.Errorf("cannot lock ref '%s': cannot process '%s' and '%s' at the same time", u.target, u.target, other.name)
+		}
+	}
+	return nil
+}
+
+// Commit prepares the transaction if needed and applies every update:
+// deleted refs leave packed-refs first, then the loose files and the
+// reflogs are written.
+func (t *filesTransaction) Commit() error {
+	if t.state == txOpen {
+		if err := t.Prepare(); err != nil {
+			return err
+		}
+	}
+	if t.state != txPrepared {
+		return ErrTransactionClosed
+	}
+	defer t.Abort()
+	s := t.store
+
+	if t.packedLock != nil {
+		p, err := s.packed()
+		if err != nil {
+			return err
+		}
+		deleted := map[string]bool{}
+		for _, u := range t.updates {
+			if t.isDelete(u) {
+				deleted[u.target] = true
+			}
+		}
+		kept := make([]*Ref, 0, len(p.refs))
+		for _, ref := range p.refs {
+			if !deleted[ref.Name] {
+				kept = append(kept, ref)
+			}
+		}
+		err = s.writePacked(t.packedLock, kept)
+		t.packedLock = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, u := range t.updates {
+		switch {
+		case u.newSha == "":
+			// verify only
+		case t.isDelete(u):
+			if u.current == nil {
+				continue
+			}
+			err := os.Remove(s.path(u.target))
+			u.lock.Rollback()
+			u.lock = nil
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			s.pruneEmptyDirs(u.target)
+			if err := s.DeleteReflog(u.target); err != nil {
+				return err
+			}
+			if err := s.logHead(u.name, u.target, u.current.Target, t.algo.ZeroHex(), u.msg); err != nil {
+				return err
+			}
+		default:
+			if _, err := u.lock.Write([]byte(u.newSha + "\n")); err != nil {
+				return err
+			}
+			old := s.value(u.current)
+			// A lock that fails to commit is left for Abort to remove.
+			if err := u.lock.Commit(); err != nil {
+				return err
+			}
+			u.lock = nil
+			if err := s.logUpdate(u.name, u.target, old, u.newSha, u.msg); err != nil {
+				return err
+			}
+		}
+	}
+	t.committed = true
+	return nil
+}
+
+// Abort releases every lock without changing anything, and removes the
+// directories made for the locks. It is a no-op on a committed
+// transaction.
+func (t *filesTransaction) Abort() {
+	for _, u := range t.updates {
+		if u.lock != nil {
+			u.lock.Rollback()
+			u.lock = nil
+		}
+		if !t.committed && u.target != "" {
+			t.store.pruneEmptyDirs(u.target)
+		}
+	}
+	if t.packedLock != nil {
+		t.packedLock.Rollback()
+		t.packedLock = nil
+	}
+	t.state = txClosed
+}
@@ -0,0 +1,108 @@
+package refs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+const testSha = "1111111111111111111111111111111111111111"
+
+func newTestFiles(t *testing.T) *Files {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "refs", "heads"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s := NewFiles(dir, hash.SHA1)
+	s.LogRefUpdates = "true"
+	s.Committer = func() (object.Signature, error) {
+		return object.ParseSignature("A U Thor <author@example.com> 1112911993 -0700")
+	}
+	return s
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func TestTransactionQueuedDFConflict(t *testing.T) {
+	for _, names := range [][2]string{
+		{"refs/heads/x", "refs/heads/x/y"},
+		{"refs/heads/x/y", "refs/heads/x"},
+	} {
+		s := newTestFiles(t)
+		tx := s.NewTransaction()
+		for _, name := range names {
+			if err := tx.Update(name, testSha, "", "test", false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := tx.Commit()
+		want := "cannot lock ref '" + names[0] + "': cannot process '" + names[0] + "' and '" + names[1] + "' at the same time"
+		if err == nil || err.Error() != want {
+			t.Fatalf("Commit() = %v, want %q", err, want)
+		}
+		for _, p := range []string{"refs/heads/x", "refs/heads/x.lock", "logs/refs/heads/x"} {
+			if exists(filepath.Join(s.GitDir, p)) {
+				t.Errorf("%v: %s left behind", names, p)
+			}
+		}
+	}
+}
+
+func TestTransactionExistingDFConflict(t *testing.T) {
+	s := newTestFiles(t)
+	tx := s.NewTransaction()
+	tx.Update("refs/heads/x", testSha, "", "test", false)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx = s.NewTransaction()
+	tx.Update("refs/heads/x/y", testSha, "", "test", false)
+	if err := tx.Commit(); err == nil || !strings.Contains(err.Error(), "refs/heads/x") {
+		t.Fatalf("Commit() = %v, want a conflict with refs/heads/x", err)
+	}
+
+	tx = s.NewTransaction()
+	tx.Update("refs/heads/a/b", testSha, "", "test", false)
+	tx.Update("refs/heads/x/y", testSha, "", "test", false)
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Commit() succeeded over an existing refs/heads/x")
+	}
+	if exists(filepath.Join(s.GitDir, "refs/heads/a")) {
+		t.Error("refs/heads/a left behind by a failed transaction")
+	}
+	if exists(filepath.Join(s.GitDir, "logs/refs/heads/a")) {
+		t.Error("reflog written by a failed transaction")
+	}
+}
+
+func TestTransactionCommitWritesReflog(t *testing.T) {
+	s := newTestFiles(t)
+	tx := s.NewTransaction()
+	tx.Update("refs/heads/a/b", testSha, "", "test", false)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(s.GitDir, "refs/heads/a/b"))
+	if err != nil || string(data) != testSha+"\n" {
+		t.Fatalf("refs/heads/a/b = %q, %v", data, err)
+	}
+	log, err := os.ReadFile(filepath.Join(s.GitDir, "logs/refs/heads/a/b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := hash.SHA1.ZeroHex() + " " + testSha + " A U Thor <author@example.com> 1112911993 -0700\ttest\n"
+	if string(log) != want {
+		t.Errorf("reflog = %q, want %q", log, want)
+	}
+	if exists(filepath.Join(s.GitDir, "refs/heads/a/b.lock")) {
+		t.Error("lock left behind")
+	}
+}
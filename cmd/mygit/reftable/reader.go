@@ -0,0 +1,292 @@
+package reftable
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+)
+
+// Table is a parsed reftable file.
+type Table struct {
+	Version        int
+	BlockSize      int
+	HashSize       int
+	MinUpdateIndex uint64
+	MaxUpdateIndex uint64
+	Refs           []RefRecord // sorted by name
+	Logs           []LogRecord // sorted by name, newest first
+}
+
+// Read parses a whole table. Index and object blocks are skipped: the
+// records are read sequentially.
+func Read(data []byte) (*Table, error) {
+	if len(data) < headerSize(1) || string(data[:4]) != magic {
+		return nil, ErrFormat
+	}
+	t := &Table{Version: int(data[4]), HashSize: 20}
+	if t.Version != 1 && t.Version != 2 {
+		return nil, fmt.Errorf("reftable: unsupported version %d", t.Version)
+	}
+	hs := headerSize(t.Version)
+	fs := footerSize(t.Version)
+	if len(data) < hs+fs && len(data) != fs {
+		return nil, ErrFormat
+	}
+	t.BlockSize = getUint24(data[5:])
+	t.MinUpdateIndex = binary.BigEndian.Uint64(data[8:])
+	t.MaxUpdateIndex = binary.BigEndian.Uint64(data[16:])
+	if t.Version == 2 {
+		switch string(data[24:28]) {
+		case "sha1":
+		case "s256":
+			t.HashSize = 32
+		default:
+			return nil, fmt.Errorf("reftable: unknown hash id %q", data[24:28])
+		}
+	}
+
+	footerStart := len(data) - fs
+	footer := data[footerStart:]
+	if !bytes.Equal(footer[:hs], data[:hs]) ||
+		crc32.ChecksumIEEE(footer[:fs-4]) != binary.BigEndian.Uint32(footer[fs-4:]) {
+		return nil, ErrFormat
+	}
+	if footerStart <= hs {
+		// A table without any block is just the header and the footer.
+		return t, nil
+	}
+	positions := make([]uint64, 5)
+	for i := range positions {
+		positions[i] = binary.BigEndian.Uint64(footer[hs+8*i:])
+	}
+	refIndex, objPosition, objIndex, logPosition, logIndex := positions[0], positions[1]>>5, positions[2], positions[3], positions[4]
+
+	// Without refs the log section starts in the first block, at offset 0.
+	hasLogs := logPosition != 0 || data[hs] == blockTypeLog
+	refEnd := uint64(footerStart)
+	for _, pos := range []uint64{refIndex, objPosition, objIndex, logPosition} {
+		if pos != 0 && pos < refEnd {
+			refEnd = pos
+		}
+	}
+	if data[hs] == blockTypeLog {
+		refEnd = 0
+	}
+	if err := t.readRefs(data, hs, int(refEnd)); err != nil {
+		return nil, err
+	}
+	if hasLogs {
+		logEnd := uint64(footerStart)
+		if logIndex != 0 {
+			logEnd = logIndex
+		}
+		if err := t.readLogs(data, hs, int(logPosition), int(logEnd)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// block is the uncompressed contents of one block.
+type block struct {
+	data      []byte // from the start of the block, file header included
+	headerOff int
+	length    int // block_len
+}
+
+// records calls fn with the key, value type and value bytes of every
+// record, undoing the prefix compression.
+func (b *block) records(fn func(key string, typ byte, value []byte) (int, error)) error {
+	if b.length > len(b.data) || b.length < b.headerOff+6 {
+		return ErrFormat
+	}
+	restarts := int(binary.BigEndian.Uint16(b.data[b.length-2:]))
+	end := b.length - 2 - 3*restarts
+	if end < b.headerOff+4 {
+		return ErrFormat
+	}
+	pos := b.headerOff + 4
+	last := ""
+	for pos < end {
+		prefix, n, ok := getVarint(b.data[pos:end])
+		if !ok {
+			return ErrFormat
+		}
+		pos += n
+		suffixType, n, ok := getVarint(b.data[pos:end])
+		if !ok {
+			return ErrFormat
+		}
+		pos += n
+		suffix := int(suffixType >> 3)
+		if int(prefix) > len(last) || pos+suffix > end {
+			return ErrFormat
+		}
+		key := last[:prefix] + string(b.data[pos:pos+suffix])
+		pos += suffix
+		n, err := fn(key, byte(suffixType&7), b.data[pos:end])
+		if err != nil {
+			return err
+		}
+		pos += n
+		last = key
+	}
+	return nil
+}
+
+func (t *Table) readRefs(data []byte, hs, end int) error {
+	for off := 0; off < end; {
+		headerOff := 0
+		if off == 0 {
+			headerOff = hs
+		}
+		if off+headerOff+4 > end {
+			return ErrFormat
+		}
+		typ := data[off+headerOff]
+		length := getUint24(data[off+headerOff+1:])
+		if length == 0 || off+length > end {
+			return ErrFormat
+		}
+		if typ == blockTypeRef {
+			b := &block{data: data[off : off+length], headerOff: headerOff, length: length}
+			if err := b.records(t.parseRef); err != nil {
+				return err
+			}
+		} else if typ != blockTypeIndex {
+			return fmt.Errorf("reftable: unexpected block type %q", typ)
+		}
+		// A zero byte after the block means it is padded.
+		if t.BlockSize > 0 && off+length < end && data[off+length] == 0 {
+			off += t.BlockSize
+		} else {
+			off += length
+		}
+	}
+	return nil
+}
+
+func (t *Table) parseRef(key string, typ byte, value []byte) (int, error) {
+	delta, pos, ok := getVarint(value)
+	if !ok {
+		return 0, ErrFormat
+	}
+	r := RefRecord{Name: key, UpdateIndex: t.MinUpdateIndex + delta}
+	switch typ {
+	case refValueDeletion:
+		r.Deleted = true
+	case refValueVal1, refValueVal2:
+		n := t.HashSize
+		if typ == refValueVal2 {
+			n *= 2
+		}
+		if pos+n > len(value) {
+			return 0, ErrFormat
+		}
+		r.Value = append([]byte{}, value[pos:pos+t.HashSize]...)
+		if typ == refValueVal2 {
+			r.Peeled = append([]byte{}, value[pos+t.HashSize:pos+n]...)
+		}
+		pos += n
+	case refValueSymref:
+		size, n, ok := getVarint(value[pos:])
+		if !ok || pos+n+int(size) > len(value) {
+			return 0, ErrFormat
+		}
+		pos += n
+		r.Target = string(value[pos : pos+int(size)])
+		pos += int(size)
+	default:
+		return 0, ErrFormat
+	}
+	t.Refs = append(t.Refs, r)
+	return pos, nil
+}
+
+func (t *Table) readLogs(data []byte, hs, off, end int) error {
+	for off < end {
+		headerOff := 0
+		if off == 0 {
+			headerOff = hs
+		}
+		start := off + headerOff + 4
+		if start > end {
+			return ErrFormat
+		}
+		typ := data[off+headerOff]
+		length := getUint24(data[off+headerOff+1:])
+		if typ == blockTypeIndex {
+			off += length
+			continue
+		}
+		if typ != blockTypeLog || length < headerOff+4 {
+			return fmt.Errorf("reftable: unexpected block type %q", typ)
+		}
+		src := bytes.NewReader(data[start:end])
+		zr, err := zlib.NewReader(src)
+		if err != nil {
+			return ErrFormat
+		}
+		contents, err := ioutil.ReadAll(zr)
+		if err != nil || len(contents) != length-headerOff-4 {
+			return ErrFormat
+		}
+		raw := append(append([]byte{}, data[off:start]...), contents...)
+		b := &block{data: raw, headerOff: headerOff, length: length}
+		if err := b.records(t.parseLog); err != nil {
+			return err
+		}
+		off = end - src.Len()
+	}
+	return nil
+}
+
+func (t *Table) parseLog(key string, typ byte, value []byte) (int, error) {
+	name, updateIndex, ok := parseLogKey(key)
+	if !ok {
+		return 0, ErrFormat
+	}
+	l := LogRecord{Name: name, UpdateIndex: updateIndex}
+	if typ == logValueDeletion {
+		l.Deleted = true
+		t.Logs = append(t.Logs, l)
+		return 0, nil
+	}
+	if typ != logValueUpdate || len(value) < 2*t.HashSize {
+		return 0, ErrFormat
+	}
+	l.Old = append([]byte{}, value[:t.HashSize]...)
+	l.New = append([]byte{}, value[t.HashSize:2*t.HashSize]...)
+	pos := 2 * t.HashSize
+	str := func() (string, bool) {
+		size, n, ok := getVarint(value[pos:])
+		if !ok || pos+n+int(size) > len(value) {
+			return "", false
+		}
+		s := string(value[pos+n : pos+n+int(size)])
+		pos += n + int(size)
+		return s, true
+	}
+	if l.PersonName, ok = str(); !ok {
+		return 0, ErrFormat
+	}
+	if l.Email, ok = str(); !ok {
+		return 0, ErrFormat
+	}
+	when, n, ok := getVarint(value[pos:])
+	if !ok || pos+n+2 > len(value) {
+		return 0, ErrFormat
+	}
+	l.Time = when
+	pos += n
+	l.TZOffset = int16(binary.BigEndian.Uint16(value[pos:]))
+	pos += 2
+	if l.Message, ok = str(); !ok {
+		return 0, ErrFormat
+	}
+	t.Logs = append(t.Logs, l)
+	return pos, nil
+}
@@ -0,0 +1,142 @@
+// Package reftable reads and writes reftable files, the block based
+// format git can store refs and reflogs in instead of loose files.
+// ref: https://git-scm.com/docs/reftable
+package reftable
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	magic = "REFT"
+
+	blockTypeRef   = 'r'
+	blockTypeLog   = 'g'
+	blockTypeObj   = 'o'
+	blockTypeIndex = 'i'
+
+	// Every restartInterval-th record of a block is written without prefix
+	// compression so readers can binary search the block.
+	restartInterval = 16
+
+	DefaultBlockSize = 4096
+)
+
+// Values of the 3 low bits of a ref record's suffix length.
+const (
+	refValueDeletion = 0
+	refValueVal1     = 1
+	refValueVal2     = 2
+	refValueSymref   = 3
+)
+
+// Values of the 3 low bits of a log record's suffix length.
+const (
+	logValueDeletion = 0
+	logValueUpdate   = 1
+)
+
+var ErrFormat = errors.New("reftable: corrupt table")
+
+// RefRecord is one ref of a table. A record with Deleted set is a
+// tombstone hiding the ref in older tables of a stack.
+type RefRecord struct {
+	Name        string
+	UpdateIndex uint64
+	Deleted     bool
+	Value       []byte // object name, nil for symrefs and tombstones
+	Peeled      []byte // peeled object name of an annotated tag, or nil
+	Target      string // symref target
+}
+
+// LogRecord is one reflog entry, keyed by ref name and update index.
+type LogRecord struct {
+	Name        string
+	UpdateIndex uint64
+	Deleted     bool
+	Old         []byte
+	New         []byte
+	PersonName  string
+	Email       string
+	Time        uint64
+	TZOffset    int16 // the "+hhmm" offset read as a decimal number
+	Message     string
+}
+
+// key sorts log records by name, newest first.
+func (l *LogRecord) key() string {
+	var idx [8]byte
+	binary.BigEndian.PutUint64(idx[:], ^l.UpdateIndex)
+	return l.Name + "\x00" + string(idx[:])
+}
+
+func parseLogKey(key string) (string, uint64, bool) {
+	if len(key) < 9 || key[len(key)-9] != 0 {
+		return "", 0, false
+	}
+	return key[:len(key)-9], ^binary.BigEndian.Uint64([]byte(key[len(key)-8:])), true
+}
+
+// putVarint writes the offset style varint also used by pack files:
+// big endian 7-bit groups where each continuation adds one.
+func putVarint(buf []byte, value uint64) []byte {
+	var tmp [10]byte
+	pos := len(tmp) - 1
+	tmp[pos] = byte(value & 127)
+	for value >>= 7; value != 0; value >>= 7 {
+		value--
+		pos--
+		tmp[pos] = 128 | byte(value&127)
+	}
+	return append(buf, tmp[pos:]...)
+}
+
+func getVarint(buf []byte) (uint64, int, bool) {
+	if len(buf) == 0 {
+		return 0, 0, false
+	}
+	c := buf[0]
+	value := uint64(c & 127)
+	n := 1
+	for c&128 != 0 {
+		if n >= len(buf) || n > 9 {
+			return 0, 0, false
+		}
+		c = buf[n]
+		n++
+		value = ((value + 1) << 7) | uint64(c&127)
+	}
+	return value, n, true
+}
+
+func putUint24(buf []byte, value int) {
+	buf[0] = byte(value >> 16)
+	buf[1] = byte(value >> 8)
+	buf[2] = byte(value)
+}
+
+func getUint24(buf []byte) int {
+	return int(buf[0])<<16 | int(buf[1])<<8 | int(buf[2])
+}
+
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// headerSize is 24 bytes for version 1 (SHA-1) and 28 for version 2,
+// which adds the hash function id.
+func headerSize(version int) int {
+	if version == 2 {
+		return 28
+	}
+	return 24
+}
+
+func footerSize(version int) int {
+	return headerSize(version) + 44
+}
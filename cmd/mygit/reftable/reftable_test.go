@@ -0,0 +1,294 @@
+package reftable
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testHash(size int, b byte) []byte {
+	return bytes.Repeat([]byte{b}, size)
+}
+
+func writeTable(t *testing.T, opts Options, refs []RefRecord, logs []LogRecord) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, opts, refs, logs); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVarint(t *testing.T) {
+	// The vectors of the offset encoding of pack files, which reftable
+	// shares.
+	for _, tt := range []struct {
+		value uint64
+		enc   []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x00}},
+		{255, []byte{0x80, 0x7f}},
+		{16511, []byte{0xff, 0x7f}},
+		{16512, []byte{0x80, 0x80, 0x00}},
+		{1<<64 - 1, []byte{0x80, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0x7f}},
+	} {
+		if got := putVarint(nil, tt.value); !bytes.Equal(got, tt.enc) {
+			t.Errorf("putVarint(%d) = %x, want %x", tt.value, got, tt.enc)
+		}
+		value, n, ok := getVarint(append(tt.enc, 0xaa))
+		if !ok || value != tt.value || n != len(tt.enc) {
+			t.Errorf("getVarint(%x) = %d, %d, %v", tt.enc, value, n, ok)
+		}
+	}
+	if _, _, ok := getVarint([]byte{0x80}); ok {
+		t.Error("getVarint accepted a truncated varint")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, hashSize := range []int{20, 32} {
+		refs := []RefRecord{
+			{Name: "refs/tags/v1", UpdateIndex: 3, Value: testHash(hashSize, 1), Peeled: testHash(hashSize, 2)},
+			{Name: "HEAD", UpdateIndex: 1, Target: "refs/heads/main"},
+			{Name: "refs/heads/main", UpdateIndex: 2, Value: testHash(hashSize, 3)},
+			{Name: "refs/heads/gone", UpdateIndex: 3, Deleted: true},
+		}
+		logs := []LogRecord{
+			{Name: "refs/heads/main", UpdateIndex: 1, Old: testHash(hashSize, 0), New: testHash(hashSize, 3),
+				PersonName: "A U Thor", Email: "author@example.com", Time: 1112911993, TZOffset: -700, Message: "commit (initial): one\n"},
+			{Name: "refs/heads/main", UpdateIndex: 2, Old: testHash(hashSize, 3), New: testHash(hashSize, 4),
+				PersonName: "A U Thor", Email: "author@example.com", Time: 1112912053, TZOffset: 130, Message: "\n"},
+			{Name: "HEAD", UpdateIndex: 2, Deleted: true},
+		}
+		opts := Options{HashSize: hashSize, MinUpdateIndex: 1, MaxUpdateIndex: 3}
+		table, err := Read(writeTable(t, opts, refs, logs))
+		if err != nil {
+			t.Fatalf("hash size %d: %v", hashSize, err)
+		}
+		// Write sorts what it is given, which is the order Read returns.
+		if !reflect.DeepEqual(table.Refs, refs) {
+			t.Errorf("hash size %d: refs = %+v, want %+v", hashSize, table.Refs, refs)
+		}
+		if !reflect.DeepEqual(table.Logs, logs) {
+			t.Errorf("hash size %d: logs = %+v, want %+v", hashSize, table.Logs, logs)
+		}
+		if table.HashSize != hashSize || table.MinUpdateIndex != 1 || table.MaxUpdateIndex != 3 {
+			t.Errorf("hash size %d: table = %+v", hashSize, table)
+		}
+		if logs[0].Name != "HEAD" || logs[1].UpdateIndex != 2 {
+			t.Errorf("hash size %d: logs not sorted by name, newest first: %+v", hashSize, logs)
+		}
+	}
+}
+
+func TestWriteRejects(t *testing.T) {
+	opts := Options{MinUpdateIndex: 1, MaxUpdateIndex: 1}
+	for name, refs := range map[string][]RefRecord{
+		"duplicate":    {{Name: "refs/heads/a", UpdateIndex: 1, Value: testHash(20, 1)}, {Name: "refs/heads/a", UpdateIndex: 1, Value: testHash(20, 2)}},
+		"out of range": {{Name: "refs/heads/a", UpdateIndex: 2, Value: testHash(20, 1)}},
+		"short name":   {{Name: "refs/heads/a", UpdateIndex: 1, Value: testHash(20, 1)[:10]}},
+	} {
+		if err := Write(ioutil.Discard, opts, refs, nil); err == nil {
+			t.Errorf("%s: Write succeeded", name)
+		}
+	}
+}
+
+func TestHeaderAndFooter(t *testing.T) {
+	for _, tt := range []struct {
+		hashSize int
+		header   []byte
+	}{
+		{20, []byte("REFT\x01\x00\x10\x00\x00\x00\x00\x00\x00\x00\x00\x05\x00\x00\x00\x00\x00\x00\x00\x07")},
+		{32, []byte("REFT\x02\x00\x10\x00\x00\x00\x00\x00\x00\x00\x00\x05\x00\x00\x00\x00\x00\x00\x00\x07s256")},
+	} {
+		data := writeTable(t, Options{HashSize: tt.hashSize, MinUpdateIndex: 5, MaxUpdateIndex: 7}, nil, nil)
+		// An empty table is the header and the footer only.
+		if len(data) != len(tt.header)+len(tt.header)+44 {
+			t.Errorf("hash size %d: empty table is %d bytes", tt.hashSize, len(data))
+		}
+		if !bytes.HasPrefix(data, tt.header) {
+			t.Errorf("hash size %d: header = %q, want %q", tt.hashSize, data[:len(tt.header)], tt.header)
+		}
+		footer := data[len(data)-len(tt.header)-44:]
+		if !bytes.HasPrefix(footer, tt.header) {
+			t.Errorf("hash size %d: footer doesn't repeat the header", tt.hashSize)
+		}
+		crc := binary.BigEndian.Uint32(footer[len(footer)-4:])
+		if want := crc32.ChecksumIEEE(footer[:len(footer)-4]); crc != want {
+			t.Errorf("hash size %d: footer CRC = %08x, want %08x", tt.hashSize, crc, want)
+		}
+		if _, err := Read(data); err != nil {
+			t.Errorf("hash size %d: %v", tt.hashSize, err)
+		}
+	}
+}
+
+func TestFooterCRC(t *testing.T) {
+	refs := []RefRecord{{Name: "refs/heads/main", UpdateIndex: 1, Value: testHash(20, 1)}}
+	data := writeTable(t, Options{MinUpdateIndex: 1, MaxUpdateIndex: 1}, refs, nil)
+	footer := len(data) - footerSize(1)
+	for _, pos := range []int{footer + 8, footer + headerSize(1) + 3*8 + 7, len(data) - 1} {
+		corrupt := append([]byte{}, data...)
+		corrupt[pos] ^= 0x01
+		if _, err := Read(corrupt); err != ErrFormat {
+			t.Errorf("byte %d flipped: Read() = %v, want %v", pos, err, ErrFormat)
+		}
+	}
+}
+
+func TestRestartPoints(t *testing.T) {
+	refs := []RefRecord{}
+	for i := 0; i < 40; i++ {
+		refs = append(refs, RefRecord{Name: fmt.Sprintf("refs/heads/branch-%02d", i), UpdateIndex: 1, Value: testHash(20, byte(i))})
+	}
+	data := writeTable(t, Options{MinUpdateIndex: 1, MaxUpdateIndex: 1}, refs, nil)
+	hs := headerSize(1)
+	if data[hs] != blockTypeRef {
+		t.Fatalf("block type = %q", data[hs])
+	}
+	length := getUint24(data[hs+1:])
+	count := int(binary.BigEndian.Uint16(data[length-2:]))
+	// A restart every 16 records: 0, 16 and 32.
+	if count != 3 {
+		t.Fatalf("%d restart points, want 3", count)
+	}
+	table := data[length-2-3*count : length-2]
+	last := 0
+	for i := 0; i < count; i++ {
+		offset := getUint24(table[3*i:])
+		if offset <= last || offset >= length-2-3*count {
+			t.Fatalf("restart %d at %d, after %d", i, offset, last)
+		}
+		last = offset
+		// A restart record has no prefix and the whole name.
+		prefix, n, _ := getVarint(data[offset:])
+		suffixType, _, _ := getVarint(data[offset+n:])
+		name := refs[16*i].Name
+		if prefix != 0 || int(suffixType>>3) != len(name) || !bytes.Contains(data[offset:offset+n+2+len(name)], []byte(name)) {
+			t.Errorf("restart %d: prefix %d, suffix length %d, want the full %s", i, prefix, suffixType>>3, name)
+		}
+	}
+	if first := getUint24(table); first != hs+4 {
+		t.Errorf("first restart at %d, want %d", first, hs+4)
+	}
+	// The records between restarts share the prefix of the name before.
+	if got := strings.Count(string(data[:length]), "refs/heads/branch-"); got != count {
+		t.Errorf("%d full names in the block, want %d", got, count)
+	}
+}
+
+func TestBlockPadding(t *testing.T) {
+	const blockSize = 256
+	refs := []RefRecord{}
+	for i := 0; i < 30; i++ {
+		refs = append(refs, RefRecord{Name: fmt.Sprintf("refs/heads/%c-topic", 'a'+i), UpdateIndex: 1, Value: testHash(20, byte(i))})
+	}
+	logs := []LogRecord{{Name: "refs/heads/a-topic", UpdateIndex: 1, Old: testHash(20, 0), New: testHash(20, 1), Message: "m\n"}}
+	opts := Options{BlockSize: blockSize, MinUpdateIndex: 1, MaxUpdateIndex: 1}
+	data := writeTable(t, opts, refs, logs)
+	hs := headerSize(1)
+	footer := data[len(data)-footerSize(1):]
+	logPosition := int(binary.BigEndian.Uint64(footer[hs+3*8:]))
+	if logPosition%blockSize == 0 {
+		t.Fatalf("log section at %d: the last ref block was padded", logPosition)
+	}
+	blocks := 0
+	for off := 0; off < logPosition; off += blockSize {
+		headerOff := 0
+		if off == 0 {
+			headerOff = hs
+		}
+		if data[off+headerOff] != blockTypeRef {
+			t.Fatalf("block at %d has type %q", off, data[off+headerOff])
+		}
+		length := getUint24(data[off+headerOff+1:])
+		if length > blockSize {
+			t.Fatalf("block at %d is %d bytes, over %d", off, length, blockSize)
+		}
+		end := off + blockSize
+		if end > logPosition {
+			// The last block isn't padded.
+			if off+length != logPosition {
+				t.Errorf("last ref block ends at %d, log section starts at %d", off+length, logPosition)
+			}
+		} else if padding := data[off+length : end]; !bytes.Equal(padding, make([]byte, len(padding))) {
+			t.Errorf("block at %d: padding %x isn't zeros", off, padding)
+		}
+		blocks++
+	}
+	if blocks < 3 {
+		t.Fatalf("%d ref blocks, want several", blocks)
+	}
+	table, err := Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(table.Refs, refs) || !reflect.DeepEqual(table.Logs, logs) {
+		t.Errorf("padded table read back as %+v", table)
+	}
+}
+
+func TestLogBlocksCompressed(t *testing.T) {
+	message := strings.Repeat("rebase (pick): a long and repetitive message ", 20) + "\n"
+	logs := []LogRecord{}
+	for i := uint64(1); i <= 5; i++ {
+		logs = append(logs, LogRecord{Name: "HEAD", UpdateIndex: i, Old: testHash(20, byte(i-1)), New: testHash(20, byte(i)),
+			PersonName: "A U Thor", Email: "author@example.com", Time: 1112911993 + i, Message: message})
+	}
+	refs := []RefRecord{{Name: "HEAD", UpdateIndex: 5, Target: "refs/heads/main"}}
+	for _, withRefs := range []bool{true, false} {
+		var tableRefs []RefRecord
+		if withRefs {
+			tableRefs = refs
+		}
+		data := writeTable(t, Options{MinUpdateIndex: 1, MaxUpdateIndex: 5}, tableRefs, append([]LogRecord{}, logs...))
+		if bytes.Contains(data, []byte("rebase (pick)")) {
+			t.Errorf("refs %v: log message stored uncompressed", withRefs)
+		}
+		hs := headerSize(1)
+		footer := data[len(data)-footerSize(1):]
+		logPosition := int(binary.BigEndian.Uint64(footer[hs+3*8:]))
+		headerOff := 0
+		if logPosition == 0 {
+			// Without refs, the log block is the first one.
+			headerOff = hs
+			if withRefs {
+				t.Fatal("log position 0 in a table with refs")
+			}
+		}
+		start := logPosition + headerOff
+		if data[start] != blockTypeLog {
+			t.Fatalf("refs %v: block at %d has type %q", withRefs, start, data[start])
+		}
+		// block_len counts the uncompressed block, the header included.
+		length := getUint24(data[start+1:])
+		zr, err := zlib.NewReader(bytes.NewReader(data[start+4:]))
+		if err != nil {
+			t.Fatalf("refs %v: %v", withRefs, err)
+		}
+		contents, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("refs %v: %v", withRefs, err)
+		}
+		if len(contents) != length-headerOff-4 {
+			t.Errorf("refs %v: inflated %d bytes, block_len %d", withRefs, len(contents), length)
+		}
+		table, err := Read(data)
+		if err != nil {
+			t.Fatalf("refs %v: %v", withRefs, err)
+		}
+		if len(table.Logs) != 5 || table.Logs[0].UpdateIndex != 5 || table.Logs[0].Message != message {
+			t.Errorf("refs %v: logs read back as %+v", withRefs, table.Logs)
+		}
+	}
+}
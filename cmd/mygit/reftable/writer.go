@@ -0,0 +1,264 @@
+package reftable
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// Options describe the table being written.
+type Options struct {
+	BlockSize      int // defaults to DefaultBlockSize
+	HashSize       int // 20 for SHA-1, 32 for SHA-256
+	MinUpdateIndex uint64
+	MaxUpdateIndex uint64
+}
+
+func (o *Options) version() int {
+	if o.HashSize == 32 {
+		return 2
+	}
+	return 1
+}
+
+func (o *Options) header() []byte {
+	buf := make([]byte, headerSize(o.version()))
+	copy(buf, magic)
+	buf[4] = byte(o.version())
+	putUint24(buf[5:], o.BlockSize)
+	binary.BigEndian.PutUint64(buf[8:], o.MinUpdateIndex)
+	binary.BigEndian.PutUint64(buf[16:], o.MaxUpdateIndex)
+	if o.version() == 2 {
+		copy(buf[24:], "s256")
+	}
+	return buf
+}
+
+// blockWriter fills one block with prefix compressed records followed by
+// the restart table.
+type blockWriter struct {
+	buf       []byte // the block, starting with the file header for the first block
+	headerOff int    // where the 4 byte block header starts in buf
+	limit     int
+	restarts  []int
+	lastKey   string
+	entries   int
+}
+
+func newBlockWriter(typ byte, fileHeader []byte, limit int) *blockWriter {
+	b := &blockWriter{buf: append([]byte{}, fileHeader...), headerOff: len(fileHeader), limit: limit}
+	b.buf = append(b.buf, typ, 0, 0, 0)
+	return b
+}
+
+// add appends a record, or reports false when it doesn't fit anymore.
+func (b *blockWriter) add(key string, valueType byte, value []byte) bool {
+	restart := b.entries%restartInterval == 0
+	prefix := 0
+	if !restart {
+		prefix = commonPrefix(b.lastKey, key)
+	}
+	rec := putVarint(nil, uint64(prefix))
+	rec = putVarint(rec, uint64(len(key)-prefix)<<3|uint64(valueType))
+	rec = append(rec, key[prefix:]...)
+	rec = append(rec, value...)
+	restarts := len(b.restarts)
+	if restart {
+		restarts++
+	}
+	if b.entries > 0 && len(b.buf)+len(rec)+3*restarts+2 > b.limit {
+		return false
+	}
+	if restart {
+		b.restarts = append(b.restarts, len(b.buf))
+	}
+	b.buf = append(b.buf, rec...)
+	b.lastKey = key
+	b.entries++
+	return true
+}
+
+// finish appends the restart table and fills in the block length.
+func (b *blockWriter) finish() []byte {
+	var tmp [3]byte
+	for _, offset := range b.restarts {
+		putUint24(tmp[:], offset)
+		b.buf = append(b.buf, tmp[:]...)
+	}
+	b.buf = append(b.buf, byte(len(b.restarts)>>8), byte(len(b.restarts)))
+	putUint24(b.buf[b.headerOff+1:], len(b.buf))
+	return b.buf
+}
+
+func (o *Options) encodeRef(r *RefRecord) (byte, []byte, error) {
+	value := putVarint(nil, r.UpdateIndex-o.MinUpdateIndex)
+	switch {
+	case r.Deleted:
+		return refValueDeletion, value, nil
+	case r.Target != "":
+		value = putVarint(value, uint64(len(r.Target)))
+		return refValueSymref, append(value, r.Target...), nil
+	case len(r.Value) != o.HashSize || (r.Peeled != nil && len(r.Peeled) != o.HashSize):
+		return 0, nil, fmt.Errorf("reftable: bad object name for %s", r.Name)
+	case r.Peeled != nil:
+		value = append(value, r.Value...)
+		return refValueVal2, append(value, r.Peeled...), nil
+	}
+	return refValueVal1, append(value, r.Value...), nil
+}
+
+func (o *Options) encodeLog(l *LogRecord) (byte, []byte, error) {
+	if l.Deleted {
+		return logValueDeletion, nil, nil
+	}
+	if len(l.Old) != o.HashSize || len(l.New) != o.HashSize {
+		return 0, nil, fmt.Errorf("reftable: bad object name in reflog of %s", l.Name)
+	}
+	value := append(append([]byte{}, l.Old...), l.New...)
+	value = putVarint(value, uint64(len(l.PersonName)))
+	value = append(value, l.PersonName...)
+	value = putVarint(value, uint64(len(l.Email)))
+	value = append(value, l.Email...)
+	value = putVarint(value, l.Time)
+	value = append(value, byte(uint16(l.TZOffset)>>8), byte(uint16(l.TZOffset)))
+	value = putVarint(value, uint64(len(l.Message)))
+	return logValueUpdate, append(value, l.Message...), nil
+}
+
+// Write writes a complete table: the ref blocks, then the zlib compressed
+// log blocks, then the footer. Records are sorted here; names must be
+// unique. No index or object blocks are written, readers scan instead.
+func Write(w io.Writer, opts Options, refs []RefRecord, logs []LogRecord) error {
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.HashSize == 0 {
+		opts.HashSize = 20
+	}
+	if opts.MaxUpdateIndex < opts.MinUpdateIndex {
+		return fmt.Errorf("reftable: update index range %d-%d", opts.MinUpdateIndex, opts.MaxUpdateIndex)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	sort.Slice(logs, func(i, j int) bool { return logs[i].key() < logs[j].key() })
+
+	header := opts.header()
+	out := []byte{}
+	fileHeader := func() []byte {
+		if len(out) == 0 {
+			return header
+		}
+		return nil
+	}
+
+	// Ref blocks are padded to the block size, except the last block of
+	// the file.
+	blocks := [][]byte{}
+	var block *blockWriter
+	for i := range refs {
+		r := &refs[i]
+		if i > 0 && refs[i-1].Name == r.Name {
+			return fmt.Errorf("reftable: duplicate ref %s", r.Name)
+		}
+		if r.UpdateIndex < opts.MinUpdateIndex || r.UpdateIndex > opts.MaxUpdateIndex {
+			return fmt.Errorf("reftable: update index %d of %s out of range", r.UpdateIndex, r.Name)
+		}
+		typ, value, err := opts.encodeRef(r)
+		if err != nil {
+			return err
+		}
+		if block != nil && block.add(r.Name, typ, value) {
+			continue
+		}
+		if block != nil {
+			blocks = append(blocks, block.finish())
+			out = append(out, blocks[len(blocks)-1]...)
+		}
+		block = newBlockWriter(blockTypeRef, fileHeader(), opts.BlockSize)
+		if !block.add(r.Name, typ, value) {
+			return fmt.Errorf("reftable: ref %s doesn't fit in a block", r.Name)
+		}
+	}
+	if block != nil {
+		blocks = append(blocks, block.finish())
+		out = append(out, blocks[len(blocks)-1]...)
+	}
+	if len(blocks) > 1 {
+		// Pad every ref block but the last one to the block size. A table
+		// with a single ref block stays small.
+		out = out[:0]
+		for i, b := range blocks {
+			out = append(out, b...)
+			if i < len(blocks)-1 {
+				out = append(out, make([]byte, opts.BlockSize-len(b))...)
+			}
+		}
+	}
+
+	logPosition := uint64(0)
+	if len(logs) > 0 {
+		logPosition = uint64(len(out))
+		block = nil
+		for i := range logs {
+			l := &logs[i]
+			if i > 0 && logs[i-1].key() == l.key() {
+				return fmt.Errorf("reftable: duplicate reflog entry %s@%d", l.Name, l.UpdateIndex)
+			}
+			typ, value, err := opts.encodeLog(l)
+			if err != nil {
+				return err
+			}
+			if block != nil && block.add(l.key(), typ, value) {
+				continue
+			}
+			if block != nil {
+				if out, err = appendLogBlock(out, block); err != nil {
+					return err
+				}
+			}
+			block = newBlockWriter(blockTypeLog, fileHeader(), opts.BlockSize)
+			if !block.add(l.key(), typ, value) {
+				return fmt.Errorf("reftable: reflog entry of %s doesn't fit in a block", l.Name)
+			}
+		}
+		var err error
+		if out, err = appendLogBlock(out, block); err != nil {
+			return err
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, header...)
+	}
+
+	footer := append([]byte{}, header...)
+	var field [8]byte
+	for _, value := range []uint64{0, 0, 0, logPosition, 0} {
+		binary.BigEndian.PutUint64(field[:], value)
+		footer = append(footer, field[:]...)
+	}
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(footer))
+	footer = append(footer, crc[:]...)
+	out = append(out, footer...)
+	_, err := w.Write(out)
+	return err
+}
+
+// appendLogBlock compresses everything after the block header.
+func appendLogBlock(out []byte, b *blockWriter) ([]byte, error) {
+	raw := b.finish()
+	start := b.headerOff + 4
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(raw[start:]); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	out = append(out, raw[:start]...)
+	return append(out, compressed.Bytes()...), nil
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package repository
+
+import (
+	"os"
+	"syscall"
+)
+
+func sameFilesystem(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+	statA, okA := infoA.Sys().(*syscall.Stat_t)
+	statB, okB := infoB.Sys().(*syscall.Stat_t)
+	if !okA || !okB {
+		return true
+	}
+	return statA.Dev == statB.Dev
+}
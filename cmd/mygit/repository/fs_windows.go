@@ -0,0 +1,5 @@
+package repository
+
+func sameFilesystem(a, b string) bool {
+	return true
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// Ident returns "Name <email>" for the author or the committer, taken
+// from GIT_AUTHOR_NAME and friends, then user.name/user.email, then the
+// login name and host like git falls back to.
+// ref: https://git-scm.com/docs/git-commit-tree#_commit_information
+func (r *Repository) Ident(kind string) string {
+	name, email := r.ident(kind)
+	return name + " <" + email + ">"
+}
+
+func (r *Repository) ident(kind string) (string, string) {
+	upper := strings.ToUpper(kind)
+	name := os.Getenv("GIT_" + upper + "_NAME")
+	email := os.Getenv("GIT_" + upper + "_EMAIL")
+	if cfg, err := r.Config(); err == nil {
+		if name == "" {
+			name, _ = cfg.Get("user.name")
+		}
+		if email == "" {
+			email, _ = cfg.Get("user.email")
+		}
+	}
+	if email == "" {
+		email = os.Getenv("EMAIL")
+	}
+	login := "unknown"
+	if u, err := user.Current(); err == nil {
+		login = u.Username
+		if name == "" {
+			name = strings.SplitN(u.Name, ",", 2)[0]
+		}
+	}
+	if name == "" {
+		name = login
+	}
+	if email == "" {
+		host, _ := os.Hostname()
+		email = login + "@" + host
+	}
+	return name, email
+}
+
+// Signature is the identity of Ident dated GIT_AUTHOR_DATE or
+// GIT_COMMITTER_DATE, or now.
+func (r *Repository) Signature(kind string) (object.Signature, error) {
+	name, email := r.ident(kind)
+	when := time.Now()
+	if value := os.Getenv("GIT_" + strings.ToUpper(kind) + "_DATE"); value != "" {
+		t, err := date.Parse(value)
+		if err != nil {
+			return object.Signature{}, err
+		}
+		when = t
+	}
+	sig := object.NewSignature(name, email, when)
+	sig.Timezone = date.Offset(when)
+	return sig, nil
+}
+
+// Committer is Signature("committer"), as recorded in reflogs.
+func (r *Repository) Committer() (object.Signature, error) {
+	return r.Signature("committer")
+}
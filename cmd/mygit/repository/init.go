@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/shared"
+)
+
+const defaultBranch = "master"
+
+type InitOptions struct {
+	Dir         string // working tree, or the repository itself when Bare
+	Bare        bool
+	Branch      string // initial branch, "" for init.defaultBranch
+	TemplateDir string
+	Shared      string // value of --shared, "" when not given
+	Format      *hash.Algo
+	RefFormat   string // "files" or "reftable", "" for the default
+}
+
+// Init creates a repository, or reinitializes an existing one without
+// touching its refs, objects or config. It reports whether the repository
+// already existed.
+// ref: https://git-scm.com/docs/git-init
+func Init(opts InitOptions) (*Repository, bool, error) {
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, false, err
+	}
+	gitDir := filepath.Join(dir, ".git")
+	workTree := dir
+	if env := os.Getenv("GIT_DIR"); env != "" {
+		if gitDir, err = filepath.Abs(env); err != nil {
+			return nil, false, err
+		}
+	}
+	if opts.Bare {
+		if os.Getenv("GIT_DIR") == "" {
+			gitDir = dir
+		}
+		workTree = ""
+	}
+	reinit := isGitDir(gitDir)
+	format := hash.SHA1
+	refFormat := opts.RefFormat
+	if refFormat != "" && refFormat != RefFormatFiles && refFormat != RefFormatReftable {
+		return nil, false, fmt.Errorf("unknown ref storage format '%s'", refFormat)
+	}
+	if reinit {
+		existing, err := open(gitDir, workTree, dir)
+		if err != nil {
+			return nil, true, err
+		}
+		if opts.Format != nil && *opts.Format != existing.Format {
+			return nil, true, fmt.Errorf("attempt to reinitialize repository with different hash")
+		}
+		if refFormat != "" && refFormat != existing.RefFormat {
+			return nil, true, fmt.Errorf("attempt to reinitialize repository with different reference storage format")
+		}
+		format, refFormat = existing.Format, existing.RefFormat
+	} else {
+		shared.Repository = shared.Umask
+		if opts.Format != nil {
+			format = *opts.Format
+		}
+		if refFormat == "" {
+			if refFormat, err = defaultRefFormat(); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	// Without --shared a re-init keeps the setting open read.
+	if opts.Shared != "" {
+		if shared.Repository, err = shared.Parse(opts.Shared); err != nil {
+			return nil, reinit, err
+		}
+	}
+
+	subdirs := []string{"", "objects", "objects/info", "objects/pack", "refs", "refs/heads", "refs/tags", "info", "hooks"}
+	if refFormat == RefFormatReftable {
+		subdirs = []string{"", "objects", "objects/info", "objects/pack", "refs", "reftable", "info", "hooks"}
+	}
+	for _, sub := range subdirs {
+		path := filepath.Join(gitDir, sub)
+		if err := shared.MkdirAll(path); err != nil {
+			return nil, reinit, err
+		}
+		if err := shared.Adjust(path); err != nil {
+			return nil, reinit, err
+		}
+	}
+	if err := copyTemplate(templateDir(opts.TemplateDir), gitDir); err != nil {
+		return nil, reinit, err
+	}
+
+	branch := opts.Branch
+	if branch == "" {
+		branch = initDefaultBranch()
+	}
+	if !validBranchName(branch) {
+		return nil, reinit, fmt.Errorf("invalid initial branch name: '%s'", branch)
+	}
+	headPath := filepath.Join(gitDir, "HEAD")
+	if _, err := os.Stat(headPath); os.IsNotExist(err) {
+		head := "ref: refs/heads/" + branch + "\n"
+		if refFormat == RefFormatReftable {
+			if err := writeReftableStubs(gitDir); err != nil {
+				return nil, reinit, err
+			}
+			head = reftableStubHead
+		}
+		if err := writeFile(headPath, head); err != nil {
+			return nil, reinit, err
+		}
+	} else if err != nil {
+		return nil, reinit, err
+	} else if opts.Branch != "" {
+		fmt.Fprintf(os.Stderr, "warning: re-init: ignored --initial-branch=%s\n", opts.Branch)
+	}
+
+	configPath := filepath.Join(gitDir, "config")
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		version := format.RepositoryFormatVersion()
+		if refFormat != RefFormatFiles {
+			version = 1
+		}
+		cfg := fmt.Sprintf("[core]\n\trepositoryformatversion = %d\n\tfilemode = true\n\tbare = %t\n", version, opts.Bare)
+		if !opts.Bare {
+			cfg += "\tlogallrefupdates = true\n"
+		}
+		if format != hash.SHA1 || refFormat != RefFormatFiles {
+			cfg += "[extensions]\n"
+		}
+		if format != hash.SHA1 {
+			cfg += fmt.Sprintf("\tobjectformat = %s\n", format)
+		}
+		if refFormat != RefFormatFiles {
+			cfg += fmt.Sprintf("\trefstorage = %s\n", refFormat)
+		}
+		if err := writeFile(configPath, cfg); err != nil {
+			return nil, reinit, err
+		}
+	} else if err != nil {
+		return nil, reinit, err
+	}
+	// Like git, a shared repository refuses forced pushes, on re-init too.
+	if opts.Shared != "" && shared.Repository != shared.Umask {
+		f, err := config.ReadFile(configPath, config.ScopeLocal)
+		if err != nil {
+			return nil, reinit, err
+		}
+		if err := f.Set("core.sharedrepository", shared.Repository.ConfigValue(), false); err != nil {
+			return nil, reinit, err
+		}
+		if err := f.Set("receive.denyNonFastforwards", "true", false); err != nil {
+			return nil, reinit, err
+		}
+		if err := f.Save(); err != nil {
+			return nil, reinit, err
+		}
+	}
+
+	repo, err := open(gitDir, workTree, dir)
+	if err != nil {
+		return nil, reinit, err
+	}
+	// With reftable the real HEAD lives in the stack.
+	if _, err := repo.Refs().Read(refs.HEAD); refs.IsNotFound(err) {
+		if err := repo.Refs().SetSymbolic(refs.HEAD, "refs/heads/"+branch, ""); err != nil {
+			return nil, reinit, err
+		}
+	}
+	return repo, reinit, nil
+}
+
+// reftableStubHead is the HEAD file of a reftable repository. It keeps
+// the directory recognizable as a repository while making tools that
+// only know loose refs fail instead of misreading it.
+const reftableStubHead = "ref: refs/heads/.invalid\n"
+
+// writeReftableStubs turns refs/heads into a file for the same reason.
+func writeReftableStubs(gitDir string) error {
+	heads := filepath.Join(gitDir, "refs", "heads")
+	if err := shared.MkdirAll(filepath.Dir(heads)); err != nil {
+		return err
+	}
+	return writeFile(heads, "this repository uses the reftable format\n")
+}
+
+// writeFile writes a file of the git directory with the permissions of
+// the shared repository.
+func writeFile(path, contents string) error {
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		return err
+	}
+	return shared.Adjust(path)
+}
+
+// defaultRefFormat picks GIT_DEFAULT_REF_FORMAT or init.defaultRefFormat.
+func defaultRefFormat() (string, error) {
+	format := os.Getenv("GIT_DEFAULT_REF_FORMAT")
+	if format == "" {
+		if cfg, err := config.Load(""); err == nil {
+			format, _ = cfg.Get("init.defaultRefFormat")
+		}
+	}
+	switch format {
+	case "":
+		return RefFormatFiles, nil
+	case RefFormatFiles, RefFormatReftable:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown ref storage format '%s'", format)
+}
+
+// templateDir picks --template, $GIT_TEMPLATE_DIR or init.templateDir.
+func templateDir(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	if env := os.Getenv("GIT_TEMPLATE_DIR"); env != "" {
+		return env
+	}
+	if cfg, err := config.Load(""); err == nil {
+		if dir, found := cfg.Path("init.templateDir"); found {
+			return dir
+		}
+	}
+	return ""
+}
+
+// copyTemplate copies the template directory into the git directory
+// without overwriting anything that already exists.
+func copyTemplate(src, dst string) error {
+	if src == "" {
+		return nil
+	}
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "warning: templates not found in %s\n", src)
+		return nil
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			if err := shared.MkdirAll(target); err != nil {
+				return err
+			}
+			return shared.Adjust(target)
+		}
+		if _, err := os.Lstat(target); err == nil {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, contents, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return shared.Adjust(target)
+	})
+}
+
+func initDefaultBranch() string {
+	cfg, err := config.Load("")
+	if err != nil {
+		return defaultBranch
+	}
+	if branch, found := cfg.Get("init.defaultBranch"); found && branch != "" {
+		return branch
+	}
+	return defaultBranch
+}
+
+// validBranchName is a subset of git check-ref-format for branch names.
+func validBranchName(name string) bool {
+	if name == "" || name == "HEAD" || strings.HasPrefix(name, "-") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".lock") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") ||
+		strings.Contains(name, "@{") || strings.Contains(name, "//") {
+		return false
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return false
+		}
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
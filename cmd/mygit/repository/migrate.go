@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/shared"
+)
+
+type MigrateOptions struct {
+	// DryRun leaves the migrated refs in a scratch directory instead of
+	// switching the repository over.
+	DryRun bool
+	// Peel is passed on to the final pack of the new store.
+	Peel func(sha string) string
+}
+
+// MigrateRefs converts the refs and reflogs of the repository to another
+// ref format. The new store is built in a scratch directory inside the
+// git directory first; its path is returned.
+// ref: https://git-scm.com/docs/git-refs#_description
+func (r *Repository) MigrateRefs(format string, opts MigrateOptions) (string, error) {
+	if format != RefFormatFiles && format != RefFormatReftable {
+		return "", fmt.Errorf("unknown ref storage format '%s'", format)
+	}
+	if format == r.RefFormat {
+		return "", fmt.Errorf("repository already uses '%s' format", format)
+	}
+	tmp, err := ioutil.TempDir(r.GitDir, "ref_migration.")
+	if err != nil {
+		return "", err
+	}
+	if format == RefFormatReftable {
+		err = shared.MkdirAll(filepath.Join(tmp, "reftable"))
+	}
+	if err == nil {
+		err = r.copyRefs(r.newRefStore(format, tmp, "false"), opts.Peel)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	if opts.DryRun {
+		return tmp, nil
+	}
+	if err := r.switchRefs(format, tmp); err != nil {
+		return "", err
+	}
+	return tmp, os.RemoveAll(tmp)
+}
+
+// copyRefs writes every ref and reflog of the repository into store,
+// without logging the writes themselves.
+func (r *Repository) copyRefs(store refs.Store, peel func(string) string) error {
+	list, err := r.Refs().List("refs/")
+	if err != nil {
+		return err
+	}
+	if head, err := r.Refs().Read(refs.HEAD); err == nil {
+		list = append([]*refs.Ref{head}, list...)
+	} else if !refs.IsNotFound(err) {
+		return err
+	}
+	tx := store.NewTransaction()
+	symrefs := []*refs.Ref{}
+	for _, ref := range list {
+		if ref.Symref != "" {
+			symrefs = append(symrefs, ref)
+			continue
+		}
+		if err := tx.Create(ref.Name, ref.Target, "", true); err != nil {
+			tx.Abort()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, ref := range symrefs {
+		if err := store.SetSymbolic(ref.Name, ref.Symref, ""); err != nil {
+			return err
+		}
+	}
+
+	names, err := r.Refs().ListReflogs()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		entries, err := r.Refs().ReadReflog(name)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			err = store.CreateReflog(name)
+		} else {
+			err = store.WriteReflog(name, entries)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return store.Pack(refs.PackOptions{All: true, Peel: peel})
+}
+
+// switchRefs replaces the ref storage of the repository by the one built
+// in dir and records the new format in the config.
+func (r *Repository) switchRefs(format, dir string) error {
+	move := func(name string) error {
+		err := os.Rename(filepath.Join(dir, name), r.Path(name))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if format == RefFormatReftable {
+		for _, name := range []string{"refs", "packed-refs", "logs"} {
+			if err := os.RemoveAll(r.Path(name)); err != nil {
+				return err
+			}
+		}
+		if err := move("reftable"); err != nil {
+			return err
+		}
+		if err := writeReftableStubs(r.GitDir); err != nil {
+			return err
+		}
+		if err := writeFile(r.Path("HEAD"), reftableStubHead); err != nil {
+			return err
+		}
+	} else {
+		for _, name := range []string{"reftable", "refs"} {
+			if err := os.RemoveAll(r.Path(name)); err != nil {
+				return err
+			}
+		}
+		for _, name := range []string{"refs", "packed-refs", "logs", "HEAD"} {
+			if err := move(name); err != nil {
+				return err
+			}
+		}
+		for _, name := range []string{"refs/heads", "refs/tags"} {
+			if err := shared.MkdirAll(r.Path(name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	f, err := config.ReadFile(r.Path("config"), config.ScopeLocal)
+	if err != nil {
+		return err
+	}
+	if format == RefFormatReftable {
+		if err := f.Set("core.repositoryformatversion", "1", false); err != nil {
+			return err
+		}
+		err = f.Set("extensions.refstorage", format, false)
+	} else {
+		_, err = f.Unset("extensions.refstorage", false)
+		if _, found, _ := config.Lookup(r.Path("config"), "extensions", "objectformat"); err == nil && !found {
+			_, err = f.RemoveSection("extensions", "")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := f.Save(); err != nil {
+		return err
+	}
+	r.RefFormat, r.refs = format, nil
+	return nil
+}
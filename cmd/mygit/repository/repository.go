@@ -0,0 +1,307 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/shared"
+)
+
+const (
+	RefFormatFiles    = "files"
+	RefFormatReftable = "reftable"
+)
+
+var ErrNotFound = errors.New("not a git repository (or any of the parent directories): .git")
+
+// Repository is a discovered git directory and its working tree.
+type Repository struct {
+	GitDir   string // absolute path of the git directory
+	WorkTree string // absolute path of the working tree, "" when bare
+	Prefix   string // current directory relative to WorkTree, slash separated
+	Format   hash.Algo
+	// RefFormat is the ref backend, "files" or "reftable"
+	// (extensions.refStorage).
+	RefFormat string
+
+	objects *object.Store
+	refs    refs.Store
+}
+
+// Path joins elem to the git directory.
+func (r *Repository) Path(elem ...string) string {
+	return filepath.Join(append([]string{r.GitDir}, elem...)...)
+}
+
+// ObjectsDir honors GIT_OBJECT_DIRECTORY like git does.
+func (r *Repository) ObjectsDir() string {
+	if dir := os.Getenv("GIT_OBJECT_DIRECTORY"); dir != "" {
+		return dir
+	}
+	return r.Path("objects")
+}
+
+// IndexFile honors GIT_INDEX_FILE like git does.
+func (r *Repository) IndexFile() string {
+	if file := os.Getenv("GIT_INDEX_FILE"); file != "" {
+		return file
+	}
+	return r.Path("index")
+}
+
+// Index reads the index of the repository.
+func (r *Repository) Index() (*index.Index, error) {
+	return index.Read(r.IndexFile(), r.Format)
+}
+
+// Objects returns the object database of the repository.
+func (r *Repository) Objects() *object.Store {
+	if r.objects == nil {
+		r.objects = object.NewStore(r.ObjectsDir(), r.Format)
+	}
+	return r.objects
+}
+
+// Refs returns the ref store of the repository.
+func (r *Repository) Refs() refs.Store {
+	if r.refs == nil {
+		r.refs = r.newRefStore(r.RefFormat, r.GitDir, r.logRefUpdates())
+	}
+	return r.refs
+}
+
+// logRefUpdates reads core.logAllRefUpdates as "true", "false" or
+// "always". Reflogs are on by default, except in bare repositories.
+func (r *Repository) logRefUpdates() string {
+	logRefUpdates := "false"
+	if !r.IsBare() {
+		logRefUpdates = "true"
+	}
+	if cfg, err := r.Config(); err == nil {
+		if value, ok := cfg.Get("core.logallrefupdates"); ok {
+			if strings.EqualFold(value, "always") {
+				logRefUpdates = "always"
+			} else if b, err := config.ParseBool(value, false); err == nil {
+				logRefUpdates = strconv.FormatBool(b)
+			}
+		}
+	}
+	return logRefUpdates
+}
+
+// newRefStore creates a backend of the given format rooted at gitDir.
+func (r *Repository) newRefStore(format, gitDir, logRefUpdates string) refs.Store {
+	if format == RefFormatReftable {
+		store := refs.NewReftable(gitDir, r.Format)
+		store.Committer, store.LogRefUpdates = r.Committer, logRefUpdates
+		return store
+	}
+	store := refs.NewFiles(gitDir, r.Format)
+	store.Committer, store.LogRefUpdates = r.Committer, logRefUpdates
+	return store
+}
+
+// Config loads every config scope as seen from this repository.
+func (r *Repository) Config() (*config.Config, error) {
+	return config.Load(r.GitDir)
+}
+
+func (r *Repository) IsBare() bool {
+	return r.WorkTree == ""
+}
+
+// Discover finds the repository for the current directory. GIT_DIR and
+// GIT_WORK_TREE take precedence; otherwise parent directories are searched
+// up to GIT_CEILING_DIRECTORIES or a filesystem boundary.
+// ref: https://git-scm.com/docs/git#_the_git_repository
+func Discover() (*Repository, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if gitDir := os.Getenv("GIT_DIR"); gitDir != "" {
+		gitDir, err := resolveGitDir(absPath(cwd, gitDir))
+		if err != nil {
+			return nil, err
+		}
+		if !isGitDir(gitDir) {
+			return nil, fmt.Errorf("not a git repository: '%s'", os.Getenv("GIT_DIR"))
+		}
+		// Without GIT_WORK_TREE or core.worktree the current directory is
+		// the top of the working tree.
+		return open(gitDir, cwd, cwd)
+	}
+
+	ceilings := ceilingDirectories()
+	acrossFS := strings.EqualFold(os.Getenv("GIT_DISCOVERY_ACROSS_FILESYSTEM"), "true") ||
+		os.Getenv("GIT_DISCOVERY_ACROSS_FILESYSTEM") == "1"
+	dir := cwd
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if gitDir, err := resolveGitDir(dotGit); err == nil && isGitDir(gitDir) {
+			return open(gitDir, dir, cwd)
+		}
+		if isGitDir(dir) {
+			// Bare repository, or we're somewhere inside .git.
+			return open(dir, "", cwd)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || ceilings[parent] {
+			return nil, ErrNotFound
+		}
+		if !acrossFS && !sameFilesystem(dir, parent) {
+			return nil, fmt.Errorf("not a git repository (or any parent up to mount point %s)\nStopping at filesystem boundary (GIT_DISCOVERY_ACROSS_FILESYSTEM not set).", dir)
+		}
+		dir = parent
+	}
+}
+
+// Open opens the repository at gitDir without searching for it, for
+// commands like clone that have just created it.
+func Open(gitDir string) (*Repository, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	gitDir = absPath(cwd, gitDir)
+	workTree := ""
+	if filepath.Base(gitDir) == ".git" {
+		workTree = filepath.Dir(gitDir)
+	}
+	return open(gitDir, workTree, cwd)
+}
+
+func open(gitDir, defaultWorkTree, cwd string) (*Repository, error) {
+	configPath := filepath.Join(gitDir, "config")
+	version, _, err := config.Lookup(configPath, "core", "repositoryformatversion")
+	if err != nil {
+		return nil, err
+	}
+	if version != "" && version != "0" && version != "1" {
+		return nil, fmt.Errorf("expected git repo version <= 1, found %s", version)
+	}
+	format := hash.SHA1
+	if name, found, err := config.Lookup(configPath, "extensions", "objectformat"); err != nil {
+		return nil, err
+	} else if found {
+		if version != "1" {
+			return nil, errors.New("extensions.objectformat requires core.repositoryformatversion=1")
+		}
+		if format, err = hash.ByName(name); err != nil {
+			return nil, err
+		}
+	}
+
+	refFormat := RefFormatFiles
+	if name, found, err := config.Lookup(configPath, "extensions", "refstorage"); err != nil {
+		return nil, err
+	} else if found {
+		if version != "1" {
+			return nil, errors.New("extensions.refstorage requires core.repositoryformatversion=1")
+		}
+		if name != RefFormatFiles && name != RefFormatReftable {
+			return nil, fmt.Errorf("invalid value for 'extensions.refstorage': '%s'", name)
+		}
+		refFormat = name
+	}
+
+	workTree := defaultWorkTree
+	if bare, _, err := config.Lookup(configPath, "core", "bare"); err != nil {
+		return nil, err
+	} else if bare == "true" {
+		workTree = ""
+	}
+	if wt, found, err := config.Lookup(configPath, "core", "worktree"); err != nil {
+		return nil, err
+	} else if found {
+		workTree = absPath(gitDir, wt)
+	}
+	if wt := os.Getenv("GIT_WORK_TREE"); wt != "" {
+		workTree = absPath(cwd, wt)
+	}
+
+	shared.Repository = shared.Umask
+	if value, found, err := config.Lookup(configPath, "core", "sharedrepository"); err != nil {
+		return nil, err
+	} else if found {
+		if shared.Repository, err = shared.Parse(value); err != nil {
+			return nil, err
+		}
+	}
+
+	repo := &Repository{GitDir: gitDir, WorkTree: workTree, Format: format, RefFormat: refFormat}
+	if workTree != "" {
+		if rel, err := filepath.Rel(workTree, cwd); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			repo.Prefix = filepath.ToSlash(rel)
+		}
+	}
+	return repo, nil
+}
+
+// resolveGitDir follows a ".git" file of the form "gitdir: <path>".
+func resolveGitDir(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return path, nil
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimRight(string(contents), "\r\n")
+	if !strings.HasPrefix(line, "gitdir: ") {
+		return "", fmt.Errorf("invalid gitfile format: %s", path)
+	}
+	return absPath(filepath.Dir(path), strings.TrimPrefix(line, "gitdir: ")), nil
+}
+
+// isGitDir checks for the minimum git needs: HEAD, objects and refs.
+func isGitDir(dir string) bool {
+	if info, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil || info.IsDir() {
+		return false
+	}
+	commonDir := dir
+	if contents, err := ioutil.ReadFile(filepath.Join(dir, "commondir")); err == nil {
+		commonDir = absPath(dir, strings.TrimSpace(string(contents)))
+	}
+	for _, sub := range []string{"objects", "refs"} {
+		if info, err := os.Stat(filepath.Join(commonDir, sub)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+func ceilingDirectories() map[string]bool {
+	ceilings := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("GIT_CEILING_DIRECTORIES")) {
+		if dir == "" || !filepath.IsAbs(dir) {
+			continue
+		}
+		ceilings[filepath.Clean(dir)] = true
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			ceilings[resolved] = true
+		}
+	}
+	return ceilings
+}
+
+func absPath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
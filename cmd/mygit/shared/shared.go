@@ -0,0 +1,131 @@
+// Package shared applies core.sharedRepository to the files and
+// directories written into a repository, as git's adjust_shared_perm does.
+// ref: https://git-scm.com/docs/git-config#Documentation/git-config.txt-coresharedRepository
+package shared
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Perm is a parsed core.sharedRepository. Positive values are bits added
+// to the umask permissions, negative ones the exact permissions wanted.
+type Perm int
+
+const (
+	Umask     Perm = 0
+	Group     Perm = 0660
+	Everybody Perm = 0664
+)
+
+// Repository is the setting of the repository being worked on. It is set
+// when the repository is opened or initialized.
+var Repository Perm
+
+// Parse reads a core.sharedRepository or "init --shared" value like
+// git_config_perm: "group", "all", "umask", a boolean, "0", "1", "2" or
+// an octal mode.
+func Parse(value string) (Perm, error) {
+	switch strings.ToLower(value) {
+	case "umask", "false", "no", "off":
+		return Umask, nil
+	case "", "group", "true", "yes", "on":
+		return Group, nil
+	case "all", "world", "everybody":
+		return Everybody, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad boolean config value '%s' for 'core.sharedrepository'", value)
+	}
+	switch mode {
+	case 0:
+		return Umask, nil
+	case 1:
+		return Group, nil
+	case 2:
+		return Everybody, nil
+	}
+	if mode&0600 != 0600 {
+		return 0, fmt.Errorf("problem with core.sharedRepository filemode value (0%.3o).\nThe owner of files must always have read and write permissions.", mode)
+	}
+	return -Perm(mode & 0666), nil
+}
+
+// ConfigValue is how init records p: the old numbers for group and
+// everybody, so that older versions can read it, and octal otherwise.
+func (p Perm) ConfigValue() string {
+	switch {
+	case p < 0:
+		return fmt.Sprintf("0%o", int(-p))
+	case p == Group:
+		return "1"
+	case p == Everybody:
+		return "2"
+	}
+	return "0"
+}
+
+// mode is calc_shared_perm: the permissions of a file of the given mode
+// in a repository shared as p.
+func (p Perm) mode(mode os.FileMode) os.FileMode {
+	tweak := os.FileMode(p)
+	if p < 0 {
+		tweak = os.FileMode(-p)
+	}
+	if mode&0200 == 0 {
+		tweak &^= 0222
+	}
+	if mode&0100 != 0 {
+		tweak |= (tweak & 0444) >> 2
+	}
+	if p < 0 {
+		return mode&^0777 | tweak
+	}
+	return mode | tweak
+}
+
+// Adjust gives path the permissions of the shared repository; it does
+// nothing in a repository that isn't shared. Directories also get the
+// setgid bit so that their files keep the group.
+func Adjust(path string) error {
+	if Repository == Umask {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	old := info.Mode() & (os.ModePerm | os.ModeSetgid)
+	mode := Repository.mode(old)
+	if info.IsDir() {
+		mode |= (mode & 0444) >> 2
+		mode |= os.ModeSetgid
+	}
+	if mode == old {
+		return nil
+	}
+	return os.Chmod(path, mode)
+}
+
+// MkdirAll is os.MkdirAll that adjusts each directory it creates.
+func MkdirAll(dir string) error {
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := MkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		if info, statErr := os.Stat(dir); statErr != nil || !info.IsDir() {
+			return err
+		}
+		return nil
+	}
+	return Adjust(dir)
+}
@@ -0,0 +1,69 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The expected modes are the ones git gives HEAD, loose objects and
+// directories in a repository made by "git init --shared=<value>".
+func TestAdjust(t *testing.T) {
+	defer func(p Perm) { Repository = p }(Repository)
+	for _, tt := range []struct {
+		value          string
+		file, obj, dir os.FileMode
+	}{
+		{"group", 0664, 0444, os.ModeSetgid | 0775},
+		{"all", 0664, 0444, os.ModeSetgid | 0775},
+		{"0660", 0660, 0440, os.ModeSetgid | 0770},
+		{"0640", 0640, 0440, os.ModeSetgid | 0750},
+	} {
+		var err error
+		if Repository, err = Parse(tt.value); err != nil {
+			t.Fatalf("Parse(%q): %v", tt.value, err)
+		}
+		dir := t.TempDir()
+		file, obj, sub := filepath.Join(dir, "HEAD"), filepath.Join(dir, "obj"), filepath.Join(dir, "a", "b")
+		for path, mode := range map[string]os.FileMode{file: 0644, obj: 0444} {
+			if err := os.WriteFile(path, nil, mode); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, mode); err != nil {
+				t.Fatal(err)
+			}
+			if err := Adjust(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := MkdirAll(sub); err != nil {
+			t.Fatal(err)
+		}
+		for path, want := range map[string]os.FileMode{file: tt.file, obj: tt.obj, sub: tt.dir, filepath.Dir(sub): tt.dir} {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.Mode() & (os.ModePerm | os.ModeSetgid); got != want {
+				t.Errorf("--shared=%s: %s is %v, want %v", tt.value, filepath.Base(path), got, want)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for value, want := range map[string]string{
+		"group": "1", "true": "1", "1": "1", "all": "2", "everybody": "2", "2": "2",
+		"umask": "0", "false": "0", "0": "0", "0660": "0660", "0775": "0664",
+	} {
+		p, err := Parse(value)
+		if err != nil || p.ConfigValue() != want {
+			t.Errorf("Parse(%q) = %s, %v; want %s", value, p.ConfigValue(), err, want)
+		}
+	}
+	for _, value := range []string{"0400", "foo"} {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("Parse(%q) succeeded", value)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package unpack
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// ReadTree lists the files, symlinks and submodules of a tree as stage 0
+// index entries without stat data, in index order. An empty sha is the
+// empty tree.
+func ReadTree(store *object.Store, sha string) ([]*index.Entry, error) {
+	entries := []*index.Entry{}
+	if sha == "" {
+		return entries, nil
+	}
+	if err := readTree(store, sha, "", &entries); err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+func readTree(store *object.Store, sha, base string, entries *[]*index.Entry) error {
+	contents, err := store.ReadType(sha, "tree")
+	if err != nil {
+		return err
+	}
+	tree, err := object.ParseTree(contents, store.Algo)
+	if err != nil {
+		return err
+	}
+	for _, e := range tree {
+		path := base + e.Name
+		if e.IsTree() {
+			if err := readTree(store, e.Sha, path+"/", entries); err != nil {
+				return err
+			}
+			continue
+		}
+		*entries = append(*entries, &index.Entry{Mode: treeMode(e.Mode), Sha: e.Sha, Path: path})
+	}
+	return nil
+}
+
+// treeMode is the index mode of a tree entry. Old trees may record any
+// permission bits on files, which only keep their executable bit.
+func treeMode(mode string) uint32 {
+	m, _ := strconv.ParseUint(mode, 8, 32)
+	switch {
+	case m == 0120000, m == 0160000:
+		return uint32(m)
+	case m&0100 != 0:
+		return 0100755
+	}
+	return 0100644
+}
+
+// WriteTree writes the tree objects holding stage 0 entries, which
+// must be in index order, and returns the name of the top one.
+// ref: cache_tree_update in https://github.com/git/git/blob/master/cache-tree.c
+func WriteTree(store *object.Store, entries []*index.Entry) (string, error) {
+	sha, _, err := writeTree(store, entries, "")
+	return sha, err
+}
+
+// writeTree writes the subtree of the entries starting with base and
+// returns its name and the number of entries it took.
+func writeTree(store *object.Store, entries []*index.Entry, base string) (string, int, error) {
+	tree := []object.TreeEntry{}
+	i := 0
+	for i < len(entries) && strings.HasPrefix(entries[i].Path, base) {
+		e := entries[i]
+		name := e.Path[len(base):]
+		if slash := strings.IndexByte(name, '/'); slash >= 0 {
+			sha, n, err := writeTree(store, entries[i:], base+name[:slash+1])
+			if err != nil {
+				return "", 0, err
+			}
+			tree = append(tree, object.TreeEntry{Mode: "40000", Name: name[:slash], Sha: sha})
+			i += n
+			continue
+		}
+		if e.Stage != 0 {
+			return "", 0, fmt.Errorf("%s: unmerged (%s)", e.Path, e.Sha)
+		}
+		tree = append(tree, object.TreeEntry{Mode: fmt.Sprintf("%o", e.Mode), Name: name, Sha: e.Sha})
+		i++
+	}
+	contents, err := object.TreeBytes(tree)
+	if err != nil {
+		return "", 0, err
+	}
+	sha, err := store.Write("tree", contents)
+	return sha, i, err
+}
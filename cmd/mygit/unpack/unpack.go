@@ -0,0 +1,454 @@
+// Package unpack moves the index and the work tree from one tree to
+// another, as checkout does: local changes that don't get in the way are
+// kept, and nothing is changed if some would be lost.
+// ref: https://github.com/git/git/blob/master/unpack-trees.c
+package unpack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// Options tell how to move to the new tree.
+type Options struct {
+	Store *object.Store
+	// WorkTree is updated along with the index, unless it is "".
+	WorkTree string
+	// Reset throws local changes and untracked files in the way away
+	// instead of refusing to lose them, as "checkout -f" does.
+	Reset bool
+	// Initial is set when there is no index yet, as after a clone: the
+	// paths missing from it aren't staged deletions.
+	Initial bool
+	// Ignored reports whether an untracked path may be overwritten.
+	Ignored func(path string, isDir bool) bool
+	// Action is the command named in the errors, "checkout" or "merge".
+	Action string
+}
+
+// Error lists the paths whose local changes a move would lose.
+type Error struct {
+	Action      string
+	Overwritten []string // tracked files changed in the index
+	NotUptodate []string // tracked files changed in the work tree
+	Dirs        []string // directories with untracked files
+	Untracked   []string // untracked files that would be overwritten
+	Removed     []string // untracked files that would be removed
+}
+
+// Messages are the explanations of the error as git gives them, one for
+// each kind of path.
+// ref: setup_unpack_trees_porcelain in https://github.com/git/git/blob/master/unpack-trees.c
+func (e *Error) Messages() []string {
+	advice := e.Action
+	switch e.Action {
+	case "checkout":
+		advice = "switch branches"
+	case "":
+		advice = "checkout"
+	}
+	action := e.Action
+	if action == "" {
+		action = "checkout"
+	}
+	list := func(paths []string) string {
+		s := ""
+		for _, p := range paths {
+			s += "\t" + p + "\n"
+		}
+		return s
+	}
+	msgs := []string{}
+	for _, paths := range [][]string{e.Overwritten, e.NotUptodate} {
+		if len(paths) > 0 {
+			msgs = append(msgs, fmt.Sprintf("Your local changes to the following files would be overwritten by %s:\n%sPlease commit your changes or stash them before you %s.", action, list(paths), advice))
+		}
+	}
+	if len(e.Dirs) > 0 {
+		msgs = append(msgs, "Updating the following directories would lose untracked files in them:\n"+list(e.Dirs))
+	}
+	if len(e.Untracked) > 0 {
+		msgs = append(msgs, fmt.Sprintf("The following untracked working tree files would be overwritten by %s:\n%sPlease move or remove them before you %s.", action, list(e.Untracked), advice))
+	}
+	if len(e.Removed) > 0 {
+		msgs = append(msgs, fmt.Sprintf("The following untracked working tree files would be removed by %s:\n%sPlease move or remove them before you %s.", action, list(e.Removed), advice))
+	}
+	return msgs
+}
+
+func (e *Error) Error() string {
+	return strings.Join(e.Messages(), "\n")
+}
+
+func (e *Error) empty() bool {
+	return len(e.Overwritten)+len(e.NotUptodate)+len(e.Dirs)+len(e.Untracked)+len(e.Removed) == 0
+}
+
+// unpacker collects the new entries and the changes to the work tree.
+type unpacker struct {
+	idx     *index.Index
+	opts    Options
+	entries []*index.Entry
+	updates []*index.Entry // entries whose files are written
+	removes []string       // paths whose files are deleted
+	err     *Error
+}
+
+// TwoWay moves the index from oldTree, the tree of HEAD, to newTree, and
+// the work tree with it unless opts say otherwise. Each path either
+// keeps its index entry, when that is what both trees agree on or what
+// the new tree has, or takes the entry of the new tree if the index and
+// the work tree still have the old one. Anything else is refused: an
+// *Error lists the paths, and neither the index nor the work tree is
+// changed. The caller writes the index.
+// ref: twoway_merge in https://github.com/git/git/blob/master/unpack-trees.c
+func TwoWay(idx *index.Index, oldTree, newTree string, opts Options) error {
+	olds, err := ReadTree(opts.Store, oldTree)
+	if err != nil {
+		return err
+	}
+	news, err := ReadTree(opts.Store, newTree)
+	if err != nil {
+		return err
+	}
+	u := &unpacker{idx: idx, opts: opts, err: &Error{Action: opts.Action}}
+	oldByPath, newByPath := byPath(olds), byPath(news)
+	current := map[string][]*index.Entry{}
+	paths := []string{}
+	for _, e := range idx.Entries {
+		if current[e.Path] == nil {
+			paths = append(paths, e.Path)
+		}
+		current[e.Path] = append(current[e.Path], e)
+	}
+	for _, list := range [][]*index.Entry{olds, news} {
+		for _, e := range list {
+			if current[e.Path] == nil && (oldByPath[e.Path] == e || oldByPath[e.Path] == nil) {
+				paths = append(paths, e.Path)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := u.twoWay(current[path], oldByPath[path], newByPath[path]); err != nil {
+			return err
+		}
+	}
+	if !u.err.empty() {
+		return u.err
+	}
+	return u.apply()
+}
+
+// OneWay moves the index to tree, as "reset --merge" does: paths the
+// index has as the tree does keep their local changes, and the others,
+// conflicts included, take the entry of the tree unless a local change
+// to their file would be lost. With opts.Reset, everything takes the
+// entry of the tree. The caller writes the index.
+// ref: oneway_merge in https://github.com/git/git/blob/master/unpack-trees.c
+func OneWay(idx *index.Index, tree string, opts Options) error {
+	news, err := ReadTree(opts.Store, tree)
+	if err != nil {
+		return err
+	}
+	u := &unpacker{idx: idx, opts: opts, err: &Error{Action: opts.Action}}
+	newByPath := byPath(news)
+	current := map[string][]*index.Entry{}
+	paths := []string{}
+	for _, e := range idx.Entries {
+		if current[e.Path] == nil {
+			paths = append(paths, e.Path)
+		}
+		current[e.Path] = append(current[e.Path], e)
+	}
+	for _, e := range news {
+		if current[e.Path] == nil {
+			paths = append(paths, e.Path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		cur, new := current[path], newByPath[path]
+		switch {
+		case opts.Reset:
+			err = u.reset(cur, new)
+		case len(cur) > 0 && cur[0].Stage > 0:
+			if new == nil {
+				u.removes = append(u.removes, path)
+			} else {
+				err = u.merged(new, nil)
+			}
+		case new == nil:
+			err = u.deleted(cur[0], cur[0])
+		case len(cur) > 0 && same(cur[0], new):
+			u.entries = append(u.entries, cur[0])
+		case len(cur) > 0:
+			err = u.merged(new, cur[0])
+		default:
+			err = u.merged(new, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !u.err.empty() {
+		return u.err
+	}
+	return u.apply()
+}
+
+func byPath(entries []*index.Entry) map[string]*index.Entry {
+	m := map[string]*index.Entry{}
+	for _, e := range entries {
+		m[e.Path] = e
+	}
+	return m
+}
+
+// same tells whether two entries, either of which may be missing, have
+// the same mode and contents.
+func same(a, b *index.Entry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Mode == b.Mode && a.Sha == b.Sha
+}
+
+// twoWay decides one path from its index entries, at all stages, and
+// its entries in the old and the new tree.
+func (u *unpacker) twoWay(current []*index.Entry, old, new *index.Entry) error {
+	if u.opts.Reset {
+		return u.reset(current, new)
+	}
+	if len(current) == 0 {
+		switch {
+		case new == nil:
+			return u.deleted(old, nil)
+		case old != nil && !u.opts.Initial:
+			// The deletion of the path is staged.
+			if !same(old, new) {
+				u.err.Overwritten = append(u.err.Overwritten, new.Path)
+			}
+			return nil
+		}
+		return u.merged(new, nil)
+	}
+	cur := current[0]
+	if cur.Stage > 0 {
+		if !same(old, new) {
+			u.err.Overwritten = append(u.err.Overwritten, cur.Path)
+			return nil
+		}
+		if new == nil {
+			u.removes = append(u.removes, cur.Path)
+			return nil
+		}
+		return u.merged(new, nil)
+	}
+	switch {
+	case old == nil && new == nil, // 4 and 5
+		old == nil && same(cur, new),               // 6 and 7
+		old != nil && new != nil && same(old, new), // 14 and 15
+		old != nil && new != nil && same(cur, new): // 18 and 19
+		u.entries = append(u.entries, cur)
+		return nil
+	case old != nil && new == nil && same(cur, old): // 10 and 11
+		return u.deleted(old, cur)
+	case old != nil && new != nil && same(cur, old): // 20 and 21
+		return u.merged(new, cur)
+	}
+	u.err.Overwritten = append(u.err.Overwritten, cur.Path)
+	return nil
+}
+
+// merged takes the entry of the new tree in place of cur, which must
+// be clean; with no entry in the index, nothing untracked must be lost.
+// ref: merged_entry in https://github.com/git/git/blob/master/unpack-trees.c
+func (u *unpacker) merged(new, cur *index.Entry) error {
+	e := *new
+	if cur == nil {
+		if err := u.verifyAbsent(e.Path, false); err != nil {
+			return err
+		}
+	} else if ok, err := u.verifyUptodate(cur); err != nil || !ok {
+		return err
+	}
+	u.entries = append(u.entries, &e)
+	u.updates = append(u.updates, &e)
+	return nil
+}
+
+// deleted drops the entry of a path the new tree doesn't have.
+// ref: deleted_entry in https://github.com/git/git/blob/master/unpack-trees.c
+func (u *unpacker) deleted(old, cur *index.Entry) error {
+	if cur == nil {
+		return u.verifyAbsent(old.Path, true)
+	}
+	if ok, err := u.verifyUptodate(cur); err != nil || !ok {
+		return err
+	}
+	u.removes = append(u.removes, cur.Path)
+	return nil
+}
+
+// reset makes a path what the new tree has, rewriting its file unless
+// it already matches.
+// ref: oneway_merge in https://github.com/git/git/blob/master/unpack-trees.c
+func (u *unpacker) reset(current []*index.Entry, new *index.Entry) error {
+	if new == nil {
+		if len(current) > 0 {
+			u.removes = append(u.removes, current[0].Path)
+		}
+		return nil
+	}
+	if len(current) > 0 && current[0].Stage == 0 && same(current[0], new) {
+		cur := current[0]
+		u.entries = append(u.entries, cur)
+		if u.opts.WorkTree == "" {
+			return nil
+		}
+		_, err := os.Lstat(filepath.Join(u.opts.WorkTree, filepath.FromSlash(cur.Path)))
+		ok, cerr := Clean(u.idx, cur, u.opts.WorkTree, u.opts.Store.Algo)
+		if cerr != nil {
+			return cerr
+		}
+		if err != nil || !ok {
+			u.updates = append(u.updates, cur)
+		}
+		return nil
+	}
+	e := *new
+	u.entries = append(u.entries, &e)
+	u.updates = append(u.updates, &e)
+	return nil
+}
+
+// verifyUptodate reports whether the file of an index entry can be
+// overwritten or removed, and lists it as an error if not.
+func (u *unpacker) verifyUptodate(cur *index.Entry) (bool, error) {
+	if u.opts.WorkTree == "" {
+		return true, nil
+	}
+	ok, err := Clean(u.idx, cur, u.opts.WorkTree, u.opts.Store.Algo)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		u.err.NotUptodate = append(u.err.NotUptodate, cur.Path)
+	}
+	return ok, nil
+}
+
+// tracked tells whether the index has path at any stage.
+func (u *unpacker) tracked(path string) bool {
+	return u.idx.Find(path, 0) != nil || u.idx.Unmerged(path)
+}
+
+// verifyAbsent checks that writing or removing a path the index doesn't
+// have loses no untracked file, be it at the path, in a directory there,
+// or in the way of a leading directory.
+// ref: verify_absent in https://github.com/git/git/blob/master/unpack-trees.c
+func (u *unpacker) verifyAbsent(path string, removed bool) error {
+	if u.opts.WorkTree == "" {
+		return nil
+	}
+	reject := func(p string) {
+		if removed {
+			u.err.Removed = append(u.err.Removed, p)
+		} else {
+			u.err.Untracked = append(u.err.Untracked, p)
+		}
+	}
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		lead := strings.Join(parts[:i], "/")
+		info, err := os.Lstat(filepath.Join(u.opts.WorkTree, filepath.FromSlash(lead)))
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			continue
+		}
+		if !u.tracked(lead) && !u.ignored(lead, false) {
+			reject(lead)
+		}
+		return nil
+	}
+	name := filepath.Join(u.opts.WorkTree, filepath.FromSlash(path))
+	info, err := os.Lstat(name)
+	if err != nil || u.tracked(path) {
+		return nil
+	}
+	if !info.IsDir() {
+		if !u.ignored(path, false) {
+			reject(path)
+		}
+		return nil
+	}
+	if u.ignored(path, true) {
+		return nil
+	}
+	// A directory may go if git knows all of its files.
+	lost := false
+	err = filepath.Walk(name, func(p string, info os.FileInfo, err error) error {
+		if err != nil || lost {
+			return err
+		}
+		rel, err := filepath.Rel(u.opts.WorkTree, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if p != name && u.ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !u.tracked(rel) && !u.ignored(rel, false) {
+			lost = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if lost {
+		u.err.Dirs = append(u.err.Dirs, path)
+	}
+	return nil
+}
+
+func (u *unpacker) ignored(path string, isDir bool) bool {
+	return u.opts.Ignored != nil && u.opts.Ignored(path, isDir)
+}
+
+// apply removes and writes the files and gives the index its new
+// entries.
+// ref: check_updates in https://github.com/git/git/blob/master/unpack-trees.c
+func (u *unpacker) apply() error {
+	if u.opts.WorkTree != "" {
+		for _, path := range u.removes {
+			if err := RemoveFile(u.opts.WorkTree, path); err != nil {
+				return err
+			}
+		}
+		for _, e := range u.updates {
+			if err := CheckoutEntry(u.opts.Store, u.opts.WorkTree, e); err != nil {
+				return err
+			}
+		}
+	}
+	u.idx.Entries = u.entries
+	// The cache tree and the like describe the old entries.
+	u.idx.Extensions = nil
+	return nil
+}
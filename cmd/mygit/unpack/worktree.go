@@ -0,0 +1,133 @@
+package unpack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// Clean reports whether the work tree file of an entry can be replaced
+// or removed without losing anything: it is missing, or has the contents
+// and mode the entry records.
+// ref: verify_uptodate in https://github.com/git/git/blob/master/unpack-trees.c
+func Clean(idx *index.Index, e *index.Entry, workTree string, algo hash.Algo) (bool, error) {
+	name := filepath.Join(workTree, filepath.FromSlash(e.Path))
+	info, err := os.Lstat(name)
+	if err != nil {
+		return true, nil
+	}
+	if e.Mode == 0160000 {
+		return info.IsDir(), nil
+	}
+	if info.IsDir() {
+		return false, nil
+	}
+	if !e.AssumeValid && !e.SkipWorktree && idx.StatMatches(e, info) {
+		return true, nil
+	}
+	return index.SameContents(e, name, info, algo)
+}
+
+// CheckoutEntry writes the blob of an entry to the work tree, replacing
+// whatever is at its path, and records the stat data of the new file in
+// the entry. A submodule only gets an empty directory.
+// ref: checkout_entry in https://github.com/git/git/blob/master/entry.c
+func CheckoutEntry(store *object.Store, workTree string, e *index.Entry) error {
+	name := filepath.Join(workTree, filepath.FromSlash(e.Path))
+	if err := makeLeadingDirs(workTree, e.Path); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(name); err == nil {
+		if info.IsDir() && e.Mode == 0160000 {
+			e.SetStat(info)
+			return nil
+		}
+		if err := os.RemoveAll(name); err != nil {
+			return err
+		}
+	}
+	switch e.Mode {
+	case 0160000:
+		if err := os.Mkdir(name, 0777); err != nil {
+			return err
+		}
+	case 0120000:
+		target, err := store.ReadType(e.Sha, "blob")
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(filepath.FromSlash(string(target)), name); err != nil {
+			return err
+		}
+	default:
+		data, err := store.ReadType(e.Sha, "blob")
+		if err != nil {
+			return err
+		}
+		perm := os.FileMode(0666)
+		if e.Mode == 0100755 {
+			perm = 0777
+		}
+		if err := ioutil.WriteFile(name, data, perm); err != nil {
+			return err
+		}
+	}
+	info, err := os.Lstat(name)
+	if err != nil {
+		return err
+	}
+	e.SetStat(info)
+	return nil
+}
+
+// makeLeadingDirs creates the directories leading to path. A file in
+// the way of one of them is removed; callers check that it may be.
+func makeLeadingDirs(workTree, path string) error {
+	dir := workTree
+	parts := strings.Split(path, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if err == nil && info.IsDir() {
+			continue
+		}
+		if err == nil {
+			if err := os.Remove(dir); err != nil {
+				return err
+			}
+		}
+		if err := os.Mkdir(dir, 0777); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveFile deletes the work tree file of path and then the directories
+// it leaves empty.
+// ref: unlink_entry in https://github.com/git/git/blob/master/entry.c
+func RemoveFile(workTree, path string) error {
+	name := filepath.Join(workTree, filepath.FromSlash(path))
+	info, err := os.Lstat(name)
+	if err != nil {
+		// Missing, or a file took the place of a leading directory.
+		return nil
+	}
+	if info.IsDir() {
+		// A submodule is only removed when nothing was checked out in it.
+		os.Remove(name)
+	} else if err := os.Remove(name); err != nil {
+		return err
+	}
+	for dir := filepath.Dir(name); dir != filepath.Clean(workTree) && strings.HasPrefix(dir, workTree); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/hash"
 )
 
 func GetDireFilePathsWalk() ([]string, []string, error) {
@@ -39,20 +41,18 @@ func GetDireFilePathsWalk() ([]string, []string, error) {
 	return filePaths, direPath, nil
 }
 
-func GetHashByBlob(blob []byte) string {
-	sha := sha1.Sum(blob)
-	sha1Hex := fmt.Sprintf("%x", sha)
-	return sha1Hex
+func GetHashByBlob(algo hash.Algo, blob []byte) string {
+	return algo.Sum(blob)
 }
 
-func GetHashByFileName(fileName string) (string, error) {
+func GetHashByFileName(algo hash.Algo, fileName string) (string, error) {
 	blobData, err := GetBlobDataByFileName(fileName)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error get blob: %s\n", err)
 	}
 
 	// SHA-1ハッシュの計算
-	sha1Hex := GetHashByBlob(blobData)
+	sha1Hex := GetHashByBlob(algo, blobData)
 	return sha1Hex, nil
 }
 
@@ -0,0 +1,44 @@
+package walk
+
+// Dated is anything a Queue can hold: a commit with its committer date.
+type Dated interface {
+	CommitDate() int64
+}
+
+// Queue is a container/heap of commits that pops the most recent one
+// first; commits with the same date come out in the order they went in,
+// like git's prio_queue ordered by compare_commits_by_commit_date.
+// ref: https://github.com/git/git/blob/master/prio-queue.c
+type Queue struct {
+	items []Dated
+	seqs  []int
+	seq   int
+}
+
+func (q *Queue) Len() int { return len(q.items) }
+func (q *Queue) Less(i, j int) bool {
+	if a, b := q.items[i].CommitDate(), q.items[j].CommitDate(); a != b {
+		return a > b
+	}
+	return q.seqs[i] < q.seqs[j]
+}
+func (q *Queue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.seqs[i], q.seqs[j] = q.seqs[j], q.seqs[i]
+}
+func (q *Queue) Push(x interface{}) {
+	q.seq++
+	q.items = append(q.items, x.(Dated))
+	q.seqs = append(q.seqs, q.seq)
+}
+func (q *Queue) Pop() interface{} {
+	n := len(q.items) - 1
+	item := q.items[n]
+	q.items, q.seqs = q.items[:n], q.seqs[:n]
+	return item
+}
+
+// Items returns the queued commits, the next one to pop first.
+func (q *Queue) Items() []Dated {
+	return q.items
+}
@@ -0,0 +1,46 @@
+// Package walk has what the walks of the commit graph share: a loader
+// that parses each commit once, and the queue that hands commits out
+// newest first.
+package walk
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+// Commit is a commit as a walk needs it.
+type Commit struct {
+	Sha     string
+	Parents []string
+	When    int64 // committer timestamp
+}
+
+func (c *Commit) CommitDate() int64 { return c.When }
+
+// Graph loads the commits of a walk, each one once.
+type Graph struct {
+	store   *object.Store
+	commits map[string]*Commit
+}
+
+func NewGraph(store *object.Store) *Graph {
+	return &Graph{store: store, commits: map[string]*Commit{}}
+}
+
+func (g *Graph) Load(sha string) (*Commit, error) {
+	if c, ok := g.commits[sha]; ok {
+		return c, nil
+	}
+	data, err := g.store.ReadType(sha, "commit")
+	if err != nil {
+		return nil, err
+	}
+	commit, err := object.ParseCommit(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", sha, err)
+	}
+	c := &Commit{Sha: sha, Parents: commit.Parents, When: commit.Committer.Unix}
+	g.commits[sha] = c
+	return c, nil
+}
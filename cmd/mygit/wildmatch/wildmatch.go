@@ -0,0 +1,278 @@
+package wildmatch
+
+// Port of git's wildmatch, used by gitignore, gitattributes and includeIf.
+// ref: https://github.com/git/git/blob/master/wildmatch.c
+
+const (
+	// Pathname makes '*' and '?' stop at '/' and enables '**'.
+	Pathname = 1 << iota
+	CaseFold
+)
+
+const (
+	wmNoMatch = iota
+	wmMatch
+	wmAbortAll
+	wmAbortToStarStar
+)
+
+// Match reports whether text matches the pattern.
+func Match(pattern, text string, flags int) bool {
+	return dowild([]byte(pattern), []byte(text), flags) == wmMatch
+}
+
+func at(s []byte, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func upper(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+func isGlobSpecial(c byte) bool {
+	return c == '*' || c == '?' || c == '[' || c == '\\'
+}
+
+func dowild(pattern, text []byte, flags int) int {
+	p, t := 0, 0
+	for ; p < len(pattern); p, t = p+1, t+1 {
+		pCh := pattern[p]
+		tCh := at(text, t)
+		if tCh == 0 && pCh != '*' {
+			return wmAbortAll
+		}
+		if flags&CaseFold != 0 {
+			tCh = lower(tCh)
+			pCh = lower(pCh)
+		}
+		switch pCh {
+		case '\\':
+			p++
+			pCh = at(pattern, p)
+			if flags&CaseFold != 0 {
+				pCh = lower(pCh)
+			}
+			if tCh != pCh {
+				return wmNoMatch
+			}
+		case '?':
+			if flags&Pathname != 0 && tCh == '/' {
+				return wmNoMatch
+			}
+		case '*':
+			matchSlash := false
+			p++
+			if at(pattern, p) == '*' {
+				prev := p - 2
+				for p++; at(pattern, p) == '*'; p++ {
+				}
+				if (prev < 0 || pattern[prev] == '/') &&
+					(p >= len(pattern) || pattern[p] == '/' || (pattern[p] == '\\' && at(pattern, p+1) == '/')) {
+					if at(pattern, p) == '/' && dowild(pattern[p+1:], text[t:], flags) == wmMatch {
+						return wmMatch
+					}
+					matchSlash = true
+				}
+			} else {
+				matchSlash = flags&Pathname == 0
+			}
+			if p >= len(pattern) {
+				if !matchSlash {
+					for _, c := range text[t:] {
+						if c == '/' {
+							return wmNoMatch
+						}
+					}
+				}
+				return wmMatch
+			} else if !matchSlash && pattern[p] == '/' {
+				slash := -1
+				for i := t; i < len(text); i++ {
+					if text[i] == '/' {
+						slash = i
+						break
+					}
+				}
+				if slash < 0 {
+					return wmNoMatch
+				}
+				// The slash is consumed by the loop.
+				t = slash
+				continue
+			}
+			for {
+				if t >= len(text) {
+					break
+				}
+				if !isGlobSpecial(pattern[p]) {
+					// Skip ahead to the next possible match of a literal.
+					want := pattern[p]
+					if flags&CaseFold != 0 {
+						want = lower(want)
+					}
+					for t < len(text) && (matchSlash || text[t] != '/') {
+						c := text[t]
+						if flags&CaseFold != 0 {
+							c = lower(c)
+						}
+						if c == want {
+							break
+						}
+						t++
+					}
+					if t >= len(text) || (flags&CaseFold == 0 && text[t] != want) || (flags&CaseFold != 0 && lower(text[t]) != want) {
+						return wmNoMatch
+					}
+				}
+				matched := dowild(pattern[p:], text[t:], flags)
+				if matched != wmNoMatch {
+					if !matchSlash || matched != wmAbortToStarStar {
+						return matched
+					}
+				} else if !matchSlash && text[t] == '/' {
+					return wmAbortToStarStar
+				}
+				t++
+			}
+			return wmAbortAll
+		case '[':
+			p++
+			pCh = at(pattern, p)
+			if pCh == '^' {
+				pCh = '!'
+			}
+			negated := pCh == '!'
+			if negated {
+				p++
+				pCh = at(pattern, p)
+			}
+			var prevCh byte
+			matched := false
+			for {
+				if pCh == 0 {
+					return wmAbortAll
+				}
+				if pCh == '\\' {
+					p++
+					pCh = at(pattern, p)
+					if pCh == 0 {
+						return wmAbortAll
+					}
+					if tCh == pCh {
+						matched = true
+					}
+				} else if pCh == '-' && prevCh != 0 && at(pattern, p+1) != 0 && at(pattern, p+1) != ']' {
+					p++
+					pCh = at(pattern, p)
+					if pCh == '\\' {
+						p++
+						pCh = at(pattern, p)
+						if pCh == 0 {
+							return wmAbortAll
+						}
+					}
+					if tCh <= pCh && tCh >= prevCh {
+						matched = true
+					} else if flags&CaseFold != 0 {
+						if u := upper(tCh); u <= pCh && u >= prevCh {
+							matched = true
+						}
+					}
+					pCh = 0
+				} else if pCh == '[' && at(pattern, p+1) == ':' {
+					start := p + 2
+					p = start
+					for at(pattern, p) != 0 && at(pattern, p) != ']' {
+						p++
+					}
+					if at(pattern, p) == 0 {
+						return wmAbortAll
+					}
+					if p-start-1 < 0 || pattern[p-1] != ':' {
+						// Not a [:class:], treat '[' literally.
+						p = start - 2
+						pCh = '['
+						if tCh == pCh {
+							matched = true
+						}
+					} else {
+						class := string(pattern[start : p-1])
+						ok, valid := matchClass(class, tCh, flags)
+						if !valid {
+							return wmAbortAll
+						}
+						if ok {
+							matched = true
+						}
+						pCh = 0
+					}
+				} else if tCh == pCh {
+					matched = true
+				}
+				prevCh = pCh
+				p++
+				pCh = at(pattern, p)
+				if pCh == ']' {
+					break
+				}
+			}
+			if matched == negated || (flags&Pathname != 0 && tCh == '/') {
+				return wmNoMatch
+			}
+		default:
+			if tCh != pCh {
+				return wmNoMatch
+			}
+		}
+	}
+	if t < len(text) {
+		return wmNoMatch
+	}
+	return wmMatch
+}
+
+func matchClass(class string, c byte, flags int) (bool, bool) {
+	isUpper := 'A' <= c && c <= 'Z'
+	isLower := 'a' <= c && c <= 'z'
+	isDigit := '0' <= c && c <= '9'
+	switch class {
+	case "alnum":
+		return isUpper || isLower || isDigit, true
+	case "alpha":
+		return isUpper || isLower, true
+	case "blank":
+		return c == ' ' || c == '\t', true
+	case "cntrl":
+		return c < 0x20 || c == 0x7f, true
+	case "digit":
+		return isDigit, true
+	case "graph":
+		return c > 0x20 && c < 0x7f, true
+	case "lower":
+		return isLower || (flags&CaseFold != 0 && isUpper), true
+	case "print":
+		return c >= 0x20 && c < 0x7f, true
+	case "punct":
+		return c > 0x20 && c < 0x7f && !isUpper && !isLower && !isDigit, true
+	case "space":
+		return c == ' ' || (c >= '\t' && c <= '\r'), true
+	case "upper":
+		return isUpper || (flags&CaseFold != 0 && isLower), true
+	case "xdigit":
+		return isDigit || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F'), true
+	}
+	return false, false
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// noteReader reads the notes attached to objects by a notes ref.
+// ref: https://git-scm.com/docs/git-notes
+type noteReader struct {
+	repo  *repository.Repository
+	ref   string
+	tree  string // of the notes commit, "" when there are no notes
+	trees map[string][]object.TreeEntry
+}
+
+// newNoteReader opens the notes ref log shows: GIT_NOTES_REF,
+// core.notesRef or refs/notes/commits.
+func newNoteReader(repo *repository.Repository) *noteReader {
+	r := &noteReader{repo: repo, ref: "refs/notes/commits", trees: map[string][]object.TreeEntry{}}
+	if cfg, err := repo.Config(); err == nil {
+		if value, ok := cfg.Get("core.notesRef"); ok {
+			r.ref = value
+		}
+	}
+	if value := os.Getenv("GIT_NOTES_REF"); value != "" {
+		r.ref = value
+	}
+	switch {
+	case strings.HasPrefix(r.ref, "refs/notes/"):
+	case strings.HasPrefix(r.ref, "notes/"):
+		r.ref = "refs/" + r.ref
+	default:
+		r.ref = "refs/notes/" + r.ref
+	}
+	ref, err := repo.Refs().Resolve(r.ref)
+	if err != nil {
+		return r
+	}
+	if info, err := readObjectInfo(repo.Objects(), ref.Target); err == nil && info.typ == "commit" {
+		r.tree = info.header("tree")
+	}
+	return r
+}
+
+// note returns the note of an object, "" if it has none. A note is
+// stored under the name of its object, split into fan-out directories
+// such as "ab/cdef..." in large notes trees.
+func (r *noteReader) note(sha string) string {
+	tree, rest := r.tree, sha
+	for tree != "" {
+		entries, ok := r.trees[tree]
+		if !ok {
+			contents, err := r.repo.Objects().ReadType(tree, "tree")
+			if err != nil {
+				return ""
+			}
+			if entries, err = object.ParseTree(contents, r.repo.Format); err != nil {
+				return ""
+			}
+			r.trees[tree] = entries
+		}
+		tree = ""
+		for _, e := range entries {
+			if e.Name == rest && !e.IsTree() {
+				data, err := r.repo.Objects().ReadType(e.Sha, "blob")
+				if err != nil {
+					return ""
+				}
+				return string(data)
+			}
+			if e.IsTree() && len(e.Name) == 2 && strings.HasPrefix(rest, e.Name) {
+				tree, rest = e.Sha, rest[2:]
+				break
+			}
+		}
+	}
+	return ""
+}
+
+// format lays out a note the way git's format_note does: each line
+// indented under a "Notes:" header, or raw for %N.
+func (r *noteReader) format(sha string, raw bool) string {
+	note := strings.TrimSuffix(r.note(sha), "\n")
+	if note == "" {
+		return ""
+	}
+	var sb strings.Builder
+	if !raw {
+		if r.ref == "refs/notes/commits" {
+			sb.WriteString("\nNotes:\n")
+		} else {
+			sb.WriteString("\nNotes (" + strings.TrimPrefix(r.ref, "refs/notes/") + "):\n")
+		}
+	}
+	for _, line := range strings.Split(note, "\n") {
+		if !raw {
+			sb.WriteString("    ")
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
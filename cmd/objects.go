@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+)
+
+type header struct {
+	key, value string
+}
+
+// objectInfo is a commit or tag split into headers and message.
+type objectInfo struct {
+	sha     string
+	typ     string
+	size    int
+	headers []header
+	message string
+	raw     []byte
+}
+
+func readObjectInfo(store *object.Store, sha string) (*objectInfo, error) {
+	typ, contents, err := store.Read(sha)
+	if err != nil {
+		return nil, err
+	}
+	info := &objectInfo{sha: sha, typ: typ, size: len(contents), raw: contents}
+	if typ != "commit" && typ != "tag" {
+		return info, nil
+	}
+	text := string(contents)
+	for text != "" {
+		nl := strings.IndexByte(text, '\n')
+		if nl < 0 {
+			nl = len(text)
+		}
+		line := text[:nl]
+		text = text[min(nl+1, len(text)):]
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, " ") && len(info.headers) > 0 {
+			// Continuation of a multi-line header such as gpgsig.
+			info.headers[len(info.headers)-1].value += "\n" + line[1:]
+			continue
+		}
+		key, value := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			key, value = line[:i], line[i+1:]
+		}
+		info.headers = append(info.headers, header{key, value})
+	}
+	info.message = text
+	return info, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (o *objectInfo) header(key string) string {
+	for _, h := range o.headers {
+		if h.key == key {
+			return h.value
+		}
+	}
+	return ""
+}
+
+func (o *objectInfo) headerAll(key string) []string {
+	values := []string{}
+	for _, h := range o.headers {
+		if h.key == key {
+			values = append(values, h.value)
+		}
+	}
+	return values
+}
+
+// splitSubjectBody splits a message into its first paragraph, joined into
+// one line, and the rest.
+func splitSubjectBody(message string) (string, string) {
+	message = strings.TrimLeft(message, "\n")
+	subject, body := message, ""
+	if i := strings.Index(message, "\n\n"); i >= 0 {
+		subject, body = message[:i], strings.TrimLeft(message[i+2:], "\n")
+	}
+	return strings.Join(strings.Fields(strings.ReplaceAll(subject, "\n", " ")), " "), body
+}
+
+// peel follows annotated tags down to the object they point to.
+func peel(store *object.Store, sha string) (string, string, error) {
+	for depth := 0; depth < 16; depth++ {
+		info, err := readObjectInfo(store, sha)
+		if err != nil {
+			return "", "", err
+		}
+		if info.typ != "tag" {
+			return sha, info.typ, nil
+		}
+		sha = info.header("object")
+	}
+	return "", "", fmt.Errorf("tag chain too long at %s", sha)
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+)
+
+// PackRefs implements "pack-refs".
+// ref: https://git-scm.com/docs/git-pack-refs
+func PackRefs(args []string) int {
+	opts := refs.PackOptions{}
+	for _, arg := range args {
+		switch {
+		case arg == "--all":
+			opts.All = true
+		case arg == "--no-all":
+			opts.All = false
+		case arg == "--prune":
+			opts.NoPrune = false
+		case arg == "--no-prune":
+			opts.NoPrune = true
+		case strings.HasPrefix(arg, "-"):
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			return usage("usage: pack-refs [--all] [--no-prune]")
+		}
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	opts.Peel = func(sha string) string {
+		peeled, _, err := peel(repo.Objects(), sha)
+		if err != nil {
+			return sha
+		}
+		return peeled
+	}
+	if err := repo.Refs().Pack(opts); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
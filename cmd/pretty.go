@@ -0,0 +1,1181 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/color"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// prettyFormat is a --pretty format: one of the built-in ones, or a user
+// format string.
+// ref: https://git-scm.com/docs/pretty-formats
+type prettyFormat struct {
+	// kind is "oneline", "short", "medium", "full", "fuller", "raw",
+	// "email", "mboxrd" or "user".
+	kind string
+	user string
+	// terminator ends each entry with a newline instead of separating
+	// entries with one, as oneline and tformat: do.
+	terminator bool
+	dateStyle  string // the date style the format defaults to, if any
+}
+
+// builtinFormats are the formats --pretty knows by name, in the order
+// git looks for them.
+var builtinFormats = []prettyFormat{
+	{kind: "raw"},
+	{kind: "medium"},
+	{kind: "short"},
+	{kind: "email"},
+	{kind: "mboxrd"},
+	{kind: "fuller"},
+	{kind: "full"},
+	{kind: "oneline", terminator: true},
+	{kind: "user", user: "%C(auto)%h (%s, %ad)", terminator: true, dateStyle: "short"},
+}
+
+// parsePrettyFormat reads a --pretty value. Built-in formats may be
+// abbreviated, the shortest match winning.
+func parsePrettyFormat(value string) (prettyFormat, error) {
+	switch {
+	case value == "":
+		return prettyFormat{kind: "medium"}, nil
+	case strings.HasPrefix(value, "format:"):
+		return prettyFormat{kind: "user", user: strings.TrimPrefix(value, "format:")}, nil
+	case strings.HasPrefix(value, "tformat:"):
+		return prettyFormat{kind: "user", user: strings.TrimPrefix(value, "tformat:"), terminator: true}, nil
+	case strings.Contains(value, "%"):
+		return prettyFormat{kind: "user", user: value, terminator: true}, nil
+	}
+	var found *prettyFormat
+	foundName := ""
+	for i, format := range builtinFormats {
+		name := format.kind
+		if name == "user" {
+			name = "reference"
+		}
+		if len(name) >= len(value) && strings.EqualFold(name[:len(value)], value) && (found == nil || len(foundName) > len(name)) {
+			found, foundName = &builtinFormats[i], name
+		}
+	}
+	if found == nil {
+		return prettyFormat{}, fmt.Errorf("invalid --pretty format: %s", value)
+	}
+	return *found, nil
+}
+
+// isEmail tells whether the format writes commits as mails.
+func (f prettyFormat) isEmail() bool {
+	return f.kind == "email" || f.kind == "mboxrd"
+}
+
+// wants tells whether a user format has a placeholder, like git's
+// userformat_find_requirements.
+func (f prettyFormat) wants(placeholder byte) bool {
+	if f.kind != "user" {
+		return false
+	}
+	s := f.user
+	for {
+		i := strings.IndexByte(s, '%')
+		if i < 0 || i+1 == len(s) {
+			return false
+		}
+		s = s[i+1:]
+		if s[0] == '%' {
+			s = s[1:]
+			continue
+		}
+		if s[0] == '+' || s[0] == '-' || s[0] == ' ' {
+			s = s[1:]
+		}
+		if s != "" && s[0] == placeholder {
+			return true
+		}
+	}
+}
+
+// prettyContext holds what formatting a commit needs besides the commit.
+type prettyContext struct {
+	repo         *repository.Repository
+	abbrev       int // length of abbreviated names
+	dateStyle    string
+	dateExplicit bool // the date style was given, which reflog selectors then show
+	tabExpand    int  // tab width of messages, -1 for that of the format
+	useMailmap   bool // map the identities the built-in formats show
+	decorate     func(sha, prefix, separator, suffix string) string
+	parents      func(n *commitNode) []string
+	sources      map[string]string // the revisions commits were reached from
+	graphWidth   func() int
+	notes        *noteReader // nil when notes aren't shown
+	mailmap      mailmap     // read on first use
+}
+
+// mapIdent maps a name and an email with the mailmap.
+func (ctx *prettyContext) mapIdent(name, email string) (string, string) {
+	if ctx.mailmap == nil {
+		ctx.mailmap = readMailmap(ctx.repo)
+	}
+	return ctx.mailmap.lookup(name, email)
+}
+
+// prettyPrint renders a commit in one of the built-in formats other than
+// the "commit <name>" line, the way git's pretty_print_commit does.
+func prettyPrint(ctx *prettyContext, format prettyFormat, n *commitNode) (string, error) {
+	if format.kind == "user" {
+		return formatCommit(ctx, format.user, n)
+	}
+	var sb strings.Builder
+	mail := format.isEmail()
+	msg := n.commit.Message
+	if format.kind == "raw" {
+		for _, h := range n.commit.Headers() {
+			sb.WriteString(h.String() + "\n")
+		}
+	} else if format.kind != "oneline" {
+		if parents := ctx.parents(n); len(parents) > 1 && !mail {
+			sb.WriteString("Merge:")
+			for _, p := range parents {
+				sb.WriteString(" " + ctx.repo.Objects().Abbrev(p, ctx.abbrev))
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString(prettyIdent(ctx, format.kind, "Author", n.commit.Author.String()))
+		if format.kind == "full" || format.kind == "fuller" {
+			sb.WriteString(prettyIdent(ctx, format.kind, "Commit", n.commit.Committer.String()))
+		}
+	}
+	if format.kind != "oneline" && !mail {
+		sb.WriteString("\n")
+	}
+	msg = skipBlankLines(msg)
+	if format.kind == "oneline" {
+		subject, _ := formatSubject(msg, " ")
+		return subject, nil
+	}
+	if mail {
+		var subject string
+		subject, msg = formatSubject(msg, " ")
+		sb.WriteString(emailSubject(subject, hasNonASCII(n.commit.Message)))
+	}
+	bodyStart := sb.Len()
+	indent, expand := 4, ctx.tabExpand
+	if mail {
+		indent = 0
+	}
+	if expand < 0 {
+		expand = 0
+		if format.kind == "medium" || format.kind == "full" || format.kind == "fuller" {
+			expand = 8
+		}
+	}
+	first := true
+	for msg != "" {
+		line := msg
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			line, msg = msg[:i], msg[i+1:]
+		} else {
+			msg = ""
+		}
+		line = strings.TrimRight(line, " \t\n\v\f\r")
+		if line == "" {
+			if first {
+				continue
+			}
+			if format.kind == "short" {
+				break
+			}
+		}
+		first = false
+		sb.WriteString(strings.Repeat(" ", indent))
+		if expand > 0 {
+			line = expandTabs(line, expand)
+		} else if format.kind == "mboxrd" && len(line) > 4 && strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			sb.WriteString(">")
+		}
+		sb.WriteString(line + "\n")
+	}
+	s := strings.TrimRight(sb.String(), " \t\n\v\f\r") + "\n"
+	if mail && len(s) <= bodyStart {
+		// Keep the blank line between the headers and the body.
+		s += "\n"
+	}
+	return s, nil
+}
+
+// prettyIdent renders the "Author:" or "Commit:" lines of a built-in
+// format, or the "From:" and "Date:" headers of a mail.
+func prettyIdent(ctx *prettyContext, kind, what, ident string) string {
+	name, email, when := splitIdent(ident)
+	if ctx.useMailmap {
+		mapped, mappedEmail := ctx.mapIdent(name, strings.Trim(email, "<>"))
+		name, email = mapped, "<"+mappedEmail+">"
+	}
+	formatted := func(style string) string {
+		t, err := date.ParseRaw(when)
+		if err != nil {
+			return ""
+		}
+		s, _ := date.Format(t, style)
+		return s
+	}
+	if kind == "email" || kind == "mboxrd" {
+		return emailFrom(name, strings.Trim(email, "<>")) + "Date: " + formatted("rfc2822") + "\n"
+	}
+	label := what + ": "
+	if kind == "fuller" {
+		label += "    "
+	}
+	s := label + name + " " + email + "\n"
+	switch kind {
+	case "medium":
+		s += "Date:   " + formatted(ctx.dateStyle) + "\n"
+	case "fuller":
+		s += what + "Date: " + formatted(ctx.dateStyle) + "\n"
+	}
+	return s
+}
+
+// emailFrom writes the "From:" header of a mail, quoting or encoding the
+// name as needed and folding the line at 78 columns, like git's
+// pp_user_info.
+func emailFrom(name, email string) string {
+	var sb strings.Builder
+	sb.WriteString("From: ")
+	max := 78
+	switch {
+	case needsRFC2047(name):
+		sb.WriteString(rfc2047(name, len("From: "), true))
+		max = 76
+	case strings.ContainsAny(name, `()<>[]:;@,."\`):
+		quoted := `"` + strings.NewReplacer(`"`, `\"`, `\`, `\\`).Replace(name) + `"`
+		sb.WriteString(wrapText(quoted, -6, 1, max))
+	default:
+		sb.WriteString(wrapText(name, -6, 1, max))
+	}
+	if max < lastLineLength(sb.String())+len(" <")+len(email)+len(">") {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(" <" + email + ">\n")
+	return sb.String()
+}
+
+// emailSubject writes the "Subject:" header of a mail and the MIME
+// headers a message that isn't ASCII needs, then the blank line before
+// the body, like git's pp_title_line.
+func emailSubject(subject string, eightBit bool) string {
+	s := "Subject: [PATCH] "
+	if needsRFC2047(subject) {
+		s += rfc2047(subject, len(s), false)
+	} else {
+		s += wrapText(subject, -len(s), 1, 78)
+	}
+	s += "\n"
+	if eightBit {
+		s += "MIME-Version: 1.0\nContent-Type: text/plain; charset=UTF-8\nContent-Transfer-Encoding: 8bit\n"
+	}
+	return s + "\n"
+}
+
+// hasNonASCII tells whether s has bytes outside ASCII.
+func hasNonASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// needsRFC2047 tells whether a header needs encoding: it isn't ASCII,
+// spans lines or looks like it is encoded already.
+func needsRFC2047(s string) bool {
+	return hasNonASCII(s) || strings.Contains(s, "\n") || strings.Contains(s, "=?")
+}
+
+// rfc2047 encodes a header value as "=?UTF-8?q?...?=" words, folding
+// lines to stay within 76 columns, like git's add_rfc2047. lineLen is
+// what the line already holds. Names in addresses allow fewer
+// characters unencoded.
+// ref: https://www.rfc-editor.org/rfc/rfc2047
+func rfc2047(s string, lineLen int, address bool) string {
+	const maxLen = 76
+	const charset = "UTF-8"
+	var sb strings.Builder
+	sb.WriteString("=?" + charset + "?q?")
+	lineLen += len(charset) + 5
+	for s != "" {
+		_, size := utf8.DecodeRuneInString(s)
+		c := s[0]
+		special := size > 1 || c >= 0x80 || c < 0x20 || c == 0x7f ||
+			isGitSpace(c) || c == '=' || c == '?' || c == '_' ||
+			address && !(isAlnum(c) || strings.IndexByte("!*+-/", c) >= 0)
+		encodedLen := 1
+		if special {
+			encodedLen = 3 * size
+		}
+		if lineLen+encodedLen+2 > maxLen {
+			// It won't fit with the closing "?=".
+			sb.WriteString("?=\n =?" + charset + "?q?")
+			lineLen = len(charset) + 5 + 1
+		}
+		for i := 0; i < size; i++ {
+			if special {
+				fmt.Fprintf(&sb, "=%02X", s[i])
+			} else {
+				sb.WriteByte(s[i])
+			}
+		}
+		lineLen += encodedLen
+		s = s[size:]
+	}
+	sb.WriteString("?=")
+	return sb.String()
+}
+
+// lastLineLength is the number of bytes on the last line of s.
+func lastLineLength(s string) int {
+	return len(s) - strings.LastIndexByte(s, '\n') - 1
+}
+
+// skipBlankLines drops the lines holding only whitespace at the start of
+// a message.
+func skipBlankLines(msg string) string {
+	for msg != "" {
+		line := msg
+		rest := ""
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			line, rest = msg[:i], msg[i+1:]
+		}
+		if strings.TrimSpace(line) != "" {
+			break
+		}
+		msg = rest
+	}
+	return msg
+}
+
+// formatSubject joins the lines of the first paragraph of msg with sep,
+// and returns it with the rest of the message.
+func formatSubject(msg, sep string) (string, string) {
+	lines := []string{}
+	for msg != "" {
+		line := msg
+		rest := ""
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			line, rest = msg[:i], msg[i+1:]
+		}
+		msg = rest
+		line = strings.TrimRight(line, " \t\n\v\f\r")
+		if line == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, sep), msg
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of width.
+func expandTabs(line string, width int) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := width - col%width
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		b.WriteRune(r)
+		col++
+	}
+	return b.String()
+}
+
+var sanitizeSubjectRe = regexp.MustCompile(`[^A-Za-z0-9._]+`)
+
+// sanitizeSubject turns a subject into a file name for %f.
+func sanitizeSubject(subject string) string {
+	s := sanitizeSubjectRe.ReplaceAllString(subject, "-")
+	for strings.Contains(s, "..") {
+		s = strings.ReplaceAll(s, "..", ".")
+	}
+	s = strings.TrimLeft(s, ".-")
+	s = strings.TrimRight(s, ".-")
+	return strings.TrimSuffix(s, ".lock")
+}
+
+// formattingLimit bounds the widths of %<(N) and %w(), as git does to
+// keep a format from taking all memory.
+const formattingLimit = 16 * 1024
+
+// How %<(N) and the like align the next placeholder.
+const (
+	flushNone      = iota
+	flushRight     // %<(N): pad on the right
+	flushLeft      // %>(N): pad on the left
+	flushLeftSteal // %>>(N): pad on the left, taking spaces before it
+	flushBoth      // %><(N): center
+)
+
+// commitFormat expands a user format for a commit, the way git's
+// format_commit_message does.
+type commitFormat struct {
+	ctx *prettyContext
+	n   *commitNode
+	buf []byte
+
+	// padding is the width set by %<(N) and the like for the next
+	// placeholder; negative for %<|(N), as the column to reach.
+	padding  int
+	flush    int
+	truncate string // "", "trunc", "ltrunc" or "mtrunc"
+
+	// The wrapping of %w(width,indent1,indent2), applied to what was
+	// written since wrapStart.
+	width, indent1, indent2 int
+	wrapStart               int
+
+	signature *signatureCheck
+	err       error
+}
+
+// formatCommit expands a user format for a commit.
+func formatCommit(ctx *prettyContext, format string, n *commitNode) (string, error) {
+	c := &commitFormat{ctx: ctx, n: n}
+	for {
+		i := strings.IndexByte(format, '%')
+		if i < 0 {
+			c.buf = append(c.buf, format...)
+			break
+		}
+		c.buf = append(c.buf, format[:i]...)
+		format = format[i+1:]
+		if strings.HasPrefix(format, "%") {
+			c.buf = append(c.buf, '%')
+			format = format[1:]
+			continue
+		}
+		consumed := c.item(format)
+		if c.err != nil {
+			return "", c.err
+		}
+		if consumed == 0 {
+			// Unknown placeholders are shown as they are.
+			c.buf = append(c.buf, '%')
+		}
+		format = format[consumed:]
+	}
+	c.rewrap(0, 0, 0)
+	return string(c.buf), nil
+}
+
+// item expands the placeholder at the start of p, after a '%', and
+// returns how many bytes it took, 0 for an unknown one. A '-' before
+// it removes the line breaks before an empty expansion, a '+' or ' '
+// puts a line break or space before one that isn't.
+func (c *commitFormat) item(p string) int {
+	magic := byte(0)
+	if p != "" && (p[0] == '-' || p[0] == '+' || p[0] == ' ') {
+		magic, p = p[0], p[1:]
+		if strings.HasPrefix(p, "w") {
+			return 0
+		}
+	}
+	orig := len(c.buf)
+	consumed := 0
+	if c.flush != flushNone {
+		consumed = c.pad(p)
+	} else {
+		consumed = c.one(p)
+	}
+	if magic == 0 {
+		return consumed
+	}
+	switch {
+	case len(c.buf) == orig && magic == '-':
+		for len(c.buf) > 0 && c.buf[len(c.buf)-1] == '\n' {
+			c.buf = c.buf[:len(c.buf)-1]
+		}
+	case len(c.buf) != orig && magic != '-':
+		sep := byte('\n')
+		if magic == ' ' {
+			sep = ' '
+		}
+		c.buf = append(c.buf[:orig], append([]byte{sep}, c.buf[orig:]...)...)
+	}
+	return consumed + 1
+}
+
+// pad expands the placeholder at the start of p, with the colors before
+// it, and aligns it as the last %<(N) or the like asked, like git's
+// format_and_pad_commit.
+func (c *commitFormat) pad(p string) int {
+	padding := c.padding
+	if padding < 0 {
+		line := c.buf[maxInt(strings.LastIndexByte(string(c.buf), '\n'), 0):]
+		padding = -padding - displayWidth(string(line)) - c.ctx.graphWidthOr0()
+	}
+	saved := c.buf
+	c.buf = nil
+	total := 0
+	for {
+		modifier := strings.HasPrefix(p, "C")
+		consumed := c.one(p)
+		total += consumed
+		if !modifier {
+			break
+		}
+		p = p[consumed:]
+		if !strings.HasPrefix(p, "%") {
+			break
+		}
+		p = p[1:]
+		total++
+	}
+	local := string(c.buf)
+	c.buf = saved
+	width := displayWidth(local)
+
+	if c.flush == flushLeftSteal {
+		// Take the spaces before, and the colors between them.
+		ch := len(c.buf) - 1
+		for width > padding && ch > 0 {
+			if c.buf[ch] == ' ' {
+				ch--
+				padding++
+				continue
+			}
+			if c.buf[ch] != 'm' {
+				break
+			}
+			start := ch - 1
+			for start > 0 && ch-start < 10 && c.buf[start] != '\033' {
+				start--
+			}
+			if c.buf[start] != '\033' || ch+1-start != escapeLen(string(c.buf[start:])) {
+				break
+			}
+			local = string(c.buf[start:ch+1]) + local
+			ch = start - 1
+		}
+		c.buf = c.buf[:ch+1]
+		c.flush = flushLeft
+	}
+
+	if width > padding {
+		switch c.truncate {
+		case "ltrunc":
+			local = utf8Replace(local, 0, width-(padding-2), "..")
+		case "mtrunc":
+			local = utf8Replace(local, padding/2-1, width-(padding-2), "..")
+		case "trunc":
+			local = utf8Replace(local, padding-2, width-(padding-2), "..")
+		}
+		c.buf = append(c.buf, local...)
+	} else {
+		offset := 0
+		switch c.flush {
+		case flushLeft:
+			offset = padding - width
+		case flushBoth:
+			offset = (padding - width) / 2
+		}
+		spaces := padding - width
+		c.buf = append(c.buf, strings.Repeat(" ", offset)...)
+		c.buf = append(c.buf, local...)
+		c.buf = append(c.buf, strings.Repeat(" ", spaces-offset)...)
+	}
+	c.flush = flushNone
+	return total
+}
+
+// graphWidthOr0 is the width of the graph before the lines of the
+// commit, which %<|(N) counts.
+func (ctx *prettyContext) graphWidthOr0() int {
+	if ctx.graphWidth == nil {
+		return 0
+	}
+	return ctx.graphWidth()
+}
+
+// rewrap wraps what was written since the last %w() as it asked, and
+// starts wrapping the rest as this one asks.
+func (c *commitFormat) rewrap(width, indent1, indent2 int) {
+	if c.width == width && c.indent1 == indent1 && c.indent2 == indent2 {
+		return
+	}
+	if c.wrapStart < len(c.buf) {
+		wrapped := wrapText(string(c.buf[c.wrapStart:]), c.indent1, c.indent2, c.width)
+		c.buf = append(c.buf[:c.wrapStart], wrapped...)
+	}
+	c.wrapStart = len(c.buf)
+	c.width, c.indent1, c.indent2 = width, indent1, indent2
+}
+
+// parseLeadingInt reads a number at the start of s the way strtol does,
+// after spaces and with a sign, and returns what follows it.
+func parseLeadingInt(s string) (int, string, bool) {
+	i := 0
+	for i < len(s) && (s[i] == ' ' || s[i] >= '\t' && s[i] <= '\r') {
+		i++
+	}
+	j := i
+	if j < len(s) && (s[j] == '+' || s[j] == '-') {
+		j++
+	}
+	k := j
+	for k < len(s) && s[k] >= '0' && s[k] <= '9' {
+		k++
+	}
+	if k == j {
+		return 0, s, false
+	}
+	n, err := strconv.Atoi(s[i:k])
+	if err != nil {
+		// Out of range, which no limit allows.
+		n = formattingLimit + 1
+		if s[i] == '-' {
+			n = -n
+		}
+	}
+	return n, s[k:], true
+}
+
+// parsePadding reads %<(N), %<|(N), %>(N), %>>(N) and %><(N) with an
+// optional ",trunc", ",ltrunc" or ",mtrunc", like git's
+// parse_padding_placeholder.
+func (c *commitFormat) parsePadding(p string) int {
+	flush := flushRight
+	rest := p[1:]
+	if p[0] == '>' {
+		flush = flushLeft
+		switch {
+		case strings.HasPrefix(rest, "<"):
+			flush, rest = flushBoth, rest[1:]
+		case strings.HasPrefix(rest, ">"):
+			flush, rest = flushLeftSteal, rest[1:]
+		}
+	}
+	toColumn := strings.HasPrefix(rest, "|")
+	if toColumn {
+		rest = rest[1:]
+	}
+	if !strings.HasPrefix(rest, "(") {
+		return 0
+	}
+	rest = rest[1:]
+	end := strings.IndexAny(rest, ",)")
+	if end <= 0 {
+		return 0
+	}
+	width, _, ok := parseLeadingInt(rest[:end])
+	if !ok || width == 0 || width < -formattingLimit || width > formattingLimit {
+		return 0
+	}
+	if width < 0 {
+		if toColumn {
+			width += diff.TerminalWidth()
+		}
+		if width < 0 {
+			return 0
+		}
+	}
+	c.padding = width
+	if toColumn {
+		c.padding = -width
+	}
+	c.flush = flush
+	if rest[end] == ')' {
+		c.truncate = ""
+		return len(p) - len(rest) + end + 1
+	}
+	option := rest[end+1:]
+	close := strings.IndexByte(option, ')')
+	if close <= 0 {
+		return 0
+	}
+	switch option[:close] {
+	case "trunc", "ltrunc", "mtrunc":
+		c.truncate = option[:close]
+	default:
+		return 0
+	}
+	return len(p) - len(option) + close + 1
+}
+
+// parseColor reads %C(...), %Cred, %Cgreen, %Cblue and %Creset. Colors
+// are only shown when asked for with "always,", as log never writes to
+// a terminal.
+func (c *commitFormat) parseColor(p string) int {
+	if strings.HasPrefix(p, "C(") {
+		end := strings.IndexByte(p, ')')
+		if end < 0 {
+			return 0
+		}
+		if spec := p[2:end]; strings.HasPrefix(spec, "always,") {
+			code, err := color.Parse(strings.TrimPrefix(spec, "always,"))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				c.err = errors.New("unable to parse --pretty format")
+				return 0
+			}
+			c.buf = append(c.buf, code...)
+		}
+		return end + 1
+	}
+	for _, name := range []string{"red", "green", "blue", "reset"} {
+		if strings.HasPrefix(p[1:], name) {
+			return 1 + len(name)
+		}
+	}
+	return 0
+}
+
+// one expands the placeholder at the start of p and returns how many
+// bytes it took, 0 for an unknown one, like git's format_commit_one.
+func (c *commitFormat) one(p string) int {
+	if p == "" {
+		return 0
+	}
+	ctx, n := c.ctx, c.n
+	add := func(s string) {
+		c.buf = append(c.buf, s...)
+	}
+	abbrev := func(sha string) string {
+		return ctx.repo.Objects().Abbrev(sha, ctx.abbrev)
+	}
+
+	// These don't depend on the commit.
+	switch p[0] {
+	case 'C':
+		if strings.HasPrefix(p, "C(auto)") {
+			return len("C(auto)")
+		}
+		return c.parseColor(p)
+	case 'n':
+		add("\n")
+		return 1
+	case 'x':
+		if len(p) >= 3 && isHexDigit(p[1]) && isHexDigit(p[2]) {
+			v, _ := strconv.ParseUint(p[1:3], 16, 8)
+			c.buf = append(c.buf, byte(v))
+			return 3
+		}
+		return 0
+	case 'w':
+		if !strings.HasPrefix(p, "w(") {
+			return 0
+		}
+		end := strings.IndexByte(p, ')')
+		if end < 0 {
+			return 0
+		}
+		var values [3]int
+		if args := p[2:end]; args != "" {
+			for i := range values {
+				v, rest, ok := parseLeadingInt(args)
+				if !ok || v < 0 {
+					// Like strtoul, a negative number is too large.
+					v = formattingLimit + 1
+				}
+				values[i], args = v, rest
+				if i == 2 || !strings.HasPrefix(args, ",") {
+					break
+				}
+				args = args[1:]
+			}
+			if args != "" {
+				return 0
+			}
+		}
+		for _, v := range values {
+			if v > formattingLimit {
+				return 0
+			}
+		}
+		c.rewrap(values[0], values[1], values[2])
+		return end + 1
+	case '<', '>':
+		return c.parsePadding(p)
+	}
+	if strings.HasPrefix(p, "(describe") {
+		opts, rest, ok := parseDescribeArgs(strings.TrimPrefix(p, "(describe"))
+		if !ok {
+			return 0
+		}
+		add(describeCommit(ctx.repo, n.sha, opts))
+		return len(p) - len(rest) + 1
+	}
+
+	switch p[0] {
+	case 'H':
+		add(n.sha)
+		return 1
+	case 'h':
+		add(abbrev(n.sha))
+		return 1
+	case 'T':
+		add(n.tree)
+		return 1
+	case 't':
+		add(abbrev(n.tree))
+		return 1
+	case 'P', 'p':
+		names := []string{}
+		for _, parent := range ctx.parents(n) {
+			if p[0] == 'p' {
+				parent = abbrev(parent)
+			}
+			names = append(names, parent)
+		}
+		add(strings.Join(names, " "))
+		return 1
+	case 'm':
+		add(">")
+		return 1
+	case 'd':
+		add(ctx.decorate(n.sha, " (", ", ", ")"))
+		return 1
+	case 'D':
+		add(ctx.decorate(n.sha, "", ", ", ""))
+		return 1
+	case 'S':
+		source := ctx.sources[n.sha]
+		if source == "" {
+			return 0
+		}
+		add(source)
+		return 1
+	case 'g':
+		if len(p) < 2 {
+			return 0
+		}
+		switch p[1] {
+		case 'd', 'D':
+			if n.reflog != nil {
+				add(n.reflog.selector(ctx, p[1] == 'd'))
+			}
+			return 2
+		case 's':
+			if n.reflog != nil {
+				add(n.reflog.entry.Message)
+			}
+			return 2
+		case 'n', 'N', 'e', 'E':
+			if n.reflog == nil {
+				return 2
+			}
+			return c.person(p[1], n.reflog.entry.Committer)
+		}
+		return 0
+	case 'N':
+		if ctx.notes == nil {
+			return 0
+		}
+		add(ctx.notes.format(n.sha, true))
+		return 1
+	case 'G':
+		if c.signature == nil {
+			c.signature = checkCommitSignature(ctx.repo, n.info.raw)
+		}
+		sig := c.signature
+		if len(p) < 2 {
+			return 0
+		}
+		switch p[1] {
+		case 'G':
+			add(sig.output)
+		case '?':
+			result := sig.result
+			if result == 'G' && (sig.trust == "undefined" || sig.trust == "never") {
+				result = 'U'
+			}
+			if strings.IndexByte("GUBENXYR", result) >= 0 {
+				c.buf = append(c.buf, result)
+			}
+		case 'S':
+			add(sig.signer)
+		case 'K':
+			add(sig.key)
+		case 'F':
+			add(sig.fingerprint)
+		case 'P':
+			add(sig.primaryKey)
+		case 'T':
+			add(sig.trust)
+		default:
+			return 0
+		}
+		return 2
+	case 'a':
+		return c.person(byteAt(p, 1), n.commit.Author.String())
+	case 'c':
+		return c.person(byteAt(p, 1), n.commit.Committer.String())
+	case 'e':
+		add(n.commit.Encoding)
+		return 1
+	case 'B':
+		add(n.commit.Message)
+		return 1
+	}
+
+	msg := skipBlankLines(n.commit.Message)
+	subject, rest := formatSubject(msg, " ")
+	switch p[0] {
+	case 's':
+		add(subject)
+		return 1
+	case 'f':
+		add(sanitizeSubject(subject))
+		return 1
+	case 'b':
+		add(skipBlankLines(rest))
+		return 1
+	}
+	if strings.HasPrefix(p, "(trailers") {
+		opts, rest, ok := parseTrailerArgs(strings.TrimPrefix(p, "(trailers"))
+		if !ok {
+			return 0
+		}
+		add(formatTrailers(msg, trailerSeparators(ctx), opts))
+		return len(p) - len(rest) + 1
+	}
+	return 0
+}
+
+// byteAt is s[i], or 0 past its end.
+func byteAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
+
+// person expands the part of an identity a %a*, %c* or %g* placeholder
+// asks for, like git's format_person_part. N, E and L map it with the
+// mailmap first.
+func (c *commitFormat) person(part byte, ident string) int {
+	name, email, when := splitIdent(ident)
+	if email != "" {
+		email = strings.Trim(email, "<>")
+		if part == 'N' || part == 'E' || part == 'L' {
+			name, email = c.ctx.mapIdent(name, email)
+		}
+		switch part {
+		case 'n', 'N':
+			c.buf = append(c.buf, name...)
+			return 2
+		case 'e', 'E':
+			c.buf = append(c.buf, email...)
+			return 2
+		case 'l', 'L':
+			if i := strings.IndexByte(email, '@'); i >= 0 {
+				email = email[:i]
+			}
+			c.buf = append(c.buf, email...)
+			return 2
+		}
+		if t, err := date.ParseRaw(when); err == nil {
+			style := ""
+			switch part {
+			case 't':
+				c.buf = append(c.buf, strings.Fields(when)[0]...)
+				return 2
+			case 'd':
+				style = c.ctx.dateStyle
+			case 'D':
+				style = "rfc2822"
+			case 'r':
+				style = "relative"
+			case 'i':
+				style = "iso"
+			case 'I':
+				style = "iso-strict"
+			case 'h':
+				style = "human"
+			case 's':
+				style = "short"
+			}
+			if style != "" {
+				formatted, _ := date.Format(t, style)
+				c.buf = append(c.buf, formatted...)
+				return 2
+			}
+		}
+	}
+	// A bogus identity, or one without a date as in reflogs.
+	if strings.IndexByte("netdDri", part) >= 0 && part != 0 {
+		return 2
+	}
+	return 0
+}
+
+// placeholderArg matches "<name>" or "<name>=<value>" followed by ',' or
+// ')' at the start of s, like git's match_placeholder_arg_value, and
+// returns what follows the ',' or is the ')'.
+func placeholderArg(s, name string) (value string, hasValue bool, rest string, ok bool) {
+	if !strings.HasPrefix(s, name) {
+		return "", false, s, false
+	}
+	p := s[len(name):]
+	if strings.HasPrefix(p, "=") {
+		p = p[1:]
+		end := strings.IndexAny(p, ",)")
+		if end < 0 {
+			end = len(p)
+		}
+		value, hasValue, p = p[:end], true, p[end:]
+	}
+	switch {
+	case strings.HasPrefix(p, ","):
+		return value, hasValue, p[1:], true
+	case strings.HasPrefix(p, ")"):
+		return value, hasValue, p, true
+	}
+	return "", false, s, false
+}
+
+// placeholderBool matches "<name>" or "<name>=<bool>", like git's
+// match_placeholder_bool_arg.
+func placeholderBool(s, name string) (bool, string, bool) {
+	value, hasValue, rest, ok := placeholderArg(s, name)
+	if !ok {
+		return false, s, false
+	}
+	if !hasValue {
+		return true, rest, true
+	}
+	b, err := config.ParseBool(value, false)
+	if err != nil {
+		return false, s, false
+	}
+	return b, rest, true
+}
+
+// parseDescribeArgs reads the ":tags,abbrev=N,match=P,exclude=P" options
+// of %(describe) and returns what follows them, which must be ')'.
+func parseDescribeArgs(s string) (describeOptions, string, bool) {
+	opts := describeOptions{abbrev: -1}
+	if strings.HasPrefix(s, ":") {
+		s = s[1:]
+		for {
+			if tags, rest, ok := placeholderBool(s, "tags"); ok {
+				opts.tags, s = tags, rest
+				continue
+			}
+			if value, _, rest, ok := placeholderArg(s, "abbrev"); ok {
+				n, after, valid := parseLeadingInt(value)
+				if !valid || after != "" {
+					return opts, s, false
+				}
+				if n != 0 && n < 4 {
+					n = 4
+				}
+				opts.abbrev, s = n, rest
+				continue
+			}
+			if value, _, rest, ok := placeholderArg(s, "exclude"); ok {
+				if value == "" {
+					return opts, s, false
+				}
+				opts.excludes, s = append(opts.excludes, value), rest
+				continue
+			}
+			if value, _, rest, ok := placeholderArg(s, "match"); ok {
+				if value == "" {
+					return opts, s, false
+				}
+				opts.match, s = append(opts.match, value), rest
+				continue
+			}
+			break
+		}
+	}
+	return opts, s, strings.HasPrefix(s, ")")
+}
+
+// parseTrailerArgs reads the options of %(trailers) and returns what
+// follows them, which must be ')'.
+func parseTrailerArgs(s string) (trailerOptions, string, bool) {
+	var opts trailerOptions
+	if !strings.HasPrefix(s, ":") {
+		return opts, s, strings.HasPrefix(s, ")")
+	}
+	s = s[1:]
+	for !strings.HasPrefix(s, ")") {
+		if value, hasValue, rest, ok := placeholderArg(s, "key"); ok {
+			if !hasValue {
+				return opts, s, false
+			}
+			opts.keys = append(opts.keys, value)
+			opts.only, s = true, rest
+			continue
+		}
+		if value, _, rest, ok := placeholderArg(s, "separator"); ok {
+			sep := expandLiterals(value)
+			opts.separator, s = &sep, rest
+			continue
+		}
+		if value, _, rest, ok := placeholderArg(s, "key_value_separator"); ok {
+			sep := expandLiterals(value)
+			opts.keyValueSeparator, s = &sep, rest
+			continue
+		}
+		matched := false
+		for _, option := range []struct {
+			name  string
+			value *bool
+		}{{"only", &opts.only}, {"unfold", &opts.unfold}, {"keyonly", &opts.keyOnly}, {"valueonly", &opts.valueOnly}} {
+			if b, rest, ok := placeholderBool(s, option.name); ok {
+				*option.value, s, matched = b, rest, true
+				break
+			}
+		}
+		if !matched {
+			return opts, s, false
+		}
+	}
+	return opts, s, true
+}
+
+// expandLiterals expands the %n, %xNN and %% of a separator.
+func expandLiterals(s string) string {
+	var sb strings.Builder
+	for {
+		i := strings.IndexByte(s, '%')
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String()
+		}
+		sb.WriteString(s[:i])
+		s = s[i+1:]
+		switch {
+		case strings.HasPrefix(s, "%"):
+			sb.WriteByte('%')
+			s = s[1:]
+		case strings.HasPrefix(s, "n"):
+			sb.WriteByte('\n')
+			s = s[1:]
+		case len(s) >= 3 && s[0] == 'x' && isHexDigit(s[1]) && isHexDigit(s[2]):
+			v, _ := strconv.ParseUint(s[1:3], 16, 8)
+			sb.WriteByte(byte(v))
+			s = s[3:]
+		default:
+			sb.WriteByte('%')
+		}
+	}
+}
@@ -0,0 +1,948 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/unpack"
+)
+
+const rebaseUsage = "usage: git rebase [-i] [options] [--onto <newbase>] [<upstream> [<branch>]]"
+
+// rebaseState is a rebase in progress, kept in .git/rebase-merge so that
+// it survives the stops for conflicts, edits and breaks.
+type rebaseState struct {
+	repo  *repository.Repository
+	dir   string
+	quiet bool
+}
+
+func newRebaseState(repo *repository.Repository) *rebaseState {
+	s := &rebaseState{repo: repo, dir: repo.Path("rebase-merge")}
+	_, err := os.Stat(s.path("quiet"))
+	s.quiet = err == nil
+	return s
+}
+
+func (s *rebaseState) exists() bool {
+	info, err := os.Stat(s.dir)
+	return err == nil && info.IsDir()
+}
+
+func (s *rebaseState) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// read returns the contents of a file of the state, empty if missing.
+func (s *rebaseState) read(name string) string {
+	data, _ := os.ReadFile(s.path(name))
+	return string(data)
+}
+
+// readLine returns the first line of a file of the state.
+func (s *rebaseState) readLine(name string) string {
+	line, _, _ := strings.Cut(s.read(name), "\n")
+	return line
+}
+
+func (s *rebaseState) has(name string) bool {
+	_, err := os.Stat(s.path(name))
+	return err == nil
+}
+
+func (s *rebaseState) write(name, content string) error {
+	return os.WriteFile(s.path(name), []byte(content), 0o666)
+}
+
+func (s *rebaseState) append(name, content string) error {
+	f, err := os.OpenFile(s.path(name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *rebaseState) remove(names ...string) {
+	for _, name := range names {
+		os.Remove(s.path(name))
+	}
+}
+
+// head is the commit HEAD is at.
+func (s *rebaseState) head() (string, error) {
+	head, err := s.repo.Refs().Resolve(refs.HEAD)
+	if err != nil {
+		return "", err
+	}
+	return head.Target, nil
+}
+
+func (s *rebaseState) readTodo() ([]todoItem, error) {
+	return parseTodo(s.repo, s.read("git-rebase-todo"))
+}
+
+// writeTodo saves what is left to do, with full object names.
+func (s *rebaseState) writeTodo(items []todoItem) error {
+	var b strings.Builder
+	for _, it := range items {
+		b.WriteString(it.format(func(sha string) string { return sha }) + "\n")
+	}
+	return s.write("git-rebase-todo", b.String())
+}
+
+// writeAuthorScript records the author of the commit to make, as the
+// shell assignments git writes.
+func (s *rebaseState) writeAuthorScript(author *object.Signature) error {
+	return s.write("author-script", fmt.Sprintf("GIT_AUTHOR_NAME=%s\nGIT_AUTHOR_EMAIL=%s\nGIT_AUTHOR_DATE=%s\n",
+		sqQuote(author.Name), sqQuote(author.Email), sqQuote(fmt.Sprintf("@%d %s", author.Unix, author.Timezone))))
+}
+
+func (s *rebaseState) readAuthorScript() (*object.Signature, error) {
+	author := &object.Signature{}
+	for _, line := range strings.Split(s.read("author-script"), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = sqUnquote(value)
+		switch key {
+		case "GIT_AUTHOR_NAME":
+			author.Name = value
+		case "GIT_AUTHOR_EMAIL":
+			author.Email = value
+		case "GIT_AUTHOR_DATE":
+			when, zone, _ := strings.Cut(strings.TrimPrefix(value, "@"), " ")
+			unix, err := strconv.ParseInt(when, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date format '%s' in '%s'", value, s.path("author-script"))
+			}
+			author.Unix, author.Timezone = unix, zone
+		}
+	}
+	if author.Name == "" {
+		return nil, fmt.Errorf("could not parse '%s'", s.path("author-script"))
+	}
+	return author, nil
+}
+
+// sqQuote quotes a string for the shell, in single quotes.
+func sqQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func sqUnquote(s string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(s, "'"), "'"), `'\''`, "'")
+}
+
+// dirty tells whether the index or the work tree differ from HEAD.
+func (s *rebaseState) dirty() (bool, error) {
+	unstaged, staged, err := localChanges(s.repo)
+	return unstaged || staged, err
+}
+
+// localChanges tells whether the work tree differs from the index, and
+// the index from HEAD.
+func localChanges(repo *repository.Repository) (unstaged, staged bool, err error) {
+	idx, err := repo.Index()
+	if err != nil {
+		return false, false, err
+	}
+	stale, changed, err := idx.Refresh(repo.WorkTree, repo.Format, false)
+	if err != nil {
+		return false, false, err
+	}
+	if changed {
+		if err := idx.Write(repo.IndexFile(), repo.Format); err != nil {
+			return false, false, err
+		}
+	}
+	tree, err := headTree(repo)
+	if err != nil {
+		return false, false, err
+	}
+	pairs, err := diff.TreeIndex(repo.Objects(), tree, idx, "", diff.TreeOptions{})
+	if err != nil {
+		return false, false, err
+	}
+	return len(stale) > 0, len(pairs) > 0, nil
+}
+
+// Rebase implements "rebase": the commits of the current branch, or of
+// <branch>, that <upstream> doesn't have are applied again on top of
+// <upstream>, or of the --onto commit, one after the other, and the
+// branch is moved to the result. With -i the list of what to do is
+// edited first. A rebase stops for conflicts, edits, breaks and failed
+// execs, to go on with --continue or --skip, or to be thrown away with
+// --abort.
+// ref: https://git-scm.com/docs/git-rebase
+func Rebase(args []string) int {
+	interactive, quiet := false, false
+	onto, action := "", ""
+	autoSquash, updateRefs := -1, -1
+	reapply := false
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-i" || arg == "--interactive":
+			interactive = true
+		case arg == "--onto":
+			if i+1 >= len(args) {
+				return usage("option `onto' requires a value")
+			}
+			i++
+			onto = args[i]
+		case strings.HasPrefix(arg, "--onto="):
+			onto = strings.TrimPrefix(arg, "--onto=")
+		case arg == "--continue" || arg == "--abort" || arg == "--skip" || arg == "--quit" || arg == "--edit-todo":
+			if action != "" {
+				return usage("options '--%s' and '%s' cannot be used together", action, arg)
+			}
+			action = strings.TrimPrefix(arg, "--")
+		case arg == "--autosquash":
+			autoSquash = 1
+		case arg == "--no-autosquash":
+			autoSquash = 0
+		case arg == "--update-refs":
+			updateRefs = 1
+		case arg == "--no-update-refs":
+			updateRefs = 0
+		case arg == "--reapply-cherry-picks":
+			reapply = true
+		case arg == "--no-reapply-cherry-picks":
+			reapply = false
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "-m" || arg == "--merge":
+			// The merge backend is the only one.
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	s := newRebaseState(repo)
+	if action != "" {
+		if len(rest) > 0 {
+			return usage(rebaseUsage)
+		}
+		if !s.exists() {
+			return die("No rebase in progress?")
+		}
+		switch action {
+		case "continue":
+			return s.cont()
+		case "abort":
+			return s.abort()
+		case "skip":
+			return s.skip()
+		case "quit":
+			if err := os.RemoveAll(s.dir); err != nil {
+				return die("%v", err)
+			}
+			return 0
+		default:
+			return s.editTodo()
+		}
+	}
+	if len(rest) > 2 {
+		return usage(rebaseUsage)
+	}
+	if s.exists() {
+		rel, err := filepath.Rel(repo.WorkTree, s.dir)
+		if err != nil || repo.WorkTree == "" {
+			rel = s.dir
+		}
+		return die("It seems that there is already a rebase-merge directory, and\n"+
+			"I wonder if you are in the middle of another rebase.  If that is the\n"+
+			"case, please try\n\tgit rebase (--continue | --abort | --skip)\n"+
+			"If that is not the case, please\n\trm -fr \"%s\"\n"+
+			"and run me again.  I am stopping in case you still have something\n"+
+			"valuable there.\n", rel)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return die("%v", err)
+	}
+	if autoSquash < 0 {
+		if on, _ := cfg.Bool("rebase.autoSquash", false); on {
+			autoSquash = 1
+		}
+	}
+	if updateRefs < 0 {
+		if on, _ := cfg.Bool("rebase.updateRefs", false); on {
+			updateRefs = 1
+		}
+	}
+
+	upstreamName := ""
+	if len(rest) > 0 {
+		upstreamName = rest[0]
+	} else {
+		if upstreamName, err = trackingRef(repo, "", false); err != nil {
+			branch := "<branch>"
+			if head, err := currentBranch(repo); err == nil && head.ref != "" {
+				branch = head.name
+			}
+			fmt.Fprint(os.Stderr, "There is no tracking information for the current branch.\n"+
+				"Please specify which branch you want to rebase against.\n"+
+				"See git-rebase(1) for details.\n\n    git rebase '<branch>'\n\n"+
+				"If you wish to set tracking information for this branch you can do so with:\n\n"+
+				"    git branch --set-upstream-to=<remote>/<branch> "+branch+"\n\n")
+			return 1
+		}
+	}
+	upstream, err := resolveRevisionAs(repo, upstreamName, "commit")
+	if err == nil {
+		upstream, err = peelTo(repo, upstreamName, upstream, "commit")
+	}
+	if err != nil {
+		return die("invalid upstream '%s'", upstreamName)
+	}
+	ontoName, ontoSha := upstreamName, upstream
+	if onto != "" {
+		ontoName = onto
+		ontoSha, err = resolveRevisionAs(repo, onto, "commit")
+		if err == nil {
+			ontoSha, err = peelTo(repo, onto, ontoSha, "commit")
+		}
+		if err != nil {
+			return die("Does not point to a valid commit '%s'", onto)
+		}
+	}
+
+	head, err := currentBranch(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	switchTo := ""
+	if len(rest) == 2 {
+		branch := rest[1]
+		head = &branchInfo{name: branch}
+		if sha, err := repo.Refs().Resolve("refs/heads/" + branch); err == nil {
+			head.ref, head.commit = "refs/heads/"+branch, sha.Target
+		} else {
+			sha, err := resolveRevisionAs(repo, branch, "commit")
+			if err == nil {
+				sha, err = peelTo(repo, branch, sha, "commit")
+			}
+			if err != nil {
+				return die("no such branch/commit '%s'", branch)
+			}
+			head.commit = sha
+		}
+		switchTo = branch
+	}
+	if head.commit == "" {
+		return die("%v", fmt.Errorf("no such ref: HEAD"))
+	}
+
+	unstaged, staged, err := localChanges(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	if unstaged || staged {
+		if unstaged {
+			fmt.Fprintln(os.Stderr, "error: cannot rebase: You have unstaged changes.")
+			if staged {
+				fmt.Fprintln(os.Stderr, "error: additionally, your index contains uncommitted changes.")
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, "error: cannot rebase: Your index contains uncommitted changes.")
+		}
+		fmt.Fprintln(os.Stderr, "error: Please commit or stash them.")
+		return 1
+	}
+
+	headName := head.ref
+	if headName == "" {
+		headName = "detached HEAD"
+	}
+	if !interactive {
+		upToDate, err := rebaseUpToDate(repo, upstream, ontoSha, head.commit)
+		if err != nil {
+			return die("%v", err)
+		}
+		if upToDate {
+			if switchTo != "" {
+				if code := s.switchBranch(head, switchTo); code != 0 {
+					return code
+				}
+			}
+			if head.ref != "" {
+				fmt.Printf("Current branch %s is up to date.\n", head.name)
+			} else {
+				fmt.Println("HEAD is up to date.")
+			}
+			return 0
+		}
+	}
+
+	items, err := todoList(repo, upstream, head.commit, reapply)
+	if err != nil {
+		return die("%v", err)
+	}
+	var updated []string
+	if updateRefs == 1 {
+		if items, updated, err = addUpdateRefs(repo, items, head.ref); err != nil {
+			return die("%v", err)
+		}
+	}
+	if interactive && autoSquash == 1 {
+		items = autosquash(repo, items)
+	}
+
+	if err := os.MkdirAll(s.dir, 0o777); err != nil {
+		return die("%v", err)
+	}
+	s.quiet = quiet
+	files := map[string]string{
+		"head-name":                 headName + "\n",
+		"onto":                      ontoSha + "\n",
+		"orig-head":                 head.commit + "\n",
+		"interactive":               "",
+		"no-reschedule-failed-exec": "",
+	}
+	if !interactive {
+		// Without -i, the commits that became empty are dropped.
+		files["drop_redundant_commits"] = ""
+	}
+	if quiet {
+		files["quiet"] = ""
+	}
+	for name, content := range files {
+		if err := s.write(name, content); err != nil {
+			return die("%v", err)
+		}
+	}
+	updates := []refUpdate{}
+	for _, name := range updated {
+		ref, err := repo.Refs().Resolve(name)
+		if err != nil {
+			return die("%v", err)
+		}
+		updates = append(updates, refUpdate{name, ref.Target, repo.Format.ZeroHex()})
+	}
+	if len(updates) > 0 {
+		if err := s.writeUpdateRefs(updates); err != nil {
+			return die("%v", err)
+		}
+	}
+
+	if interactive {
+		if len(items) == 0 {
+			items = append(items, todoItem{command: "noop"})
+		}
+		abbrev := func(sha string) string { return repo.Objects().Abbrev(sha, defaultAbbrev(repo)) }
+		var b strings.Builder
+		for _, it := range items {
+			b.WriteString(it.format(abbrev) + "\n")
+		}
+		n := countCommands(items)
+		plural := "s"
+		if n == 1 {
+			plural = ""
+		}
+		fmt.Fprintf(&b, "\n# Rebase %s..%s onto %s (%d command%s)\n#", abbrev(upstream), abbrev(head.commit), abbrev(ontoSha), n, plural)
+		b.WriteString(todoHelp)
+		for _, name := range []string{"git-rebase-todo", "git-rebase-todo.backup"} {
+			if err := s.write(name, b.String()); err != nil {
+				return die("%v", err)
+			}
+		}
+		if err := launchEditor(sequenceEditor(repo), s.path("git-rebase-todo")); err != nil {
+			return die("%v", err)
+		}
+		if items, err = s.readTodo(); err != nil {
+			// Like git, leave HEAD at onto for the list to be fixed.
+			if code := s.detach(ontoSha, "checkout "+ontoName); code != 0 {
+				return code
+			}
+			return s.badTodo(err)
+		}
+		if countCommands(items) == 0 {
+			os.RemoveAll(s.dir)
+			fmt.Fprintln(os.Stderr, "error: nothing to do")
+			return 1
+		}
+		if err := s.filterUpdateRefs(items); err != nil {
+			return die("%v", err)
+		}
+	}
+	if err := s.writeTodo(items); err != nil {
+		return die("%v", err)
+	}
+	if err := s.writeEnd(); err != nil {
+		return die("%v", err)
+	}
+	if err := repo.Refs().Update("ORIG_HEAD", head.commit, "", "", true); err != nil {
+		return die("%v", err)
+	}
+	return s.begin("checkout " + ontoName)
+}
+
+// rebaseUpToDate tells whether head is already on top of onto, with
+// nothing of upstream that onto lacks, so that there is nothing to do.
+// ref: can_fast_forward in https://github.com/git/git/blob/master/builtin/rebase.c
+func rebaseUpToDate(repo *repository.Repository, upstream, onto, head string) (bool, error) {
+	bases, err := merge.Bases(repo.Objects(), onto, []string{head})
+	if err != nil || len(bases) != 1 || bases[0] != onto {
+		return false, err
+	}
+	if upstream == onto {
+		return true, nil
+	}
+	bases, err = merge.Bases(repo.Objects(), upstream, []string{head})
+	if err != nil || len(bases) != 1 {
+		return false, err
+	}
+	return bases[0] == onto, nil
+}
+
+// switchBranch switches to the branch a rebase is given, as
+// "rebase <upstream> <branch>" does before it finds there is nothing to
+// do.
+func (s *rebaseState) switchBranch(head *branchInfo, name string) int {
+	repo := s.repo
+	current, err := currentBranch(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	if code := checkoutCommit(repo, idx, current.commit, head.commit); code != 0 {
+		return code
+	}
+	msg := "rebase: checkout " + name
+	if head.ref != "" {
+		if err := repo.Refs().SetSymbolic(refs.HEAD, head.ref, msg); err != nil {
+			return die("%v", err)
+		}
+		return 0
+	}
+	if err := repo.Refs().Update(refs.HEAD, head.commit, current.commit, msg, true); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// writeEnd records the number of commands of the whole rebase, done or
+// not; the blank lines that end the todo list aren't counted.
+func (s *rebaseState) writeEnd() error {
+	done, err := parseTodo(s.repo, s.read("done"))
+	if err != nil {
+		return err
+	}
+	todo, err := s.readTodo()
+	if err != nil {
+		return err
+	}
+	for len(todo) > 0 && todo[len(todo)-1].command == "" {
+		todo = todo[:len(todo)-1]
+	}
+	return s.write("end", fmt.Sprintf("%d\n", len(done)+len(todo)))
+}
+
+// filterUpdateRefs forgets the branches whose update-ref was taken out
+// of the todo list.
+func (s *rebaseState) filterUpdateRefs(items []todoItem) error {
+	updates, err := s.readUpdateRefs()
+	if err != nil || len(updates) == 0 {
+		return err
+	}
+	kept := map[string]bool{}
+	for _, it := range items {
+		if it.command == "update-ref" {
+			kept[it.rest] = true
+		}
+	}
+	filtered := []refUpdate{}
+	for _, u := range updates {
+		if kept[u.name] {
+			filtered = append(filtered, u)
+		}
+	}
+	if len(filtered) == 0 {
+		s.remove("update-refs")
+		return nil
+	}
+	return s.writeUpdateRefs(filtered)
+}
+
+// begin starts on the todo list: the picks that would only recreate
+// the commits on top of onto are done already, and HEAD is detached at
+// the last of them.
+// ref: skip_unnecessary_picks in https://github.com/git/git/blob/master/sequencer.c
+func (s *rebaseState) begin(reflog string) int {
+	repo := s.repo
+	onto := s.readLine("onto")
+	items, err := s.readTodo()
+	if err != nil {
+		return s.badTodo(err)
+	}
+	var done strings.Builder
+	skipped := 0
+	for _, it := range items {
+		if it.command == "" {
+			done.WriteString("\n")
+			skipped++
+			continue
+		}
+		if it.command != "pick" {
+			break
+		}
+		c, err := readCommit(repo, it.sha)
+		if err != nil {
+			return die("%v", err)
+		}
+		if len(c.Parents) != 1 || c.Parents[0] != onto {
+			break
+		}
+		done.WriteString(it.format(func(sha string) string { return sha }) + "\n")
+		onto = it.sha
+		skipped++
+	}
+	// Blank lines before the first command left undone stay in the list.
+	for skipped > 0 && items[skipped-1].command == "" {
+		skipped--
+	}
+	text := strings.SplitAfter(done.String(), "\n")
+	if err := s.write("done", strings.Join(text[:skipped], "")); err != nil {
+		return die("%v", err)
+	}
+	if err := s.writeTodo(items[skipped:]); err != nil {
+		return die("%v", err)
+	}
+	if n := countCommands(items[:skipped]); n > 0 {
+		if err := s.write("msgnum", fmt.Sprintf("%d\n", n)); err != nil {
+			return die("%v", err)
+		}
+	}
+
+	if code := s.detach(onto, reflog); code != 0 {
+		return code
+	}
+	return s.run()
+}
+
+// detach checks out the commit to start from, with HEAD detached.
+func (s *rebaseState) detach(onto, reflog string) int {
+	repo := s.repo
+	head, err := currentBranch(repo)
+	if err != nil {
+		return die("%v", err)
+	}
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	if code := checkoutCommit(repo, idx, head.commit, onto); code != 0 {
+		return code
+	}
+	if err := repo.Refs().Update(refs.HEAD, onto, head.commit, "rebase (start): "+reflog, true); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// finish moves the branch to where the rebase ended, and HEAD back to
+// it, along with the branches of --update-refs.
+// ref: https://github.com/git/git/blob/master/sequencer.c
+func (s *rebaseState) finish() int {
+	repo := s.repo
+	headName := s.readLine("head-name")
+	head, err := s.head()
+	if err != nil {
+		return die("%v", err)
+	}
+	updates, err := s.readUpdateRefs()
+	if err != nil {
+		return die("%v", err)
+	}
+	updated := []string{}
+	for _, u := range updates {
+		if u.new == repo.Format.ZeroHex() {
+			continue
+		}
+		if err := repo.Refs().Update(u.name, u.new, u.old, "rewritten during rebase", false); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			continue
+		}
+		updated = append(updated, u.name)
+	}
+	if strings.HasPrefix(headName, "refs/") {
+		msg := fmt.Sprintf("rebase (finish): %s onto %s", headName, s.readLine("onto"))
+		if err := repo.Refs().Update(headName, head, "", msg, true); err != nil {
+			return die("%v", err)
+		}
+		if err := repo.Refs().SetSymbolic(refs.HEAD, headName, "rebase (finish): returning to "+headName); err != nil {
+			return die("%v", err)
+		}
+	}
+	os.Remove(repo.Path("REBASE_HEAD"))
+	if err := os.RemoveAll(s.dir); err != nil {
+		return die("%v", err)
+	}
+	s.clearLine()
+	if !s.quiet {
+		fmt.Fprintf(os.Stderr, "Successfully rebased and updated %s.\n", headName)
+	}
+	if len(updated) > 0 {
+		fmt.Fprintln(os.Stderr, "Updated the following refs with --update-refs:")
+		for _, name := range updated {
+			fmt.Fprintf(os.Stderr, "\t%s\n", name)
+		}
+	}
+	return 0
+}
+
+// cont goes on with a rebase that stopped: the resolved conflicts or
+// the changes made at an edit are committed first.
+func (s *rebaseState) cont() int {
+	repo := s.repo
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	stale, _, err := idx.Refresh(repo.WorkTree, repo.Format, false)
+	if err != nil {
+		return die("%v", err)
+	}
+	unmerged := false
+	for _, e := range stale {
+		if e.Unmerged {
+			fmt.Printf("%s: needs merge\n", e.Path)
+			unmerged = true
+		}
+	}
+	if unmerged {
+		fmt.Fprintln(os.Stderr, "You must edit all merge conflicts and then\nmark them as resolved using git add")
+		return 1
+	}
+	if _, err := s.readTodo(); err != nil {
+		printTodoError(err)
+		fmt.Fprintln(os.Stderr, "error: please fix this using 'git rebase --edit-todo'.")
+		return 1
+	}
+	if !s.has("end") {
+		if err := s.writeEnd(); err != nil {
+			return die("%v", err)
+		}
+	}
+	if code := s.commitStaged(idx); code != 0 {
+		return code
+	}
+	return s.run()
+}
+
+// commitStaged commits what the user staged at a stop: the resolution
+// of the conflicts of a pick, or the changes to amend the commit of an
+// edit with.
+// ref: commit_staged_changes in https://github.com/git/git/blob/master/sequencer.c
+func (s *rebaseState) commitStaged(idx *index.Index) int {
+	repo := s.repo
+	head, err := s.head()
+	if err != nil {
+		return die("%v", err)
+	}
+	headTree, err := peelTo(repo, head, head, "tree")
+	if err != nil {
+		return die("%v", err)
+	}
+	tree, err := unpack.WriteTree(repo.Objects(), idx.Entries)
+	if err != nil {
+		return die("%v", err)
+	}
+	staged := tree != headTree
+	amend := s.readLine("amend")
+	stopped := s.has("stopped-sha")
+	defer func() {
+		s.remove("stopped-sha", "message", "author-script")
+		os.Remove(repo.Path("REBASE_HEAD"))
+		os.Remove(repo.Path("MERGE_MSG"))
+	}()
+	switch {
+	case amend != "" && amend != head:
+		fmt.Fprintln(os.Stderr, "error: there is nothing to amend")
+		fmt.Fprint(os.Stderr, "You have uncommitted changes in your working tree. Please, commit them\nfirst and then run 'git rebase --continue' again.\n")
+		return 1
+	case amend != "" && s.has("current-fixups"):
+		items, err := s.readTodo()
+		if err != nil {
+			return s.badTodo(err)
+		}
+		return s.commitFixup("continue", items, tree, true)
+	case amend != "":
+		s.remove("amend")
+		if !staged {
+			return 0
+		}
+		return s.amend(head, "rebase (continue)")
+	case stopped:
+		if !staged {
+			return 0
+		}
+		author, err := s.readAuthorScript()
+		if err != nil {
+			return die("%v", err)
+		}
+		msg, ok := s.editCommitMessage(s.read("message"))
+		if !ok {
+			return 1
+		}
+		sha, err := createCommit(repo, tree, []string{head}, msg, author)
+		if err != nil {
+			return die("%v", err)
+		}
+		subject, _, _ := strings.Cut(msg, "\n")
+		if err := repo.Refs().Update(refs.HEAD, sha, head, "rebase (continue): "+subject, true); err != nil {
+			return die("%v", err)
+		}
+		if err := printCommitSummary(repo, &branchInfo{name: refs.HEAD, commit: head}, sha, false); err != nil {
+			return die("%v", err)
+		}
+	case staged:
+		fmt.Fprint(os.Stderr, "error: you have staged changes in your working tree\n"+
+			"If these changes are meant to be squashed into the previous commit, run:\n\n"+
+			"  git commit --amend \n\n"+
+			"If they are meant to go into a new commit, run:\n\n"+
+			"  git commit \n\n"+
+			"In both cases, once you're done, continue with:\n\n"+
+			"  git rebase --continue\n\n")
+		return 1
+	}
+	return 0
+}
+
+// resetHard moves the index and the work tree to a commit, throwing
+// local changes away.
+func resetHard(repo *repository.Repository, commit string) int {
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	tree, err := peelTo(repo, commit, commit, "tree")
+	if err != nil {
+		return die("%v", err)
+	}
+	err = unpack.OneWay(idx, tree, unpack.Options{Store: repo.Objects(), WorkTree: repo.WorkTree, Action: "reset"})
+	var unpackErr *unpack.Error
+	if errors.As(err, &unpackErr) {
+		for _, msg := range unpackErr.Messages() {
+			fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+		}
+		return die("could not move back to %s", commit)
+	}
+	if err != nil {
+		return die("%v", err)
+	}
+	if err := idx.Write(repo.IndexFile(), repo.Format); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// abort goes back to the branch and the commit the rebase started from.
+func (s *rebaseState) abort() int {
+	repo := s.repo
+	headName, origHead := s.readLine("head-name"), s.readLine("orig-head")
+	head, err := s.head()
+	if err != nil {
+		return die("%v", err)
+	}
+	if code := resetHard(repo, origHead); code != 0 {
+		return code
+	}
+	if strings.HasPrefix(headName, "refs/") {
+		if err := repo.Refs().SetSymbolic(refs.HEAD, headName, "rebase (abort): returning to "+headName); err != nil {
+			return die("%v", err)
+		}
+	} else if err := repo.Refs().Update(refs.HEAD, origHead, head, "rebase (abort): returning to "+origHead, true); err != nil {
+		return die("%v", err)
+	}
+	removeMergeState(repo)
+	os.Remove(repo.Path("REBASE_HEAD"))
+	if err := os.RemoveAll(s.dir); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// skip throws the changes of the commit the rebase stopped at away and
+// goes on with the next.
+func (s *rebaseState) skip() int {
+	repo := s.repo
+	head, err := s.head()
+	if err != nil {
+		return die("%v", err)
+	}
+	if code := resetHard(repo, head); code != 0 {
+		return code
+	}
+	removeMergeState(repo)
+	os.Remove(repo.Path("REBASE_HEAD"))
+	s.remove("stopped-sha", "message", "author-script", "amend")
+	return s.run()
+}
+
+// editTodo lets the user edit what is left to do. The lines of a list
+// that doesn't parse are kept as they are.
+func (s *rebaseState) editTodo() int {
+	repo := s.repo
+	abbrev := func(sha string) string { return repo.Objects().Abbrev(sha, defaultAbbrev(repo)) }
+	var b strings.Builder
+	if _, err := s.readTodo(); err != nil {
+		printTodoError(err)
+	}
+	for _, line := range strings.SplitAfter(s.read("git-rebase-todo"), "\n") {
+		if line == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		items, err := parseTodo(repo, line)
+		if err != nil || len(items) != 1 {
+			b.WriteString(strings.TrimSuffix(line, "\n") + "\n")
+			continue
+		}
+		b.WriteString(items[0].format(abbrev) + "\n")
+	}
+	b.WriteString("#" + strings.TrimSuffix(todoHelp, "# However, if you remove everything, the rebase will be aborted.\n#\n"))
+	b.WriteString("# You are editing the todo file of an ongoing interactive rebase.\n" +
+		"# To continue rebase after editing, run:\n#     git rebase --continue\n#\n")
+	if err := s.write("git-rebase-todo", b.String()); err != nil {
+		return die("%v", err)
+	}
+	if err := launchEditor(sequenceEditor(repo), s.path("git-rebase-todo")); err != nil {
+		return die("%v", err)
+	}
+	items, err := s.readTodo()
+	if err != nil {
+		return s.badTodo(err)
+	}
+	if err := s.writeTodo(items); err != nil {
+		return die("%v", err)
+	}
+	if err := s.writeEnd(); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// Reflog implements "reflog" and its show, expire, delete, exists and
+// list subcommands.
+// ref: https://git-scm.com/docs/git-reflog
+func Reflog(args []string) int {
+	sub := "show"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "show", "expire", "delete", "exists", "list":
+			sub, args = args[0], args[1:]
+		}
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	switch sub {
+	case "expire":
+		return reflogExpire(repo, args)
+	case "delete":
+		return reflogDelete(repo, args)
+	case "exists":
+		if len(args) != 1 {
+			return usage("usage: reflog exists <ref>")
+		}
+		if repo.Refs().HasReflog(args[0]) {
+			return 0
+		}
+		return 1
+	case "list":
+		names, err := repo.Refs().ListReflogs()
+		if err != nil {
+			return die("%v", err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return 0
+	}
+	return reflogShow(repo, args)
+}
+
+// reflogShow prints "<abbrev> <ref>@{<n>}: <message>", newest first.
+func reflogShow(repo *repository.Repository, args []string) int {
+	maxCount := -1
+	dateStyle := ""
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-n" && i+1 < len(args):
+			i++
+			arg = "--max-count=" + args[i]
+			fallthrough
+		case strings.HasPrefix(arg, "--max-count="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-count="))
+			if err != nil {
+				return die("'%s': not an integer", arg)
+			}
+			maxCount = n
+		case strings.HasPrefix(arg, "-n") && len(arg) > 2:
+			n, err := strconv.Atoi(arg[2:])
+			if err != nil {
+				return die("'%s': not an integer", arg)
+			}
+			maxCount = n
+		case strings.HasPrefix(arg, "--date="):
+			dateStyle = strings.TrimPrefix(arg, "--date=")
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) > 1 {
+		return usage("usage: reflog [show] [<options>] [<ref>]")
+	}
+	name := refs.HEAD
+	if len(rest) == 1 {
+		name = rest[0]
+	}
+	full, err := reflogRef(repo, name)
+	if err != nil {
+		return die("%v", err)
+	}
+	entries, err := repo.Refs().ReadReflog(full)
+	if err != nil && !refs.IsNotFound(err) {
+		return die("%v", err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for n := 0; n < len(entries) && n != maxCount; n++ {
+		entry := entries[len(entries)-1-n]
+		selector := strconv.Itoa(n)
+		if dateStyle != "" {
+			if selector, err = date.Format(entry.When, dateStyle); err != nil {
+				return die("%v", err)
+			}
+		}
+		fmt.Fprintf(out, "%s %s@{%s}: %s\n", entry.New[:7], name, selector, entry.Message)
+	}
+	return 0
+}
+
+// reflogRewriteOptions are shared by "reflog expire" and "reflog delete".
+type reflogRewriteOptions struct {
+	dryRun    bool
+	rewrite   bool
+	updateRef bool
+	verbose   bool
+}
+
+func (o *reflogRewriteOptions) parse(arg string) bool {
+	switch arg {
+	case "-n", "--dry-run":
+		o.dryRun = true
+	case "--rewrite":
+		o.rewrite = true
+	case "--updateref":
+		o.updateRef = true
+	case "--verbose":
+		o.verbose = true
+	default:
+		return false
+	}
+	return true
+}
+
+// rewriteReflog stores the entries kept for name. With --rewrite the old
+// value of each entry is adjusted to the entry before it, with
+// --updateref the ref is set to the newest entry left.
+func rewriteReflog(repo *repository.Repository, name string, entries, kept []*refs.ReflogEntry, opts reflogRewriteOptions) error {
+	if opts.verbose {
+		for _, entry := range entries {
+			verb := "prune"
+			for _, k := range kept {
+				if k == entry {
+					verb = "keep"
+				}
+			}
+			fmt.Printf("%s %s\n", verb, entry.Message)
+		}
+	}
+	if opts.dryRun {
+		return nil
+	}
+	if opts.rewrite {
+		for i := 1; i < len(kept); i++ {
+			kept[i].Old = kept[i-1].New
+		}
+	}
+	if err := repo.Refs().WriteReflog(name, kept); err != nil {
+		return err
+	}
+	if opts.updateRef && len(kept) > 0 {
+		ref, err := repo.Refs().Read(name)
+		if err == nil && !ref.IsSymbolic() && ref.Target != kept[len(kept)-1].New {
+			return repo.Refs().Write(name, kept[len(kept)-1].New, ref.Target)
+		}
+	}
+	return nil
+}
+
+// parseExpiry reads the value of --expire and gc.reflogExpire: "never"
+// keeps everything, "now" and "all" drop everything.
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	switch strings.ToLower(value) {
+	case "never", "false":
+		return time.Time{}, nil
+	case "all", "now":
+		return now.Add(time.Second), nil
+	}
+	return date.Approx(value, now)
+}
+
+func reflogExpire(repo *repository.Repository, args []string) int {
+	now := time.Now()
+	expireValue, unreachableValue := "90.days.ago", "30.days.ago"
+	if cfg, err := repo.Config(); err == nil {
+		if value, ok := cfg.Get("gc.reflogexpire"); ok {
+			expireValue = value
+		}
+		if value, ok := cfg.Get("gc.reflogexpireunreachable"); ok {
+			unreachableValue = value
+		}
+	}
+	all := false
+	opts := reflogRewriteOptions{}
+	names := []string{}
+	for _, arg := range args {
+		switch {
+		case opts.parse(arg):
+		case strings.HasPrefix(arg, "--expire="):
+			expireValue = strings.TrimPrefix(arg, "--expire=")
+		case strings.HasPrefix(arg, "--expire-unreachable="):
+			unreachableValue = strings.TrimPrefix(arg, "--expire-unreachable=")
+		case arg == "--all":
+			all = true
+		case arg == "--stale-fix" || arg == "--single-worktree":
+		case strings.HasPrefix(arg, "-"):
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			names = append(names, arg)
+		}
+	}
+	expire, err := parseExpiry(expireValue, now)
+	if err != nil {
+		return die("'%s' is not a valid timestamp", expireValue)
+	}
+	expireUnreachable, err := parseExpiry(unreachableValue, now)
+	if err != nil {
+		return die("'%s' is not a valid timestamp", unreachableValue)
+	}
+	if all {
+		if names, err = repo.Refs().ListReflogs(); err != nil {
+			return die("%v", err)
+		}
+	}
+	status := 0
+	for _, name := range names {
+		full, err := reflogRef(repo, name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s points nowhere!\n", name)
+			status = 1
+			continue
+		}
+		entries, err := repo.Refs().ReadReflog(full)
+		if err != nil {
+			continue
+		}
+		var reachable map[string]bool
+		kept := []*refs.ReflogEntry{}
+		for _, entry := range entries {
+			if entry.When.Before(expire) {
+				continue
+			}
+			if entry.When.Before(expireUnreachable) {
+				if reachable == nil {
+					reachable = reachableFrom(repo, full)
+				}
+				if !reachable[entry.New] {
+					continue
+				}
+			}
+			kept = append(kept, entry)
+		}
+		if err := rewriteReflog(repo, full, entries, kept, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// reachableFrom collects the commits reachable from the tip of name.
+func reachableFrom(repo *repository.Repository, name string) map[string]bool {
+	seen := map[string]bool{}
+	ref, err := repo.Refs().Resolve(name)
+	if err != nil {
+		return seen
+	}
+	queue := []string{ref.Target}
+	for len(queue) > 0 {
+		sha := queue[0]
+		queue = queue[1:]
+		if seen[sha] {
+			continue
+		}
+		seen[sha] = true
+		info, err := readObjectInfo(repo.Objects(), sha)
+		if err != nil || info.typ != "commit" {
+			continue
+		}
+		queue = append(queue, info.headerAll("parent")...)
+	}
+	return seen
+}
+
+func reflogDelete(repo *repository.Repository, args []string) int {
+	opts := reflogRewriteOptions{}
+	specs := []string{}
+	for _, arg := range args {
+		switch {
+		case opts.parse(arg):
+		case strings.HasPrefix(arg, "-"):
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			specs = append(specs, arg)
+		}
+	}
+	if len(specs) == 0 {
+		return die("no reflog specified to delete")
+	}
+	status := 0
+	for _, spec := range specs {
+		i := strings.Index(spec, "@{")
+		if i < 0 || !strings.HasSuffix(spec, "}") {
+			fmt.Fprintf(os.Stderr, "error: not a reflog: %s\n", spec)
+			status = 1
+			continue
+		}
+		full, err := reflogRef(repo, spec[:i])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			status = 1
+			continue
+		}
+		entries, err := repo.Refs().ReadReflog(full)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: no reflog for '%s'\n", spec)
+			status = 1
+			continue
+		}
+		n, err := strconv.Atoi(spec[i+2 : len(spec)-1])
+		if err != nil || n < 0 || n >= len(entries) {
+			fmt.Fprintf(os.Stderr, "error: invalid reflog entry: %s\n", spec)
+			status = 1
+			continue
+		}
+		drop := len(entries) - 1 - n
+		kept := append(append([]*refs.ReflogEntry{}, entries[:drop]...), entries[drop+1:]...)
+		if err := rewriteReflog(repo, full, entries, kept, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// reflogSelector is the reflog entry a commit is shown for by
+// --walk-reflogs.
+type reflogSelector struct {
+	name  string // the ref as named on the command line
+	index int    // of the entry, counting from the newest
+	by    string // "", "index" or "date": how the revision chose the entry
+	entry *refs.ReflogEntry
+}
+
+// selector names the entry as "<ref>@{<n>}", with its date in place of n
+// when the revision named it by date or --date was given, like git's
+// get_reflog_selector.
+func (s *reflogSelector) selector(ctx *prettyContext, short bool) string {
+	name := s.name
+	if short {
+		name = refs.Shorten(name, ctx.repo.Refs().Exists)
+	}
+	at := strconv.Itoa(s.index)
+	if s.by == "date" || s.by == "" && ctx.dateExplicit {
+		at, _ = date.Format(s.entry.When, ctx.dateStyle)
+	}
+	return name + "@{" + at + "}"
+}
+
+// reflogWalk is the reflog of one revision walked by --walk-reflogs.
+type reflogWalk struct {
+	name    string
+	by      string
+	entries []*refs.ReflogEntry // oldest first
+	next    int                 // the next entry, counting from the newest
+}
+
+// openReflogWalk reads the reflog a revision names: "<ref>",
+// "<ref>@{<n>}" or "<ref>@{<date>}", the latter starting at that entry.
+// A revision without a reflog has nothing to walk.
+func openReflogWalk(repo *repository.Repository, rev string) *reflogWalk {
+	name, at := rev, ""
+	if i := strings.Index(rev, "@{"); i >= 0 && strings.HasSuffix(rev, "}") {
+		name, at = rev[:i], rev[i+2:len(rev)-1]
+	}
+	full, err := reflogRef(repo, name)
+	if err != nil {
+		return nil
+	}
+	entries, err := repo.Refs().ReadReflog(full)
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+	if name == "" {
+		name = refs.Shorten(full, repo.Refs().Exists)
+	}
+	r := &reflogWalk{name: name, entries: entries}
+	if at == "" {
+		return r
+	}
+	if n, err := strconv.Atoi(at); err == nil && n >= 0 {
+		r.by, r.next = "index", n
+		return r
+	}
+	when, err := date.Approx(at, time.Now())
+	if err != nil {
+		return nil
+	}
+	r.by, r.next = "date", len(entries)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].When.After(when) {
+			r.next = len(entries) - 1 - i
+			break
+		}
+	}
+	return r
+}
+
+// entry is the next entry of the walk.
+func (r *reflogWalk) entry() *refs.ReflogEntry {
+	return r.entries[len(r.entries)-1-r.next]
+}
+
+// commit skips the entries that don't name a commit and returns that of
+// the next one, nil at the end of the reflog.
+func (r *reflogWalk) commit(w *revWalk) *commitNode {
+	for ; r.next < len(r.entries); r.next++ {
+		if n, err := w.load(r.entry().New); err == nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// reflogCommits lists the commits of the reflogs of the revisions for
+// --walk-reflogs, newest entry first across the reflogs, like git's
+// reflog-walk.c. The filters of the walk apply to each entry, dated by
+// the entry rather than by the commit.
+// ref: https://git-scm.com/docs/git-log#Documentation/git-log.txt---walk-reflogs
+func (w *revWalk) reflogCommits() ([]*commitNode, error) {
+	if w.reverse {
+		return nil, errors.New("options '--reverse' and '--walk-reflogs' cannot be used together")
+	}
+	if w.order != "" {
+		return nil, errors.New("cannot combine --walk-reflogs with history-limiting options")
+	}
+	if err := w.compilePatterns(); err != nil {
+		return nil, err
+	}
+	walks := []*reflogWalk{}
+	for _, start := range w.starts[w.reflogFrom:] {
+		if start.not {
+			return nil, fmt.Errorf("cannot walk reflogs for %s", start.rev)
+		}
+		if r := openReflogWalk(w.repo, start.rev); r != nil {
+			walks = append(walks, r)
+		}
+	}
+	shown := []*commitNode{}
+	for w.maxCount < 0 || len(shown) < w.maxCount {
+		var best *reflogWalk
+		var n *commitNode
+		for _, r := range walks {
+			c := r.commit(w)
+			if c != nil && (best == nil || r.entry().When.After(best.entry().When)) {
+				best, n = r, c
+			}
+		}
+		if best == nil {
+			break
+		}
+		entry := best.entry()
+		s := &reflogSelector{name: best.name, index: best.next, by: best.by, entry: entry}
+		best.next++
+		if w.since != nil && entry.When.Before(*w.since) {
+			continue
+		}
+		if len(w.paths) > 0 && w.flags[n.sha]&walkAdded == 0 {
+			w.flags[n.sha] |= walkAdded
+			if err := w.simplify(n); err != nil {
+				return nil, err
+			}
+		}
+		// The same commit may be shown for several entries.
+		c := *n
+		c.when = entry.When.Unix()
+		c.reflog = s
+		if !w.wanted(&c) {
+			continue
+		}
+		if w.skipped < w.skip {
+			w.skipped++
+			continue
+		}
+		shown = append(shown, &c)
+	}
+	return shown, nil
+}
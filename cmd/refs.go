@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// Refs implements "refs migrate".
+// ref: https://git-scm.com/docs/git-refs
+func Refs(args []string) int {
+	if len(args) == 0 || args[0] != "migrate" {
+		return usage("usage: refs migrate --ref-format=<format> [--dry-run]")
+	}
+	format, dryRun := "", false
+	for _, arg := range args[1:] {
+		switch {
+		case strings.HasPrefix(arg, "--ref-format="):
+			format = strings.TrimPrefix(arg, "--ref-format=")
+		case arg == "--dry-run":
+			dryRun = true
+		default:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		}
+	}
+	if format == "" {
+		return usage("missing --ref-format=<format>")
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	opts := repository.MigrateOptions{DryRun: dryRun}
+	opts.Peel = func(sha string) string {
+		peeled, _, err := peel(repo.Objects(), sha)
+		if err != nil {
+			return sha
+		}
+		return peeled
+	}
+	path, err := repo.MigrateRefs(format, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if dryRun {
+		fmt.Printf("Finished dry-run migration of refs, the result can be found at '%s'\n", path)
+	}
+	return 0
+}
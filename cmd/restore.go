@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/unpack"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/wildmatch"
+)
+
+// restoreOptions say where restore, or checkout with paths, takes files
+// from and what it puts them back into.
+type restoreOptions struct {
+	command  string // "restore" or "checkout"
+	source   string // the tree-ish to restore from, "" for the index
+	staged   bool   // restore the index
+	worktree bool   // restore the work tree
+	overlay  bool   // keep the files the source doesn't have
+	quiet    bool
+	count    bool     // tell how many files were written
+	specs    []string // the pathspecs as given
+}
+
+// Restore implements "restore": files of the work tree come back from
+// the index, or with --staged index entries come back from HEAD, or both
+// from --source. Files the source doesn't have are removed.
+// ref: https://git-scm.com/docs/git-restore
+func Restore(args []string) int {
+	o := &restoreOptions{command: "restore"}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			o.specs = append(o.specs, args[i+1:]...)
+			i = len(args)
+		case arg == "-s" || arg == "--source":
+			if i+1 >= len(args) {
+				return usage("switch `s' requires a value")
+			}
+			i++
+			o.source = args[i]
+		case strings.HasPrefix(arg, "--source="):
+			o.source = strings.TrimPrefix(arg, "--source=")
+		case arg == "--staged":
+			o.staged = true
+		case arg == "--worktree":
+			o.worktree = true
+		case arg == "--quiet":
+			o.quiet = true
+		case arg == "--overlay":
+			o.overlay = true
+		case arg == "--no-overlay":
+			o.overlay = false
+		case strings.HasPrefix(arg, "-s") && len(arg) > 2:
+			o.source = arg[2:]
+		case strings.HasPrefix(arg, "-") && len(arg) > 1 && !strings.HasPrefix(arg, "--") && strings.Trim(arg[1:], "SWq") == "":
+			o.staged = o.staged || strings.Contains(arg, "S")
+			o.worktree = o.worktree || strings.Contains(arg, "W")
+			o.quiet = o.quiet || strings.Contains(arg, "q")
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			o.specs = append(o.specs, arg)
+		}
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	if repo.IsBare() {
+		return die("this operation must be run in a work tree")
+	}
+	if len(o.specs) == 0 {
+		return die("you must specify path(s) to restore")
+	}
+	if !o.staged {
+		o.worktree = true
+	}
+	if o.staged && o.source == "" {
+		o.source = "HEAD"
+	}
+	return restorePaths(repo, o)
+}
+
+// matchPathspec reports whether path, relative to the top, matches a
+// pathspec made relative to the top: it is the path, a directory above
+// it, or a glob matching it.
+func matchPathspec(spec, path string) bool {
+	if spec == "" || path == spec || strings.HasPrefix(path, spec+"/") {
+		return true
+	}
+	return strings.ContainsAny(spec, "*?[") && wildmatch.Match(spec, path, 0)
+}
+
+// restorePaths puts the files matching the pathspecs back from the index
+// or the source tree-ish, into the index and the work tree as asked.
+// ref: checkout_paths in https://github.com/git/git/blob/master/builtin/checkout.c
+func restorePaths(repo *repository.Repository, o *restoreOptions) int {
+	paths := diffPaths(repo, o.specs)
+	matched := make([]bool, len(paths))
+	match := func(path string) bool {
+		found := false
+		for i, spec := range paths {
+			if matchPathspec(spec, path) {
+				matched[i] = true
+				found = true
+			}
+		}
+		return found
+	}
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	store := repo.Objects()
+
+	var tree string
+	sources := map[string]*index.Entry{}
+	var sourceList []*index.Entry
+	if o.source != "" {
+		sha, err := resolveRevision(repo, o.source)
+		if err == nil {
+			tree, err = peelTo(repo, o.source, sha, "tree")
+		}
+		if err != nil {
+			if o.command == "checkout" {
+				return die("invalid reference: %s", o.source)
+			}
+			return die("could not resolve %s", o.source)
+		}
+		entries, err := unpack.ReadTree(store, tree)
+		if err != nil {
+			return die("%v", err)
+		}
+		for _, e := range entries {
+			if match(e.Path) {
+				sources[e.Path] = e
+				sourceList = append(sourceList, e)
+			}
+		}
+	}
+	// The index entries to restore, or with a source, to remove.
+	selected := []*index.Entry{}
+	for _, e := range idx.Entries {
+		if o.source != "" && (o.overlay || sources[e.Path] != nil) {
+			continue
+		}
+		if match(e.Path) {
+			selected = append(selected, e)
+		}
+	}
+	failed := false
+	for i, spec := range o.specs {
+		if !matched[i] {
+			fmt.Fprintf(os.Stderr, "error: pathspec '%s' did not match any file(s) known to git\n", spec)
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	if o.source == "" {
+		for i, e := range selected {
+			if e.Stage > 0 && (i == 0 || selected[i-1].Path != e.Path) {
+				fmt.Fprintf(os.Stderr, "error: path '%s' is unmerged\n", e.Path)
+				failed = true
+			}
+		}
+		if failed {
+			return 1
+		}
+	}
+
+	written := 0
+	checkout := func(e *index.Entry) error {
+		if _, err := os.Lstat(filepath.Join(repo.WorkTree, filepath.FromSlash(e.Path))); err == nil {
+			if clean, err := unpack.Clean(idx, e, repo.WorkTree, repo.Format); err != nil || clean {
+				return err
+			}
+		}
+		written++
+		return unpack.CheckoutEntry(store, repo.WorkTree, e)
+	}
+	if o.source == "" {
+		for _, e := range selected {
+			if err := checkout(e); err != nil {
+				return die("%v", err)
+			}
+		}
+	} else {
+		removed := map[string]bool{}
+		for _, e := range selected {
+			if o.staged {
+				removed[e.Path] = true
+			}
+			if o.worktree {
+				if err := unpack.RemoveFile(repo.WorkTree, e.Path); err != nil {
+					return die("%v", err)
+				}
+			}
+		}
+		added := []*index.Entry{}
+		for _, src := range sourceList {
+			e := src
+			if cur := idx.Find(src.Path, 0); cur != nil && cur.Mode == src.Mode && cur.Sha == src.Sha {
+				e = cur
+			}
+			if o.worktree {
+				if err := checkout(e); err != nil {
+					return die("%v", err)
+				}
+			}
+			if o.staged {
+				removed[e.Path] = true
+				added = append(added, e)
+			}
+		}
+		if o.staged {
+			entries := added
+			for _, e := range idx.Entries {
+				if !removed[e.Path] {
+					entries = append(entries, e)
+				}
+			}
+			sort.Slice(entries, func(i, j int) bool {
+				a, b := entries[i], entries[j]
+				return a.Path < b.Path || a.Path == b.Path && a.Stage < b.Stage
+			})
+			idx.Entries = entries
+			idx.Extensions = nil
+		}
+	}
+	if err := idx.Write(repo.IndexFile(), repo.Format); err != nil {
+		return die("%v", err)
+	}
+	if o.count && !o.quiet {
+		paths := "paths"
+		if written == 1 {
+			paths = "path"
+		}
+		from := "the index"
+		if o.source != "" {
+			from = store.Abbrev(tree, defaultAbbrev(repo))
+		}
+		fmt.Fprintf(os.Stderr, "Updated %d %s from %s\n", written, paths, from)
+	}
+	return 0
+}
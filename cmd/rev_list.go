@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RevList implements "rev-list".
+// ref: https://git-scm.com/docs/git-rev-list
+func RevList(args []string) int {
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	w := newRevWalk(repo)
+	rest, err := w.parseArgs(args)
+	if err != nil {
+		return die("%v", err)
+	}
+	count, parents, timestamp, quiet := false, false, false, false
+	abbrev := 0
+	for _, arg := range rest {
+		switch {
+		case arg == "--count":
+			count = true
+		case arg == "--parents":
+			parents = true
+		case arg == "--timestamp":
+			timestamp = true
+		case arg == "--quiet":
+			quiet = true
+		case arg == "--abbrev-commit":
+			if abbrev == 0 {
+				abbrev = defaultAbbrev(repo)
+			}
+		case strings.HasPrefix(arg, "--abbrev="):
+			abbrev = parseAbbrev(strings.TrimPrefix(arg, "--abbrev="))
+		case arg == "--no-abbrev-commit":
+			abbrev = 0
+		default:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		}
+	}
+	w.rewrite = parents
+	if !w.revGiven {
+		return usage("no revisions given")
+	}
+
+	commits, err := w.commits()
+	if err != nil {
+		return die("%v", err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	if count {
+		fmt.Fprintln(out, len(commits))
+		return 0
+	}
+	name := func(sha string) string {
+		if abbrev > 0 {
+			return repo.Objects().Abbrev(sha, abbrev)
+		}
+		return sha
+	}
+	for _, n := range commits {
+		if quiet {
+			continue
+		}
+		if timestamp {
+			fmt.Fprintf(out, "%d ", n.when)
+		}
+		fmt.Fprint(out, name(n.sha))
+		if parents {
+			for _, p := range w.shownParents(n) {
+				fmt.Fprint(out, " "+name(p))
+			}
+		}
+		fmt.Fprintln(out)
+	}
+	if !w.objects {
+		return 0
+	}
+	err = w.listObjects(commits, func(sha, path string) {
+		if !quiet {
+			fmt.Fprintln(out, sha+" "+path)
+		}
+	})
+	if err != nil {
+		out.Flush()
+		return die("%v", err)
+	}
+	return 0
+}
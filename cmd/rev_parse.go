@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// RevParse implements "rev-parse".
+// ref: https://git-scm.com/docs/git-rev-parse
+func RevParse(args []string) int {
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	fail := func(code int) int {
+		out.Flush()
+		return code
+	}
+
+	verify, quiet := false, false
+	abbrev := 0    // length of abbreviated names, 0 for full ones
+	symbolic := "" // "full" or "abbrev" to print ref names instead
+	verifyRevs := []string{}
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			if !verify {
+				fmt.Fprintln(out, arg)
+				for _, p := range args[i+1:] {
+					fmt.Fprintln(out, p)
+				}
+			}
+			return revParseVerify(repo, out, verifyRevs, verify, quiet, abbrev, symbolic)
+		case arg == "--verify":
+			verify = true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--short":
+			verify, abbrev = true, defaultAbbrev(repo)
+		case strings.HasPrefix(arg, "--short="):
+			verify, abbrev = true, parseAbbrev(strings.TrimPrefix(arg, "--short="))
+		case arg == "--abbrev-ref" || arg == "--abbrev-ref=strict" || arg == "--abbrev-ref=loose":
+			symbolic = "abbrev"
+		case arg == "--symbolic-full-name":
+			symbolic = "full"
+		case arg == "--show-toplevel":
+			if repo.IsBare() {
+				return fail(die("this operation must be run in a work tree"))
+			}
+			fmt.Fprintln(out, repo.WorkTree)
+		case arg == "--git-dir":
+			fmt.Fprintln(out, displayGitDir(repo))
+		case arg == "--absolute-git-dir" || arg == "--git-common-dir":
+			fmt.Fprintln(out, repo.GitDir)
+		case arg == "--show-prefix":
+			if repo.Prefix != "" {
+				fmt.Fprintln(out, repo.Prefix+"/")
+			} else {
+				fmt.Fprintln(out)
+			}
+		case arg == "--show-cdup":
+			if repo.Prefix != "" {
+				fmt.Fprintln(out, strings.Repeat("../", strings.Count(repo.Prefix, "/")+1))
+			} else {
+				fmt.Fprintln(out)
+			}
+		case arg == "--is-inside-work-tree":
+			fmt.Fprintln(out, insideWorkTree(repo) && !insideGitDir(repo))
+		case arg == "--is-inside-git-dir":
+			fmt.Fprintln(out, insideGitDir(repo))
+		case arg == "--is-bare-repository":
+			fmt.Fprintln(out, repo.IsBare())
+		case arg == "--show-object-format":
+			fmt.Fprintln(out, repo.Format)
+		case arg == "--show-ref-format":
+			fmt.Fprintln(out, repo.RefFormat)
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// Options of other commands are passed through.
+			if !verify {
+				fmt.Fprintln(out, arg)
+			}
+		case verify:
+			verifyRevs = append(verifyRevs, arg)
+		default:
+			if code := revParseShow(repo, out, arg, abbrev, symbolic); code != 0 {
+				return fail(code)
+			}
+		}
+	}
+	return revParseVerify(repo, out, verifyRevs, verify, quiet, abbrev, symbolic)
+}
+
+// revParseVerify prints the single revision given with --verify.
+func revParseVerify(repo *repository.Repository, out *bufio.Writer, revs []string, verify, quiet bool, abbrev int, symbolic string) int {
+	if !verify {
+		return 0
+	}
+	fail := func() int {
+		out.Flush()
+		if quiet {
+			return 1
+		}
+		return die("Needed a single revision")
+	}
+	if len(revs) != 1 {
+		return fail()
+	}
+	sha, err := resolveRevision(repo, revs[0])
+	if err != nil {
+		return fail()
+	}
+	revParsePrint(repo, out, revs[0], sha, "", abbrev, symbolic)
+	return 0
+}
+
+// revParseShow prints one revision argument: a revision, "^<rev>",
+// "<rev>..<rev>" or "<rev>...<rev>".
+func revParseShow(repo *repository.Repository, out *bufio.Writer, arg string, abbrev int, symbolic string) int {
+	resolve := func(rev string) (string, int) {
+		sha, err := resolveRevision(repo, rev)
+		if err == nil {
+			return sha, 0
+		}
+		var outside *outsideRepositoryError
+		if errors.As(err, &outside) {
+			return "", die("%v", err)
+		}
+		code := 0
+		if isUnknownRevision(err) {
+			code = die("%s", ambiguousArgument(arg))
+		} else {
+			code = die("%v", err)
+		}
+		// Like git, the argument is still shown as a path before exiting.
+		fmt.Fprintln(out, arg)
+		out.Flush()
+		return "", code
+	}
+	if i := strings.Index(arg, "..."); i >= 0 {
+		left, right := arg[:i], arg[i+3:]
+		if left == "" {
+			left = refs.HEAD
+		}
+		if right == "" {
+			right = refs.HEAD
+		}
+		leftSha, leftErr := resolveRevision(repo, left)
+		rightSha, rightErr := resolveRevision(repo, right)
+		leftCommit, leftPeelErr := resolveRevision(repo, left+"^{commit}")
+		rightCommit, rightPeelErr := resolveRevision(repo, right+"^{commit}")
+		if leftErr == nil && rightErr == nil && leftPeelErr == nil && rightPeelErr == nil {
+			bases, err := merge.Bases(repo.Objects(), leftCommit, []string{rightCommit})
+			if err != nil {
+				return die("%v", err)
+			}
+			revParsePrint(repo, out, right, rightSha, "", abbrev, symbolic)
+			revParsePrint(repo, out, left, leftSha, "", abbrev, symbolic)
+			for _, base := range bases {
+				revParsePrint(repo, out, base, base, "^", abbrev, symbolic)
+			}
+			return 0
+		}
+	}
+	if i := strings.Index(arg, ".."); i >= 0 && !strings.HasPrefix(arg[i+2:], ".") {
+		left, right := arg[:i], arg[i+2:]
+		if left == "" {
+			left = refs.HEAD
+		}
+		if right == "" {
+			right = refs.HEAD
+		}
+		// "HEAD:../file" is not a range: fall back to a single revision
+		// unless both ends resolve.
+		leftSha, leftErr := resolveRevision(repo, left)
+		rightSha, rightErr := resolveRevision(repo, right)
+		if leftErr == nil && rightErr == nil {
+			revParsePrint(repo, out, right, rightSha, "", abbrev, symbolic)
+			revParsePrint(repo, out, left, leftSha, "^", abbrev, symbolic)
+			return 0
+		}
+	}
+	prefix := ""
+	if strings.HasPrefix(arg, "^") && len(arg) > 1 {
+		prefix, arg = "^", arg[1:]
+	}
+	sha, code := resolve(arg)
+	if code != 0 {
+		return code
+	}
+	revParsePrint(repo, out, arg, sha, prefix, abbrev, symbolic)
+	return 0
+}
+
+// revParsePrint shows the object name, or with --symbolic-full-name and
+// --abbrev-ref the ref name; revisions that aren't refs print nothing
+// then.
+func revParsePrint(repo *repository.Repository, out *bufio.Writer, rev, sha, prefix string, abbrev int, symbolic string) {
+	if symbolic != "" {
+		full, err := resolveRefName(repo, rev)
+		if err != nil || full == "" {
+			return
+		}
+		if symbolic == "abbrev" {
+			full = refs.Shorten(full, repo.Refs().Exists)
+		}
+		fmt.Fprintln(out, prefix+full)
+		return
+	}
+	if abbrev > 0 {
+		sha = repo.Objects().Abbrev(sha, abbrev)
+	}
+	fmt.Fprintln(out, prefix+sha)
+}
+
+// displayGitDir prints the git directory the way git does: as given in
+// GIT_DIR, relative at the top of the working tree, absolute elsewhere.
+func displayGitDir(repo *repository.Repository) string {
+	if dir := os.Getenv("GIT_DIR"); dir != "" {
+		return dir
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return repo.GitDir
+	}
+	if cwd == repo.GitDir {
+		return "."
+	}
+	if repo.WorkTree != "" && cwd == repo.WorkTree && repo.GitDir == filepath.Join(repo.WorkTree, ".git") {
+		return ".git"
+	}
+	return repo.GitDir
+}
+
+// insideWorkTree reports whether the current directory is the work
+// tree or below it, which it needn't be with GIT_WORK_TREE.
+func insideWorkTree(repo *repository.Repository) bool {
+	if repo.WorkTree == "" {
+		return false
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(repo.WorkTree, cwd)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func insideGitDir(repo *repository.Repository) bool {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(repo.GitDir, cwd)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
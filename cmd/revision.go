@@ -0,0 +1,682 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// unknownRevisionError is returned when a revision names nothing. Other
+// errors, like a missing path in "<rev>:<path>", are worth reporting as
+// they are.
+type unknownRevisionError struct {
+	rev string
+}
+
+func (e *unknownRevisionError) Error() string {
+	return fmt.Sprintf("not a valid object name: '%s'", e.rev)
+}
+
+func isUnknownRevision(err error) bool {
+	var unknown *unknownRevisionError
+	return errors.As(err, &unknown)
+}
+
+// ambiguousArgument is the message for an argument that is neither a
+// revision nor a path.
+func ambiguousArgument(arg string) string {
+	return fmt.Sprintf("ambiguous argument '%s': unknown revision or path not in the working tree.\n"+
+		"Use '--' to separate paths from revisions, like this:\n"+
+		"'git <command> [<revision>...] -- [<file>...]'", arg)
+}
+
+// outsideRepositoryError is returned for "<rev>:../<path>" leaving the
+// working tree.
+type outsideRepositoryError struct {
+	path, top string
+}
+
+func (e *outsideRepositoryError) Error() string {
+	return fmt.Sprintf("'%s' is outside repository at '%s'", e.path, e.top)
+}
+
+// resolveRevision turns a revision in the gitrevisions syntax into an
+// object name.
+// ref: https://git-scm.com/docs/gitrevisions#_specifying_revisions
+func resolveRevision(repo *repository.Repository, rev string) (string, error) {
+	return resolveRevisionAs(repo, rev, "")
+}
+
+// ResolveRevision is resolveRevision for the commands still implemented
+// in package main.
+func ResolveRevision(repo *repository.Repository, rev string) (string, error) {
+	return resolveRevision(repo, rev)
+}
+
+// resolveRevisionAs is resolveRevision with a hint used to pick among
+// ambiguous short object names: "commit" for a commit-ish, "tree" for a
+// tree-ish, "" for anything.
+func resolveRevisionAs(repo *repository.Repository, rev, want string) (string, error) {
+	if strings.HasPrefix(rev, ":/") {
+		return searchCommitMessage(repo, refTips(repo), rev, rev[2:])
+	}
+	if i := pathSeparator(rev); i > 0 {
+		sha, err := resolveRevisionAs(repo, rev[:i], "tree")
+		if err != nil {
+			return "", err
+		}
+		tree, err := peelTo(repo, rev, sha, "tree")
+		if err != nil {
+			return "", err
+		}
+		return lookupTreePath(repo, tree, rev[:i], rev[i+1:])
+	} else if i == 0 {
+		// ":<path>" names an index entry, and there is no index yet.
+		return "", &unknownRevisionError{rev}
+	}
+	return resolveSuffixes(repo, rev, want)
+}
+
+// pathSeparator finds the colon of "<rev>:<path>", skipping braces so
+// that "HEAD@{10:00}" stays a revision.
+func pathSeparator(rev string) int {
+	depth := 0
+	for i := 0; i < len(rev); i++ {
+		switch {
+		case rev[i] == '{':
+			depth++
+		case rev[i] == '}' && depth > 0:
+			depth--
+		case rev[i] == ':' && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveSuffixes peels "^{<type>}", "~<n>" and "^<n>" off the end of
+// rev, innermost first.
+func resolveSuffixes(repo *repository.Repository, rev, want string) (string, error) {
+	if strings.HasSuffix(rev, "}") {
+		if i := strings.LastIndex(rev, "^{"); i >= 0 {
+			return peelOnion(repo, rev, rev[:i], rev[i+2:len(rev)-1])
+		}
+	}
+	j := len(rev)
+	for j > 0 && isDigit(rev[j-1]) {
+		j--
+	}
+	if j == 0 || (rev[j-1] != '~' && rev[j-1] != '^') {
+		return resolveBase(repo, rev, want)
+	}
+	op, n := rev[j-1], 1
+	if j < len(rev) {
+		var err error
+		if n, err = strconv.Atoi(rev[j:]); err != nil {
+			return "", &unknownRevisionError{rev}
+		}
+	}
+	sha, err := resolveSuffixes(repo, rev[:j-1], "commit")
+	if err != nil {
+		return "", err
+	}
+	if sha, err = peelTo(repo, rev, sha, "commit"); err != nil {
+		return "", err
+	}
+	if op == '^' {
+		if n == 0 {
+			return sha, nil
+		}
+		parents, err := commitParents(repo, sha)
+		if err != nil || n > len(parents) {
+			return "", &unknownRevisionError{rev}
+		}
+		return parents[n-1], nil
+	}
+	for ; n > 0; n-- {
+		parents, err := commitParents(repo, sha)
+		if err != nil || len(parents) == 0 {
+			return "", &unknownRevisionError{rev}
+		}
+		sha = parents[0]
+	}
+	return sha, nil
+}
+
+// peelOnion implements "<rev>^{<type>}", "<rev>^{}" and "<rev>^{/<regex>}".
+func peelOnion(repo *repository.Repository, rev, base, inner string) (string, error) {
+	want := ""
+	if inner == "commit" || inner == "tree" {
+		want = inner
+	} else if strings.HasPrefix(inner, "/") {
+		want = "commit"
+	}
+	sha, err := resolveSuffixes(repo, base, want)
+	if err != nil {
+		return "", err
+	}
+	switch inner {
+	case "":
+		peeled, _, err := peel(repo.Objects(), sha)
+		if err != nil {
+			return "", &unknownRevisionError{rev}
+		}
+		return peeled, nil
+	case "object":
+		if !repo.Objects().Has(sha) {
+			return "", &unknownRevisionError{rev}
+		}
+		return sha, nil
+	case "commit", "tree", "blob", "tag":
+		return peelTo(repo, rev, sha, inner)
+	}
+	if strings.HasPrefix(inner, "/") {
+		commit, err := peelTo(repo, rev, sha, "commit")
+		if err != nil {
+			return "", err
+		}
+		return searchCommitMessage(repo, []string{commit}, rev, inner[1:])
+	}
+	return "", &unknownRevisionError{rev}
+}
+
+// peelTo follows tags, and commits to their trees, until it reaches an
+// object of the given type.
+func peelTo(repo *repository.Repository, rev, sha, typ string) (string, error) {
+	for depth := 0; depth < 16; depth++ {
+		info, err := readObjectInfo(repo.Objects(), sha)
+		if err != nil {
+			return "", &unknownRevisionError{rev}
+		}
+		switch {
+		case info.typ == typ:
+			return sha, nil
+		case info.typ == "tag":
+			sha = info.header("object")
+		case info.typ == "commit":
+			sha = info.header("tree")
+		default:
+			fmt.Fprintf(os.Stderr, "error: %s: expected %s type, but the object dereferences to %s type\n", rev, typ, info.typ)
+			return "", &unknownRevisionError{rev}
+		}
+	}
+	return "", &unknownRevisionError{rev}
+}
+
+func commitParents(repo *repository.Repository, sha string) ([]string, error) {
+	info, err := readObjectInfo(repo.Objects(), sha)
+	if err != nil {
+		return nil, err
+	}
+	if info.typ != "commit" {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", sha, info.typ)
+	}
+	return info.headerAll("parent"), nil
+}
+
+// resolveBase resolves a revision without suffixes: "@", a reflog entry,
+// a full or abbreviated object name, or a ref name.
+func resolveBase(repo *repository.Repository, name, want string) (string, error) {
+	expanded, err := expandPriorCheckout(repo, name)
+	if err != nil {
+		return "", err
+	}
+	if expanded == "" {
+		return "", &unknownRevisionError{name}
+	}
+	if i := strings.Index(expanded, "@{"); i >= 0 && strings.HasSuffix(expanded, "}") && !isTrackingSuffix(expanded[i:]) {
+		return resolveReflogRevision(repo, expanded[:i], expanded[i+2:len(expanded)-1])
+	}
+	if repo.Format.IsHex(expanded) {
+		return strings.ToLower(expanded), nil
+	}
+	full, err := resolveRefName(repo, expanded)
+	if err != nil {
+		return "", err
+	}
+	if full != "" {
+		if ref, err := repo.Refs().Resolve(full); err == nil {
+			return ref.Target, nil
+		}
+		return "", &unknownRevisionError{name}
+	}
+	return findShortObject(repo, name, expanded, want)
+}
+
+// isTrackingSuffix reports "@{upstream}", "@{u}" and "@{push}".
+func isTrackingSuffix(suffix string) bool {
+	switch strings.ToLower(suffix) {
+	case "@{upstream}", "@{u}", "@{push}":
+		return true
+	}
+	return false
+}
+
+// resolveRefName returns the full name of the ref that name stands for,
+// following symbolic refs, or "" when name isn't a ref.
+func resolveRefName(repo *repository.Repository, name string) (string, error) {
+	name, err := expandPriorCheckout(repo, name)
+	if err != nil || name == "" {
+		return "", err
+	}
+	if name == "@" {
+		name = refs.HEAD
+	}
+	if i := strings.LastIndex(name, "@{"); i >= 0 && isTrackingSuffix(name[i:]) {
+		return trackingRef(repo, name[:i], strings.EqualFold(name[i:], "@{push}"))
+	}
+	if !refs.ValidName(name) {
+		return "", nil
+	}
+	found := ""
+	count := 0
+	for _, rule := range refs.DWIMRules {
+		ref, err := repo.Refs().Resolve(fmt.Sprintf(rule, name))
+		if err != nil {
+			continue
+		}
+		if count == 0 {
+			found = ref.Name
+		}
+		count++
+	}
+	if count > 1 {
+		fmt.Fprintf(os.Stderr, "warning: refname '%s' is ambiguous.\n", name)
+	}
+	return found, nil
+}
+
+// expandPriorCheckout replaces a leading "@{-<n>}" by the branch, or
+// detached commit, checked out n switches ago. It returns "" when the
+// reflog of HEAD doesn't go back that far.
+func expandPriorCheckout(repo *repository.Repository, name string) (string, error) {
+	if !strings.HasPrefix(name, "@{-") {
+		return name, nil
+	}
+	end := strings.IndexByte(name, '}')
+	if end < 0 {
+		return name, nil
+	}
+	n, err := strconv.Atoi(name[3:end])
+	if err != nil || n <= 0 {
+		return name, nil
+	}
+	entries, err := repo.Refs().ReadReflog(refs.HEAD)
+	if err != nil {
+		return "", nil
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		msg := entries[i].Message
+		if !strings.HasPrefix(msg, "checkout: moving from ") {
+			continue
+		}
+		msg = strings.TrimPrefix(msg, "checkout: moving from ")
+		to := strings.LastIndex(msg, " to ")
+		if to < 0 {
+			continue
+		}
+		if n--; n == 0 {
+			return msg[:to] + name[end+1:], nil
+		}
+	}
+	return "", nil
+}
+
+// trackingRef resolves "<branch>@{upstream}" and "<branch>@{push}" to
+// the remote-tracking ref. An empty branch means the current one.
+// ref: https://git-scm.com/docs/gitrevisions#Documentation/gitrevisions.txt-emltbranchnamegtupstreamemegemmasterupstreamememuem
+func trackingRef(repo *repository.Repository, branch string, push bool) (string, error) {
+	if branch == "" {
+		head, err := repo.Refs().Read(refs.HEAD)
+		if err != nil || !head.IsSymbolic() || !strings.HasPrefix(head.Symref, "refs/heads/") {
+			return "", errors.New("HEAD does not point to a branch")
+		}
+		branch = strings.TrimPrefix(head.Symref, "refs/heads/")
+	} else if !repo.Refs().Exists("refs/heads/" + branch) {
+		return "", fmt.Errorf("no such branch: '%s'", branch)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", err
+	}
+	remote, _ := cfg.Get("branch." + branch + ".remote")
+	merge, hasMerge := cfg.Get("branch." + branch + ".merge")
+	upstream := func() (string, error) {
+		if remote == "" || !hasMerge {
+			return "", fmt.Errorf("no upstream configured for branch '%s'", branch)
+		}
+		return remoteTrackingRef(repo, remote, merge)
+	}
+	if !push {
+		return upstream()
+	}
+
+	pushRemote, ok := cfg.Get("branch." + branch + ".pushRemote")
+	if !ok {
+		if pushRemote, ok = cfg.Get("remote.pushDefault"); !ok {
+			pushRemote = remote
+		}
+	}
+	if pushRemote == "" {
+		pushRemote = "origin"
+	}
+	mode, ok := cfg.Get("push.default")
+	if !ok {
+		mode = "simple"
+	}
+	current := func() (string, error) {
+		return remoteTrackingRef(repo, pushRemote, "refs/heads/"+branch)
+	}
+	switch mode {
+	case "nothing":
+		return "", errors.New("push has no destination (push.default is 'nothing')")
+	case "matching", "current":
+		return current()
+	case "upstream":
+		if pushRemote != remote {
+			return "", errors.New("cannot resolve 'upstream' push to a different remote")
+		}
+		return upstream()
+	case "simple":
+		if pushRemote != remote {
+			return current()
+		}
+		if hasMerge && merge != "refs/heads/"+branch {
+			return "", errors.New("cannot resolve 'simple' push to a single destination")
+		}
+		return upstream()
+	}
+	return "", fmt.Errorf("unknown push.default value '%s'", mode)
+}
+
+// remoteTrackingRef maps a ref of remote through its fetch refspecs.
+// The remote "." is the repository itself.
+func remoteTrackingRef(repo *repository.Repository, remote, name string) (string, error) {
+	if remote == "." {
+		return name, nil
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", err
+	}
+	for _, value := range cfg.GetAll("remote." + remote + ".fetch") {
+		spec, err := refs.ParseRefspec(value)
+		if err != nil {
+			continue
+		}
+		if dst, ok := spec.MapSrc(name); ok {
+			return dst, nil
+		}
+	}
+	return "", fmt.Errorf("upstream branch '%s' not stored as a remote-tracking branch", name)
+}
+
+// findShortObject resolves an abbreviated object name, using want to
+// choose between several candidates.
+func findShortObject(repo *repository.Repository, rev, prefix, want string) (string, error) {
+	if len(prefix) < object.MinAbbrev || len(prefix) > repo.Format.HexSize() || !isHex(prefix) {
+		return "", &unknownRevisionError{rev}
+	}
+	names, err := repo.Objects().FindPrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	if len(names) > 1 && want != "" {
+		matching := []string{}
+		for _, sha := range names {
+			if peelsTo(repo, sha, want) {
+				matching = append(matching, sha)
+			}
+		}
+		if len(matching) > 0 {
+			names = matching
+		}
+	}
+	switch len(names) {
+	case 0:
+		return "", &unknownRevisionError{rev}
+	case 1:
+		return names[0], nil
+	}
+	fmt.Fprintf(os.Stderr, "error: short object ID %s is ambiguous\n", prefix)
+	fmt.Fprintf(os.Stderr, "hint: The candidates are:\n")
+	for _, line := range ambiguousCandidates(repo, names) {
+		fmt.Fprintf(os.Stderr, "hint:   %s\n", line)
+	}
+	return "", &unknownRevisionError{rev}
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// peelsTo reports whether the object is a commit-ish or a tree-ish.
+func peelsTo(repo *repository.Repository, sha, want string) bool {
+	_, typ, err := peel(repo.Objects(), sha)
+	if err != nil {
+		return false
+	}
+	return typ == want || (want == "tree" && typ == "commit")
+}
+
+// ambiguousCandidates describes the objects an ambiguous short name may
+// stand for: tags first, then commits, trees and blobs.
+func ambiguousCandidates(repo *repository.Repository, names []string) []string {
+	order := map[string]int{"tag": 0, "commit": 1, "tree": 2, "blob": 3}
+	type candidate struct {
+		typ, line string
+	}
+	list := []candidate{}
+	for _, sha := range names {
+		info, err := readObjectInfo(repo.Objects(), sha)
+		if err != nil {
+			continue
+		}
+		abbrev := repo.Objects().Abbrev(sha, defaultAbbrev(repo))
+		line := abbrev + " " + info.typ
+		switch info.typ {
+		case "commit":
+			subject, _ := splitSubjectBody(info.message)
+			line += " " + shortIdentDate(info.header("committer")) + " - " + subject
+		case "tag":
+			line += " " + shortIdentDate(info.header("tagger")) + " - " + info.header("tag")
+		}
+		list = append(list, candidate{info.typ, line})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return order[list[i].typ] < order[list[j].typ]
+	})
+	lines := []string{}
+	for _, c := range list {
+		lines = append(lines, c.line)
+	}
+	return lines
+}
+
+func shortIdentDate(ident string) string {
+	_, _, when := splitIdent(ident)
+	t, err := date.ParseRaw(when)
+	if err != nil {
+		return ""
+	}
+	short, _ := date.Format(t, "short")
+	return short
+}
+
+// defaultAbbrev reads core.abbrev, 7 unless configured.
+func defaultAbbrev(repo *repository.Repository) int {
+	cfg, err := repo.Config()
+	if err != nil {
+		return 7
+	}
+	if value, ok := cfg.Get("core.abbrev"); ok && value != "auto" {
+		if strings.EqualFold(value, "no") || value == "false" {
+			return repo.Format.HexSize()
+		}
+		return parseAbbrev(value)
+	}
+	return 7
+}
+
+// refTips returns the commits HEAD and the refs point to, for ":/<regex>".
+func refTips(repo *repository.Repository) []string {
+	tips := []string{}
+	if head, err := repo.Refs().Resolve(refs.HEAD); err == nil {
+		tips = append(tips, head.Target)
+	}
+	list, err := repo.Refs().List("refs/")
+	if err != nil {
+		return tips
+	}
+	for _, ref := range list {
+		if ref.Target != "" {
+			tips = append(tips, ref.Target)
+		}
+	}
+	return tips
+}
+
+// searchCommitMessage finds the youngest commit reachable from starts
+// whose message matches pattern. A leading "!-" negates the match and
+// "!!" stands for a literal "!".
+func searchCommitMessage(repo *repository.Repository, starts []string, rev, pattern string) (string, error) {
+	negate := false
+	switch {
+	case strings.HasPrefix(pattern, "!-"):
+		negate, pattern = true, pattern[2:]
+	case strings.HasPrefix(pattern, "!!"):
+		pattern = pattern[1:]
+	case strings.HasPrefix(pattern, "!"):
+		return "", &unknownRevisionError{rev}
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", &unknownRevisionError{rev}
+	}
+	type entry struct {
+		info *objectInfo
+		when int64
+	}
+	queue := []entry{}
+	seen := map[string]bool{}
+	push := func(sha string) {
+		if seen[sha] {
+			return
+		}
+		seen[sha] = true
+		peeled, typ, err := peel(repo.Objects(), sha)
+		if err != nil || typ != "commit" {
+			return
+		}
+		info, err := readObjectInfo(repo.Objects(), peeled)
+		if err != nil {
+			return
+		}
+		queue = append(queue, entry{info, commitTime(info)})
+	}
+	for _, sha := range starts {
+		push(sha)
+	}
+	for len(queue) > 0 {
+		newest := 0
+		for i := range queue {
+			if queue[i].when > queue[newest].when {
+				newest = i
+			}
+		}
+		e := queue[newest]
+		queue = append(queue[:newest], queue[newest+1:]...)
+		if re.MatchString(e.info.message) != negate {
+			return e.info.sha, nil
+		}
+		for _, parent := range e.info.headerAll("parent") {
+			push(parent)
+		}
+	}
+	return "", &unknownRevisionError{rev}
+}
+
+// commitTime is the committer timestamp of a commit in seconds.
+func commitTime(info *objectInfo) int64 {
+	_, _, when := splitIdent(info.header("committer"))
+	t, err := date.ParseRaw(when)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// lookupTreePath implements "<tree-ish>:<path>". Paths starting with
+// "./" or "../" are relative to the current directory.
+func lookupTreePath(repo *repository.Repository, tree, treeish, name string) (string, error) {
+	full := name
+	if name == "." || name == ".." || strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		full = path.Join(repo.Prefix, name)
+		if full == ".." || strings.HasPrefix(full, "../") {
+			return "", &outsideRepositoryError{name, repo.WorkTree}
+		}
+	}
+	full = strings.Trim(full, "/")
+	if full == "." || full == "" {
+		return tree, nil
+	}
+	if sha, ok := findTreePath(repo, tree, full); ok {
+		return sha, nil
+	}
+	if repo.WorkTree != "" {
+		if _, err := os.Lstat(filepath.Join(repo.WorkTree, filepath.FromSlash(full))); err == nil {
+			return "", fmt.Errorf("path '%s' exists on disk, but not in '%s'", full, treeish)
+		}
+	}
+	if repo.Prefix != "" && full == name {
+		// Paths are relative to the top, not to the current directory.
+		inPrefix := repo.Prefix + "/" + full
+		if _, ok := findTreePath(repo, tree, inPrefix); ok {
+			return "", fmt.Errorf("path '%s' exists, but not '%s'\n"+
+				"hint: Did you mean '%s:%s' aka '%s:./%s'?", inPrefix, full, treeish, inPrefix, treeish, full)
+		}
+	}
+	return "", fmt.Errorf("path '%s' does not exist in '%s'", full, treeish)
+}
+
+// findTreePath looks a slash separated path up in a tree.
+func findTreePath(repo *repository.Repository, tree, name string) (string, bool) {
+	sha := tree
+	for _, part := range strings.Split(name, "/") {
+		contents, err := repo.Objects().ReadType(sha, "tree")
+		if err != nil {
+			return "", false
+		}
+		entries, err := object.ParseTree(contents, repo.Format)
+		if err != nil {
+			return "", false
+		}
+		found := false
+		for _, e := range entries {
+			if e.Name == part {
+				sha, found = e.Sha, true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return sha, true
+}
@@ -0,0 +1,1116 @@
+package cmd
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/date"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/walk"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/wildmatch"
+)
+
+// Flags the revision walker keeps per commit.
+const (
+	walkSeen          = 1 << iota // queued once
+	walkAdded                     // parents processed
+	walkUninteresting             // reachable from a negative revision
+	walkTreesame                  // doesn't touch the limiting paths
+	walkBottom                    // negative revision from the command line
+)
+
+// commitNode is a commit as seen by the revision walker.
+type commitNode struct {
+	sha        string
+	tree       string
+	parents    []string // parents the walk follows, after simplification
+	allParents []string // parents of the commit itself
+	when       int64    // committer timestamp
+	info       *objectInfo
+	commit     *object.Commit
+	reflog     *reflogSelector // the entry shown by --walk-reflogs
+}
+
+// startCommit is a commit named on the command line.
+type startCommit struct {
+	sha string
+	not bool
+	rev string // the revision as named, "" for those the walk adds
+}
+
+// pendingObject is a non-commit object named on the command line, shown
+// by --objects.
+type pendingObject struct {
+	sha, name string
+}
+
+// revWalk walks the commit graph the way "rev-list" does: from the
+// positive revisions down, stopping at commits reachable from negative
+// ones, with the filtering and ordering options of rev-list and log.
+// ref: https://git-scm.com/docs/git-rev-list
+type revWalk struct {
+	repo  *repository.Repository
+	nodes map[string]*commitNode
+	flags map[string]int
+
+	starts  []startCommit // in command line order
+	pending []pendingObject
+	paths   []string // limiting paths, relative to the top
+
+	firstParent bool
+	order       string // "", "date" or "topo"
+	reverse     bool
+	objects     bool
+	walkReflogs bool // walk the reflogs of the revisions instead
+	// reflogFrom is the first start given after --walk-reflogs; those
+	// before it have no reflog to walk, as in git.
+	reflogFrom int
+	// sources holds the revision each commit was reached from, for %S;
+	// nil when not needed.
+	sources    map[string]string
+	rewrite    bool // show parents rewritten around hidden commits
+	revGiven   bool // revisions or ref options were given, even if empty
+	maxCount   int  // -1 for no limit
+	skip       int
+	since      *time.Time
+	until      *time.Time
+	minParents int
+	maxParents int // -1 for no limit
+
+	authors, committers, greps []string
+	allMatch, invertGrep       bool
+	ignoreCase                 bool
+	patternType                string // "basic", "extended" or "fixed"
+	matchers                   map[string][]*regexp.Regexp
+
+	queue   *walk.Queue
+	limited bool
+	list    []*commitNode // the limited walk's result
+	shown   int
+	skipped int
+}
+
+func newRevWalk(repo *repository.Repository) *revWalk {
+	return &revWalk{
+		repo:        repo,
+		nodes:       map[string]*commitNode{},
+		flags:       map[string]int{},
+		maxCount:    -1,
+		maxParents:  -1,
+		patternType: "basic",
+	}
+}
+
+// parseArgs consumes the walk options, revisions and paths of args and
+// returns the options it doesn't know, for the command to handle.
+func (w *revWalk) parseArgs(args []string) ([]string, error) {
+	rest := []string{}
+	not := false
+	seenPath := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("option '%s' requires a value", arg)
+			}
+			i++
+			return args[i], nil
+		}
+		handled, err := w.parseOption(arg, value)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case handled:
+		case arg == "--":
+			w.addPaths(args[i+1:])
+			return rest, nil
+		case arg == "--not":
+			not = !not
+		case arg == "--all":
+			w.revGiven = true
+			w.addRefs("", "", not)
+			w.addRef(refs.HEAD, not)
+		case arg == "--branches" || strings.HasPrefix(arg, "--branches="):
+			w.revGiven = true
+			w.addRefs("refs/heads/", strings.TrimPrefix(strings.TrimPrefix(arg, "--branches"), "="), not)
+		case arg == "--tags" || strings.HasPrefix(arg, "--tags="):
+			w.revGiven = true
+			w.addRefs("refs/tags/", strings.TrimPrefix(strings.TrimPrefix(arg, "--tags"), "="), not)
+		case arg == "--remotes" || strings.HasPrefix(arg, "--remotes="):
+			w.revGiven = true
+			w.addRefs("refs/remotes/", strings.TrimPrefix(strings.TrimPrefix(arg, "--remotes"), "="), not)
+		case strings.HasPrefix(arg, "-") && arg != "-" && !seenPath:
+			rest = append(rest, arg)
+		default:
+			if seenPath {
+				w.addPaths([]string{arg})
+				continue
+			}
+			err := w.addRevision(arg, not)
+			if err == nil {
+				continue
+			}
+			if !isUnknownRevision(err) {
+				return nil, err
+			}
+			// Like git, an argument that isn't a revision must be an
+			// existing path to be taken as one without "--".
+			if _, statErr := os.Lstat(arg); statErr != nil {
+				return nil, errors.New(ambiguousArgument(arg))
+			}
+			seenPath = true
+			w.addPaths([]string{arg})
+		}
+	}
+	return rest, nil
+}
+
+// parseOption handles one limiting or ordering option. value fetches
+// the next argument for options written as two words.
+func (w *revWalk) parseOption(arg string, value func() (string, error)) (bool, error) {
+	var err error
+	intValue := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("'%s': not an integer", s)
+		}
+		return n, nil
+	}
+	dateValue := func(s string) (*time.Time, error) {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			t := time.Unix(n, 0)
+			return &t, nil
+		}
+		t, err := date.Approx(s, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return &t, nil
+	}
+	prefixed := func(names ...string) (string, bool) {
+		for _, name := range names {
+			if strings.HasPrefix(arg, name+"=") {
+				return strings.TrimPrefix(arg, name+"="), true
+			}
+		}
+		return "", false
+	}
+	switch {
+	case arg == "-n" || arg == "--max-count":
+		var s string
+		if s, err = value(); err == nil {
+			w.maxCount, err = intValue(s)
+		}
+	case strings.HasPrefix(arg, "-n") && len(arg) > 2 && isDigit(arg[2]):
+		w.maxCount, err = intValue(arg[2:])
+	case strings.HasPrefix(arg, "--max-count="):
+		w.maxCount, err = intValue(strings.TrimPrefix(arg, "--max-count="))
+	case len(arg) > 1 && arg[0] == '-' && isDigit(arg[1]):
+		w.maxCount, err = intValue(arg[1:])
+	case strings.HasPrefix(arg, "--skip="):
+		w.skip, err = intValue(strings.TrimPrefix(arg, "--skip="))
+	case arg == "--first-parent":
+		w.firstParent = true
+	case arg == "--topo-order":
+		w.order = "topo"
+	case arg == "--date-order":
+		w.order = "date"
+	case arg == "--reverse":
+		w.reverse = true
+	case arg == "--objects":
+		w.objects = true
+	case arg == "-g" || arg == "--walk-reflogs":
+		if !w.walkReflogs {
+			w.walkReflogs, w.reflogFrom = true, len(w.starts)
+		}
+	case arg == "--no-merges":
+		w.maxParents = 1
+	case arg == "--merges":
+		w.minParents = 2
+	case strings.HasPrefix(arg, "--min-parents="):
+		w.minParents, err = intValue(strings.TrimPrefix(arg, "--min-parents="))
+	case strings.HasPrefix(arg, "--max-parents="):
+		w.maxParents, err = intValue(strings.TrimPrefix(arg, "--max-parents="))
+	case arg == "--no-min-parents":
+		w.minParents = 0
+	case arg == "--no-max-parents":
+		w.maxParents = -1
+	case arg == "--all-match":
+		w.allMatch = true
+	case arg == "--invert-grep":
+		w.invertGrep = true
+	case arg == "-i" || arg == "--regexp-ignore-case":
+		w.ignoreCase = true
+	case arg == "-E" || arg == "--extended-regexp":
+		w.patternType = "extended"
+	case arg == "-F" || arg == "--fixed-strings":
+		w.patternType = "fixed"
+	case arg == "-G" || arg == "--basic-regexp":
+		w.patternType = "basic"
+	default:
+		if s, ok := prefixed("--since", "--after", "--max-age"); ok {
+			w.since, err = dateValue(s)
+		} else if s, ok := prefixed("--until", "--before", "--min-age"); ok {
+			w.until, err = dateValue(s)
+		} else if s, ok := prefixed("--author"); ok {
+			w.authors = append(w.authors, s)
+		} else if s, ok := prefixed("--committer"); ok {
+			w.committers = append(w.committers, s)
+		} else if s, ok := prefixed("--grep"); ok {
+			w.greps = append(w.greps, s)
+		} else {
+			return false, nil
+		}
+	}
+	return true, err
+}
+
+// addPaths adds limiting paths, taken relative to the current directory.
+func (w *revWalk) addPaths(paths []string) {
+	for _, p := range paths {
+		p = path.Join(w.repo.Prefix, filepath.ToSlash(p))
+		if p == "." {
+			p = ""
+		}
+		w.paths = append(w.paths, strings.Trim(p, "/"))
+	}
+}
+
+// addRefs adds every ref below prefix, filtered by a glob pattern. A
+// pattern without glob characters matches a whole directory.
+func (w *revWalk) addRefs(prefix, pattern string, not bool) {
+	list, err := w.repo.Refs().List(prefix)
+	if err != nil {
+		return
+	}
+	if pattern != "" && !strings.ContainsAny(pattern, "*?[") {
+		pattern = strings.TrimSuffix(pattern, "/") + "/*"
+	}
+	for _, ref := range list {
+		if pattern != "" && !wildmatch.Match(prefix+pattern, ref.Name, wildmatch.Pathname) {
+			continue
+		}
+		w.addRef(ref.Name, not)
+	}
+}
+
+func (w *revWalk) addRef(name string, not bool) {
+	if ref, err := w.repo.Refs().Resolve(name); err == nil {
+		w.addObject(ref.Target, name, not)
+	}
+}
+
+// addRevision handles one revision argument: "<rev>", "^<rev>",
+// "<rev>..<rev>", "<rev>...<rev>", "<rev>^@", "<rev>^!" and "<rev>^-<n>".
+func (w *revWalk) addRevision(arg string, not bool) error {
+	resolve := func(rev string) (string, error) {
+		if rev == "" {
+			rev = refs.HEAD
+		}
+		return resolveRevision(w.repo, rev)
+	}
+	if i := strings.Index(arg, ".."); i >= 0 {
+		symmetric := strings.HasPrefix(arg[i+2:], ".")
+		left, right := arg[:i], arg[i+2:]
+		if symmetric {
+			right = arg[i+3:]
+		}
+		leftSha, leftErr := resolve(left)
+		rightSha, rightErr := resolve(right)
+		if leftErr == nil && rightErr == nil {
+			if !symmetric {
+				w.addObject(leftSha, left, !not)
+				w.addObject(rightSha, right, not)
+				return nil
+			}
+			a, err := peelTo(w.repo, left, leftSha, "commit")
+			if err != nil {
+				return err
+			}
+			b, err := peelTo(w.repo, right, rightSha, "commit")
+			if err != nil {
+				return err
+			}
+			bases, err := merge.Bases(w.repo.Objects(), a, []string{b})
+			if err != nil {
+				return err
+			}
+			w.addObject(leftSha, left, not)
+			w.addObject(rightSha, right, not)
+			for _, base := range bases {
+				w.addObject(base, "", !not)
+			}
+			return nil
+		}
+	}
+	for _, suffix := range []string{"^@", "^!"} {
+		if strings.HasSuffix(arg, suffix) {
+			sha, err := resolve(strings.TrimSuffix(arg, suffix))
+			if err != nil {
+				return err
+			}
+			if sha, err = peelTo(w.repo, arg, sha, "commit"); err != nil {
+				return err
+			}
+			parents, err := commitParents(w.repo, sha)
+			if err != nil {
+				return err
+			}
+			if suffix == "^!" {
+				w.addObject(sha, arg, not)
+			}
+			for _, parent := range parents {
+				w.addObject(parent, "", suffix == "^!" != not)
+			}
+			return nil
+		}
+	}
+	if i := strings.LastIndex(arg, "^-"); i > 0 {
+		n := 1
+		if i+2 < len(arg) {
+			var err error
+			if n, err = strconv.Atoi(arg[i+2:]); err != nil {
+				return &unknownRevisionError{arg}
+			}
+		}
+		return w.addRevision(fmt.Sprintf("%s^%d..%s", arg[:i], n, arg[:i]), not)
+	}
+	if strings.HasPrefix(arg, "^") && len(arg) > 1 {
+		arg, not = arg[1:], !not
+	}
+	sha, err := resolveRevision(w.repo, arg)
+	if err != nil {
+		return err
+	}
+	w.addObject(sha, arg, not)
+	return nil
+}
+
+// addObject starts the walk at sha. Tags are peeled to commits; other
+// objects are only listed by --objects, named after the path of
+// "<rev>:<path>".
+func (w *revWalk) addObject(sha, rev string, not bool) {
+	w.revGiven = true
+	name := ""
+	if i := pathSeparator(rev); i > 0 {
+		name = rev[i+1:]
+	}
+	for depth := 0; depth < 16; depth++ {
+		info, err := readObjectInfo(w.repo.Objects(), sha)
+		if err != nil {
+			return
+		}
+		switch info.typ {
+		case "commit":
+			w.starts = append(w.starts, startCommit{sha, not, rev})
+			return
+		case "tag":
+			if !not {
+				w.pending = append(w.pending, pendingObject{sha, info.header("tag")})
+			}
+			sha, name = info.header("object"), ""
+		default:
+			if !not {
+				w.pending = append(w.pending, pendingObject{sha, name})
+			}
+			return
+		}
+	}
+}
+
+func (w *revWalk) load(sha string) (*commitNode, error) {
+	if n, ok := w.nodes[sha]; ok {
+		return n, nil
+	}
+	info, err := readObjectInfo(w.repo.Objects(), sha)
+	if err != nil {
+		return nil, err
+	}
+	if info.typ != "commit" {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", sha, info.typ)
+	}
+	commit, err := object.ParseCommit(info.raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", sha, err)
+	}
+	n := &commitNode{sha: sha, info: info, commit: commit, tree: commit.Tree, parents: commit.Parents, when: commit.Committer.Unix}
+	n.allParents = n.parents
+	if w.firstParent && len(n.parents) > 1 {
+		n.parents = n.parents[:1]
+	}
+	w.nodes[sha] = n
+	return n, nil
+}
+
+// CommitDate orders the nodes in a walk.Queue.
+func (n *commitNode) CommitDate() int64 { return n.when }
+
+// markParentsUninteresting spreads the uninteresting flag to the
+// ancestors already loaded.
+func (w *revWalk) markParentsUninteresting(n *commitNode) {
+	stack := []*commitNode{n}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, p := range c.parents {
+			if w.flags[p]&walkUninteresting != 0 {
+				continue
+			}
+			w.flags[p] |= walkUninteresting
+			if pn, ok := w.nodes[p]; ok {
+				stack = append(stack, pn)
+			}
+		}
+	}
+}
+
+func (w *revWalk) everybodyUninteresting(q *walk.Queue) bool {
+	for _, n := range q.Items() {
+		if w.flags[n.(*commitNode).sha]&walkUninteresting == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// prepare queues the starting commits. The walk is limited, computing
+// every commit up front, when negative revisions, --since or a sorted
+// order need the whole picture; otherwise commits come out as the date
+// queue reaches them.
+func (w *revWalk) prepare() error {
+	if err := w.compilePatterns(); err != nil {
+		return err
+	}
+	w.queue = &walk.Queue{}
+	for _, start := range w.starts {
+		if _, err := w.load(start.sha); err != nil {
+			return err
+		}
+		if w.sources != nil && w.sources[start.sha] == "" {
+			w.sources[start.sha] = start.rev
+		}
+	}
+	// Like git, what the negative commits reach is known to be
+	// uninteresting before the walk starts.
+	for _, start := range w.starts {
+		if start.not {
+			w.flags[start.sha] |= walkUninteresting | walkBottom
+			w.markParentsUninteresting(w.nodes[start.sha])
+			w.limited = true
+		}
+	}
+	for _, start := range w.starts {
+		if err := w.add(start.sha, 0); err != nil {
+			return err
+		}
+	}
+	if w.order != "" {
+		w.limited = true
+	}
+	if !w.limited {
+		return nil
+	}
+	list, err := w.limit()
+	if err != nil {
+		return err
+	}
+	if w.order != "" {
+		list = w.sortTopologically(list)
+	}
+	w.list = list
+	return nil
+}
+
+// add queues a commit the first time it is seen.
+func (w *revWalk) add(sha string, flags int) error {
+	w.flags[sha] |= flags
+	if w.flags[sha]&walkSeen != 0 {
+		return nil
+	}
+	w.flags[sha] |= walkSeen
+	n, err := w.load(sha)
+	if err != nil {
+		return err
+	}
+	heap.Push(w.queue, n)
+	return nil
+}
+
+// processParents queues the parents of a commit once, spreading the
+// uninteresting flag or simplifying the commit on the limiting paths.
+func (w *revWalk) processParents(n *commitNode) error {
+	if w.flags[n.sha]&walkAdded != 0 {
+		return nil
+	}
+	w.flags[n.sha] |= walkAdded
+	if w.flags[n.sha]&walkUninteresting != 0 {
+		for _, p := range n.parents {
+			w.flags[p] |= walkUninteresting
+			pn, err := w.load(p)
+			if err != nil {
+				return err
+			}
+			w.markParentsUninteresting(pn)
+			if err := w.add(p, 0); err != nil {
+				return err
+			}
+		}
+		w.markParentsUninteresting(n)
+		return nil
+	}
+	if len(w.paths) > 0 {
+		if err := w.simplify(n); err != nil {
+			return err
+		}
+	}
+	for _, p := range n.parents {
+		if w.sources != nil && w.sources[p] == "" {
+			w.sources[p] = w.sources[n.sha]
+		}
+		if err := w.add(p, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limit walks from the tips in date order and returns the interesting
+// commits in the order they were reached.
+func (w *revWalk) limit() ([]*commitNode, error) {
+	list := []*commitNode{}
+	const slop = 5
+	left := slop
+	last := int64(math.MaxInt64) // date of the last interesting commit
+	for w.queue.Len() > 0 {
+		n := heap.Pop(w.queue).(*commitNode)
+		if w.since != nil && n.when < w.since.Unix() {
+			w.flags[n.sha] |= walkUninteresting
+		}
+		if err := w.processParents(n); err != nil {
+			return nil, err
+		}
+		if w.flags[n.sha]&walkUninteresting != 0 {
+			// Keep going a little while only uninteresting commits older
+			// than the interesting ones are left, in case of clock skew.
+			if w.queue.Len() == 0 {
+				break
+			}
+			if !w.everybodyUninteresting(w.queue) || last <= w.queue.Items()[0].CommitDate() {
+				left = slop
+			} else if left--; left == 0 {
+				break
+			}
+			continue
+		}
+		if w.until != nil && n.when > w.until.Unix() {
+			continue
+		}
+		last = n.when
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+// simplify compares the commit with its parents on the limiting paths.
+// A commit that matches an interesting parent follows only that parent
+// and is marked TREESAME, like git's default history simplification.
+// ref: https://git-scm.com/docs/git-log#_history_simplification
+func (w *revWalk) simplify(n *commitNode) error {
+	if len(n.parents) == 0 {
+		if w.samePaths("", n.tree) {
+			w.flags[n.sha] |= walkTreesame
+		}
+		return nil
+	}
+	relevant := 0
+	relevantChange, irrelevantChange := false, false
+	for _, p := range n.parents {
+		pn, err := w.load(p)
+		if err != nil {
+			return err
+		}
+		isRelevant := w.relevant(p)
+		if isRelevant {
+			relevant++
+		}
+		if w.samePaths(pn.tree, n.tree) {
+			if isRelevant {
+				n.parents = []string{p}
+				w.flags[n.sha] |= walkTreesame
+				return nil
+			}
+			continue
+		}
+		if isRelevant {
+			relevantChange = true
+		} else {
+			irrelevantChange = true
+		}
+	}
+	changed := irrelevantChange
+	if relevant > 0 {
+		changed = relevantChange
+	}
+	if !changed {
+		w.flags[n.sha] |= walkTreesame
+	}
+	return nil
+}
+
+// relevant reports whether a parent counts for history simplification:
+// it is interesting or one of the negative revisions themselves.
+func (w *revWalk) relevant(sha string) bool {
+	return w.flags[sha]&(walkUninteresting|walkBottom) != walkUninteresting
+}
+
+// samePaths reports whether two trees agree on every limiting path. An
+// empty tree name stands for the empty tree.
+func (w *revWalk) samePaths(a, b string) bool {
+	for _, p := range w.paths {
+		if p == "" {
+			if a != b {
+				return false
+			}
+			continue
+		}
+		shaA, shaB := "", ""
+		if a != "" {
+			shaA, _ = findTreePath(w.repo, a, p)
+		}
+		if b != "" {
+			shaB, _ = findTreePath(w.repo, b, p)
+		}
+		if shaA != shaB {
+			return false
+		}
+	}
+	return true
+}
+
+// next returns the next commit to show, or nil at the end of the walk.
+func (w *revWalk) next() (*commitNode, error) {
+	for {
+		if w.maxCount >= 0 && w.shown >= w.maxCount {
+			return nil, nil
+		}
+		var n *commitNode
+		if w.limited {
+			if len(w.list) == 0 {
+				return nil, nil
+			}
+			n, w.list = w.list[0], w.list[1:]
+		} else {
+			if w.queue.Len() == 0 {
+				return nil, nil
+			}
+			n = heap.Pop(w.queue).(*commitNode)
+			if w.since != nil && n.when < w.since.Unix() {
+				continue
+			}
+			if err := w.processParents(n); err != nil {
+				return nil, err
+			}
+		}
+		if !w.wanted(n) {
+			continue
+		}
+		if w.rewrite && len(w.paths) > 0 {
+			parents, err := w.rewriteParents(n)
+			if err != nil {
+				return nil, err
+			}
+			n.parents = parents
+		}
+		if w.skipped < w.skip {
+			w.skipped++
+			continue
+		}
+		w.shown++
+		return n, nil
+	}
+}
+
+// commits runs the whole walk and returns the commits to show, in order.
+func (w *revWalk) commits() ([]*commitNode, error) {
+	if w.walkReflogs {
+		return w.reflogCommits()
+	}
+	if err := w.prepare(); err != nil {
+		return nil, err
+	}
+	shown := []*commitNode{}
+	for {
+		n, err := w.next()
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			break
+		}
+		shown = append(shown, n)
+	}
+	if w.reverse {
+		for i, j := 0, len(shown)-1; i < j; i, j = i+1, j-1 {
+			shown[i], shown[j] = shown[j], shown[i]
+		}
+	}
+	return shown, nil
+}
+
+// wanted applies the filters that hide a commit without stopping the
+// walk.
+func (w *revWalk) wanted(n *commitNode) bool {
+	flags := w.flags[n.sha]
+	if flags&walkUninteresting != 0 {
+		return false
+	}
+	if w.until != nil && n.when > w.until.Unix() {
+		return false
+	}
+	if len(n.allParents) < w.minParents || (w.maxParents >= 0 && len(n.allParents) > w.maxParents) {
+		return false
+	}
+	if len(w.paths) > 0 && flags&walkTreesame != 0 {
+		return false
+	}
+	return w.matchesPatterns(n)
+}
+
+// sortTopologically shows no parent before all of its children, keeping
+// the date order (--date-order) or lines of history together
+// (--topo-order) otherwise.
+func (w *revWalk) sortTopologically(list []*commitNode) []*commitNode {
+	indegree := map[string]int{}
+	for _, n := range list {
+		indegree[n.sha] = 1
+	}
+	// Like git, --first-parent doesn't drop the other parents here, so
+	// that side lines still wait for the commits merging them.
+	parents := func(n *commitNode) []string {
+		if w.firstParent && len(w.paths) == 0 {
+			return n.allParents
+		}
+		return n.parents
+	}
+	for _, n := range list {
+		for _, p := range parents(n) {
+			if indegree[p] > 0 {
+				indegree[p]++
+			}
+		}
+	}
+	q := &walk.Queue{}
+	stack := []*commitNode{}
+	for _, n := range list {
+		if indegree[n.sha] == 1 {
+			if w.order == "date" {
+				heap.Push(q, n)
+			} else {
+				stack = append(stack, n)
+			}
+		}
+	}
+	// The stack pops its first tip first.
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	sorted := []*commitNode{}
+	for {
+		var n *commitNode
+		if w.order == "date" {
+			if q.Len() == 0 {
+				break
+			}
+			n = heap.Pop(q).(*commitNode)
+		} else {
+			if len(stack) == 0 {
+				break
+			}
+			n, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		}
+		for _, p := range parents(n) {
+			if indegree[p] == 0 {
+				continue
+			}
+			if indegree[p]--; indegree[p] == 1 {
+				if w.order == "date" {
+					heap.Push(q, w.nodes[p])
+				} else {
+					stack = append(stack, w.nodes[p])
+				}
+			}
+		}
+		indegree[n.sha] = 0
+		sorted = append(sorted, n)
+	}
+	return sorted
+}
+
+// compilePatterns turns --author, --committer and --grep into regular
+// expressions according to -E, -F and -i.
+func (w *revWalk) compilePatterns() error {
+	w.matchers = map[string][]*regexp.Regexp{}
+	for kind, patterns := range map[string][]string{"author": w.authors, "committer": w.committers, "grep": w.greps} {
+		for _, p := range patterns {
+			switch w.patternType {
+			case "fixed":
+				p = regexp.QuoteMeta(p)
+			case "basic":
+				p = basicToExtended(p)
+			}
+			if w.ignoreCase {
+				p = "(?i)" + p
+			}
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("invalid regex: %v", err)
+			}
+			w.matchers[kind] = append(w.matchers[kind], re)
+		}
+	}
+	return nil
+}
+
+// basicToExtended translates a POSIX basic regular expression, where
+// "+?|(){}" are literal unless escaped, into Go's syntax.
+func basicToExtended(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c == '\\' && i+1 < len(p) {
+			next := p[i+1]
+			i++
+			if strings.IndexByte("+?|(){}", next) >= 0 {
+				b.WriteByte(next)
+			} else {
+				b.WriteByte('\\')
+				b.WriteByte(next)
+			}
+			continue
+		}
+		if strings.IndexByte("+?|(){}", c) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// matchesPatterns applies --author, --committer and --grep: any pattern
+// may match, or all of them with --all-match.
+func (w *revWalk) matchesPatterns(n *commitNode) bool {
+	total, matched := 0, 0
+	check := func(kind, text string) {
+		for _, re := range w.matchers[kind] {
+			total++
+			if re.MatchString(text) {
+				matched++
+			}
+		}
+	}
+	ident := func(sig object.Signature) string {
+		return sig.Name + " <" + sig.Email + ">"
+	}
+	check("author", ident(n.commit.Author))
+	check("committer", ident(n.commit.Committer))
+	// --author and --committer always have to match; --grep only
+	// decides among the commits they let through.
+	identTotal := total
+	if matched < identTotal && (w.allMatch || matched == 0) {
+		return false
+	}
+	headerMatched := matched
+	check("grep", n.commit.Message)
+	greps := total - identTotal
+	grepMatched := matched - headerMatched
+	if greps == 0 {
+		return true
+	}
+	ok := grepMatched > 0
+	if w.allMatch {
+		ok = grepMatched == greps
+	}
+	return ok != w.invertGrep
+}
+
+// shownParents returns the parents to show for a commit: those of the
+// commit itself, or with limiting paths its rewritten parents.
+func (w *revWalk) shownParents(n *commitNode) []string {
+	if len(w.paths) == 0 {
+		return n.allParents
+	}
+	return n.parents
+}
+
+// rewriteParents skips over the hidden TREESAME commits between a commit
+// and its parents, so that they connect with --parents and --graph.
+// ref: https://git-scm.com/docs/git-log#_history_simplification
+func (w *revWalk) rewriteParents(n *commitNode) ([]string, error) {
+	seen := map[string]bool{}
+	parents := []string{}
+	for _, p := range n.parents {
+		for p != "" {
+			pn, err := w.load(p)
+			if err != nil {
+				return nil, err
+			}
+			// An incremental walk has to look at the parents of what it
+			// skips now, as git's does.
+			if !w.limited {
+				if err := w.processParents(pn); err != nil {
+					return nil, err
+				}
+			}
+			flags := w.flags[p]
+			if flags&walkUninteresting != 0 || flags&walkTreesame == 0 {
+				break
+			}
+			if len(pn.parents) == 0 {
+				p = ""
+				break
+			}
+			next := pn.parents[0]
+			for _, pp := range pn.parents {
+				if w.relevant(pp) {
+					next = pp
+					break
+				}
+			}
+			p = next
+		}
+		if p != "" && !seen[p] {
+			seen[p] = true
+			parents = append(parents, p)
+		}
+	}
+	return parents, nil
+}
+
+// listObjects calls show for the trees and blobs reachable from the
+// commits, and for the objects named on the command line, skipping what
+// the uninteresting commits already have. The root tree of a commit has
+// an empty name.
+func (w *revWalk) listObjects(commits []*commitNode, show func(sha, name string)) error {
+	done := map[string]bool{}
+	for sha, flags := range w.flags {
+		if flags&walkUninteresting == 0 {
+			continue
+		}
+		if n, ok := w.nodes[sha]; ok {
+			if err := w.walkTree(n.tree, "", done, nil); err != nil {
+				return err
+			}
+		}
+	}
+	for _, p := range w.pending {
+		if done[p.sha] {
+			continue
+		}
+		typ, _, err := w.repo.Objects().Read(p.sha)
+		if err != nil {
+			return err
+		}
+		if typ == "tree" {
+			if err := w.walkTree(p.sha, p.name, done, show); err != nil {
+				return err
+			}
+			continue
+		}
+		done[p.sha] = true
+		show(p.sha, p.name)
+	}
+	for _, n := range commits {
+		if err := w.walkTree(n.tree, "", done, show); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkTree shows a tree and everything below it not done yet; a nil show
+// only marks them done.
+func (w *revWalk) walkTree(sha, name string, done map[string]bool, show func(sha, name string)) error {
+	if done[sha] {
+		return nil
+	}
+	done[sha] = true
+	if show != nil {
+		show(sha, name)
+	}
+	contents, err := w.repo.Objects().ReadType(sha, "tree")
+	if err != nil {
+		return err
+	}
+	entries, err := object.ParseTree(contents, w.repo.Format)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		full := e.Name
+		if name != "" {
+			full = name + "/" + e.Name
+		}
+		if !w.inPaths(full, e.IsTree()) {
+			continue
+		}
+		switch {
+		case e.IsTree():
+			if err := w.walkTree(e.Sha, full, done, show); err != nil {
+				return err
+			}
+		case e.Mode == "160000":
+			// Submodule commits live in another repository.
+		case !done[e.Sha]:
+			done[e.Sha] = true
+			if show != nil {
+				show(e.Sha, full)
+			}
+		}
+	}
+	return nil
+}
+
+// inPaths reports whether a path is inside the limiting paths, or for a
+// tree leads to one of them.
+func (w *revWalk) inPaths(name string, tree bool) bool {
+	if len(w.paths) == 0 {
+		return true
+	}
+	for _, p := range w.paths {
+		if p == "" || name == p || strings.HasPrefix(name, p+"/") || (tree && strings.HasPrefix(p, name+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// aheadBehind counts the commits reachable from one but not from two,
+// and the other way around.
+func aheadBehind(repo *repository.Repository, one, two string) (int, int, error) {
+	count := func(from, not string) (int, error) {
+		w := newRevWalk(repo)
+		w.addObject(from, "", false)
+		w.addObject(not, "", true)
+		list, err := w.commits()
+		return len(list), err
+	}
+	ahead, err := count(one, two)
+	if err != nil {
+		return 0, 0, err
+	}
+	behind, err := count(two, one)
+	return ahead, behind, err
+}
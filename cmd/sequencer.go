@@ -0,0 +1,1003 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/object"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/unpack"
+)
+
+// todoItem is a line of the todo list of a rebase. A blank line is an
+// item without a command: it is kept where it is, and counted in the
+// total as git counts it, but does nothing.
+type todoItem struct {
+	command string
+	flag    string // "-C" or "-c" for fixup
+	sha     string
+	// rest is what follows the commit, usually its subject; the command
+	// line of exec; the ref of update-ref.
+	rest string
+}
+
+// todoCommands maps the commands of the todo list and their
+// abbreviations to their names.
+var todoCommands = map[string]string{
+	"pick": "pick", "p": "pick",
+	"reword": "reword", "r": "reword",
+	"edit": "edit", "e": "edit",
+	"squash": "squash", "s": "squash",
+	"fixup": "fixup", "f": "fixup",
+	"exec": "exec", "x": "exec",
+	"break": "break", "b": "break",
+	"drop": "drop", "d": "drop",
+	"update-ref": "update-ref", "u": "update-ref",
+	"noop": "",
+}
+
+// takesCommit tells whether a command applies to a commit.
+func takesCommit(command string) bool {
+	switch command {
+	case "pick", "reword", "edit", "squash", "fixup", "drop":
+		return true
+	}
+	return false
+}
+
+func isFixup(command string) bool {
+	return command == "squash" || command == "fixup"
+}
+
+// format writes an item as a line of the todo list, with the commit
+// named by name.
+func (it todoItem) format(name func(string) string) string {
+	line := it.command
+	if it.flag != "" {
+		line += " " + it.flag
+	}
+	if takesCommit(it.command) {
+		line += " " + name(it.sha)
+	}
+	if it.rest != "" {
+		line += " " + it.rest
+	}
+	return line
+}
+
+// todoParseError is a line of the todo list that makes no sense.
+type todoParseError struct {
+	n    int
+	line string
+	// object is the name of the commit that doesn't resolve, if that is
+	// what is wrong.
+	object string
+}
+
+func (e *todoParseError) Error() string {
+	return fmt.Sprintf("invalid line %d: %s", e.n, e.line)
+}
+
+// parseTodo reads a todo list, leaving out its comments.
+// ref: todo_list_parse_insn_buffer in https://github.com/git/git/blob/master/sequencer.c
+func parseTodo(repo *repository.Repository, text string) ([]todoItem, error) {
+	items := []todoItem{}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			items = append(items, todoItem{})
+			continue
+		}
+		if strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		bad := &todoParseError{n: i + 1, line: strings.TrimRight(line, "\r")}
+		command, ok := todoCommands[fields[0]]
+		if !ok {
+			return nil, bad
+		}
+		it := todoItem{command: command}
+		args := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0]))
+		switch {
+		case command == "":
+			continue
+		case command == "break":
+			if args != "" {
+				return nil, bad
+			}
+		case command == "exec" || command == "update-ref":
+			if args == "" {
+				return nil, bad
+			}
+			it.rest = args
+		default:
+			if command == "fixup" && len(fields) > 1 && (fields[1] == "-C" || fields[1] == "-c") {
+				it.flag = fields[1]
+				args = strings.TrimSpace(strings.TrimPrefix(args, fields[1]))
+			}
+			name, rest, _ := strings.Cut(args, " ")
+			sha, err := resolveRevisionAs(repo, name, "commit")
+			if err == nil {
+				sha, err = peelTo(repo, name, sha, "commit")
+			}
+			if name == "" || err != nil {
+				if name != "" {
+					bad.object = name
+				}
+				return nil, bad
+			}
+			it.sha, it.rest = sha, strings.TrimSpace(rest)
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// countCommands is the number of commands of a todo list, blank lines
+// left out.
+func countCommands(items []todoItem) int {
+	n := 0
+	for _, it := range items {
+		if it.command != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// todoHelp follows the todo list in the editor.
+const todoHelp = `
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup [-C | -c] <commit> = like "squash" but keep only the previous
+#                    commit's log message, unless -C is used, in which case
+#                    keep only this commit's message; -c is same as -C but
+#                    opens the editor
+# x, exec <command> = run command (the rest of the line) using shell
+# b, break = stop here (continue rebase later with 'git rebase --continue')
+# d, drop <commit> = remove commit
+# l, label <label> = label current HEAD with a name
+# t, reset <label> = reset HEAD to a label
+# m, merge [-C <commit> | -c <commit>] <label> [# <oneline>]
+#         create a merge commit using the original merge commit's
+#         message (or the oneline, if no original merge commit was
+#         specified); use -c <commit> to reword the commit message
+# u, update-ref <ref> = track a placeholder for the <ref> to be updated
+#                       to this position in the new commits. The <ref> is
+#                       updated at the end of the rebase
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+#
+`
+
+// todoList makes the list of commits to pick: those of head that
+// upstream doesn't have, oldest first, without merges, and without
+// those whose changes upstream already made, which are reported.
+// ref: sequencer_make_script in https://github.com/git/git/blob/master/sequencer.c
+func todoList(repo *repository.Repository, upstream, head string, reapply bool) ([]todoItem, error) {
+	walk := func(from, not string) ([]*commitNode, error) {
+		w := newRevWalk(repo)
+		w.order, w.reverse, w.maxParents = "topo", true, 1
+		w.addObject(from, "", false)
+		w.addObject(not, "", true)
+		return w.commits()
+	}
+	ours, err := walk(head, upstream)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := walk(upstream, head)
+	if err != nil {
+		return nil, err
+	}
+	upstreamIDs := map[string]bool{}
+	if len(ours) > 0 && !reapply {
+		for _, n := range theirs {
+			id, err := patchID(repo, n.commit)
+			if err != nil {
+				return nil, err
+			}
+			upstreamIDs[id] = true
+		}
+	}
+	items := []todoItem{}
+	skipped := false
+	for _, n := range ours {
+		if len(upstreamIDs) > 0 {
+			id, err := patchID(repo, n.commit)
+			if err != nil {
+				return nil, err
+			}
+			if upstreamIDs[id] {
+				fmt.Fprintf(os.Stderr, "warning: skipped previously applied commit %s\n", repo.Objects().Abbrev(n.sha, defaultAbbrev(repo)))
+				skipped = true
+				continue
+			}
+		}
+		subject, _ := formatSubject(skipBlankLines(n.commit.Message), " ")
+		items = append(items, todoItem{command: "pick", sha: n.sha, rest: subject})
+	}
+	if skipped {
+		if cfg, err := repo.Config(); err == nil {
+			if advice, _ := cfg.Bool("advice.skippedCherryPicks", true); advice {
+				fmt.Fprintln(os.Stderr, "hint: use --reapply-cherry-picks to include skipped commits")
+				fmt.Fprintln(os.Stderr, `hint: Disable this message with "git config advice.skippedCherryPicks false"`)
+			}
+		}
+	}
+	return items, nil
+}
+
+// patchID names the change a commit makes whatever it was made on: a
+// hash of its patch without the blob names, line numbers and
+// whitespace. Commits with the same patch id make the same change.
+// ref: commit_patch_id in https://github.com/git/git/blob/master/patch-ids.c
+func patchID(repo *repository.Repository, c *object.Commit) (string, error) {
+	parentTree := ""
+	if len(c.Parents) > 0 {
+		var err error
+		if parentTree, err = peelTo(repo, c.Parents[0], c.Parents[0], "tree"); err != nil {
+			return "", err
+		}
+	}
+	pairs, err := diff.Trees(repo.Objects(), parentTree, c.Tree, diff.TreeOptions{Recursive: true})
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	printer := &diff.Printer{Store: repo.Objects(), Out: &buf, Options: diff.DefaultOptions(), Abbrev: 7}
+	for _, pair := range pairs {
+		if err := printer.Patch(pair); err != nil {
+			return "", err
+		}
+	}
+	printer.Flush()
+	h := sha1.New()
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if strings.HasPrefix(line, "index ") || strings.HasPrefix(line, "@@ ") {
+			continue
+		}
+		h.Write([]byte(strings.Join(strings.Fields(line), "")))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// addUpdateRefs follows each commit that a branch other than the one
+// rebased points to with an update-ref of the branch, so that the
+// branch moves with the commit.
+// ref: todo_list_add_update_ref_commands in https://github.com/git/git/blob/master/sequencer.c
+func addUpdateRefs(repo *repository.Repository, items []todoItem, headName string) ([]todoItem, []string, error) {
+	branches, err := repo.Refs().List("refs/heads/")
+	if err != nil {
+		return nil, nil, err
+	}
+	at := map[string][]string{}
+	for _, ref := range branches {
+		if ref.Name != headName && !ref.IsSymbolic() {
+			at[ref.Target] = append(at[ref.Target], ref.Name)
+		}
+	}
+	result := []todoItem{}
+	updated := []string{}
+	for _, it := range items {
+		result = append(result, it)
+		if it.command != "pick" {
+			continue
+		}
+		names := at[it.sha]
+		sort.Strings(names)
+		for _, name := range names {
+			result = append(result, todoItem{command: "update-ref", rest: name}, todoItem{})
+			updated = append(updated, name)
+		}
+	}
+	return result, updated, nil
+}
+
+// autosquash moves the commits whose subject starts with "fixup! ",
+// "squash! " or "amend! " right after the commit they name, by subject,
+// by commit name or by the start of the subject, and makes them fixups
+// and squashes of it.
+// ref: todo_list_rearrange_squash in https://github.com/git/git/blob/master/sequencer.c
+func autosquash(repo *repository.Repository, items []todoItem) []todoItem {
+	n := len(items)
+	next, tail := make([]int, n), make([]int, n)
+	subjects := make([]string, n)
+	bySubject := map[string]int{}
+	moved := false
+	for i := range items {
+		next[i], tail[i] = -1, -1
+		if items[i].command != "pick" {
+			continue
+		}
+		subject := items[i].rest
+		if c, err := readCommit(repo, items[i].sha); err == nil {
+			subject, _ = formatSubject(skipBlankLines(c.Message), " ")
+		}
+		subjects[i] = subject
+		command, flag := "", ""
+		switch {
+		case strings.HasPrefix(subject, "fixup! "):
+			command = "fixup"
+		case strings.HasPrefix(subject, "squash! "):
+			command = "squash"
+		case strings.HasPrefix(subject, "amend! "):
+			command, flag = "fixup", "-C"
+		}
+		if command != "" {
+			p := subject
+			for {
+				rest, ok := cutFixupPrefix(p)
+				if !ok {
+					break
+				}
+				p = rest
+			}
+			target := -1
+			if j, ok := bySubject[p]; ok {
+				target = j
+			} else if !strings.Contains(p, " ") {
+				if sha, err := resolveRevisionAs(repo, p, "commit"); err == nil {
+					for j := 0; j < i; j++ {
+						if items[j].sha == sha && items[j].command == "pick" {
+							target = j
+							break
+						}
+					}
+				}
+			}
+			if target < 0 {
+				for j := 0; j < i; j++ {
+					if subjects[j] != "" && strings.HasPrefix(subjects[j], p) {
+						target = j
+						break
+					}
+				}
+			}
+			if target >= 0 {
+				moved = true
+				items[i].command, items[i].flag = command, flag
+				if tail[target] < 0 {
+					next[i] = next[target]
+					next[target] = i
+				} else {
+					next[i] = next[tail[target]]
+					next[tail[target]] = i
+				}
+				tail[target] = i
+			}
+		}
+		if _, ok := bySubject[subject]; !ok {
+			bySubject[subject] = i
+		}
+	}
+	if !moved {
+		return items
+	}
+	result := make([]todoItem, 0, n)
+	for i := range items {
+		if isFixup(items[i].command) {
+			continue
+		}
+		for cur := i; cur >= 0; cur = next[cur] {
+			result = append(result, items[cur])
+		}
+	}
+	return result
+}
+
+// cutFixupPrefix takes "fixup! ", "squash! " or "amend! " off a
+// subject.
+func cutFixupPrefix(subject string) (string, bool) {
+	for _, prefix := range []string{"fixup! ", "squash! ", "amend! "} {
+		if rest, ok := strings.CutPrefix(subject, prefix); ok {
+			return rest, true
+		}
+	}
+	return subject, false
+}
+
+// run carries out the todo list, one command after the other, until it
+// is done or a command stops it.
+// ref: pick_commits in https://github.com/git/git/blob/master/sequencer.c
+func (s *rebaseState) run() int {
+	for {
+		items, err := s.readTodo()
+		if err != nil {
+			return s.badTodo(err)
+		}
+		if len(items) == 0 {
+			return s.finish()
+		}
+		it := items[0]
+		if err := s.append("done", it.format(func(sha string) string { return sha })+"\n"); err != nil {
+			return die("%v", err)
+		}
+		if err := s.writeTodo(items[1:]); err != nil {
+			return die("%v", err)
+		}
+		if it.command == "" {
+			continue
+		}
+		msgnum, _ := strconv.Atoi(s.readLine("msgnum"))
+		msgnum++
+		if err := s.write("msgnum", fmt.Sprintf("%d\n", msgnum)); err != nil {
+			return die("%v", err)
+		}
+		if !s.quiet {
+			fmt.Fprintf(os.Stderr, "Rebasing (%d/%s)\r", msgnum, s.readLine("end"))
+		}
+		var code int
+		var stop bool
+		switch it.command {
+		case "pick", "reword", "edit", "squash", "fixup":
+			code, stop = s.pick(it, items[1:])
+		case "exec":
+			code, stop = s.exec(it)
+		case "break":
+			s.clearLine()
+			head, err := s.head()
+			if err != nil {
+				return die("%v", err)
+			}
+			c, err := readCommit(s.repo, head)
+			if err != nil {
+				return die("%v", err)
+			}
+			fmt.Fprintf(os.Stderr, "Stopped at %s\n", s.label(head, c))
+			code, stop = 0, true
+		case "update-ref":
+			code, stop = s.updateRef(it.rest), false
+		}
+		if stop || code != 0 {
+			return code
+		}
+	}
+}
+
+// printTodoError tells what is wrong with a todo list.
+func printTodoError(err error) {
+	var parseErr *todoParseError
+	if errors.As(err, &parseErr) && parseErr.object != "" {
+		fmt.Fprintf(os.Stderr, "error: could not parse '%s'\n", parseErr.object)
+	}
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+}
+
+// badTodo reports a todo list that doesn't parse.
+func (s *rebaseState) badTodo(err error) int {
+	printTodoError(err)
+	fmt.Fprintln(os.Stderr, "You can fix this with 'git rebase --edit-todo' and then run 'git rebase --continue'.")
+	fmt.Fprintln(os.Stderr, "Or you can abort the rebase with 'git rebase --abort'.")
+	return 1
+}
+
+// clearLine erases the progress line, as git's term_clear_line does.
+func (s *rebaseState) clearLine() {
+	if s.quiet {
+		return
+	}
+	if term := os.Getenv("TERM"); term == "" || term == "dumb" {
+		fmt.Fprintf(os.Stderr, "\r%*s\r", diff.TerminalWidth(), "")
+	} else {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
+
+// label names a commit in messages: "<abbrev> (<subject>)".
+func (s *rebaseState) label(sha string, c *object.Commit) string {
+	subject, _ := splitSubjectBody(c.Message)
+	return fmt.Sprintf("%s (%s)", s.repo.Objects().Abbrev(sha, defaultAbbrev(s.repo)), subject)
+}
+
+// pick applies the change of a commit on top of HEAD: by fast-forwarding
+// to it when HEAD is its parent, or else by a three-way merge. It makes
+// a new commit, or with squash and fixup amends HEAD; reword edits the
+// message and edit stops after committing.
+// ref: do_pick_commit in https://github.com/git/git/blob/master/sequencer.c
+func (s *rebaseState) pick(it todoItem, rest []todoItem) (int, bool) {
+	repo := s.repo
+	c, err := readCommit(repo, it.sha)
+	if err != nil {
+		return die("%v", err), true
+	}
+	if len(c.Parents) > 1 {
+		fmt.Fprintf(os.Stderr, "error: commit %s is a merge but no -m option was given.\n", it.sha)
+		return 1, true
+	}
+	head, err := s.head()
+	if err != nil {
+		return die("%v", err), true
+	}
+	parent := ""
+	if len(c.Parents) == 1 {
+		parent = c.Parents[0]
+	}
+	subject, _ := splitSubjectBody(c.Message)
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err), true
+	}
+
+	if !isFixup(it.command) && parent != "" && parent == head {
+		if code := checkoutCommit(repo, idx, head, it.sha); code != 0 {
+			return code, true
+		}
+		if err := repo.Refs().Update(refs.HEAD, it.sha, head, "rebase: fast-forward", true); err != nil {
+			return die("%v", err), true
+		}
+		switch it.command {
+		case "reword":
+			return s.amend(it.sha, fmt.Sprintf("rebase (%s)", it.command)), false
+		case "edit":
+			return s.stopForEdit(it, c)
+		}
+		return 0, false
+	}
+
+	headTree, err := peelTo(repo, head, head, "tree")
+	if err != nil {
+		return die("%v", err), true
+	}
+	parentTree := ""
+	if parent != "" {
+		if parentTree, err = peelTo(repo, parent, parent, "tree"); err != nil {
+			return die("%v", err), true
+		}
+	}
+	style, err := conflictStyle(repo)
+	if err != nil {
+		return die("%v", err), true
+	}
+	label := s.label(it.sha, c)
+	res, err := merge.Trees(parentTree, headTree, c.Tree, merge.Options{
+		Store:         repo.Objects(),
+		AncestorLabel: "parent of " + label,
+		OursLabel:     "HEAD",
+		TheirsLabel:   label,
+		Style:         style,
+		RenameLimit:   diff.DefaultRenameLimit,
+	})
+	if err != nil {
+		return die("%v", err), true
+	}
+	if code := applyMerge(repo, idx, headTree, res); code != 0 {
+		return code, true
+	}
+	// Like git, only the merges that conflict tell what they did.
+	if !res.Clean {
+		printMergeMessages(res)
+	}
+
+	msg, author := c.Message, &c.Author
+	if isFixup(it.command) {
+		headCommit, err := readCommit(repo, head)
+		if err != nil {
+			return die("%v", err), true
+		}
+		if msg, err = s.updateSquashMessage(it, headCommit, c); err != nil {
+			return die("%v", err), true
+		}
+		author = &headCommit.Author
+		if err := s.write("amend", head+"\n"); err != nil {
+			return die("%v", err), true
+		}
+	}
+	if !res.Clean {
+		return s.stopForConflicts(it, msg, author, res), true
+	}
+	if isFixup(it.command) {
+		return s.commitFixup(it.command, rest, res.Tree, false), false
+	}
+	if res.Tree == headTree && c.Tree != parentTree {
+		if !s.has("drop_redundant_commits") {
+			return s.stopForEmpty(it, msg, author), true
+		}
+		fmt.Fprintf(os.Stderr, "dropping %s %s -- patch contents already upstream\n", it.sha, subject)
+		return 0, false
+	}
+	if it.command == "reword" {
+		edited, ok := s.editCommitMessage(msg)
+		if !ok {
+			return 1, true
+		}
+		msg = edited
+	}
+	sha, err := createCommit(repo, res.Tree, []string{head}, msg, author)
+	if err != nil {
+		return die("%v", err), true
+	}
+	newSubject, _, _ := strings.Cut(msg, "\n")
+	if err := repo.Refs().Update(refs.HEAD, sha, head, fmt.Sprintf("rebase (%s): %s", it.command, newSubject), true); err != nil {
+		return die("%v", err), true
+	}
+	switch it.command {
+	case "reword":
+		if err := printCommitSummary(repo, &branchInfo{name: refs.HEAD, commit: head}, sha, true); err != nil {
+			return die("%v", err), true
+		}
+	case "edit":
+		return s.stopForEdit(it, c)
+	}
+	return 0, false
+}
+
+// editCommitMessage lets the user edit the message of a commit being
+// made; an empty message aborts it.
+func (s *rebaseState) editCommitMessage(msg string) (string, bool) {
+	edited, err := editMessage(s.repo, "COMMIT_EDITMSG", msg+commitTemplate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return "", false
+	}
+	if edited = cleanupMessage(edited, true); edited == "" {
+		fmt.Fprintln(os.Stderr, "Aborting commit due to empty commit message.")
+		return "", false
+	}
+	return edited, true
+}
+
+// amend replaces HEAD with a commit of the index whose message the user
+// edits, as "commit --amend" does.
+func (s *rebaseState) amend(head, action string) int {
+	repo := s.repo
+	c, err := readCommit(repo, head)
+	if err != nil {
+		return die("%v", err)
+	}
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	tree, err := unpack.WriteTree(repo.Objects(), idx.Entries)
+	if err != nil {
+		return die("%v", err)
+	}
+	msg, ok := s.editCommitMessage(c.Message)
+	if !ok {
+		return 1
+	}
+	sha, err := createCommit(repo, tree, c.Parents, msg, &c.Author)
+	if err != nil {
+		return die("%v", err)
+	}
+	subject, _, _ := strings.Cut(msg, "\n")
+	if err := repo.Refs().Update(refs.HEAD, sha, head, action+": "+subject, true); err != nil {
+		return die("%v", err)
+	}
+	if err := printCommitSummary(repo, &branchInfo{name: refs.HEAD, commit: head}, sha, true); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// stopForEdit stops after the commit of an edit, for the user to amend
+// it.
+func (s *rebaseState) stopForEdit(it todoItem, c *object.Commit) (int, bool) {
+	head, err := s.head()
+	if err != nil {
+		return die("%v", err), true
+	}
+	if err := s.saveStop(it.sha, c.Message, &c.Author); err != nil {
+		return die("%v", err), true
+	}
+	if err := s.write("amend", head+"\n"); err != nil {
+		return die("%v", err), true
+	}
+	s.clearLine()
+	fmt.Fprintf(os.Stderr, "Stopped at %s...  %s\n", s.repo.Objects().Abbrev(it.sha, defaultAbbrev(s.repo)), it.rest)
+	fmt.Fprint(os.Stderr, "You can amend the commit now, with\n\n  git commit --amend \n\nOnce you are satisfied with your changes, run\n\n  git rebase --continue\n")
+	return 0, true
+}
+
+// stopForConflicts stops a pick that conflicts, for the user to resolve
+// the conflicts and go on with "rebase --continue".
+func (s *rebaseState) stopForConflicts(it todoItem, msg string, author *object.Signature, res *merge.Result) int {
+	repo := s.repo
+	if err := s.saveStop(it.sha, msg, author); err != nil {
+		return die("%v", err)
+	}
+	if err := os.WriteFile(repo.Path("MERGE_MSG"), []byte(msg), 0o666); err != nil {
+		return die("%v", err)
+	}
+	if err := suggestConflicts(repo, res); err != nil {
+		return die("%v", err)
+	}
+	// Like git, tell the commit by its line of the todo list.
+	abbrev := repo.Objects().Abbrev(it.sha, defaultAbbrev(repo))
+	fmt.Fprintf(os.Stderr, "error: could not apply %s... %s\n", abbrev, it.rest)
+	fmt.Fprintln(os.Stderr, "hint: Resolve all conflicts manually, mark them as resolved with")
+	fmt.Fprintln(os.Stderr, `hint: "git add/rm <conflicted_files>", then run "git rebase --continue".`)
+	fmt.Fprintln(os.Stderr, `hint: You can instead skip this commit: run "git rebase --skip".`)
+	fmt.Fprintln(os.Stderr, `hint: To abort and get back to the state before "git rebase", run "git rebase --abort".`)
+	fmt.Fprintf(os.Stderr, "Could not apply %s... %s\n", abbrev, it.rest)
+	return 1
+}
+
+// stopForEmpty stops a pick of -i that leaves nothing to commit, for the
+// user to commit it anyway or skip it.
+func (s *rebaseState) stopForEmpty(it todoItem, msg string, author *object.Signature) int {
+	if err := s.saveStop(it.sha, msg, author); err != nil {
+		return die("%v", err)
+	}
+	fmt.Fprint(os.Stderr, "The previous cherry-pick is now empty, possibly due to conflict resolution.\n"+
+		"If you wish to commit it anyway, use:\n\n    git commit --allow-empty\n\n"+
+		"Otherwise, please use 'git rebase --skip'\n")
+	fmt.Fprintf(os.Stderr, "Could not apply %s... %s\n", s.repo.Objects().Abbrev(it.sha, defaultAbbrev(s.repo)), it.rest)
+	return 1
+}
+
+// saveStop records the commit a rebase stopped at, with the message and
+// author of the commit to make for it.
+func (s *rebaseState) saveStop(sha, msg string, author *object.Signature) error {
+	if err := s.write("stopped-sha", sha+"\n"); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.repo.Path("REBASE_HEAD"), []byte(sha+"\n"), 0o666); err != nil {
+		return err
+	}
+	if err := s.write("message", msg); err != nil {
+		return err
+	}
+	return s.writeAuthorScript(author)
+}
+
+// Headers of the messages of squashes.
+// ref: update_squash_messages in https://github.com/git/git/blob/master/sequencer.c
+const (
+	combinedCommitMsg = "# This is a combination of %d commits."
+	firstCommitMsg    = "# This is the 1st commit message:"
+	skipFirstMsg      = "# The 1st commit message will be skipped:"
+	nthCommitMsg      = "# This is the commit message #%d:"
+	skipNthCommitMsg  = "# The commit message #%d will be skipped:"
+)
+
+// updateSquashMessage adds the message of a commit squashed or fixed up
+// into HEAD to the message of the squash, with the messages to skip
+// commented out, and returns it.
+func (s *rebaseState) updateSquashMessage(it todoItem, head, c *object.Commit) (string, error) {
+	current := s.read("current-fixups")
+	fixups := strings.Count(current, "\n")
+	if current != "" {
+		fixups++
+	}
+	seenSquash := strings.Contains(current, "squash")
+	useMessage := it.flag != "" // fixup -C and -c take the message of the commit
+	var b strings.Builder
+	if fixups > 0 {
+		msg := s.read("message-squash")
+		if strings.HasPrefix(msg, "#") {
+			_, msg, _ = strings.Cut(msg, "\n")
+			fmt.Fprintf(&b, combinedCommitMsg+"\n", fixups+2)
+		}
+		if useMessage && !seenSquash {
+			msg = commentLines(msg)
+		}
+		b.WriteString(msg)
+	} else {
+		fmt.Fprintf(&b, combinedCommitMsg+"\n", 2)
+		if useMessage {
+			b.WriteString(skipFirstMsg + "\n\n" + commentLines(head.Message))
+		} else {
+			b.WriteString(firstCommitMsg + "\n\n" + head.Message)
+		}
+	}
+	n := fixups + 2
+	switch {
+	case it.command == "squash" || useMessage:
+		body := c.Message
+		if strings.HasPrefix(body, "amend!") || (it.command == "squash" || seenSquash) && (strings.HasPrefix(body, "squash!") || strings.HasPrefix(body, "fixup!")) {
+			// The subject only names the commit to squash into.
+			end := subjectLength(body)
+			body = commentLines(body[:end]) + body[end:]
+		}
+		fmt.Fprintf(&b, "\n"+nthCommitMsg+"\n\n%s", n, body)
+	default:
+		fmt.Fprintf(&b, "\n"+skipNthCommitMsg+"\n\n%s", n, commentLines(c.Message))
+	}
+	if current != "" {
+		current += "\n"
+	}
+	if err := s.write("current-fixups", fmt.Sprintf("%s%s %s", current, it.command, it.sha)); err != nil {
+		return "", err
+	}
+	if err := s.write("message-squash", b.String()); err != nil {
+		return "", err
+	}
+	// message-fixup is the message of a chain of fixups, which needs no
+	// editing; a squash or a fixup -c asks for the editor.
+	if it.command == "fixup" && it.flag != "-c" && !seenSquash {
+		if err := s.write("message-fixup", cleanupMessage(b.String(), true)); err != nil {
+			return "", err
+		}
+	} else {
+		s.remove("message-fixup")
+	}
+	return b.String(), nil
+}
+
+// subjectLength is the length of the first paragraph of a message,
+// with its last newline.
+func subjectLength(msg string) int {
+	end := strings.Index(msg, "\n\n")
+	if end < 0 {
+		return len(msg)
+	}
+	return end + 1
+}
+
+// commentLines comments every line of a message out, as
+// strbuf_add_commented_lines does.
+func commentLines(msg string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(msg, "\n") {
+		switch {
+		case line == "":
+		case line == "\n":
+			b.WriteString("#\n")
+		default:
+			b.WriteString("# " + line)
+		}
+	}
+	if !strings.HasSuffix(b.String(), "\n") && b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// commitFixup amends HEAD with the tree of a squash or fixup. The last
+// of a run of them settles the message: the user edits it if any of
+// them was a squash, or if it concludes conflicts, and the comments go.
+func (s *rebaseState) commitFixup(command string, rest []todoItem, tree string, resolved bool) int {
+	repo := s.repo
+	head, err := s.head()
+	if err != nil {
+		return die("%v", err)
+	}
+	headCommit, err := readCommit(repo, head)
+	if err != nil {
+		return die("%v", err)
+	}
+	msg := s.read("message-squash")
+	final := isFinalFixup(rest)
+	edit := false
+	if final {
+		edit = resolved || !s.has("message-fixup")
+		if edit {
+			var ok bool
+			if msg, ok = s.editCommitMessage(msg); !ok {
+				return 1
+			}
+		} else {
+			msg = cleanupMessage(msg, true)
+		}
+	}
+	sha, err := createCommit(repo, tree, headCommit.Parents, msg, &headCommit.Author)
+	if err != nil {
+		return die("%v", err)
+	}
+	subject, _, _ := strings.Cut(msg, "\n")
+	if err := repo.Refs().Update(refs.HEAD, sha, head, fmt.Sprintf("rebase (%s): %s", command, subject), true); err != nil {
+		return die("%v", err)
+	}
+	s.remove("amend")
+	if !final {
+		return 0
+	}
+	s.remove("current-fixups", "message-squash", "message-fixup")
+	if edit {
+		if err := printCommitSummary(repo, &branchInfo{name: refs.HEAD, commit: head}, sha, true); err != nil {
+			return die("%v", err)
+		}
+	}
+	return 0
+}
+
+// isFinalFixup tells whether no squash or fixup follows, before the
+// next command that does something.
+// ref: is_final_fixup in https://github.com/git/git/blob/master/sequencer.c
+func isFinalFixup(rest []todoItem) bool {
+	for _, it := range rest {
+		if isFixup(it.command) {
+			return false
+		}
+		if it.command != "" && it.command != "drop" {
+			break
+		}
+	}
+	return true
+}
+
+// exec runs the command of an exec through the shell. A command that
+// fails, or leaves changes behind, stops the rebase.
+// ref: do_exec in https://github.com/git/git/blob/master/sequencer.c
+func (s *rebaseState) exec(it todoItem) (int, bool) {
+	s.clearLine()
+	fmt.Fprintf(os.Stderr, "Executing: %s\n", it.rest)
+	c := exec.Command("sh", "-c", it.rest)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: execution failed: %s\n", it.rest)
+		fmt.Fprint(os.Stderr, "You can fix the problem, and then run\n\n  git rebase --continue\n\n\n")
+		return 1, true
+	}
+	dirty, err := s.dirty()
+	if err != nil {
+		return die("%v", err), true
+	}
+	if dirty {
+		fmt.Fprintf(os.Stderr, "warning: execution succeeded: %s\nbut left changes to the index and/or the working tree\n", it.rest)
+		fmt.Fprint(os.Stderr, "Commit or stash your changes, and then run\n\n  git rebase --continue\n\n\n")
+		return 1, true
+	}
+	return 0, false
+}
+
+// updateRef records where HEAD is for a branch to move to at the end.
+func (s *rebaseState) updateRef(name string) int {
+	head, err := s.head()
+	if err != nil {
+		return die("%v", err)
+	}
+	updates, err := s.readUpdateRefs()
+	if err != nil {
+		return die("%v", err)
+	}
+	for i := range updates {
+		if updates[i].name == name {
+			updates[i].new = head
+		}
+	}
+	if err := s.writeUpdateRefs(updates); err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// refUpdate is a branch that --update-refs moves: where it was and where
+// it goes, zero until its update-ref is done.
+type refUpdate struct {
+	name, old, new string
+}
+
+func (s *rebaseState) readUpdateRefs() ([]refUpdate, error) {
+	lines := strings.Fields(s.read("update-refs"))
+	if len(lines)%3 != 0 {
+		return nil, fmt.Errorf("corrupt %s", s.path("update-refs"))
+	}
+	updates := []refUpdate{}
+	for i := 0; i < len(lines); i += 3 {
+		updates = append(updates, refUpdate{lines[i], lines[i+1], lines[i+2]})
+	}
+	return updates, nil
+}
+
+func (s *rebaseState) writeUpdateRefs(updates []refUpdate) error {
+	var b strings.Builder
+	for _, u := range updates {
+		fmt.Fprintf(&b, "%s\n%s\n%s\n", u.name, u.old, u.new)
+	}
+	return s.write("update-refs", b.String())
+}
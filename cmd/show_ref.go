@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+)
+
+// ShowRef implements "show-ref".
+// ref: https://git-scm.com/docs/git-show-ref
+func ShowRef(args []string) int {
+	head, heads, tags, deref, verify, quiet, exists := false, false, false, false, false, false, false
+	hashOnly := false
+	abbrev := 0
+	patterns := []string{}
+	for _, arg := range args {
+		switch {
+		case arg == "--head":
+			head = true
+		case arg == "--heads" || arg == "--branches":
+			heads = true
+		case arg == "--tags":
+			tags = true
+		case arg == "-d" || arg == "--dereference":
+			deref = true
+		case arg == "--verify":
+			verify = true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--exists":
+			exists = true
+		case arg == "-s" || arg == "--hash":
+			hashOnly = true
+		case strings.HasPrefix(arg, "--hash="):
+			hashOnly = true
+			abbrev = parseAbbrev(strings.TrimPrefix(arg, "--hash="))
+		case arg == "--abbrev":
+			abbrev = 7
+		case strings.HasPrefix(arg, "--abbrev="):
+			abbrev = parseAbbrev(strings.TrimPrefix(arg, "--abbrev="))
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	store := repo.Refs()
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	show := func(ref *refs.Ref, sha string) {
+		if quiet {
+			return
+		}
+		shown := sha
+		if abbrev > 0 && abbrev < len(sha) {
+			shown = sha[:abbrev]
+		}
+		if hashOnly {
+			fmt.Fprintln(out, shown)
+		} else {
+			fmt.Fprintf(out, "%s %s\n", shown, ref.Name)
+		}
+		if deref {
+			// packed-refs already records the peeled value of tags.
+			peeled, err := ref.Peeled, error(nil)
+			if peeled == "" {
+				peeled, _, err = peel(repo.Objects(), sha)
+			}
+			if err == nil && peeled != sha {
+				if abbrev > 0 && abbrev < len(peeled) {
+					peeled = peeled[:abbrev]
+				}
+				if hashOnly {
+					fmt.Fprintln(out, peeled)
+				} else {
+					fmt.Fprintf(out, "%s %s^{}\n", peeled, ref.Name)
+				}
+			}
+		}
+	}
+
+	if exists {
+		if len(patterns) != 1 {
+			return usage("--exists requires exactly one reference")
+		}
+		if _, err := store.Read(patterns[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: reference does not exist\n")
+			return 2
+		}
+		return 0
+	}
+
+	if verify {
+		if len(patterns) == 0 {
+			return die("--verify requires a reference")
+		}
+		for _, name := range patterns {
+			ref, err := store.Resolve(name)
+			if err != nil || !(name == refs.HEAD || strings.HasPrefix(name, "refs/")) {
+				if quiet {
+					return 1
+				}
+				return die("'%s' - not a valid ref", name)
+			}
+			show(&refs.Ref{Name: name}, ref.Target)
+		}
+		return 0
+	}
+
+	found := false
+	if head && len(patterns) == 0 {
+		if ref, err := store.Resolve(refs.HEAD); err == nil {
+			show(&refs.Ref{Name: refs.HEAD}, ref.Target)
+			found = true
+		}
+	}
+	all, err := store.List("refs/")
+	if err != nil {
+		return die("%v", err)
+	}
+	for _, ref := range all {
+		if (heads || tags) && !(heads && strings.HasPrefix(ref.Name, "refs/heads/")) &&
+			!(tags && strings.HasPrefix(ref.Name, "refs/tags/")) {
+			continue
+		}
+		if len(patterns) > 0 && !matchesTail(ref.Name, patterns) {
+			continue
+		}
+		resolved, err := store.Resolve(ref.Name)
+		if err != nil {
+			continue
+		}
+		show(ref, resolved.Target)
+		found = true
+	}
+	if !found {
+		return 1
+	}
+	return 0
+}
+
+// matchesTail matches whole trailing path components, so "master"
+// matches refs/heads/master and refs/remotes/origin/master.
+func matchesTail(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if name == pattern || strings.HasSuffix(name, "/"+strings.TrimPrefix(pattern, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAbbrev(value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 7
+	}
+	if n < 4 {
+		return 4
+	}
+	return n
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+)
+
+// SymbolicRef implements "symbolic-ref".
+// ref: https://git-scm.com/docs/git-symbolic-ref
+func SymbolicRef(args []string) int {
+	quiet, short, del, noRecurse := false, false, false, false
+	msg := ""
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--short":
+			short = true
+		case arg == "-d" || arg == "--delete":
+			del = true
+		case arg == "--no-recurse":
+			noRecurse = true
+		case arg == "--recurse":
+			noRecurse = false
+		case arg == "-m":
+			if i+1 >= len(args) {
+				return usage("switch `m' requires a value")
+			}
+			i++
+			msg = args[i]
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	store := repo.Refs()
+
+	switch {
+	case del:
+		if len(rest) != 1 {
+			return usage("usage: symbolic-ref -d [-q] <name>")
+		}
+		ref, err := store.Read(rest[0])
+		if err != nil || !ref.IsSymbolic() {
+			if quiet {
+				return 1
+			}
+			return die("Cannot delete %s, not a symbolic ref", rest[0])
+		}
+		if rest[0] == refs.HEAD {
+			return die("deleting '%s' is not allowed", rest[0])
+		}
+		if err := store.Delete(rest[0], "", true); err != nil {
+			return die("%v", err)
+		}
+		return 0
+	case len(rest) == 1:
+		name := rest[0]
+		ref, err := store.Read(name)
+		if err != nil || !ref.IsSymbolic() {
+			if quiet {
+				return 1
+			}
+			return die("ref %s is not a symbolic ref", name)
+		}
+		target := ref.Symref
+		if !noRecurse {
+			// Follow chains of symbolic refs to the last one.
+			for depth := 0; depth < 5; depth++ {
+				next, err := store.Read(target)
+				if err != nil || !next.IsSymbolic() {
+					break
+				}
+				target = next.Symref
+			}
+		}
+		if short {
+			target = refs.Shorten(target, store.Exists)
+		}
+		fmt.Println(target)
+		return 0
+	case len(rest) == 2:
+		name, target := rest[0], rest[1]
+		if name == refs.HEAD && !strings.HasPrefix(target, "refs/") {
+			return die("Refusing to point HEAD outside of refs/")
+		}
+		if !refs.ValidName(target) {
+			return die("Refusing to set '%s' to invalid ref '%s'", name, target)
+		}
+		if err := store.SetSymbolic(name, target, msg); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	return usage("usage: symbolic-ref [-m <reason>] <name> <ref>")
+}
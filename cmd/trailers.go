@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"strings"
+)
+
+// trailerOptions are the options of %(trailers).
+// ref: https://git-scm.com/docs/pretty-formats#Documentation/pretty-formats.txt-emtrailersoptionsem
+type trailerOptions struct {
+	keys              []string // show only these, compared without case
+	only              bool     // leave out the lines that aren't trailers
+	unfold            bool
+	keyOnly           bool
+	valueOnly         bool
+	separator         *string // between trailers instead of a newline
+	keyValueSeparator *string // instead of ": "
+}
+
+// trailerPrefixes are the trailers git writes itself; a block with one
+// of them needs only a quarter of its lines to be trailers.
+var trailerPrefixes = []string{"Signed-off-by: ", "(cherry picked from commit "}
+
+// trailerSeparators are the characters that may end the key of a
+// trailer, set by trailer.separators.
+func trailerSeparators(ctx *prettyContext) string {
+	if cfg, err := ctx.repo.Config(); err == nil {
+		if value, ok := cfg.Get("trailer.separators"); ok {
+			return value
+		}
+	}
+	return ":"
+}
+
+// formatTrailers shows the trailers of a commit message, which starts
+// with the subject, like git's format_trailers_from_commit.
+func formatTrailers(msg, separators string, opts trailerOptions) string {
+	end := len(msg) - ignoredMessageBytes(msg)
+	start := trailerBlockStart(msg[:end], separators)
+	if !opts.only && !opts.unfold && opts.keys == nil && opts.separator == nil && !opts.keyOnly && !opts.valueOnly && opts.keyValueSeparator == nil {
+		return msg[start:end]
+	}
+
+	// Lines that start with a space continue the trailer before them.
+	trailers := []string{}
+	continued := false
+	for block := msg[start:end]; block != ""; {
+		line := block
+		if i := strings.IndexByte(block, '\n'); i >= 0 {
+			line = block[:i+1]
+		}
+		block = block[len(line):]
+		if continued && isGitSpace(line[0]) {
+			trailers[len(trailers)-1] += line
+			continue
+		}
+		trailers = append(trailers, line)
+		continued = trailerSeparator(line, separators) >= 1
+	}
+
+	var sb strings.Builder
+	for _, trailer := range trailers {
+		pos := trailerSeparator(trailer, separators)
+		if pos < 1 {
+			if opts.only {
+				continue
+			}
+			if opts.separator != nil && sb.Len() > 0 {
+				sb.WriteString(*opts.separator)
+			}
+			sb.WriteString(trailer)
+			if opts.separator != nil {
+				s := strings.TrimRight(sb.String(), " \t\n\r")
+				sb.Reset()
+				sb.WriteString(s)
+			}
+			continue
+		}
+		key := strings.TrimSpace(trailer[:pos])
+		value := strings.TrimSpace(trailer[pos+1:])
+		if opts.keys != nil && !matchTrailerKey(opts.keys, key) {
+			continue
+		}
+		if opts.unfold {
+			value = unfoldTrailer(value)
+		}
+		if opts.separator != nil && sb.Len() > 0 {
+			sb.WriteString(*opts.separator)
+		}
+		if !opts.valueOnly {
+			sb.WriteString(key)
+		}
+		if !opts.keyOnly && !opts.valueOnly {
+			if opts.keyValueSeparator != nil {
+				sb.WriteString(*opts.keyValueSeparator)
+			} else {
+				sb.WriteString(": ")
+			}
+		}
+		if !opts.keyOnly {
+			sb.WriteString(value)
+		}
+		if opts.separator == nil {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// matchTrailerKey tells whether a key is one of those asked for; the
+// keys may end with the colon.
+func matchTrailerKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(strings.TrimSuffix(k, ":"), key) {
+			return true
+		}
+	}
+	return false
+}
+
+// unfoldTrailer joins the lines of a trailer value with single spaces.
+func unfoldTrailer(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\n' {
+			sb.WriteByte(value[i])
+			continue
+		}
+		for i+1 < len(value) && isGitSpace(value[i+1]) {
+			i++
+		}
+		sb.WriteByte(' ')
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// trailerSeparator finds the separator of a trailer line, after a key of
+// letters, digits and dashes and optional spaces; -1 if there is none.
+func trailerSeparator(line, separators string) int {
+	spaces := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case strings.IndexByte(separators, c) >= 0:
+			return i
+		case !spaces && (isAlnum(c) || c == '-'):
+		case i > 0 && (c == ' ' || c == '\t'):
+			spaces = true
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// isBlankLine tells whether the line at the start of s holds only spaces.
+func isBlankLine(s string) bool {
+	i := 0
+	for i < len(s) && s[i] != '\n' && isGitSpace(s[i]) {
+		i++
+	}
+	return i == len(s) || s[i] == '\n'
+}
+
+// nextLine is the offset of the line after the one at i.
+func nextLine(s string, i int) int {
+	if j := strings.IndexByte(s[i:], '\n'); j >= 0 {
+		return i + j + 1
+	}
+	return len(s)
+}
+
+// lastLine is the offset of the last line of s[:end], not counting a
+// final newline; -1 if there is none.
+func lastLine(s string, end int) int {
+	if end == 0 {
+		return -1
+	}
+	for i := end - 2; i >= 0; i-- {
+		if s[i] == '\n' {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// trailerBlockStart finds where the trailers of a message start: after
+// the blank line before the last paragraph, when that paragraph is all
+// trailers, or has a trailer git writes and a quarter of trailers. It
+// is len(msg) when there are none, like git's find_trailer_block_start.
+func trailerBlockStart(msg, separators string) int {
+	// The first paragraph is the title and cannot be trailers.
+	title := 0
+	for title < len(msg) {
+		if msg[title] != '#' && isBlankLine(msg[title:]) {
+			break
+		}
+		title = nextLine(msg, title)
+	}
+	onlySpaces, recognized := true, false
+	trailerLines, nonTrailerLines, continuations := 0, 0, 0
+	for l := lastLine(msg, len(msg)); l >= title; l = lastLine(msg, l) {
+		line := msg[l:]
+		if line[0] == '#' {
+			nonTrailerLines += continuations
+			continuations = 0
+			continue
+		}
+		if isBlankLine(line) {
+			if onlySpaces {
+				continue
+			}
+			nonTrailerLines += continuations
+			if recognized && trailerLines*3 >= nonTrailerLines || trailerLines > 0 && nonTrailerLines == 0 {
+				return nextLine(msg, l)
+			}
+			return len(msg)
+		}
+		onlySpaces = false
+		prefixed := false
+		for _, p := range trailerPrefixes {
+			if strings.HasPrefix(line, p) {
+				prefixed = true
+			}
+		}
+		switch {
+		case prefixed:
+			trailerLines++
+			continuations = 0
+			recognized = true
+		case trailerSeparator(line, separators) >= 1 && !isGitSpace(line[0]):
+			trailerLines++
+			continuations = 0
+		case isGitSpace(line[0]):
+			continuations++
+		default:
+			nonTrailerLines += 1 + continuations
+			continuations = 0
+		}
+	}
+	return len(msg)
+}
+
+// ignoredMessageBytes counts the bytes at the end of a message that
+// aren't part of it: comments, blank lines, an old "Conflicts:" block
+// and what follows a scissors line, like git's
+// ignored_log_message_bytes.
+func ignoredMessageBytes(msg string) int {
+	cutoff := len(msg)
+	const scissors = "# ------------------------ >8 ------------------------\n"
+	if strings.HasPrefix(msg, scissors) {
+		cutoff = 0
+	} else if i := strings.Index(msg, "\n"+scissors); i >= 0 {
+		cutoff = i + 1
+	}
+	boc := 0
+	conflicts := false
+	for bol := 0; bol < cutoff; bol = nextLine(msg, bol) {
+		switch {
+		case msg[bol] == '#' || msg[bol] == '\n':
+			if boc == 0 {
+				boc = bol
+			}
+		case strings.HasPrefix(msg[bol:], "Conflicts:\n"):
+			conflicts = true
+			if boc == 0 {
+				boc = bol
+			}
+		case conflicts && msg[bol] == '\t':
+		case boc != 0:
+			boc = 0
+			conflicts = false
+		}
+	}
+	if boc != 0 {
+		return len(msg) - boc
+	}
+	return len(msg) - cutoff
+}
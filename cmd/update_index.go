@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// UpdateIndex implements the refreshing of "update-index": --refresh
+// rereads the stat data of files whose contents still match the index,
+// and --really-refresh does so for files marked assume-unchanged too.
+// Files that don't match are reported as needing an update.
+// ref: https://git-scm.com/docs/git-update-index
+func UpdateIndex(args []string) int {
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+	if repo.IsBare() {
+		return die("this operation must be run in a work tree")
+	}
+	quiet, ignoreMissing, allowUnmerged := false, false, false
+	code := 0
+	refreshed := false
+	for _, arg := range args {
+		switch arg {
+		case "-q":
+			quiet = true
+		case "--ignore-missing":
+			ignoreMissing = true
+		case "--unmerged":
+			allowUnmerged = true
+		case "--refresh", "--really-refresh":
+			c := refreshIndex(repo, arg == "--really-refresh", quiet, ignoreMissing, allowUnmerged)
+			if c > 1 {
+				return c
+			}
+			if c != 0 {
+				code = c
+			}
+			refreshed = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return usage("unknown option '%s'", strings.TrimLeft(arg, "-"))
+			}
+			return usage("usage: git update-index [--refresh | --really-refresh] [-q] [--unmerged] [--ignore-missing]")
+		}
+	}
+	if !refreshed {
+		return usage("usage: git update-index [--refresh | --really-refresh] [-q] [--unmerged] [--ignore-missing]")
+	}
+	return code
+}
+
+// refreshIndex refreshes the index and writes it back if that changed
+// it, returning 1 when some entry needs an update or a merge.
+func refreshIndex(repo *repository.Repository, really, quiet, ignoreMissing, allowUnmerged bool) int {
+	idx, err := repo.Index()
+	if err != nil {
+		return die("%v", err)
+	}
+	stale, changed, err := idx.Refresh(repo.WorkTree, repo.Format, really)
+	if err != nil {
+		return die("%v", err)
+	}
+	code := 0
+	for _, s := range stale {
+		switch {
+		case s.Unmerged:
+			if allowUnmerged {
+				continue
+			}
+			fmt.Printf("%s: needs merge\n", s.Path)
+		case s.Missing && ignoreMissing:
+			continue
+		case quiet:
+			continue
+		default:
+			fmt.Printf("%s: needs update\n", s.Path)
+		}
+		code = 1
+	}
+	if changed {
+		if err := idx.Write(repo.IndexFile(), repo.Format); err != nil {
+			return die("%v", err)
+		}
+	}
+	return code
+}
@@ -0,0 +1,386 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/repository"
+)
+
+// UpdateRef implements "update-ref".
+// ref: https://git-scm.com/docs/git-update-ref
+func UpdateRef(args []string) int {
+	del, noDeref, stdin, null, createReflog := false, false, false, false, false
+	msg := ""
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-d":
+			del = true
+		case arg == "--no-deref":
+			noDeref = true
+		case arg == "--stdin":
+			stdin = true
+		case arg == "-z":
+			null = true
+		case arg == "--create-reflog":
+			createReflog = true
+		case strings.HasPrefix(arg, "-m") && len(arg) > 2:
+			msg = arg[2:]
+		case arg == "-m":
+			if i+1 >= len(args) {
+				return usage("switch `m' requires a value")
+			}
+			i++
+			msg = args[i]
+		case arg == "--":
+			rest = append(rest, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			return usage("unknown option `%s'", strings.TrimLeft(arg, "-"))
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	repo, err := openRepository()
+	if err != nil {
+		return die("%v", err)
+	}
+
+	if stdin {
+		if del || len(rest) > 0 {
+			return usage("update-ref --stdin takes no other arguments")
+		}
+		return updateRefStdin(repo, os.Stdin, null, noDeref, createReflog, msg)
+	}
+	if null {
+		return usage("-z only makes sense with --stdin")
+	}
+
+	if del {
+		if len(rest) < 1 || len(rest) > 2 {
+			return usage("usage: update-ref -d <refname> [<old-oid>]")
+		}
+		old := ""
+		if len(rest) == 2 {
+			if old, err = resolveOldValue(repo, rest[1]); err != nil {
+				return die("%v", err)
+			}
+		}
+		if err := deleteRef(repo, rest[0], old, msg, noDeref); err != nil {
+			return die("%v", err)
+		}
+		return 0
+	}
+	if len(rest) < 2 || len(rest) > 3 {
+		return usage("usage: update-ref <refname> <new-oid> [<old-oid>]")
+	}
+	newSha, err := resolveNewValue(repo, rest[1])
+	if err != nil {
+		return die("%v", err)
+	}
+	old := ""
+	if len(rest) == 3 {
+		if old, err = resolveOldValue(repo, rest[2]); err != nil {
+			return die("%v", err)
+		}
+	}
+	if newSha == repo.Format.ZeroHex() {
+		err = deleteRef(repo, rest[0], old, msg, noDeref)
+	} else {
+		if createReflog {
+			if err := createReflogFor(repo, rest[0], noDeref); err != nil {
+				return die("%v", err)
+			}
+		}
+		err = repo.Refs().Update(rest[0], newSha, old, msg, noDeref)
+	}
+	if err != nil {
+		return die("%v", err)
+	}
+	return 0
+}
+
+// deleteRef deletes a ref, logging msg in the reflog of HEAD when the
+// ref is the current branch.
+func deleteRef(repo *repository.Repository, name, old, msg string, noDeref bool) error {
+	tx := repo.Refs().NewTransaction()
+	if err := tx.Delete(name, old, msg, noDeref); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// resolveNewValue accepts any revision that names an existing object.
+func resolveNewValue(repo *repository.Repository, rev string) (string, error) {
+	if rev == "" || rev == repo.Format.ZeroHex() {
+		return repo.Format.ZeroHex(), nil
+	}
+	sha, err := resolveRevision(repo, rev)
+	if err != nil {
+		return "", fmt.Errorf("%s: not a valid SHA1", rev)
+	}
+	if !repo.Objects().Has(sha) {
+		return "", fmt.Errorf("trying to write ref with nonexistent object %s", sha)
+	}
+	return sha, nil
+}
+
+// resolveOldValue is like resolveNewValue, but the object doesn't need to
+// exist and the empty string means "must not exist".
+func resolveOldValue(repo *repository.Repository, rev string) (string, error) {
+	if rev == "" {
+		return repo.Format.ZeroHex(), nil
+	}
+	sha, err := resolveRevision(repo, rev)
+	if err != nil {
+		return "", fmt.Errorf("%s: not a valid old SHA1", rev)
+	}
+	return sha, nil
+}
+
+// createReflogFor creates the reflog of the ref an update of name writes.
+func createReflogFor(repo *repository.Repository, name string, noDeref bool) error {
+	if !noDeref {
+		if ref, _ := repo.Refs().Resolve(name); ref != nil {
+			name = ref.Name
+		}
+	}
+	return repo.Refs().CreateReflog(name)
+}
+
+// stdinCommand is one parsed line of "update-ref --stdin".
+type stdinCommand struct {
+	verb    string
+	ref     string
+	newSha  string
+	old     string
+	noDeref bool
+}
+
+// States of an "update-ref --stdin" session. Plain commands run in an
+// implicit transaction committed at the end of input, "start" opens an
+// explicit one that must be committed or is aborted at the end.
+const (
+	stdinOpen = iota
+	stdinStarted
+	stdinPrepared
+	stdinClosed
+)
+
+// updateRefStdin queues the commands read from r in a ref transaction.
+// ref: https://git-scm.com/docs/git-update-ref#_description
+func updateRefStdin(repo *repository.Repository, r io.Reader, null, noDeref, createReflog bool, msg string) int {
+	reader := bufio.NewReader(r)
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	state := stdinOpen
+	tx := repo.Refs().NewTransaction()
+	defer func() { tx.Abort() }()
+	reply := func(verb string) {
+		fmt.Fprintf(out, "%s: ok\n", verb)
+		out.Flush()
+	}
+	for {
+		cmd, err := readStdinCommand(repo, reader, null)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return die("%v", err)
+		}
+		switch cmd.verb {
+		case "start":
+			if state == stdinStarted {
+				return die("cannot restart ongoing transaction")
+			}
+			if state == stdinPrepared {
+				return die("prepared transactions can only be closed")
+			}
+			if state == stdinClosed {
+				tx = repo.Refs().NewTransaction()
+			}
+			state = stdinStarted
+			reply(cmd.verb)
+			continue
+		case "prepare":
+			if state == stdinPrepared || state == stdinClosed {
+				return die("prepared transactions can only be closed")
+			}
+			if err := tx.Prepare(); err != nil {
+				return die("%v", err)
+			}
+			state = stdinPrepared
+			reply(cmd.verb)
+			continue
+		case "commit":
+			if state == stdinClosed {
+				return die("transaction is closed")
+			}
+			if err := tx.Commit(); err != nil {
+				return die("%v", err)
+			}
+			state = stdinClosed
+			reply(cmd.verb)
+			continue
+		case "abort":
+			if state == stdinClosed {
+				return die("transaction is closed")
+			}
+			tx.Abort()
+			state = stdinClosed
+			reply(cmd.verb)
+			continue
+		}
+		switch state {
+		case stdinPrepared:
+			return die("prepared transactions can only be closed")
+		case stdinClosed:
+			return die("transaction is closed")
+		}
+		if cmd.verb == "option" {
+			noDeref = true
+			continue
+		}
+		cmd.noDeref = cmd.noDeref || noDeref
+		noDeref = false
+		if createReflog && (cmd.verb == "update" || cmd.verb == "create") {
+			if err := createReflogFor(repo, cmd.ref, cmd.noDeref); err != nil {
+				return die("%v", err)
+			}
+		}
+		if err := queueStdinCommand(repo, tx, cmd, msg); err != nil {
+			return die("%v", err)
+		}
+	}
+	// An implicit transaction commits at the end of input, an explicit
+	// one that wasn't committed is aborted.
+	if state == stdinOpen {
+		if err := tx.Commit(); err != nil {
+			return die("%v", err)
+		}
+	}
+	return 0
+}
+
+func queueStdinCommand(repo *repository.Repository, tx refs.Transaction, cmd *stdinCommand, msg string) error {
+	switch cmd.verb {
+	case "update", "create":
+		if cmd.newSha == repo.Format.ZeroHex() {
+			return tx.Delete(cmd.ref, cmd.old, msg, cmd.noDeref)
+		}
+		return tx.Update(cmd.ref, cmd.newSha, cmd.old, msg, cmd.noDeref)
+	case "delete":
+		return tx.Delete(cmd.ref, cmd.old, msg, cmd.noDeref)
+	case "verify":
+		return tx.Verify(cmd.ref, cmd.old, cmd.noDeref)
+	}
+	return nil
+}
+
+// readStdinCommand parses one command in either the line or the -z format.
+// ref: https://git-scm.com/docs/git-update-ref#_description
+func readStdinCommand(repo *repository.Repository, r *bufio.Reader, null bool) (*stdinCommand, error) {
+	var line string
+	var err error
+	if null {
+		line, err = r.ReadString(0)
+		line = strings.TrimSuffix(line, "\x00")
+	} else {
+		line, err = r.ReadString('\n')
+		line = strings.TrimSuffix(line, "\n")
+	}
+	if err == io.EOF && line == "" {
+		return nil, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !null && line == "" {
+		return nil, fmt.Errorf("empty command in input")
+	}
+
+	verb, rest := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		verb, rest = line[:i], line[i+1:]
+	}
+	// In the -z format the arguments after the ref are NUL-terminated.
+	args := []string{}
+	if null {
+		args = append(args, rest)
+		n := map[string]int{"update": 2, "create": 1, "delete": 1, "verify": 1}[verb]
+		for i := 0; i < n; i++ {
+			arg, err := r.ReadString(0)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: missing argument", verb, rest)
+			}
+			args = append(args, strings.TrimSuffix(arg, "\x00"))
+		}
+	} else if rest != "" {
+		args = strings.Split(rest, " ")
+	}
+
+	cmd := &stdinCommand{verb: verb}
+	expect := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			return fmt.Errorf("%s: wrong number of arguments", line)
+		}
+		return nil
+	}
+	switch verb {
+	case "start", "prepare", "commit", "abort":
+		if rest != "" {
+			return nil, fmt.Errorf("%s: extra input: %s", verb, rest)
+		}
+		return cmd, nil
+	case "option":
+		if rest != "no-deref" {
+			return nil, fmt.Errorf("option unknown: %s", rest)
+		}
+		return cmd, nil
+	case "update":
+		if err := expect(2, 3); err != nil {
+			return nil, err
+		}
+	case "create":
+		if err := expect(2, 2); err != nil {
+			return nil, err
+		}
+		args = append(args, repo.Format.ZeroHex())
+	case "delete", "verify":
+		if err := expect(1, 2); err != nil {
+			return nil, err
+		}
+		args = append([]string{args[0], ""}, args[1:]...)
+	default:
+		return nil, fmt.Errorf("unknown command: %s", line)
+	}
+	cmd.ref = args[0]
+	if verb == "update" || verb == "create" {
+		if cmd.newSha, err = resolveNewValue(repo, args[1]); err != nil {
+			return nil, err
+		}
+		if verb == "create" && cmd.newSha == repo.Format.ZeroHex() {
+			return nil, fmt.Errorf("create %s: zero <new-oid>", cmd.ref)
+		}
+	}
+	if len(args) > 2 {
+		old := args[2]
+		if old == "" && null && verb == "update" {
+			// An empty old value in the -z format means "don't check".
+			return cmd, nil
+		}
+		if cmd.old, err = resolveOldValue(repo, old); err != nil {
+			return nil, err
+		}
+	}
+	if verb == "verify" && cmd.old == "" {
+		cmd.old = repo.Format.ZeroHex()
+	}
+	return cmd, nil
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// wideRanges are the code points shown two columns wide: the East Asian
+// wide and fullwidth ones, and emoji.
+var wideRanges = []struct{ lo, hi rune }{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec},
+	{0x23f0, 0x23f0}, {0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267f, 0x267f}, {0x2693, 0x2693}, {0x26a1, 0x26a1},
+	{0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5}, {0x26ce, 0x26ce},
+	{0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+	{0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b},
+	{0x2728, 0x2728}, {0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27b0, 0x27b0}, {0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x2e80, 0x303e},
+	{0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf},
+	{0xa960, 0xa97f}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f}, {0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x1f300, 0x1f64f},
+	{0x1f900, 0x1f9ff}, {0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
+
+// runeWidth is the number of columns a character takes, like git's
+// git_wcwidth: -1 for control characters, 0 for combining ones.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0:
+		return 0
+	case r < 32 || r >= 0x7f && r < 0xa0:
+		return -1
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf), r >= 0x1160 && r <= 0x11ff, r == 0x200b:
+		return 0
+	}
+	for _, w := range wideRanges {
+		if r >= w.lo && r <= w.hi {
+			return 2
+		}
+	}
+	return 1
+}
+
+// escapeLen is the length of the ANSI color sequence at the start of s,
+// 0 if there is none.
+func escapeLen(s string) int {
+	if !strings.HasPrefix(s, "\033[") {
+		return 0
+	}
+	i := 2
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == ';') {
+		i++
+	}
+	if i == len(s) || s[i] != 'm' {
+		return 0
+	}
+	return i + 1
+}
+
+// displayWidth is the number of columns s takes on a terminal, skipping
+// color sequences, like git's utf8_strnwidth. Invalid UTF-8 counts a
+// column per byte.
+func displayWidth(s string) int {
+	if !utf8.ValidString(s) {
+		return len(s)
+	}
+	width := 0
+	for s != "" {
+		if n := escapeLen(s); n > 0 {
+			s = s[n:]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		if w := runeWidth(r); w > 0 {
+			width += w
+		}
+		s = s[size:]
+	}
+	return width
+}
+
+// utf8Replace replaces the characters of s from column pos on, over
+// width columns, with replacement, like git's strbuf_utf8_replace. It
+// leaves invalid UTF-8 alone.
+func utf8Replace(s string, pos, width int, replacement string) string {
+	if !utf8.ValidString(s) {
+		return s
+	}
+	var sb strings.Builder
+	col := 0
+	for s != "" {
+		if n := escapeLen(s); n > 0 {
+			sb.WriteString(s[:n])
+			s = s[n:]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		w := maxInt(runeWidth(r), 0)
+		if w > 0 && col >= pos && col < pos+width {
+			sb.WriteString(replacement)
+			replacement = ""
+		} else {
+			sb.WriteString(s[:size])
+		}
+		col += w
+		s = s[size:]
+	}
+	return sb.String()
+}
+
+// isGitSpace is git's isspace, which knows only these.
+func isGitSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// isAlnum is git's isalnum, which knows only ASCII.
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// wrapText wraps text at width columns, indenting the first line by
+// indent1 and the others by indent2, the way git's
+// strbuf_add_wrapped_text does. A negative indent1 counts columns taken
+// before the text on its first line. Paragraphs stay apart, and a line
+// that doesn't start with a letter or digit starts a new line.
+func wrapText(text string, indent1, indent2, width int) string {
+	if width <= 0 {
+		return indentText(text, indent1, indent2)
+	}
+	var sb strings.Builder
+	validUTF8 := utf8.ValidString(text)
+	bol, i := 0, 0
+	w, indent := indent1, indent1
+	space := -1
+	if indent < 0 {
+		w, space = -indent, 0
+	}
+	for {
+		for i < len(text) {
+			n := escapeLen(text[i:])
+			if n == 0 {
+				break
+			}
+			i += n
+		}
+		if i == len(text) || isGitSpace(text[i]) {
+			if w <= width || space < 0 {
+				start := bol
+				if i == len(text) && i == start {
+					return sb.String()
+				}
+				if space >= 0 {
+					start = space
+				} else {
+					sb.WriteString(strings.Repeat(" ", maxInt(indent, 0)))
+				}
+				sb.WriteString(text[start:i])
+				if i == len(text) {
+					return sb.String()
+				}
+				space = i
+				switch text[i] {
+				case '\t':
+					w |= 0x07
+				case '\n':
+					space++
+					if space < len(text) && text[space] == '\n' {
+						sb.WriteByte('\n')
+						goto newLine
+					} else if space == len(text) || !isAlnum(text[space]) {
+						goto newLine
+					}
+					sb.WriteByte(' ')
+				}
+				w++
+				i++
+				continue
+			}
+		newLine:
+			sb.WriteByte('\n')
+			i = space
+			if i < len(text) && isGitSpace(text[i]) {
+				i++
+			}
+			bol = i
+			space = -1
+			w, indent = indent2, indent2
+			continue
+		}
+		if validUTF8 {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			w += runeWidth(r)
+			i += size
+		} else {
+			w++
+			i++
+		}
+	}
+}
+
+// indentText indents the first line of text by indent1 columns and the
+// others by indent2, like git's strbuf_add_indented_text.
+func indentText(text string, indent1, indent2 int) string {
+	var sb strings.Builder
+	indent := maxInt(indent1, 0)
+	for text != "" {
+		line := text
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			line = text[:i+1]
+		}
+		sb.WriteString(strings.Repeat(" ", indent))
+		sb.WriteString(line)
+		text = text[len(line):]
+		indent = indent2
+	}
+	return sb.String()
+}
@@ -3,7 +3,7 @@ module github.com/codecrafters-io/git-starter-go
 go 1.16
 
 require (
-	github.com/go-git/go-git/v5 v5.9.0 // indirect
+	github.com/go-git/go-git/v5 v5.9.0
 	github.com/joho/godotenv v1.5.1
 	github.com/labstack/gommon v0.4.0
 )